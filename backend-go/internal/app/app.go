@@ -53,6 +53,15 @@ func New(cfg *config.Config, db *gorm.DB, uploadsDir string) (*Application, erro
 	tripService := services.NewTripService(db, uploadsDir)
 	taskService := services.NewTaskService(db, paymentService, invoiceService)
 	regressionService := services.NewRegressionSampleService(db)
+	importProfileService := services.NewImportProfileService(db)
+	exchangeRateService := services.NewExchangeRateService(db)
+	categoryRuleService := services.NewCategoryRuleService(db)
+	tagService := services.NewTagService(db)
+	searchService := services.NewSearchService(db)
+	budgetService := services.NewBudgetService(db)
+	paymentAccountService := services.NewPaymentAccountService(db)
+	buyerProfileService := services.NewBuyerProfileService(db)
+	dedupReviewService := services.NewDedupReviewService(db, paymentService, invoiceService)
 
 	if cfg.NodeEnv == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -82,8 +91,17 @@ func New(cfg *config.Config, db *gorm.DB, uploadsDir string) (*Application, erro
 	handlers.NewInvoiceHandler(invoiceService, taskService, uploadsDir).RegisterRoutes(protectedGroup.Group("/invoices"))
 	handlers.NewEmailHandler(emailService).RegisterRoutes(protectedGroup.Group("/email"))
 	handlers.NewTripHandler(tripService).RegisterRoutes(protectedGroup.Group("/trips"))
+	handlers.NewImportProfileHandler(importProfileService).RegisterRoutes(protectedGroup.Group("/import-profiles"))
+	handlers.NewExchangeRateHandler(exchangeRateService).RegisterRoutes(protectedGroup.Group("/exchange-rates"))
+	handlers.NewCategoryRuleHandler(categoryRuleService).RegisterRoutes(protectedGroup.Group("/category-rules"))
+	handlers.NewTagHandler(tagService).RegisterRoutes(protectedGroup.Group("/tags"))
+	handlers.NewSearchHandler(searchService).RegisterRoutes(protectedGroup.Group("/search"))
+	handlers.NewBudgetHandler(budgetService).RegisterRoutes(protectedGroup.Group("/budgets"))
+	handlers.NewPaymentAccountHandler(paymentAccountService).RegisterRoutes(protectedGroup.Group("/accounts"))
+	handlers.NewBuyerProfileHandler(buyerProfileService).RegisterRoutes(protectedGroup.Group("/buyer-profiles"))
+	handlers.NewDedupHandler(dedupReviewService).RegisterRoutes(protectedGroup.Group("/dedup"))
 	handlers.NewTaskHandler(taskService).RegisterRoutes(protectedGroup.Group("/tasks"))
-	handlers.NewDashboardHandler(db, paymentService, invoiceService, emailService).RegisterRoutes(protectedGroup)
+	handlers.NewDashboardHandler(db, paymentService, invoiceService, emailService, budgetService).RegisterRoutes(protectedGroup)
 
 	logsGroup := protectedGroup.Group("/logs")
 	logsGroup.Use(middleware.RequireAdmin())
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"testing"
 
+	"smart-bill-manager/internal/middleware"
 	"smart-bill-manager/internal/models"
 )
 
@@ -165,3 +166,47 @@ func assertInvoiceLinkState(t *testing.T, application *Application, invoiceID, p
 		t.Fatalf("成功关联未同步兼容 payment_id: %#v", invoice.PaymentID)
 	}
 }
+
+func TestBulkPaymentOperationsRequireActAsConfirmation(t *testing.T) {
+	application := newTestApplication(t)
+	admin := setupContractAdmin(t, application)
+	member := registerContractMember(t, application, admin.Token)
+
+	created := performContractRequest(t, application, http.MethodPost, "/api/payments", member.Token, map[string]any{
+		"amount":           20,
+		"merchant":         "批量删除商户",
+		"transaction_time": "2026-08-03T10:00:00+08:00",
+	}, nil)
+	assertContractStatus(t, created, http.StatusCreated)
+	var payment models.Payment
+	decodeContractData(t, created, &payment)
+
+	bulkDelete := map[string]any{"ids": []string{payment.ID}, "action": "delete"}
+	unconfirmed := performContractRequest(t, application, http.MethodPost, "/api/payments/bulk", admin.Token, bulkDelete, map[string]string{
+		middleware.HeaderActAsUser: member.ID,
+	})
+	assertContractStatus(t, unconfirmed, http.StatusBadRequest)
+	assertPaymentCount(t, application, 1)
+
+	foreign := performContractRequest(t, application, http.MethodPost, "/api/payments/bulk", admin.Token, bulkDelete, nil)
+	assertContractStatus(t, foreign, http.StatusOK)
+	var result struct {
+		Succeeded int `json:"succeeded"`
+		Failed    int `json:"failed"`
+	}
+	decodeContractData(t, foreign, &result)
+	if result.Succeeded != 0 || result.Failed != 1 {
+		t.Fatalf("批量操作不应触及其他用户的数据: %#v", result)
+	}
+	assertPaymentCount(t, application, 1)
+
+	confirmed := performContractRequest(t, application, http.MethodPost, "/api/payments/bulk", admin.Token, bulkDelete, map[string]string{
+		middleware.HeaderActAsUser:      member.ID,
+		middleware.HeaderActAsConfirmed: "1",
+	})
+	assertContractStatus(t, confirmed, http.StatusOK)
+	assertPaymentCount(t, application, 0)
+
+	invalid := performContractRequest(t, application, http.MethodPost, "/api/payments/bulk", member.Token, map[string]any{"action": "delete"}, nil)
+	assertContractStatus(t, invalid, http.StatusBadRequest)
+}
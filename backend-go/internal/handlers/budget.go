@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"smart-bill-manager/internal/middleware"
+	"smart-bill-manager/internal/services"
+	"smart-bill-manager/internal/utils"
+)
+
+type BudgetHandler struct {
+	budgetService *services.BudgetService
+}
+
+func NewBudgetHandler(budgetService *services.BudgetService) *BudgetHandler {
+	return &BudgetHandler{budgetService: budgetService}
+}
+
+func (h *BudgetHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("", h.List)
+	r.POST("", h.Create)
+	r.GET("/report", h.Report)
+	r.GET("/alerts", h.ListAlerts)
+	r.POST("/alerts/read", h.MarkAlertsRead)
+	r.GET("/:id", h.GetByID)
+	r.PUT("/:id", h.Update)
+	r.DELETE("/:id", h.Delete)
+}
+
+func (h *BudgetHandler) List(c *gin.Context) {
+	budgets, err := h.budgetService.List(middleware.GetEffectiveUserID(c))
+	if err != nil {
+		utils.Error(c, 500, "获取预算失败", err)
+		return
+	}
+	utils.SuccessData(c, budgets)
+}
+
+func (h *BudgetHandler) Create(c *gin.Context) {
+	var input services.BudgetInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	budget, err := h.budgetService.Create(middleware.GetEffectiveUserID(c), input)
+	if err != nil {
+		utils.Error(c, 400, "创建预算失败", err)
+		return
+	}
+	utils.Success(c, 201, "预算创建成功", budget)
+}
+
+func (h *BudgetHandler) GetByID(c *gin.Context) {
+	budget, err := h.budgetService.GetByID(middleware.GetEffectiveUserID(c), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrBudgetNotFound) {
+			utils.Error(c, 404, "预算不存在", err)
+			return
+		}
+		utils.Error(c, 500, "获取预算失败", err)
+		return
+	}
+	utils.SuccessData(c, budget)
+}
+
+func (h *BudgetHandler) Update(c *gin.Context) {
+	var input services.BudgetInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	budget, err := h.budgetService.Update(middleware.GetEffectiveUserID(c), c.Param("id"), input)
+	if err != nil {
+		if errors.Is(err, services.ErrBudgetNotFound) {
+			utils.Error(c, 404, "预算不存在", err)
+			return
+		}
+		utils.Error(c, 400, "更新预算失败", err)
+		return
+	}
+	utils.Success(c, 200, "预算更新成功", budget)
+}
+
+func (h *BudgetHandler) Delete(c *gin.Context) {
+	if err := h.budgetService.Delete(middleware.GetEffectiveUserID(c), c.Param("id")); err != nil {
+		if errors.Is(err, services.ErrBudgetNotFound) {
+			utils.Error(c, 404, "预算不存在", err)
+			return
+		}
+		utils.Error(c, 500, "删除预算失败", err)
+		return
+	}
+	utils.Success(c, 200, "预算删除成功", nil)
+}
+
+// Report returns budget vs actual for the periods containing date (YYYY-MM-DD, default today).
+func (h *BudgetHandler) Report(c *gin.Context) {
+	at := time.Now()
+	if raw := strings.TrimSpace(c.Query("date")); raw != "" {
+		loc, err := time.LoadLocation("Asia/Shanghai")
+		if err != nil {
+			loc = time.UTC
+		}
+		parsed, err := time.ParseInLocation("2006-01-02", raw, loc)
+		if err != nil {
+			utils.Error(c, 400, "date 参数错误", err)
+			return
+		}
+		at = parsed
+	}
+
+	ctx, cancel := withReadTimeout(c)
+	defer cancel()
+
+	report, err := h.budgetService.Report(ctx, middleware.GetEffectiveUserID(c), at)
+	if err != nil {
+		if handleReadTimeoutError(c, err) {
+			return
+		}
+		utils.Error(c, 500, "获取预算执行情况失败", err)
+		return
+	}
+	utils.SuccessData(c, report)
+}
+
+func (h *BudgetHandler) ListAlerts(c *gin.Context) {
+	unreadOnly, err := parseBoolQuery(c, []string{"unread"}, false)
+	if err != nil {
+		utils.Error(c, 400, "unread 参数错误", err)
+		return
+	}
+	alerts, err := h.budgetService.ListAlerts(middleware.GetEffectiveUserID(c), unreadOnly)
+	if err != nil {
+		utils.Error(c, 500, "获取预算提醒失败", err)
+		return
+	}
+	utils.SuccessData(c, alerts)
+}
+
+// MarkAlertsRead marks {"ids": [...]} as read; an empty list marks all alerts.
+func (h *BudgetHandler) MarkAlertsRead(c *gin.Context) {
+	var input struct {
+		IDs []string `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	if err := h.budgetService.MarkAlertsRead(middleware.GetEffectiveUserID(c), input.IDs); err != nil {
+		utils.Error(c, 500, "更新预算提醒失败", err)
+		return
+	}
+	utils.Success(c, 200, "预算提醒已读", nil)
+}
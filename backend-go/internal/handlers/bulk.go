@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"smart-bill-manager/internal/services"
+	"smart-bill-manager/internal/utils"
+)
+
+// writeBulkResult reports the outcome of a bulk payment or invoice operation.
+func writeBulkResult(c *gin.Context, result *services.BulkResult, err error) {
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidBulkRequest) {
+			utils.Error(c, 400, "批量操作参数无效", err)
+			return
+		}
+		utils.Error(c, 500, "批量操作失败", err)
+		return
+	}
+	utils.Success(c, 200, "批量操作完成", result)
+}
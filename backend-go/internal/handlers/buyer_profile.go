@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"smart-bill-manager/internal/middleware"
+	"smart-bill-manager/internal/services"
+	"smart-bill-manager/internal/utils"
+)
+
+type BuyerProfileHandler struct {
+	profileService *services.BuyerProfileService
+}
+
+func NewBuyerProfileHandler(profileService *services.BuyerProfileService) *BuyerProfileHandler {
+	return &BuyerProfileHandler{profileService: profileService}
+}
+
+func (h *BuyerProfileHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("", h.List)
+	r.POST("", h.Create)
+	r.PUT("/:id", h.Update)
+	r.DELETE("/:id", h.Delete)
+}
+
+func (h *BuyerProfileHandler) List(c *gin.Context) {
+	profiles, err := h.profileService.List(middleware.GetEffectiveUserID(c))
+	if err != nil {
+		utils.Error(c, 500, "获取抬头档案失败", err)
+		return
+	}
+	utils.SuccessData(c, profiles)
+}
+
+func (h *BuyerProfileHandler) Create(c *gin.Context) {
+	var input services.BuyerProfileInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	profile, err := h.profileService.Create(middleware.GetEffectiveUserID(c), isAdmin(c), input)
+	if err != nil {
+		if errors.Is(err, services.ErrBuyerProfileForbidden) {
+			utils.Error(c, 403, "公共抬头仅管理员可维护", err)
+			return
+		}
+		utils.Error(c, 400, "创建抬头档案失败", err)
+		return
+	}
+	utils.Success(c, 201, "抬头档案创建成功", profile)
+}
+
+func (h *BuyerProfileHandler) Update(c *gin.Context) {
+	var input services.BuyerProfileInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	profile, err := h.profileService.Update(middleware.GetEffectiveUserID(c), isAdmin(c), c.Param("id"), input)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrBuyerProfileNotFound):
+			utils.Error(c, 404, "抬头档案不存在", err)
+		case errors.Is(err, services.ErrBuyerProfileForbidden):
+			utils.Error(c, 403, "公共抬头仅管理员可维护", err)
+		default:
+			utils.Error(c, 400, "更新抬头档案失败", err)
+		}
+		return
+	}
+	utils.Success(c, 200, "抬头档案更新成功", profile)
+}
+
+func (h *BuyerProfileHandler) Delete(c *gin.Context) {
+	if err := h.profileService.Delete(middleware.GetEffectiveUserID(c), isAdmin(c), c.Param("id")); err != nil {
+		switch {
+		case errors.Is(err, services.ErrBuyerProfileNotFound):
+			utils.Error(c, 404, "抬头档案不存在", err)
+		case errors.Is(err, services.ErrBuyerProfileForbidden):
+			utils.Error(c, 403, "公共抬头仅管理员可维护", err)
+		default:
+			utils.Error(c, 500, "删除抬头档案失败", err)
+		}
+		return
+	}
+	utils.Success(c, 200, "抬头档案删除成功", nil)
+}
+
+func isAdmin(c *gin.Context) bool {
+	return middleware.GetUserRole(c) == "admin"
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"smart-bill-manager/internal/middleware"
+	"smart-bill-manager/internal/services"
+	"smart-bill-manager/internal/utils"
+)
+
+type CategoryRuleHandler struct {
+	categoryRuleService *services.CategoryRuleService
+}
+
+func NewCategoryRuleHandler(categoryRuleService *services.CategoryRuleService) *CategoryRuleHandler {
+	return &CategoryRuleHandler{categoryRuleService: categoryRuleService}
+}
+
+func (h *CategoryRuleHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("", h.List)
+	r.POST("", h.Create)
+	r.POST("/reapply", h.Reapply)
+	r.GET("/:id", h.GetByID)
+	r.PUT("/:id", h.Update)
+	r.DELETE("/:id", h.Delete)
+}
+
+func (h *CategoryRuleHandler) List(c *gin.Context) {
+	rules, err := h.categoryRuleService.List(middleware.GetEffectiveUserID(c))
+	if err != nil {
+		utils.Error(c, 500, "获取分类规则失败", err)
+		return
+	}
+	utils.SuccessData(c, rules)
+}
+
+func (h *CategoryRuleHandler) Create(c *gin.Context) {
+	var input services.CategoryRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	rule, err := h.categoryRuleService.Create(middleware.GetEffectiveUserID(c), input)
+	if err != nil {
+		utils.Error(c, 400, "创建分类规则失败", err)
+		return
+	}
+	utils.Success(c, 201, "分类规则创建成功", rule)
+}
+
+func (h *CategoryRuleHandler) GetByID(c *gin.Context) {
+	rule, err := h.categoryRuleService.GetByID(middleware.GetEffectiveUserID(c), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrCategoryRuleNotFound) {
+			utils.Error(c, 404, "分类规则不存在", err)
+			return
+		}
+		utils.Error(c, 500, "获取分类规则失败", err)
+		return
+	}
+	utils.SuccessData(c, rule)
+}
+
+func (h *CategoryRuleHandler) Update(c *gin.Context) {
+	var input services.CategoryRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	rule, err := h.categoryRuleService.Update(middleware.GetEffectiveUserID(c), c.Param("id"), input)
+	if err != nil {
+		if errors.Is(err, services.ErrCategoryRuleNotFound) {
+			utils.Error(c, 404, "分类规则不存在", err)
+			return
+		}
+		utils.Error(c, 400, "更新分类规则失败", err)
+		return
+	}
+	utils.Success(c, 200, "分类规则更新成功", rule)
+}
+
+func (h *CategoryRuleHandler) Delete(c *gin.Context) {
+	if err := h.categoryRuleService.Delete(middleware.GetEffectiveUserID(c), c.Param("id")); err != nil {
+		if errors.Is(err, services.ErrCategoryRuleNotFound) {
+			utils.Error(c, 404, "分类规则不存在", err)
+			return
+		}
+		utils.Error(c, 500, "删除分类规则失败", err)
+		return
+	}
+	utils.Success(c, 200, "分类规则删除成功", nil)
+}
+
+// Reapply runs the rules over existing payments; dry_run=true only returns the changes and
+// overwrite=true also replaces categories that are already set.
+func (h *CategoryRuleHandler) Reapply(c *gin.Context) {
+	dryRun, err := parseBoolQuery(c, []string{"dry_run", "dryRun"}, false)
+	if err != nil {
+		utils.Error(c, 400, "dry_run 参数错误", err)
+		return
+	}
+	overwrite, err := parseBoolQuery(c, []string{"overwrite"}, false)
+	if err != nil {
+		utils.Error(c, 400, "overwrite 参数错误", err)
+		return
+	}
+	changes, err := h.categoryRuleService.ReapplyToHistory(middleware.GetEffectiveUserID(c), dryRun, overwrite)
+	if err != nil {
+		utils.Error(c, 500, "应用分类规则失败", err)
+		return
+	}
+	if dryRun {
+		utils.Success(c, 200, "分类规则预览完成", changes)
+		return
+	}
+	utils.Success(c, 200, "分类规则已应用", changes)
+}
@@ -9,6 +9,7 @@ import (
 
 	"smart-bill-manager/internal/middleware"
 	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/repository"
 	"smart-bill-manager/internal/services"
 	"smart-bill-manager/internal/utils"
 )
@@ -18,6 +19,7 @@ type DashboardHandler struct {
 	paymentService *services.PaymentService
 	invoiceService *services.InvoiceService
 	emailService   *services.EmailService
+	budgetService  *services.BudgetService
 }
 
 func NewDashboardHandler(
@@ -25,12 +27,14 @@ func NewDashboardHandler(
 	paymentService *services.PaymentService,
 	invoiceService *services.InvoiceService,
 	emailService *services.EmailService,
+	budgetService *services.BudgetService,
 ) *DashboardHandler {
 	return &DashboardHandler{
 		db:             db,
 		paymentService: paymentService,
 		invoiceService: invoiceService,
 		emailService:   emailService,
+		budgetService:  budgetService,
 	}
 }
 
@@ -68,6 +72,16 @@ func (h *DashboardHandler) Get(c *gin.Context) {
 		h.internalError(c, "recent email logs", err)
 		return
 	}
+	budgetReport, err := h.budgetService.Report(ctx, ownerUserID, time.Now())
+	if err != nil {
+		h.internalError(c, "budget report", err)
+		return
+	}
+	unreadAlerts, err := h.budgetService.ListAlerts(ownerUserID, true)
+	if err != nil {
+		h.internalError(c, "budget alerts", err)
+		return
+	}
 
 	type recentPaymentRow struct {
 		models.Payment
@@ -77,7 +91,7 @@ func (h *DashboardHandler) Get(c *gin.Context) {
 	if err := h.db.WithContext(ctx).
 		Table("payments AS p").
 		Select(`p.*, COUNT(l.invoice_id) AS invoice_count`).
-		Joins("LEFT JOIN invoice_payment_links AS l ON l.payment_id = p.id").
+		Joins("LEFT JOIN "+repository.InvoicePaymentPairsTable+" AS l ON l.payment_id = p.id").
 		Where("p.is_draft = 0").
 		Where("p.owner_user_id = ?", ownerUserID).
 		Group("p.id").
@@ -89,22 +103,29 @@ func (h *DashboardHandler) Get(c *gin.Context) {
 	}
 
 	utils.SuccessData(c, gin.H{
+		"currency": paymentStats.BaseCurrency,
 		"payments": gin.H{
 			"totalThisMonth": paymentStats.TotalAmount,
 			"countThisMonth": paymentStats.TotalCount,
 			"categoryStats":  paymentStats.CategoryStats,
 			"dailyStats":     paymentStats.DailyStats,
+			"missingRates":   paymentStats.MissingRateCurrencies,
 		},
 		"recentPayments": recentPayments,
 		"invoices": gin.H{
-			"totalCount":  invoiceStats.TotalCount,
-			"totalAmount": invoiceStats.TotalAmount,
-			"bySource":    invoiceStats.BySource,
+			"totalCount":   invoiceStats.TotalCount,
+			"totalAmount":  invoiceStats.TotalAmount,
+			"bySource":     invoiceStats.BySource,
+			"missingRates": invoiceStats.MissingRateCurrencies,
 		},
 		"email": gin.H{
 			"monitoringStatus": emailStatus,
 			"recentLogs":       recentEmails,
 		},
+		"budgets": gin.H{
+			"items":        budgetReport.Budgets,
+			"unreadAlerts": unreadAlerts,
+		},
 	})
 }
 
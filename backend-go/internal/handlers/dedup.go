@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"smart-bill-manager/internal/middleware"
+	"smart-bill-manager/internal/services"
+	"smart-bill-manager/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+type DedupHandler struct {
+	dedupService *services.DedupReviewService
+}
+
+func NewDedupHandler(dedupService *services.DedupReviewService) *DedupHandler {
+	return &DedupHandler{dedupService: dedupService}
+}
+
+func (h *DedupHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("", h.List)
+	r.POST("/dismiss", h.Dismiss)
+	r.POST("/merge", h.Merge)
+}
+
+func (h *DedupHandler) List(c *gin.Context) {
+	var filter services.DuplicateQueueFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	ctx, cancel := withReadTimeout(c)
+	defer cancel()
+
+	items, total, err := h.dedupService.List(ctx, middleware.GetEffectiveUserID(c), filter)
+	if err != nil {
+		if handleReadTimeoutError(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidDuplicatePair) {
+			utils.Error(c, 400, "参数错误", err)
+			return
+		}
+		utils.Error(c, 500, "获取重复记录失败", err)
+		return
+	}
+	utils.SuccessData(c, gin.H{"items": items, "total": total})
+}
+
+func (h *DedupHandler) Dismiss(c *gin.Context) {
+	var input services.DuplicatePairInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	if err := h.dedupService.Dismiss(middleware.GetEffectiveUserID(c), input); err != nil {
+		writeDedupError(c, "忽略重复记录失败", err)
+		return
+	}
+	utils.Success(c, 200, "已标记为非重复", nil)
+}
+
+func (h *DedupHandler) Merge(c *gin.Context) {
+	var input services.DuplicateMergeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	survivor, err := h.dedupService.Merge(middleware.GetEffectiveUserID(c), input)
+	if err != nil {
+		writeDedupError(c, "合并重复记录失败", err)
+		return
+	}
+	utils.Success(c, 200, "重复记录已合并", survivor)
+}
+
+func writeDedupError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidDuplicatePair):
+		utils.Error(c, 400, "重复记录参数无效", err)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.Error(c, 404, "记录不存在", nil)
+	default:
+		utils.Error(c, 500, message, err)
+	}
+}
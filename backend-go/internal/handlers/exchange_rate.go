@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"smart-bill-manager/internal/middleware"
+	"smart-bill-manager/internal/services"
+	"smart-bill-manager/internal/utils"
+)
+
+type ExchangeRateHandler struct {
+	exchangeRateService *services.ExchangeRateService
+}
+
+func NewExchangeRateHandler(exchangeRateService *services.ExchangeRateService) *ExchangeRateHandler {
+	return &ExchangeRateHandler{exchangeRateService: exchangeRateService}
+}
+
+func (h *ExchangeRateHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("", h.List)
+	r.POST("/import", h.ImportCSV)
+	r.DELETE("/:id", h.Delete)
+	r.GET("/base-currency", h.GetBaseCurrency)
+	r.PUT("/base-currency", h.SetBaseCurrency)
+}
+
+func (h *ExchangeRateHandler) List(c *gin.Context) {
+	limit := 200
+	if v := c.Query("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	rates, err := h.exchangeRateService.ListCtx(c.Request.Context(), middleware.GetEffectiveUserID(c), c.Query("currency"), limit)
+	if err != nil {
+		utils.Error(c, 400, "获取汇率失败", err)
+		return
+	}
+	utils.SuccessData(c, rates)
+}
+
+func (h *ExchangeRateHandler) ImportCSV(c *gin.Context) {
+	_, raw, ok := readImportUpload(c, []string{".csv"}, "仅支持 CSV 汇率文件")
+	if !ok {
+		return
+	}
+	result, err := h.exchangeRateService.ImportCSV(middleware.GetEffectiveUserID(c), raw)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidExchangeCSV) {
+			utils.Error(c, 400, "无法识别的汇率文件，需要日期、币种和汇率列", err)
+			return
+		}
+		utils.Error(c, 500, "导入汇率失败", err)
+		return
+	}
+	utils.Success(c, 200, "汇率导入完成", result)
+}
+
+func (h *ExchangeRateHandler) Delete(c *gin.Context) {
+	if err := h.exchangeRateService.Delete(middleware.GetEffectiveUserID(c), c.Param("id")); err != nil {
+		if errors.Is(err, services.ErrExchangeRateNotFound) {
+			utils.Error(c, 404, "汇率不存在", err)
+			return
+		}
+		utils.Error(c, 500, "删除汇率失败", err)
+		return
+	}
+	utils.Success(c, 200, "汇率删除成功", nil)
+}
+
+func (h *ExchangeRateHandler) GetBaseCurrency(c *gin.Context) {
+	currency, err := h.exchangeRateService.GetBaseCurrencyCtx(c.Request.Context(), middleware.GetEffectiveUserID(c))
+	if err != nil {
+		utils.Error(c, 500, "获取本位币失败", err)
+		return
+	}
+	utils.SuccessData(c, gin.H{"base_currency": currency})
+}
+
+func (h *ExchangeRateHandler) SetBaseCurrency(c *gin.Context) {
+	var input struct {
+		BaseCurrency string `json:"base_currency" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	currency, err := h.exchangeRateService.SetBaseCurrency(middleware.GetEffectiveUserID(c), input.BaseCurrency)
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			utils.Error(c, 404, "用户不存在", err)
+			return
+		}
+		utils.Error(c, 400, "设置本位币失败", err)
+		return
+	}
+	utils.Success(c, 200, "本位币设置成功", gin.H{"base_currency": currency})
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"smart-bill-manager/internal/middleware"
+	"smart-bill-manager/internal/services"
+	"smart-bill-manager/internal/utils"
+)
+
+type ImportProfileHandler struct {
+	importProfileService *services.ImportProfileService
+}
+
+func NewImportProfileHandler(importProfileService *services.ImportProfileService) *ImportProfileHandler {
+	return &ImportProfileHandler{importProfileService: importProfileService}
+}
+
+func (h *ImportProfileHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("", h.List)
+	r.POST("", h.Create)
+	r.GET("/:id", h.GetByID)
+	r.PUT("/:id", h.Update)
+	r.DELETE("/:id", h.Delete)
+}
+
+func (h *ImportProfileHandler) List(c *gin.Context) {
+	profiles, err := h.importProfileService.List(middleware.GetEffectiveUserID(c))
+	if err != nil {
+		utils.Error(c, 500, "获取导入模板失败", err)
+		return
+	}
+	utils.SuccessData(c, profiles)
+}
+
+func (h *ImportProfileHandler) Create(c *gin.Context) {
+	var input services.ImportProfileInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	profile, err := h.importProfileService.Create(middleware.GetEffectiveUserID(c), input)
+	if err != nil {
+		utils.Error(c, 400, "创建导入模板失败", err)
+		return
+	}
+	utils.Success(c, 201, "导入模板创建成功", profile)
+}
+
+func (h *ImportProfileHandler) GetByID(c *gin.Context) {
+	profile, err := h.importProfileService.GetByID(middleware.GetEffectiveUserID(c), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrImportProfileNotFound) {
+			utils.Error(c, 404, "导入模板不存在", err)
+			return
+		}
+		utils.Error(c, 500, "获取导入模板失败", err)
+		return
+	}
+	utils.SuccessData(c, profile)
+}
+
+func (h *ImportProfileHandler) Update(c *gin.Context) {
+	var input services.ImportProfileInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	profile, err := h.importProfileService.Update(middleware.GetEffectiveUserID(c), c.Param("id"), input)
+	if err != nil {
+		if errors.Is(err, services.ErrImportProfileNotFound) {
+			utils.Error(c, 404, "导入模板不存在", err)
+			return
+		}
+		utils.Error(c, 400, "更新导入模板失败", err)
+		return
+	}
+	utils.Success(c, 200, "导入模板更新成功", profile)
+}
+
+func (h *ImportProfileHandler) Delete(c *gin.Context) {
+	if err := h.importProfileService.Delete(middleware.GetEffectiveUserID(c), c.Param("id")); err != nil {
+		if errors.Is(err, services.ErrImportProfileNotFound) {
+			utils.Error(c, 404, "导入模板不存在", err)
+			return
+		}
+		utils.Error(c, 500, "删除导入模板失败", err)
+		return
+	}
+	utils.Success(c, 200, "导入模板删除成功", nil)
+}
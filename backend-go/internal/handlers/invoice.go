@@ -24,6 +24,8 @@ func contentTypeFromInvoiceFilename(filename string) string {
 	switch strings.ToLower(filepath.Ext(filename)) {
 	case ".pdf":
 		return "application/pdf"
+	case ".ofd":
+		return "application/ofd"
 	case ".png":
 		return "image/png"
 	case ".jpg", ".jpeg":
@@ -35,7 +37,7 @@ func contentTypeFromInvoiceFilename(filename string) string {
 
 func isAllowedInvoiceExt(ext string) bool {
 	switch strings.ToLower(ext) {
-	case ".pdf", ".png", ".jpg", ".jpeg":
+	case ".pdf", ".ofd", ".png", ".jpg", ".jpeg":
 		return true
 	default:
 		return false
@@ -69,6 +71,7 @@ func (h *InvoiceHandler) RegisterRoutes(r *gin.RouterGroup) {
 	r.GET("/:id/linked-payments", h.GetLinkedPayments)
 	r.GET("/:id/suggest-payments", h.SuggestPayments)
 	r.GET("/payment/:paymentId", h.GetByPaymentID)
+	r.POST("/bulk", h.Bulk)
 	r.POST("/upload", h.Upload)
 	r.POST("/upload-async", h.UploadAsync)
 	r.POST("/upload-multiple", h.UploadMultiple)
@@ -76,8 +79,15 @@ func (h *InvoiceHandler) RegisterRoutes(r *gin.RouterGroup) {
 	r.POST("/:id/link-payment", h.LinkPayment)
 	r.POST("/:id/parse", h.Parse)
 	r.PUT("/:id", h.Update)
+	r.PUT("/:id/tags", h.SetTags)
 	r.DELETE("/:id", h.Delete)
 	r.DELETE("/:id/unlink-payment", h.UnlinkPayment)
+	r.POST("/:id/rides/match", h.MatchRides)
+	r.PUT("/:id/rides/:rideId/payment", h.SetRidePayment)
+}
+
+func (h *InvoiceHandler) SetTags(c *gin.Context) {
+	setTags(c, h.invoiceService.SetTags)
 }
 
 func (h *InvoiceHandler) UploadAttachment(c *gin.Context) {
@@ -95,7 +105,7 @@ func (h *InvoiceHandler) UploadAttachment(c *gin.Context) {
 
 	ext := strings.ToLower(filepath.Ext(file.Filename))
 	if !isAllowedInvoiceExt(ext) {
-		utils.Error(c, 400, "只支持 PDF 或图片格式（PNG/JPG）", nil)
+		utils.Error(c, 400, "只支持 PDF、OFD 或图片格式（PNG/JPG）", nil)
 		return
 	}
 	if file.Size > 20*1024*1024 {
@@ -202,6 +212,14 @@ func (h *InvoiceHandler) GetAll(c *gin.Context) {
 		utils.Error(c, 400, "参数错误", err)
 		return
 	}
+	if t := strings.TrimSpace(filter.InvoiceType); t != "" && t != "unknown" && !services.IsValidInvoiceType(t) {
+		utils.Error(c, 400, "发票类型无效", nil)
+		return
+	}
+	if v := strings.TrimSpace(filter.BuyerCheck); v != "" && !services.IsValidBuyerCheck(v) {
+		utils.Error(c, 400, "抬头核对状态无效", nil)
+		return
+	}
 
 	ctx, cancel := withReadTimeout(c)
 	defer cancel()
@@ -334,6 +352,19 @@ func (h *InvoiceHandler) GetFile(c *gin.Context) {
 		return
 	}
 
+	// Browsers cannot display OFD, so inline views get an SVG rendering; Download still returns the original file.
+	if services.IsOFDFilename(invoice.Filename) {
+		svg, err := services.RenderOFDPreviewSVG(absPath)
+		if err != nil {
+			utils.Error(c, 422, "OFD 预览生成失败", err)
+			return
+		}
+		c.Header("Content-Disposition", "inline")
+		c.Header("Content-Security-Policy", "default-src 'none'; img-src data:; style-src 'unsafe-inline'")
+		c.Data(200, "image/svg+xml", svg)
+		return
+	}
+
 	c.Header("Content-Disposition", "inline")
 	c.Header("Content-Type", contentTypeFromInvoiceFilename(invoice.Filename))
 	c.File(absPath)
@@ -442,7 +473,7 @@ func (h *InvoiceHandler) Upload(c *gin.Context) {
 
 	ext := strings.ToLower(filepath.Ext(file.Filename))
 	if !isAllowedInvoiceExt(ext) {
-		utils.Error(c, 400, "只支持 PDF 或图片格式（PNG/JPG）", nil)
+		utils.Error(c, 400, "只支持 PDF、OFD 或图片格式（PNG/JPG）", nil)
 		return
 	}
 
@@ -523,15 +554,16 @@ func (h *InvoiceHandler) Upload(c *gin.Context) {
 	}
 
 	dedup := interface{}(nil)
-	if invoice != nil && invoice.DedupStatus == services.DedupStatusSuspected && invoice.InvoiceNumber != nil {
-		no := strings.TrimSpace(*invoice.InvoiceNumber)
-		if no != "" {
-			if cands, derr := h.invoiceService.FindCandidatesByInvoiceNumberForOwner(middleware.GetEffectiveUserID(c), no, invoice.ID, 5); derr == nil && len(cands) > 0 {
-				dedup = gin.H{
-					"kind":       "suspected_duplicate",
-					"reason":     "invoice_number",
-					"candidates": cands,
-				}
+	if invoice != nil && invoice.DedupStatus == services.DedupStatusSuspected {
+		no := ""
+		if invoice.InvoiceNumber != nil {
+			no = *invoice.InvoiceNumber
+		}
+		if reason, cands, derr := h.invoiceService.FindSuspectedDuplicatesForOwner(middleware.GetEffectiveUserID(c), no, invoice.PerceptualHash, invoice.ID); derr == nil && len(cands) > 0 {
+			dedup = gin.H{
+				"kind":       "suspected_duplicate",
+				"reason":     reason,
+				"candidates": cands,
 			}
 		}
 	}
@@ -551,7 +583,7 @@ func (h *InvoiceHandler) UploadAsync(c *gin.Context) {
 
 	ext := strings.ToLower(filepath.Ext(file.Filename))
 	if !isAllowedInvoiceExt(ext) {
-		utils.Error(c, 400, "只支持 PDF 或图片格式（PNG/JPG）", nil)
+		utils.Error(c, 400, "只支持 PDF、OFD 或图片格式（PNG/JPG）", nil)
 		return
 	}
 	if file.Size > 20*1024*1024 {
@@ -989,6 +1021,16 @@ func (h *InvoiceHandler) Delete(c *gin.Context) {
 	utils.Success(c, 200, "发票删除成功", nil)
 }
 
+func (h *InvoiceHandler) Bulk(c *gin.Context) {
+	var input services.BulkInvoiceInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	result, err := h.invoiceService.Bulk(middleware.GetEffectiveUserID(c), input)
+	writeBulkResult(c, result, err)
+}
+
 func (h *InvoiceHandler) LinkPayment(c *gin.Context) {
 	id := c.Param("id")
 
@@ -1030,6 +1072,44 @@ func (h *InvoiceHandler) UnlinkPayment(c *gin.Context) {
 	utils.Success(c, 200, "取消关联成功", nil)
 }
 
+// MatchRides matches the itinerary rides of an invoice to payments of the same fare.
+func (h *InvoiceHandler) MatchRides(c *gin.Context) {
+	result, err := h.invoiceService.MatchRides(middleware.GetEffectiveUserID(c), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.Error(c, 404, "发票不存在", nil)
+			return
+		}
+		utils.Error(c, 500, "匹配行程支付失败", err)
+		return
+	}
+
+	utils.Success(c, 200, fmt.Sprintf("已匹配 %d 笔行程", result.Matched), result)
+}
+
+// SetRidePayment matches one ride to a payment by hand; an empty payment_id clears the match.
+func (h *InvoiceHandler) SetRidePayment(c *gin.Context) {
+	var input struct {
+		PaymentID string `json:"payment_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+
+	ride, err := h.invoiceService.SetRidePayment(middleware.GetEffectiveUserID(c), c.Param("id"), c.Param("rideId"), input.PaymentID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.Error(c, 404, "行程或支付记录不存在", nil)
+			return
+		}
+		utils.Error(c, 500, "更新行程支付失败", err)
+		return
+	}
+
+	utils.Success(c, 200, "更新行程支付成功", ride)
+}
+
 func (h *InvoiceHandler) GetLinkedPayments(c *gin.Context) {
 	id := c.Param("id")
 
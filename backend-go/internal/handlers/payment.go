@@ -10,12 +10,13 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"smart-bill-manager/internal/middleware"
 	"smart-bill-manager/internal/services"
 	"smart-bill-manager/internal/utils"
+
+	"gorm.io/gorm"
 )
 
 type PaymentHandler struct {
@@ -43,7 +44,17 @@ func (h *PaymentHandler) RegisterRoutes(r *gin.RouterGroup) {
 	r.GET("/:id/screenshot", h.GetScreenshot)
 	r.GET("/:id/invoices", h.GetLinkedInvoices)
 	r.GET("/:id/suggest-invoices", h.SuggestInvoices)
+	r.GET("/:id/refunds", h.GetRefunds)
+	r.PUT("/:id/refund-of", h.LinkRefund)
+	r.DELETE("/:id/refund-of", h.UnlinkRefund)
+	r.GET("/:id/splits", h.GetSplits)
+	r.PUT("/:id/splits", h.SetSplits)
+	r.PUT("/:id/tags", h.SetTags)
 	r.POST("", h.Create)
+	r.POST("/bulk", h.Bulk)
+	r.POST("/import", h.ImportBillCSV)
+	r.POST("/import/statement", h.ImportStatement)
+	r.POST("/import/csv", h.ImportMappedCSV)
 	r.POST("/upload-screenshot", h.UploadScreenshot)
 	r.POST("/upload-screenshot-async", h.UploadScreenshotAsync)
 	r.POST("/upload-screenshot/cancel", h.CancelUploadScreenshot)
@@ -140,6 +151,140 @@ func (h *PaymentHandler) Create(c *gin.Context) {
 	utils.Success(c, 201, "支付记录创建成功", payment)
 }
 
+func (h *PaymentHandler) ImportBillCSV(c *gin.Context) {
+	_, raw, ok := readImportUpload(c, []string{".csv"}, "只支持支付宝或微信支付导出的 CSV 账单")
+	if !ok {
+		return
+	}
+
+	result, err := h.paymentService.ImportBillCSV(middleware.GetEffectiveUserID(c), raw)
+	if err != nil {
+		if errors.Is(err, services.ErrUnsupportedBillCSV) {
+			utils.Error(c, 400, "无法识别的账单格式", err)
+			return
+		}
+		respondImportError(c, "导入账单失败", result, err)
+		return
+	}
+
+	utils.Success(c, 200, "账单导入完成", result)
+}
+
+// ImportStatement previews a bank statement by default; pass commit=true to create the new rows.
+func (h *PaymentHandler) ImportStatement(c *gin.Context) {
+	commit, err := parseBoolQuery(c, []string{"commit"}, false)
+	if err != nil {
+		utils.Error(c, 400, "commit 参数错误", err)
+		return
+	}
+	filename, raw, ok := readImportUpload(c, []string{".ofx", ".qfx", ".qif", ".xml", ".053", ".txt"}, "只支持 OFX、QIF 或 CAMT.053 格式的对账单")
+	if !ok {
+		return
+	}
+
+	result, err := h.paymentService.ImportStatement(middleware.GetEffectiveUserID(c), filename, raw, commit)
+	if err != nil {
+		if errors.Is(err, services.ErrUnsupportedStatement) {
+			utils.Error(c, 400, "无法识别的对账单格式", err)
+			return
+		}
+		respondImportError(c, "导入对账单失败", result, err)
+		return
+	}
+
+	if !commit {
+		utils.Success(c, 200, "对账单预览完成", result)
+		return
+	}
+	utils.Success(c, 200, "对账单导入完成", result)
+}
+
+// ImportMappedCSV imports a CSV with a saved column-mapping profile; dry_run=true only reports.
+func (h *PaymentHandler) ImportMappedCSV(c *gin.Context) {
+	dryRun, err := parseBoolQuery(c, []string{"dry_run", "dryRun"}, false)
+	if err != nil {
+		utils.Error(c, 400, "dry_run 参数错误", err)
+		return
+	}
+	profileID := strings.TrimSpace(c.PostForm("profile_id"))
+	if profileID == "" {
+		utils.Error(c, 400, "请选择导入模板", nil)
+		return
+	}
+	_, raw, ok := readImportUpload(c, []string{".csv", ".txt"}, "只支持 CSV 文件")
+	if !ok {
+		return
+	}
+
+	result, err := h.paymentService.ImportMappedCSV(middleware.GetEffectiveUserID(c), profileID, raw, dryRun)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrImportProfileNotFound):
+			utils.Error(c, 404, "导入模板不存在", err)
+		case errors.Is(err, services.ErrInvalidMappedCSV):
+			utils.Error(c, 400, "文件与导入模板不匹配", err)
+		default:
+			respondImportError(c, "导入 CSV 失败", result, err)
+		}
+		return
+	}
+
+	if dryRun {
+		utils.Success(c, 200, "CSV 试导入完成", result)
+		return
+	}
+	utils.Success(c, 200, "CSV 导入完成", result)
+}
+
+// respondImportError reports a failed import together with the rows handled before the failure,
+// so the client still learns which payments were already created.
+func respondImportError(c *gin.Context, message string, result *services.PaymentImportResult, err error) {
+	if result != nil {
+		utils.ErrorData(c, 500, message, result, err)
+		return
+	}
+	utils.Error(c, 500, message, err)
+}
+
+// readImportUpload reads the multipart "file" field of an import request, writing the error
+// response itself when the upload is missing, has the wrong extension or is too large.
+func readImportUpload(c *gin.Context, exts []string, extMessage string) (string, []byte, bool) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		utils.Error(c, 400, "请上传文件", err)
+		return "", nil, false
+	}
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	allowed := false
+	for _, e := range exts {
+		if ext == e {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		utils.Error(c, 400, extMessage, nil)
+		return "", nil, false
+	}
+	if file.Size > 20*1024*1024 {
+		utils.Error(c, 400, "文件大小不能超过20MB", nil)
+		return "", nil, false
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		utils.Error(c, 500, "打开上传文件失败", err)
+		return "", nil, false
+	}
+	defer src.Close()
+	raw, err := io.ReadAll(src)
+	if err != nil {
+		utils.Error(c, 500, "读取上传文件失败", err)
+		return "", nil, false
+	}
+	return file.Filename, raw, true
+}
+
 func (h *PaymentHandler) Update(c *gin.Context) {
 	id := c.Param("id")
 	var input services.UpdatePaymentInput
@@ -154,6 +299,18 @@ func (h *PaymentHandler) Update(c *gin.Context) {
 			utils.ErrorData(c, 409, "检测到重复，请确认是否仍要保存", de, err)
 			return
 		}
+		if errors.Is(err, services.ErrInvalidRefund) {
+			utils.Error(c, 400, "退款关联无效", err)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidPaymentSplit) {
+			utils.Error(c, 400, "拆分金额无效", err)
+			return
+		}
+		if errors.Is(err, services.ErrPaymentAccountNotFound) {
+			utils.Error(c, 400, "支付账户不存在", err)
+			return
+		}
 		utils.Error(c, 404, "支付记录不存在或更新失败", err)
 		return
 	}
@@ -161,6 +318,96 @@ func (h *PaymentHandler) Update(c *gin.Context) {
 	utils.Success(c, 200, "支付记录更新成功", nil)
 }
 
+func (h *PaymentHandler) GetRefunds(c *gin.Context) {
+	refunds, err := h.paymentService.GetRefunds(middleware.GetEffectiveUserID(c), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.Error(c, 404, "支付记录不存在", nil)
+			return
+		}
+		utils.Error(c, 500, "获取退款记录失败", err)
+		return
+	}
+	utils.SuccessData(c, refunds)
+}
+
+func (h *PaymentHandler) LinkRefund(c *gin.Context) {
+	var input struct {
+		OriginalID string `json:"original_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	refund, err := h.paymentService.LinkRefund(middleware.GetEffectiveUserID(c), c.Param("id"), input.OriginalID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.Error(c, 404, "支付记录不存在", nil)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidRefund) {
+			utils.Error(c, 400, "退款关联无效", err)
+			return
+		}
+		utils.Error(c, 500, "关联退款失败", err)
+		return
+	}
+	utils.Success(c, 200, "退款关联成功", refund)
+}
+
+func (h *PaymentHandler) UnlinkRefund(c *gin.Context) {
+	if err := h.paymentService.UnlinkRefund(middleware.GetEffectiveUserID(c), c.Param("id")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.Error(c, 404, "支付记录不存在", nil)
+			return
+		}
+		utils.Error(c, 500, "取消退款关联失败", err)
+		return
+	}
+	utils.Success(c, 200, "已取消退款关联", nil)
+}
+
+func (h *PaymentHandler) GetSplits(c *gin.Context) {
+	splits, err := h.paymentService.GetSplits(middleware.GetEffectiveUserID(c), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.Error(c, 404, "支付记录不存在", nil)
+			return
+		}
+		utils.Error(c, 500, "获取拆分记录失败", err)
+		return
+	}
+	utils.SuccessData(c, splits)
+}
+
+func (h *PaymentHandler) SetSplits(c *gin.Context) {
+	var input struct {
+		Splits []services.PaymentSplitInput `json:"splits"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	splits, err := h.paymentService.SetSplits(middleware.GetEffectiveUserID(c), c.Param("id"), input.Splits)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.Error(c, 404, "支付记录不存在", nil)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidPaymentSplit) {
+			utils.Error(c, 400, "拆分金额无效", err)
+			return
+		}
+		utils.Error(c, 500, "保存拆分失败", err)
+		return
+	}
+	utils.Success(c, 200, "拆分保存成功", splits)
+}
+
+func (h *PaymentHandler) SetTags(c *gin.Context) {
+	setTags(c, h.paymentService.SetTags)
+}
+
 func (h *PaymentHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
 	ownerUserID := middleware.GetEffectiveUserID(c)
@@ -172,6 +419,16 @@ func (h *PaymentHandler) Delete(c *gin.Context) {
 	utils.Success(c, 200, "支付记录删除成功", nil)
 }
 
+func (h *PaymentHandler) Bulk(c *gin.Context) {
+	var input services.BulkPaymentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	result, err := h.paymentService.Bulk(middleware.GetEffectiveUserID(c), input)
+	writeBulkResult(c, result, err)
+}
+
 func (h *PaymentHandler) UploadScreenshot(c *gin.Context) {
 	file, err := c.FormFile("file")
 	if err != nil {
@@ -302,10 +559,10 @@ func (h *PaymentHandler) UploadScreenshot(c *gin.Context) {
 
 	dedup := interface{}(nil)
 	if payment != nil && payment.DedupStatus == services.DedupStatusSuspected {
-		if cands, derr := h.paymentService.FindCandidatesByAmountTimeForOwner(middleware.GetEffectiveUserID(c), payment.Amount, payment.TransactionTimeTs, payment.ID, 5*time.Minute, 5); derr == nil && len(cands) > 0 {
+		if reason, cands, derr := h.paymentService.FindSuspectedDuplicatesForOwner(middleware.GetEffectiveUserID(c), payment.Amount, payment.Currency, payment.TransactionTimeTs, payment.PerceptualHash, payment.ID); derr == nil && len(cands) > 0 {
 			dedup = gin.H{
 				"kind":       "suspected_duplicate",
-				"reason":     "amount_time",
+				"reason":     reason,
 				"candidates": cands,
 			}
 		}
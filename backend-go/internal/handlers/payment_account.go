@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"smart-bill-manager/internal/middleware"
+	"smart-bill-manager/internal/services"
+	"smart-bill-manager/internal/utils"
+)
+
+type PaymentAccountHandler struct {
+	accountService *services.PaymentAccountService
+}
+
+func NewPaymentAccountHandler(accountService *services.PaymentAccountService) *PaymentAccountHandler {
+	return &PaymentAccountHandler{accountService: accountService}
+}
+
+func (h *PaymentAccountHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("", h.List)
+	r.POST("", h.Create)
+	r.GET("/:id", h.GetByID)
+	r.GET("/:id/statement", h.Statement)
+	r.PUT("/:id", h.Update)
+	r.DELETE("/:id", h.Delete)
+}
+
+func (h *PaymentAccountHandler) List(c *gin.Context) {
+	accounts, err := h.accountService.List(middleware.GetEffectiveUserID(c))
+	if err != nil {
+		utils.Error(c, 500, "获取支付账户失败", err)
+		return
+	}
+	utils.SuccessData(c, accounts)
+}
+
+func (h *PaymentAccountHandler) Create(c *gin.Context) {
+	var input services.PaymentAccountInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	account, err := h.accountService.Create(middleware.GetEffectiveUserID(c), input)
+	if err != nil {
+		if errors.Is(err, services.ErrPaymentAccountExists) {
+			utils.Error(c, 409, "支付账户已存在", err)
+			return
+		}
+		utils.Error(c, 400, "创建支付账户失败", err)
+		return
+	}
+	utils.Success(c, 201, "支付账户创建成功", account)
+}
+
+func (h *PaymentAccountHandler) GetByID(c *gin.Context) {
+	account, err := h.accountService.GetByID(middleware.GetEffectiveUserID(c), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrPaymentAccountNotFound) {
+			utils.Error(c, 404, "支付账户不存在", err)
+			return
+		}
+		utils.Error(c, 500, "获取支付账户失败", err)
+		return
+	}
+	utils.SuccessData(c, account)
+}
+
+func (h *PaymentAccountHandler) Update(c *gin.Context) {
+	var input services.PaymentAccountInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	account, err := h.accountService.Update(middleware.GetEffectiveUserID(c), c.Param("id"), input)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrPaymentAccountNotFound):
+			utils.Error(c, 404, "支付账户不存在", err)
+		case errors.Is(err, services.ErrPaymentAccountExists):
+			utils.Error(c, 409, "支付账户已存在", err)
+		default:
+			utils.Error(c, 400, "更新支付账户失败", err)
+		}
+		return
+	}
+	utils.Success(c, 200, "支付账户更新成功", account)
+}
+
+func (h *PaymentAccountHandler) Delete(c *gin.Context) {
+	if err := h.accountService.Delete(middleware.GetEffectiveUserID(c), c.Param("id")); err != nil {
+		if errors.Is(err, services.ErrPaymentAccountNotFound) {
+			utils.Error(c, 404, "支付账户不存在", err)
+			return
+		}
+		utils.Error(c, 500, "删除支付账户失败", err)
+		return
+	}
+	utils.Success(c, 200, "支付账户删除成功", nil)
+}
+
+// Statement returns the account's payments and totals between startDate and endDate (RFC3339).
+func (h *PaymentAccountHandler) Statement(c *gin.Context) {
+	ctx, cancel := withReadTimeout(c)
+	defer cancel()
+
+	statement, err := h.accountService.Statement(ctx, middleware.GetEffectiveUserID(c), c.Param("id"), c.Query("startDate"), c.Query("endDate"))
+	if err != nil {
+		if handleReadTimeoutError(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrPaymentAccountNotFound) {
+			utils.Error(c, 404, "支付账户不存在", err)
+			return
+		}
+		utils.Error(c, 400, "获取账户流水失败", err)
+		return
+	}
+	utils.SuccessData(c, statement)
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"smart-bill-manager/internal/middleware"
+	"smart-bill-manager/internal/services"
+	"smart-bill-manager/internal/utils"
+)
+
+type SearchHandler struct {
+	searchService *services.SearchService
+}
+
+func NewSearchHandler(searchService *services.SearchService) *SearchHandler {
+	return &SearchHandler{searchService: searchService}
+}
+
+func (h *SearchHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("", h.Search)
+}
+
+func (h *SearchHandler) Search(c *gin.Context) {
+	var input services.SearchInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+
+	ctx, cancel := withReadTimeout(c)
+	defer cancel()
+
+	items, total, err := h.searchService.Search(ctx, middleware.GetEffectiveUserID(c), input)
+	if err != nil {
+		if handleReadTimeoutError(c, err) {
+			return
+		}
+		utils.Error(c, 500, "搜索失败", err)
+		return
+	}
+	utils.SuccessData(c, gin.H{
+		"items": items,
+		"total": total,
+	})
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"smart-bill-manager/internal/middleware"
+	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/services"
+	"smart-bill-manager/internal/utils"
+)
+
+type TagHandler struct {
+	tagService *services.TagService
+}
+
+func NewTagHandler(tagService *services.TagService) *TagHandler {
+	return &TagHandler{tagService: tagService}
+}
+
+func (h *TagHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("", h.List)
+	r.POST("", h.Create)
+	r.PUT("/:id", h.Update)
+	r.DELETE("/:id", h.Delete)
+}
+
+func (h *TagHandler) List(c *gin.Context) {
+	tags, err := h.tagService.List(middleware.GetEffectiveUserID(c))
+	if err != nil {
+		utils.Error(c, 500, "获取标签失败", err)
+		return
+	}
+	utils.SuccessData(c, tags)
+}
+
+func (h *TagHandler) Create(c *gin.Context) {
+	var input services.TagInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	tag, err := h.tagService.Create(middleware.GetEffectiveUserID(c), input)
+	if err != nil {
+		if errors.Is(err, services.ErrTagExists) {
+			utils.Error(c, 409, "标签已存在", err)
+			return
+		}
+		utils.Error(c, 400, "创建标签失败", err)
+		return
+	}
+	utils.Success(c, 201, "标签创建成功", tag)
+}
+
+func (h *TagHandler) Update(c *gin.Context) {
+	var input services.TagInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	tag, err := h.tagService.Update(middleware.GetEffectiveUserID(c), c.Param("id"), input)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTagNotFound):
+			utils.Error(c, 404, "标签不存在", err)
+		case errors.Is(err, services.ErrTagExists):
+			utils.Error(c, 409, "标签已存在", err)
+		default:
+			utils.Error(c, 400, "更新标签失败", err)
+		}
+		return
+	}
+	utils.Success(c, 200, "标签更新成功", tag)
+}
+
+func (h *TagHandler) Delete(c *gin.Context) {
+	if err := h.tagService.Delete(middleware.GetEffectiveUserID(c), c.Param("id")); err != nil {
+		if errors.Is(err, services.ErrTagNotFound) {
+			utils.Error(c, 404, "标签不存在", err)
+			return
+		}
+		utils.Error(c, 500, "删除标签失败", err)
+		return
+	}
+	utils.Success(c, 200, "标签删除成功", nil)
+}
+
+// setTags handles PUT /<records>/:id/tags with {"tag_ids": [...]}, replacing the record's tags.
+func setTags(c *gin.Context, set func(ownerUserID string, id string, tagIDs []string) ([]models.Tag, error)) {
+	var input struct {
+		TagIDs []string `json:"tag_ids"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.Error(c, 400, "参数错误", err)
+		return
+	}
+	tags, err := set(middleware.GetEffectiveUserID(c), c.Param("id"), input.TagIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.Error(c, 404, "记录不存在", nil)
+		case errors.Is(err, services.ErrTagNotFound):
+			utils.Error(c, 400, "标签不存在", err)
+		default:
+			utils.Error(c, 500, "保存标签失败", err)
+		}
+		return
+	}
+	if tags == nil {
+		tags = []models.Tag{}
+	}
+	utils.Success(c, 200, "标签保存成功", tags)
+}
@@ -29,13 +29,19 @@ func (h *TripHandler) RegisterRoutes(r *gin.RouterGroup) {
 	r.POST("/pending-payments/:paymentId/block", h.BlockPendingPayment)
 	r.GET("/:id", h.GetByID)
 	r.PUT("/:id", h.Update)
+	r.PUT("/:id/tags", h.SetTags)
 	r.GET("/:id/summary", h.GetSummary)
 	r.GET("/:id/payments", h.GetPayments)
+	r.GET("/:id/journey-suggestion", h.GetJourneySuggestion)
 	r.GET("/:id/export", h.ExportZip)
 	r.GET("/:id/cascade-preview", h.CascadePreview)
 	r.DELETE("/:id", h.DeleteCascade)
 }
 
+func (h *TripHandler) SetTags(c *gin.Context) {
+	setTags(c, h.tripService.SetTags)
+}
+
 func (h *TripHandler) GetSummaries(c *gin.Context) {
 	ctx, cancel := withReadTimeout(c)
 	defer cancel()
@@ -127,6 +133,26 @@ func (h *TripHandler) GetSummary(c *gin.Context) {
 	utils.SuccessData(c, summary)
 }
 
+func (h *TripHandler) GetJourneySuggestion(c *gin.Context) {
+	id := c.Param("id")
+	ctx, cancel := withReadTimeout(c)
+	defer cancel()
+
+	out, err := h.tripService.GetJourneySuggestionCtx(ctx, middleware.GetEffectiveUserID(c), id)
+	if err != nil {
+		if handleReadTimeoutError(c, err) {
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.Error(c, 404, "行程不存在", err)
+			return
+		}
+		utils.Error(c, 500, "获取行程时间建议失败", err)
+		return
+	}
+	utils.SuccessData(c, out)
+}
+
 func (h *TripHandler) GetPayments(c *gin.Context) {
 	id := c.Param("id")
 	includeInvoices := c.Query("includeInvoices") == "1" || c.Query("includeInvoices") == "true"
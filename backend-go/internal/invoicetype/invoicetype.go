@@ -0,0 +1,53 @@
+package invoicetype
+
+import (
+	"regexp"
+	"strings"
+)
+
+// 发票类型取值，存于 invoices.invoice_type；空值表示尚未分类。
+const (
+	VATSpecial    = "vat_special"    // 增值税专用发票（含电子专票）
+	VATOrdinary   = "vat_ordinary"   // 增值税普通发票（含电子普票）
+	Digital       = "digital"        // 数电票：电子发票（普通发票/增值税专用发票）
+	RailwayTicket = "railway_ticket" // 电子发票（铁路电子客票）
+	AirItinerary  = "air_itinerary"  // 航空运输电子客票行程单
+	Toll          = "toll"           // 通行费发票
+	Taxi          = "taxi"           // 出租汽车发票
+	Other         = "other"
+)
+
+// PlateNumberRe 匹配机动车号牌，通行费发票按它识别车牌。
+var PlateNumberRe = regexp.MustCompile(`[京津沪渝冀豫云辽黑湘皖鲁新苏浙赣鄂桂甘晋蒙陕吉闽贵粤青藏川宁琼][A-HJ-NP-Z][·.]?[A-HJ-NP-Z0-9]{4,5}[A-HJ-NP-Z0-9挂学警]`)
+
+// Compact 去掉空白并统一括号，使 "电子发票 (普通发票)" 这类票种标题不受文本层排版影响。
+func Compact(text string) string {
+	return strings.NewReplacer(" ", "", "\t", "", "　", "", "(", "（", ")", "）").Replace(text)
+}
+
+// Classify 按发票文本中的票种标题和各类票据特有的字段判定发票类型；文本为空时返回空值。
+// 客票、通行费和出租车发票同样印有增值税发票标题，因此先于通用标题判定。
+func Classify(text string) string {
+	compact := Compact(text)
+	if strings.TrimSpace(compact) == "" {
+		return ""
+	}
+	has := func(s string) bool { return strings.Contains(compact, s) }
+	switch {
+	case has("铁路电子客票") || (has("电子发票") && has("铁路") && has("客票")):
+		return RailwayTicket
+	case has("航空运输电子客票行程单") || (has("航空运输电子客票") && has("电子客票号码")):
+		return AirItinerary
+	case has("通行费") && (has("车牌号") || has("通行日期") || PlateNumberRe.MatchString(compact)):
+		return Toll
+	case has("出租汽车") || has("出租车") || (has("上车") && has("下车") && has("车号")):
+		return Taxi
+	case has("电子发票（普通发票）") || has("电子发票（增值税专用发票）") || has("全电发票"):
+		return Digital
+	case has("增值税专用发票"):
+		return VATSpecial
+	case has("普通发票"):
+		return VATOrdinary
+	}
+	return Other
+}
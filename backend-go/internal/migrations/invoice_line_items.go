@@ -0,0 +1,39 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// migrateInvoiceLineItems 把已有发票识别结果中的 items 回填到 invoice_line_items。
+// 识别结果优先取 invoice_ocr_blobs，缺失时退回 invoices.extracted_data；已有明细的发票不会重复写入。
+func migrateInvoiceLineItems(db *gorm.DB) error {
+	return execSQL(db, "回填发票明细", `
+		INSERT INTO invoice_line_items (
+			id, owner_user_id, invoice_id, line_no, name, spec, unit, quantity,
+			unit_price, amount_cents, tax_rate, tax_amount_cents, created_at
+		)
+		SELECT
+			src.invoice_id || ':' || j.key,
+			src.owner_user_id,
+			src.invoice_id,
+			j.key + 1,
+			TRIM(json_extract(j.value, '$.name')),
+			NULLIF(TRIM(json_extract(j.value, '$.spec')), ''),
+			NULLIF(TRIM(json_extract(j.value, '$.unit')), ''),
+			json_extract(j.value, '$.quantity'),
+			json_extract(j.value, '$.unit_price'),
+			CAST(ROUND(json_extract(j.value, '$.amount') * 100) AS INTEGER),
+			json_extract(j.value, '$.tax_rate'),
+			CAST(ROUND(json_extract(j.value, '$.tax_amount') * 100) AS INTEGER),
+			CURRENT_TIMESTAMP
+		FROM (
+			SELECT i.id AS invoice_id, i.owner_user_id,
+				CASE WHEN json_valid(COALESCE(b.extracted_data, i.extracted_data))
+					THEN COALESCE(b.extracted_data, i.extracted_data) ELSE '{}' END AS data
+			FROM invoices i
+			LEFT JOIN invoice_ocr_blobs b ON b.invoice_id = i.id
+		) src
+		JOIN json_each(src.data, '$.items') j
+		WHERE json_type(src.data, '$.items') = 'array'
+			AND TRIM(COALESCE(json_extract(j.value, '$.name'), '')) != ''
+			AND NOT EXISTS (SELECT 1 FROM invoice_line_items li WHERE li.invoice_id = src.invoice_id)
+	`)
+}
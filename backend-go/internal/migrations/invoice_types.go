@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"fmt"
+	"strings"
+
+	"smart-bill-manager/internal/invoicetype"
+
+	"gorm.io/gorm"
+)
+
+// migrateInvoiceTypes 回填未分类发票的 invoice_type：识别结果里已带 invoice_type 的直接采用，
+// 否则用 invoicetype.Classify 按识别文本判定，与新上传发票的规则一致。没有识别文本的发票保持未分类。
+func migrateInvoiceTypes(db *gorm.DB) error {
+	type invoiceRow struct {
+		ID            string `gorm:"column:id"`
+		ExtractedType string `gorm:"column:extracted_type"`
+		RawText       string `gorm:"column:raw_text"`
+	}
+	var rows []invoiceRow
+	if err := db.Raw(`
+		SELECT
+			i.id AS id,
+			CASE WHEN json_valid(COALESCE(b.extracted_data, i.extracted_data))
+				THEN COALESCE(json_extract(COALESCE(b.extracted_data, i.extracted_data), '$.invoice_type'), '')
+				ELSE '' END AS extracted_type,
+			COALESCE(NULLIF(b.raw_text, ''), i.raw_text, '') AS raw_text
+		FROM invoices i
+		LEFT JOIN invoice_ocr_blobs b ON b.invoice_id = i.id
+		WHERE COALESCE(i.invoice_type, '') = ''
+	`).Scan(&rows).Error; err != nil {
+		return fmt.Errorf("读取未分类发票失败: %w", err)
+	}
+	for _, row := range rows {
+		invoiceType := strings.TrimSpace(row.ExtractedType)
+		if invoiceType == "" {
+			invoiceType = invoicetype.Classify(row.RawText)
+		}
+		if invoiceType == "" {
+			continue
+		}
+		if err := db.Table("invoices").Where("id = ?", row.ID).Update("invoice_type", invoiceType).Error; err != nil {
+			return fmt.Errorf("回填发票 %s 类型失败: %w", row.ID, err)
+		}
+	}
+	return nil
+}
@@ -28,6 +28,10 @@ type migration struct {
 var registeredMigrations = []migration{
 	{version: 2026080301, name: "legacy_data_and_indexes", up: migrateLegacyDataAndIndexes},
 	{version: 2026080302, name: "money_cents", up: migrateMoneyCents},
+	{version: 2026101701, name: "payment_import_external_id", up: migratePaymentImportIndexes},
+	{version: 2026101702, name: "search_index", up: migrateSearchIndex},
+	{version: 2026101703, name: "invoice_line_items", up: migrateInvoiceLineItems},
+	{version: 2026101704, name: "invoice_types", up: migrateInvoiceTypes},
 }
 
 // Run 先同步表结构，再按版本顺序执行尚未应用的数据迁移。
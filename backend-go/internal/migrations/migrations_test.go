@@ -153,6 +153,36 @@ func TestRunRejectsNewerDatabaseVersion(t *testing.T) {
 	}
 }
 
+func TestRunRejectsDuplicateImportedExternalID(t *testing.T) {
+	db := openTestDB(t)
+	if err := Run(db); err != nil {
+		t.Fatalf("执行迁移失败: %v", err)
+	}
+
+	insert := func(id, owner string) error {
+		return db.Create(&models.Payment{
+			ID:              id,
+			OwnerUserID:     owner,
+			Amount:          1,
+			TransactionTime: "2026-01-02T03:04:05Z",
+			ImportSource:    stringPointer("ofx"),
+			ExternalID:      stringPointer("FIT-1"),
+		}).Error
+	}
+	if err := insert("payment-1", "user-1"); err != nil {
+		t.Fatalf("写入导入支付失败: %v", err)
+	}
+	if err := insert("payment-2", "user-1"); err == nil {
+		t.Fatalf("同一来源交易号重复写入应被唯一索引拒绝")
+	}
+	if err := insert("payment-3", "user-2"); err != nil {
+		t.Fatalf("不同用户的相同交易号应允许写入: %v", err)
+	}
+	if err := db.Create(&models.Payment{ID: "payment-4", OwnerUserID: "user-1", Amount: 1, TransactionTime: "2026-01-02T03:04:05Z"}).Error; err != nil {
+		t.Fatalf("无交易号的支付不应受唯一索引约束: %v", err)
+	}
+}
+
 func openTestDB(t *testing.T) *gorm.DB {
 	t.Helper()
 	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
@@ -188,3 +218,111 @@ func insertLegacyInvoice(t *testing.T, db *gorm.DB, id, date, extractedData, raw
 func stringPointer(value string) *string {
 	return &value
 }
+
+func TestRunBackfillsSearchIndexIdempotently(t *testing.T) {
+	db := openTestDB(t)
+	if err := migrateSchema(db); err != nil {
+		t.Fatalf("初始化结构失败: %v", err)
+	}
+	merchant := "滴滴出行"
+	if err := db.Create(&models.Payment{
+		ID: "payment-1", OwnerUserID: "user-1", Amount: 1, Merchant: &merchant, TransactionTime: "2026-01-02T03:04:05Z",
+	}).Error; err != nil {
+		t.Fatalf("写入已有支付失败: %v", err)
+	}
+	if err := Run(db); err != nil {
+		t.Fatalf("执行迁移失败: %v", err)
+	}
+	if err := migrateSearchIndex(db); err != nil {
+		t.Fatalf("重复执行搜索索引迁移失败: %v", err)
+	}
+
+	var docs []models.SearchDocument
+	if err := db.Find(&docs).Error; err != nil {
+		t.Fatalf("读取搜索文档失败: %v", err)
+	}
+	if len(docs) != 1 || docs[0].DocID != "payment-1" || docs[0].OwnerUserID != "user-1" || docs[0].Title != merchant {
+		t.Fatalf("已有支付应回填且只回填一次: %#v", docs)
+	}
+
+	if err := db.Delete(&models.Payment{}, "id = ?", "payment-1").Error; err != nil {
+		t.Fatalf("删除支付失败: %v", err)
+	}
+	var count int64
+	if err := db.Model(&models.SearchDocument{}).Count(&count).Error; err != nil {
+		t.Fatalf("统计搜索文档失败: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("删除支付后搜索文档应被触发器移除，实际为 %d", count)
+	}
+}
+
+func TestRunBackfillsInvoiceLineItemsIdempotently(t *testing.T) {
+	db := openTestDB(t)
+	if err := migrateSchema(db); err != nil {
+		t.Fatalf("初始化结构失败: %v", err)
+	}
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	insertLegacyInvoice(t, db, "invoice-items", "2026-01-02",
+		`{"items":[{"name":"*餐饮服务*餐费","unit":"次","quantity":1,"amount":100,"tax_rate":0.06,"tax_amount":6},{"name":" "}]}`, "", createdAt)
+	insertLegacyInvoice(t, db, "invoice-broken", "2026-01-02", `not json`, "", createdAt)
+	if err := Run(db); err != nil {
+		t.Fatalf("执行迁移失败: %v", err)
+	}
+	if err := migrateInvoiceLineItems(db); err != nil {
+		t.Fatalf("重复执行发票明细迁移失败: %v", err)
+	}
+
+	var items []models.InvoiceLineItem
+	if err := db.Find(&items).Error; err != nil {
+		t.Fatalf("读取发票明细失败: %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("已有发票明细应回填且只回填一次: %#v", items)
+	}
+	item := items[0]
+	if item.InvoiceID != "invoice-items" || item.LineNo != 1 || item.Name != "*餐饮服务*餐费" ||
+		item.AmountCents == nil || *item.AmountCents != 10000 || item.TaxAmountCents == nil || *item.TaxAmountCents != 600 ||
+		item.TaxRate == nil || *item.TaxRate != 0.06 || item.Unit == nil || *item.Unit != "次" {
+		t.Fatalf("回填的发票明细内容异常: %#v", item)
+	}
+}
+
+func TestRunBackfillsInvoiceTypesIdempotently(t *testing.T) {
+	db := openTestDB(t)
+	if err := migrateSchema(db); err != nil {
+		t.Fatalf("初始化结构失败: %v", err)
+	}
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	insertLegacyInvoice(t, db, "invoice-rail", "2026-01-02", "", "电子发票 (铁路电子客票)\n票价: ￥100.00", createdAt)
+	insertLegacyInvoice(t, db, "invoice-special", "2026-01-02", "", "北京增值税专用发票\n发票代码: 1100191130", createdAt)
+	insertLegacyInvoice(t, db, "invoice-digital", "2026-01-02", `{"invoice_type":"digital"}`, "", createdAt)
+	insertLegacyInvoice(t, db, "invoice-empty", "2026-01-02", "", "", createdAt)
+	insertLegacyInvoice(t, db, "invoice-toll", "2026-01-02", "", "通行费\n项目名称: 经营租赁*通行费 京A12345", createdAt)
+	if err := Run(db); err != nil {
+		t.Fatalf("执行迁移失败: %v", err)
+	}
+	if err := db.Exec(`UPDATE invoices SET invoice_type = 'toll' WHERE id = 'invoice-special'`).Error; err != nil {
+		t.Fatalf("修改发票类型失败: %v", err)
+	}
+	if err := migrateInvoiceTypes(db); err != nil {
+		t.Fatalf("重复执行发票类型迁移失败: %v", err)
+	}
+
+	want := map[string]string{
+		"invoice-rail":    "railway_ticket",
+		"invoice-special": "toll",
+		"invoice-digital": "digital",
+		"invoice-empty":   "",
+		"invoice-toll":    "toll",
+	}
+	var invoices []models.Invoice
+	if err := db.Select("id", "invoice_type").Find(&invoices).Error; err != nil {
+		t.Fatalf("读取发票失败: %v", err)
+	}
+	for _, inv := range invoices {
+		if inv.InvoiceType != want[inv.ID] {
+			t.Fatalf("发票 %s 类型应为 %q，实际为 %q", inv.ID, want[inv.ID], inv.InvoiceType)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// migratePaymentImportIndexes 保证同一用户从同一来源导入的交易号只落库一次，使重复导入对账单幂等。
+func migratePaymentImportIndexes(db *gorm.DB) error {
+	return execSQL(db, "创建支付导入交易号唯一索引", `
+		CREATE UNIQUE INDEX IF NOT EXISTS ux_payments_owner_import_external
+		ON payments(owner_user_id, import_source, external_id)
+		WHERE external_id IS NOT NULL
+	`)
+}
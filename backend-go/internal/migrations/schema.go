@@ -17,10 +17,27 @@ func migrateSchema(db *gorm.DB) error {
 		&models.Trip{},
 		&models.Invoice{},
 		&models.InvoiceAttachment{},
+		&models.InvoiceLineItem{},
+		&models.JourneySegment{},
+		&models.InvoiceRide{},
 		&models.InvoiceOCRBlob{},
 		&models.PaymentOCRBlob{},
 		&models.InvoicePaymentLink{},
 		&models.EmailConfig{},
 		&models.EmailLog{},
+		&models.ImportProfile{},
+		&models.ExchangeRate{},
+		&models.PaymentSplit{},
+		&models.CategoryRule{},
+		&models.Tag{},
+		&models.PaymentTag{},
+		&models.InvoiceTag{},
+		&models.TripTag{},
+		&models.SearchDocument{},
+		&models.Budget{},
+		&models.BudgetAlert{},
+		&models.PaymentAccount{},
+		&models.BuyerProfile{},
+		&models.DedupDismissal{},
 	)
 }
@@ -0,0 +1,124 @@
+package migrations
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// searchSource 描述一类可搜索记录：如何从业务表拼出 search_documents 行，以及哪些表的变更需要重建索引。
+type searchSource struct {
+	docType  string
+	idColumn string // selectSQL 中记录 ID 的列
+	// selectSQL 返回一条 SELECT，列依次为 doc_id, owner_user_id, title, body, doc_time；%s 为额外的过滤条件。
+	selectSQL string
+	watches   []searchWatch
+}
+
+// searchWatch 表示某张表的增删改会影响哪个记录的索引，key 为触发器中引用记录 ID 的列名。
+type searchWatch struct {
+	table string
+	key   string
+}
+
+// joinSearchText 把多个可能为空的文本列拼成以换行分隔的正文。
+func joinSearchText(columns ...string) string {
+	parts := make([]string, 0, len(columns))
+	for _, column := range columns {
+		parts = append(parts, "COALESCE("+column+", '')")
+	}
+	return "TRIM(" + strings.Join(parts, " || char(10) || ") + ")"
+}
+
+var searchSources = []searchSource{
+	{
+		docType:  "payment",
+		idColumn: "p.id",
+		selectSQL: `SELECT p.id, p.owner_user_id,
+				COALESCE(NULLIF(TRIM(p.merchant), ''), p.description, ''),
+				` + joinSearchText("p.merchant", "p.description",
+			"CASE WHEN json_valid(b.extracted_data) THEN json_extract(b.extracted_data, '$.raw_text') END") + `,
+				COALESCE(p.transaction_time, '')
+			FROM payments p
+			LEFT JOIN payment_ocr_blobs b ON b.payment_id = p.id
+			WHERE p.is_draft = 0 %s`,
+		watches: []searchWatch{{table: "payments", key: "id"}, {table: "payment_ocr_blobs", key: "payment_id"}},
+	},
+	{
+		docType:  "invoice",
+		idColumn: "i.id",
+		selectSQL: `SELECT i.id, i.owner_user_id,
+				COALESCE(NULLIF(TRIM(i.seller_name), ''), i.invoice_number, ''),
+				` + joinSearchText("i.invoice_number", "i.seller_name", "i.buyer_name", "COALESCE(b.raw_text, i.raw_text)") + `,
+				COALESCE(i.invoice_date, '')
+			FROM invoices i
+			LEFT JOIN invoice_ocr_blobs b ON b.invoice_id = i.id
+			WHERE i.is_draft = 0 %s`,
+		watches: []searchWatch{{table: "invoices", key: "id"}, {table: "invoice_ocr_blobs", key: "invoice_id"}},
+	},
+	{
+		docType:  "email",
+		idColumn: "e.id",
+		selectSQL: `SELECT e.id, e.owner_user_id,
+				COALESCE(e.subject, ''),
+				` + joinSearchText("e.subject", "e.from_address") + `,
+				COALESCE(e.received_date, '')
+			FROM email_logs e
+			WHERE 1 = 1 %s`,
+		watches: []searchWatch{{table: "email_logs", key: "id"}},
+	},
+}
+
+func (s searchSource) insertSQL(filter string) string {
+	return `INSERT INTO search_documents (doc_type, doc_id, owner_user_id, title, body, doc_time)
+		SELECT '` + s.docType + `', * FROM (` + fmt.Sprintf(s.selectSQL, filter) + `)`
+}
+
+// reindexSQL 删除并按当前数据重建单条记录的索引；草稿或已删除的记录不会重新写入。
+func (s searchSource) reindexSQL(idExpr string) string {
+	return `DELETE FROM search_documents WHERE doc_type = '` + s.docType + `' AND doc_id = ` + idExpr + `;
+		` + s.insertSQL("AND "+s.idColumn+" = "+idExpr) + `;`
+}
+
+// migrateSearchIndex 创建全文搜索的文档表触发器并回填已有记录，之后索引随业务表的增删改自动更新。
+func migrateSearchIndex(db *gorm.DB) error {
+	for _, source := range searchSources {
+		for _, watch := range source.watches {
+			triggers := []struct {
+				suffix string
+				event  string
+				ref    string
+			}{
+				{suffix: "ai", event: "AFTER INSERT", ref: "NEW"},
+				{suffix: "au", event: "AFTER UPDATE", ref: "NEW"},
+				{suffix: "ad", event: "AFTER DELETE", ref: "OLD"},
+			}
+			for _, trigger := range triggers {
+				name := "trg_search_" + watch.table + "_" + trigger.suffix
+				body := source.reindexSQL(trigger.ref + "." + watch.key)
+				if trigger.suffix == "au" && watch.key != "id" {
+					// 大字段换绑到另一条记录时，原记录也要重建。
+					body += "\n" + source.reindexSQL("OLD."+watch.key)
+				}
+				if err := execSQL(db, "删除搜索触发器 "+name, "DROP TRIGGER IF EXISTS "+name); err != nil {
+					return err
+				}
+				if err := execSQL(db, "创建搜索触发器 "+name, fmt.Sprintf(
+					"CREATE TRIGGER %s %s ON %s BEGIN\n%s\nEND", name, trigger.event, watch.table, body,
+				)); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := execSQL(db, "清理 "+source.docType+" 搜索索引",
+			"DELETE FROM search_documents WHERE doc_type = ?", source.docType); err != nil {
+			return err
+		}
+		if err := execSQL(db, "回填 "+source.docType+" 搜索索引", source.insertSQL("")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-bill-manager/internal/money"
+
+	"gorm.io/gorm"
+)
+
+// Budget caps spending on one category (or on everything when Category is empty) per calendar
+// period. Rollover carries the previous period's balance into the current one: surplus carries
+// only money left over, full also carries overspending.
+type Budget struct {
+	ID          string  `json:"id" gorm:"primaryKey"`
+	OwnerUserID string  `json:"owner_user_id" gorm:"not null;default:'';index"`
+	Category    string  `json:"category" gorm:"not null;default:''"`
+	Period      string  `json:"period" gorm:"not null;default:monthly"` // monthly|quarterly|yearly
+	Amount      float64 `json:"amount" gorm:"-"`
+	AmountCents int64   `json:"-" gorm:"not null"`
+	Rollover    string  `json:"rollover" gorm:"not null;default:none"` // none|surplus|full
+	// AlertThresholds are percentages of the available amount that raise an alert once reached.
+	AlertThresholds    []int     `json:"alert_thresholds" gorm:"-"`
+	AlertThresholdsRaw string    `json:"-" gorm:"column:alert_thresholds;not null;default:''"`
+	Enabled            bool      `json:"enabled" gorm:"not null;default:true"`
+	CreatedAt          time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt          time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (Budget) TableName() string {
+	return "budgets"
+}
+
+func (b *Budget) AfterFind(*gorm.DB) error {
+	b.Amount = money.ToMajor(b.AmountCents)
+	b.AlertThresholds = []int{}
+	for _, part := range strings.Split(b.AlertThresholdsRaw, ",") {
+		if v, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			b.AlertThresholds = append(b.AlertThresholds, v)
+		}
+	}
+	return nil
+}
+
+// BudgetAlert records that spending in a budget period reached one of its thresholds. Each
+// threshold alerts at most once per period.
+type BudgetAlert struct {
+	ID          string    `json:"id" gorm:"primaryKey"`
+	OwnerUserID string    `json:"owner_user_id" gorm:"not null;default:'';index"`
+	BudgetID    string    `json:"budget_id" gorm:"not null;uniqueIndex:idx_budget_alerts_period_threshold,priority:1"`
+	PeriodStart string    `json:"period_start" gorm:"not null;uniqueIndex:idx_budget_alerts_period_threshold,priority:2"` // YYYY-MM-DD
+	Threshold   int       `json:"threshold" gorm:"not null;uniqueIndex:idx_budget_alerts_period_threshold,priority:3"`
+	Category    string    `json:"category" gorm:"not null;default:''"`
+	PaymentID   *string   `json:"payment_id"`
+	Spent       float64   `json:"spent" gorm:"-"`
+	SpentCents  int64     `json:"-" gorm:"not null;default:0"`
+	Limit       float64   `json:"limit" gorm:"-"`
+	LimitCents  int64     `json:"-" gorm:"not null;default:0"`
+	Read        bool      `json:"read" gorm:"not null;default:false;index"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (BudgetAlert) TableName() string {
+	return "budget_alerts"
+}
+
+func (a *BudgetAlert) AfterFind(*gorm.DB) error {
+	a.Spent = money.ToMajor(a.SpentCents)
+	a.Limit = money.ToMajor(a.LimitCents)
+	return nil
+}
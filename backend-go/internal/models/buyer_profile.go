@@ -0,0 +1,39 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BuyerProfile is a company invoices may be issued to (发票抬头): its name, other names it is
+// printed under and its 统一社会信用代码. Profiles with an empty OwnerUserID are shared by all users
+// and managed by admins. Invoice buyers are checked against them, see Invoice.BuyerCheck.
+type BuyerProfile struct {
+	ID          string `json:"id" gorm:"primaryKey"`
+	OwnerUserID string `json:"owner_user_id" gorm:"not null;default:'';index"`
+	Name        string `json:"name" gorm:"not null"`
+	TaxID       string `json:"tax_id" gorm:"not null;default:''"`
+	// Aliases are other titles accepted for this company, e.g. its English or former name.
+	Aliases    []string  `json:"aliases" gorm:"-"`
+	AliasesRaw string    `json:"-" gorm:"column:aliases;not null;default:''"`
+	Shared     bool      `json:"shared" gorm:"-"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (BuyerProfile) TableName() string {
+	return "buyer_profiles"
+}
+
+func (profile *BuyerProfile) AfterFind(*gorm.DB) error {
+	profile.Shared = profile.OwnerUserID == ""
+	profile.Aliases = []string{}
+	for _, alias := range strings.Split(profile.AliasesRaw, "\n") {
+		if alias = strings.TrimSpace(alias); alias != "" {
+			profile.Aliases = append(profile.Aliases, alias)
+		}
+	}
+	return nil
+}
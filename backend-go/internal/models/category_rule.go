@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"smart-bill-manager/internal/money"
+
+	"gorm.io/gorm"
+)
+
+// CategoryRule categorizes payments automatically. Every non-empty condition must match; rules
+// run by ascending Priority and the first match decides the category, while any match with
+// BlockTrip keeps the payment out of automatic trip assignment.
+type CategoryRule struct {
+	ID              string    `json:"id" gorm:"primaryKey"`
+	OwnerUserID     string    `json:"owner_user_id" gorm:"not null;default:'';index"`
+	Name            string    `json:"name" gorm:"not null"`
+	Priority        int       `json:"priority" gorm:"not null;default:0;index"`
+	Enabled         bool      `json:"enabled" gorm:"not null;default:true"`
+	MerchantMatch   string    `json:"merchant_match" gorm:"not null;default:contains"` // contains|regex
+	MerchantPattern string    `json:"merchant_pattern" gorm:"not null;default:''"`
+	PaymentMethod   string    `json:"payment_method" gorm:"not null;default:''"` // substring of the payment method
+	MinAmount       *float64  `json:"min_amount" gorm:"-"`
+	MinAmountCents  *int64    `json:"-"`
+	MaxAmount       *float64  `json:"max_amount" gorm:"-"`
+	MaxAmountCents  *int64    `json:"-"`
+	Source          string    `json:"source" gorm:"not null;default:''"` // wechat|alipay|jd|unionpay
+	Category        string    `json:"category" gorm:"not null;default:''"`
+	BlockTrip       bool      `json:"block_trip" gorm:"not null;default:false"`
+	CreatedAt       time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt       time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (CategoryRule) TableName() string {
+	return "category_rules"
+}
+
+func (rule *CategoryRule) AfterFind(*gorm.DB) error {
+	rule.MinAmount, rule.MaxAmount = nil, nil
+	if rule.MinAmountCents != nil {
+		v := money.ToMajor(*rule.MinAmountCents)
+		rule.MinAmount = &v
+	}
+	if rule.MaxAmountCents != nil {
+		v := money.ToMajor(*rule.MaxAmountCents)
+		rule.MaxAmount = &v
+	}
+	return nil
+}
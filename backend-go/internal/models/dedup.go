@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// DedupDismissal records that two payments or two invoices were reviewed and are not
+// duplicates, so the pair stays out of the review queue. FirstID is the smaller of the two IDs.
+type DedupDismissal struct {
+	ID          string    `json:"id" gorm:"primaryKey"`
+	OwnerUserID string    `json:"owner_user_id" gorm:"not null;default:'';index"`
+	Entity      string    `json:"entity" gorm:"not null;uniqueIndex:idx_dedup_dismissals_pair,priority:1"` // payment|invoice
+	FirstID     string    `json:"first_id" gorm:"not null;uniqueIndex:idx_dedup_dismissals_pair,priority:2"`
+	SecondID    string    `json:"second_id" gorm:"not null;uniqueIndex:idx_dedup_dismissals_pair,priority:3"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (DedupDismissal) TableName() string {
+	return "dedup_dismissals"
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// ExchangeRate stores how many CNY one unit of Currency was worth on Date (YYYY-MM-DD).
+// Rates are per owner so each user can import the rates their bank actually applied.
+type ExchangeRate struct {
+	ID          string    `json:"id" gorm:"primaryKey"`
+	OwnerUserID string    `json:"owner_user_id" gorm:"not null;default:'';uniqueIndex:ux_exchange_rates_owner_currency_date,priority:1"`
+	Currency    string    `json:"currency" gorm:"not null;uniqueIndex:ux_exchange_rates_owner_currency_date,priority:2"`
+	Date        string    `json:"date" gorm:"not null;uniqueIndex:ux_exchange_rates_owner_currency_date,priority:3"`
+	Rate        float64   `json:"rate" gorm:"not null"`
+	Source      string    `json:"source" gorm:"not null;default:''"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (ExchangeRate) TableName() string {
+	return "exchange_rates"
+}
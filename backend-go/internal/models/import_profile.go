@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// ImportProfile is a user-defined column mapping for generic CSV payment imports.
+// Column references are header names, or 1-based column numbers when HasHeader is false.
+type ImportProfile struct {
+	ID                  string    `json:"id" gorm:"primaryKey"`
+	OwnerUserID         string    `json:"owner_user_id" gorm:"not null;default:'';index"`
+	Name                string    `json:"name" gorm:"not null"`
+	Encoding            string    `json:"encoding" gorm:"not null;default:auto"` // auto|utf-8|gbk
+	Delimiter           string    `json:"delimiter" gorm:"not null;default:','"`
+	SkipRows            int       `json:"skip_rows" gorm:"not null;default:0"` // lines before the header (or first data row)
+	HasHeader           bool      `json:"has_header" gorm:"not null"`
+	AmountColumn        string    `json:"amount_column" gorm:"not null"`
+	TimeColumn          string    `json:"time_column" gorm:"not null"`
+	MerchantColumn      string    `json:"merchant_column" gorm:"not null;default:''"`
+	CategoryColumn      string    `json:"category_column" gorm:"not null;default:''"`
+	NoteColumn          string    `json:"note_column" gorm:"not null;default:''"`
+	PaymentMethodColumn string    `json:"payment_method_column" gorm:"not null;default:''"`
+	ExternalIDColumn    string    `json:"external_id_column" gorm:"not null;default:''"`
+	DirectionColumn     string    `json:"direction_column" gorm:"not null;default:''"`
+	ExpenseMarker       string    `json:"expense_marker" gorm:"not null;default:''"` // direction value meaning expense, e.g. 支出
+	DateFormat          string    `json:"date_format" gorm:"not null;default:''"`    // e.g. YYYY/MM/DD HH:mm; empty = auto
+	Timezone            string    `json:"timezone" gorm:"not null;default:Asia/Shanghai"`
+	DecimalSeparator    string    `json:"decimal_separator" gorm:"not null;default:'.'"`        // .|,
+	AmountSign          string    `json:"amount_sign" gorm:"not null;default:expense_negative"` // expense_negative|expense_positive|absolute|direction
+	CreatedAt           time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt           time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (ImportProfile) TableName() string {
+	return "import_profiles"
+}
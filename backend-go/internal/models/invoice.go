@@ -19,11 +19,15 @@ type Invoice struct {
 	FilePath       string              `json:"file_path" gorm:"not null"`
 	FileSize       *int64              `json:"file_size"`
 	FileSHA256     *string             `json:"file_sha256" gorm:"index"`
+	PerceptualHash *string             `json:"perceptual_hash"` // 首页渲染图的 64 位 dHash（十六进制），用于近似重复检测
+	InvoiceType    string              `json:"invoice_type" gorm:"not null;default:'';index"`
+	TypeDetails    *InvoiceTypeDetails `json:"type_details,omitempty" gorm:"serializer:json"`
 	InvoiceNumber  *string             `json:"invoice_number"`
 	InvoiceDate    *string             `json:"invoice_date"`
 	InvoiceDateYMD *string             `json:"-" gorm:"index"`
 	Amount         *float64            `json:"amount"` // 兼容旧数据库和元单位 API。
 	AmountCents    *int64              `json:"-" gorm:"index"`
+	Currency       string              `json:"currency" gorm:"not null;default:CNY;index"`
 	BadDebt        bool                `json:"bad_debt" gorm:"not null;default:false;index"`
 	SellerName     *string             `json:"seller_name"`
 	BuyerName      *string             `json:"buyer_name"`
@@ -36,7 +40,14 @@ type Invoice struct {
 	Source         string              `json:"source" gorm:"default:upload"`
 	DedupStatus    string              `json:"dedup_status" gorm:"not null;default:ok;index"`
 	DedupRefID     *string             `json:"dedup_ref_id" gorm:"index"`
+	Warnings       []InvoiceWarning    `json:"warnings,omitempty" gorm:"serializer:json"` // 一致性校验发现的可疑字段
+	WarningCount   int                 `json:"warning_count" gorm:"not null;default:0;index"`
+	BuyerCheck     string              `json:"buyer_check" gorm:"not null;default:'';index"`
 	Attachments    []InvoiceAttachment `json:"attachments,omitempty" gorm:"-"`
+	LineItems      []InvoiceLineItem   `json:"line_items,omitempty" gorm:"-"`
+	Journeys       []JourneySegment    `json:"journeys,omitempty" gorm:"-"`
+	Rides          []InvoiceRide       `json:"rides,omitempty" gorm:"-"`
+	Tags           []Tag               `json:"tags,omitempty" gorm:"-"`
 	CreatedAt      time.Time           `json:"created_at" gorm:"autoCreateTime"`
 }
 
@@ -57,6 +68,9 @@ func (invoice *Invoice) BeforeCreate(*gorm.DB) error {
 	invoice.TaxAmountCents = taxAmountCents
 	invoice.Amount = money.ToMajorPointer(amountCents)
 	invoice.TaxAmount = money.ToMajorPointer(taxAmountCents)
+	if invoice.Currency == "" {
+		invoice.Currency = money.DefaultCurrency
+	}
 	return nil
 }
 
@@ -80,6 +94,36 @@ func (invoice *Invoice) AfterFind(*gorm.DB) error {
 	return nil
 }
 
+// InvoiceWarning is one finding of the invoice consistency check. Field names the invoice field
+// that looks wrong (amount, tax_amount, invoice_number, invoice_date, buyer_tax_id, seller_tax_id
+// or items.N for the N-th line item, counted from 0).
+type InvoiceWarning struct {
+	Code    string `json:"code"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	// Suggestion is a corrected value the user may accept for Field, e.g. a taxpayer number one
+	// OCR confusion away from the printed one that passes its check digit.
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// InvoiceTypeDetails holds the fields only some invoice types carry, e.g. the passenger of a
+// transport ticket or the plate number of a toll invoice.
+type InvoiceTypeDetails struct {
+	Passenger    *string `json:"passenger,omitempty"`     // 乘车人/旅客姓名
+	TicketNumber *string `json:"ticket_number,omitempty"` // 电子客票号
+	PlateNumber  *string `json:"plate_number,omitempty"`  // 车牌号
+	// PeriodStart/PeriodEnd are the toll passage dates or the taxi boarding and alighting times.
+	PeriodStart *string `json:"period_start,omitempty"`
+	PeriodEnd   *string `json:"period_end,omitempty"`
+	// Price breakdown of an air itinerary; Total is what the passenger paid and may exceed the
+	// invoice amount when the development fund is not part of the invoice.
+	Fare            *float64 `json:"fare,omitempty"`             // 票价
+	FuelSurcharge   *float64 `json:"fuel_surcharge,omitempty"`   // 燃油附加费
+	DevelopmentFund *float64 `json:"development_fund,omitempty"` // 民航发展基金
+	OtherTaxes      *float64 `json:"other_taxes,omitempty"`      // 其他税费
+	Total           *float64 `json:"total,omitempty"`            // 合计
+}
+
 // InvoiceAttachment represents an extra file associated with an invoice (e.g. itinerary PDF).
 type InvoiceAttachment struct {
 	ID           string    `json:"id" gorm:"primaryKey"`
@@ -93,12 +137,131 @@ type InvoiceAttachment struct {
 	FileSHA256   *string   `json:"file_sha256" gorm:"index"`
 	Source       string    `json:"source" gorm:"default:email"`
 	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+	// TypeDetails is what was read from an itinerary attachment (passenger, ticket number, fares).
+	TypeDetails *InvoiceTypeDetails `json:"type_details,omitempty" gorm:"serializer:json"`
 }
 
 func (InvoiceAttachment) TableName() string {
 	return "invoice_attachments"
 }
 
+// InvoiceLineItem is one row of an invoice's goods/services table, kept outside the OCR blob so that
+// reports can aggregate by item and tax rate. TaxRate is a fraction (0.13 for 13%); tax-exempt rows
+// have a zero rate. Rows are rebuilt whenever the invoice is parsed again.
+type InvoiceLineItem struct {
+	ID             string    `json:"id" gorm:"primaryKey"`
+	OwnerUserID    string    `json:"owner_user_id" gorm:"not null;default:'';index"`
+	InvoiceID      string    `json:"invoice_id" gorm:"not null;index"`
+	LineNo         int       `json:"line_no" gorm:"not null;default:0"`
+	Name           string    `json:"name" gorm:"not null;index"`
+	Spec           *string   `json:"spec"`
+	Unit           *string   `json:"unit"`
+	Quantity       *float64  `json:"quantity"`
+	UnitPrice      *float64  `json:"unit_price"`
+	Amount         *float64  `json:"amount" gorm:"-"`
+	AmountCents    *int64    `json:"-"`
+	TaxRate        *float64  `json:"tax_rate" gorm:"index"`
+	TaxAmount      *float64  `json:"tax_amount" gorm:"-"`
+	TaxAmountCents *int64    `json:"-"`
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (InvoiceLineItem) TableName() string {
+	return "invoice_line_items"
+}
+
+func (item *InvoiceLineItem) BeforeCreate(*gorm.DB) error {
+	amountCents, err := money.FromMajorPointer(item.Amount)
+	if err != nil {
+		return err
+	}
+	taxAmountCents, err := money.FromMajorPointer(item.TaxAmount)
+	if err != nil {
+		return err
+	}
+	item.AmountCents = amountCents
+	item.TaxAmountCents = taxAmountCents
+	return nil
+}
+
+func (item *InvoiceLineItem) AfterFind(*gorm.DB) error {
+	item.Amount = money.ToMajorPointer(item.AmountCents)
+	item.TaxAmount = money.ToMajorPointer(item.TaxAmountCents)
+	return nil
+}
+
+// JourneySegment is one leg of a transport ticket (a train ride of a railway e-ticket, a flight
+// of an air itinerary), in ticket order. DepartureTime is RFC3339 in the ticket's local time;
+// DepartureTs is its unix milliseconds, 0 when the ticket has no usable departure time.
+// Segments read from an itinerary attachment carry its AttachmentID and are kept when the
+// invoice itself is parsed again.
+type JourneySegment struct {
+	ID            string    `json:"id" gorm:"primaryKey"`
+	OwnerUserID   string    `json:"owner_user_id" gorm:"not null;default:'';index"`
+	InvoiceID     string    `json:"invoice_id" gorm:"not null;index"`
+	SegmentNo     int       `json:"segment_no" gorm:"not null;default:0"`
+	AttachmentID  *string   `json:"attachment_id,omitempty" gorm:"index"`
+	Mode          string    `json:"mode" gorm:"not null;default:'';index"` // rail|air
+	Carrier       *string   `json:"carrier"`
+	Number        *string   `json:"number"` // 车次/航班号
+	Origin        *string   `json:"origin"`
+	Destination   *string   `json:"destination"`
+	DepartureTime *string   `json:"departure_time"`
+	DepartureTs   int64     `json:"departure_ts" gorm:"not null;default:0;index"`
+	SeatClass     *string   `json:"seat_class"`
+	SeatNumber    *string   `json:"seat_number"`
+	Passenger     *string   `json:"passenger"`
+	TicketNumber  *string   `json:"ticket_number"`
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (JourneySegment) TableName() string {
+	return "invoice_journey_segments"
+}
+
+// InvoiceRide is one ride listed on the ride-hailing itinerary (网约车行程单) attached to a taxi
+// invoice. A ride can be matched to the payment that charged it, which also puts the ride into
+// that payment's trip, so an invoice covering rides of several trips is allocated ride by ride.
+// RideTime is the boarding time as RFC3339; RideTs its unix milliseconds, 0 when unknown.
+type InvoiceRide struct {
+	ID           string    `json:"id" gorm:"primaryKey"`
+	OwnerUserID  string    `json:"owner_user_id" gorm:"not null;default:'';index"`
+	InvoiceID    string    `json:"invoice_id" gorm:"not null;index"`
+	AttachmentID *string   `json:"attachment_id,omitempty" gorm:"index"`
+	RideNo       int       `json:"ride_no" gorm:"not null;default:0"`
+	Provider     *string   `json:"provider"` // 滴滴出行/高德打车...
+	CarType      *string   `json:"car_type"`
+	RideTime     *string   `json:"ride_time"`
+	RideTs       int64     `json:"ride_ts" gorm:"not null;default:0;index"`
+	City         *string   `json:"city"`
+	Origin       *string   `json:"origin"`
+	Destination  *string   `json:"destination"`
+	DistanceKm   *float64  `json:"distance_km"`
+	Amount       *float64  `json:"amount" gorm:"-"`
+	AmountCents  *int64    `json:"-"`
+	PaymentID    *string   `json:"payment_id" gorm:"index"`
+	TripID       *string   `json:"trip_id,omitempty" gorm:"-"` // trip of the matched payment
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (InvoiceRide) TableName() string {
+	return "invoice_rides"
+}
+
+func (r *InvoiceRide) BeforeCreate(*gorm.DB) error {
+	cents, err := money.FromMajorPointer(r.Amount)
+	if err != nil {
+		return err
+	}
+	r.AmountCents = cents
+	return nil
+}
+
+func (r *InvoiceRide) AfterFind(*gorm.DB) error {
+	r.Amount = money.ToMajorPointer(r.AmountCents)
+	return nil
+}
+
 // InvoicePaymentLink represents the many-to-many relationship between invoices and payments
 type InvoicePaymentLink struct {
 	InvoiceID string    `json:"invoice_id" gorm:"primaryKey;index"`
@@ -116,4 +279,16 @@ type InvoiceStats struct {
 	TotalAmount float64            `json:"totalAmount"`
 	BySource    map[string]int     `json:"bySource"`
 	ByMonth     map[string]float64 `json:"byMonth"`
+	ByTag       map[string]float64 `json:"byTag"`
+	// ByTaxRate and ByItem sum line-item amounts excluding tax; ByTaxRateTax sums their tax.
+	// Tax rates are keyed as percentages such as "13%", items without a rate as "unknown".
+	ByTaxRate    map[string]float64 `json:"byTaxRate"`
+	ByTaxRateTax map[string]float64 `json:"byTaxRateTax"`
+	ByItem       map[string]float64 `json:"byItem"`
+	// ByType sums amounts per invoice type ("unknown" for unclassified invoices); ByTypeCount counts them.
+	ByType      map[string]float64 `json:"byType"`
+	ByTypeCount map[string]int     `json:"byTypeCount"`
+	// BaseCurrency is the currency TotalAmount and ByMonth are expressed in.
+	BaseCurrency          string   `json:"baseCurrency,omitempty"`
+	MissingRateCurrencies []string `json:"missingRateCurrencies,omitempty"`
 }
@@ -19,18 +19,26 @@ type Payment struct {
 	BadDebt           bool      `json:"bad_debt" gorm:"not null;default:false;index"`
 	Amount            float64   `json:"amount" gorm:"not null"` // 兼容旧数据库和元单位 API。
 	AmountCents       int64     `json:"-" gorm:"not null;default:0;index"`
+	Currency          string    `json:"currency" gorm:"not null;default:CNY;index"`
 	Merchant          *string   `json:"merchant"`
 	Category          *string   `json:"category"`
 	PaymentMethod     *string   `json:"payment_method"`
+	AccountID         *string   `json:"account_id" gorm:"index"`
 	Description       *string   `json:"description"`
 	TransactionTime   string    `json:"transaction_time" gorm:"not null"`
 	TransactionTimeTs int64     `json:"transaction_time_ts" gorm:"not null;default:0;index"`
 	ScreenshotPath    *string   `json:"screenshot_path"`
 	FileSHA256        *string   `json:"file_sha256" gorm:"index"`
+	PerceptualHash    *string   `json:"perceptual_hash"` // 截图的 64 位 dHash（十六进制），用于近似重复检测
 	ExtractedData     *string   `json:"extracted_data"`
 	DedupStatus       string    `json:"dedup_status" gorm:"not null;default:ok;index"`
 	DedupRefID        *string   `json:"dedup_ref_id" gorm:"index"`
+	ImportSource      *string   `json:"import_source"`                          // ofx|qif|camt053|alipay_csv|wechat_csv
+	ExternalID        *string   `json:"external_id"`                            // 导入来源的交易号，与 owner、来源组合唯一
+	RefundOfID        *string   `json:"refund_of_id" gorm:"index"`              // 非空表示本记录是对该支付的退款/冲正，金额为正数
+	RefundKind        string    `json:"refund_kind" gorm:"not null;default:''"` // full|partial，仅退款记录有值
 	CreatedAt         time.Time `json:"created_at" gorm:"autoCreateTime"`
+	Tags              []Tag     `json:"tags,omitempty" gorm:"-"`
 }
 
 func (Payment) TableName() string {
@@ -44,6 +52,9 @@ func (payment *Payment) BeforeCreate(*gorm.DB) error {
 	}
 	payment.AmountCents = cents
 	payment.Amount = money.ToMajor(cents)
+	if payment.Currency == "" {
+		payment.Currency = money.DefaultCurrency
+	}
 	return nil
 }
 
@@ -66,4 +77,9 @@ type PaymentStats struct {
 	CategoryStats map[string]float64 `json:"categoryStats"`
 	MerchantStats map[string]float64 `json:"merchantStats"`
 	DailyStats    map[string]float64 `json:"dailyStats"`
+	TagStats      map[string]float64 `json:"tagStats"`
+	AccountStats  map[string]float64 `json:"accountStats"` // keyed by account id, "none" for no account
+	// BaseCurrency is the currency all amounts above are expressed in.
+	BaseCurrency          string   `json:"baseCurrency,omitempty"`
+	MissingRateCurrencies []string `json:"missingRateCurrencies,omitempty"`
 }
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PaymentAccount is a card, wallet or bank account payments are made from. Payments point to it
+// through Payment.AccountID; OCR'd payment methods are mapped by issuer, last four digits and
+// the account's aliases.
+type PaymentAccount struct {
+	ID          string `json:"id" gorm:"primaryKey"`
+	OwnerUserID string `json:"owner_user_id" gorm:"not null;default:'';uniqueIndex:idx_payment_accounts_owner_name"`
+	Name        string `json:"name" gorm:"not null;uniqueIndex:idx_payment_accounts_owner_name"`
+	Type        string `json:"type" gorm:"not null;default:other"` // credit_card|debit_card|wallet|bank_account|cash|other
+	Issuer      string `json:"issuer" gorm:"not null;default:''"`  // 招商银行, 微信, 支付宝...
+	LastFour    string `json:"last_four" gorm:"not null;default:''"`
+	Currency    string `json:"currency" gorm:"not null;default:CNY"`
+	// Aliases are extra payment method texts that always map to this account.
+	Aliases    []string  `json:"aliases" gorm:"-"`
+	AliasesRaw string    `json:"-" gorm:"column:aliases;not null;default:''"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (PaymentAccount) TableName() string {
+	return "payment_accounts"
+}
+
+func (account *PaymentAccount) AfterFind(*gorm.DB) error {
+	account.Aliases = []string{}
+	for _, alias := range strings.Split(account.AliasesRaw, "\n") {
+		if alias = strings.TrimSpace(alias); alias != "" {
+			account.Aliases = append(account.Aliases, alias)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"smart-bill-manager/internal/money"
+
+	"gorm.io/gorm"
+)
+
+// PaymentSplit allocates part of a payment to its own category and trip. A payment either has
+// no splits or splits whose AmountCents add up to the payment's AmountCents. An empty Category
+// falls back to the payment's; with TripAssignSrc auto the TripID follows the payment's trip,
+// manual keeps the chosen trip and blocked keeps the allocation out of trips.
+type PaymentSplit struct {
+	ID            string    `json:"id" gorm:"primaryKey"`
+	OwnerUserID   string    `json:"owner_user_id" gorm:"not null;default:'';index"`
+	PaymentID     string    `json:"payment_id" gorm:"not null;index"`
+	Amount        float64   `json:"amount" gorm:"-"`
+	AmountCents   int64     `json:"-" gorm:"not null"`
+	Category      *string   `json:"category"`
+	TripID        *string   `json:"trip_id" gorm:"index"`
+	TripAssignSrc string    `json:"trip_assignment_source" gorm:"column:trip_assignment_source;not null;default:auto;index"`
+	Note          *string   `json:"note"`
+	SortOrder     int       `json:"sort_order" gorm:"not null;default:0"`
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (PaymentSplit) TableName() string {
+	return "payment_splits"
+}
+
+func (split *PaymentSplit) AfterFind(*gorm.DB) error {
+	split.Amount = money.ToMajor(split.AmountCents)
+	return nil
+}
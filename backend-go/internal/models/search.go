@@ -0,0 +1,17 @@
+package models
+
+// SearchDocument is one searchable record in the full-text index. Rows are maintained by database
+// triggers on payments, invoices, their OCR blobs and email logs; application code only reads them.
+type SearchDocument struct {
+	ID          int64  `json:"-" gorm:"primaryKey;autoIncrement"`
+	DocType     string `json:"doc_type" gorm:"not null;uniqueIndex:idx_search_documents_doc,priority:1"` // payment|invoice|email
+	DocID       string `json:"doc_id" gorm:"not null;uniqueIndex:idx_search_documents_doc,priority:2"`
+	OwnerUserID string `json:"-" gorm:"not null;default:'';index"`
+	Title       string `json:"title" gorm:"not null;default:''"`
+	Body        string `json:"body" gorm:"not null;default:''"`
+	DocTime     string `json:"doc_time" gorm:"not null;default:''"`
+}
+
+func (SearchDocument) TableName() string {
+	return "search_documents"
+}
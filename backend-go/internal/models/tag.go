@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// Tag is a user-defined label that can be attached to payments, invoices and trips.
+type Tag struct {
+	ID          string    `json:"id" gorm:"primaryKey"`
+	OwnerUserID string    `json:"owner_user_id" gorm:"not null;default:'';uniqueIndex:idx_tags_owner_name"`
+	Name        string    `json:"name" gorm:"not null;uniqueIndex:idx_tags_owner_name"`
+	Color       string    `json:"color" gorm:"not null;default:''"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (Tag) TableName() string {
+	return "tags"
+}
+
+// PaymentTag links a tag to a payment.
+type PaymentTag struct {
+	PaymentID string    `json:"payment_id" gorm:"primaryKey;index"`
+	TagID     string    `json:"tag_id" gorm:"primaryKey;index"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (PaymentTag) TableName() string {
+	return "payment_tags"
+}
+
+// InvoiceTag links a tag to an invoice.
+type InvoiceTag struct {
+	InvoiceID string    `json:"invoice_id" gorm:"primaryKey;index"`
+	TagID     string    `json:"tag_id" gorm:"primaryKey;index"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (InvoiceTag) TableName() string {
+	return "invoice_tags"
+}
+
+// TripTag links a tag to a trip.
+type TripTag struct {
+	TripID    string    `json:"trip_id" gorm:"primaryKey;index"`
+	TagID     string    `json:"tag_id" gorm:"primaryKey;index"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (TripTag) TableName() string {
+	return "trip_tags"
+}
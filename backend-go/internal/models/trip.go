@@ -18,6 +18,7 @@ type Trip struct {
 	Note            *string   `json:"note"`
 	CreatedAt       time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt       time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	Tags            []Tag     `json:"tags,omitempty" gorm:"-"`
 }
 
 func (Trip) TableName() string {
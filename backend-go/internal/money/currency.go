@@ -0,0 +1,48 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency 是历史数据和未指定币种记录使用的币种，也是汇率表的计价基准。
+const DefaultCurrency = "CNY"
+
+var ErrInvalidCurrency = errors.New("币种代码无效")
+
+// NormalizeCurrency 将币种规范为 ISO 4217 三位大写字母代码，空值视为人民币。
+// 所有币种的金额分字段统一按 1/100 主单位存储，与币种自身的小数位数无关。
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	switch code {
+	case "":
+		return DefaultCurrency, nil
+	case "RMB", "¥", "￥":
+		return DefaultCurrency, nil
+	}
+	if len(code) != 3 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidCurrency, code)
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("%w: %q", ErrInvalidCurrency, code)
+		}
+	}
+	return code, nil
+}
+
+// ConvertCents 按汇率换算整数分金额，结果四舍五入到分。
+func ConvertCents(cents int64, rate float64) (int64, error) {
+	if math.IsNaN(rate) || math.IsInf(rate, 0) || rate <= 0 {
+		return 0, fmt.Errorf("%w: 汇率无效", ErrInvalidAmount)
+	}
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(rate, 'f', -1, 64))
+	if !ok {
+		return 0, fmt.Errorf("%w: 汇率无效", ErrInvalidAmount)
+	}
+	return roundToCents(new(big.Rat).Mul(new(big.Rat).SetInt64(cents), r))
+}
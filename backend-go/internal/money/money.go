@@ -29,7 +29,11 @@ func FromMajor(value float64) (int64, error) {
 	if !ok {
 		return 0, ErrInvalidAmount
 	}
-	scaled := new(big.Rat).Mul(rational, big.NewRat(scale, 1))
+	return roundToCents(new(big.Rat).Mul(rational, big.NewRat(scale, 1)))
+}
+
+// roundToCents 将以分为单位的有理数按四舍五入（远离零）取整。
+func roundToCents(scaled *big.Rat) (int64, error) {
 	quotient, remainder := new(big.Int), new(big.Int)
 	quotient.QuoRem(scaled.Num(), scaled.Denom(), remainder)
 
@@ -58,3 +58,31 @@ func TestSyncUpdateMap(t *testing.T) {
 		t.Fatalf("空金额未同步到分字段: %#v", nullable)
 	}
 }
+
+func TestNormalizeCurrency(t *testing.T) {
+	for input, want := range map[string]string{"": "CNY", "rmb": "CNY", " usd ": "USD", "JPY": "JPY"} {
+		got, err := NormalizeCurrency(input)
+		if err != nil || got != want {
+			t.Fatalf("NormalizeCurrency(%q)=%q,%v，期望 %q", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"US", "US1", "美元"} {
+		if _, err := NormalizeCurrency(input); !errors.Is(err, ErrInvalidCurrency) {
+			t.Fatalf("应拒绝币种 %q，实际错误为 %v", input, err)
+		}
+	}
+}
+
+func TestConvertCents(t *testing.T) {
+	got, err := ConvertCents(1000, 7.1234)
+	if err != nil || got != 7123 {
+		t.Fatalf("ConvertCents(1000, 7.1234)=%d,%v，期望 7123", got, err)
+	}
+	got, err = ConvertCents(-1005, 0.5)
+	if err != nil || got != -503 {
+		t.Fatalf("ConvertCents(-1005, 0.5)=%d,%v，期望 -503", got, err)
+	}
+	if _, err := ConvertCents(100, 0); !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("应拒绝零汇率，实际错误为 %v", err)
+	}
+}
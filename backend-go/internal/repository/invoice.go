@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -103,6 +104,14 @@ type InvoiceFilter struct {
 	// StartDate/EndDate are "YYYY-MM-DD" prefixes for filtering invoice_date.
 	StartDate string
 	EndDate   string
+	// TagIDs keeps invoices carrying every one of these tags.
+	TagIDs []string
+	// HasWarnings keeps only invoices flagged by the consistency validator.
+	HasWarnings bool
+	// InvoiceType keeps invoices of one type; "unknown" selects unclassified invoices.
+	InvoiceType string
+	// BuyerCheck keeps invoices with one buyer check result; "mismatch" selects every failed check.
+	BuyerCheck string
 	// IncludeDraft controls whether draft records are included.
 	// By default, drafts are hidden from normal list/stats flows.
 	IncludeDraft bool
@@ -129,6 +138,29 @@ func (r *InvoiceRepository) buildFindAllQuery(ctx context.Context, filter Invoic
 		query = query.Where("invoice_date_ymd IS NOT NULL AND LENGTH(invoice_date_ymd) = 10")
 		query = query.Where("invoice_date_ymd >= ? AND invoice_date_ymd <= ?", start, end)
 	}
+	if tagIDs := uniqueNonEmpty(filter.TagIDs); len(tagIDs) > 0 {
+		query = query.Where("id IN (?)", r.db.Table("invoice_tags").
+			Select("invoice_id").
+			Where("tag_id IN ?", tagIDs).
+			Group("invoice_id").
+			Having("COUNT(DISTINCT tag_id) = ?", len(tagIDs)))
+	}
+	if filter.HasWarnings {
+		query = query.Where("warning_count > 0")
+	}
+	if invoiceType := strings.TrimSpace(filter.InvoiceType); invoiceType != "" {
+		if invoiceType == "unknown" {
+			invoiceType = ""
+		}
+		query = query.Where("invoice_type = ?", invoiceType)
+	}
+	if buyerCheck := strings.TrimSpace(filter.BuyerCheck); buyerCheck != "" {
+		if buyerCheck == "mismatch" {
+			query = query.Where("buyer_check NOT IN ?", []string{"", "ok"})
+		} else {
+			query = query.Where("buyer_check = ?", buyerCheck)
+		}
+	}
 	return query
 }
 
@@ -145,6 +177,17 @@ func (r *InvoiceRepository) FindAll(filter InvoiceFilter) ([]models.Invoice, err
 	return invoices, err
 }
 
+// FindIDs returns the IDs of invoices matching the filter, newest first, ignoring paging.
+func (r *InvoiceRepository) FindIDs(filter InvoiceFilter, limit int) ([]string, error) {
+	query := r.buildFindAllQuery(context.Background(), filter).Order("created_at DESC, id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var ids []string
+	err := query.Pluck("id", &ids).Error
+	return ids, err
+}
+
 func (r *InvoiceRepository) FindAllPaged(filter InvoiceFilter, selectCols []string) ([]models.Invoice, int64, error) {
 	return r.FindAllPagedCtx(context.Background(), filter, selectCols)
 }
@@ -192,8 +235,9 @@ func (r *InvoiceRepository) FindUnlinkedCtx(ctx context.Context, ownerUserID str
 		return nil, 0, fmt.Errorf("missing owner_user_id")
 	}
 
-	// Consider an invoice "linked" only if there is at least one valid link to an existing non-draft payment.
-	// This avoids legacy invoices.payment_id noise and prevents broken/stale link rows from hiding invoices.
+	// Consider an invoice "linked" only if there is at least one valid link to an existing non-draft payment,
+	// directly or through a matched ride. This avoids legacy invoices.payment_id noise and prevents
+	// broken/stale link rows from hiding invoices.
 	base := db.WithContext(ctx).
 		Model(&models.Invoice{}).
 		Where("invoices.is_draft = 0").
@@ -201,7 +245,7 @@ func (r *InvoiceRepository) FindUnlinkedCtx(ctx context.Context, ownerUserID str
 		Where(`
 			NOT EXISTS (
 				SELECT 1
-				FROM invoice_payment_links AS l
+				FROM ` + InvoicePaymentPairsTable + ` AS l
 				JOIN payments AS p ON p.id = l.payment_id AND p.is_draft = 0 AND p.owner_user_id = invoices.owner_user_id
 				WHERE l.invoice_id = invoices.id
 			)
@@ -246,7 +290,7 @@ func (r *InvoiceRepository) FindByPaymentIDCtx(ctx context.Context, ownerUserID
 		Model(&models.Invoice{}).
 		Where("owner_user_id = ? AND is_draft = 0", ownerUserID).
 		Where(`
-			id IN (SELECT invoice_id FROM invoice_payment_links WHERE payment_id = ?)
+			id IN (SELECT invoice_id FROM `+InvoicePaymentPairsTable+` AS l WHERE payment_id = ?)
 			OR payment_id = ?
 		`, paymentID, paymentID).
 		Order("created_at DESC").
@@ -307,6 +351,12 @@ func (r *InvoiceRepository) GetStats(ownerUserID string, startDate string, endDa
 }
 
 func (r *InvoiceRepository) GetStatsCtx(ctx context.Context, ownerUserID string, startDate string, endDate string) (*models.InvoiceStats, error) {
+	return r.GetConvertedStatsCtx(ctx, ownerUserID, startDate, endDate, nil)
+}
+
+// GetConvertedStatsCtx is GetStatsCtx with amounts converted per currency and invoice date.
+// Groups whose currency has no rate are left out of the sums and listed in MissingRateCurrencies.
+func (r *InvoiceRepository) GetConvertedStatsCtx(ctx context.Context, ownerUserID string, startDate string, endDate string, convert CentsConverter) (*models.InvoiceStats, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -318,8 +368,14 @@ func (r *InvoiceRepository) GetStatsCtx(ctx context.Context, ownerUserID string,
 	endDate = strings.TrimSpace(endDate)
 
 	stats := &models.InvoiceStats{
-		BySource: make(map[string]int),
-		ByMonth:  make(map[string]float64),
+		BySource:     make(map[string]int),
+		ByMonth:      make(map[string]float64),
+		ByTag:        make(map[string]float64),
+		ByTaxRate:    make(map[string]float64),
+		ByTaxRateTax: make(map[string]float64),
+		ByItem:       make(map[string]float64),
+		ByType:       make(map[string]float64),
+		ByTypeCount:  make(map[string]int),
 	}
 
 	applyDate := func(q *gorm.DB) *gorm.DB {
@@ -330,20 +386,55 @@ func (r *InvoiceRepository) GetStatsCtx(ctx context.Context, ownerUserID string,
 		return q
 	}
 
-	type totalsRow struct {
-		TotalCount int64 `gorm:"column:total_count"`
-		TotalCents int64 `gorm:"column:total_cents"`
+	type sumRow struct {
+		Key        string `gorm:"column:k"`
+		Currency   string `gorm:"column:currency"`
+		Day        string `gorm:"column:day"`
+		TotalCents int64  `gorm:"column:total_cents"`
+		TotalCount int64  `gorm:"column:total_count"`
+	}
+	missing := map[string]bool{}
+	sumBy := func(table string, keyExpr string, extra string) (map[string]int64, int64, error) {
+		selectSQL := keyExpr + ` AS k, COALESCE(SUM(amount_cents), 0) AS total_cents, COUNT(*) AS total_count`
+		group := "k"
+		if convert != nil {
+			selectSQL += `, currency, COALESCE(invoice_date_ymd, '') AS day`
+			group = "k, currency, day"
+		}
+		q := r.db.WithContext(ctx).
+			Table(table).
+			Where("is_draft = 0 AND owner_user_id = ?", ownerUserID)
+		if extra != "" {
+			q = q.Where(extra)
+		}
+		var rows []sumRow
+		if err := applyDate(q).Select(selectSQL).Group(group).Scan(&rows).Error; err != nil {
+			return nil, 0, err
+		}
+		out := make(map[string]int64, len(rows))
+		var count int64
+		for _, row := range rows {
+			count += row.TotalCount
+			cents := row.TotalCents
+			if convert != nil {
+				converted, ok := convert(cents, row.Currency, row.Day)
+				if !ok {
+					missing[row.Currency] = true
+					continue
+				}
+				cents = converted
+			}
+			out[row.Key] += cents
+		}
+		return out, count, nil
 	}
-	var totals totalsRow
-	if err := applyDate(r.db.WithContext(ctx).
-		Table("invoices").
-		Where("is_draft = 0 AND owner_user_id = ?", ownerUserID).
-		Select("COUNT(*) AS total_count, COALESCE(SUM(amount_cents), 0) AS total_cents"),
-	).Scan(&totals).Error; err != nil {
+
+	totals, count, err := sumBy("invoices", `''`, "")
+	if err != nil {
 		return nil, err
 	}
-	stats.TotalCount = int(totals.TotalCount)
-	stats.TotalAmount = money.ToMajor(totals.TotalCents)
+	stats.TotalCount = int(count)
+	stats.TotalAmount = money.ToMajor(totals[""])
 
 	// By source
 	type srcRow struct {
@@ -363,30 +454,103 @@ func (r *InvoiceRepository) GetStatsCtx(ctx context.Context, ownerUserID string,
 		stats.BySource[r.Source] = int(r.Cnt)
 	}
 
-	// By month (YYYY-MM)
-	type monthRow struct {
-		Month      string `gorm:"column:m"`
-		TotalCents int64  `gorm:"column:total_cents"`
-	}
-	var monthRows []monthRow
+	// By invoice type
+	var typeRows []srcRow
 	if err := applyDate(r.db.WithContext(ctx).
 		Table("invoices").
 		Where("is_draft = 0 AND owner_user_id = ?", ownerUserID).
-		Where("invoice_date_ymd IS NOT NULL AND LENGTH(invoice_date_ymd) >= 7 AND amount_cents IS NOT NULL").
-		Select(`SUBSTR(invoice_date_ymd, 1, 7) AS m, COALESCE(SUM(amount_cents), 0) AS total_cents`).
-		Group("m"),
-	).Scan(&monthRows).Error; err != nil {
+		Select(invoiceTypeKey + ` AS src, COUNT(*) AS cnt`).
+		Group("src"),
+	).Scan(&typeRows).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range typeRows {
+		stats.ByTypeCount[r.Source] = int(r.Cnt)
+	}
+	types, _, err := sumBy("invoices", invoiceTypeKey, "amount_cents IS NOT NULL")
+	if err != nil {
 		return nil, err
 	}
-	for _, r := range monthRows {
-		if len(r.Month) == 7 {
-			stats.ByMonth[r.Month] = money.ToMajor(r.TotalCents)
+	for invoiceType, cents := range types {
+		stats.ByType[invoiceType] = money.ToMajor(cents)
+	}
+
+	// By month (YYYY-MM)
+	months, _, err := sumBy("invoices", `SUBSTR(invoice_date_ymd, 1, 7)`,
+		"invoice_date_ymd IS NOT NULL AND LENGTH(invoice_date_ymd) >= 7 AND amount_cents IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	for month, cents := range months {
+		if len(month) == 7 {
+			stats.ByMonth[month] = money.ToMajor(cents)
 		}
 	}
 
+	// By tag; an invoice with several tags counts towards each of them.
+	tags, _, err := sumBy(invoiceTagsTable, `tag_name`, "amount_cents IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	for tag, cents := range tags {
+		stats.ByTag[tag] = money.ToMajor(cents)
+	}
+
+	// By tax rate and by item, from the stored line items.
+	rates, _, err := sumBy(invoiceLineItemsTable("amount_cents"), invoiceTaxRateKey, "amount_cents IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	for rate, cents := range rates {
+		stats.ByTaxRate[rate] = money.ToMajor(cents)
+	}
+	rateTaxes, _, err := sumBy(invoiceLineItemsTable("tax_amount_cents"), invoiceTaxRateKey, "amount_cents IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	for rate, cents := range rateTaxes {
+		stats.ByTaxRateTax[rate] = money.ToMajor(cents)
+	}
+	items, _, err := sumBy(invoiceLineItemsTable("amount_cents"), `item_name`, "amount_cents IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	for item, cents := range items {
+		stats.ByItem[item] = money.ToMajor(cents)
+	}
+
+	for currency := range missing {
+		stats.MissingRateCurrencies = append(stats.MissingRateCurrencies, currency)
+	}
+	sort.Strings(stats.MissingRateCurrencies)
 	return stats, nil
 }
 
+// invoiceTypeKey groups invoices by type, with unclassified invoices as "unknown".
+const invoiceTypeKey = `CASE WHEN invoice_type IS NULL OR invoice_type = '' THEN 'unknown' ELSE invoice_type END`
+
+// invoiceTagsTable has one invoice row per tag, with the tag's name as tag_name.
+const invoiceTagsTable = `(
+	SELECT i.*, t.name AS tag_name
+	FROM invoices AS i
+	JOIN invoice_tags AS it ON it.invoice_id = i.id
+	JOIN tags AS t ON t.id = it.tag_id AND t.owner_user_id = i.owner_user_id
+) AS invoices`
+
+// invoiceLineItemsTable has one invoice row per line item, with the item's name as item_name, its
+// tax rate as tax_rate and the given line-item money column as amount_cents.
+func invoiceLineItemsTable(column string) string {
+	return `(
+	SELECT i.owner_user_id, i.is_draft, i.currency, i.invoice_date_ymd,
+		li.name AS item_name, li.tax_rate, li.` + column + ` AS amount_cents
+	FROM invoices AS i
+	JOIN invoice_line_items AS li ON li.invoice_id = i.id AND li.owner_user_id = i.owner_user_id
+) AS invoices`
+}
+
+// invoiceTaxRateKey renders a fractional tax rate as a percentage key such as "13%".
+const invoiceTaxRateKey = `CASE WHEN tax_rate IS NULL THEN 'unknown' ELSE printf('%g%%', ROUND(tax_rate * 100, 2)) END`
+
 // LinkPayment creates a link between an invoice and a payment
 func (r *InvoiceRepository) LinkPayment(ownerUserID string, invoiceID, paymentID string) error {
 	ownerUserID = strings.TrimSpace(ownerUserID)
@@ -499,8 +663,10 @@ func (r *InvoiceRepository) SuggestPaymentsCtx(ctx context.Context, invoice *mod
 		}
 		minAmount := int64(math.Floor(float64(amountCents) * 0.8))
 		maxAmount := int64(math.Ceil(float64(amountCents) * 1.2))
-		// Support negative payment amounts by matching on absolute value.
-		base = base.Where("ABS(amount_cents) >= ? AND ABS(amount_cents) <= ?", minAmount, maxAmount)
+		// Support negative payment amounts by matching on absolute value. Payments in another
+		// currency cannot be compared in SQL; the service scores them after conversion.
+		base = base.Where("(currency <> ? OR (ABS(amount_cents) >= ? AND ABS(amount_cents) <= ?))",
+			currencyOrDefault(invoice.Currency), minAmount, maxAmount)
 	}
 
 	// If invoice has date, prioritize payments from similar timeframe
@@ -610,7 +776,8 @@ func (r *InvoiceRepository) SuggestInvoicesCtx(ctx context.Context, payment *mod
 		// Keep suggestions conservative: default to ±10% around payment amount.
 		minAmount := int64(math.Floor(float64(amountCents) * 0.9))
 		maxAmount := int64(math.Ceil(float64(amountCents) * 1.1))
-		query = query.Where("amount_cents >= ? AND amount_cents <= ?", minAmount, maxAmount)
+		query = query.Where("(currency <> ? OR (amount_cents >= ? AND amount_cents <= ?))",
+			currencyOrDefault(payment.Currency), minAmount, maxAmount)
 	}
 
 	if hasAmount {
@@ -627,6 +794,13 @@ func (r *InvoiceRepository) SuggestInvoicesCtx(ctx context.Context, payment *mod
 	return invoices, err
 }
 
+func currencyOrDefault(currency string) string {
+	if normalized, err := money.NormalizeCurrency(currency); err == nil {
+		return normalized
+	}
+	return money.DefaultCurrency
+}
+
 func normalizeInvoiceMoney(data map[string]interface{}) error {
 	if err := money.SyncUpdateMap(data, "amount", "amount_cents", true); err != nil {
 		return err
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"smart-bill-manager/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type InvoiceLineItemRepository struct {
+	db *gorm.DB
+}
+
+func NewInvoiceLineItemRepository(db *gorm.DB) *InvoiceLineItemRepository {
+	return &InvoiceLineItemRepository{db: db}
+}
+
+// ReplaceForInvoice swaps the stored line items of an invoice for rows, numbering them in order.
+func (r *InvoiceLineItemRepository) ReplaceForInvoice(tx *gorm.DB, ownerUserID, invoiceID string, rows []models.InvoiceLineItem) error {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	invoiceID = strings.TrimSpace(invoiceID)
+	if ownerUserID == "" || invoiceID == "" {
+		return fmt.Errorf("missing fields")
+	}
+	db := tx
+	if db == nil {
+		db = r.db
+	}
+	if err := db.Where("invoice_id = ?", invoiceID).Delete(&models.InvoiceLineItem{}).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	for i := range rows {
+		rows[i].OwnerUserID = ownerUserID
+		rows[i].InvoiceID = invoiceID
+		rows[i].LineNo = i + 1
+	}
+	return db.Create(&rows).Error
+}
+
+func (r *InvoiceLineItemRepository) FindByInvoiceIDForOwnerCtx(ctx context.Context, ownerUserID string, invoiceID string) ([]models.InvoiceLineItem, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	invoiceID = strings.TrimSpace(invoiceID)
+	if ownerUserID == "" || invoiceID == "" {
+		return []models.InvoiceLineItem{}, nil
+	}
+	var rows []models.InvoiceLineItem
+	err := r.db.WithContext(ctx).
+		Where("owner_user_id = ? AND invoice_id = ?", ownerUserID, invoiceID).
+		Order("line_no ASC, id ASC").
+		Find(&rows).Error
+	return rows, err
+}
+
+func (r *InvoiceLineItemRepository) DeleteForInvoice(tx *gorm.DB, ownerUserID, invoiceID string) error {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	invoiceID = strings.TrimSpace(invoiceID)
+	if ownerUserID == "" || invoiceID == "" {
+		return gorm.ErrRecordNotFound
+	}
+	db := tx
+	if db == nil {
+		db = r.db
+	}
+	return db.Where("invoice_id = ? AND owner_user_id = ?", invoiceID, ownerUserID).Delete(&models.InvoiceLineItem{}).Error
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"smart-bill-manager/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// InvoicePaymentPairsTable lists the (invoice_id, payment_id) pairs an invoice covers: its link
+// to a payment, plus the payments matched to the rides of its ride-hailing itinerary. Use it in
+// place of invoice_payment_links wherever "is this payment invoiced" matters.
+const InvoicePaymentPairsTable = `(
+	SELECT invoice_id, payment_id FROM invoice_payment_links
+	UNION
+	SELECT invoice_id, payment_id FROM invoice_rides WHERE payment_id IS NOT NULL
+)`
+
+type InvoiceRideRepository struct {
+	db *gorm.DB
+}
+
+func NewInvoiceRideRepository(db *gorm.DB) *InvoiceRideRepository {
+	return &InvoiceRideRepository{db: db}
+}
+
+// ReplaceForAttachment swaps the rides read from an itinerary attachment of an invoice for rows,
+// numbering them in order.
+func (r *InvoiceRideRepository) ReplaceForAttachment(tx *gorm.DB, ownerUserID, invoiceID, attachmentID string, rows []models.InvoiceRide) error {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	invoiceID = strings.TrimSpace(invoiceID)
+	attachmentID = strings.TrimSpace(attachmentID)
+	if ownerUserID == "" || invoiceID == "" || attachmentID == "" {
+		return fmt.Errorf("missing fields")
+	}
+	db := tx
+	if db == nil {
+		db = r.db
+	}
+	if err := db.Where("invoice_id = ? AND attachment_id = ?", invoiceID, attachmentID).Delete(&models.InvoiceRide{}).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	for i := range rows {
+		rows[i].OwnerUserID = ownerUserID
+		rows[i].InvoiceID = invoiceID
+		rows[i].AttachmentID = &attachmentID
+		rows[i].RideNo = i + 1
+	}
+	return db.Create(&rows).Error
+}
+
+// FindByInvoiceIDForOwnerCtx returns the rides of an invoice in itinerary order, each with the trip
+// of its matched payment.
+func (r *InvoiceRideRepository) FindByInvoiceIDForOwnerCtx(ctx context.Context, ownerUserID string, invoiceID string) ([]models.InvoiceRide, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	invoiceID = strings.TrimSpace(invoiceID)
+	if ownerUserID == "" || invoiceID == "" {
+		return []models.InvoiceRide{}, nil
+	}
+	var rows []models.InvoiceRide
+	if err := r.db.WithContext(ctx).
+		Where("owner_user_id = ? AND invoice_id = ?", ownerUserID, invoiceID).
+		Order("attachment_id ASC, ride_no ASC, id ASC").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, r.fillTrips(ctx, ownerUserID, rows)
+}
+
+func (r *InvoiceRideRepository) FindByIDForOwnerCtx(ctx context.Context, ownerUserID string, id string) (*models.InvoiceRide, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var row models.InvoiceRide
+	if err := r.db.WithContext(ctx).
+		Where("id = ? AND owner_user_id = ?", strings.TrimSpace(id), strings.TrimSpace(ownerUserID)).
+		First(&row).Error; err != nil {
+		return nil, err
+	}
+	rows := []models.InvoiceRide{row}
+	if err := r.fillTrips(ctx, ownerUserID, rows); err != nil {
+		return nil, err
+	}
+	return &rows[0], nil
+}
+
+// fillTrips sets TripID from the matched payments.
+func (r *InvoiceRideRepository) fillTrips(ctx context.Context, ownerUserID string, rows []models.InvoiceRide) error {
+	var paymentIDs []string
+	for _, row := range rows {
+		if row.PaymentID != nil {
+			paymentIDs = append(paymentIDs, *row.PaymentID)
+		}
+	}
+	if len(paymentIDs) == 0 {
+		return nil
+	}
+	var trips []struct {
+		ID     string
+		TripID *string
+	}
+	if err := r.db.WithContext(ctx).Model(&models.Payment{}).
+		Select("id, trip_id").
+		Where("owner_user_id = ? AND id IN ?", strings.TrimSpace(ownerUserID), paymentIDs).
+		Scan(&trips).Error; err != nil {
+		return err
+	}
+	byPayment := make(map[string]*string, len(trips))
+	for _, t := range trips {
+		byPayment[t.ID] = t.TripID
+	}
+	for i := range rows {
+		if rows[i].PaymentID != nil {
+			rows[i].TripID = byPayment[*rows[i].PaymentID]
+		}
+	}
+	return nil
+}
+
+// SetPayment matches a ride to a payment, or clears the match when paymentID is nil.
+func (r *InvoiceRideRepository) SetPayment(tx *gorm.DB, ownerUserID, id string, paymentID *string) error {
+	db := tx
+	if db == nil {
+		db = r.db
+	}
+	res := db.Model(&models.InvoiceRide{}).
+		Where("id = ? AND owner_user_id = ?", strings.TrimSpace(id), strings.TrimSpace(ownerUserID)).
+		Update("payment_id", paymentID)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ClearPayments drops the matches of rides to the given payments, e.g. when they are deleted.
+func (r *InvoiceRideRepository) ClearPayments(tx *gorm.DB, paymentIDs []string) error {
+	if len(paymentIDs) == 0 {
+		return nil
+	}
+	db := tx
+	if db == nil {
+		db = r.db
+	}
+	return db.Model(&models.InvoiceRide{}).Where("payment_id IN ?", paymentIDs).Update("payment_id", nil).Error
+}
+
+func (r *InvoiceRideRepository) DeleteForInvoice(tx *gorm.DB, ownerUserID, invoiceID string) error {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	invoiceID = strings.TrimSpace(invoiceID)
+	if ownerUserID == "" || invoiceID == "" {
+		return gorm.ErrRecordNotFound
+	}
+	db := tx
+	if db == nil {
+		db = r.db
+	}
+	return db.Where("invoice_id = ? AND owner_user_id = ?", invoiceID, ownerUserID).Delete(&models.InvoiceRide{}).Error
+}
+
+// DeleteForAttachment removes the rides read from one itinerary attachment.
+func (r *InvoiceRideRepository) DeleteForAttachment(tx *gorm.DB, ownerUserID, attachmentID string) error {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	attachmentID = strings.TrimSpace(attachmentID)
+	if ownerUserID == "" || attachmentID == "" {
+		return gorm.ErrRecordNotFound
+	}
+	db := tx
+	if db == nil {
+		db = r.db
+	}
+	return db.Where("attachment_id = ? AND owner_user_id = ?", attachmentID, ownerUserID).Delete(&models.InvoiceRide{}).Error
+}
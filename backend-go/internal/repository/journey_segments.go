@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"smart-bill-manager/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type JourneySegmentRepository struct {
+	db *gorm.DB
+}
+
+func NewJourneySegmentRepository(db *gorm.DB) *JourneySegmentRepository {
+	return &JourneySegmentRepository{db: db}
+}
+
+// ReplaceForInvoice swaps the journey segments read from the invoice file itself for rows, numbering
+// them in order. Segments of itinerary attachments are left alone.
+func (r *JourneySegmentRepository) ReplaceForInvoice(tx *gorm.DB, ownerUserID, invoiceID string, rows []models.JourneySegment) error {
+	return r.replace(tx, ownerUserID, invoiceID, "", rows)
+}
+
+// ReplaceForAttachment swaps the journey segments read from an itinerary attachment of an invoice.
+func (r *JourneySegmentRepository) ReplaceForAttachment(tx *gorm.DB, ownerUserID, invoiceID, attachmentID string, rows []models.JourneySegment) error {
+	if strings.TrimSpace(attachmentID) == "" {
+		return fmt.Errorf("missing fields")
+	}
+	return r.replace(tx, ownerUserID, invoiceID, attachmentID, rows)
+}
+
+func (r *JourneySegmentRepository) replace(tx *gorm.DB, ownerUserID, invoiceID, attachmentID string, rows []models.JourneySegment) error {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	invoiceID = strings.TrimSpace(invoiceID)
+	attachmentID = strings.TrimSpace(attachmentID)
+	if ownerUserID == "" || invoiceID == "" {
+		return fmt.Errorf("missing fields")
+	}
+	db := tx
+	if db == nil {
+		db = r.db
+	}
+	q := db.Where("invoice_id = ?", invoiceID)
+	var attachment *string
+	if attachmentID == "" {
+		q = q.Where("attachment_id IS NULL")
+	} else {
+		q = q.Where("attachment_id = ?", attachmentID)
+		attachment = &attachmentID
+	}
+	if err := q.Delete(&models.JourneySegment{}).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	for i := range rows {
+		rows[i].OwnerUserID = ownerUserID
+		rows[i].InvoiceID = invoiceID
+		rows[i].AttachmentID = attachment
+		rows[i].SegmentNo = i + 1
+	}
+	return db.Create(&rows).Error
+}
+
+func (r *JourneySegmentRepository) FindByInvoiceIDForOwnerCtx(ctx context.Context, ownerUserID string, invoiceID string) ([]models.JourneySegment, error) {
+	return r.FindByInvoiceIDsForOwnerCtx(ctx, ownerUserID, []string{invoiceID})
+}
+
+// FindByInvoiceIDsForOwnerCtx returns the segments of several invoices, each invoice's in ticket order.
+func (r *JourneySegmentRepository) FindByInvoiceIDsForOwnerCtx(ctx context.Context, ownerUserID string, invoiceIDs []string) ([]models.JourneySegment, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	invoiceIDs = uniqueNonEmpty(invoiceIDs)
+	if ownerUserID == "" || len(invoiceIDs) == 0 {
+		return []models.JourneySegment{}, nil
+	}
+	var rows []models.JourneySegment
+	err := r.db.WithContext(ctx).
+		Where("owner_user_id = ? AND invoice_id IN ?", ownerUserID, invoiceIDs).
+		Order("invoice_id ASC, attachment_id IS NOT NULL, attachment_id ASC, segment_no ASC, id ASC").
+		Find(&rows).Error
+	return rows, err
+}
+
+func (r *JourneySegmentRepository) DeleteForInvoice(tx *gorm.DB, ownerUserID, invoiceID string) error {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	invoiceID = strings.TrimSpace(invoiceID)
+	if ownerUserID == "" || invoiceID == "" {
+		return gorm.ErrRecordNotFound
+	}
+	db := tx
+	if db == nil {
+		db = r.db
+	}
+	return db.Where("invoice_id = ? AND owner_user_id = ?", invoiceID, ownerUserID).Delete(&models.JourneySegment{}).Error
+}
+
+// DeleteForAttachment removes the segments read from one itinerary attachment.
+func (r *JourneySegmentRepository) DeleteForAttachment(tx *gorm.DB, ownerUserID, attachmentID string) error {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	attachmentID = strings.TrimSpace(attachmentID)
+	if ownerUserID == "" || attachmentID == "" {
+		return gorm.ErrRecordNotFound
+	}
+	db := tx
+	if db == nil {
+		db = r.db
+	}
+	return db.Where("attachment_id = ? AND owner_user_id = ?", attachmentID, ownerUserID).Delete(&models.JourneySegment{}).Error
+}
@@ -17,7 +17,7 @@ import (
 
 func TestRepositoryWithDBParticipatesInTransaction(t *testing.T) {
 	db := openMoneyTestDB(t)
-	if err := db.AutoMigrate(&models.Payment{}, &models.Invoice{}); err != nil {
+	if err := db.AutoMigrate(&models.Payment{}, &models.PaymentSplit{}, &models.Invoice{}); err != nil {
 		t.Fatalf("初始化事务测试表失败: %v", err)
 	}
 
@@ -79,7 +79,7 @@ func TestRepositoryWithDBParticipatesInTransaction(t *testing.T) {
 
 func TestMoneyPersistenceUsesCentsAsCanonicalValue(t *testing.T) {
 	db := openMoneyTestDB(t)
-	if err := db.AutoMigrate(&models.Payment{}, &models.Invoice{}); err != nil {
+	if err := db.AutoMigrate(&models.Payment{}, &models.PaymentSplit{}, &models.Invoice{}, &models.Tag{}, &models.PaymentTag{}, &models.InvoiceTag{}, &models.InvoiceLineItem{}, &models.PaymentAccount{}); err != nil {
 		t.Fatalf("初始化金额测试表失败: %v", err)
 	}
 
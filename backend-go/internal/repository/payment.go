@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"sort"
 	"strings"
 
 	"smart-bill-manager/internal/models"
@@ -39,6 +40,9 @@ func (r *PaymentRepository) FindByID(id string) (*models.Payment, error) {
 	return &payment, nil
 }
 
+// PaymentAccountNone filters payments that are not linked to any account.
+const PaymentAccountNone = "none"
+
 type PaymentFilter struct {
 	OwnerUserID string
 	Limit       int
@@ -50,6 +54,10 @@ type PaymentFilter struct {
 	StartTs     int64
 	EndTs       int64
 	Category    string
+	// TagIDs keeps payments carrying every one of these tags.
+	TagIDs []string
+	// AccountID keeps payments made from this account; PaymentAccountNone keeps unassigned ones.
+	AccountID string
 	// IncludeDraft controls whether draft records are included.
 	// By default, drafts are hidden from normal list/stats flows.
 	IncludeDraft bool
@@ -75,6 +83,20 @@ func (r *PaymentRepository) buildFindAllQuery(ctx context.Context, filter Paymen
 	if filter.Category != "" {
 		query = query.Where("category = ?", filter.Category)
 	}
+	switch accountID := strings.TrimSpace(filter.AccountID); accountID {
+	case "":
+	case PaymentAccountNone:
+		query = query.Where("account_id IS NULL")
+	default:
+		query = query.Where("account_id = ?", accountID)
+	}
+	if tagIDs := uniqueNonEmpty(filter.TagIDs); len(tagIDs) > 0 {
+		query = query.Where("id IN (?)", r.db.Table("payment_tags").
+			Select("payment_id").
+			Where("tag_id IN ?", tagIDs).
+			Group("payment_id").
+			Having("COUNT(DISTINCT tag_id) = ?", len(tagIDs)))
+	}
 	if filter.AfterTs > 0 && strings.TrimSpace(filter.AfterID) != "" {
 		afterID := strings.TrimSpace(filter.AfterID)
 		query = query.Where("(transaction_time_ts < ?) OR (transaction_time_ts = ? AND id < ?)", filter.AfterTs, filter.AfterTs, afterID)
@@ -98,6 +120,17 @@ func (r *PaymentRepository) FindAll(filter PaymentFilter) ([]models.Payment, err
 	return payments, err
 }
 
+// FindIDs returns the IDs of payments matching the filter, newest first, ignoring paging.
+func (r *PaymentRepository) FindIDs(filter PaymentFilter, limit int) ([]string, error) {
+	query := r.buildFindAllQuery(context.Background(), filter).Order("transaction_time_ts DESC, id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var ids []string
+	err := query.Pluck("id", &ids).Error
+	return ids, err
+}
+
 func (r *PaymentRepository) FindAllPaged(filter PaymentFilter, selectCols []string) ([]models.Payment, int64, error) {
 	return r.FindAllPagedCtx(context.Background(), filter, selectCols)
 }
@@ -218,6 +251,8 @@ func (r *PaymentRepository) GetStats(startDate, endDate string) (*models.Payment
 		CategoryStats: make(map[string]float64),
 		MerchantStats: make(map[string]float64),
 		DailyStats:    make(map[string]float64),
+		TagStats:      make(map[string]float64),
+		AccountStats:  make(map[string]float64),
 	}
 	categoryCents := make(map[string]int64)
 	merchantCents := make(map[string]int64)
@@ -259,6 +294,81 @@ func (r *PaymentRepository) GetStats(startDate, endDate string) (*models.Payment
 	return stats, nil
 }
 
+// NetPaymentsTable exposes payments as allocations to sum over. A split payment contributes one
+// row per split with the split's amount, category and trip. A linked refund keeps its own id,
+// draft flag and owner, but carries a negative amount and the original's currency, category,
+// merchant, time and trip, so aggregating yields net spend. origin_id is the payment whose tags
+// apply (the original for refunds). Use it in place of the payments table for sums; count
+// payments with COUNT(DISTINCT id) over rows where is_refund = 0.
+const NetPaymentsTable = `(
+	SELECT
+		p.id,
+		COALESCE(o.id, p.id) AS origin_id,
+		p.owner_user_id,
+		p.is_draft,
+		CASE WHEN o.id IS NULL THEN p.amount_cents ELSE -p.amount_cents END AS amount_cents,
+		CASE WHEN o.id IS NULL THEN 0 ELSE 1 END AS is_refund,
+		CASE WHEN o.id IS NULL THEN p.currency ELSE o.currency END AS currency,
+		CASE WHEN o.id IS NULL THEN p.category ELSE o.category END AS category,
+		CASE WHEN o.id IS NULL THEN p.merchant ELSE o.merchant END AS merchant,
+		CASE WHEN o.id IS NULL THEN p.transaction_time ELSE o.transaction_time END AS transaction_time,
+		CASE WHEN o.id IS NULL THEN p.transaction_time_ts ELSE o.transaction_time_ts END AS transaction_time_ts,
+		CASE WHEN o.id IS NULL THEN p.trip_id ELSE o.trip_id END AS trip_id,
+		COALESCE(p.account_id, o.account_id) AS account_id
+	FROM payments AS p
+	LEFT JOIN payments AS o
+		ON o.id = p.refund_of_id AND o.owner_user_id = p.owner_user_id AND o.is_draft = 0
+	WHERE NOT EXISTS (SELECT 1 FROM payment_splits AS s WHERE s.payment_id = p.id)
+	UNION ALL
+	SELECT
+		p.id,
+		p.id AS origin_id,
+		p.owner_user_id,
+		p.is_draft,
+		s.amount_cents,
+		0 AS is_refund,
+		p.currency,
+		COALESCE(s.category, p.category) AS category,
+		p.merchant,
+		p.transaction_time,
+		p.transaction_time_ts,
+		s.trip_id,
+		p.account_id
+	FROM payment_splits AS s
+	JOIN payments AS p ON p.id = s.payment_id AND p.owner_user_id = s.owner_user_id
+) AS payments`
+
+// PaymentTagsTable is NetPaymentsTable with one row per tag of each allocation, named tag_name.
+const PaymentTagsTable = `(
+	SELECT payments.*, t.name AS tag_name
+	FROM ` + NetPaymentsTable + `
+	JOIN payment_tags AS pt ON pt.payment_id = payments.origin_id
+	JOIN tags AS t ON t.id = pt.tag_id AND t.owner_user_id = payments.owner_user_id
+) AS payments`
+
+// uniqueNonEmpty trims ids and drops blanks and repeats.
+func uniqueNonEmpty(ids []string) []string {
+	out := make([]string, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+	}
+	return out
+}
+
+// LocalDayExpr is the Asia/Shanghai calendar day (YYYY-MM-DD) of a payment row. transaction_time
+// is stored in UTC, so its date prefix would put payments before 08:00 on the previous day.
+const LocalDayExpr = `DATE(transaction_time_ts / 1000, 'unixepoch', '+8 hours')`
+
+// CentsConverter converts an amount in currency on day (YYYY-MM-DD) to the caller's base currency.
+// ok=false means no exchange rate is available.
+type CentsConverter func(cents int64, currency string, day string) (converted int64, ok bool)
+
 // GetStatsByTs uses SQL aggregation to compute stats efficiently.
 // startTs/endTs are UTC unix milliseconds; 0 means unbounded.
 func (r *PaymentRepository) GetStatsByTs(ownerUserID string, startTs, endTs int64) (*models.PaymentStats, error) {
@@ -266,6 +376,14 @@ func (r *PaymentRepository) GetStatsByTs(ownerUserID string, startTs, endTs int6
 }
 
 func (r *PaymentRepository) GetStatsByTsCtx(ctx context.Context, ownerUserID string, startTs, endTs int64) (*models.PaymentStats, error) {
+	return r.GetConvertedStatsByTsCtx(ctx, ownerUserID, startTs, endTs, nil)
+}
+
+// GetConvertedStatsByTsCtx is GetStatsByTsCtx with amounts converted per currency and day.
+// Split payments count by allocation and refunds are netted against their original payment
+// (see NetPaymentsTable).
+// Groups whose currency has no rate are left out of the sums and listed in MissingRateCurrencies.
+func (r *PaymentRepository) GetConvertedStatsByTsCtx(ctx context.Context, ownerUserID string, startTs, endTs int64, convert CentsConverter) (*models.PaymentStats, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -287,68 +405,115 @@ func (r *PaymentRepository) GetStatsByTsCtx(ctx context.Context, ownerUserID str
 		CategoryStats: make(map[string]float64),
 		MerchantStats: make(map[string]float64),
 		DailyStats:    make(map[string]float64),
+		TagStats:      make(map[string]float64),
+		AccountStats:  make(map[string]float64),
 	}
 
-	type totalsRow struct {
-		TotalCents int64 `gorm:"column:total_cents"`
-		TotalCount int64 `gorm:"column:total_count"`
-	}
-	var totals totalsRow
-	if err := applyFilter(r.db.WithContext(ctx).Table("payments")).
-		Select("COALESCE(SUM(amount_cents), 0) AS total_cents, COUNT(*) AS total_count").
-		Scan(&totals).Error; err != nil {
-		return nil, err
-	}
-	stats.TotalAmount = money.ToMajor(totals.TotalCents)
-	stats.TotalCount = int(totals.TotalCount)
-
 	type kvRow struct {
 		Key        string `gorm:"column:k"`
+		Currency   string `gorm:"column:currency"`
+		Day        string `gorm:"column:day"`
 		TotalCents int64  `gorm:"column:total_cents"`
+		TotalCount int64  `gorm:"column:total_count"`
+	}
+	missing := map[string]bool{}
+	// aggregate sums amount_cents per key expression; with a converter the rows are further split
+	// by currency and day so each group can be converted at its own rate.
+	aggregate := func(table string, keyExpr string) (map[string]int64, int64, error) {
+		selectSQL := keyExpr + ` AS k, COALESCE(SUM(amount_cents), 0) AS total_cents, COUNT(DISTINCT CASE WHEN is_refund = 0 THEN id END) AS total_count`
+		group := "k"
+		if convert != nil {
+			selectSQL += `, currency, ` + LocalDayExpr + ` AS day`
+			group = "k, currency, day"
+		}
+		var rows []kvRow
+		if err := applyFilter(r.db.WithContext(ctx).Table(table)).
+			Select(selectSQL).
+			Group(group).
+			Scan(&rows).Error; err != nil {
+			return nil, 0, err
+		}
+		out := make(map[string]int64, len(rows))
+		var count int64
+		for _, row := range rows {
+			count += row.TotalCount
+			cents := row.TotalCents
+			if convert != nil {
+				converted, ok := convert(cents, row.Currency, row.Day)
+				if !ok {
+					missing[row.Currency] = true
+					continue
+				}
+				cents = converted
+			}
+			out[row.Key] += cents
+		}
+		return out, count, nil
+	}
+
+	totals, count, err := aggregate(NetPaymentsTable, `''`)
+	if err != nil {
+		return nil, err
 	}
+	stats.TotalAmount = money.ToMajor(totals[""])
+	stats.TotalCount = int(count)
 
 	// Category stats
-	var catRows []kvRow
-	if err := applyFilter(r.db.WithContext(ctx).Table("payments")).
-		Select(`CASE WHEN category IS NULL OR TRIM(category) = '' THEN '未分类' ELSE category END AS k, COALESCE(SUM(amount_cents), 0) AS total_cents`).
-		Group("k").
-		Scan(&catRows).Error; err != nil {
+	categories, _, err := aggregate(NetPaymentsTable, `CASE WHEN category IS NULL OR TRIM(category) = '' THEN '未分类' ELSE category END`)
+	if err != nil {
 		return nil, err
 	}
-	for _, r := range catRows {
-		stats.CategoryStats[r.Key] = money.ToMajor(r.TotalCents)
+	for key, cents := range categories {
+		stats.CategoryStats[key] = money.ToMajor(cents)
 	}
 
 	// Merchant stats
-	var merchRows []kvRow
-	if err := applyFilter(r.db.WithContext(ctx).Table("payments")).
-		Select(`CASE WHEN merchant IS NULL OR TRIM(merchant) = '' THEN '未知商家' ELSE merchant END AS k, COALESCE(SUM(amount_cents), 0) AS total_cents`).
-		Group("k").
-		Scan(&merchRows).Error; err != nil {
+	merchants, _, err := aggregate(NetPaymentsTable, `CASE WHEN merchant IS NULL OR TRIM(merchant) = '' THEN '未知商家' ELSE merchant END`)
+	if err != nil {
 		return nil, err
 	}
-	for _, r := range merchRows {
-		stats.MerchantStats[r.Key] = money.ToMajor(r.TotalCents)
+	for key, cents := range merchants {
+		stats.MerchantStats[key] = money.ToMajor(cents)
 	}
 
-	// Daily stats (YYYY-MM-DD from RFC3339 string)
-	var dayRows []kvRow
-	if err := applyFilter(r.db.WithContext(ctx).Table("payments")).
-		Select(`SUBSTR(transaction_time, 1, 10) AS k, COALESCE(SUM(amount_cents), 0) AS total_cents`).
-		Group("k").
-		Scan(&dayRows).Error; err != nil {
+	// Tag stats; a payment with several tags counts towards each of them.
+	tags, _, err := aggregate(PaymentTagsTable, `tag_name`)
+	if err != nil {
 		return nil, err
 	}
-	for _, r := range dayRows {
-		if len(r.Key) == 10 {
-			stats.DailyStats[r.Key] = money.ToMajor(r.TotalCents)
+	for key, cents := range tags {
+		stats.TagStats[key] = money.ToMajor(cents)
+	}
+
+	// Account stats, keyed by account id (PaymentAccountNone for payments without an account) so
+	// that accounts sharing a name stay apart.
+	accounts, _, err := aggregate(NetPaymentsTable, `COALESCE(account_id, '`+PaymentAccountNone+`')`)
+	if err != nil {
+		return nil, err
+	}
+	for key, cents := range accounts {
+		stats.AccountStats[key] = money.ToMajor(cents)
+	}
+
+	// Daily stats by local day
+	days, _, err := aggregate(NetPaymentsTable, LocalDayExpr)
+	if err != nil {
+		return nil, err
+	}
+	for key, cents := range days {
+		if len(key) == 10 {
+			stats.DailyStats[key] = money.ToMajor(cents)
 		}
 	}
 
+	for currency := range missing {
+		stats.MissingRateCurrencies = append(stats.MissingRateCurrencies, currency)
+	}
+	sort.Strings(stats.MissingRateCurrencies)
 	return stats, nil
 }
 
-// GetLinkedInvoices returns all invoices linked to a payment
+// GetLinkedInvoices returns all invoices linked to a payment, including those with a ride matched to it
 func (r *PaymentRepository) GetLinkedInvoices(ownerUserID string, paymentID string) ([]models.Invoice, error) {
 	return r.GetLinkedInvoicesCtx(context.Background(), ownerUserID, paymentID)
 }
@@ -359,8 +524,8 @@ func (r *PaymentRepository) GetLinkedInvoicesCtx(ctx context.Context, ownerUserI
 	}
 	var invoices []models.Invoice
 	q := r.db.WithContext(ctx).
-		Joins("INNER JOIN invoice_payment_links ON invoice_payment_links.invoice_id = invoices.id").
-		Where("invoice_payment_links.payment_id = ?", paymentID).
+		Joins("INNER JOIN "+InvoicePaymentPairsTable+" AS l ON l.invoice_id = invoices.id").
+		Where("l.payment_id = ?", paymentID).
 		Where("invoices.is_draft = 0")
 	if ownerUserID != "" {
 		q = q.Where("invoices.owner_user_id = ?", ownerUserID)
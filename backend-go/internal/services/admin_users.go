@@ -146,6 +146,54 @@ func (s *AuthService) DeleteUserCtx(ctx context.Context, actorUserID, targetUser
 		}
 		out.LinksDeleted = res.RowsAffected
 
+		for _, link := range []tagLink{paymentTagLink, invoiceTagLink, tripTagLink} {
+			if err := tx.Exec(
+				"DELETE FROM "+link.linkTable+" WHERE tag_id IN (SELECT id FROM tags WHERE owner_user_id = ?)",
+				targetUserID,
+			).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("owner_user_id = ?", targetUserID).Delete(&models.Tag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("owner_user_id = ?", targetUserID).Delete(&models.BudgetAlert{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("owner_user_id = ?", targetUserID).Delete(&models.Budget{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("owner_user_id = ?", targetUserID).Delete(&models.PaymentAccount{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("owner_user_id = ?", targetUserID).Delete(&models.BuyerProfile{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("owner_user_id = ?", targetUserID).Delete(&models.DedupDismissal{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("owner_user_id = ?", targetUserID).Delete(&models.InvoiceLineItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("owner_user_id = ?", targetUserID).Delete(&models.JourneySegment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("owner_user_id = ?", targetUserID).Delete(&models.InvoiceRide{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("owner_user_id = ?", targetUserID).Delete(&models.PaymentSplit{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("owner_user_id = ?", targetUserID).Delete(&models.CategoryRule{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("owner_user_id = ?", targetUserID).Delete(&models.ImportProfile{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("owner_user_id = ?", targetUserID).Delete(&models.ExchangeRate{}).Error; err != nil {
+			return err
+		}
+
 		res = tx.Where("owner_user_id = ?", targetUserID).Delete(&models.PaymentOCRBlob{})
 		if res.Error != nil {
 			return res.Error
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// "自 FROM 北京首都 PEK CA 1501 ..." / "至：上海虹桥 T2"; the rest of the line belongs to the flight
+	// departing from that airport.
+	airStationLineRe = regexp.MustCompile(`^\s*(自|至)\s*(?:FROM|TO)?\s*[:：]?\s*(.*)$`)
+	airStationNameRe = regexp.MustCompile(`^([\p{Han}]{2,12})\s*((?:T\d)?)`)
+	airFlightRe      = regexp.MustCompile(`^(?:[A-Z]{2}|[A-Z]\d|\d[A-Z])\d{2,4}[A-Z]?$`)
+	airCarrierCodeRe = regexp.MustCompile(`^(?:[A-Z]{2}|[A-Z]\d|\d[A-Z])$`)
+	airFlightNoRe    = regexp.MustCompile(`^\d{2,4}[A-Z]?$`)
+	airCNDateRe      = regexp.MustCompile(`^(\d{4})年(\d{1,2})月(\d{1,2})日$`)
+	airISODateRe     = regexp.MustCompile(`^(\d{4})[-/.](\d{1,2})[-/.](\d{1,2})$`)
+	airPaperDateRe   = regexp.MustCompile(`^(\d{1,2})(JAN|FEB|MAR|APR|MAY|JUN|JUL|AUG|SEP|OCT|NOV|DEC)$`)
+	airClockRe       = regexp.MustCompile(`^(\d{1,2})[:：]?(\d{2})$`)
+	airClassRe       = regexp.MustCompile(`^[A-Z]$`)
+	airPassengerRe   = regexp.MustCompile(`旅客姓名\s*(?:NAME\s*OF\s*PASSENGER)?\s*[:：]?\s*([\p{Han}·]{2,20})`)
+	airCNYAmount     = `\s*[:：]?\s*(?:CNY|CN|YQ)?\s*([\d,]+\.\d{2})`
+
+	airFareRe            = regexp.MustCompile(`票\s*价\s*(?:FARE)?` + airCNYAmount)
+	airFuelSurchargeRe   = regexp.MustCompile(`燃油附加费\s*(?:FUEL\s*SURCHARGE)?` + airCNYAmount)
+	airDevelopmentFundRe = regexp.MustCompile(`民航发展基金\s*(?:CAAC\s*DEVELOPMENT\s*FUND)?` + airCNYAmount)
+	airOtherTaxesRe      = regexp.MustCompile(`其他税费\s*(?:OTHER\s*TAXES)?` + airCNYAmount)
+	airTotalRe           = regexp.MustCompile(`合\s*计\s*(?:TOTAL)?` + airCNYAmount)
+)
+
+var airPaperMonths = map[string]time.Month{
+	"JAN": time.January, "FEB": time.February, "MAR": time.March, "APR": time.April,
+	"MAY": time.May, "JUN": time.June, "JUL": time.July, "AUG": time.August,
+	"SEP": time.September, "OCT": time.October, "NOV": time.November, "DEC": time.December,
+}
+
+// airItineraryLabels are table headings that can sit among the flight cells of OCR output.
+var airItineraryLabels = map[string]bool{
+	"承运人": true, "航班号": true, "座位等级": true, "日期": true, "时间": true, "免费行李": true,
+	"客票级别": true, "客票类别": true, "客票生效日期": true, "有效截止日期": true,
+}
+
+// parseAirItinerarySegments reads the flights of an air itinerary (航空运输电子客票行程单), both the
+// paper form ("自 FROM 北京首都 PEK CA 1501 Y 17OCT 0830 ...") and the fully digital one, where
+// the flight cells follow the departure airport line by line. Each 自/至 line names an airport; the
+// cells after it describe the flight leaving it, up to the next 至 line. Paper dates carry no year,
+// which is taken from issued (the 填开日期, any format parseFlexibleDateTime reads).
+func parseAirItinerarySegments(text string, issued string) []JourneySegment {
+	type stop struct {
+		name  string
+		cells []string
+	}
+	var stops []stop
+	for _, line := range strings.Split(text, "\n") {
+		if m := airStationLineRe.FindStringSubmatch(line); m != nil {
+			rest := strings.TrimSpace(m[2])
+			name := ""
+			if n := airStationNameRe.FindStringSubmatch(rest); n != nil {
+				name = strings.TrimSpace(n[1] + " " + n[2])
+				rest = rest[len(n[0]):]
+			}
+			stops = append(stops, stop{name: name, cells: strings.Fields(rest)})
+			continue
+		}
+		if len(stops) > 0 {
+			stops[len(stops)-1].cells = append(stops[len(stops)-1].cells, strings.Fields(line)...)
+		}
+	}
+
+	issueDay, hasIssueDay := parseFlexibleDateTime(issued)
+	var out []JourneySegment
+	for i := 0; i+1 < len(stops); i++ {
+		from, to := stops[i], stops[i+1]
+		if from.name == "" || to.name == "" {
+			continue
+		}
+		seg := JourneySegment{Mode: JourneyModeAir, Origin: from.name, Destination: to.name}
+		var year, day int
+		var month time.Month
+		hour, minute := -1, -1
+		for j := 0; j < len(from.cells); j++ {
+			cell := from.cells[j]
+			switch {
+			case seg.Number == "" && airFlightRe.MatchString(cell):
+				seg.Number = cell
+			case seg.Number == "" && airCarrierCodeRe.MatchString(cell) && j+1 < len(from.cells) && airFlightNoRe.MatchString(from.cells[j+1]):
+				// Paper form: separate 承运人 and 航班号 columns ("CA 1501").
+				seg.Number = cell + from.cells[j+1]
+				j++
+			case seg.Carrier == "" && isAirCarrierName(cell):
+				seg.Carrier = cell
+			case seg.Number != "" && seg.SeatClass == "" && airClassRe.MatchString(cell):
+				seg.SeatClass = cell
+			case day == 0 && airCNDateRe.MatchString(cell):
+				m := airCNDateRe.FindStringSubmatch(cell)
+				year, month, day = atoiOr(m[1]), time.Month(atoiOr(m[2])), atoiOr(m[3])
+			case day == 0 && airISODateRe.MatchString(cell):
+				m := airISODateRe.FindStringSubmatch(cell)
+				year, month, day = atoiOr(m[1]), time.Month(atoiOr(m[2])), atoiOr(m[3])
+			case day == 0 && airPaperDateRe.MatchString(cell):
+				m := airPaperDateRe.FindStringSubmatch(cell)
+				day, month = atoiOr(m[1]), airPaperMonths[m[2]]
+			case day != 0 && hour < 0 && airClockRe.MatchString(cell):
+				m := airClockRe.FindStringSubmatch(cell)
+				if h, mm := atoiOr(m[1]), atoiOr(m[2]); h < 24 && mm < 60 {
+					hour, minute = h, mm
+				}
+			}
+		}
+		if seg.Number == "" {
+			// "VOID" legs and blank rows carry no flight.
+			continue
+		}
+		if seg.Carrier == "" {
+			seg.Carrier = seg.Number[:2]
+		}
+		if day != 0 && year == 0 && hasIssueDay {
+			// Paper itineraries are issued around the first flight: pick the year that puts the
+			// flight closest to the issue date.
+			year = issueDay.Year()
+			t := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+			if t.Sub(issueDay) > 183*24*time.Hour {
+				year--
+			} else if issueDay.Sub(t) > 183*24*time.Hour {
+				year++
+			}
+		}
+		if day != 0 && year != 0 && hour >= 0 {
+			seg.DepartureTime = railDepartureTime(strconv.Itoa(year), strconv.Itoa(int(month)), strconv.Itoa(day), strconv.Itoa(hour), strconv.Itoa(minute))
+		}
+		out = append(out, seg)
+	}
+	return out
+}
+
+// isAirCarrierName reports whether cell is a Chinese airline name such as 东航 or 中国国际航空.
+func isAirCarrierName(cell string) bool {
+	if airItineraryLabels[cell] {
+		return false
+	}
+	runes := []rune(cell)
+	if len(runes) < 2 || len(runes) > 12 {
+		return false
+	}
+	for _, r := range runes {
+		if r < 0x4e00 || r > 0x9fff {
+			return false
+		}
+	}
+	return strings.HasSuffix(cell, "航") || strings.Contains(cell, "航空") || cell == "春秋" || cell == "吉祥"
+}
+
+// parseAirItineraryPassenger returns the passenger name printed next to 旅客姓名, if on the same line.
+func parseAirItineraryPassenger(text string) string {
+	if m := airPassengerRe.FindStringSubmatch(text); len(m) > 1 {
+		return m[1]
+	}
+	return ""
+}
+
+// applyAirFareBreakdown fills the fare, fuel surcharge, development fund, other taxes and total of
+// an air itinerary into d.
+func applyAirFareBreakdown(text string, d *InvoiceTypeDetails) {
+	for _, f := range []struct {
+		re  *regexp.Regexp
+		dst **float64
+	}{
+		{airFareRe, &d.Fare},
+		{airFuelSurchargeRe, &d.FuelSurcharge},
+		{airDevelopmentFundRe, &d.DevelopmentFund},
+		{airOtherTaxesRe, &d.OtherTaxes},
+		{airTotalRe, &d.Total},
+	} {
+		if m := f.re.FindStringSubmatch(text); len(m) > 1 {
+			*f.dst = parseAmountLoose(m[1])
+		}
+	}
+}
+
+// parseAirItineraryXML reads the flights, passenger, ticket number and fares of a fully digital
+// air itinerary from the element values of its XML. Flight elements repeat once per segment.
+func parseAirItineraryXML(values map[string][]string) ([]JourneySegment, *InvoiceTypeDetails) {
+	all := func(keys ...string) []string {
+		for _, k := range keys {
+			if len(values[k]) > 0 {
+				return values[k]
+			}
+		}
+		return nil
+	}
+	at := func(vs []string, i int) string {
+		if i < len(vs) {
+			return strings.TrimSpace(vs[i])
+		}
+		return ""
+	}
+	flights := all("flightnumber", "flightno", "hbh")
+	carriers := all("carrier", "airline", "cyr")
+	origins := all("departurestation", "departureairport", "fromcity", "fromairport", "qfd")
+	dests := all("destinationstation", "arrivalairport", "tocity", "toairport", "ddd")
+	dates := all("flightdate", "departuredate", "traveldate", "cfrq")
+	clocks := all("departuretime", "flighttime", "cfsj")
+	classes := all("seatclass", "cabin", "seatlevel", "zwdj")
+
+	var segs []JourneySegment
+	for i, number := range flights {
+		seg := JourneySegment{
+			Mode:        JourneyModeAir,
+			Number:      strings.TrimSpace(number),
+			Carrier:     at(carriers, i),
+			Origin:      at(origins, i),
+			Destination: at(dests, i),
+			SeatClass:   at(classes, i),
+		}
+		if seg.Number == "" {
+			continue
+		}
+		rawDate, clock := at(dates, i), at(clocks, i)
+		if clock == "" {
+			clock = rawDate
+		}
+		if date := normalizeDate(rawDate); date != "" {
+			if m := railClockRe.FindStringSubmatch(clock); len(m) == 3 {
+				parts := strings.Split(date, "-")
+				seg.DepartureTime = railDepartureTime(parts[0], parts[1], parts[2], m[1], m[2])
+			}
+		}
+		segs = append(segs, seg)
+	}
+
+	first := func(keys ...string) string { return at(all(keys...), 0) }
+	d := &InvoiceTypeDetails{
+		Passenger:       ptrString(first("passengername", "travelername", "lkxm")),
+		TicketNumber:    ptrString(first("eticketno", "electronicticketnumber", "ticketnumber", "dzkph")),
+		Fare:            parseAmountLoose(first("fare", "ticketprice", "pj")),
+		FuelSurcharge:   parseAmountLoose(first("fuelsurcharge", "ryfjf")),
+		DevelopmentFund: parseAmountLoose(first("caacdevelopmentfund", "civilaviationdevelopmentfund", "developmentfund", "mhfzjj")),
+		OtherTaxes:      parseAmountLoose(first("othertaxes", "qtsf")),
+	}
+	if *d == (InvoiceTypeDetails{}) {
+		d = nil
+	}
+	return segs, d
+}
+
+func atoiOr(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"smart-bill-manager/internal/models"
+)
+
+func TestParseAirItinerary_Digital(t *testing.T) {
+	text := "乌洪军\n旅客姓名\n电子发票\n航空运输电子客票行程单\n发票号码：25318781112038121208\n" +
+		"承运人\n航班号\n座位等级\n日期\n时间\n" +
+		"自：北京首都 T2\n东航\nMU5156\nY\n2025年10月17日\n13:30\nY\n20K\n" +
+		"至:上海虹桥 T2\n票价\nCNY 1972.48\n燃油附加费\nCNY 18.35\n增值税税额\nCNY 179.17\n" +
+		"民航发展基金\nCNY 50.00\n其他税费\nCNY 0.00\n合计\nCNY 2220.00\n" +
+		"电子客票号码：7812103964567\n填开单位：中国东方航空股份有限公司\n填开日期：2025年10月18日\n"
+	data, err := NewOCRService().ParseInvoiceData(text)
+	if err != nil {
+		t.Fatalf("parse invoice: %v", err)
+	}
+	want := JourneySegment{
+		Mode:          JourneyModeAir,
+		Carrier:       "东航",
+		Number:        "MU5156",
+		Origin:        "北京首都 T2",
+		Destination:   "上海虹桥 T2",
+		DepartureTime: "2025-10-17T13:30:00+08:00",
+		SeatClass:     "Y",
+		Passenger:     "乌洪军",
+		TicketNumber:  "7812103964567",
+	}
+	if len(data.Journeys) != 1 || data.Journeys[0] != want {
+		t.Fatalf("got %+v\nwant %+v", data.Journeys, want)
+	}
+	d := data.TypeDetails
+	if d == nil || valueOrZero(d.Fare) != 1972.48 || valueOrZero(d.FuelSurcharge) != 18.35 ||
+		valueOrZero(d.DevelopmentFund) != 50 || d.OtherTaxes == nil || valueOrZero(d.Total) != 2220 {
+		t.Fatalf("unexpected fares: %+v", d)
+	}
+}
+
+func TestParseAirItinerary_PaperMultiSegment(t *testing.T) {
+	text := "航空运输电子客票行程单\n" +
+		"旅客姓名 NAME OF PASSENGER 张三\n" +
+		"承运人 CARRIER 航班号 FLIGHT 座位等级 CLASS 日期 DATE 时间 TIME\n" +
+		"自 FROM 北京首都 T3 PEK CA 1501 Y 30DEC 0830 Y 20K\n" +
+		"至 TO 上海虹桥 T2 SHA MU 5102 Y 02JAN 1900 Y 20K\n" +
+		"至 TO 北京首都 T2 PEK\n" +
+		"至 TO VOID\n" +
+		"票价 FARE CNY 2400.00 民航发展基金 CAAC DEVELOPMENT FUND CN 100.00 燃油附加费 FUEL SURCHARGE YQ 40.00\n" +
+		"其他税费 OTHER TAXES 合计 TOTAL CNY 2540.00\n" +
+		"电子客票号码 E-TICKET NO. 999-1234567890\n" +
+		"填开日期 DATE OF ISSUE 2025-12-20\n"
+	segs := parseAirItinerarySegments(text, "2025-12-20")
+	if len(segs) != 2 {
+		t.Fatalf("expected two flights, got %+v", segs)
+	}
+	if segs[0].Number != "CA1501" || segs[0].Carrier != "CA" || segs[0].Origin != "北京首都 T3" || segs[0].Destination != "上海虹桥 T2" ||
+		segs[0].SeatClass != "Y" || segs[0].DepartureTime != "2025-12-30T08:30:00+08:00" {
+		t.Fatalf("unexpected first flight: %+v", segs[0])
+	}
+	// The return flight crosses into the year after the issue date.
+	if segs[1].Number != "MU5102" || segs[1].Destination != "北京首都 T2" || segs[1].DepartureTime != "2026-01-02T19:00:00+08:00" {
+		t.Fatalf("unexpected return flight: %+v", segs[1])
+	}
+
+	d := extractInvoiceTypeDetails(InvoiceTypeAirItinerary, text, nil)
+	if d == nil || strPtrVal(d.Passenger) != "张三" || strPtrVal(d.TicketNumber) != "999-1234567890" ||
+		valueOrZero(d.Fare) != 2400 || valueOrZero(d.DevelopmentFund) != 100 || valueOrZero(d.FuelSurcharge) != 40 ||
+		d.OtherTaxes != nil || valueOrZero(d.Total) != 2540 {
+		t.Fatalf("unexpected details: %+v", d)
+	}
+}
+
+func TestParseAirItineraryXML(t *testing.T) {
+	extracted, err := parseInvoiceXMLToExtracted([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<EInvoice>
+  <EIid>25318781112038121208</EIid>
+  <LabelName>电子发票（航空运输电子客票行程单）</LabelName>
+  <IssueTime>2025-10-18</IssueTime>
+  <TotalTax-includedAmount>2220.00</TotalTax-includedAmount>
+  <PassengerName>乌洪军</PassengerName>
+  <ETicketNo>7812103964567</ETicketNo>
+  <Fare>1972.48</Fare>
+  <FuelSurcharge>18.35</FuelSurcharge>
+  <CAACDevelopmentFund>50.00</CAACDevelopmentFund>
+  <Flight>
+    <Carrier>东航</Carrier><FlightNo>MU5156</FlightNo><DepartureStation>北京首都</DepartureStation>
+    <DestinationStation>上海虹桥</DestinationStation><FlightDate>2025-10-17</FlightDate><DepartureTime>13:30</DepartureTime><SeatClass>Y</SeatClass>
+  </Flight>
+  <Flight>
+    <Carrier>东航</Carrier><FlightNo>MU5105</FlightNo><DepartureStation>上海虹桥</DepartureStation>
+    <DestinationStation>北京首都</DestinationStation><FlightDate>2025-10-20</FlightDate><DepartureTime>09:00</DepartureTime><SeatClass>Y</SeatClass>
+  </Flight>
+</EInvoice>`))
+	if err != nil {
+		t.Fatalf("parse xml: %v", err)
+	}
+	if extracted.InvoiceType != InvoiceTypeAirItinerary || len(extracted.Journeys) != 2 {
+		t.Fatalf("expected two air segments, got %q %+v", extracted.InvoiceType, extracted.Journeys)
+	}
+	back := extracted.Journeys[1]
+	if back.Number != "MU5105" || back.Origin != "上海虹桥" || back.DepartureTime != "2025-10-20T09:00:00+08:00" ||
+		back.Passenger != "乌洪军" || back.TicketNumber != "7812103964567" {
+		t.Fatalf("unexpected segment: %+v", back)
+	}
+	d := extracted.TypeDetails
+	if d == nil || valueOrZero(d.Fare) != 1972.48 || valueOrZero(d.DevelopmentFund) != 50 || valueOrZero(d.Total) != 2220 {
+		t.Fatalf("unexpected details: %+v", d)
+	}
+}
+
+func TestInvoicePaymentScore_UsesItineraryTotal(t *testing.T) {
+	amount, total := 2170.0, 2220.0
+	inv := &models.Invoice{Amount: &amount, InvoiceDate: ptrString("2025-10-18"), SellerName: ptrString("中国东方航空股份有限公司")}
+	pay := &models.Payment{Amount: 2220, TransactionTime: "2025-10-16T10:00:00+08:00"}
+
+	_, without, _, _ := computeInvoicePaymentScoreBreakdown(inv, pay, nil)
+	inv.TypeDetails = &models.InvoiceTypeDetails{Total: &total}
+	_, with, _, _ := computeInvoicePaymentScoreBreakdown(inv, pay, nil)
+	if with != 1 || without >= with {
+		t.Fatalf("expected the itinerary total to match exactly: without=%v with=%v", without, with)
+	}
+}
+
+func TestTripExportJourneyIndex(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	segs := []models.JourneySegment{
+		{InvoiceID: "inv-2", Mode: JourneyModeRail, Number: ptrString("G8"), DepartureTs: 1762333200000},
+		{InvoiceID: "inv-1", Mode: JourneyModeAir, Number: ptrString("MU5156"), Carrier: ptrString("东航")},
+		{InvoiceID: "inv-1", Mode: JourneyModeRail, Number: ptrString("G7"), DepartureTs: 1762128900000},
+		{InvoiceID: "draft", Mode: JourneyModeRail, Number: ptrString("G1"), DepartureTs: 1762128900000},
+	}
+	invByID := map[string]tripExportInvoice{
+		"inv-1": {ID: "inv-1", InvoiceNumber: ptrString("001")},
+		"inv-2": {ID: "inv-2", InvoiceNumber: ptrString("002")},
+	}
+	rows := tripExportJourneyIndex(segs, invByID, loc)
+	if len(rows) != 4 {
+		t.Fatalf("expected header and three rows, got %v", rows)
+	}
+	if rows[1][0] != "2025-11-03 08:15" || rows[1][3] != "G7" || rows[1][9] != "001" ||
+		rows[2][3] != "G8" || rows[3][0] != "" || rows[3][1] != "飞机" || rows[3][2] != "东航" {
+		t.Fatalf("unexpected rows: %v", rows)
+	}
+}
+
+func valueOrZero(v *float64) float64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/repository"
 
 	"gorm.io/gorm"
 )
@@ -33,8 +34,8 @@ func isTripBadDebtLockedTx(tx *gorm.DB, tripID string) (bool, error) {
 	var invoiceBadDebtViaLinks int64
 	if err := tx.
 		Table("invoices").
-		Joins("JOIN invoice_payment_links ON invoice_payment_links.invoice_id = invoices.id").
-		Joins("JOIN payments ON payments.id = invoice_payment_links.payment_id").
+		Joins("JOIN "+repository.InvoicePaymentPairsTable+" AS l ON l.invoice_id = invoices.id").
+		Joins("JOIN payments ON payments.id = l.payment_id").
 		Where("payments.trip_id = ? AND invoices.bad_debt = ? AND payments.is_draft = 0 AND invoices.is_draft = 0", tripID, true).
 		Distinct("invoices.id").
 		Count(&invoiceBadDebtViaLinks).Error; err != nil {
@@ -73,8 +74,8 @@ func recalcTripBadDebtLocked(db *gorm.DB, tripID string) error {
 	var invoiceBadDebtViaLinks int64
 	if err := db.
 		Table("invoices").
-		Joins("JOIN invoice_payment_links ON invoice_payment_links.invoice_id = invoices.id").
-		Joins("JOIN payments ON payments.id = invoice_payment_links.payment_id").
+		Joins("JOIN "+repository.InvoicePaymentPairsTable+" AS l ON l.invoice_id = invoices.id").
+		Joins("JOIN payments ON payments.id = l.payment_id").
 		Where("payments.trip_id = ? AND invoices.bad_debt = ? AND payments.is_draft = 0 AND invoices.is_draft = 0", tripID, true).
 		Distinct("invoices.id").
 		Count(&invoiceBadDebtViaLinks).Error; err != nil {
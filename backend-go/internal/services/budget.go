@@ -0,0 +1,527 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/money"
+	"smart-bill-manager/internal/repository"
+	"smart-bill-manager/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	BudgetPeriodMonthly   = "monthly"
+	BudgetPeriodQuarterly = "quarterly"
+	BudgetPeriodYearly    = "yearly"
+
+	BudgetRolloverNone    = "none"
+	BudgetRolloverSurplus = "surplus"
+	BudgetRolloverFull    = "full"
+)
+
+var ErrBudgetNotFound = errors.New("budget not found")
+
+// defaultBudgetAlertThresholds apply when a budget is saved without thresholds.
+var defaultBudgetAlertThresholds = []int{80, 100}
+
+type BudgetService struct {
+	db   *gorm.DB
+	repo *repository.PaymentRepository
+}
+
+func NewBudgetService(db *gorm.DB) *BudgetService {
+	return &BudgetService{db: db, repo: repository.NewPaymentRepository(db)}
+}
+
+type BudgetInput struct {
+	Category        string  `json:"category"`
+	Period          string  `json:"period"`
+	Amount          float64 `json:"amount"`
+	Rollover        string  `json:"rollover"`
+	AlertThresholds []int   `json:"alert_thresholds"`
+	Enabled         *bool   `json:"enabled"`
+}
+
+// applyTo validates the input and copies it onto budget, filling defaults.
+func (input BudgetInput) applyTo(budget *models.Budget) error {
+	period := strings.ToLower(strings.TrimSpace(input.Period))
+	if period == "" {
+		period = BudgetPeriodMonthly
+	}
+	switch period {
+	case BudgetPeriodMonthly, BudgetPeriodQuarterly, BudgetPeriodYearly:
+	default:
+		return fmt.Errorf("invalid period")
+	}
+
+	rollover := strings.ToLower(strings.TrimSpace(input.Rollover))
+	if rollover == "" {
+		rollover = BudgetRolloverNone
+	}
+	switch rollover {
+	case BudgetRolloverNone, BudgetRolloverSurplus, BudgetRolloverFull:
+	default:
+		return fmt.Errorf("invalid rollover")
+	}
+
+	cents, err := money.FromMajor(input.Amount)
+	if err != nil {
+		return fmt.Errorf("invalid amount: %w", err)
+	}
+	if cents <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+
+	thresholds := input.AlertThresholds
+	if len(thresholds) == 0 {
+		thresholds = defaultBudgetAlertThresholds
+	}
+	seen := make(map[int]bool, len(thresholds))
+	parts := make([]string, 0, len(thresholds))
+	sorted := append([]int(nil), thresholds...)
+	sort.Ints(sorted)
+	for _, t := range sorted {
+		if t <= 0 || t > 1000 {
+			return fmt.Errorf("alert thresholds must be between 1 and 1000 percent")
+		}
+		if !seen[t] {
+			seen[t] = true
+			parts = append(parts, strconv.Itoa(t))
+		}
+	}
+
+	enabled := true
+	if input.Enabled != nil {
+		enabled = *input.Enabled
+	}
+
+	budget.Category = strings.TrimSpace(input.Category)
+	budget.Period = period
+	budget.AmountCents = cents
+	budget.Rollover = rollover
+	budget.AlertThresholdsRaw = strings.Join(parts, ",")
+	budget.Enabled = enabled
+	return budget.AfterFind(nil)
+}
+
+func (s *BudgetService) Create(ownerUserID string, input BudgetInput) (*models.Budget, error) {
+	budget := &models.Budget{
+		ID:          utils.GenerateUUID(),
+		OwnerUserID: strings.TrimSpace(ownerUserID),
+	}
+	if err := input.applyTo(budget); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(budget).Error; err != nil {
+		return nil, err
+	}
+	return budget, nil
+}
+
+func (s *BudgetService) List(ownerUserID string) ([]models.Budget, error) {
+	var out []models.Budget
+	err := s.db.Where("owner_user_id = ?", strings.TrimSpace(ownerUserID)).
+		Order("period ASC, category ASC, created_at ASC").
+		Find(&out).Error
+	return out, err
+}
+
+func (s *BudgetService) GetByID(ownerUserID string, id string) (*models.Budget, error) {
+	return findBudgetForOwner(s.db, ownerUserID, id)
+}
+
+func (s *BudgetService) Update(ownerUserID string, id string, input BudgetInput) (*models.Budget, error) {
+	budget, err := findBudgetForOwner(s.db, ownerUserID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := input.applyTo(budget); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(budget).Error; err != nil {
+		return nil, err
+	}
+	return budget, nil
+}
+
+// Delete removes the budget and its alerts.
+func (s *BudgetService) Delete(ownerUserID string, id string) error {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	id = strings.TrimSpace(id)
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND owner_user_id = ?", id, ownerUserID).Delete(&models.Budget{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrBudgetNotFound
+		}
+		return tx.Where("budget_id = ?", id).Delete(&models.BudgetAlert{}).Error
+	})
+}
+
+func findBudgetForOwner(db *gorm.DB, ownerUserID string, id string) (*models.Budget, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, ErrBudgetNotFound
+	}
+	var budget models.Budget
+	if err := db.Where("id = ? AND owner_user_id = ?", id, strings.TrimSpace(ownerUserID)).First(&budget).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBudgetNotFound
+		}
+		return nil, err
+	}
+	return &budget, nil
+}
+
+// BudgetStatus compares a budget with actual spending in the period containing the report date.
+// Amounts are in the owner's base currency.
+type BudgetStatus struct {
+	Budget      models.Budget `json:"budget"`
+	PeriodStart string        `json:"period_start"` // YYYY-MM-DD
+	PeriodEnd   string        `json:"period_end"`   // YYYY-MM-DD, inclusive
+	Carryover   float64       `json:"carryover"`
+	Available   float64       `json:"available"`
+	Spent       float64       `json:"spent"`
+	Remaining   float64       `json:"remaining"`
+	// Percent is Spent relative to Available; an exhausted budget with any spending counts as 100.
+	Percent  float64 `json:"percent"`
+	Exceeded bool    `json:"exceeded"`
+	// ReachedThresholds lists the alert thresholds reached so far in this period.
+	ReachedThresholds []int `json:"reached_thresholds"`
+
+	availableCents int64
+	spentCents     int64
+}
+
+type BudgetReport struct {
+	Date         string         `json:"date"`
+	BaseCurrency string         `json:"base_currency"`
+	Budgets      []BudgetStatus `json:"budgets"`
+	MissingRates []string       `json:"missing_rates,omitempty"`
+}
+
+// Report returns budget vs actual for the owner's enabled budgets in the periods containing at.
+func (s *BudgetService) Report(ctx context.Context, ownerUserID string, at time.Time) (*BudgetReport, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	var budgets []models.Budget
+	if err := s.db.WithContext(ctx).
+		Where("owner_user_id = ? AND enabled = ?", ownerUserID, true).
+		Order("period ASC, category ASC, created_at ASC").
+		Find(&budgets).Error; err != nil {
+		return nil, err
+	}
+	calc := &budgetCalculator{ctx: ctx, db: s.db, repo: s.repo, ownerUserID: ownerUserID, stats: map[string]*models.PaymentStats{}}
+	statuses := make([]BudgetStatus, 0, len(budgets))
+	for _, budget := range budgets {
+		status, err := calc.status(budget, at)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, *status)
+	}
+
+	report := &BudgetReport{
+		Date:         at.In(loadLocationOrUTC("Asia/Shanghai")).Format("2006-01-02"),
+		BaseCurrency: calc.baseCurrency,
+		Budgets:      statuses,
+	}
+	missing := map[string]bool{}
+	for _, stats := range calc.stats {
+		for _, currency := range stats.MissingRateCurrencies {
+			missing[currency] = true
+		}
+	}
+	for currency := range missing {
+		report.MissingRates = append(report.MissingRates, currency)
+	}
+	sort.Strings(report.MissingRates)
+	return report, nil
+}
+
+// budgetCalculator caches payment stats per period so budgets sharing a period query them once.
+type budgetCalculator struct {
+	ctx          context.Context
+	db           *gorm.DB
+	repo         *repository.PaymentRepository
+	ownerUserID  string
+	stats        map[string]*models.PaymentStats
+	conv         *currencyConverter
+	baseCurrency string
+}
+
+// budgetPeriodBounds returns the start of the period containing t and the start of the next one,
+// using calendar periods in Asia/Shanghai.
+func budgetPeriodBounds(period string, t time.Time) (time.Time, time.Time) {
+	loc := loadLocationOrUTC("Asia/Shanghai")
+	t = t.In(loc)
+	switch period {
+	case BudgetPeriodQuarterly:
+		start := time.Date(t.Year(), time.Month((int(t.Month())-1)/3*3+1), 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 3, 0)
+	case BudgetPeriodYearly:
+		start := time.Date(t.Year(), 1, 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(1, 0, 0)
+	default:
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0)
+	}
+}
+
+// spent returns the converted spending on category ("" for all spending) in [start, end).
+func (c *budgetCalculator) spent(category string, start, end time.Time) (int64, error) {
+	key := start.Format(time.RFC3339) + "|" + end.Format(time.RFC3339)
+	stats, ok := c.stats[key]
+	if !ok {
+		if c.conv == nil {
+			conv, err := newCurrencyConverter(c.ctx, c.db, c.ownerUserID)
+			if err != nil {
+				return 0, err
+			}
+			c.conv = conv
+			c.baseCurrency = conv.base
+		}
+		var err error
+		stats, err = c.repo.GetConvertedStatsByTsCtx(c.ctx, c.ownerUserID, unixMilli(start), unixMilli(end)-1, c.conv.toBase)
+		if err != nil {
+			return 0, err
+		}
+		c.stats[key] = stats
+	}
+	total := stats.TotalAmount
+	if category != "" {
+		total = stats.CategoryStats[category]
+	}
+	return money.FromMajor(total)
+}
+
+func (c *budgetCalculator) status(budget models.Budget, at time.Time) (*BudgetStatus, error) {
+	start, end := budgetPeriodBounds(budget.Period, at)
+	spent, err := c.spent(budget.Category, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rollover looks back one period, and only if the budget already existed then.
+	var carryover int64
+	if budget.Rollover != BudgetRolloverNone && budget.CreatedAt.Before(start) {
+		prevStart, _ := budgetPeriodBounds(budget.Period, start.Add(-time.Millisecond))
+		prevSpent, err := c.spent(budget.Category, prevStart, start)
+		if err != nil {
+			return nil, err
+		}
+		carryover = budget.AmountCents - prevSpent
+		if budget.Rollover == BudgetRolloverSurplus && carryover < 0 {
+			carryover = 0
+		}
+	}
+
+	available := budget.AmountCents + carryover
+	var percent float64
+	switch {
+	case available > 0:
+		percent = float64(spent) * 100 / float64(available)
+	case spent > 0:
+		percent = 100
+	}
+	reached := []int{}
+	for _, t := range budget.AlertThresholds {
+		if percent >= float64(t) {
+			reached = append(reached, t)
+		}
+	}
+
+	return &BudgetStatus{
+		Budget:            budget,
+		PeriodStart:       start.Format("2006-01-02"),
+		PeriodEnd:         end.AddDate(0, 0, -1).Format("2006-01-02"),
+		Carryover:         money.ToMajor(carryover),
+		Available:         money.ToMajor(available),
+		Spent:             money.ToMajor(spent),
+		Remaining:         money.ToMajor(available - spent),
+		Percent:           float64(int64(percent*100+0.5)) / 100,
+		Exceeded:          spent > available,
+		ReachedThresholds: reached,
+		availableCents:    available,
+		spentCents:        spent,
+	}, nil
+}
+
+// CheckPayment raises alerts for budgets the payment counts towards whose current period spending
+// has now reached a threshold. A payment dated outside the period containing now raises nothing,
+// like in CheckPayments. Alerts already raised for the same period and threshold are not
+// repeated, so the payment that first crosses a threshold is the one recorded.
+func (s *BudgetService) CheckPayment(ctx context.Context, ownerUserID string, paymentID string, now time.Time) ([]models.BudgetAlert, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	var rows []struct {
+		Category          string `gorm:"column:category"`
+		TransactionTimeTs int64  `gorm:"column:transaction_time_ts"`
+	}
+	if err := s.db.WithContext(ctx).Table(repository.NetPaymentsTable).
+		Select(`CASE WHEN category IS NULL OR TRIM(category) = '' THEN '未分类' ELSE category END AS category, transaction_time_ts`).
+		Where("id = ? AND owner_user_id = ? AND is_draft = 0 AND is_refund = 0", strings.TrimSpace(paymentID), ownerUserID).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	categories := map[string]bool{"": true}
+	for _, r := range rows {
+		categories[r.Category] = true
+	}
+	at := time.UnixMilli(rows[0].TransactionTimeTs)
+
+	var budgets []models.Budget
+	if err := s.db.WithContext(ctx).
+		Where("owner_user_id = ? AND enabled = ?", ownerUserID, true).
+		Find(&budgets).Error; err != nil {
+		return nil, err
+	}
+	calc := &budgetCalculator{ctx: ctx, db: s.db, repo: s.repo, ownerUserID: ownerUserID, stats: map[string]*models.PaymentStats{}}
+	var created []models.BudgetAlert
+	for _, budget := range budgets {
+		if !categories[budget.Category] {
+			continue
+		}
+		if start, end := budgetPeriodBounds(budget.Period, now); at.Before(start) || !at.Before(end) {
+			continue
+		}
+		status, err := calc.status(budget, now)
+		if err != nil {
+			return nil, err
+		}
+		alerts, err := s.recordAlerts(ctx, ownerUserID, budget, status, paymentID)
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, alerts...)
+	}
+	return created, nil
+}
+
+// CheckPayments is CheckPayment for a batch such as a statement import. Each budget is checked
+// once, and only for the period containing now: old payments must not raise alerts for periods
+// that are long over. The latest payment of the batch counting towards a budget is
+// recorded on its alerts.
+func (s *BudgetService) CheckPayments(ctx context.Context, ownerUserID string, paymentIDs []string, now time.Time) ([]models.BudgetAlert, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	paymentIDs = uniqueTrimmed(paymentIDs)
+	if len(paymentIDs) == 0 {
+		return nil, nil
+	}
+	var budgets []models.Budget
+	if err := s.db.WithContext(ctx).
+		Where("owner_user_id = ? AND enabled = ?", ownerUserID, true).
+		Find(&budgets).Error; err != nil {
+		return nil, err
+	}
+	if len(budgets) == 0 {
+		return nil, nil
+	}
+
+	calc := &budgetCalculator{ctx: ctx, db: s.db, repo: s.repo, ownerUserID: ownerUserID, stats: map[string]*models.PaymentStats{}}
+	var created []models.BudgetAlert
+	for _, budget := range budgets {
+		start, end := budgetPeriodBounds(budget.Period, now)
+		q := s.db.WithContext(ctx).Table(repository.NetPaymentsTable).
+			Select("id").
+			Where("owner_user_id = ? AND is_draft = 0 AND is_refund = 0", ownerUserID).
+			Where("id IN ?", paymentIDs).
+			Where("transaction_time_ts >= ? AND transaction_time_ts < ?", unixMilli(start), unixMilli(end))
+		if budget.Category != "" {
+			q = q.Where(`CASE WHEN category IS NULL OR TRIM(category) = '' THEN '未分类' ELSE category END = ?`, budget.Category)
+		}
+		var latest []string
+		if err := q.Order("transaction_time_ts DESC").Limit(1).Pluck("id", &latest).Error; err != nil {
+			return nil, err
+		}
+		if len(latest) == 0 {
+			continue
+		}
+		status, err := calc.status(budget, now)
+		if err != nil {
+			return nil, err
+		}
+		alerts, err := s.recordAlerts(ctx, ownerUserID, budget, status, latest[0])
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, alerts...)
+	}
+	return created, nil
+}
+
+// recordAlerts stores an alert for each threshold the budget has reached in the status period,
+// skipping thresholds already alerted for that period.
+func (s *BudgetService) recordAlerts(ctx context.Context, ownerUserID string, budget models.Budget, status *BudgetStatus, paymentID string) ([]models.BudgetAlert, error) {
+	var created []models.BudgetAlert
+	for _, threshold := range status.ReachedThresholds {
+		alert := models.BudgetAlert{
+			ID:          utils.GenerateUUID(),
+			OwnerUserID: ownerUserID,
+			BudgetID:    budget.ID,
+			PeriodStart: status.PeriodStart,
+			Threshold:   threshold,
+			Category:    budget.Category,
+			PaymentID:   &paymentID,
+			SpentCents:  status.spentCents,
+			LimitCents:  status.availableCents,
+		}
+		res := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&alert)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected > 0 {
+			_ = alert.AfterFind(nil)
+			created = append(created, alert)
+		}
+	}
+	return created, nil
+}
+
+// ListAlerts returns the owner's alerts, newest first.
+func (s *BudgetService) ListAlerts(ownerUserID string, unreadOnly bool) ([]models.BudgetAlert, error) {
+	q := s.db.Where("owner_user_id = ?", strings.TrimSpace(ownerUserID))
+	if unreadOnly {
+		q = q.Where("read = ?", false)
+	}
+	var out []models.BudgetAlert
+	err := q.Order("created_at DESC").Find(&out).Error
+	return out, err
+}
+
+// MarkAlertsRead marks the given alerts, or all of the owner's alerts when ids is empty, as read.
+func (s *BudgetService) MarkAlertsRead(ownerUserID string, ids []string) error {
+	q := s.db.Model(&models.BudgetAlert{}).Where("owner_user_id = ?", strings.TrimSpace(ownerUserID))
+	if ids = uniqueTrimmed(ids); len(ids) > 0 {
+		q = q.Where("id IN ?", ids)
+	}
+	return q.Update("read", true).Error
+}
+
+// checkBudgetAlerts runs the budget check after a payment was saved. Failures are logged only:
+// alerts must never block recording a payment.
+func (s *PaymentService) checkBudgetAlerts(ownerUserID string, paymentID string) {
+	if _, err := NewBudgetService(s.db).CheckPayment(context.Background(), ownerUserID, paymentID, time.Now()); err != nil {
+		log.Printf("[Budget] 检查预算提醒失败 payment_id=%s err=%v", paymentID, err)
+	}
+}
+
+// checkBatchBudgetAlerts runs the budget check once after a batch of payments was saved.
+func (s *PaymentService) checkBatchBudgetAlerts(ownerUserID string, paymentIDs []string) {
+	if _, err := NewBudgetService(s.db).CheckPayments(context.Background(), ownerUserID, paymentIDs, time.Now()); err != nil {
+		log.Printf("[Budget] 检查预算提醒失败 payments=%d err=%v", len(paymentIDs), err)
+	}
+}
@@ -0,0 +1,133 @@
+//go:build cgo
+
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"smart-bill-manager/internal/models"
+)
+
+func TestBudgetReportAndThresholdAlerts(t *testing.T) {
+	db := openServiceTestDB(t)
+	payments := NewPaymentService(db, t.TempDir())
+	budgets := NewBudgetService(db)
+	ctx := context.Background()
+
+	food, err := budgets.Create("owner-1", BudgetInput{Category: "餐饮", Amount: 100})
+	if err != nil {
+		t.Fatalf("创建预算失败: %v", err)
+	}
+	if food.Period != BudgetPeriodMonthly || len(food.AlertThresholds) != 2 || food.AlertThresholds[0] != 80 {
+		t.Fatalf("预算默认值异常: %#v", food)
+	}
+	if _, err := budgets.Create("owner-1", BudgetInput{Category: "餐饮", Amount: 100, Period: "weekly"}); err == nil {
+		t.Fatalf("不支持的周期应被拒绝")
+	}
+
+	category := "餐饮"
+	now := time.Date(2025, 11, 20, 0, 0, 0, 0, time.UTC)
+	create := func(amount float64, at string) *models.Payment {
+		t.Helper()
+		p, err := payments.create("owner-1", CreatePaymentInput{Amount: amount, Category: &category, TransactionTime: at}, false)
+		if err != nil {
+			t.Fatalf("创建支付失败: %v", err)
+		}
+		if _, err := budgets.CheckPayment(ctx, "owner-1", p.ID, now); err != nil {
+			t.Fatalf("检查预算失败: %v", err)
+		}
+		return p
+	}
+	create(50, "2025-11-03T04:00:00Z")
+	if alerts, _ := budgets.ListAlerts("owner-1", false); len(alerts) != 0 {
+		t.Fatalf("未达到阈值不应提醒: %#v", alerts)
+	}
+	crossing := create(35, "2025-11-05T04:00:00Z")
+	alerts, err := budgets.ListAlerts("owner-1", true)
+	if err != nil || len(alerts) != 1 || alerts[0].Threshold != 80 || alerts[0].PaymentID == nil || *alerts[0].PaymentID != crossing.ID {
+		t.Fatalf("达到 80%% 应提醒一次: %#v %v", alerts, err)
+	}
+	if alerts[0].Spent != 85 || alerts[0].Limit != 100 || alerts[0].PeriodStart != "2025-11-01" {
+		t.Fatalf("提醒内容异常: %#v", alerts[0])
+	}
+	create(20, "2025-11-06T04:00:00Z")
+	create(5, "2025-11-07T04:00:00Z")
+	if alerts, _ = budgets.ListAlerts("owner-1", false); len(alerts) != 2 || alerts[0].Threshold != 100 {
+		t.Fatalf("超出 100%% 应再提醒一次且不重复: %#v", alerts)
+	}
+	if err := budgets.MarkAlertsRead("owner-1", nil); err != nil {
+		t.Fatalf("标记已读失败: %v", err)
+	}
+	if unread, _ := budgets.ListAlerts("owner-1", true); len(unread) != 0 {
+		t.Fatalf("全部标记后不应有未读提醒: %#v", unread)
+	}
+
+	// Rollover carries the previous month's balance of a budget that already existed then.
+	total, err := budgets.Create("owner-1", BudgetInput{Amount: 300, Rollover: BudgetRolloverFull, AlertThresholds: []int{150}})
+	if err != nil {
+		t.Fatalf("创建总预算失败: %v", err)
+	}
+	if err := db.Model(&models.Budget{}).Where("id = ?", total.ID).
+		Update("created_at", time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)).Error; err != nil {
+		t.Fatalf("调整预算创建时间失败: %v", err)
+	}
+	create(400, "2025-10-15T04:00:00Z")
+
+	report, err := budgets.Report(ctx, "owner-1", now)
+	if err != nil || len(report.Budgets) != 2 {
+		t.Fatalf("获取预算报告失败: %#v %v", report, err)
+	}
+	byID := make(map[string]BudgetStatus, len(report.Budgets))
+	for _, s := range report.Budgets {
+		byID[s.Budget.ID] = s
+	}
+	if got := byID[food.ID]; got.Spent != 110 || got.Remaining != -10 || !got.Exceeded || got.Percent != 110 || got.Carryover != 0 {
+		t.Fatalf("分类预算执行情况异常: %#v", got)
+	}
+	if got := byID[total.ID]; got.Carryover != -100 || got.Available != 200 || got.Spent != 110 || got.Exceeded {
+		t.Fatalf("总预算应结转上月超支: %#v", got)
+	}
+}
+
+func TestBudgetCheckPaymentsOnlyAlertsCurrentPeriod(t *testing.T) {
+	db := openServiceTestDB(t)
+	payments := NewPaymentService(db, t.TempDir())
+	budgets := NewBudgetService(db)
+
+	if _, err := budgets.Create("owner-1", BudgetInput{Category: "餐饮", Amount: 100}); err != nil {
+		t.Fatalf("创建预算失败: %v", err)
+	}
+	category := "餐饮"
+	var ids []string
+	for _, p := range []struct {
+		amount float64
+		at     string
+	}{
+		{200, "2025-10-15T04:00:00Z"},
+		{50, "2025-11-03T04:00:00Z"},
+		{40, "2025-11-05T04:00:00Z"},
+	} {
+		created, err := payments.create("owner-1", CreatePaymentInput{Amount: p.amount, Category: &category, TransactionTime: p.at}, false)
+		if err != nil {
+			t.Fatalf("创建支付失败: %v", err)
+		}
+		ids = append(ids, created.ID)
+	}
+	if alerts, _ := budgets.ListAlerts("owner-1", false); len(alerts) != 0 {
+		t.Fatalf("批量导入时不应逐条检查预算: %#v", alerts)
+	}
+	now := time.Date(2025, 11, 20, 0, 0, 0, 0, time.UTC)
+	if old, err := budgets.CheckPayment(context.Background(), "owner-1", ids[0], now); err != nil || len(old) != 0 {
+		t.Fatalf("上月的支付不应提醒: %#v %v", old, err)
+	}
+
+	created, err := budgets.CheckPayments(context.Background(), "owner-1", ids, now)
+	if err != nil {
+		t.Fatalf("批量检查预算失败: %v", err)
+	}
+	if len(created) != 1 || created[0].Threshold != 80 || created[0].PeriodStart != "2025-11-01" || *created[0].PaymentID != ids[2] {
+		t.Fatalf("只应为当前周期提醒一次: %#v", created)
+	}
+}
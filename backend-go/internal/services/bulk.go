@@ -0,0 +1,395 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// MaxBulkItems caps how many records a single bulk request may touch.
+const MaxBulkItems = 500
+
+const (
+	BulkActionUpdate = "update"
+	BulkActionDelete = "delete"
+)
+
+const bulkErrorNotFound = "not_found"
+
+var ErrInvalidBulkRequest = errors.New("invalid bulk request")
+
+// BulkItemResult reports the outcome for one requested ID.
+type BulkItemResult struct {
+	ID    string `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type BulkResult struct {
+	Action    string           `json:"action"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Items     []BulkItemResult `json:"items"`
+	// Assignment summarizes the trip re-assignment run when payments were put back on auto.
+	Assignment *AssignmentChangeSummary `json:"assignment,omitempty"`
+}
+
+func newBulkResult(action string, ids []string, found map[string]bool) *BulkResult {
+	out := &BulkResult{Action: action, Items: make([]BulkItemResult, 0, len(ids))}
+	for _, id := range ids {
+		if found[id] {
+			out.Items = append(out.Items, BulkItemResult{ID: id, OK: true})
+			out.Succeeded++
+		} else {
+			out.Items = append(out.Items, BulkItemResult{ID: id, Error: bulkErrorNotFound})
+			out.Failed++
+		}
+	}
+	return out
+}
+
+// resolveBulkIDs returns the explicit IDs of a bulk request, or the IDs matched by its filter
+// when none were given. Exactly one of the two must be provided.
+func resolveBulkIDs(ids []string, hasFilter bool, find func(limit int) ([]string, error)) ([]string, error) {
+	ids = uniqueTrimmed(ids)
+	switch {
+	case len(ids) > 0 && hasFilter:
+		return nil, fmt.Errorf("%w: ids and filter are mutually exclusive", ErrInvalidBulkRequest)
+	case len(ids) == 0 && !hasFilter:
+		return nil, fmt.Errorf("%w: ids or filter is required", ErrInvalidBulkRequest)
+	case hasFilter:
+		matched, err := find(MaxBulkItems + 1)
+		if err != nil {
+			return nil, err
+		}
+		ids = matched
+	}
+	if len(ids) > MaxBulkItems {
+		return nil, fmt.Errorf("%w: at most %d records per request", ErrInvalidBulkRequest, MaxBulkItems)
+	}
+	return ids, nil
+}
+
+func normalizeBulkAction(action string) (string, error) {
+	switch action = strings.ToLower(strings.TrimSpace(action)); action {
+	case BulkActionUpdate, BulkActionDelete:
+		return action, nil
+	default:
+		return "", fmt.Errorf("%w: unsupported action %q", ErrInvalidBulkRequest, action)
+	}
+}
+
+// BulkPaymentInput selects payments by IDs or by a list filter (same keys as GET /payments)
+// and applies one action to all of them.
+type BulkPaymentInput struct {
+	IDs    []string            `json:"ids"`
+	Filter *PaymentFilterInput `json:"filter"`
+	Action string              `json:"action"` // update|delete
+	// Update fields; omitted fields are left unchanged. TripID and TripAssignSrc follow the
+	// same rules as the single-payment update.
+	Category      *string `json:"category"`
+	TripID        *string `json:"trip_id"`
+	TripAssignSrc *string `json:"trip_assignment_source"`
+	BadDebt       *bool   `json:"bad_debt"`
+}
+
+// bulkPaymentUpdates turns the update fields of a bulk request into column updates.
+func (s *PaymentService) bulkPaymentUpdates(ownerUserID string, input BulkPaymentInput) (map[string]interface{}, bool, error) {
+	data := make(map[string]interface{})
+	if input.Category != nil {
+		data["category"] = strings.TrimSpace(*input.Category)
+	}
+	if input.BadDebt != nil {
+		data["bad_debt"] = *input.BadDebt
+	}
+
+	toAuto := false
+	if input.TripID != nil || input.TripAssignSrc != nil {
+		tripID := ""
+		if input.TripID != nil {
+			tripID = strings.TrimSpace(*input.TripID)
+		}
+		src := ""
+		if input.TripAssignSrc != nil {
+			src = strings.TrimSpace(*input.TripAssignSrc)
+		}
+		if src == "" {
+			if tripID == "" {
+				src = assignSrcBlocked
+			} else {
+				src = assignSrcManual
+			}
+		}
+		switch src {
+		case assignSrcBlocked:
+			data["trip_id"] = nil
+			data["trip_assignment_source"] = assignSrcBlocked
+			data["trip_assignment_state"] = assignStateBlocked
+		case assignSrcManual:
+			if tripID == "" {
+				data["trip_id"] = nil
+				data["trip_assignment_state"] = assignStateNoMatch
+			} else {
+				var count int64
+				if err := s.db.Model(&models.Trip{}).Where("id = ? AND owner_user_id = ?", tripID, ownerUserID).Count(&count).Error; err != nil {
+					return nil, false, err
+				}
+				if count == 0 {
+					return nil, false, fmt.Errorf("%w: trip not found", ErrInvalidBulkRequest)
+				}
+				data["trip_id"] = tripID
+				data["trip_assignment_state"] = assignStateAssigned
+			}
+			data["trip_assignment_source"] = assignSrcManual
+		case assignSrcAuto:
+			if tripID != "" {
+				return nil, false, fmt.Errorf("%w: trip_id cannot be set with automatic assignment", ErrInvalidBulkRequest)
+			}
+			data["trip_assignment_source"] = assignSrcAuto
+			toAuto = true
+		default:
+			return nil, false, fmt.Errorf("invalid trip_assignment_source")
+		}
+	}
+	if len(data) == 0 {
+		return nil, false, fmt.Errorf("%w: nothing to update", ErrInvalidBulkRequest)
+	}
+	return data, toAuto, nil
+}
+
+// Bulk applies one update or delete to many payments in a single transaction. Trip
+// re-assignment and bad-debt locks are recomputed once for the whole batch.
+func (s *PaymentService) Bulk(ownerUserID string, input BulkPaymentInput) (*BulkResult, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	action, err := normalizeBulkAction(input.Action)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]interface{}
+	toAuto := false
+	if action == BulkActionUpdate {
+		if data, toAuto, err = s.bulkPaymentUpdates(ownerUserID, input); err != nil {
+			return nil, err
+		}
+	}
+
+	ids, err := resolveBulkIDs(input.IDs, input.Filter != nil, func(limit int) ([]string, error) {
+		filter, err := s.repositoryFilter(ownerUserID, *input.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBulkRequest, err)
+		}
+		return s.repo.FindIDs(filter, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var payments []models.Payment
+	if len(ids) > 0 {
+		if err := s.db.Select("id", "trip_id", "transaction_time_ts", "is_draft", "screenshot_path").
+			Where("owner_user_id = ? AND id IN ?", ownerUserID, ids).
+			Find(&payments).Error; err != nil {
+			return nil, err
+		}
+	}
+	found := make(map[string]bool, len(payments))
+	foundIDs := make([]string, 0, len(payments))
+	affectedTrips := make([]string, 0, len(payments))
+	for _, p := range payments {
+		found[p.ID] = true
+		foundIDs = append(foundIDs, p.ID)
+		if p.TripID != nil {
+			affectedTrips = append(affectedTrips, *p.TripID)
+		}
+	}
+	result := newBulkResult(action, ids, found)
+	if len(foundIDs) == 0 {
+		return result, nil
+	}
+
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if action == BulkActionDelete {
+			for _, id := range foundIDs {
+				if err := s.deletePaymentTx(tx, ownerUserID, id); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		if err := tx.Model(&models.Payment{}).
+			Where("owner_user_id = ? AND id IN ?", ownerUserID, foundIDs).
+			Updates(data).Error; err != nil {
+			return err
+		}
+		if _, ok := data["trip_id"]; ok {
+			if err := syncAutoSplitTripsTx(tx, ownerUserID, foundIDs); err != nil {
+				return err
+			}
+		}
+		if !toAuto {
+			return nil
+		}
+		startTs, endTs := payments[0].TransactionTimeTs, payments[0].TransactionTimeTs
+		for _, p := range payments[1:] {
+			startTs = min(startTs, p.TransactionTimeTs)
+			endTs = max(endTs, p.TransactionTimeTs)
+		}
+		summary, tripIDs, err := recomputeAutoAssignmentsForRangeTx(tx, ownerUserID, startTs, endTs+1)
+		if err != nil {
+			return err
+		}
+		result.Assignment = summary
+		affectedTrips = append(affectedTrips, tripIDs...)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if action == BulkActionDelete {
+		for _, p := range payments {
+			if p.ScreenshotPath != nil {
+				removeUnreferencedFile(s.db, s.uploadsDir, *p.ScreenshotPath)
+			}
+		}
+	} else {
+		var tripIDs []string
+		if err := s.db.Model(&models.Payment{}).
+			Where("id IN ? AND trip_id IS NOT NULL", foundIDs).
+			Distinct().Pluck("trip_id", &tripIDs).Error; err != nil {
+			return nil, err
+		}
+		affectedTrips = append(affectedTrips, tripIDs...)
+		if _, ok := data["category"]; ok {
+			for _, p := range payments {
+				if !p.IsDraft {
+					s.checkBudgetAlerts(ownerUserID, p.ID)
+				}
+			}
+		}
+	}
+	if err := recalcTripBadDebtLockedForTripIDs(s.db, affectedTrips); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// BulkInvoiceInput selects invoices by IDs or by a list filter (same keys as GET /invoices).
+// Invoices carry no category or trip of their own, so updates are limited to the bad-debt flag.
+type BulkInvoiceInput struct {
+	IDs     []string            `json:"ids"`
+	Filter  *InvoiceFilterInput `json:"filter"`
+	Action  string              `json:"action"` // update|delete
+	BadDebt *bool               `json:"bad_debt"`
+}
+
+// Bulk applies one update or delete to many invoices in a single transaction and recomputes
+// the bad-debt locks of the trips behind their payments once.
+func (s *InvoiceService) Bulk(ownerUserID string, input BulkInvoiceInput) (*BulkResult, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	action, err := normalizeBulkAction(input.Action)
+	if err != nil {
+		return nil, err
+	}
+	if action == BulkActionUpdate && input.BadDebt == nil {
+		return nil, fmt.Errorf("%w: nothing to update", ErrInvalidBulkRequest)
+	}
+
+	ids, err := resolveBulkIDs(input.IDs, input.Filter != nil, func(limit int) ([]string, error) {
+		return s.repo.FindIDs(repository.InvoiceFilter{
+			OwnerUserID:  ownerUserID,
+			StartDate:    strings.TrimSpace(input.Filter.StartDate),
+			EndDate:      strings.TrimSpace(input.Filter.EndDate),
+			TagIDs:       input.Filter.TagIDs,
+			IncludeDraft: input.Filter.IncludeDraft,
+		}, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var invoices []models.Invoice
+	if len(ids) > 0 {
+		if err := s.db.Select("id", "file_path").
+			Where("owner_user_id = ? AND id IN ?", ownerUserID, ids).
+			Find(&invoices).Error; err != nil {
+			return nil, err
+		}
+	}
+	found := make(map[string]bool, len(invoices))
+	foundIDs := make([]string, 0, len(invoices))
+	for _, inv := range invoices {
+		found[inv.ID] = true
+		foundIDs = append(foundIDs, inv.ID)
+	}
+	result := newBulkResult(action, ids, found)
+	if len(foundIDs) == 0 {
+		return result, nil
+	}
+
+	affectedTrips, err := tripIDsForInvoices(s.db, ownerUserID, foundIDs)
+	if err != nil {
+		return nil, err
+	}
+	var attachments []models.InvoiceAttachment
+	if action == BulkActionDelete {
+		if err := s.db.Where("owner_user_id = ? AND invoice_id IN ?", ownerUserID, foundIDs).Find(&attachments).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if action == BulkActionUpdate {
+			return tx.Model(&models.Invoice{}).
+				Where("owner_user_id = ? AND id IN ?", ownerUserID, foundIDs).
+				Update("bad_debt", *input.BadDebt).Error
+		}
+		for _, id := range foundIDs {
+			if err := s.deleteInvoiceTx(tx, ownerUserID, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if action == BulkActionDelete {
+		byInvoice := make(map[string][]models.InvoiceAttachment, len(invoices))
+		for _, a := range attachments {
+			byInvoice[a.InvoiceID] = append(byInvoice[a.InvoiceID], a)
+		}
+		for i := range invoices {
+			s.removeInvoiceFiles(&invoices[i], byInvoice[invoices[i].ID])
+		}
+	}
+	if err := recalcTripBadDebtLockedForTripIDs(s.db, affectedTrips); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// tripIDsForInvoices returns the trips of the payments the invoices are linked to, through
+// either the link table or the legacy invoices.payment_id column.
+func tripIDsForInvoices(db *gorm.DB, ownerUserID string, invoiceIDs []string) ([]string, error) {
+	var viaLinks []string
+	if err := db.Table("payments AS p").
+		Joins("JOIN "+repository.InvoicePaymentPairsTable+" AS l ON l.payment_id = p.id").
+		Where("p.owner_user_id = ? AND l.invoice_id IN ? AND p.trip_id IS NOT NULL", ownerUserID, invoiceIDs).
+		Distinct().Pluck("p.trip_id", &viaLinks).Error; err != nil {
+		return nil, err
+	}
+	var viaLegacy []string
+	if err := db.Table("payments AS p").
+		Joins("JOIN invoices AS i ON i.payment_id = p.id").
+		Where("p.owner_user_id = ? AND i.id IN ? AND p.trip_id IS NOT NULL", ownerUserID, invoiceIDs).
+		Distinct().Pluck("p.trip_id", &viaLegacy).Error; err != nil {
+		return nil, err
+	}
+	return append(viaLinks, viaLegacy...), nil
+}
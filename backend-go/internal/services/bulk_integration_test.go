@@ -0,0 +1,151 @@
+//go:build cgo
+
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"smart-bill-manager/internal/models"
+)
+
+func TestBulkPaymentAndInvoiceOperations(t *testing.T) {
+	db := openServiceTestDB(t)
+	payments := NewPaymentService(db, t.TempDir())
+	invoices := NewInvoiceService(db, t.TempDir())
+	trips := NewTripService(db, t.TempDir())
+
+	trip, _, err := trips.Create("owner-1", CreateTripInput{
+		Name:      "杭州出差",
+		StartTime: "2025-12-01T00:00:00+08:00",
+		EndTime:   "2025-12-03T00:00:00+08:00",
+	})
+	if err != nil {
+		t.Fatalf("创建行程失败: %v", err)
+	}
+	create := func(owner string, amount float64, at string) *models.Payment {
+		t.Helper()
+		p, err := payments.Create(owner, CreatePaymentInput{Amount: amount, TransactionTime: at})
+		if err != nil {
+			t.Fatalf("创建支付失败: %v", err)
+		}
+		return p
+	}
+	taxi := create("owner-1", 30, "2025-12-01T02:00:00Z")
+	hotel := create("owner-1", 300, "2025-12-01T12:00:00Z")
+	rent := create("owner-1", 3000, "2025-11-20T02:00:00Z")
+	foreign := create("owner-2", 10, "2025-12-01T02:00:00Z")
+	tripLocked := func() bool {
+		t.Helper()
+		var stored models.Trip
+		if err := db.First(&stored, "id = ?", trip.ID).Error; err != nil {
+			t.Fatalf("读取行程失败: %v", err)
+		}
+		return stored.BadDebtLocked
+	}
+
+	category := "差旅"
+	badDebt := true
+	result, err := payments.Bulk("owner-1", BulkPaymentInput{
+		IDs:      []string{taxi.ID, hotel.ID, foreign.ID, taxi.ID},
+		Action:   BulkActionUpdate,
+		Category: &category,
+		BadDebt:  &badDebt,
+	})
+	if err != nil {
+		t.Fatalf("批量更新失败: %v", err)
+	}
+	if result.Succeeded != 2 || result.Failed != 1 || len(result.Items) != 3 || result.Items[2].Error != "not_found" {
+		t.Fatalf("批量结果应按 ID 报告且忽略他人记录: %#v", result)
+	}
+	if !tripLocked() {
+		t.Fatalf("标记坏账后行程应被锁定")
+	}
+	if got, _ := payments.GetByID("owner-2", foreign.ID); got.Category != nil {
+		t.Fatalf("不应修改其他用户的支付: %#v", got.Category)
+	}
+
+	blocked := assignSrcBlocked
+	if result, err = payments.Bulk("owner-1", BulkPaymentInput{
+		Filter:        &PaymentFilterInput{Category: "差旅"},
+		Action:        BulkActionUpdate,
+		TripAssignSrc: &blocked,
+	}); err != nil || result.Succeeded != 2 {
+		t.Fatalf("按筛选条件批量移出行程失败: %#v %v", result, err)
+	}
+	if got, _ := payments.GetByID("owner-1", hotel.ID); got.TripID != nil || got.TripAssignState != assignStateBlocked {
+		t.Fatalf("支付应移出行程: %#v", got)
+	}
+	if tripLocked() {
+		t.Fatalf("坏账支付移出后行程应解锁")
+	}
+
+	auto := assignSrcAuto
+	if result, err = payments.Bulk("owner-1", BulkPaymentInput{
+		IDs:           []string{taxi.ID, hotel.ID, rent.ID},
+		Action:        BulkActionUpdate,
+		TripAssignSrc: &auto,
+	}); err != nil || result.Assignment == nil || result.Assignment.AutoAssigned != 2 {
+		t.Fatalf("恢复自动归属应重新分配行程: %#v %v", result, err)
+	}
+	if got, _ := payments.GetByID("owner-1", taxi.ID); got.TripID == nil || *got.TripID != trip.ID {
+		t.Fatalf("支付应重新归入行程: %#v", got.TripID)
+	}
+	if got, _ := payments.GetByID("owner-1", rent.ID); got.TripID != nil {
+		t.Fatalf("行程外的支付不应被分配: %#v", got.TripID)
+	}
+	if !tripLocked() {
+		t.Fatalf("坏账支付回到行程后应重新锁定")
+	}
+
+	badDebt = false
+	if _, err := payments.Bulk("owner-1", BulkPaymentInput{IDs: []string{taxi.ID, hotel.ID}, Action: BulkActionUpdate, BadDebt: &badDebt}); err != nil {
+		t.Fatalf("批量取消坏账失败: %v", err)
+	}
+	invoice := &models.Invoice{
+		ID: "invoice-1", OwnerUserID: "owner-1", Filename: "a.pdf", OriginalName: "a.pdf",
+		FilePath: "uploads/a.pdf", ParseStatus: "success", Source: "upload", DedupStatus: "ok",
+	}
+	if err := db.Create(invoice).Error; err != nil {
+		t.Fatalf("创建发票失败: %v", err)
+	}
+	if err := invoices.LinkPayment("owner-1", invoice.ID, hotel.ID); err != nil {
+		t.Fatalf("关联发票失败: %v", err)
+	}
+	badDebt = true
+	if result, err = invoices.Bulk("owner-1", BulkInvoiceInput{IDs: []string{invoice.ID}, Action: BulkActionUpdate, BadDebt: &badDebt}); err != nil || result.Succeeded != 1 {
+		t.Fatalf("批量标记发票坏账失败: %#v %v", result, err)
+	}
+	if !tripLocked() {
+		t.Fatalf("关联坏账发票后行程应被锁定")
+	}
+	if result, err = invoices.Bulk("owner-1", BulkInvoiceInput{Filter: &InvoiceFilterInput{}, Action: BulkActionDelete}); err != nil || result.Succeeded != 1 {
+		t.Fatalf("批量删除发票失败: %#v %v", result, err)
+	}
+	if tripLocked() {
+		t.Fatalf("删除坏账发票后行程应解锁")
+	}
+	var links int64
+	db.Model(&models.InvoicePaymentLink{}).Where("invoice_id = ?", invoice.ID).Count(&links)
+	if links != 0 {
+		t.Fatalf("删除发票应移除关联: %d", links)
+	}
+
+	if result, err = payments.Bulk("owner-1", BulkPaymentInput{IDs: []string{rent.ID, "missing"}, Action: BulkActionDelete}); err != nil || result.Succeeded != 1 || result.Failed != 1 {
+		t.Fatalf("批量删除支付失败: %#v %v", result, err)
+	}
+	if _, err := payments.GetByID("owner-1", rent.ID); err == nil {
+		t.Fatalf("支付应已删除")
+	}
+
+	for name, input := range map[string]BulkPaymentInput{
+		"同时指定 ID 与筛选": {IDs: []string{taxi.ID}, Filter: &PaymentFilterInput{}, Action: BulkActionUpdate, Category: &category},
+		"没有更新字段":      {IDs: []string{taxi.ID}, Action: BulkActionUpdate},
+		"未知操作":        {IDs: []string{taxi.ID}, Action: "archive"},
+		"行程不存在":       {IDs: []string{taxi.ID}, Action: BulkActionUpdate, TripID: &foreign.ID},
+	} {
+		if _, err := payments.Bulk("owner-1", input); !errors.Is(err, ErrInvalidBulkRequest) {
+			t.Fatalf("%s应被拒绝: %v", name, err)
+		}
+	}
+}
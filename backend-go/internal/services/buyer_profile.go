@@ -0,0 +1,445 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// Buyer check results, see models.Invoice.BuyerCheck. An empty result means the invoice was not
+// checked: its owner has no buyer profiles, or the invoice type carries no buyer.
+const (
+	BuyerCheckOK           = "ok"
+	BuyerCheckWrongTitle   = "wrong_title"
+	BuyerCheckWrongTaxID   = "wrong_tax_id"
+	BuyerCheckMissingTaxID = "missing_tax_id"
+	BuyerCheckPersonal     = "personal"
+)
+
+// BuyerCheckMismatch filters invoices with any failed buyer check.
+const BuyerCheckMismatch = "mismatch"
+
+// InvoiceWarningBuyerMismatch flags an invoice whose buyer does not match the user's buyer profiles.
+const InvoiceWarningBuyerMismatch = "buyer_mismatch"
+
+var (
+	ErrBuyerProfileNotFound  = errors.New("buyer profile not found")
+	ErrBuyerProfileForbidden = errors.New("shared buyer profiles are managed by admins")
+)
+
+// IsValidBuyerCheck reports whether v is a buyer check result or BuyerCheckMismatch.
+func IsValidBuyerCheck(v string) bool {
+	switch v {
+	case BuyerCheckOK, BuyerCheckWrongTitle, BuyerCheckWrongTaxID, BuyerCheckMissingTaxID, BuyerCheckPersonal, BuyerCheckMismatch:
+		return true
+	}
+	return false
+}
+
+type BuyerProfileService struct {
+	db *gorm.DB
+}
+
+func NewBuyerProfileService(db *gorm.DB) *BuyerProfileService {
+	return &BuyerProfileService{db: db}
+}
+
+type BuyerProfileInput struct {
+	Name    string   `json:"name" binding:"required"`
+	TaxID   string   `json:"tax_id"`
+	Aliases []string `json:"aliases"`
+	// Shared makes the profile apply to every user; only admins may create one.
+	Shared bool `json:"shared"`
+}
+
+// applyTo validates the input and copies it onto profile.
+func (input BuyerProfileInput) applyTo(profile *models.BuyerProfile) error {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	taxID := normalizeBuyerTaxID(input.TaxID)
+	if taxID != "" && !isValidTaxID(taxID) {
+		return fmt.Errorf("invalid tax_id")
+	}
+	aliases := make([]string, 0, len(input.Aliases))
+	for _, alias := range input.Aliases {
+		if alias = strings.TrimSpace(strings.ReplaceAll(alias, "\n", " ")); alias != "" {
+			aliases = append(aliases, alias)
+		}
+	}
+
+	profile.Name = name
+	profile.TaxID = taxID
+	profile.AliasesRaw = strings.Join(aliases, "\n")
+	return profile.AfterFind(nil)
+}
+
+// List returns the user's own profiles followed by the shared ones.
+func (s *BuyerProfileService) List(ownerUserID string) ([]models.BuyerProfile, error) {
+	return loadBuyerProfiles(s.db, ownerUserID)
+}
+
+// Create adds a profile and re-checks the buyers of the invoices it applies to.
+func (s *BuyerProfileService) Create(ownerUserID string, isAdmin bool, input BuyerProfileInput) (*models.BuyerProfile, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	if input.Shared {
+		if !isAdmin {
+			return nil, ErrBuyerProfileForbidden
+		}
+		ownerUserID = ""
+	}
+	profile := &models.BuyerProfile{ID: utils.GenerateUUID(), OwnerUserID: ownerUserID}
+	if err := input.applyTo(profile); err != nil {
+		return nil, err
+	}
+	if err := s.writeAndRecheck(profile.OwnerUserID, func(tx *gorm.DB) error {
+		return tx.Create(profile).Error
+	}); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// Update saves a profile; whether it is shared does not change.
+func (s *BuyerProfileService) Update(ownerUserID string, isAdmin bool, id string, input BuyerProfileInput) (*models.BuyerProfile, error) {
+	profile, err := s.findEditable(ownerUserID, isAdmin, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := input.applyTo(profile); err != nil {
+		return nil, err
+	}
+	if err := s.writeAndRecheck(profile.OwnerUserID, func(tx *gorm.DB) error {
+		return tx.Save(profile).Error
+	}); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func (s *BuyerProfileService) Delete(ownerUserID string, isAdmin bool, id string) error {
+	profile, err := s.findEditable(ownerUserID, isAdmin, id)
+	if err != nil {
+		return err
+	}
+	return s.writeAndRecheck(profile.OwnerUserID, func(tx *gorm.DB) error {
+		return tx.Delete(&models.BuyerProfile{}, "id = ?", profile.ID).Error
+	})
+}
+
+// writeAndRecheck runs a profile write and re-checks the buyers of the invoices it applies to. A
+// user's own profile covers only their invoices, which are re-checked in the same transaction. A
+// shared profile covers every user's; those are re-checked after the write commits, batch by batch,
+// so the write lock is never held for the whole scan. A failed re-check is only logged: the profile
+// is saved and the next change re-checks again.
+func (s *BuyerProfileService) writeAndRecheck(profileOwnerID string, write func(tx *gorm.DB) error) error {
+	if profileOwnerID != "" {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			if err := write(tx); err != nil {
+				return err
+			}
+			return recheckInvoiceBuyersTx(tx, profileOwnerID)
+		})
+	}
+	if err := s.db.Transaction(write); err != nil {
+		return err
+	}
+	if err := recheckAllInvoiceBuyers(s.db); err != nil {
+		log.Printf("[BuyerCheck] 重新校验购买方失败 err=%v", err)
+	}
+	return nil
+}
+
+// findEditable returns a profile of the user, or a shared one when the user is an admin.
+func (s *BuyerProfileService) findEditable(ownerUserID string, isAdmin bool, id string) (*models.BuyerProfile, error) {
+	var profile models.BuyerProfile
+	err := s.db.Where("id = ? AND owner_user_id IN ?", strings.TrimSpace(id), []string{strings.TrimSpace(ownerUserID), ""}).
+		First(&profile).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBuyerProfileNotFound
+		}
+		return nil, err
+	}
+	if profile.Shared && !isAdmin {
+		return nil, ErrBuyerProfileForbidden
+	}
+	return &profile, nil
+}
+
+const buyerRecheckBatchSize = 500
+
+// recheckInvoiceBuyersTx recomputes the buyer checks of one user's invoices inside tx.
+func recheckInvoiceBuyersTx(tx *gorm.DB, ownerUserID string) error {
+	for afterID := ""; ; {
+		lastID, err := recheckInvoiceBuyerBatch(tx, ownerUserID, afterID)
+		if err != nil || lastID == "" {
+			return err
+		}
+		afterID = lastID
+	}
+}
+
+// recheckAllInvoiceBuyers recomputes the buyer checks of every user's invoices, each batch in its
+// own short transaction.
+func recheckAllInvoiceBuyers(db *gorm.DB) error {
+	for afterID := ""; ; {
+		var lastID string
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			lastID, err = recheckInvoiceBuyerBatch(tx, "", afterID)
+			return err
+		}); err != nil || lastID == "" {
+			return err
+		}
+		afterID = lastID
+	}
+}
+
+// recheckInvoiceBuyerBatch recomputes the buyer checks of the next batch of invoices after afterID
+// (of one user, or of all users when ownerUserID is ""), and returns the last ID it read, "" when
+// none was left. Only buyer_check and the buyer_mismatch warning are recomputed, and only invoices
+// whose result changed are written.
+func recheckInvoiceBuyerBatch(tx *gorm.DB, ownerUserID string, afterID string) (string, error) {
+	var rows []struct {
+		ID          string
+		OwnerUserID string
+		InvoiceType string
+		BuyerName   *string
+		BuyerTaxID  *string
+		BuyerCheck  string
+		Warnings    *string
+	}
+	q := tx.Table("invoices i").
+		Select(`i.id, i.owner_user_id, i.invoice_type, i.buyer_name, i.buyer_check, i.warnings,
+			CASE WHEN json_valid(COALESCE(b.extracted_data, i.extracted_data))
+				THEN json_extract(COALESCE(b.extracted_data, i.extracted_data), '$.buyer_tax_id') END AS buyer_tax_id`).
+		Joins("LEFT JOIN invoice_ocr_blobs b ON b.invoice_id = i.id").
+		Where("i.id > ?", afterID)
+	if ownerUserID != "" {
+		q = q.Where("i.owner_user_id = ?", ownerUserID)
+	}
+	if err := q.Order("i.id ASC").Limit(buyerRecheckBatchSize).Scan(&rows).Error; err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", nil
+	}
+
+	profilesByOwner := map[string][]models.BuyerProfile{}
+	for _, row := range rows {
+		profiles, ok := profilesByOwner[row.OwnerUserID]
+		if !ok {
+			var err error
+			if profiles, err = loadBuyerProfiles(tx, row.OwnerUserID); err != nil {
+				return "", err
+			}
+			profilesByOwner[row.OwnerUserID] = profiles
+		}
+
+		var warnings []models.InvoiceWarning
+		if row.Warnings != nil && strings.TrimSpace(*row.Warnings) != "" {
+			if err := json.Unmarshal([]byte(*row.Warnings), &warnings); err != nil {
+				return "", fmt.Errorf("invoice %s warnings: %w", row.ID, err)
+			}
+		}
+		var old *models.InvoiceWarning
+		kept := make([]models.InvoiceWarning, 0, len(warnings))
+		for i := range warnings {
+			if warnings[i].Code == InvoiceWarningBuyerMismatch {
+				old = &warnings[i]
+				continue
+			}
+			kept = append(kept, warnings[i])
+		}
+
+		check, warning := checkInvoiceBuyer(row.InvoiceType, strPtrVal(row.BuyerName), strPtrVal(row.BuyerTaxID), profiles)
+		if check == row.BuyerCheck && (old == nil) == (warning == nil) && (old == nil || *old == *warning) {
+			continue
+		}
+		if warning != nil {
+			kept = append(kept, *warning)
+		}
+		if err := tx.Model(&models.Invoice{}).
+			Where("owner_user_id = ? AND id = ?", row.OwnerUserID, row.ID).
+			Updates(map[string]interface{}{
+				"buyer_check":   check,
+				"warnings":      jsonColumnValue(kept),
+				"warning_count": len(kept),
+			}).Error; err != nil {
+			return "", err
+		}
+	}
+	return rows[len(rows)-1].ID, nil
+}
+
+// loadBuyerProfiles returns the profiles that apply to a user: their own, then the shared ones.
+func loadBuyerProfiles(db *gorm.DB, ownerUserID string) ([]models.BuyerProfile, error) {
+	var out []models.BuyerProfile
+	err := db.Where("owner_user_id IN ?", []string{strings.TrimSpace(ownerUserID), ""}).
+		Order("owner_user_id = '' ASC, name ASC").
+		Find(&out).Error
+	return out, err
+}
+
+var (
+	buyerTitleSpaceRe  = regexp.MustCompile(`\s+`)
+	personalBuyerRe    = regexp.MustCompile(`^\p{Han}{2,4}$`)
+	companyMarkerTexts = []string{"公司", "集团", "厂", "局", "院", "所", "中心", "部", "店", "行", "社", "会", "校"}
+)
+
+// normalizeBuyerTitle makes titles comparable: no whitespace, ASCII parentheses, upper case.
+func normalizeBuyerTitle(s string) string {
+	s = strings.NewReplacer("（", "(", "）", ")").Replace(strings.TrimSpace(s))
+	return strings.ToUpper(buyerTitleSpaceRe.ReplaceAllString(s, ""))
+}
+
+func normalizeBuyerTaxID(s string) string {
+	return strings.ToUpper(buyerTitleSpaceRe.ReplaceAllString(s, ""))
+}
+
+// matchBuyerProfile returns the profile whose name or an alias is the title, or nil.
+func matchBuyerProfile(title string, profiles []models.BuyerProfile) *models.BuyerProfile {
+	title = normalizeBuyerTitle(title)
+	if title == "" {
+		return nil
+	}
+	for i := range profiles {
+		if normalizeBuyerTitle(profiles[i].Name) == title {
+			return &profiles[i]
+		}
+		for _, alias := range profiles[i].Aliases {
+			if normalizeBuyerTitle(alias) == title {
+				return &profiles[i]
+			}
+		}
+	}
+	return nil
+}
+
+// isPersonalBuyer reports whether an invoice was issued to a person rather than a company: the
+// title is 个人, or a short personal name without a taxpayer number.
+func isPersonalBuyer(title, taxID string) bool {
+	title = normalizeBuyerTitle(title)
+	if title == "个人" || strings.Contains(title, "(个人)") {
+		return true
+	}
+	if taxID != "" || !personalBuyerRe.MatchString(title) {
+		return false
+	}
+	for _, marker := range companyMarkerTexts {
+		if strings.Contains(title, marker) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkInvoiceBuyer checks the buyer title and taxpayer number of an invoice against the buyer
+// profiles, returning the check result and, when it failed, the warning explaining why.
+func checkInvoiceBuyer(invoiceType, title, taxID string, profiles []models.BuyerProfile) (string, *models.InvoiceWarning) {
+	if len(profiles) == 0 {
+		return "", nil
+	}
+	title, taxID = strings.TrimSpace(title), normalizeBuyerTaxID(taxID)
+	// Taxi invoices and paper air itineraries print no buyer; the latter carry the passenger instead.
+	if invoiceType == InvoiceTypeTaxi || (invoiceType == InvoiceTypeAirItinerary && taxID == "") {
+		return "", nil
+	}
+	fail := func(check, field, format string, args ...any) (string, *models.InvoiceWarning) {
+		return check, &models.InvoiceWarning{Code: InvoiceWarningBuyerMismatch, Field: field, Message: fmt.Sprintf(format, args...)}
+	}
+	if title == "" && taxID == "" {
+		return fail(BuyerCheckWrongTitle, "buyer_name", "未识别到购买方名称，无法核对发票抬头")
+	}
+	// A profile match wins over the personal-name heuristic, which short company aliases also fit.
+	profile := matchBuyerProfile(title, profiles)
+	if profile == nil {
+		if isPersonalBuyer(title, taxID) {
+			return fail(BuyerCheckPersonal, "buyer_name", "发票开给个人（%s），不是公司抬头", title)
+		}
+		for i := range profiles {
+			if taxID != "" && profiles[i].TaxID == taxID {
+				return fail(BuyerCheckWrongTitle, "buyer_name", "购买方名称 %s 与纳税人识别号对应的抬头 %s 不符", title, profiles[i].Name)
+			}
+		}
+		return fail(BuyerCheckWrongTitle, "buyer_name", "购买方 %s 不在抬头档案中", title)
+	}
+	switch {
+	case profile.TaxID == "":
+	case taxID == "":
+		return fail(BuyerCheckMissingTaxID, "buyer_tax_id", "购买方 %s 缺少纳税人识别号，应为 %s", profile.Name, profile.TaxID)
+	case taxID != profile.TaxID:
+		return fail(BuyerCheckWrongTaxID, "buyer_tax_id", "购买方纳税人识别号 %s 与 %s 的 %s 不符", taxID, profile.Name, profile.TaxID)
+	}
+	return BuyerCheckOK, nil
+}
+
+// applyBuyerCheckTx sets the buyer check of inv against its owner's profiles and adds the warning
+// of a failed check.
+func applyBuyerCheckTx(tx *gorm.DB, inv *models.Invoice, extracted *InvoiceExtractedData) error {
+	profiles, err := loadBuyerProfiles(tx, inv.OwnerUserID)
+	if err != nil {
+		return err
+	}
+	taxID := ""
+	if extracted != nil {
+		taxID = strPtrVal(extracted.BuyerTaxID)
+	}
+	check, warning := checkInvoiceBuyer(inv.InvoiceType, strPtrVal(inv.BuyerName), taxID, profiles)
+	inv.BuyerCheck = check
+	if warning != nil {
+		inv.Warnings = append(inv.Warnings, *warning)
+		inv.WarningCount = len(inv.Warnings)
+	}
+	return nil
+}
+
+// pickBuyerFromProfiles replaces an extracted buyer that matches no profile with the best scored
+// buyer candidate that does, e.g. when OCR preferred a header line over the printed company title.
+// It reports whether the buyer changed.
+func pickBuyerFromProfiles(extracted *InvoiceExtractedData, profiles []models.BuyerProfile) bool {
+	if extracted == nil || extracted.Trace == nil || len(profiles) == 0 || matchBuyerProfile(strPtrVal(extracted.BuyerName), profiles) != nil {
+		return false
+	}
+	candidates := append([]ExtractionCandidate(nil), extracted.Trace.BuyerCandidates...)
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Score > candidates[j].Score })
+	for _, c := range candidates {
+		if c.RejectReason != "" || matchBuyerProfile(c.Value, profiles) == nil {
+			continue
+		}
+		v := strings.TrimSpace(c.Value)
+		extracted.BuyerName = &v
+		extracted.BuyerNameSource = "buyer_profile"
+		extracted.BuyerNameConfidence = c.Confidence
+		return true
+	}
+	return false
+}
+
+// pickBuyerFromProfilesJSON applies pickBuyerFromProfiles to a stored extraction result and returns
+// the buyer and the result to store.
+func (s *InvoiceService) pickBuyerFromProfilesJSON(ownerUserID string, buyerName, extractedData *string) (*string, *string) {
+	extracted := decodeInvoiceExtracted(extractedData)
+	if extracted == nil || extracted.Trace == nil {
+		return buyerName, extractedData
+	}
+	profiles, err := loadBuyerProfiles(s.db, ownerUserID)
+	if err != nil || !pickBuyerFromProfiles(extracted, profiles) {
+		return buyerName, extractedData
+	}
+	if jsonStr, err := ExtractedDataToJSON(extracted); err == nil {
+		extractedData = jsonStr
+	}
+	return extracted.BuyerName, extractedData
+}
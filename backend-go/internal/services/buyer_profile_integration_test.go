@@ -0,0 +1,97 @@
+//go:build cgo
+
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBuyerProfilesFlagInvoices(t *testing.T) {
+	db := openServiceTestDB(t)
+	invoices := NewInvoiceService(db, t.TempDir())
+	profiles := NewBuyerProfileService(db)
+
+	s := func(v string) *string { return &v }
+	create := func(owner, buyer, taxID string) string {
+		inv, err := invoices.CreateFromExtracted(owner, CreateInvoiceInput{
+			Filename:     buyer + ".pdf",
+			OriginalName: buyer + ".pdf",
+			FilePath:     "uploads/" + owner + "/" + buyer + ".pdf",
+			Source:       "upload",
+		}, InvoiceExtractedData{InvoiceType: InvoiceTypeDigital, BuyerName: s(buyer), BuyerTaxID: ptrString(taxID)})
+		if err != nil {
+			t.Fatalf("创建发票失败: %v", err)
+		}
+		return inv.ID
+	}
+	good := create("owner-1", "北京星河科技有限公司", "91350100M000100Y43")
+	wrong := create("owner-1", "北京星河技术有限公司", "91350100M000100Y43")
+	other := create("owner-2", "张三", "")
+
+	// Without profiles nothing is checked.
+	if inv, _ := invoices.GetByID("owner-1", wrong); inv.BuyerCheck != "" {
+		t.Fatalf("没有抬头档案时不应核对: %q", inv.BuyerCheck)
+	}
+
+	if _, err := profiles.Create("owner-1", false, BuyerProfileInput{Name: "公共抬头有限公司", Shared: true}); !errors.Is(err, ErrBuyerProfileForbidden) {
+		t.Fatalf("普通用户不能创建公共抬头: %v", err)
+	}
+	if _, err := profiles.Create("owner-1", false, BuyerProfileInput{Name: "北京星河科技有限公司", TaxID: "123"}); err == nil {
+		t.Fatalf("税号格式错误应被拒绝")
+	}
+	profile, err := profiles.Create("owner-1", false, BuyerProfileInput{Name: "北京星河科技有限公司", TaxID: "91350100m000100y43"})
+	if err != nil {
+		t.Fatalf("创建抬头档案失败: %v", err)
+	}
+
+	if inv, _ := invoices.GetByID("owner-1", good); inv.BuyerCheck != BuyerCheckOK {
+		t.Fatalf("抬头一致的发票应通过核对: %q %#v", inv.BuyerCheck, inv.Warnings)
+	}
+	inv, _ := invoices.GetByID("owner-1", wrong)
+	if inv.BuyerCheck != BuyerCheckWrongTitle || !hasInvoiceWarning(inv, InvoiceWarningBuyerMismatch) {
+		t.Fatalf("抬头错误的发票应被标记: %q %#v", inv.BuyerCheck, inv.Warnings)
+	}
+	if inv, _ := invoices.GetByID("owner-2", other); inv.BuyerCheck != "" {
+		t.Fatalf("其他用户的档案不应影响本用户: %q", inv.BuyerCheck)
+	}
+
+	items, total, err := invoices.List("owner-1", InvoiceFilterInput{BuyerCheck: BuyerCheckMismatch})
+	if err != nil || total != 1 || items[0].ID != wrong || items[0].BuyerCheck != BuyerCheckWrongTitle {
+		t.Fatalf("按抬头核对筛选异常: %v %d %#v", err, total, items)
+	}
+
+	// An alias accepts the other title.
+	if _, err := profiles.Update("owner-1", false, profile.ID, BuyerProfileInput{
+		Name: profile.Name, TaxID: profile.TaxID, Aliases: []string{"北京星河技术有限公司"},
+	}); err != nil {
+		t.Fatalf("更新抬头档案失败: %v", err)
+	}
+	if inv, _ := invoices.GetByID("owner-1", wrong); inv.BuyerCheck != BuyerCheckOK || hasInvoiceWarning(inv, InvoiceWarningBuyerMismatch) {
+		t.Fatalf("别名应通过核对: %q %#v", inv.BuyerCheck, inv.Warnings)
+	}
+
+	// A shared profile applies to every user and only admins may change it.
+	shared, err := profiles.Create("admin", true, BuyerProfileInput{Name: "上海总部有限公司", Shared: true})
+	if err != nil {
+		t.Fatalf("创建公共抬头失败: %v", err)
+	}
+	if inv, _ := invoices.GetByID("owner-2", other); inv.BuyerCheck != BuyerCheckPersonal {
+		t.Fatalf("公共抬头应核对所有用户的发票: %q", inv.BuyerCheck)
+	}
+	if list, err := profiles.List("owner-2"); err != nil || len(list) != 1 || !list[0].Shared {
+		t.Fatalf("用户应能看到公共抬头: %v %#v", err, list)
+	}
+	if err := profiles.Delete("owner-2", false, shared.ID); !errors.Is(err, ErrBuyerProfileForbidden) {
+		t.Fatalf("普通用户不能删除公共抬头: %v", err)
+	}
+	if err := profiles.Delete("owner-1", false, "missing"); !errors.Is(err, ErrBuyerProfileNotFound) {
+		t.Fatalf("删除不存在的档案应报错: %v", err)
+	}
+	if err := profiles.Delete("admin", true, shared.ID); err != nil {
+		t.Fatalf("删除公共抬头失败: %v", err)
+	}
+	if inv, _ := invoices.GetByID("owner-2", other); inv.BuyerCheck != "" {
+		t.Fatalf("删除公共抬头后不应再核对: %q", inv.BuyerCheck)
+	}
+}
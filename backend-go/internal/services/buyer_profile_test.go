@@ -0,0 +1,78 @@
+package services
+
+import (
+	"testing"
+
+	"smart-bill-manager/internal/models"
+)
+
+func testBuyerProfiles() []models.BuyerProfile {
+	profiles := []models.BuyerProfile{
+		{Name: "北京星河科技有限公司", TaxID: "91350100M000100Y43", AliasesRaw: "Beijing Xinghe Technology Co., Ltd.\n星河科技（北京）有限公司\n星河科技"},
+		{Name: "上海分公司", OwnerUserID: "owner-1"},
+	}
+	for i := range profiles {
+		_ = profiles[i].AfterFind(nil)
+	}
+	return profiles
+}
+
+func TestCheckInvoiceBuyer(t *testing.T) {
+	profiles := testBuyerProfiles()
+	cases := []struct {
+		name, invoiceType, title, taxID string
+		want                            string
+	}{
+		{"matching title and tax id", InvoiceTypeDigital, "北京星河科技有限公司", "91350100M000100Y43", BuyerCheckOK},
+		{"alias with half-width parens", InvoiceTypeDigital, "星河科技(北京)有限公司", "91350100m000100y43", BuyerCheckOK},
+		{"profile without tax id", InvoiceTypeVATOrdinary, "上海分公司", "", BuyerCheckOK},
+		{"other company", InvoiceTypeDigital, "北京月亮科技有限公司", "91110108MA01KX2P7A", BuyerCheckWrongTitle},
+		{"title typo with our tax id", InvoiceTypeDigital, "北京星河技术有限公司", "91350100M000100Y43", BuyerCheckWrongTitle},
+		{"tax id missing", InvoiceTypeDigital, "北京星河科技有限公司", "", BuyerCheckMissingTaxID},
+		{"tax id differs", InvoiceTypeDigital, "北京星河科技有限公司", "91110108MA01KX2P7A", BuyerCheckWrongTaxID},
+		{"short alias is not a personal name", InvoiceTypeDigital, "星河科技", "", BuyerCheckMissingTaxID},
+		{"personal marker", InvoiceTypeDigital, "个人", "", BuyerCheckPersonal},
+		{"personal name", InvoiceTypeVATOrdinary, "张三", "", BuyerCheckPersonal},
+		{"taxi invoices have no buyer", InvoiceTypeTaxi, "", "", ""},
+		{"paper itinerary carries the passenger", InvoiceTypeAirItinerary, "张三", "", ""},
+	}
+	for _, tc := range cases {
+		got, warning := checkInvoiceBuyer(tc.invoiceType, tc.title, tc.taxID, profiles)
+		if got != tc.want {
+			t.Fatalf("%s: expected %q, got %q (%+v)", tc.name, tc.want, got, warning)
+		}
+		if (warning != nil) != (got != "" && got != BuyerCheckOK) {
+			t.Fatalf("%s: unexpected warning %+v", tc.name, warning)
+		}
+		if warning != nil && warning.Code != InvoiceWarningBuyerMismatch {
+			t.Fatalf("%s: unexpected warning code %q", tc.name, warning.Code)
+		}
+	}
+
+	if got, _ := checkInvoiceBuyer(InvoiceTypeDigital, "张三", "", nil); got != "" {
+		t.Fatalf("invoices of users without profiles should not be checked, got %q", got)
+	}
+}
+
+func TestPickBuyerFromProfiles(t *testing.T) {
+	profiles := testBuyerProfiles()
+	buyer := "名称：北京月亮科技有限公司"
+	extracted := &InvoiceExtractedData{
+		BuyerName: &buyer,
+		Trace: &InvoiceExtractionTrace{BuyerCandidates: []ExtractionCandidate{
+			{Value: buyer, Source: "buyer_label", Score: 90, Confidence: 0.9},
+			{Value: "上海分公司", Source: "buyer_section", Score: 70, Confidence: 0.7, RejectReason: "lower_score"},
+			{Value: "北京星河科技有限公司", Source: "buyer_section", Score: 60, Confidence: 0.6},
+		}},
+	}
+	if !pickBuyerFromProfiles(extracted, profiles) {
+		t.Fatalf("expected the profile candidate to be picked")
+	}
+	if strPtrVal(extracted.BuyerName) != "北京星河科技有限公司" || extracted.BuyerNameSource != "buyer_profile" || extracted.BuyerNameConfidence != 0.6 {
+		t.Fatalf("unexpected buyer: %q %s %v", strPtrVal(extracted.BuyerName), extracted.BuyerNameSource, extracted.BuyerNameConfidence)
+	}
+	// A buyer that already matches a profile is kept.
+	if pickBuyerFromProfiles(extracted, profiles) {
+		t.Fatalf("a matching buyer should not be replaced")
+	}
+}
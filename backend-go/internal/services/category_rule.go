@@ -0,0 +1,504 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/money"
+	"smart-bill-manager/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	CategoryRuleMatchContains = "contains"
+	CategoryRuleMatchRegex    = "regex"
+)
+
+var ErrCategoryRuleNotFound = errors.New("category rule not found")
+
+type CategoryRuleService struct {
+	db *gorm.DB
+}
+
+func NewCategoryRuleService(db *gorm.DB) *CategoryRuleService {
+	return &CategoryRuleService{db: db}
+}
+
+type CategoryRuleInput struct {
+	Name            string   `json:"name" binding:"required"`
+	Priority        int      `json:"priority"`
+	Enabled         *bool    `json:"enabled"`
+	MerchantMatch   string   `json:"merchant_match"`
+	MerchantPattern string   `json:"merchant_pattern"`
+	PaymentMethod   string   `json:"payment_method"`
+	MinAmount       *float64 `json:"min_amount"`
+	MaxAmount       *float64 `json:"max_amount"`
+	Source          string   `json:"source"`
+	Category        string   `json:"category"`
+	BlockTrip       bool     `json:"block_trip"`
+}
+
+// applyTo validates the input and copies it onto rule, filling defaults.
+func (input CategoryRuleInput) applyTo(rule *models.CategoryRule) error {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	match := strings.ToLower(strings.TrimSpace(input.MerchantMatch))
+	if match == "" {
+		match = CategoryRuleMatchContains
+	}
+	pattern := strings.TrimSpace(input.MerchantPattern)
+	switch match {
+	case CategoryRuleMatchContains:
+	case CategoryRuleMatchRegex:
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid merchant_pattern: %w", err)
+		}
+	default:
+		return fmt.Errorf("invalid merchant_match")
+	}
+
+	source := strings.ToLower(strings.TrimSpace(input.Source))
+	switch source {
+	case "", PaymentPlatformWeChat, PaymentPlatformAlipay, PaymentPlatformJD, PaymentPlatformUnionPay:
+	default:
+		return fmt.Errorf("invalid source")
+	}
+
+	var minCents, maxCents *int64
+	if input.MinAmount != nil {
+		cents, err := money.FromMajor(*input.MinAmount)
+		if err != nil {
+			return fmt.Errorf("invalid min_amount: %w", err)
+		}
+		minCents = &cents
+	}
+	if input.MaxAmount != nil {
+		cents, err := money.FromMajor(*input.MaxAmount)
+		if err != nil {
+			return fmt.Errorf("invalid max_amount: %w", err)
+		}
+		maxCents = &cents
+	}
+	if minCents != nil && maxCents != nil && *minCents > *maxCents {
+		return fmt.Errorf("min_amount must not exceed max_amount")
+	}
+
+	paymentMethod := strings.TrimSpace(input.PaymentMethod)
+	if pattern == "" && paymentMethod == "" && minCents == nil && maxCents == nil && source == "" {
+		return fmt.Errorf("a rule needs at least one condition")
+	}
+	category := strings.TrimSpace(input.Category)
+	if category == "" && !input.BlockTrip {
+		return fmt.Errorf("a rule must set a category or block trip assignment")
+	}
+
+	enabled := true
+	if input.Enabled != nil {
+		enabled = *input.Enabled
+	}
+
+	rule.Name = name
+	rule.Priority = input.Priority
+	rule.Enabled = enabled
+	rule.MerchantMatch = match
+	rule.MerchantPattern = pattern
+	rule.PaymentMethod = paymentMethod
+	rule.MinAmountCents = minCents
+	rule.MaxAmountCents = maxCents
+	rule.Source = source
+	rule.Category = category
+	rule.BlockTrip = input.BlockTrip
+	return rule.AfterFind(nil)
+}
+
+func (s *CategoryRuleService) Create(ownerUserID string, input CategoryRuleInput) (*models.CategoryRule, error) {
+	rule := &models.CategoryRule{
+		ID:          utils.GenerateUUID(),
+		OwnerUserID: strings.TrimSpace(ownerUserID),
+	}
+	if err := input.applyTo(rule); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(rule).Error; err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// List returns the owner's rules in the order they run.
+func (s *CategoryRuleService) List(ownerUserID string) ([]models.CategoryRule, error) {
+	var out []models.CategoryRule
+	err := s.db.Where("owner_user_id = ?", strings.TrimSpace(ownerUserID)).
+		Order("priority ASC, created_at ASC").
+		Find(&out).Error
+	return out, err
+}
+
+func (s *CategoryRuleService) GetByID(ownerUserID string, id string) (*models.CategoryRule, error) {
+	return findCategoryRuleForOwner(s.db, ownerUserID, id)
+}
+
+func (s *CategoryRuleService) Update(ownerUserID string, id string, input CategoryRuleInput) (*models.CategoryRule, error) {
+	rule, err := findCategoryRuleForOwner(s.db, ownerUserID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := input.applyTo(rule); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(rule).Error; err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// Delete removes the rule only; categories it already set are kept.
+func (s *CategoryRuleService) Delete(ownerUserID string, id string) error {
+	res := s.db.Where("id = ? AND owner_user_id = ?", strings.TrimSpace(id), strings.TrimSpace(ownerUserID)).
+		Delete(&models.CategoryRule{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrCategoryRuleNotFound
+	}
+	return nil
+}
+
+// CategoryRuleChange is what re-applying the rules does (or would do) to one payment.
+type CategoryRuleChange struct {
+	PaymentID       string  `json:"payment_id"`
+	Merchant        *string `json:"merchant"`
+	Amount          float64 `json:"amount"`
+	TransactionTime string  `json:"transaction_time"`
+	OldCategory     *string `json:"old_category"`
+	NewCategory     *string `json:"new_category,omitempty"`
+	CategoryRuleID  string  `json:"category_rule_id,omitempty"`
+	Overwrite       bool    `json:"overwrite,omitempty"` // NewCategory replaces a category already set, possibly by hand
+	BlockTrip       bool    `json:"block_trip"`
+	BlockRuleID     string  `json:"block_rule_id,omitempty"`
+}
+
+// ReapplyToHistory runs the current rules over all confirmed payments. Like applyCategoryRules it
+// only fills empty categories unless overwrite is set; even then split payments keep theirs, as
+// the user categorized them part by part. Trip blocks only touch automatically assigned payments.
+// With dryRun nothing is written and the result is a preview.
+func (s *CategoryRuleService) ReapplyToHistory(ownerUserID string, dryRun bool, overwrite bool) ([]CategoryRuleChange, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	rules, err := loadCategoryRules(s.db, ownerUserID)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]CategoryRuleChange, 0)
+	if len(rules) == 0 {
+		return changes, nil
+	}
+
+	var payments []models.Payment
+	if err := s.db.Model(&models.Payment{}).
+		Where("owner_user_id = ? AND is_draft = 0", ownerUserID).
+		Order("transaction_time_ts DESC, id DESC").
+		Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	platforms, err := loadPaymentPlatforms(s.db, ownerUserID)
+	if err != nil {
+		return nil, err
+	}
+	var splitIDs []string
+	if err := s.db.Model(&models.PaymentSplit{}).
+		Where("owner_user_id = ?", ownerUserID).
+		Distinct("payment_id").
+		Pluck("payment_id", &splitIDs).Error; err != nil {
+		return nil, err
+	}
+	hasSplits := make(map[string]bool, len(splitIDs))
+	for _, id := range splitIDs {
+		hasSplits[id] = true
+	}
+
+	for _, p := range payments {
+		subject := categoryRuleSubject{
+			Merchant:      strPtrVal(p.Merchant),
+			PaymentMethod: strPtrVal(p.PaymentMethod),
+			AmountCents:   p.AmountCents,
+			Source:        paymentRuleSource(p.ImportSource, platforms[p.ID]),
+		}
+		outcome := rules.match(subject)
+		change := CategoryRuleChange{
+			PaymentID:       p.ID,
+			Merchant:        p.Merchant,
+			Amount:          p.Amount,
+			TransactionTime: p.TransactionTime,
+			OldCategory:     p.Category,
+		}
+		changed := false
+		current := strings.TrimSpace(strPtrVal(p.Category))
+		replaces := current != "" && current != outcome.Category
+		if outcome.Category != "" && current != outcome.Category && (!replaces || (overwrite && !hasSplits[p.ID])) {
+			category := outcome.Category
+			change.NewCategory = &category
+			change.CategoryRuleID = outcome.CategoryRuleID
+			change.Overwrite = replaces
+			changed = true
+		}
+		if outcome.BlockTrip && strings.TrimSpace(p.TripAssignSrc) == assignSrcAuto {
+			change.BlockTrip = true
+			change.BlockRuleID = outcome.BlockRuleID
+			changed = true
+		}
+		if changed {
+			changes = append(changes, change)
+		}
+	}
+	if dryRun || len(changes) == 0 {
+		return changes, nil
+	}
+
+	byID := make(map[string]*models.Payment, len(payments))
+	for i := range payments {
+		byID[payments[i].ID] = &payments[i]
+	}
+	affectedTrips := make([]string, 0)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		blocked := make([]string, 0)
+		for _, c := range changes {
+			updates := map[string]interface{}{}
+			if c.NewCategory != nil {
+				updates["category"] = *c.NewCategory
+			}
+			if c.BlockTrip {
+				updates["trip_id"] = nil
+				updates["trip_assignment_source"] = assignSrcBlocked
+				updates["trip_assignment_state"] = assignStateBlocked
+				blocked = append(blocked, c.PaymentID)
+				if p := byID[c.PaymentID]; p.BadDebt && p.TripID != nil {
+					affectedTrips = append(affectedTrips, *p.TripID)
+				}
+			}
+			if err := tx.Model(&models.Payment{}).
+				Where("id = ? AND owner_user_id = ?", c.PaymentID, ownerUserID).
+				Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if len(blocked) == 0 {
+			return nil
+		}
+		return syncAutoSplitTripsTx(tx, ownerUserID, blocked)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := recalcTripBadDebtLockedForTripIDs(s.db, affectedTrips); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func findCategoryRuleForOwner(db *gorm.DB, ownerUserID string, id string) (*models.CategoryRule, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, ErrCategoryRuleNotFound
+	}
+	var rule models.CategoryRule
+	if err := db.Where("id = ? AND owner_user_id = ?", id, ownerUserID).First(&rule).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCategoryRuleNotFound
+		}
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// categoryRuleSubject is the part of a payment that rules look at.
+type categoryRuleSubject struct {
+	Merchant      string
+	PaymentMethod string
+	AmountCents   int64
+	Source        string
+}
+
+type categoryRuleOutcome struct {
+	Category       string
+	CategoryRuleID string
+	BlockTrip      bool
+	BlockRuleID    string
+}
+
+type compiledCategoryRule struct {
+	rule    models.CategoryRule
+	pattern *regexp.Regexp
+}
+
+type categoryRuleSet []compiledCategoryRule
+
+// loadCategoryRules returns the owner's enabled rules in priority order. Rules whose regex no
+// longer compiles are skipped.
+func loadCategoryRules(db *gorm.DB, ownerUserID string) (categoryRuleSet, error) {
+	var rules []models.CategoryRule
+	if err := db.Where("owner_user_id = ? AND enabled = ?", strings.TrimSpace(ownerUserID), true).
+		Order("priority ASC, created_at ASC").
+		Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	out := make(categoryRuleSet, 0, len(rules))
+	for _, r := range rules {
+		c := compiledCategoryRule{rule: r}
+		if r.MerchantMatch == CategoryRuleMatchRegex && r.MerchantPattern != "" {
+			re, err := regexp.Compile(r.MerchantPattern)
+			if err != nil {
+				continue
+			}
+			c.pattern = re
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func (c compiledCategoryRule) matches(subject categoryRuleSubject) bool {
+	r := c.rule
+	if r.MerchantPattern != "" {
+		if c.pattern != nil {
+			if !c.pattern.MatchString(subject.Merchant) {
+				return false
+			}
+		} else if !strings.Contains(strings.ToLower(subject.Merchant), strings.ToLower(r.MerchantPattern)) {
+			return false
+		}
+	}
+	if r.PaymentMethod != "" && !strings.Contains(strings.ToLower(subject.PaymentMethod), strings.ToLower(r.PaymentMethod)) {
+		return false
+	}
+	if r.MinAmountCents != nil && subject.AmountCents < *r.MinAmountCents {
+		return false
+	}
+	if r.MaxAmountCents != nil && subject.AmountCents > *r.MaxAmountCents {
+		return false
+	}
+	if r.Source != "" && r.Source != subject.Source {
+		return false
+	}
+	return true
+}
+
+// match runs the rules in order: the first matching rule with a category decides it, and the
+// first matching rule with BlockTrip blocks trip assignment.
+func (rules categoryRuleSet) match(subject categoryRuleSubject) categoryRuleOutcome {
+	var out categoryRuleOutcome
+	for _, c := range rules {
+		if (out.Category != "" || c.rule.Category == "") && (out.BlockTrip || !c.rule.BlockTrip) {
+			continue
+		}
+		if !c.matches(subject) {
+			continue
+		}
+		if out.Category == "" && c.rule.Category != "" {
+			out.Category = c.rule.Category
+			out.CategoryRuleID = c.rule.ID
+		}
+		if !out.BlockTrip && c.rule.BlockTrip {
+			out.BlockTrip = true
+			out.BlockRuleID = c.rule.ID
+		}
+	}
+	return out
+}
+
+// paymentRuleSource maps a payment to the source rules match on: the bill export it was
+// imported from, otherwise the platform recognized on its screenshot.
+func paymentRuleSource(importSource *string, platform string) string {
+	switch strPtrVal(importSource) {
+	case BillCSVSourceWeChat:
+		return PaymentPlatformWeChat
+	case BillCSVSourceAlipay:
+		return PaymentPlatformAlipay
+	case "":
+		return platform
+	}
+	return ""
+}
+
+// loadPaymentPlatforms reads the recognized platform of every payment with OCR data. Older
+// OCR results without a platform are classified from their raw text.
+func loadPaymentPlatforms(db *gorm.DB, ownerUserID string) (map[string]string, error) {
+	var blobs []models.PaymentOCRBlob
+	if err := db.Select("payment_id, extracted_data").
+		Where("owner_user_id = ?", strings.TrimSpace(ownerUserID)).
+		Find(&blobs).Error; err != nil {
+		return nil, err
+	}
+	ocr := NewOCRService()
+	out := make(map[string]string, len(blobs))
+	for _, b := range blobs {
+		if b.ExtractedData == nil {
+			continue
+		}
+		var data PaymentExtractedData
+		if err := json.Unmarshal([]byte(*b.ExtractedData), &data); err != nil {
+			continue
+		}
+		platform := data.Platform
+		if platform == "" && data.RawText != "" {
+			platform = ocr.detectPaymentPlatform(normalizePaymentScreenshotText(data.RawText))
+		}
+		out[b.PaymentID] = platform
+	}
+	return out, nil
+}
+
+// applyCategoryRules fills in a category the user did not choose and blocks trip assignment
+// when a rule asks for it. It reports whether anything changed.
+func applyCategoryRules(db *gorm.DB, ownerUserID string, payment *models.Payment, platform string) (bool, error) {
+	rules, err := loadCategoryRules(db, ownerUserID)
+	if err != nil || len(rules) == 0 {
+		return false, err
+	}
+	cents := payment.AmountCents
+	if cents == 0 {
+		if cents, err = money.FromMajor(payment.Amount); err != nil {
+			return false, err
+		}
+	}
+	outcome := rules.match(categoryRuleSubject{
+		Merchant:      strPtrVal(payment.Merchant),
+		PaymentMethod: strPtrVal(payment.PaymentMethod),
+		AmountCents:   cents,
+		Source:        paymentRuleSource(payment.ImportSource, platform),
+	})
+	changed := false
+	if outcome.Category != "" && strings.TrimSpace(strPtrVal(payment.Category)) == "" {
+		category := outcome.Category
+		payment.Category = &category
+		changed = true
+	}
+	if outcome.BlockTrip && strings.TrimSpace(payment.TripAssignSrc) == assignSrcAuto {
+		payment.TripID = nil
+		payment.TripAssignSrc = assignSrcBlocked
+		payment.TripAssignState = assignStateBlocked
+		changed = true
+	}
+	return changed, nil
+}
+
+// extractedPlatform reads the recognized platform from stored OCR JSON, or "".
+func extractedPlatform(extractedJSON *string) string {
+	if extractedJSON == nil {
+		return ""
+	}
+	var data PaymentExtractedData
+	if err := json.Unmarshal([]byte(*extractedJSON), &data); err != nil {
+		return ""
+	}
+	return data.Platform
+}
@@ -0,0 +1,170 @@
+//go:build cgo
+
+package services
+
+import (
+	"testing"
+)
+
+func TestCategoryRulesApplyOnCreateAndReapply(t *testing.T) {
+	db := openServiceTestDB(t)
+	payments := NewPaymentService(db, t.TempDir())
+	rules := NewCategoryRuleService(db)
+	trips := NewTripService(db, t.TempDir())
+
+	trip, _, err := trips.Create("owner-1", CreateTripInput{
+		Name:      "深圳出差",
+		StartTime: "2025-12-01T00:00:00+08:00",
+		EndTime:   "2025-12-03T00:00:00+08:00",
+	})
+	if err != nil {
+		t.Fatalf("创建行程失败: %v", err)
+	}
+
+	maxAmount := 50.0
+	if _, err := rules.Create("owner-1", CategoryRuleInput{
+		Name:            "咖啡",
+		Priority:        10,
+		MerchantMatch:   CategoryRuleMatchRegex,
+		MerchantPattern: `瑞幸|星巴克`,
+		MaxAmount:       &maxAmount,
+		Category:        "餐饮",
+	}); err != nil {
+		t.Fatalf("创建规则失败: %v", err)
+	}
+	if _, err := rules.Create("owner-1", CategoryRuleInput{
+		Name:     "微信账单",
+		Priority: 20,
+		Source:   PaymentPlatformWeChat,
+		Category: "日常",
+	}); err != nil {
+		t.Fatalf("创建规则失败: %v", err)
+	}
+	if _, err := rules.Create("owner-1", CategoryRuleInput{
+		Name:            "房租不计入行程",
+		Priority:        5,
+		MerchantPattern: "房租",
+		Category:        "住房",
+		BlockTrip:       true,
+	}); err != nil {
+		t.Fatalf("创建规则失败: %v", err)
+	}
+	if _, err := rules.Create("owner-1", CategoryRuleInput{Name: "空规则", Category: "其他"}); err == nil {
+		t.Fatalf("没有条件的规则应被拒绝")
+	}
+
+	coffee := "瑞幸咖啡"
+	got, err := payments.Create("owner-1", CreatePaymentInput{Amount: 18, Merchant: &coffee, TransactionTime: "2025-11-20T02:00:00Z"})
+	if err != nil {
+		t.Fatalf("创建支付失败: %v", err)
+	}
+	if got.Category == nil || *got.Category != "餐饮" {
+		t.Fatalf("咖啡规则应设置分类: %#v", got.Category)
+	}
+
+	// A category chosen by the user is kept.
+	chosen := "招待"
+	got, err = payments.Create("owner-1", CreatePaymentInput{Amount: 20, Merchant: &coffee, Category: &chosen, TransactionTime: "2025-11-21T02:00:00Z"})
+	if err != nil {
+		t.Fatalf("创建支付失败: %v", err)
+	}
+	if got.Category == nil || *got.Category != chosen {
+		t.Fatalf("手动分类不应被规则覆盖: %#v", got.Category)
+	}
+
+	rent := "十二月房租"
+	got, err = payments.Create("owner-1", CreatePaymentInput{Amount: 3000, Merchant: &rent, TransactionTime: "2025-12-01T02:00:00Z"})
+	if err != nil {
+		t.Fatalf("创建支付失败: %v", err)
+	}
+	if got, err = payments.GetByID("owner-1", got.ID); err != nil {
+		t.Fatalf("读取支付失败: %v", err)
+	}
+	if got.TripID != nil || got.TripAssignSrc != assignSrcBlocked || got.Category == nil || *got.Category != "住房" {
+		t.Fatalf("房租规则应设置分类并阻止归入行程 %s: %#v", trip.ID, got)
+	}
+
+	// Payments created before a rule existed show up in the preview and change only on apply.
+	source, externalID := BillCSVSourceWeChat, "wx-001"
+	shop := "便利店"
+	imported, err := payments.Create("owner-1", CreatePaymentInput{
+		Amount:          9,
+		Merchant:        &shop,
+		TransactionTime: "2025-11-22T02:00:00Z",
+		ImportSource:    &source,
+		ExternalID:      &externalID,
+	})
+	if err != nil {
+		t.Fatalf("创建支付失败: %v", err)
+	}
+	if imported.Category == nil || *imported.Category != "日常" {
+		t.Fatalf("微信来源规则应设置分类: %#v", imported.Category)
+	}
+	if _, err := rules.Create("owner-1", CategoryRuleInput{
+		Name:            "便利店",
+		Priority:        1,
+		MerchantPattern: "便利店",
+		Category:        "日用品",
+	}); err != nil {
+		t.Fatalf("创建规则失败: %v", err)
+	}
+
+	// A split payment keeps its category even when overwriting; an uncategorized one is filled.
+	split, err := payments.Create("owner-1", CreatePaymentInput{Amount: 12, Merchant: &shop, Category: &chosen, TransactionTime: "2025-11-23T02:00:00Z"})
+	if err != nil {
+		t.Fatalf("创建支付失败: %v", err)
+	}
+	splitShop := split.ID
+	if _, err := payments.SetSplits("owner-1", splitShop, []PaymentSplitInput{{Amount: 5, Category: &chosen}, {Amount: 7}}); err != nil {
+		t.Fatalf("拆分支付失败: %v", err)
+	}
+	blank, err := payments.Create("owner-1", CreatePaymentInput{Amount: 3, Merchant: &shop, TransactionTime: "2025-11-24T02:00:00Z"})
+	if err != nil {
+		t.Fatalf("创建支付失败: %v", err)
+	}
+	if err := db.Table("payments").Where("id = ?", blank.ID).Update("category", nil).Error; err != nil {
+		t.Fatalf("清除分类失败: %v", err)
+	}
+
+	// Without overwrite only the empty category is filled; manual categories stay.
+	preview, err := rules.ReapplyToHistory("owner-1", true, false)
+	if err != nil {
+		t.Fatalf("预览规则失败: %v", err)
+	}
+	if len(preview) != 1 || preview[0].PaymentID != blank.ID || preview[0].Overwrite || preview[0].NewCategory == nil || *preview[0].NewCategory != "日用品" {
+		t.Fatalf("默认只应补全空分类: %#v", preview)
+	}
+
+	preview, err = rules.ReapplyToHistory("owner-1", true, true)
+	if err != nil {
+		t.Fatalf("预览规则失败: %v", err)
+	}
+	byPayment := make(map[string]CategoryRuleChange, len(preview))
+	for _, c := range preview {
+		byPayment[c.PaymentID] = c
+	}
+	change, ok := byPayment[imported.ID]
+	if !ok || change.NewCategory == nil || *change.NewCategory != "日用品" || change.OldCategory == nil || *change.OldCategory != "日常" || !change.Overwrite {
+		t.Fatalf("预览应包含并标记覆盖的便利店分类变更: %#v", preview)
+	}
+	if _, ok := byPayment[splitShop]; ok {
+		t.Fatalf("拆分支付的分类不应被覆盖: %#v", preview)
+	}
+	if got, _ := payments.GetByID("owner-1", imported.ID); got.Category == nil || *got.Category != "日常" {
+		t.Fatalf("预览不应修改数据: %#v", got.Category)
+	}
+
+	applied, err := rules.ReapplyToHistory("owner-1", false, true)
+	if err != nil || len(applied) != len(preview) {
+		t.Fatalf("应用规则失败: %d/%d %v", len(applied), len(preview), err)
+	}
+	if got, _ := payments.GetByID("owner-1", imported.ID); got.Category == nil || *got.Category != "日用品" {
+		t.Fatalf("应用后分类应更新: %#v", got.Category)
+	}
+	if got, _ := payments.GetByID("owner-1", splitShop); got.Category == nil || *got.Category != chosen {
+		t.Fatalf("拆分支付的分类应保留: %#v", got.Category)
+	}
+	if again, err := rules.ReapplyToHistory("owner-1", true, true); err != nil || len(again) != 0 {
+		t.Fatalf("再次预览应无变更: %#v %v", again, err)
+	}
+}
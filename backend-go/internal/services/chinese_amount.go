@@ -0,0 +1,192 @@
+package services
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"smart-bill-manager/internal/money"
+)
+
+// uppercaseAmountSource marks amount candidates read from the Chinese uppercase total (大写金额).
+const uppercaseAmountSource = "chinese_uppercase"
+
+var (
+	cnUpperDigits = map[rune]int64{
+		'零': 0, '〇': 0, '壹': 1, '贰': 2, '貳': 2, '叁': 3, '參': 3, '肆': 4,
+		'伍': 5, '陆': 6, '陸': 6, '柒': 7, '捌': 8, '玖': 9,
+	}
+	cnUpperUnits = map[rune]int64{'拾': 10, '佰': 100, '仟': 1000}
+
+	cnUpperRun = `[零〇壹贰貳叁參肆伍陆陸柒捌玖拾佰仟万萬亿億圆元角分整正\s]`
+	// The uppercase total follows the （大写） label, sometimes after "合计" or an ⓧ mark.
+	uppercaseAmountLabelRe = regexp.MustCompile(`大[写寫][)）]?[^零〇壹贰貳叁參肆伍陆陸柒捌玖拾\n]{0,8}?(` + cnUpperRun + `{2,40})`)
+	uppercaseAmountRe      = regexp.MustCompile(`[零〇壹贰貳叁參肆伍陆陸柒捌玖拾佰仟万萬亿億]+[圆元][零〇壹贰貳叁參肆伍陆陸柒捌玖角分整正]*`)
+)
+
+// parseChineseUppercaseAmount converts an uppercase amount such as 壹佰贰拾叁圆肆角伍分 to cents.
+// It only succeeds when every character is part of a well-formed amount, so a misread character
+// makes it fail rather than give a wrong value.
+func parseChineseUppercaseAmount(s string) (int64, bool) {
+	s = strings.Join(strings.Fields(s), "")
+	s = strings.TrimRight(s, "整正")
+	if s == "" {
+		return 0, false
+	}
+	var yuanPart, fracPart string
+	if i := strings.IndexAny(s, "圆元"); i >= 0 {
+		yuanPart, fracPart = s[:i], s[i+len("圆"):]
+	} else if strings.ContainsAny(s, "角分") {
+		fracPart = s
+	} else {
+		return 0, false
+	}
+
+	yuan, ok := parseChineseUppercaseInteger(yuanPart)
+	if !ok {
+		return 0, false
+	}
+	frac, ok := parseChineseUppercaseFraction(fracPart)
+	if !ok {
+		return 0, false
+	}
+	cents := yuan*100 + frac
+	return cents, cents > 0
+}
+
+// parseChineseUppercaseInteger parses the part before 圆, e.g. 壹万零叁佰.
+func parseChineseUppercaseInteger(s string) (int64, bool) {
+	var total, section int64
+	pending := int64(-1)
+	lastUnit := int64(10000)
+	lastBig := int64(0)
+	for _, r := range s {
+		if d, ok := cnUpperDigits[r]; ok {
+			if d == 0 {
+				if pending != -1 {
+					return 0, false
+				}
+				continue
+			}
+			if pending != -1 {
+				return 0, false
+			}
+			pending = d
+			continue
+		}
+		if u, ok := cnUpperUnits[r]; ok {
+			if pending == -1 {
+				// 拾 may open an amount on its own: 拾伍圆 is 15.
+				if u != 10 || total != 0 || section != 0 {
+					return 0, false
+				}
+				pending = 1
+			}
+			if u >= lastUnit {
+				return 0, false
+			}
+			section += pending * u
+			pending, lastUnit = -1, u
+			continue
+		}
+		var big int64
+		switch r {
+		case '万', '萬':
+			big = 10000
+		case '亿', '億':
+			big = 100000000
+		default:
+			return 0, false
+		}
+		if pending != -1 {
+			section += pending
+		}
+		if (section == 0 && total == 0) || (lastBig != 0 && big >= lastBig) {
+			return 0, false
+		}
+		if big == 100000000 {
+			total = (total + section) * big
+		} else {
+			total += section * big
+		}
+		section, pending, lastUnit, lastBig = 0, -1, 10000, big
+	}
+	if pending != -1 {
+		section += pending
+	}
+	return total + section, true
+}
+
+// parseChineseUppercaseFraction parses the part after 圆: [零][n角][零][n分].
+func parseChineseUppercaseFraction(s string) (int64, bool) {
+	var cents int64
+	pending := int64(-1)
+	seen := ""
+	for _, r := range s {
+		if d, ok := cnUpperDigits[r]; ok {
+			if d == 0 {
+				if pending != -1 {
+					return 0, false
+				}
+				continue
+			}
+			if pending != -1 {
+				return 0, false
+			}
+			pending = d
+			continue
+		}
+		if pending == -1 || strings.ContainsRune(seen, r) {
+			return 0, false
+		}
+		switch {
+		case r == '角' && seen == "":
+			cents += pending * 10
+		case r == '分':
+			cents += pending
+		default:
+			return 0, false
+		}
+		seen += string(r)
+		pending = -1
+	}
+	return cents, pending == -1
+}
+
+// extractUppercaseAmountCandidate finds the uppercase total of an invoice, preferring the one next
+// to its （大写） label. A run followed by other Chinese characters is garbled (壹拾玖圆不角扌分)
+// and skipped, since its readable prefix would parse to a wrong amount.
+func extractUppercaseAmountCandidate(text string) (MoneyCandidate, bool) {
+	var runs [][]int
+	for _, m := range uppercaseAmountLabelRe.FindAllStringSubmatchIndex(text, -1) {
+		runs = append(runs, []int{m[0], m[2], m[3]})
+	}
+	for _, m := range uppercaseAmountRe.FindAllStringIndex(text, -1) {
+		runs = append(runs, []int{m[0], m[0], m[1]})
+	}
+	for _, run := range runs {
+		if next, _ := utf8.DecodeRuneInString(text[run[2]:]); unicode.Is(unicode.Han, next) {
+			continue
+		}
+		if cents, ok := parseChineseUppercaseAmount(text[run[1]:run[2]]); ok {
+			return MoneyCandidate{
+				Value:      money.ToMajor(cents),
+				Source:     uppercaseAmountSource,
+				Confidence: 0.9,
+				Evidence:   truncateForEvidence(strings.TrimSpace(text[run[0]:run[2]]), 140),
+			}, true
+		}
+	}
+	return MoneyCandidate{}, false
+}
+
+// crossCheckUppercaseAmount scores a total candidate against the uppercase total, which survives
+// digit-level OCR errors: candidates agreeing with it win and the others are rejected.
+func crossCheckUppercaseAmount(value float64, score int, upper MoneyCandidate) (int, string) {
+	if math.Abs(value-upper.Value) < 0.005 {
+		return score + 500, ""
+	}
+	return 0, "disagrees_with_uppercase"
+}
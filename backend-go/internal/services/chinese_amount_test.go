@@ -0,0 +1,96 @@
+package services
+
+import "testing"
+
+func TestParseChineseUppercaseAmount(t *testing.T) {
+	valid := map[string]int64{
+		"壹佰贰拾叁圆肆角伍分":   12345,
+		"壹拾玖圆伍角捌分":     1958,
+		"捌拾捌圆整":        8800,
+		"叁仟零捌拾圆整":      308000,
+		"拾伍元正":         1500,
+		"壹万零叁佰圆零伍分":    1030005,
+		"贰亿零伍万圆整":      20005000000,
+		"伍角":           50,
+		"壹 佰 元 整":      10000,
+		"肆仟伍佰圆整":       450000,
+		"壹仟柒佰圆整":       170000,
+		"陆圆零捌分":        608,
+		"玖拾玖万玖仟玖佰玖拾玖圆": 99999900,
+	}
+	for s, want := range valid {
+		if got, ok := parseChineseUppercaseAmount(s); !ok || got != want {
+			t.Fatalf("%s: got %d %v, want %d", s, got, ok, want)
+		}
+	}
+	invalid := []string{"", "整", "圆整", "壹贰圆", "佰圆", "壹佰壹仟圆", "壹圆分", "壹圆伍分伍角", "壹圆伍", "壹拾玖圆不角扌分", "壹佰贰拾"}
+	for _, s := range invalid {
+		if got, ok := parseChineseUppercaseAmount(s); ok {
+			t.Fatalf("%s: expected failure, got %d", s, got)
+		}
+	}
+}
+
+func TestExtractUppercaseAmountCandidate(t *testing.T) {
+	c, ok := extractUppercaseAmountCandidate("价税合计（大写） 合计捌拾捌圆整 （小写） 83.01 88.00 4.99")
+	if !ok || c.Value != 88 || c.Source != uppercaseAmountSource {
+		t.Fatalf("unexpected candidate: %+v %v", c, ok)
+	}
+	// A garbled run must not yield its readable prefix.
+	if c, ok := extractUppercaseAmountCandidate("499098504973\n壹拾玖圆不角扌分\n￥19.58"); ok {
+		t.Fatalf("garbled amount should be skipped: %+v", c)
+	}
+}
+
+func TestParseInvoiceData_UppercaseAmount(t *testing.T) {
+	invoice := func(uppercase, total string) string {
+		return "电子发票（普通发票）\n发票号码：25117000000123456789\n开票日期：2025年10月09日\n" +
+			"购买方信息 名称：北京星河科技有限公司\n统一社会信用代码/纳税人识别号：91110108735575307R\n" +
+			"销售方信息 名称：上海某某餐饮有限公司\n统一社会信用代码/纳税人识别号：91310000132200821H\n" +
+			"价税合计（大写）" + uppercase + "（小写）¥" + total + "\n"
+	}
+
+	data, err := NewOCRService().ParseInvoiceData(invoice("壹佰贰拾叁圆肆角伍分", "123.45"))
+	if err != nil {
+		t.Fatalf("parse invoice: %v", err)
+	}
+	if valueOrZero(data.Amount) != 123.45 || data.AmountSource == uppercaseAmountSource || data.AmountConfidence < 0.98 {
+		t.Fatalf("agreeing totals should keep the numeric source with higher confidence: %v %s %v",
+			valueOrZero(data.Amount), data.AmountSource, data.AmountConfidence)
+	}
+	found := false
+	for _, c := range data.Trace.AmountCandidates {
+		found = found || (c.Source == uppercaseAmountSource && c.Value == 123.45)
+	}
+	if !found {
+		t.Fatalf("trace should carry the uppercase candidate: %+v", data.Trace.AmountCandidates)
+	}
+
+	// An agreeing reading raises the confidence also when the uppercase candidate wins the scoring.
+	text := "电子发票（普通发票）\n发票号码：25117000000123456789\n价税合计（大写）壹佰贰拾叁圆肆角伍分\n¥123.45\n"
+	data, err = NewOCRService().ParseInvoiceData(text)
+	if err != nil {
+		t.Fatalf("parse invoice: %v", err)
+	}
+	if valueOrZero(data.Amount) != 123.45 || data.AmountSource != uppercaseAmountSource || data.AmountConfidence < 0.98 {
+		t.Fatalf("agreeing totals should raise the confidence: %v %s %v",
+			valueOrZero(data.Amount), data.AmountSource, data.AmountConfidence)
+	}
+
+	// A misread digit in the numeric total gives way to the uppercase amount.
+	data, err = NewOCRService().ParseInvoiceData(invoice("壹佰贰拾叁圆肆角伍分", "128.45"))
+	if err != nil {
+		t.Fatalf("parse invoice: %v", err)
+	}
+	if valueOrZero(data.Amount) != 123.45 || data.AmountSource != uppercaseAmountSource {
+		t.Fatalf("uppercase amount should override: %v %s", valueOrZero(data.Amount), data.AmountSource)
+	}
+	for _, c := range data.Trace.AmountCandidates {
+		if c.Value == 128.45 && c.RejectReason != "disagrees_with_uppercase" {
+			t.Fatalf("numeric total should be rejected: %+v", c)
+		}
+	}
+	if data.AmountConfidence >= 0.98 {
+		t.Fatalf("a lone uppercase reading should not get the agreement confidence: %v", data.AmountConfidence)
+	}
+}
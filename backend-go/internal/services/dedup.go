@@ -21,13 +21,14 @@ type DedupCandidate struct {
 	InvoiceNumber   *string   `json:"invoice_number,omitempty"`
 	InvoiceDate     *string   `json:"invoice_date,omitempty"`
 	SellerName      *string   `json:"seller_name,omitempty"`
+	Similarity      *float64  `json:"similarity,omitempty"` // perceptual_hash only: 1 = identical image hash
 	CreatedAt       time.Time `json:"created_at"`
 }
 
 type DuplicateError struct {
 	// Kind: "hash_duplicate" | "suspected_duplicate"
 	Kind string `json:"kind"`
-	// Reason: "file_sha256" | "amount_time" | "invoice_number"
+	// Reason: "file_sha256" | "amount_time" | "invoice_number" | "perceptual_hash"
 	Reason string `json:"reason"`
 	// Entity: "payment" | "invoice"
 	Entity string `json:"entity"`
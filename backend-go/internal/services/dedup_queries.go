@@ -2,6 +2,7 @@ package services
 
 import (
 	"math"
+	"sort"
 	"strings"
 	"time"
 
@@ -73,17 +74,88 @@ func findInvoiceByFileSHA256ForOwner(db *gorm.DB, ownerUserID string, hash strin
 	return &inv, nil
 }
 
-func (s *PaymentService) FindCandidatesByAmountTimeForOwner(ownerUserID string, amount float64, transactionTimeTs int64, excludeID string, window time.Duration, limit int) ([]DedupCandidate, error) {
-	return findPaymentCandidatesByAmountTimeForOwner(s.db, ownerUserID, amount, transactionTimeTs, excludeID, window, limit)
+func (s *PaymentService) FindByExternalIDForOwner(ownerUserID string, importSource string, externalID string) (*models.Payment, error) {
+	return findPaymentByExternalIDForOwner(s.db, ownerUserID, importSource, externalID)
 }
 
-func findPaymentCandidatesByAmountTimeForOwner(db *gorm.DB, ownerUserID string, amount float64, transactionTimeTs int64, excludeID string, window time.Duration, limit int) ([]DedupCandidate, error) {
+// findPaymentByExternalIDForOwner looks up a payment previously imported from the same source
+// with the same bank/vendor transaction ID. Drafts are included: the ID is unique per source.
+func findPaymentByExternalIDForOwner(db *gorm.DB, ownerUserID string, importSource string, externalID string) (*models.Payment, error) {
 	ownerUserID = strings.TrimSpace(ownerUserID)
-	if amount <= 0 || transactionTimeTs <= 0 {
+	importSource = strings.TrimSpace(importSource)
+	externalID = strings.TrimSpace(externalID)
+	if importSource == "" || externalID == "" {
 		return nil, nil
 	}
-	if limit <= 0 {
-		limit = 5
+
+	var p models.Payment
+	res := db.Model(&models.Payment{}).
+		Where("owner_user_id = ? AND import_source = ? AND external_id = ?", ownerUserID, importSource, externalID).
+		Limit(1).
+		Find(&p)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+func (s *PaymentService) FindCandidatesByAmountTimeForOwner(ownerUserID string, amount float64, currency string, transactionTimeTs int64, excludeID string, window time.Duration, limit int) ([]DedupCandidate, error) {
+	return findPaymentCandidatesByAmountTimeForOwner(s.db, ownerUserID, amount, currency, transactionTimeTs, excludeID, window, limit)
+}
+
+func findPaymentCandidatesByAmountTimeForOwner(db *gorm.DB, ownerUserID string, amount float64, currency string, transactionTimeTs int64, excludeID string, window time.Duration, limit int) ([]DedupCandidate, error) {
+	if transactionTimeTs <= 0 {
+		return nil, nil
+	}
+	deltaMs := int64(window / time.Millisecond)
+	return findPaymentCandidatesByAmountRangeForOwner(db, ownerUserID, amount, currency, transactionTimeTs-deltaMs, transactionTimeTs+deltaMs, excludeID, limit)
+}
+
+// findPaymentCandidatesByAmountRangeForOwner finds confirmed payments of the same amount and currency
+// whose transaction time lies in [startTs, endTs] (unix millis).
+func findPaymentCandidatesByAmountRangeForOwner(db *gorm.DB, ownerUserID string, amount float64, currency string, startTs int64, endTs int64, excludeID string, limit int) ([]DedupCandidate, error) {
+	q, err := paymentAmountRangeQuery(db, ownerUserID, amount, currency, startTs, endTs)
+	if q == nil || err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(excludeID) != "" {
+		q = excludeDismissedDuplicates(q.Where("id <> ?", strings.TrimSpace(excludeID)), DedupEntityPayment, excludeID)
+	}
+	return findPaymentAmountCandidates(q, limit)
+}
+
+func (s *PaymentService) FindImportCandidatesForOwner(ownerUserID string, amount float64, currency string, startTs int64, endTs int64, importSource string, externalID string, batchIDs []string, limit int) ([]DedupCandidate, error) {
+	return findPaymentImportCandidatesForOwner(s.db, ownerUserID, amount, currency, startTs, endTs, importSource, externalID, batchIDs, limit)
+}
+
+// findPaymentImportCandidatesForOwner is the amount/time search for one imported row. Payments created
+// earlier in the same batch and payments imported from the same source under another transaction ID
+// are distinct transactions, not duplicates, so preview and commit report the same rows.
+func findPaymentImportCandidatesForOwner(db *gorm.DB, ownerUserID string, amount float64, currency string, startTs int64, endTs int64, importSource string, externalID string, batchIDs []string, limit int) ([]DedupCandidate, error) {
+	q, err := paymentAmountRangeQuery(db, ownerUserID, amount, currency, startTs, endTs)
+	if q == nil || err != nil {
+		return nil, err
+	}
+	if len(batchIDs) > 0 {
+		q = q.Where("id NOT IN ?", batchIDs)
+	}
+	importSource = strings.TrimSpace(importSource)
+	externalID = strings.TrimSpace(externalID)
+	if importSource != "" && externalID != "" {
+		q = q.Where("(COALESCE(import_source, '') <> ? OR COALESCE(external_id, '') = '' OR external_id = ?)", importSource, externalID)
+	}
+	return findPaymentAmountCandidates(q, limit)
+}
+
+// paymentAmountRangeQuery selects confirmed payments of the same amount and currency in
+// [startTs, endTs]; it returns nil when the inputs cannot match anything. An empty currency is CNY.
+func paymentAmountRangeQuery(db *gorm.DB, ownerUserID string, amount float64, currency string, startTs int64, endTs int64) (*gorm.DB, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	if amount <= 0 || startTs <= 0 {
+		return nil, nil
 	}
 
 	amountCents, err := money.FromMajor(amount)
@@ -91,21 +163,22 @@ func findPaymentCandidatesByAmountTimeForOwner(db *gorm.DB, ownerUserID string,
 		return nil, err
 	}
 
-	deltaMs := int64(window / time.Millisecond)
-	startTs := transactionTimeTs - deltaMs
-	endTs := transactionTimeTs + deltaMs
-
-	var rows []models.Payment
 	q := db.Model(&models.Payment{}).
 		Where("is_draft = 0").
 		Where("transaction_time_ts BETWEEN ? AND ?", startTs, endTs).
-		Where("amount_cents = ?", amountCents)
+		Where("amount_cents = ?", amountCents).
+		Where("currency = ?", normalizeCurrencyOrDefault(currency))
 	if ownerUserID != "" {
 		q = q.Where("owner_user_id = ?", ownerUserID)
 	}
-	if strings.TrimSpace(excludeID) != "" {
-		q = q.Where("id <> ?", strings.TrimSpace(excludeID))
+	return q, nil
+}
+
+func findPaymentAmountCandidates(q *gorm.DB, limit int) ([]DedupCandidate, error) {
+	if limit <= 0 {
+		limit = 5
 	}
+	var rows []models.Payment
 	if err := q.Order("transaction_time_ts DESC, created_at DESC").Limit(limit).Find(&rows).Error; err != nil {
 		return nil, err
 	}
@@ -148,7 +221,7 @@ func findInvoiceCandidatesByInvoiceNumberForOwner(db *gorm.DB, ownerUserID strin
 		q = q.Where("owner_user_id = ?", ownerUserID)
 	}
 	if strings.TrimSpace(excludeID) != "" {
-		q = q.Where("id <> ?", strings.TrimSpace(excludeID))
+		q = excludeDismissedDuplicates(q.Where("id <> ?", strings.TrimSpace(excludeID)), DedupEntityInvoice, excludeID)
 	}
 	if err := q.Order("created_at DESC").Limit(limit).Find(&rows).Error; err != nil {
 		return nil, err
@@ -168,3 +241,225 @@ func findInvoiceCandidatesByInvoiceNumberForOwner(db *gorm.DB, ownerUserID strin
 	}
 	return out, nil
 }
+
+// excludeDismissedDuplicates leaves out the records the user dismissed as duplicates of recordID in
+// the review queue, so confirming a draft does not flag a pair again that was already cleared.
+func excludeDismissedDuplicates(q *gorm.DB, entity string, recordID string) *gorm.DB {
+	recordID = strings.TrimSpace(recordID)
+	if recordID == "" {
+		return q
+	}
+	table := dedupEntityTable(entity)
+	return q.Where(`NOT EXISTS (SELECT 1 FROM dedup_dismissals AS d
+		WHERE d.owner_user_id = `+table+`.owner_user_id AND d.entity = ?
+		AND d.first_id = MIN(`+table+`.id, ?) AND d.second_id = MAX(`+table+`.id, ?))`, entity, recordID, recordID)
+}
+
+type perceptualHashMatch struct {
+	id       string
+	distance int
+}
+
+// nearestByPerceptualHash scores the confirmed rows of q against hash by Hamming distance.
+// SQLite has no popcount, so the owner's stored hashes are compared in Go.
+func nearestByPerceptualHash(q *gorm.DB, hash string, excludeID string, limit int) ([]perceptualHashMatch, error) {
+	target, ok := parsePerceptualHash(hash)
+	if !ok {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = 5
+	}
+
+	q = q.Select("id, perceptual_hash").
+		Where("is_draft = 0").
+		Where("perceptual_hash IS NOT NULL AND perceptual_hash <> ''")
+	if strings.TrimSpace(excludeID) != "" {
+		q = q.Where("id <> ?", strings.TrimSpace(excludeID))
+	}
+	var rows []struct {
+		ID             string
+		PerceptualHash string
+	}
+	if err := q.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	matches := make([]perceptualHashMatch, 0)
+	for _, row := range rows {
+		other, ok := parsePerceptualHash(row.PerceptualHash)
+		if !ok {
+			continue
+		}
+		if d := perceptualHashDistance(target, other); d <= perceptualHashMaxDistance {
+			matches = append(matches, perceptualHashMatch{id: row.ID, distance: d})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].id < matches[j].id
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+func (s *PaymentService) FindCandidatesByPerceptualHashForOwner(ownerUserID string, hash string, amount float64, excludeID string, limit int) ([]DedupCandidate, error) {
+	return findPaymentCandidatesByPerceptualHashForOwner(s.db, ownerUserID, hash, amount, excludeID, limit)
+}
+
+// findPaymentCandidatesByPerceptualHashForOwner finds confirmed payments whose screenshot looks
+// like the given one. Screenshots of the same app share a layout, so when amount is known a
+// candidate with a different recognised amount is treated as another payment, not a re-upload.
+func findPaymentCandidatesByPerceptualHashForOwner(db *gorm.DB, ownerUserID string, hash string, amount float64, excludeID string, limit int) ([]DedupCandidate, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	q := db.Model(&models.Payment{})
+	if ownerUserID != "" {
+		q = q.Where("owner_user_id = ?", ownerUserID)
+	}
+	if amount > 0 {
+		amountCents, err := money.FromMajor(amount)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Where("(amount_cents = ? OR amount_cents = 0)", amountCents)
+	}
+	matches, err := nearestByPerceptualHash(excludeDismissedDuplicates(q, DedupEntityPayment, excludeID), hash, excludeID, limit)
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(matches))
+	for _, m := range matches {
+		ids = append(ids, m.id)
+	}
+	var rows []models.Payment
+	if err := db.Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Payment, len(rows))
+	for _, p := range rows {
+		byID[p.ID] = p
+	}
+
+	out := make([]DedupCandidate, 0, len(matches))
+	for _, m := range matches {
+		p, ok := byID[m.id]
+		if !ok {
+			continue
+		}
+		amt := math.Abs(p.Amount)
+		ts := p.TransactionTime
+		similarity := perceptualHashSimilarity(m.distance)
+		out = append(out, DedupCandidate{
+			ID:              p.ID,
+			IsDraft:         p.IsDraft,
+			Amount:          &amt,
+			TransactionTime: &ts,
+			Merchant:        p.Merchant,
+			Similarity:      &similarity,
+			CreatedAt:       p.CreatedAt,
+		})
+	}
+	return out, nil
+}
+
+func (s *InvoiceService) FindCandidatesByPerceptualHashForOwner(ownerUserID string, hash string, invoiceNumber string, excludeID string, limit int) ([]DedupCandidate, error) {
+	return findInvoiceCandidatesByPerceptualHashForOwner(s.db, ownerUserID, hash, invoiceNumber, excludeID, limit)
+}
+
+// findInvoiceCandidatesByPerceptualHashForOwner finds confirmed invoices whose first page looks
+// like the given one. Invoices from the same seller share a template, so when invoiceNumber is
+// known only candidates without a number or with the same number are reported.
+func findInvoiceCandidatesByPerceptualHashForOwner(db *gorm.DB, ownerUserID string, hash string, invoiceNumber string, excludeID string, limit int) ([]DedupCandidate, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	invoiceNumber = strings.TrimSpace(invoiceNumber)
+	q := db.Model(&models.Invoice{})
+	if ownerUserID != "" {
+		q = q.Where("owner_user_id = ?", ownerUserID)
+	}
+	if invoiceNumber != "" {
+		q = q.Where("(invoice_number IS NULL OR invoice_number = '' OR invoice_number = ?)", invoiceNumber)
+	}
+	matches, err := nearestByPerceptualHash(excludeDismissedDuplicates(q, DedupEntityInvoice, excludeID), hash, excludeID, limit)
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(matches))
+	for _, m := range matches {
+		ids = append(ids, m.id)
+	}
+	var rows []models.Invoice
+	if err := db.Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Invoice, len(rows))
+	for _, inv := range rows {
+		byID[inv.ID] = inv
+	}
+
+	out := make([]DedupCandidate, 0, len(matches))
+	for _, m := range matches {
+		inv, ok := byID[m.id]
+		if !ok {
+			continue
+		}
+		similarity := perceptualHashSimilarity(m.distance)
+		out = append(out, DedupCandidate{
+			ID:            inv.ID,
+			IsDraft:       inv.IsDraft,
+			Amount:        inv.Amount,
+			InvoiceNumber: inv.InvoiceNumber,
+			InvoiceDate:   inv.InvoiceDate,
+			SellerName:    inv.SellerName,
+			Similarity:    &similarity,
+			CreatedAt:     inv.CreatedAt,
+		})
+	}
+	return out, nil
+}
+
+// FindSuspectedDuplicatesForOwner returns the suspected duplicates of a payment and the signal
+// that found them: amount+time matches first, then near-identical screenshots.
+func (s *PaymentService) FindSuspectedDuplicatesForOwner(ownerUserID string, amount float64, currency string, transactionTimeTs int64, perceptualHash *string, excludeID string) (string, []DedupCandidate, error) {
+	return findSuspectedPaymentDuplicatesForOwner(s.db, ownerUserID, amount, currency, transactionTimeTs, perceptualHash, excludeID)
+}
+
+func findSuspectedPaymentDuplicatesForOwner(db *gorm.DB, ownerUserID string, amount float64, currency string, transactionTimeTs int64, perceptualHash *string, excludeID string) (string, []DedupCandidate, error) {
+	cands, err := findPaymentCandidatesByAmountTimeForOwner(db, ownerUserID, amount, currency, transactionTimeTs, excludeID, 5*time.Minute, 5)
+	if err != nil || len(cands) > 0 {
+		return "amount_time", cands, err
+	}
+	if perceptualHash == nil {
+		return "", nil, nil
+	}
+	cands, err = findPaymentCandidatesByPerceptualHashForOwner(db, ownerUserID, *perceptualHash, amount, excludeID, 5)
+	if err != nil || len(cands) > 0 {
+		return "perceptual_hash", cands, err
+	}
+	return "", nil, nil
+}
+
+// FindSuspectedDuplicatesForOwner returns the suspected duplicates of an invoice and the signal
+// that found them: the invoice number first, then a near-identical first page.
+func (s *InvoiceService) FindSuspectedDuplicatesForOwner(ownerUserID string, invoiceNumber string, perceptualHash *string, excludeID string) (string, []DedupCandidate, error) {
+	invoiceNumber = strings.TrimSpace(invoiceNumber)
+	if invoiceNumber != "" {
+		cands, err := s.FindCandidatesByInvoiceNumberForOwner(ownerUserID, invoiceNumber, excludeID, 5)
+		if err != nil || len(cands) > 0 {
+			return "invoice_number", cands, err
+		}
+	}
+	if perceptualHash == nil {
+		return "", nil, nil
+	}
+	cands, err := s.FindCandidatesByPerceptualHashForOwner(ownerUserID, *perceptualHash, invoiceNumber, excludeID, 5)
+	if err != nil || len(cands) > 0 {
+		return "perceptual_hash", cands, err
+	}
+	return "", nil, nil
+}
@@ -0,0 +1,607 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DedupEntityPayment = "payment"
+	DedupEntityInvoice = "invoice"
+)
+
+var ErrInvalidDuplicatePair = errors.New("invalid duplicate pair")
+
+// DuplicateEvidence explains why two records were flagged as duplicates.
+type DuplicateEvidence struct {
+	// Reasons lists the matching signals: file_sha256, amount_time, invoice_number, perceptual_hash.
+	Reasons    []string `json:"reasons"`
+	SameFile   bool     `json:"same_file"`
+	SameAmount bool     `json:"same_amount"`
+	// TimeDeltaSeconds is the gap between the two transaction times (payments only).
+	TimeDeltaSeconds  *int64 `json:"time_delta_seconds,omitempty"`
+	SameInvoiceNumber bool   `json:"same_invoice_number"`
+	// ImageSimilarity compares the screenshots / first pages (1 = identical image hash).
+	ImageSimilarity *float64 `json:"image_similarity,omitempty"`
+}
+
+// DuplicatePair is one entry of the review queue: a flagged record next to the record it was
+// flagged against. Record and Existing are both *models.Payment or both *models.Invoice.
+type DuplicatePair struct {
+	Entity    string            `json:"entity"` // payment|invoice
+	Status    string            `json:"status"` // dedup status of the flagged record
+	Record    any               `json:"record"`
+	Existing  any               `json:"existing"`
+	Evidence  DuplicateEvidence `json:"evidence"`
+	FlaggedAt time.Time         `json:"flagged_at"`
+}
+
+type DuplicateQueueFilter struct {
+	// Entity limits the queue to payments or invoices; empty lists both.
+	Entity string `form:"entity"`
+	Limit  int    `form:"limit"`
+	Offset int    `form:"offset"`
+}
+
+// DuplicatePairInput names the two records of a pair.
+type DuplicatePairInput struct {
+	Entity     string `json:"entity" binding:"required"`
+	RecordID   string `json:"record_id" binding:"required"`
+	ExistingID string `json:"existing_id" binding:"required"`
+}
+
+// DuplicateMergeInput keeps SurvivorID and folds LoserID into it.
+type DuplicateMergeInput struct {
+	Entity     string `json:"entity" binding:"required"`
+	SurvivorID string `json:"survivor_id" binding:"required"`
+	LoserID    string `json:"loser_id" binding:"required"`
+}
+
+// DedupReviewService works through records flagged by the duplicate checks: it lists the
+// suspected pairs, dismisses false positives and merges real duplicates.
+type DedupReviewService struct {
+	db       *gorm.DB
+	payments *PaymentService
+	invoices *InvoiceService
+}
+
+func NewDedupReviewService(db *gorm.DB, payments *PaymentService, invoices *InvoiceService) *DedupReviewService {
+	return &DedupReviewService{db: db, payments: payments, invoices: invoices}
+}
+
+func normalizeDedupEntity(entity string) (string, error) {
+	switch entity = strings.ToLower(strings.TrimSpace(entity)); entity {
+	case DedupEntityPayment, DedupEntityInvoice:
+		return entity, nil
+	default:
+		return "", fmt.Errorf("%w: unsupported entity %q", ErrInvalidDuplicatePair, entity)
+	}
+}
+
+func dedupEntityTable(entity string) string {
+	if entity == DedupEntityInvoice {
+		return "invoices"
+	}
+	return "payments"
+}
+
+type duplicatePairRow struct {
+	Entity     string    `gorm:"column:entity"`
+	RecordID   string    `gorm:"column:record_id"`
+	ExistingID string    `gorm:"column:existing_id"`
+	Status     string    `gorm:"column:status"`
+	CreatedAt  time.Time `gorm:"column:created_at"`
+}
+
+// flaggedPairs returns the confirmed records flagged against another confirmed record of the
+// owner, leaving out pairs that were dismissed.
+func (s *DedupReviewService) flaggedPairs(ctx context.Context, ownerUserID string, entity string) ([]duplicatePairRow, error) {
+	table := dedupEntityTable(entity)
+	var rows []duplicatePairRow
+	err := s.db.WithContext(ctx).
+		Table(table+" AS r").
+		Select("? AS entity, r.id AS record_id, r.dedup_ref_id AS existing_id, r.dedup_status AS status, r.created_at", entity).
+		Joins("JOIN "+table+" AS e ON e.id = r.dedup_ref_id AND e.owner_user_id = r.owner_user_id AND e.is_draft = 0").
+		Where("r.owner_user_id = ? AND r.is_draft = 0 AND r.dedup_status IN ?", ownerUserID, []string{DedupStatusSuspected, DedupStatusForced}).
+		Where(`NOT EXISTS (SELECT 1 FROM dedup_dismissals AS d
+			WHERE d.owner_user_id = r.owner_user_id AND d.entity = ?
+			AND d.first_id = MIN(r.id, e.id) AND d.second_id = MAX(r.id, e.id))`, entity).
+		Scan(&rows).Error
+	return rows, err
+}
+
+// List returns the review queue, most recently flagged first.
+func (s *DedupReviewService) List(ctx context.Context, ownerUserID string, filter DuplicateQueueFilter) ([]DuplicatePair, int64, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	entities := []string{DedupEntityPayment, DedupEntityInvoice}
+	if strings.TrimSpace(filter.Entity) != "" {
+		entity, err := normalizeDedupEntity(filter.Entity)
+		if err != nil {
+			return nil, 0, err
+		}
+		entities = []string{entity}
+	}
+
+	var rows []duplicatePairRow
+	for _, entity := range entities {
+		found, err := s.flaggedPairs(ctx, ownerUserID, entity)
+		if err != nil {
+			return nil, 0, err
+		}
+		rows = append(rows, found...)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if !rows[i].CreatedAt.Equal(rows[j].CreatedAt) {
+			return rows[i].CreatedAt.After(rows[j].CreatedAt)
+		}
+		return rows[i].RecordID > rows[j].RecordID
+	})
+	total := int64(len(rows))
+	limit, offset := normalizeLimitOffset(filter.Limit, filter.Offset)
+	if offset >= len(rows) {
+		return []DuplicatePair{}, total, nil
+	}
+	rows = rows[offset:min(offset+limit, len(rows))]
+
+	ids := map[string][]string{}
+	for _, r := range rows {
+		ids[r.Entity] = append(ids[r.Entity], r.RecordID, r.ExistingID)
+	}
+	payments := map[string]*models.Payment{}
+	if len(ids[DedupEntityPayment]) > 0 {
+		var list []models.Payment
+		if err := s.db.WithContext(ctx).Where("owner_user_id = ? AND id IN ?", ownerUserID, ids[DedupEntityPayment]).Find(&list).Error; err != nil {
+			return nil, 0, err
+		}
+		for i := range list {
+			payments[list[i].ID] = &list[i]
+		}
+	}
+	invoices := map[string]*models.Invoice{}
+	if len(ids[DedupEntityInvoice]) > 0 {
+		var list []models.Invoice
+		if err := s.db.WithContext(ctx).Where("owner_user_id = ? AND id IN ?", ownerUserID, ids[DedupEntityInvoice]).Find(&list).Error; err != nil {
+			return nil, 0, err
+		}
+		for i := range list {
+			invoices[list[i].ID] = &list[i]
+		}
+	}
+
+	out := make([]DuplicatePair, 0, len(rows))
+	for _, r := range rows {
+		pair := DuplicatePair{Entity: r.Entity, Status: r.Status, FlaggedAt: r.CreatedAt}
+		if r.Entity == DedupEntityPayment {
+			record, existing := payments[r.RecordID], payments[r.ExistingID]
+			if record == nil || existing == nil {
+				continue
+			}
+			evidence, err := s.paymentEvidence(ownerUserID, record, existing)
+			if err != nil {
+				return nil, 0, err
+			}
+			pair.Record, pair.Existing, pair.Evidence = record, existing, evidence
+		} else {
+			record, existing := invoices[r.RecordID], invoices[r.ExistingID]
+			if record == nil || existing == nil {
+				continue
+			}
+			pair.Record, pair.Existing, pair.Evidence = record, existing, invoiceEvidence(record, existing)
+		}
+		out = append(out, pair)
+	}
+	return out, total, nil
+}
+
+func sameFileHash(a, b *string) bool {
+	return strings.TrimSpace(strPtrVal(a)) != "" && strings.TrimSpace(strPtrVal(a)) == strings.TrimSpace(strPtrVal(b))
+}
+
+// addImageEvidence records how alike the two images are, counting it as a signal when the
+// distance is within the near-duplicate threshold and the files are not byte-identical.
+func addImageEvidence(evidence *DuplicateEvidence, a, b *string) {
+	ha, okA := parsePerceptualHash(strPtrVal(a))
+	hb, okB := parsePerceptualHash(strPtrVal(b))
+	if !okA || !okB {
+		return
+	}
+	d := perceptualHashDistance(ha, hb)
+	similarity := perceptualHashSimilarity(d)
+	evidence.ImageSimilarity = &similarity
+	if d <= perceptualHashMaxDistance && !evidence.SameFile {
+		evidence.Reasons = append(evidence.Reasons, "perceptual_hash")
+	}
+}
+
+func (s *DedupReviewService) paymentEvidence(ownerUserID string, record, existing *models.Payment) (DuplicateEvidence, error) {
+	evidence := DuplicateEvidence{Reasons: []string{}, SameAmount: record.AmountCents == existing.AmountCents}
+	if sameFileHash(record.FileSHA256, existing.FileSHA256) {
+		evidence.SameFile = true
+		evidence.Reasons = append(evidence.Reasons, "file_sha256")
+	}
+	delta := (record.TransactionTimeTs - existing.TransactionTimeTs) / 1000
+	if delta < 0 {
+		delta = -delta
+	}
+	evidence.TimeDeltaSeconds = &delta
+	cands, err := findPaymentCandidatesByAmountTimeForOwner(s.db, ownerUserID, record.Amount, record.Currency, record.TransactionTimeTs, record.ID, 5*time.Minute, 20)
+	if err != nil {
+		return evidence, err
+	}
+	for _, c := range cands {
+		if c.ID == existing.ID {
+			evidence.Reasons = append(evidence.Reasons, "amount_time")
+			break
+		}
+	}
+	addImageEvidence(&evidence, record.PerceptualHash, existing.PerceptualHash)
+	return evidence, nil
+}
+
+func invoiceEvidence(record, existing *models.Invoice) DuplicateEvidence {
+	evidence := DuplicateEvidence{Reasons: []string{}}
+	if sameFileHash(record.FileSHA256, existing.FileSHA256) {
+		evidence.SameFile = true
+		evidence.Reasons = append(evidence.Reasons, "file_sha256")
+	}
+	if no := strings.TrimSpace(strPtrVal(record.InvoiceNumber)); no != "" && no == strings.TrimSpace(strPtrVal(existing.InvoiceNumber)) {
+		evidence.SameInvoiceNumber = true
+		evidence.Reasons = append(evidence.Reasons, "invoice_number")
+	}
+	evidence.SameAmount = record.AmountCents != nil && existing.AmountCents != nil && *record.AmountCents == *existing.AmountCents
+	addImageEvidence(&evidence, record.PerceptualHash, existing.PerceptualHash)
+	return evidence
+}
+
+// checkPair verifies that both records exist and belong to the owner.
+func (s *DedupReviewService) checkPair(ownerUserID string, entity string, firstID string, secondID string) error {
+	if firstID == "" || secondID == "" || firstID == secondID {
+		return fmt.Errorf("%w: two different records are required", ErrInvalidDuplicatePair)
+	}
+	var count int64
+	if err := s.db.Table(dedupEntityTable(entity)).
+		Where("owner_user_id = ? AND id IN ?", ownerUserID, []string{firstID, secondID}).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count != 2 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Dismiss marks a pair as not duplicates: both records are cleared of the flag pointing at the
+// other one and the pair no longer shows up in the queue, even if a later check flags it again.
+func (s *DedupReviewService) Dismiss(ownerUserID string, input DuplicatePairInput) error {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	entity, err := normalizeDedupEntity(input.Entity)
+	if err != nil {
+		return err
+	}
+	recordID, existingID := strings.TrimSpace(input.RecordID), strings.TrimSpace(input.ExistingID)
+	if err := s.checkPair(ownerUserID, entity, recordID, existingID); err != nil {
+		return err
+	}
+	first, second := min(recordID, existingID), max(recordID, existingID)
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.DedupDismissal{
+			ID:          utils.GenerateUUID(),
+			OwnerUserID: ownerUserID,
+			Entity:      entity,
+			FirstID:     first,
+			SecondID:    second,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Table(dedupEntityTable(entity)).
+			Where("owner_user_id = ? AND ((id = ? AND dedup_ref_id = ?) OR (id = ? AND dedup_ref_id = ?))", ownerUserID, first, second, second, first).
+			Updates(map[string]interface{}{"dedup_status": DedupStatusOK, "dedup_ref_id": nil}).Error
+	})
+}
+
+// Merge folds the loser into the survivor and deletes the loser. The survivor keeps its own
+// values and only takes over fields it lacks; links, tags and OCR data move across.
+func (s *DedupReviewService) Merge(ownerUserID string, input DuplicateMergeInput) (any, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	entity, err := normalizeDedupEntity(input.Entity)
+	if err != nil {
+		return nil, err
+	}
+	survivorID, loserID := strings.TrimSpace(input.SurvivorID), strings.TrimSpace(input.LoserID)
+	if err := s.checkPair(ownerUserID, entity, survivorID, loserID); err != nil {
+		return nil, err
+	}
+	if entity == DedupEntityInvoice {
+		return s.mergeInvoices(ownerUserID, survivorID, loserID)
+	}
+	return s.mergePayments(ownerUserID, survivorID, loserID)
+}
+
+// fillBlank copies a text field from the loser when the survivor has none.
+func fillBlank(updates map[string]interface{}, column string, survivor, loser *string) {
+	if strings.TrimSpace(strPtrVal(survivor)) == "" && strings.TrimSpace(strPtrVal(loser)) != "" {
+		updates[column] = *loser
+	}
+}
+
+// moveDedupReferencesTx points records flagged against the loser at the survivor and drops
+// the loser's dismissals.
+func moveDedupReferencesTx(tx *gorm.DB, ownerUserID string, entity string, survivorID string, loserID string) error {
+	if err := tx.Table(dedupEntityTable(entity)).
+		Where("owner_user_id = ? AND dedup_ref_id = ? AND id <> ?", ownerUserID, loserID, survivorID).
+		Update("dedup_ref_id", survivorID).Error; err != nil {
+		return err
+	}
+	return tx.Where("owner_user_id = ? AND entity = ? AND (first_id = ? OR second_id = ?)", ownerUserID, entity, loserID, loserID).
+		Delete(&models.DedupDismissal{}).Error
+}
+
+func (s *DedupReviewService) mergePayments(ownerUserID string, survivorID string, loserID string) (*models.Payment, error) {
+	survivor, err := s.payments.repo.FindByIDForOwner(ownerUserID, survivorID)
+	if err != nil {
+		return nil, err
+	}
+	loser, err := s.payments.repo.FindByIDForOwner(ownerUserID, loserID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{"dedup_status": DedupStatusOK, "dedup_ref_id": nil}
+	fillBlank(updates, "merchant", survivor.Merchant, loser.Merchant)
+	fillBlank(updates, "category", survivor.Category, loser.Category)
+	fillBlank(updates, "payment_method", survivor.PaymentMethod, loser.PaymentMethod)
+	fillBlank(updates, "description", survivor.Description, loser.Description)
+	fillBlank(updates, "account_id", survivor.AccountID, loser.AccountID)
+	screenshotMoved := false
+	if strings.TrimSpace(strPtrVal(survivor.ScreenshotPath)) == "" && strings.TrimSpace(strPtrVal(loser.ScreenshotPath)) != "" {
+		updates["screenshot_path"] = *loser.ScreenshotPath
+		updates["file_sha256"] = loser.FileSHA256
+		updates["perceptual_hash"] = loser.PerceptualHash
+		screenshotMoved = true
+	}
+	tripMoved := false
+	if survivor.TripID == nil && loser.TripID != nil && survivor.TripAssignSrc != assignSrcBlocked {
+		updates["trip_id"] = *loser.TripID
+		updates["trip_assignment_source"] = loser.TripAssignSrc
+		updates["trip_assignment_state"] = loser.TripAssignState
+		tripMoved = true
+	}
+
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		// An invoice links to at most one payment, so its link simply moves across.
+		if err := tx.Model(&models.InvoicePaymentLink{}).
+			Where("payment_id = ?", loserID).
+			Update("payment_id", survivorID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Invoice{}).
+			Where("owner_user_id = ? AND payment_id = ?", ownerUserID, loserID).
+			Update("payment_id", survivorID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.InvoiceRide{}).
+			Where("owner_user_id = ? AND payment_id = ?", ownerUserID, loserID).
+			Update("payment_id", survivorID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Payment{}).
+			Where("owner_user_id = ? AND refund_of_id = ? AND id <> ?", ownerUserID, loserID, survivorID).
+			Update("refund_of_id", survivorID).Error; err != nil {
+			return err
+		}
+		if err := paymentTagLink.moveTo(tx, loserID, survivorID); err != nil {
+			return err
+		}
+		var blobs int64
+		if err := tx.Model(&models.PaymentOCRBlob{}).Where("payment_id = ?", survivorID).Count(&blobs).Error; err != nil {
+			return err
+		}
+		if blobs == 0 {
+			if err := tx.Model(&models.PaymentOCRBlob{}).
+				Where("owner_user_id = ? AND payment_id = ?", ownerUserID, loserID).
+				Update("payment_id", survivorID).Error; err != nil {
+				return err
+			}
+		}
+		if err := moveDedupReferencesTx(tx, ownerUserID, DedupEntityPayment, survivorID, loserID); err != nil {
+			return err
+		}
+		if err := s.payments.repo.WithDB(tx).UpdateForOwner(ownerUserID, survivorID, updates); err != nil {
+			return err
+		}
+		if tripMoved {
+			if err := syncAutoSplitTripsTx(tx, ownerUserID, []string{survivorID}); err != nil {
+				return err
+			}
+		}
+		return s.payments.deletePaymentTx(tx, ownerUserID, loserID)
+	}); err != nil {
+		return nil, err
+	}
+
+	if !screenshotMoved && loser.ScreenshotPath != nil {
+		removeUnreferencedFile(s.db, s.payments.uploadsDir, *loser.ScreenshotPath)
+	}
+	affected := []string{}
+	for _, p := range []*models.Payment{survivor, loser} {
+		if p.TripID != nil {
+			affected = append(affected, *p.TripID)
+		}
+	}
+	if err := recalcTripBadDebtLockedForTripIDs(s.db, affected); err != nil {
+		return nil, err
+	}
+	return s.payments.GetByID(ownerUserID, survivorID)
+}
+
+// mergeInvoiceAttachmentsTx moves the loser's attachments to the survivor, except copies of a file
+// the survivor already has (same SHA-256), which are returned so their files can be cleaned up.
+// Rides, like line items and journeys, only move when the survivor has none: both copies of the
+// same ride invoice carry the same rides, and keeping both would double the ride total.
+func mergeInvoiceAttachmentsTx(tx *gorm.DB, ownerUserID string, survivorID string, loserID string) ([]models.InvoiceAttachment, error) {
+	var kept []models.InvoiceAttachment
+	if err := tx.Where("owner_user_id = ? AND invoice_id = ?", ownerUserID, survivorID).Find(&kept).Error; err != nil {
+		return nil, err
+	}
+	keptBySHA := make(map[string]string, len(kept))
+	for _, a := range kept {
+		if sha := strings.TrimSpace(strPtrVal(a.FileSHA256)); sha != "" {
+			keptBySHA[sha] = a.ID
+		}
+	}
+	var incoming []models.InvoiceAttachment
+	if err := tx.Where("owner_user_id = ? AND invoice_id = ?", ownerUserID, loserID).Find(&incoming).Error; err != nil {
+		return nil, err
+	}
+	var dropped []models.InvoiceAttachment
+	replacedBy := map[string]string{}
+	for _, a := range incoming {
+		if id, ok := keptBySHA[strings.TrimSpace(strPtrVal(a.FileSHA256))]; ok {
+			dropped = append(dropped, a)
+			replacedBy[a.ID] = id
+			continue
+		}
+		if err := tx.Model(&models.InvoiceAttachment{}).Where("id = ?", a.ID).Update("invoice_id", survivorID).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var rides int64
+	if err := tx.Model(&models.InvoiceRide{}).Where("invoice_id = ?", survivorID).Count(&rides).Error; err != nil {
+		return nil, err
+	}
+	if rides == 0 {
+		if err := tx.Model(&models.InvoiceRide{}).
+			Where("owner_user_id = ? AND invoice_id = ?", ownerUserID, loserID).
+			Update("invoice_id", survivorID).Error; err != nil {
+			return nil, err
+		}
+		// Rides read from a dropped copy point at the survivor's identical attachment instead.
+		for from, to := range replacedBy {
+			if err := tx.Model(&models.InvoiceRide{}).
+				Where("owner_user_id = ? AND invoice_id = ? AND attachment_id = ?", ownerUserID, survivorID, from).
+				Update("attachment_id", to).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+	return dropped, nil
+}
+
+func (s *DedupReviewService) mergeInvoices(ownerUserID string, survivorID string, loserID string) (*models.Invoice, error) {
+	survivor, err := s.invoices.repo.FindByIDForOwner(ownerUserID, survivorID)
+	if err != nil {
+		return nil, err
+	}
+	loser, err := s.invoices.repo.FindByIDForOwner(ownerUserID, loserID)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := tripIDsForInvoices(s.db, ownerUserID, []string{survivorID, loserID})
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{"dedup_status": DedupStatusOK, "dedup_ref_id": nil}
+	fillBlank(updates, "invoice_number", survivor.InvoiceNumber, loser.InvoiceNumber)
+	fillBlank(updates, "seller_name", survivor.SellerName, loser.SellerName)
+	fillBlank(updates, "buyer_name", survivor.BuyerName, loser.BuyerName)
+	fillBlank(updates, "payment_id", survivor.PaymentID, loser.PaymentID)
+	if strings.TrimSpace(strPtrVal(survivor.InvoiceDate)) == "" && strings.TrimSpace(strPtrVal(loser.InvoiceDate)) != "" {
+		updates["invoice_date"] = *loser.InvoiceDate
+		updates["invoice_date_ymd"] = loser.InvoiceDateYMD
+	}
+	if survivor.Amount == nil && loser.Amount != nil {
+		updates["amount"] = *loser.Amount
+	}
+	if survivor.TaxAmount == nil && loser.TaxAmount != nil {
+		updates["tax_amount"] = *loser.TaxAmount
+	}
+
+	var droppedAttachments []models.InvoiceAttachment
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		// The loser's payment link moves across unless the survivor is already linked.
+		if err := tx.Exec("UPDATE OR IGNORE invoice_payment_links SET invoice_id = ? WHERE invoice_id = ?", survivorID, loserID).Error; err != nil {
+			return err
+		}
+		dropped, err := mergeInvoiceAttachmentsTx(tx, ownerUserID, survivorID, loserID)
+		if err != nil {
+			return err
+		}
+		droppedAttachments = dropped
+		if err := invoiceTagLink.moveTo(tx, loserID, survivorID); err != nil {
+			return err
+		}
+		var blobs int64
+		if err := tx.Model(&models.InvoiceOCRBlob{}).Where("invoice_id = ?", survivorID).Count(&blobs).Error; err != nil {
+			return err
+		}
+		if blobs == 0 {
+			if err := tx.Model(&models.InvoiceOCRBlob{}).
+				Where("owner_user_id = ? AND invoice_id = ?", ownerUserID, loserID).
+				Update("invoice_id", survivorID).Error; err != nil {
+				return err
+			}
+		}
+		var lineItems int64
+		if err := tx.Model(&models.InvoiceLineItem{}).Where("invoice_id = ?", survivorID).Count(&lineItems).Error; err != nil {
+			return err
+		}
+		if lineItems == 0 {
+			if err := tx.Model(&models.InvoiceLineItem{}).
+				Where("owner_user_id = ? AND invoice_id = ?", ownerUserID, loserID).
+				Update("invoice_id", survivorID).Error; err != nil {
+				return err
+			}
+		}
+		var journeys int64
+		if err := tx.Model(&models.JourneySegment{}).Where("invoice_id = ?", survivorID).Count(&journeys).Error; err != nil {
+			return err
+		}
+		if journeys == 0 {
+			if err := tx.Model(&models.JourneySegment{}).
+				Where("owner_user_id = ? AND invoice_id = ?", ownerUserID, loserID).
+				Update("invoice_id", survivorID).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.EmailLog{}).
+			Where("owner_user_id = ? AND parsed_invoice_id = ?", ownerUserID, loserID).
+			Update("parsed_invoice_id", survivorID).Error; err != nil {
+			return err
+		}
+		if err := moveDedupReferencesTx(tx, ownerUserID, DedupEntityInvoice, survivorID, loserID); err != nil {
+			return err
+		}
+		if err := s.invoices.repo.WithDB(tx).UpdateForOwner(ownerUserID, survivorID, updates); err != nil {
+			return err
+		}
+		return s.invoices.deleteInvoiceTx(tx, ownerUserID, loserID)
+	}); err != nil {
+		return nil, err
+	}
+
+	removeUnreferencedFile(s.db, s.invoices.uploadsDir, loser.FilePath)
+	for _, a := range droppedAttachments {
+		removeUnreferencedFile(s.db, s.invoices.uploadsDir, a.FilePath)
+	}
+	merged, err := tripIDsForInvoices(s.db, ownerUserID, []string{survivorID})
+	if err != nil {
+		return nil, err
+	}
+	if err := recalcTripBadDebtLockedForTripIDs(s.db, append(affected, merged...)); err != nil {
+		return nil, err
+	}
+	return s.invoices.GetByID(ownerUserID, survivorID)
+}
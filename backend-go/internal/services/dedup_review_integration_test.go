@@ -0,0 +1,280 @@
+//go:build cgo
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"smart-bill-manager/internal/models"
+)
+
+func TestDedupReviewQueueDismissAndMerge(t *testing.T) {
+	db := openServiceTestDB(t)
+	uploads := t.TempDir()
+	payments := NewPaymentService(db, uploads)
+	invoices := NewInvoiceService(db, uploads)
+	trips := NewTripService(db, uploads)
+	tags := NewTagService(db)
+	review := NewDedupReviewService(db, payments, invoices)
+	ctx := context.Background()
+
+	create := func(amount float64, at string) *models.Payment {
+		t.Helper()
+		p, err := payments.Create("owner-1", CreatePaymentInput{Amount: amount, TransactionTime: at})
+		if err != nil {
+			t.Fatalf("创建支付失败: %v", err)
+		}
+		return p
+	}
+	flag := func(table string, id string, refID string, updates map[string]interface{}) {
+		t.Helper()
+		updates["dedup_status"] = DedupStatusSuspected
+		updates["dedup_ref_id"] = refID
+		if err := db.Table(table).Where("id = ?", id).Updates(updates).Error; err != nil {
+			t.Fatalf("标记重复失败: %v", err)
+		}
+	}
+	writeUpload := func(name string) string {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(uploads, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("写入文件失败: %v", err)
+		}
+		return "uploads/" + name
+	}
+
+	survivor := create(50, "2025-12-01T02:00:00Z")
+	loser := create(50, "2025-12-01T02:01:00Z")
+	other := create(50, "2025-12-01T02:03:00Z")
+	screenshot := writeUpload("dup.png")
+	if err := db.Model(&models.Payment{}).Where("id = ?", survivor.ID).Update("file_sha256", "hash-1").Error; err != nil {
+		t.Fatalf("更新哈希失败: %v", err)
+	}
+	flag("payments", loser.ID, survivor.ID, map[string]interface{}{"file_sha256": "hash-1", "screenshot_path": screenshot})
+	flag("payments", other.ID, survivor.ID, map[string]interface{}{})
+
+	trip, _, err := trips.Create("owner-1", CreateTripInput{Name: "苏州出差", StartTime: "2025-12-10T00:00:00+08:00", EndTime: "2025-12-12T00:00:00+08:00"})
+	if err != nil {
+		t.Fatalf("创建行程失败: %v", err)
+	}
+	if err := payments.Update("owner-1", loser.ID, UpdatePaymentInput{TripID: &trip.ID}); err != nil {
+		t.Fatalf("指定行程失败: %v", err)
+	}
+	tag, err := tags.Create("owner-1", TagInput{Name: "报销"})
+	if err != nil {
+		t.Fatalf("创建标签失败: %v", err)
+	}
+	if _, err := payments.SetTags("owner-1", loser.ID, []string{tag.ID}); err != nil {
+		t.Fatalf("设置标签失败: %v", err)
+	}
+	ocr := `{"raw_text":"重复截图"}`
+	if err := payments.blobRepo.UpsertPaymentBlob(nil, "owner-1", loser.ID, &ocr); err != nil {
+		t.Fatalf("写入 OCR 数据失败: %v", err)
+	}
+
+	invoiceNo := "24110000000000000001"
+	seller := "上海某某酒店有限公司"
+	keep := &models.Invoice{ID: "invoice-keep", OwnerUserID: "owner-1", Filename: "a.pdf", OriginalName: "a.pdf",
+		FilePath: writeUpload("a.pdf"), InvoiceNumber: &invoiceNo, ParseStatus: "success", Source: "upload", DedupStatus: "ok"}
+	drop := &models.Invoice{ID: "invoice-drop", OwnerUserID: "owner-1", Filename: "b.pdf", OriginalName: "b.pdf",
+		FilePath: writeUpload("b.pdf"), InvoiceNumber: &invoiceNo, SellerName: &seller, ParseStatus: "success", Source: "email", DedupStatus: "ok"}
+	for _, inv := range []*models.Invoice{keep, drop} {
+		if err := db.Create(inv).Error; err != nil {
+			t.Fatalf("创建发票失败: %v", err)
+		}
+	}
+	flag("invoices", drop.ID, keep.ID, map[string]interface{}{})
+	if err := invoices.LinkPayment("owner-1", drop.ID, loser.ID); err != nil {
+		t.Fatalf("关联发票失败: %v", err)
+	}
+	attachment := &models.InvoiceAttachment{ID: "attachment-1", OwnerUserID: "owner-1", InvoiceID: drop.ID,
+		Filename: "itinerary.pdf", OriginalName: "itinerary.pdf", FilePath: writeUpload("itinerary.pdf")}
+	if err := db.Create(attachment).Error; err != nil {
+		t.Fatalf("创建附件失败: %v", err)
+	}
+
+	pairs, total, err := review.List(ctx, "owner-1", DuplicateQueueFilter{})
+	if err != nil || total != 3 || len(pairs) != 3 {
+		t.Fatalf("重复队列应包含三组: %d %v", total, err)
+	}
+	evidence := map[string]DuplicateEvidence{}
+	for _, p := range pairs {
+		switch rec := p.Record.(type) {
+		case *models.Payment:
+			evidence[rec.ID] = p.Evidence
+		case *models.Invoice:
+			evidence[rec.ID] = p.Evidence
+		}
+	}
+	if e := evidence[loser.ID]; !e.SameFile || !e.SameAmount || len(e.Reasons) != 2 || e.TimeDeltaSeconds == nil || *e.TimeDeltaSeconds != 60 {
+		t.Fatalf("哈希与金额时间证据异常: %#v", e)
+	}
+	if e := evidence[other.ID]; e.SameFile || len(e.Reasons) != 1 || e.Reasons[0] != "amount_time" {
+		t.Fatalf("金额时间证据异常: %#v", e)
+	}
+	if e := evidence[drop.ID]; !e.SameInvoiceNumber || e.Reasons[0] != "invoice_number" {
+		t.Fatalf("发票号证据异常: %#v", e)
+	}
+
+	// A dismissed pair stays out of the queue even when a later check flags it again.
+	if err := review.Dismiss("owner-1", DuplicatePairInput{Entity: DedupEntityPayment, RecordID: other.ID, ExistingID: survivor.ID}); err != nil {
+		t.Fatalf("忽略重复失败: %v", err)
+	}
+	if got, _ := payments.GetByID("owner-1", other.ID); got.DedupStatus != DedupStatusOK || got.DedupRefID != nil {
+		t.Fatalf("忽略后应清除重复标记: %#v", got)
+	}
+	flag("payments", other.ID, survivor.ID, map[string]interface{}{})
+	if _, total, _ = review.List(ctx, "owner-1", DuplicateQueueFilter{Entity: DedupEntityPayment}); total != 1 {
+		t.Fatalf("已忽略的组合不应再次出现: %d", total)
+	}
+	// Re-checking the record, as confirming a draft does, skips the dismissed pair too.
+	_, cands, err := payments.FindSuspectedDuplicatesForOwner("owner-1", other.Amount, other.Currency, other.TransactionTimeTs, nil, other.ID)
+	if err != nil || len(cands) == 0 {
+		t.Fatalf("未忽略的候选仍应被发现: %#v %v", cands, err)
+	}
+	for _, c := range cands {
+		if c.ID == survivor.ID {
+			t.Fatalf("已忽略的组合不应再被判为重复: %#v", cands)
+		}
+	}
+
+	merged, err := review.Merge("owner-1", DuplicateMergeInput{Entity: DedupEntityPayment, SurvivorID: survivor.ID, LoserID: loser.ID})
+	if err != nil {
+		t.Fatalf("合并支付失败: %v", err)
+	}
+	kept := merged.(*models.Payment)
+	if kept.TripID == nil || *kept.TripID != trip.ID || kept.ScreenshotPath == nil || *kept.ScreenshotPath != screenshot ||
+		len(kept.Tags) != 1 || kept.ExtractedData == nil || kept.DedupStatus != DedupStatusOK {
+		t.Fatalf("合并后应保留行程、截图、标签与 OCR 数据: %#v", kept)
+	}
+	if _, err := payments.GetByID("owner-1", loser.ID); err == nil {
+		t.Fatalf("被合并的支付应已删除")
+	}
+	if linked, _ := payments.GetLinkedInvoices("owner-1", survivor.ID); len(linked) != 1 || linked[0].ID != drop.ID {
+		t.Fatalf("发票关联应转移到保留的支付: %#v", linked)
+	}
+	if _, err := os.Stat(filepath.Join(uploads, "dup.png")); err != nil {
+		t.Fatalf("转移给保留记录的截图不应被删除: %v", err)
+	}
+
+	if _, err := review.Merge("owner-1", DuplicateMergeInput{Entity: DedupEntityInvoice, SurvivorID: keep.ID, LoserID: drop.ID}); err != nil {
+		t.Fatalf("合并发票失败: %v", err)
+	}
+	gotInvoice, err := invoices.GetByID("owner-1", keep.ID)
+	if err != nil || gotInvoice.SellerName == nil || *gotInvoice.SellerName != seller || len(gotInvoice.Attachments) != 1 {
+		t.Fatalf("合并后发票应补全销售方并接收附件: %#v %v", gotInvoice, err)
+	}
+	if linked, _ := invoices.GetLinkedPayments("owner-1", keep.ID); len(linked) != 1 || linked[0].ID != survivor.ID {
+		t.Fatalf("支付关联应转移到保留的发票: %#v", linked)
+	}
+	if _, err := os.Stat(filepath.Join(uploads, "b.pdf")); !os.IsNotExist(err) {
+		t.Fatalf("被合并发票的文件应被删除: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(uploads, "itinerary.pdf")); err != nil {
+		t.Fatalf("转移的附件文件不应被删除: %v", err)
+	}
+	if _, total, _ = review.List(ctx, "owner-1", DuplicateQueueFilter{}); total != 0 {
+		t.Fatalf("处理完成后队列应为空: %d", total)
+	}
+
+	if _, err := review.Merge("owner-1", DuplicateMergeInput{Entity: DedupEntityPayment, SurvivorID: survivor.ID, LoserID: survivor.ID}); err == nil {
+		t.Fatalf("不能与自身合并")
+	}
+}
+
+func TestPaymentAmountTimeDuplicatesRequireSameCurrency(t *testing.T) {
+	db := openServiceTestDB(t)
+	payments := NewPaymentService(db, t.TempDir())
+
+	existing, err := payments.Create("owner-1", CreatePaymentInput{Amount: 100, TransactionTime: "2025-10-20T02:00:00Z"})
+	if err != nil {
+		t.Fatalf("创建支付失败: %v", err)
+	}
+	ts := existing.TransactionTimeTs
+
+	_, cands, err := payments.FindSuspectedDuplicatesForOwner("owner-1", 100, "USD", ts, nil, "")
+	if err != nil || len(cands) != 0 {
+		t.Fatalf("不同币种的同额支付不应视为重复: %#v %v", cands, err)
+	}
+	_, cands, err = payments.FindSuspectedDuplicatesForOwner("owner-1", 100, "", ts, nil, "")
+	if err != nil || len(cands) != 1 || cands[0].ID != existing.ID {
+		t.Fatalf("同币种的同额支付应视为重复: %#v %v", cands, err)
+	}
+
+	usd := "USD"
+	if _, err := payments.Create("owner-1", CreatePaymentInput{Amount: 100, Currency: &usd, TransactionTime: "2025-10-20T02:01:00Z"}); err != nil {
+		t.Fatalf("创建外币支付失败: %v", err)
+	}
+	_, cands, err = payments.FindSuspectedDuplicatesForOwner("owner-1", 100, "usd", ts, nil, "")
+	if err != nil || len(cands) != 1 || cands[0].ID == existing.ID {
+		t.Fatalf("应只命中同币种的支付: %#v %v", cands, err)
+	}
+}
+
+func TestDedupMergeInvoicesKeepsOneCopyOfRides(t *testing.T) {
+	db := openServiceTestDB(t)
+	uploads := t.TempDir()
+	payments := NewPaymentService(db, uploads)
+	invoices := NewInvoiceService(db, uploads)
+	review := NewDedupReviewService(db, payments, invoices)
+
+	writeUpload := func(name string) string {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(uploads, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("写入文件失败: %v", err)
+		}
+		return "uploads/" + name
+	}
+
+	// The same Didi invoice arrived twice, each copy with its itinerary and the two rides read from it.
+	invoiceNo := "25320000000000000001"
+	sha := "itinerary-sha"
+	for _, id := range []string{"keep", "drop"} {
+		inv := &models.Invoice{ID: "invoice-" + id, OwnerUserID: "owner-1", Filename: id + ".pdf", OriginalName: id + ".pdf",
+			FilePath: writeUpload(id + ".pdf"), InvoiceNumber: &invoiceNo, ParseStatus: "success", Source: "email", DedupStatus: "ok"}
+		if err := db.Create(inv).Error; err != nil {
+			t.Fatalf("创建发票失败: %v", err)
+		}
+		attachmentID := "attachment-" + id
+		attachment := &models.InvoiceAttachment{ID: attachmentID, OwnerUserID: "owner-1", InvoiceID: inv.ID, Kind: "itinerary",
+			Filename: id + "-itinerary.pdf", OriginalName: "行程单.pdf", FilePath: writeUpload(id + "-itinerary.pdf"), FileSHA256: &sha}
+		if err := db.Create(attachment).Error; err != nil {
+			t.Fatalf("创建附件失败: %v", err)
+		}
+		for no := 1; no <= 2; no++ {
+			cents := int64(2000 * no)
+			ride := &models.InvoiceRide{ID: fmt.Sprintf("ride-%s-%d", id, no), OwnerUserID: "owner-1", InvoiceID: inv.ID,
+				AttachmentID: &attachmentID, RideNo: no, AmountCents: &cents}
+			if err := db.Create(ride).Error; err != nil {
+				t.Fatalf("创建行程记录失败: %v", err)
+			}
+		}
+	}
+
+	if _, err := review.Merge("owner-1", DuplicateMergeInput{Entity: DedupEntityInvoice, SurvivorID: "invoice-keep", LoserID: "invoice-drop"}); err != nil {
+		t.Fatalf("合并发票失败: %v", err)
+	}
+	var rides []models.InvoiceRide
+	if err := db.Where("invoice_id = ?", "invoice-keep").Find(&rides).Error; err != nil {
+		t.Fatalf("读取行程记录失败: %v", err)
+	}
+	if len(rides) != 2 {
+		t.Fatalf("合并后行程记录不应重复: %d", len(rides))
+	}
+	var attachments []models.InvoiceAttachment
+	if err := db.Where("invoice_id = ?", "invoice-keep").Find(&attachments).Error; err != nil {
+		t.Fatalf("读取附件失败: %v", err)
+	}
+	if len(attachments) != 1 || attachments[0].ID != "attachment-keep" {
+		t.Fatalf("相同内容的附件只应保留一份: %#v", attachments)
+	}
+	if _, err := os.Stat(filepath.Join(uploads, "drop-itinerary.pdf")); !os.IsNotExist(err) {
+		t.Fatalf("重复附件的文件应被删除: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(uploads, "keep-itinerary.pdf")); err != nil {
+		t.Fatalf("保留附件的文件不应被删除: %v", err)
+	}
+}
@@ -126,9 +126,15 @@ func cleanupDraftsOnce(ctx context.Context, db *gorm.DB, uploadsDir string, cuto
 			if err := tx.Where("payment_id IN ?", payIDs).Delete(&models.InvoicePaymentLink{}).Error; err != nil {
 				return err
 			}
+			if err := tx.Model(&models.InvoiceRide{}).Where("payment_id IN ?", payIDs).Update("payment_id", nil).Error; err != nil {
+				return err
+			}
 			if err := tx.Where("payment_id IN ?", payIDs).Delete(&models.PaymentOCRBlob{}).Error; err != nil {
 				return err
 			}
+			if err := paymentTagLink.deleteFor(tx, payIDs); err != nil {
+				return err
+			}
 			res := tx.Where("id IN ? AND is_draft = 1 AND created_at < ?", payIDs, cutoff).Delete(&models.Payment{})
 			if res.Error != nil {
 				return res.Error
@@ -151,6 +157,18 @@ func cleanupDraftsOnce(ctx context.Context, db *gorm.DB, uploadsDir string, cuto
 			if err := tx.Where("invoice_id IN ?", invIDs).Delete(&models.InvoiceOCRBlob{}).Error; err != nil {
 				return err
 			}
+			if err := tx.Where("invoice_id IN ?", invIDs).Delete(&models.InvoiceLineItem{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("invoice_id IN ?", invIDs).Delete(&models.JourneySegment{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("invoice_id IN ?", invIDs).Delete(&models.InvoiceRide{}).Error; err != nil {
+				return err
+			}
+			if err := invoiceTagLink.deleteFor(tx, invIDs); err != nil {
+				return err
+			}
 			res := tx.Where("id IN ? AND is_draft = 1 AND created_at < ?", invIDs, cutoff).Delete(&models.Invoice{})
 			if res.Error != nil {
 				return res.Error
@@ -168,6 +186,13 @@ func cleanupDraftsOnce(ctx context.Context, db *gorm.DB, uploadsDir string, cuto
 		if row.ScreenshotPath == nil || strings.TrimSpace(*row.ScreenshotPath) == "" {
 			continue
 		}
+		// A confirmed row of the same bill-list screenshot keeps the file.
+		if referenced, refErr := storedFileReferenced(db.WithContext(ctx), *row.ScreenshotPath); refErr != nil || referenced {
+			if refErr != nil {
+				fileErrors = append(fileErrors, refErr)
+			}
+			continue
+		}
 		deleted, removeErr := removeStoredFile(uploadsDir, *row.ScreenshotPath)
 		if deleted {
 			filesDeleted++
@@ -224,6 +249,37 @@ func nonEmptyInvoiceDraftIDs(rows []invoiceDraftCleanupRow) []string {
 	return ids
 }
 
+// storedFileReferenced reports whether a payment, invoice or attachment still points at the
+// stored upload (duplicate uploads and bill-list rows can share a path).
+func storedFileReferenced(db *gorm.DB, storedPath string) (bool, error) {
+	var refs int64
+	if err := db.Raw(`SELECT
+		(SELECT COUNT(*) FROM payments WHERE screenshot_path = ?) +
+		(SELECT COUNT(*) FROM invoices WHERE file_path = ?) +
+		(SELECT COUNT(*) FROM invoice_attachments WHERE file_path = ?)`, storedPath, storedPath, storedPath).
+		Scan(&refs).Error; err != nil {
+		return false, err
+	}
+	return refs > 0, nil
+}
+
+// removeUnreferencedFile deletes a stored upload unless another record still points at it.
+func removeUnreferencedFile(db *gorm.DB, uploadsDir string, storedPath string) {
+	storedPath = strings.TrimSpace(storedPath)
+	if storedPath == "" {
+		return
+	}
+	if referenced, err := storedFileReferenced(db, storedPath); err != nil {
+		log.Printf("[FileCleanup] 检查文件引用失败 path=%s err=%v", storedPath, err)
+		return
+	} else if referenced {
+		return
+	}
+	if _, err := removeStoredFile(uploadsDir, storedPath); err != nil {
+		log.Printf("[FileCleanup] 删除文件失败 path=%s err=%v", storedPath, err)
+	}
+}
+
 func removeStoredFile(uploadsDir string, storedPath string) (bool, error) {
 	p := strings.TrimSpace(storedPath)
 	if p == "" {
@@ -176,7 +176,7 @@ func countInvoiceAttachments(bs *imap.BodyStructure) (hasAttachment int, attachm
 
 		// Fallback: some servers omit filename/disposition; treat obvious invoice formats as attachments.
 		if !isAttachment {
-			if mime == "application/pdf" || strings.Contains(mime, "xml") {
+			if mime == "application/pdf" || mime == "application/ofd" || strings.Contains(mime, "xml") {
 				isAttachment = true
 			}
 		}
@@ -1328,7 +1328,7 @@ func (s *EmailService) processMessage(ownerUserID string, configID string, msg *
 		switch h := p.Header.(type) {
 		case *mail.AttachmentHeader:
 			filename, _ := h.Filename()
-			if strings.HasSuffix(strings.ToLower(filename), ".pdf") {
+			if strings.HasSuffix(strings.ToLower(filename), ".pdf") || isOFDFilename(filename) {
 				content, err := readWithLimit(p.Body, emailParseMaxPDFBytes)
 				if err != nil {
 					log.Printf("[Email Monitor] Error reading attachment: %v", err)
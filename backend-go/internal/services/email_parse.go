@@ -130,6 +130,19 @@ func isXMLEmailHeader(h emailHeaderLike) (isXML bool, filename string) {
 	return false, filename
 }
 
+func isOFDEmailHeader(h emailHeaderLike) (isOFD bool, filename string) {
+	if h == nil {
+		return false, ""
+	}
+	ct, _, _ := h.ContentType()
+	ct = strings.ToLower(strings.TrimSpace(ct))
+	filename = strings.TrimSpace(extractFilenameFromEmailHeader(h))
+	if ct == "application/ofd" || ct == "application/x-ofd" {
+		return true, filename
+	}
+	return isOFDFilename(filename), filename
+}
+
 type emailBinaryAttachment struct {
 	Filename string
 	Bytes    []byte
@@ -272,6 +285,7 @@ func extractInvoiceArtifactsFromEmail(mr *mail.Reader) (pdfFilename string, pdfB
 
 	textParts := make([]string, 0, 8)
 	pdfParts := make([]emailBinaryAttachment, 0, 4)
+	ofdParts := make([]emailBinaryAttachment, 0, 2)
 
 	for {
 		part, err := mr.NextPart()
@@ -357,6 +371,23 @@ func extractInvoiceArtifactsFromEmail(mr *mail.Reader) (pdfFilename string, pdfB
 				pdfParts = append(pdfParts, emailBinaryAttachment{Filename: filename, Bytes: b})
 				continue
 			}
+			if ok, hinted := isOFDEmailHeader(hl); ok {
+				if emailParseMaxPDFAttachmentsToProcess > 0 && len(ofdParts) >= emailParseMaxPDFAttachmentsToProcess {
+					continue
+				}
+				filename := bestEmailPartFilename(part.Header, hinted)
+				if strings.TrimSpace(filename) == "" {
+					filename = "invoice.ofd"
+				} else if !isOFDFilename(filename) {
+					filename += ".ofd"
+				}
+				b, err := readWithLimit(part.Body, emailParseMaxPDFBytes)
+				if err != nil {
+					return "", nil, nil, nil, "", err
+				}
+				ofdParts = append(ofdParts, emailBinaryAttachment{Filename: filename, Bytes: b})
+				continue
+			}
 			if xmlBytes == nil {
 				if ok, hinted := isXMLEmailHeader(hl); ok {
 					filename := bestEmailPartFilename(part.Header, hinted)
@@ -404,6 +435,11 @@ func extractInvoiceArtifactsFromEmail(mr *mail.Reader) (pdfFilename string, pdfB
 		}
 	}
 
+	// Issuers commonly attach one invoice as PDF + OFD (+ XML); keep the PDF and only fall back to OFD when no PDF was sent.
+	if len(pdfParts) == 0 {
+		pdfParts = ofdParts
+	}
+
 	// Choose the best PDF as the primary invoice PDF; keep other PDFs for optional extra parsing.
 	if len(pdfParts) > 0 {
 		bestIdx := 0
@@ -941,7 +977,7 @@ func (s *EmailService) ParseEmailLogCtx(ctx context.Context, ownerUserID string,
 			if name == "" {
 				name = "attachment.pdf"
 			}
-			if !strings.HasSuffix(strings.ToLower(name), ".pdf") {
+			if !strings.HasSuffix(strings.ToLower(name), ".pdf") && !isOFDFilename(name) {
 				name += ".pdf"
 			}
 
@@ -1054,7 +1090,7 @@ func (s *EmailService) savePDFToUploads(ownerUserID string, originalName string,
 	if name == "" {
 		name = "invoice.pdf"
 	}
-	if !strings.HasSuffix(strings.ToLower(name), ".pdf") {
+	if !strings.HasSuffix(strings.ToLower(name), ".pdf") && !isOFDFilename(name) {
 		name += ".pdf"
 	}
 	filename = fmt.Sprintf("%d_%s", time.Now().UnixNano(), sanitizeFilename(name))
@@ -1418,6 +1454,8 @@ func parseInvoiceXMLToExtracted(xmlBytes []byte) (*InvoiceExtractedData, error)
 	invDate := first("kprq", "invoice_date", "invoicedate", "issuetime", "requesttime", "date")
 	seller := first("xfmc", "seller_name", "sellername", "xfname", "seller", "sellername")
 	buyer := first("gfmc", "buyer_name", "buyername", "gfname", "buyer", "buyername")
+	sellerTaxID := first("xfsbh", "xsfnsrsbh", "sellertaxid", "selleridnum")
+	buyerTaxID := first("gfsbh", "gmfnsrsbh", "buyertaxid", "buyeridnum")
 
 	// Prefer tax-included total (价税合计) when available.
 	amountStr := first("totaltax-includedamount", "totaltaxincludedamount", "jshj", "total", "total_amount", "totalamount", "amount", "je", "amt", "hjje")
@@ -1462,10 +1500,34 @@ func parseInvoiceXMLToExtracted(xmlBytes []byte) (*InvoiceExtractedData, error)
 		BuyerName:               ptrString(buyer),
 		BuyerNameSource:         "xml",
 		BuyerNameConfidence:     1,
+		BuyerTaxID:              ptrString(buyerTaxID),
+		SellerTaxID:             ptrString(sellerTaxID),
+		InvoiceType:             classifyInvoiceXMLType(values),
 		Items:                   items,
 		RawText:                 "",
 	}
 
+	if extracted.InvoiceType == InvoiceTypeRailwayTicket {
+		if seg := parseRailwayTicketXMLJourney(values); seg != nil {
+			extracted.Journeys = []JourneySegment{*seg}
+		}
+	}
+	if extracted.InvoiceType == InvoiceTypeAirItinerary {
+		segs, details := parseAirItineraryXML(values)
+		if details == nil {
+			details = &InvoiceTypeDetails{}
+		}
+		details.Total = amount
+		for i := range segs {
+			segs[i].Passenger = strPtrVal(details.Passenger)
+			segs[i].TicketNumber = strPtrVal(details.TicketNumber)
+		}
+		extracted.Journeys = segs
+		if *details != (InvoiceTypeDetails{}) {
+			extracted.TypeDetails = details
+		}
+	}
+
 	if extracted.InvoiceNumber == nil && extracted.InvoiceDate == nil && extracted.Amount == nil && len(extracted.Items) == 0 {
 		return nil, fmt.Errorf("no invoice fields found in xml")
 	}
@@ -1520,11 +1582,32 @@ func buildInvoiceItems(values map[string][]string) []InvoiceLineItem {
 	if len(qtys) == 0 {
 		qtys = get("quantity")
 	}
+	firstOf := func(keys ...string) []string {
+		for _, k := range keys {
+			if v := get(k); len(v) > 0 {
+				return v
+			}
+		}
+		return nil
+	}
+	prices := firstOf("spdj", "xmdj", "dj", "unprice")
+	amounts := firstOf("xmje", "je", "amount")
+	rates := firstOf("sl", "taxrate")
+	taxes := firstOf("se", "comtaxam")
 
 	n := len(names)
 	if n == 0 {
 		return nil
 	}
+	// Money columns share tag names with header totals in some layouts; only trust them when
+	// there is exactly one value per item.
+	perItem := func(col []string) []string {
+		if len(col) != n {
+			return nil
+		}
+		return col
+	}
+	prices, amounts, rates, taxes = perItem(prices), perItem(amounts), perItem(rates), perItem(taxes)
 	items := make([]InvoiceLineItem, 0, n)
 	for i := 0; i < n; i++ {
 		name := strings.TrimSpace(names[i])
@@ -1543,6 +1626,18 @@ func buildInvoiceItems(values map[string][]string) []InvoiceLineItem {
 				item.Quantity = q
 			}
 		}
+		if i < len(prices) {
+			item.UnitPrice = parseAmountLoose(prices[i])
+		}
+		if i < len(amounts) {
+			item.Amount = parseAmountLoose(amounts[i])
+		}
+		if i < len(rates) {
+			item.TaxRate = parseInvoiceTaxRate(rates[i])
+		}
+		if i < len(taxes) {
+			item.TaxAmount = parseAmountLoose(taxes[i])
+		}
 		items = append(items, item)
 	}
 	return items
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/money"
+	"smart-bill-manager/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrExchangeRateNotFound = errors.New("exchange rate not found")
+	ErrInvalidExchangeCSV   = errors.New("unsupported exchange rate csv")
+)
+
+type ExchangeRateService struct {
+	db *gorm.DB
+}
+
+func NewExchangeRateService(db *gorm.DB) *ExchangeRateService {
+	return &ExchangeRateService{db: db}
+}
+
+type ExchangeRateImportResult struct {
+	Imported int                      `json:"imported"`
+	Invalid  []ExchangeRateImportLine `json:"invalid,omitempty"`
+}
+
+type ExchangeRateImportLine struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+var exchangeCSVColumns = map[string][]string{
+	"date":     {"date", "日期"},
+	"currency": {"currency", "币种", "货币"},
+	"rate":     {"rate", "汇率", "中间价"},
+	"unit":     {"unit", "单位"},
+}
+
+// ImportCSV upserts rates from a CSV with date, currency and rate columns (rate = CNY per unit;
+// an optional unit column handles quotes per 100 JPY). Existing (currency, date) rows are replaced.
+func (s *ExchangeRateService) ImportCSV(ownerUserID string, raw []byte) (*ExchangeRateImportResult, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	text, err := decodeImportText(raw)
+	if err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExchangeCSV, err)
+	}
+	columns := map[string]int{}
+	for field, names := range exchangeCSVColumns {
+		columns[field] = -1
+		for i, h := range header {
+			for _, name := range names {
+				if strings.EqualFold(strings.TrimSpace(h), name) {
+					columns[field] = i
+				}
+			}
+		}
+	}
+	if columns["date"] < 0 || columns["currency"] < 0 || columns["rate"] < 0 {
+		return nil, ErrInvalidExchangeCSV
+	}
+
+	out := &ExchangeRateImportResult{}
+	var rows []models.ExchangeRate
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidExchangeCSV, err)
+		}
+		line, _ := reader.FieldPos(0)
+		get := func(field string) string {
+			i := columns[field]
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		day, err := parsePaymentTimeToUTC(get("date"), time.UTC)
+		if err != nil {
+			out.Invalid = append(out.Invalid, ExchangeRateImportLine{Line: line, Reason: "invalid date"})
+			continue
+		}
+		currency, err := money.NormalizeCurrency(get("currency"))
+		if err != nil || get("currency") == "" {
+			out.Invalid = append(out.Invalid, ExchangeRateImportLine{Line: line, Reason: "invalid currency"})
+			continue
+		}
+		rate, err := strconv.ParseFloat(strings.ReplaceAll(get("rate"), ",", ""), 64)
+		if err != nil || rate <= 0 {
+			out.Invalid = append(out.Invalid, ExchangeRateImportLine{Line: line, Reason: "invalid rate"})
+			continue
+		}
+		if v := get("unit"); v != "" {
+			unit, err := strconv.ParseFloat(v, 64)
+			if err != nil || unit <= 0 {
+				out.Invalid = append(out.Invalid, ExchangeRateImportLine{Line: line, Reason: "invalid unit"})
+				continue
+			}
+			rate /= unit
+		}
+		rows = append(rows, models.ExchangeRate{
+			ID:          utils.GenerateUUID(),
+			OwnerUserID: ownerUserID,
+			Currency:    currency,
+			Date:        day.Format("2006-01-02"),
+			Rate:        rate,
+			Source:      "csv",
+		})
+	}
+
+	if len(rows) > 0 {
+		if err := s.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "owner_user_id"}, {Name: "currency"}, {Name: "date"}},
+			DoUpdates: clause.AssignmentColumns([]string{"rate", "source", "updated_at"}),
+		}).CreateInBatches(rows, 200).Error; err != nil {
+			return nil, err
+		}
+	}
+	out.Imported = len(rows)
+	return out, nil
+}
+
+func (s *ExchangeRateService) ListCtx(ctx context.Context, ownerUserID string, currency string, limit int) ([]models.ExchangeRate, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if limit <= 0 || limit > 1000 {
+		limit = 200
+	}
+	q := s.db.WithContext(ctx).Where("owner_user_id = ?", strings.TrimSpace(ownerUserID))
+	if currency = strings.TrimSpace(currency); currency != "" {
+		normalized, err := money.NormalizeCurrency(currency)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Where("currency = ?", normalized)
+	}
+	var out []models.ExchangeRate
+	err := q.Order("date DESC, currency ASC").Limit(limit).Find(&out).Error
+	return out, err
+}
+
+func (s *ExchangeRateService) Delete(ownerUserID string, id string) error {
+	res := s.db.Where("id = ? AND owner_user_id = ?", strings.TrimSpace(id), strings.TrimSpace(ownerUserID)).
+		Delete(&models.ExchangeRate{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrExchangeRateNotFound
+	}
+	return nil
+}
+
+func (s *ExchangeRateService) GetBaseCurrencyCtx(ctx context.Context, ownerUserID string) (string, error) {
+	return loadBaseCurrency(ctx, s.db, ownerUserID)
+}
+
+func (s *ExchangeRateService) SetBaseCurrency(ownerUserID string, currency string) (string, error) {
+	normalized, err := money.NormalizeCurrency(currency)
+	if err != nil {
+		return "", err
+	}
+	res := s.db.Model(&models.User{}).Where("id = ?", strings.TrimSpace(ownerUserID)).Update("base_currency", normalized)
+	if res.Error != nil {
+		return "", res.Error
+	}
+	if res.RowsAffected == 0 {
+		return "", ErrNotFound
+	}
+	return normalized, nil
+}
+
+func loadBaseCurrency(ctx context.Context, db *gorm.DB, ownerUserID string) (string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var users []models.User
+	if err := db.WithContext(ctx).Select("id", "base_currency").
+		Where("id = ?", strings.TrimSpace(ownerUserID)).
+		Limit(1).
+		Find(&users).Error; err != nil {
+		return "", err
+	}
+	if len(users) == 0 || strings.TrimSpace(users[0].BaseCurrency) == "" {
+		return money.DefaultCurrency, nil
+	}
+	return users[0].BaseCurrency, nil
+}
+
+// currencyConverter converts amounts between currencies using one owner's rate table, all rates
+// being quoted in CNY. The rate for a day is the latest one on or before it, falling back to the
+// earliest later rate when the table starts after the transaction.
+type currencyConverter struct {
+	base  string
+	rates map[string][]models.ExchangeRate // ascending by date
+}
+
+func newCurrencyConverter(ctx context.Context, db *gorm.DB, ownerUserID string) (*currencyConverter, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	base, err := loadBaseCurrency(ctx, db, ownerUserID)
+	if err != nil {
+		return nil, err
+	}
+	var rows []models.ExchangeRate
+	if err := db.WithContext(ctx).
+		Select("currency", "date", "rate").
+		Where("owner_user_id = ?", strings.TrimSpace(ownerUserID)).
+		Order("currency ASC, date ASC").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	c := &currencyConverter{base: base, rates: make(map[string][]models.ExchangeRate)}
+	for _, row := range rows {
+		c.rates[row.Currency] = append(c.rates[row.Currency], row)
+	}
+	return c, nil
+}
+
+func (c *currencyConverter) rateToCNY(currency string, day string) (float64, bool) {
+	if currency == money.DefaultCurrency {
+		return 1, true
+	}
+	rows := c.rates[currency]
+	if len(rows) == 0 {
+		return 0, false
+	}
+	i := sort.Search(len(rows), func(i int) bool { return rows[i].Date > day })
+	if i == 0 {
+		return rows[0].Rate, true
+	}
+	return rows[i-1].Rate, true
+}
+
+// convert changes cents from one currency to another as of day (YYYY-MM-DD).
+func (c *currencyConverter) convert(cents int64, from string, to string, day string) (int64, bool) {
+	from = normalizeCurrencyOrDefault(from)
+	to = normalizeCurrencyOrDefault(to)
+	if from == to || cents == 0 {
+		return cents, true
+	}
+	fromRate, ok := c.rateToCNY(from, day)
+	if !ok {
+		return 0, false
+	}
+	toRate, ok := c.rateToCNY(to, day)
+	if !ok {
+		return 0, false
+	}
+	out, err := money.ConvertCents(cents, fromRate/toRate)
+	if err != nil {
+		return 0, false
+	}
+	return out, true
+}
+
+// toBase matches repository.CentsConverter.
+func (c *currencyConverter) toBase(cents int64, currency string, day string) (int64, bool) {
+	return c.convert(cents, currency, c.base, day)
+}
+
+func normalizeCurrencyOrDefault(code string) string {
+	normalized, err := money.NormalizeCurrency(code)
+	if err != nil {
+		return strings.ToUpper(strings.TrimSpace(code))
+	}
+	return normalized
+}
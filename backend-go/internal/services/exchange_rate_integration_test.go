@@ -0,0 +1,108 @@
+//go:build cgo
+
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"smart-bill-manager/internal/models"
+)
+
+func TestStatsConvertForeignPaymentsAtTransactionDateRate(t *testing.T) {
+	db := openServiceTestDB(t)
+	if err := db.Create(&models.User{ID: "owner-1", Username: "alice", Password: "x"}).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	rates := NewExchangeRateService(db)
+	payments := NewPaymentService(db, t.TempDir())
+	trips := NewTripService(db, t.TempDir())
+
+	result, err := rates.ImportCSV("owner-1", []byte("日期,币种,汇率,单位\n2026-08-01,USD,7.10,\n2026-08-02,USD,7.20,\n2026-08-01,JPY,4.80,100\nbad,USD,7,\n"))
+	if err != nil {
+		t.Fatalf("导入汇率失败: %v", err)
+	}
+	if result.Imported != 3 || len(result.Invalid) != 1 {
+		t.Fatalf("汇率导入结果异常: %#v", result)
+	}
+	// Re-importing the same day replaces the rate instead of failing.
+	if _, err := rates.ImportCSV("owner-1", []byte("date,currency,rate\n2026-08-02,USD,7.00\n")); err != nil {
+		t.Fatalf("覆盖导入汇率失败: %v", err)
+	}
+
+	trip, _, err := trips.Create("owner-1", CreateTripInput{
+		Name:      "纽约出差",
+		StartTime: "2026-08-01T00:00:00+08:00",
+		EndTime:   "2026-08-03T00:00:00+08:00",
+	})
+	if err != nil {
+		t.Fatalf("创建行程失败: %v", err)
+	}
+	usd, eur := "usd", "EUR"
+	for _, input := range []CreatePaymentInput{
+		{Amount: 100, TransactionTime: "2026-08-01T10:00:00Z"},
+		{Amount: 10, Currency: &usd, TransactionTime: "2026-08-01T11:00:00Z"},
+		{Amount: 10, Currency: &usd, TransactionTime: "2026-08-02T11:00:00Z"},
+		{Amount: 5, Currency: &eur, TransactionTime: "2026-08-02T12:00:00Z"},
+	} {
+		p, err := payments.Create("owner-1", input)
+		if err != nil {
+			t.Fatalf("创建支付失败: %v", err)
+		}
+		if err := db.Model(&models.Payment{}).Where("id = ?", p.ID).Update("trip_id", trip.ID).Error; err != nil {
+			t.Fatalf("关联行程失败: %v", err)
+		}
+	}
+
+	stats, err := payments.GetStatsCtx(context.Background(), "owner-1", "", "")
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+	// 100 + 10*7.10 + 10*7.00; the EUR payment has no rate and is reported instead.
+	if stats.BaseCurrency != "CNY" || stats.TotalAmount != 241 || stats.TotalCount != 4 {
+		t.Fatalf("人民币统计异常: %#v", stats)
+	}
+	if !reflect.DeepEqual(stats.MissingRateCurrencies, []string{"EUR"}) {
+		t.Fatalf("缺失汇率币种异常: %#v", stats.MissingRateCurrencies)
+	}
+	if stats.DailyStats["2026-08-02"] != 70 {
+		t.Fatalf("按日统计应使用当日汇率: %#v", stats.DailyStats)
+	}
+
+	if _, err := rates.SetBaseCurrency("owner-1", "USD"); err != nil {
+		t.Fatalf("设置本位币失败: %v", err)
+	}
+	summary, err := trips.GetSummaryCtx(context.Background(), "owner-1", trip.ID)
+	if err != nil {
+		t.Fatalf("行程汇总失败: %v", err)
+	}
+	// 100 CNY at 7.10 = 14.08 USD, plus the two USD payments.
+	if summary.Currency != "USD" || summary.TotalAmount != 34.08 || summary.PaymentCount != 4 {
+		t.Fatalf("行程汇总换算异常: %#v", summary)
+	}
+	all, err := trips.GetAllSummariesCtx(context.Background(), "owner-1")
+	if err != nil {
+		t.Fatalf("行程列表汇总失败: %v", err)
+	}
+	if len(all) != 1 || all[0].TotalAmount != summary.TotalAmount || !reflect.DeepEqual(all[0].MissingRateCurrencies, []string{"EUR"}) {
+		t.Fatalf("行程列表汇总异常: %#v", all)
+	}
+}
+
+func TestDailyStatsUseShanghaiDate(t *testing.T) {
+	db := openServiceTestDB(t)
+	payments := NewPaymentService(db, t.TempDir())
+
+	// 2025-10-21 01:00 in Asia/Shanghai.
+	if _, err := payments.Create("owner-1", CreatePaymentInput{Amount: 100, TransactionTime: "2025-10-20T17:00:00Z"}); err != nil {
+		t.Fatalf("创建支付失败: %v", err)
+	}
+	stats, err := payments.GetStatsCtx(context.Background(), "owner-1", "", "")
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+	if stats.DailyStats["2025-10-21"] != 100 || len(stats.DailyStats) != 1 {
+		t.Fatalf("按日统计应使用北京时间日期: %#v", stats.DailyStats)
+	}
+}
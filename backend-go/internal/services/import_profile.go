@@ -0,0 +1,218 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ImportAmountSignExpenseNegative = "expense_negative"
+	ImportAmountSignExpensePositive = "expense_positive"
+	ImportAmountSignAbsolute        = "absolute"
+	ImportAmountSignDirection       = "direction"
+)
+
+var ErrImportProfileNotFound = errors.New("import profile not found")
+
+type ImportProfileService struct {
+	db *gorm.DB
+}
+
+func NewImportProfileService(db *gorm.DB) *ImportProfileService {
+	return &ImportProfileService{db: db}
+}
+
+type ImportProfileInput struct {
+	Name                string `json:"name" binding:"required"`
+	Encoding            string `json:"encoding"`
+	Delimiter           string `json:"delimiter"`
+	SkipRows            int    `json:"skip_rows"`
+	HasHeader           *bool  `json:"has_header"`
+	AmountColumn        string `json:"amount_column" binding:"required"`
+	TimeColumn          string `json:"time_column" binding:"required"`
+	MerchantColumn      string `json:"merchant_column"`
+	CategoryColumn      string `json:"category_column"`
+	NoteColumn          string `json:"note_column"`
+	PaymentMethodColumn string `json:"payment_method_column"`
+	ExternalIDColumn    string `json:"external_id_column"`
+	DirectionColumn     string `json:"direction_column"`
+	ExpenseMarker       string `json:"expense_marker"`
+	DateFormat          string `json:"date_format"`
+	Timezone            string `json:"timezone"`
+	DecimalSeparator    string `json:"decimal_separator"`
+	AmountSign          string `json:"amount_sign"`
+}
+
+// applyTo validates the input and copies it onto profile, filling defaults.
+func (input ImportProfileInput) applyTo(profile *models.ImportProfile) error {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if strings.TrimSpace(input.AmountColumn) == "" || strings.TrimSpace(input.TimeColumn) == "" {
+		return fmt.Errorf("amount_column and time_column are required")
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(input.Encoding))
+	switch encoding {
+	case "":
+		encoding = "auto"
+	case "auto", "utf-8", "gbk":
+	case "utf8":
+		encoding = "utf-8"
+	case "gb2312", "gb18030":
+		encoding = "gbk"
+	default:
+		return fmt.Errorf("invalid encoding")
+	}
+
+	delimiter := input.Delimiter
+	if delimiter == "" {
+		delimiter = ","
+	}
+	if delimiter == `\t` {
+		delimiter = "\t"
+	}
+	if utf8.RuneCountInString(delimiter) != 1 || delimiter == `"` || delimiter == "\n" || delimiter == "\r" {
+		return fmt.Errorf("delimiter must be a single character")
+	}
+	if input.SkipRows < 0 {
+		return fmt.Errorf("skip_rows must not be negative")
+	}
+
+	decimal := strings.TrimSpace(input.DecimalSeparator)
+	if decimal == "" {
+		decimal = "."
+	}
+	if decimal != "." && decimal != "," {
+		return fmt.Errorf("invalid decimal_separator")
+	}
+
+	sign := strings.TrimSpace(input.AmountSign)
+	switch sign {
+	case "":
+		sign = ImportAmountSignExpenseNegative
+	case ImportAmountSignExpenseNegative, ImportAmountSignExpensePositive, ImportAmountSignAbsolute:
+	case ImportAmountSignDirection:
+		if strings.TrimSpace(input.DirectionColumn) == "" || strings.TrimSpace(input.ExpenseMarker) == "" {
+			return fmt.Errorf("direction sign requires direction_column and expense_marker")
+		}
+	default:
+		return fmt.Errorf("invalid amount_sign")
+	}
+
+	timezone := strings.TrimSpace(input.Timezone)
+	if timezone == "" {
+		timezone = "Asia/Shanghai"
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("invalid timezone: %w", err)
+	}
+
+	dateFormat := strings.TrimSpace(input.DateFormat)
+	if dateFormat != "" && importDateLayout(dateFormat) == "" {
+		return fmt.Errorf("invalid date_format")
+	}
+
+	hasHeader := true
+	if input.HasHeader != nil {
+		hasHeader = *input.HasHeader
+	}
+
+	profile.Name = name
+	profile.Encoding = encoding
+	profile.Delimiter = delimiter
+	profile.SkipRows = input.SkipRows
+	profile.HasHeader = hasHeader
+	profile.AmountColumn = strings.TrimSpace(input.AmountColumn)
+	profile.TimeColumn = strings.TrimSpace(input.TimeColumn)
+	profile.MerchantColumn = strings.TrimSpace(input.MerchantColumn)
+	profile.CategoryColumn = strings.TrimSpace(input.CategoryColumn)
+	profile.NoteColumn = strings.TrimSpace(input.NoteColumn)
+	profile.PaymentMethodColumn = strings.TrimSpace(input.PaymentMethodColumn)
+	profile.ExternalIDColumn = strings.TrimSpace(input.ExternalIDColumn)
+	profile.DirectionColumn = strings.TrimSpace(input.DirectionColumn)
+	profile.ExpenseMarker = strings.TrimSpace(input.ExpenseMarker)
+	profile.DateFormat = dateFormat
+	profile.Timezone = timezone
+	profile.DecimalSeparator = decimal
+	profile.AmountSign = sign
+	return nil
+}
+
+func (s *ImportProfileService) Create(ownerUserID string, input ImportProfileInput) (*models.ImportProfile, error) {
+	profile := &models.ImportProfile{
+		ID:          utils.GenerateUUID(),
+		OwnerUserID: strings.TrimSpace(ownerUserID),
+	}
+	if err := input.applyTo(profile); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(profile).Error; err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func (s *ImportProfileService) List(ownerUserID string) ([]models.ImportProfile, error) {
+	var out []models.ImportProfile
+	err := s.db.Where("owner_user_id = ?", strings.TrimSpace(ownerUserID)).
+		Order("name ASC, created_at ASC").
+		Find(&out).Error
+	return out, err
+}
+
+func (s *ImportProfileService) GetByID(ownerUserID string, id string) (*models.ImportProfile, error) {
+	return findImportProfileForOwner(s.db, ownerUserID, id)
+}
+
+func (s *ImportProfileService) Update(ownerUserID string, id string, input ImportProfileInput) (*models.ImportProfile, error) {
+	profile, err := findImportProfileForOwner(s.db, ownerUserID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := input.applyTo(profile); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(profile).Error; err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// Delete removes the profile only; payments already imported with it are kept.
+func (s *ImportProfileService) Delete(ownerUserID string, id string) error {
+	res := s.db.Where("id = ? AND owner_user_id = ?", strings.TrimSpace(id), strings.TrimSpace(ownerUserID)).
+		Delete(&models.ImportProfile{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrImportProfileNotFound
+	}
+	return nil
+}
+
+func findImportProfileForOwner(db *gorm.DB, ownerUserID string, id string) (*models.ImportProfile, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, ErrImportProfileNotFound
+	}
+	var profile models.ImportProfile
+	if err := db.Where("id = ? AND owner_user_id = ?", id, ownerUserID).First(&profile).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImportProfileNotFound
+		}
+		return nil, err
+	}
+	return &profile, nil
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/money"
 	"smart-bill-manager/internal/repository"
 	"smart-bill-manager/internal/utils"
 
@@ -17,22 +18,28 @@ import (
 )
 
 type InvoiceService struct {
-	db         *gorm.DB
-	repo       *repository.InvoiceRepository
-	blobRepo   *repository.OCRBlobRepository
-	attachRepo *repository.InvoiceAttachmentRepository
-	ocrService *OCRService
-	uploadsDir string
+	db           *gorm.DB
+	repo         *repository.InvoiceRepository
+	blobRepo     *repository.OCRBlobRepository
+	attachRepo   *repository.InvoiceAttachmentRepository
+	lineItemRepo *repository.InvoiceLineItemRepository
+	journeyRepo  *repository.JourneySegmentRepository
+	rideRepo     *repository.InvoiceRideRepository
+	ocrService   *OCRService
+	uploadsDir   string
 }
 
 func NewInvoiceService(db *gorm.DB, uploadsDir string) *InvoiceService {
 	return &InvoiceService{
-		db:         db,
-		repo:       repository.NewInvoiceRepository(db),
-		blobRepo:   repository.NewOCRBlobRepository(db),
-		attachRepo: repository.NewInvoiceAttachmentRepository(db),
-		ocrService: NewOCRService(),
-		uploadsDir: uploadsDir,
+		db:           db,
+		repo:         repository.NewInvoiceRepository(db),
+		blobRepo:     repository.NewOCRBlobRepository(db),
+		attachRepo:   repository.NewInvoiceAttachmentRepository(db),
+		lineItemRepo: repository.NewInvoiceLineItemRepository(db),
+		journeyRepo:  repository.NewJourneySegmentRepository(db),
+		rideRepo:     repository.NewInvoiceRideRepository(db),
+		ocrService:   NewOCRService(),
+		uploadsDir:   uploadsDir,
 	}
 }
 
@@ -58,19 +65,20 @@ func (s *InvoiceService) CreateDraftFromUpload(ownerUserID string, input CreateI
 	}
 
 	inv := &models.Invoice{
-		ID:           id,
-		OwnerUserID:  ownerUserID,
-		IsDraft:      true,
-		PaymentID:    input.PaymentID,
-		Filename:     input.Filename,
-		OriginalName: input.OriginalName,
-		FilePath:     input.FilePath,
-		FileSize:     &input.FileSize,
-		FileSHA256:   input.FileSHA256,
-		ParseStatus:  "pending",
-		ParseError:   nil,
-		Source:       source,
-		DedupStatus:  DedupStatusOK,
+		ID:             id,
+		OwnerUserID:    ownerUserID,
+		IsDraft:        true,
+		PaymentID:      input.PaymentID,
+		Filename:       input.Filename,
+		OriginalName:   input.OriginalName,
+		FilePath:       input.FilePath,
+		FileSize:       &input.FileSize,
+		FileSHA256:     input.FileSHA256,
+		PerceptualHash: computeStoredFilePerceptualHash(s.uploadsDir, input.FilePath),
+		ParseStatus:    "pending",
+		ParseError:     nil,
+		Source:         source,
+		DedupStatus:    DedupStatusOK,
 	}
 
 	db := s.db
@@ -122,10 +130,11 @@ func (s *InvoiceService) UpdateDraftFileMeta(ownerUserID string, invoiceID strin
 	}
 
 	update := map[string]any{
-		"filename":      filename,
-		"original_name": originalName,
-		"file_path":     filePath,
-		"file_size":     fileSize,
+		"filename":        filename,
+		"original_name":   originalName,
+		"file_path":       filePath,
+		"file_size":       fileSize,
+		"perceptual_hash": computeStoredFilePerceptualHash(s.uploadsDir, filePath),
 	}
 
 	if fileSHA256 != nil {
@@ -171,6 +180,7 @@ func (s *InvoiceService) ProcessInvoiceOCRTask(invoiceID string) (any, error) {
 		amount, taxAmount,
 		extractedData, rawText,
 		parseStatus, parseError := s.parseInvoiceFile(filePath, inv.Filename)
+	buyerName, extractedData = s.pickBuyerFromProfilesJSON(inv.OwnerUserID, buyerName, extractedData)
 
 	updateData := map[string]any{
 		"parse_status": parseStatus,
@@ -223,7 +233,7 @@ func (s *InvoiceService) ProcessInvoiceOCRTask(invoiceID string) (any, error) {
 			return err
 		}
 		// Store OCR blobs outside the invoices table to keep it slim.
-		return s.blobRepo.UpsertInvoiceBlob(tx, ownerUserID, inv.ID, extractedData, rawText)
+		return s.storeInvoiceBlobTx(tx, ownerUserID, inv.ID, extractedData, rawText)
 	}); err != nil {
 		return nil, err
 	}
@@ -242,39 +252,36 @@ func (s *InvoiceService) ProcessInvoiceOCRTask(invoiceID string) (any, error) {
 		updated.RawText = blob.RawText
 	}
 
-	// Mark suspected duplicates based on invoice_number.
-	if updated != nil && updated.InvoiceNumber != nil {
-		no := strings.TrimSpace(*updated.InvoiceNumber)
-		if no != "" {
-			cands, err := s.FindCandidatesByInvoiceNumberForOwner(strings.TrimSpace(updated.OwnerUserID), no, updated.ID, 5)
-			if err != nil {
+	// Mark suspected duplicates based on invoice_number, then on a near-identical first page.
+	if updated != nil && (strings.TrimSpace(strPtrVal(updated.InvoiceNumber)) != "" || updated.PerceptualHash != nil) {
+		reason, cands, err := s.FindSuspectedDuplicatesForOwner(strings.TrimSpace(updated.OwnerUserID), strPtrVal(updated.InvoiceNumber), updated.PerceptualHash, updated.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(cands) > 0 {
+			updated.DedupStatus = DedupStatusSuspected
+			ref := cands[0].ID
+			updated.DedupRefID = &ref
+			if err := s.db.Model(&models.Invoice{}).Where("id = ?", updated.ID).Updates(map[string]any{
+				"dedup_status": DedupStatusSuspected,
+				"dedup_ref_id": ref,
+			}).Error; err != nil {
 				return nil, err
 			}
-			if len(cands) > 0 {
-				updated.DedupStatus = DedupStatusSuspected
-				ref := cands[0].ID
-				updated.DedupRefID = &ref
-				if err := s.db.Model(&models.Invoice{}).Where("id = ?", updated.ID).Updates(map[string]any{
-					"dedup_status": DedupStatusSuspected,
-					"dedup_ref_id": ref,
-				}).Error; err != nil {
-					return nil, err
-				}
-				dedup = map[string]any{
-					"kind":       "suspected_duplicate",
-					"reason":     "invoice_number",
-					"candidates": cands,
-				}
-			} else {
-				if err := s.db.Model(&models.Invoice{}).Where("id = ?", updated.ID).Updates(map[string]any{
-					"dedup_status": DedupStatusOK,
-					"dedup_ref_id": nil,
-				}).Error; err != nil {
-					return nil, err
-				}
-				updated.DedupStatus = DedupStatusOK
-				updated.DedupRefID = nil
+			dedup = map[string]any{
+				"kind":       "suspected_duplicate",
+				"reason":     reason,
+				"candidates": cands,
+			}
+		} else {
+			if err := s.db.Model(&models.Invoice{}).Where("id = ?", updated.ID).Updates(map[string]any{
+				"dedup_status": DedupStatusOK,
+				"dedup_ref_id": nil,
+			}).Error; err != nil {
+				return nil, err
 			}
+			updated.DedupStatus = DedupStatusOK
+			updated.DedupRefID = nil
 		}
 	}
 
@@ -319,6 +326,7 @@ func (s *InvoiceService) Create(ownerUserID string, input CreateInvoiceInput) (*
 		amount, taxAmount,
 		extractedData, rawText,
 		parseStatus, parseError := s.parseInvoiceFile(filePath, input.Filename)
+	buyerName, extractedData = s.pickBuyerFromProfilesJSON(ownerUserID, buyerName, extractedData)
 
 	source := input.Source
 	if source == "" {
@@ -326,17 +334,18 @@ func (s *InvoiceService) Create(ownerUserID string, input CreateInvoiceInput) (*
 	}
 
 	invoice := &models.Invoice{
-		ID:            id,
-		OwnerUserID:   ownerUserID,
-		IsDraft:       input.IsDraft,
-		PaymentID:     input.PaymentID,
-		Filename:      input.Filename,
-		OriginalName:  input.OriginalName,
-		FilePath:      input.FilePath,
-		FileSize:      &input.FileSize,
-		FileSHA256:    input.FileSHA256,
-		InvoiceNumber: invoiceNumber,
-		InvoiceDate:   invoiceDate,
+		ID:             id,
+		OwnerUserID:    ownerUserID,
+		IsDraft:        input.IsDraft,
+		PaymentID:      input.PaymentID,
+		Filename:       input.Filename,
+		OriginalName:   input.OriginalName,
+		FilePath:       input.FilePath,
+		FileSize:       &input.FileSize,
+		FileSHA256:     input.FileSHA256,
+		PerceptualHash: computeStoredFilePerceptualHash(s.uploadsDir, input.FilePath),
+		InvoiceNumber:  invoiceNumber,
+		InvoiceDate:    invoiceDate,
 		InvoiceDateYMD: func() *string {
 			if invoiceDate == nil {
 				return nil
@@ -357,6 +366,7 @@ func (s *InvoiceService) Create(ownerUserID string, input CreateInvoiceInput) (*
 		Source:        source,
 		DedupStatus:   DedupStatusOK,
 	}
+	applyInvoiceExtracted(invoice, decodeInvoiceExtracted(extractedData), time.Now())
 
 	// Create invoice (and optional 1:1 payment link) atomically.
 	db := s.db
@@ -364,7 +374,7 @@ func (s *InvoiceService) Create(ownerUserID string, input CreateInvoiceInput) (*
 		if err := tx.Create(invoice).Error; err != nil {
 			return err
 		}
-		if err := s.blobRepo.UpsertInvoiceBlob(tx, ownerUserID, invoice.ID, extractedData, rawText); err != nil {
+		if err := s.storeInvoiceBlobTx(tx, ownerUserID, invoice.ID, extractedData, rawText); err != nil {
 			return err
 		}
 		if input.PaymentID != nil {
@@ -391,25 +401,22 @@ func (s *InvoiceService) Create(ownerUserID string, input CreateInvoiceInput) (*
 	invoice.ExtractedData = extractedData
 	invoice.RawText = rawText
 
-	// Mark suspected duplicates for UI/confirm step (invoice_number).
-	if invoice.InvoiceNumber != nil {
-		n := strings.TrimSpace(*invoice.InvoiceNumber)
-		if n != "" {
-			cands, err := s.FindCandidatesByInvoiceNumberForOwner(ownerUserID, n, invoice.ID, 5)
-			if err != nil {
+	// Mark suspected duplicates for UI/confirm step (invoice_number, then a near-identical first page).
+	if strings.TrimSpace(strPtrVal(invoice.InvoiceNumber)) != "" || invoice.PerceptualHash != nil {
+		_, cands, err := s.FindSuspectedDuplicatesForOwner(ownerUserID, strPtrVal(invoice.InvoiceNumber), invoice.PerceptualHash, invoice.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(cands) > 0 {
+			invoice.DedupStatus = DedupStatusSuspected
+			ref := cands[0].ID
+			invoice.DedupRefID = &ref
+			if err := db.Model(&models.Invoice{}).Where("id = ?", invoice.ID).Updates(map[string]interface{}{
+				"dedup_status": DedupStatusSuspected,
+				"dedup_ref_id": ref,
+			}).Error; err != nil {
 				return nil, err
 			}
-			if len(cands) > 0 {
-				invoice.DedupStatus = DedupStatusSuspected
-				ref := cands[0].ID
-				invoice.DedupRefID = &ref
-				if err := db.Model(&models.Invoice{}).Where("id = ?", invoice.ID).Updates(map[string]interface{}{
-					"dedup_status": DedupStatusSuspected,
-					"dedup_ref_id": ref,
-				}).Error; err != nil {
-					return nil, err
-				}
-			}
 		}
 	}
 
@@ -423,6 +430,14 @@ type InvoiceFilterInput struct {
 	StartDate    string `form:"startDate"`
 	EndDate      string `form:"endDate"`
 	IncludeDraft bool   `form:"includeDraft"`
+	// TagIDs keeps invoices carrying all of these tags (repeat tagIds=... in the query).
+	TagIDs []string `form:"tagIds"`
+	// HasWarnings keeps only invoices with consistency warnings.
+	HasWarnings bool `form:"hasWarnings"`
+	// InvoiceType keeps invoices of one type (see InvoiceTypes); "unknown" selects unclassified ones.
+	InvoiceType string `form:"invoiceType"`
+	// BuyerCheck keeps invoices with one buyer check result; "mismatch" selects every failed check.
+	BuyerCheck string `form:"buyerCheck"`
 }
 
 func (s *InvoiceService) GetAll(ownerUserID string, filter InvoiceFilterInput) ([]models.Invoice, error) {
@@ -432,6 +447,10 @@ func (s *InvoiceService) GetAll(ownerUserID string, filter InvoiceFilterInput) (
 		Offset:       filter.Offset,
 		StartDate:    strings.TrimSpace(filter.StartDate),
 		EndDate:      strings.TrimSpace(filter.EndDate),
+		TagIDs:       filter.TagIDs,
+		HasWarnings:  filter.HasWarnings,
+		InvoiceType:  strings.TrimSpace(filter.InvoiceType),
+		BuyerCheck:   strings.TrimSpace(filter.BuyerCheck),
 		IncludeDraft: filter.IncludeDraft,
 	})
 }
@@ -464,6 +483,8 @@ func (s *InvoiceService) ListCtx(ctx context.Context, ownerUserID string, filter
 		"original_name",
 		"file_path",
 		"file_size",
+		"invoice_type",
+		"type_details",
 		"invoice_number",
 		"invoice_date",
 		"amount",
@@ -477,10 +498,13 @@ func (s *InvoiceService) ListCtx(ctx context.Context, ownerUserID string, filter
 		"source",
 		"dedup_status",
 		"dedup_ref_id",
+		"warnings",
+		"warning_count",
+		"buyer_check",
 		"created_at",
 	}
 
-	return s.repo.FindAllPagedCtx(ctx, repository.InvoiceFilter{
+	invoices, total, err := s.repo.FindAllPagedCtx(ctx, repository.InvoiceFilter{
 		OwnerUserID:     strings.TrimSpace(ownerUserID),
 		Limit:           filter.Limit,
 		Offset:          filter.Offset,
@@ -488,8 +512,27 @@ func (s *InvoiceService) ListCtx(ctx context.Context, ownerUserID string, filter
 		BeforeID:        beforeID,
 		StartDate:       strings.TrimSpace(filter.StartDate),
 		EndDate:         strings.TrimSpace(filter.EndDate),
+		TagIDs:          filter.TagIDs,
+		HasWarnings:     filter.HasWarnings,
+		InvoiceType:     strings.TrimSpace(filter.InvoiceType),
+		BuyerCheck:      strings.TrimSpace(filter.BuyerCheck),
 		IncludeDraft:    filter.IncludeDraft,
 	}, selectCols)
+	if err != nil || len(invoices) == 0 {
+		return invoices, total, err
+	}
+	ids := make([]string, 0, len(invoices))
+	for _, inv := range invoices {
+		ids = append(ids, inv.ID)
+	}
+	tags, err := invoiceTagLink.load(s.db.WithContext(ctx), ownerUserID, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range invoices {
+		invoices[i].Tags = tags[invoices[i].ID]
+	}
+	return invoices, total, nil
 }
 
 func (s *InvoiceService) GetUnlinked(ownerUserID string, limit int, offset int) ([]models.Invoice, int64, error) {
@@ -519,6 +562,18 @@ func (s *InvoiceService) GetByIDCtx(ctx context.Context, ownerUserID string, id
 			inv.Attachments = rows
 		}
 	}
+	if rows, err := s.lineItemRepo.FindByInvoiceIDForOwnerCtx(ctx, strings.TrimSpace(ownerUserID), inv.ID); err == nil {
+		inv.LineItems = rows
+	}
+	if rows, err := s.journeyRepo.FindByInvoiceIDForOwnerCtx(ctx, strings.TrimSpace(ownerUserID), inv.ID); err == nil {
+		inv.Journeys = rows
+	}
+	if rows, err := s.rideRepo.FindByInvoiceIDForOwnerCtx(ctx, strings.TrimSpace(ownerUserID), inv.ID); err == nil {
+		inv.Rides = rows
+	}
+	if tags, err := invoiceTagLink.load(s.db.WithContext(ctx), ownerUserID, []string{inv.ID}); err == nil {
+		inv.Tags = tags[inv.ID]
+	}
 	return inv, nil
 }
 
@@ -536,11 +591,16 @@ type UpdateInvoiceInput struct {
 	InvoiceDate        *string  `json:"invoice_date"`
 	Amount             *float64 `json:"amount"`
 	TaxAmount          *float64 `json:"tax_amount"`
+	Currency           *string  `json:"currency"`
 	BadDebt            *bool    `json:"bad_debt"`
 	SellerName         *string  `json:"seller_name"`
 	BuyerName          *string  `json:"buyer_name"`
 	Confirm            *bool    `json:"confirm"`
 	ForceDuplicateSave *bool    `json:"force_duplicate_save"`
+	// BuyerTaxID and SellerTaxID replace the taxpayer numbers of the extraction result, e.g. when
+	// the user accepts the correction proposed by a tax_id_checksum warning.
+	BuyerTaxID  *string `json:"buyer_tax_id"`
+	SellerTaxID *string `json:"seller_tax_id"`
 }
 
 type CreateInvoiceAttachmentInput struct {
@@ -616,6 +676,9 @@ func (s *InvoiceService) CreateAttachmentCtx(ctx context.Context, ownerUserID st
 	if err := s.attachRepo.CreateCtx(ctx, a); err != nil {
 		return nil, err
 	}
+	if kind == "itinerary" {
+		s.parseItineraryAttachmentCtx(ctx, a)
+	}
 	return a, nil
 }
 
@@ -660,6 +723,17 @@ func (s *InvoiceService) DeleteAttachmentCtx(ctx context.Context, ownerUserID st
 	if _, err := s.attachRepo.DeleteByIDForOwnerCtx(ctx, ownerUserID, attachmentID); err != nil {
 		return err
 	}
+	if row.Kind == "itinerary" {
+		if err := s.journeyRepo.DeleteForAttachment(s.db.WithContext(ctx), ownerUserID, attachmentID); err != nil {
+			return err
+		}
+		if err := s.rideRepo.DeleteForAttachment(s.db.WithContext(ctx), ownerUserID, attachmentID); err != nil {
+			return err
+		}
+		if err := s.refreshInvoiceDerived(ownerUserID, invoiceID); err != nil {
+			log.Printf("[Itinerary] 刷新发票类型信息失败 invoice_id=%s err=%v", invoiceID, err)
+		}
+	}
 
 	p := strings.TrimSpace(row.FilePath)
 	if p != "" {
@@ -706,7 +780,7 @@ func (s *InvoiceService) Update(ownerUserID string, id string, input UpdateInvoi
 
 	// On confirm, enforce dedup rules:
 	// - hash duplicate: hard block (no override)
-	// - invoice_number duplicate: allow only with force_duplicate_save
+	// - invoice_number or near-identical first page: allow only with force_duplicate_save
 	var before *models.Invoice
 	if confirming {
 		inv, err := s.repo.FindByIDForOwner(ownerUserID, id)
@@ -741,18 +815,16 @@ func (s *InvoiceService) Update(ownerUserID string, id string, input UpdateInvoi
 		} else if inv.InvoiceNumber != nil {
 			nextNo = strings.TrimSpace(*inv.InvoiceNumber)
 		}
-		if nextNo != "" {
-			cands, err := s.FindCandidatesByInvoiceNumberForOwner(ownerUserID, nextNo, id, 5)
-			if err != nil {
-				return err
-			}
-			if len(cands) > 0 && !force {
-				return &DuplicateError{
-					Kind:       "suspected_duplicate",
-					Reason:     "invoice_number",
-					Entity:     "invoice",
-					Candidates: cands,
-				}
+		reason, cands, err := s.FindSuspectedDuplicatesForOwner(ownerUserID, nextNo, inv.PerceptualHash, id)
+		if err != nil {
+			return err
+		}
+		if len(cands) > 0 && !force {
+			return &DuplicateError{
+				Kind:       "suspected_duplicate",
+				Reason:     reason,
+				Entity:     "invoice",
+				Candidates: cands,
 			}
 		}
 	}
@@ -797,6 +869,13 @@ func (s *InvoiceService) Update(ownerUserID string, id string, input UpdateInvoi
 	if input.TaxAmount != nil {
 		data["tax_amount"] = *input.TaxAmount
 	}
+	if input.Currency != nil {
+		currency, err := money.NormalizeCurrency(*input.Currency)
+		if err != nil {
+			return err
+		}
+		data["currency"] = currency
+	}
 	if input.BadDebt != nil {
 		data["bad_debt"] = *input.BadDebt
 	}
@@ -820,18 +899,13 @@ func (s *InvoiceService) Update(ownerUserID string, id string, input UpdateInvoi
 		} else if before.InvoiceNumber != nil {
 			nextNo = strings.TrimSpace(*before.InvoiceNumber)
 		}
-		if nextNo != "" {
-			if cands, err := s.FindCandidatesByInvoiceNumberForOwner(ownerUserID, nextNo, id, 5); err == nil && len(cands) > 0 {
-				if force {
-					data["dedup_status"] = DedupStatusForced
-					data["dedup_ref_id"] = cands[0].ID
-				} else {
-					data["dedup_status"] = DedupStatusSuspected
-					data["dedup_ref_id"] = cands[0].ID
-				}
+		if _, cands, err := s.FindSuspectedDuplicatesForOwner(ownerUserID, nextNo, before.PerceptualHash, id); err == nil && len(cands) > 0 {
+			if force {
+				data["dedup_status"] = DedupStatusForced
+				data["dedup_ref_id"] = cands[0].ID
 			} else {
-				data["dedup_status"] = DedupStatusOK
-				data["dedup_ref_id"] = nil
+				data["dedup_status"] = DedupStatusSuspected
+				data["dedup_ref_id"] = cands[0].ID
 			}
 		} else {
 			data["dedup_status"] = DedupStatusOK
@@ -839,12 +913,25 @@ func (s *InvoiceService) Update(ownerUserID string, id string, input UpdateInvoi
 		}
 	}
 
-	if len(data) == 0 {
+	taxIDsChanged := input.BuyerTaxID != nil || input.SellerTaxID != nil
+	if len(data) == 0 && !taxIDsChanged {
 		return nil
 	}
 
-	if err := s.repo.UpdateForOwner(ownerUserID, id, data); err != nil {
-		return err
+	if len(data) > 0 {
+		if err := s.repo.UpdateForOwner(ownerUserID, id, data); err != nil {
+			return err
+		}
+	}
+
+	if taxIDsChanged {
+		if err := s.setPartyTaxIDs(ownerUserID, id, input.BuyerTaxID, input.SellerTaxID); err != nil {
+			return err
+		}
+	} else if input.InvoiceNumber != nil || input.InvoiceDate != nil || input.Amount != nil || input.TaxAmount != nil {
+		if err := s.refreshInvoiceDerived(ownerUserID, id); err != nil {
+			return err
+		}
 	}
 
 	if !needsRecalc {
@@ -893,31 +980,55 @@ func (s *InvoiceService) Delete(ownerUserID string, id string) error {
 	// Delete invoice + links atomically.
 	db := s.db
 	if err := db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("invoice_id = ?", id).Delete(&models.InvoicePaymentLink{}).Error; err != nil {
-			return err
-		}
-		if err := tx.Where("owner_user_id = ? AND invoice_id = ?", ownerUserID, id).Delete(&models.InvoiceAttachment{}).Error; err != nil {
-			return err
-		}
-		if err := s.blobRepo.DeleteInvoiceBlob(tx, ownerUserID, id); err != nil {
-			return err
-		}
-		if err := tx.Model(&models.EmailLog{}).
-			Where("owner_user_id = ? AND parsed_invoice_id = ?", ownerUserID, id).
-			Updates(map[string]interface{}{
-				"parsed_invoice_id": nil,
-				"status":            "received",
-				"parse_error":       nil,
-			}).Error; err != nil {
-			return err
-		}
-		return s.repo.WithDB(tx).DeleteForOwner(ownerUserID, id)
+		return s.deleteInvoiceTx(tx, ownerUserID, id)
 	}); err != nil {
 		return err
 	}
+	s.removeInvoiceFiles(invoice, attachments)
+
+	return recalcTripBadDebtLockedForTripIDs(s.db, affectedTrips)
+}
 
+// deleteInvoiceTx removes an invoice together with its links, attachments, tags, OCR blob, line items,
+// journeys and rides, and returns the email that produced it to the received state.
+func (s *InvoiceService) deleteInvoiceTx(tx *gorm.DB, ownerUserID string, id string) error {
+	if err := tx.Where("invoice_id = ?", id).Delete(&models.InvoicePaymentLink{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("owner_user_id = ? AND invoice_id = ?", ownerUserID, id).Delete(&models.InvoiceAttachment{}).Error; err != nil {
+		return err
+	}
+	if err := invoiceTagLink.deleteFor(tx, []string{id}); err != nil {
+		return err
+	}
+	if err := s.blobRepo.DeleteInvoiceBlob(tx, ownerUserID, id); err != nil {
+		return err
+	}
+	if err := s.lineItemRepo.DeleteForInvoice(tx, ownerUserID, id); err != nil {
+		return err
+	}
+	if err := s.journeyRepo.DeleteForInvoice(tx, ownerUserID, id); err != nil {
+		return err
+	}
+	if err := s.rideRepo.DeleteForInvoice(tx, ownerUserID, id); err != nil {
+		return err
+	}
+	if err := tx.Model(&models.EmailLog{}).
+		Where("owner_user_id = ? AND parsed_invoice_id = ?", ownerUserID, id).
+		Updates(map[string]interface{}{
+			"parsed_invoice_id": nil,
+			"status":            "received",
+			"parse_error":       nil,
+		}).Error; err != nil {
+		return err
+	}
+	return s.repo.WithDB(tx).DeleteForOwner(ownerUserID, id)
+}
+
+// removeInvoiceFiles deletes the stored files of an invoice that is gone from the database.
+func (s *InvoiceService) removeInvoiceFiles(invoice *models.Invoice, attachments []models.InvoiceAttachment) {
 	if _, err := removeStoredFile(s.uploadsDir, invoice.FilePath); err != nil {
-		log.Printf("[FileCleanup] 删除发票文件失败 invoice_id=%s err=%v", id, err)
+		log.Printf("[FileCleanup] 删除发票文件失败 invoice_id=%s err=%v", invoice.ID, err)
 	}
 	for _, a := range attachments {
 		p := strings.TrimSpace(a.FilePath)
@@ -925,11 +1036,9 @@ func (s *InvoiceService) Delete(ownerUserID string, id string) error {
 			continue
 		}
 		if _, err := removeStoredFile(s.uploadsDir, p); err != nil {
-			log.Printf("[FileCleanup] 删除发票附件失败 invoice_id=%s attachment_id=%s err=%v", id, a.ID, err)
+			log.Printf("[FileCleanup] 删除发票附件失败 invoice_id=%s attachment_id=%s err=%v", invoice.ID, a.ID, err)
 		}
 	}
-
-	return recalcTripBadDebtLockedForTripIDs(s.db, affectedTrips)
 }
 
 func (s *InvoiceService) GetStats(ownerUserID string) (*models.InvoiceStats, error) {
@@ -937,7 +1046,7 @@ func (s *InvoiceService) GetStats(ownerUserID string) (*models.InvoiceStats, err
 }
 
 func (s *InvoiceService) GetStatsCtx(ctx context.Context, ownerUserID string) (*models.InvoiceStats, error) {
-	return s.repo.GetStatsCtx(ctx, strings.TrimSpace(ownerUserID), "", "")
+	return s.GetStatsByInvoiceDateCtx(ctx, ownerUserID, "", "")
 }
 
 func (s *InvoiceService) GetStatsByInvoiceDate(ownerUserID string, startDate string, endDate string) (*models.InvoiceStats, error) {
@@ -945,7 +1054,16 @@ func (s *InvoiceService) GetStatsByInvoiceDate(ownerUserID string, startDate str
 }
 
 func (s *InvoiceService) GetStatsByInvoiceDateCtx(ctx context.Context, ownerUserID string, startDate string, endDate string) (*models.InvoiceStats, error) {
-	return s.repo.GetStatsCtx(ctx, strings.TrimSpace(ownerUserID), strings.TrimSpace(startDate), strings.TrimSpace(endDate))
+	conv, err := newCurrencyConverter(ctx, s.db, ownerUserID)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.repo.GetConvertedStatsCtx(ctx, strings.TrimSpace(ownerUserID), strings.TrimSpace(startDate), strings.TrimSpace(endDate), conv.toBase)
+	if err != nil {
+		return nil, err
+	}
+	stats.BaseCurrency = conv.base
+	return stats, nil
 }
 
 // LinkPayment links an invoice to a payment
@@ -1109,12 +1227,16 @@ func (s *InvoiceService) SuggestPaymentsCtx(ctx context.Context, ownerUserID str
 		dScore  float64
 		mScore  float64
 	}
+	conv, err := newCurrencyConverter(ctx, s.db, ownerUserID)
+	if err != nil {
+		return nil, err
+	}
 	scoredAll := make([]scored, 0, len(candidates))
 	for _, p := range candidates {
 		if _, ok := linkedIDs[p.ID]; ok {
 			continue
 		}
-		score, aScore, dScore, mScore := computeInvoicePaymentScoreBreakdown(invoice, &p)
+		score, aScore, dScore, mScore := computeInvoicePaymentScoreBreakdown(invoice, &p, conv)
 		scoredAll = append(scoredAll, scored{payment: p, score: score, aScore: aScore, dScore: dScore, mScore: mScore})
 	}
 
@@ -1200,6 +1322,7 @@ func strValueOrNil(v *string) interface{} {
 
 // parseInvoiceFile parses an invoice file and returns the extracted data.
 // - PDF: PyMuPDF fast-path (with RapidOCR fallback) via OCRService.RecognizePDF
+// - OFD: embedded XML, custom tags and text layer via parseOFDInvoiceFile (no OCR)
 // - Images: RapidOCR v3 via OCRService.RecognizeImage
 func (s *InvoiceService) parseInvoiceFile(filePath, filename string) (
 	invoiceNumber, invoiceDate, sellerName, buyerName *string,
@@ -1211,21 +1334,31 @@ func (s *InvoiceService) parseInvoiceFile(filePath, filename string) (
 	parseStatus = "parsing"
 
 	ext := strings.ToLower(filepath.Ext(filename))
-	if ext != ".pdf" && ext != ".png" && ext != ".jpg" && ext != ".jpeg" {
+	if ext != ".pdf" && ext != ".ofd" && ext != ".png" && ext != ".jpg" && ext != ".jpeg" {
 		parseStatus = "failed"
-		errMsg := "Only PDF/PNG/JPG files can be parsed"
+		errMsg := "Only PDF/OFD/PNG/JPG files can be parsed"
 		parseError = &errMsg
 		return
 	}
 
 	// Use OCR service to extract text
 	var (
-		text   string
-		source string
-		meta   *PDFTextCLIResponse
-		err    error
+		text      string
+		source    string
+		meta      *PDFTextCLIResponse
+		extracted *InvoiceExtractedData
+		err       error
 	)
-	if ext == ".pdf" {
+	if ext == ".ofd" {
+		extracted, err = parseOFDInvoiceFile(s.ocrService, filePath)
+		if err != nil {
+			parseStatus = "failed"
+			errMsg := fmt.Sprintf("OFD parsing failed: %v", err)
+			parseError = &errMsg
+			return
+		}
+		text, source = extracted.RawText, "ofd"
+	} else if ext == ".pdf" {
 		text, source, meta, err = s.ocrService.RecognizePDFWithSourceAndMeta(filePath)
 	} else {
 		text, err = s.ocrService.RecognizeImage(filePath)
@@ -1249,12 +1382,14 @@ func (s *InvoiceService) parseInvoiceFile(filePath, filename string) (
 	rawText = &text
 
 	// Parse the extracted text
-	extracted, err := s.ocrService.ParseInvoiceDataWithMeta(text, meta)
-	if err != nil {
-		parseStatus = "failed"
-		errMsg := fmt.Sprintf("Failed to parse invoice data: %v", err)
-		parseError = &errMsg
-		return
+	if extracted == nil {
+		extracted, err = s.ocrService.ParseInvoiceDataWithMeta(text, meta)
+		if err != nil {
+			parseStatus = "failed"
+			errMsg := fmt.Sprintf("Failed to parse invoice data: %v", err)
+			parseError = &errMsg
+			return
+		}
 	}
 
 	extracted.RawTextSource = source
@@ -1293,6 +1428,7 @@ func (s *InvoiceService) Reparse(ownerUserID string, id string) (*models.Invoice
 		amount, taxAmount,
 		extractedData, rawText,
 		parseStatus, parseError := s.parseInvoiceFile(filePath, invoice.Filename)
+	buyerName, extractedData = s.pickBuyerFromProfilesJSON(ownerUserID, buyerName, extractedData)
 
 	// Update the invoice with parsed data
 	updateData := map[string]interface{}{
@@ -1331,7 +1467,7 @@ func (s *InvoiceService) Reparse(ownerUserID string, id string) (*models.Invoice
 		if err := s.repo.WithDB(tx).UpdateForOwner(ownerUserID, id, updateData); err != nil {
 			return err
 		}
-		return s.blobRepo.UpsertInvoiceBlob(tx, ownerUserID, id, extractedData, rawText)
+		return s.storeInvoiceBlobTx(tx, ownerUserID, id, extractedData, rawText)
 	}); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	invoiceItemRateTokenRe   = regexp.MustCompile(`^\d{1,2}(?:\.\d+)?%$`)
+	invoiceItemNumberTokenRe = regexp.MustCompile(`^-?\d+(?:\.\d+)?$`)
+)
+
+// isInvoiceTaxExemptToken reports whether a tax-rate cell marks the row as exempt or out of scope.
+func isInvoiceTaxExemptToken(s string) bool {
+	switch strings.TrimSpace(s) {
+	case "免税", "不征税", "免征":
+		return true
+	}
+	return false
+}
+
+// parseInvoiceTaxRate reads a tax-rate cell as a fraction: "13%", "0.13" and "13" all give 0.13,
+// and exemption markers such as 免税 give 0.
+func parseInvoiceTaxRate(s string) *float64 {
+	s = strings.TrimSpace(strings.ReplaceAll(s, "％", "%"))
+	if s == "" {
+		return nil
+	}
+	if isInvoiceTaxExemptToken(s) {
+		zero := 0.0
+		return &zero
+	}
+	percent := strings.HasSuffix(s, "%")
+	v, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, "%")), 64)
+	if err != nil || v < 0 {
+		return nil
+	}
+	if percent || v >= 1 {
+		v /= 100
+	}
+	if v >= 1 {
+		return nil
+	}
+	v = math.Round(v*10000) / 10000
+	return &v
+}
+
+func isInvoiceItemAmountToken(tok string) bool {
+	return invoiceItemNumberTokenRe.MatchString(tok) ||
+		invoiceItemRateTokenRe.MatchString(tok) ||
+		isInvoiceTaxExemptToken(tok) ||
+		strings.Trim(tok, "*") == ""
+}
+
+// invoiceItemAmountTokens returns the run of numeric cells (numbers, tax rates, exemption markers and
+// the "***" tax placeholder) that ends a table row, left to right, e.g. "1 109.43 109.43 6% 6.57".
+func invoiceItemAmountTokens(line string) []string {
+	fields := strings.Fields(strings.NewReplacer("％", "%", "¥", " ", "￥", " ", ",", "").Replace(line))
+	start := len(fields)
+	for start > 0 && isInvoiceItemAmountToken(fields[start-1]) {
+		start--
+	}
+	return fields[start:]
+}
+
+// applyAmountTokens fills unit price, amount, tax rate and tax amount from the numeric cells of a
+// table row. The tax rate anchors the columns (price, amount, rate, tax); without one the last
+// decimal is taken as the amount. Rows with several rates are ambiguous and left alone. A unit
+// price is only kept when quantity × price matches the amount, as it is easily confused with the
+// quantity column.
+func (it *InvoiceLineItem) applyAmountTokens(tokens []string) {
+	rateIdx := -1
+	for i, tok := range tokens {
+		if invoiceItemRateTokenRe.MatchString(tok) || isInvoiceTaxExemptToken(tok) {
+			if rateIdx >= 0 {
+				return
+			}
+			rateIdx = i
+		}
+	}
+
+	amountIdx := len(tokens) - 1
+	if rateIdx >= 0 {
+		amountIdx = rateIdx - 1
+	} else if amountIdx < 0 || !strings.Contains(tokens[amountIdx], ".") {
+		return
+	}
+	var amount *float64
+	if amountIdx >= 0 {
+		amount = parseAmountLoose(tokens[amountIdx])
+	}
+	if rateIdx >= 0 {
+		if amount == nil {
+			return
+		}
+		it.TaxRate = parseInvoiceTaxRate(tokens[rateIdx])
+		if rateIdx+1 < len(tokens) {
+			tax := tokens[rateIdx+1]
+			if strings.Trim(tax, "*") == "" {
+				zero := 0.0
+				it.TaxAmount = &zero
+			} else if v := parseAmountLoose(tax); v != nil && math.Abs(*v) <= math.Abs(*amount) {
+				it.TaxAmount = v
+			}
+		}
+	}
+	if amount == nil {
+		return
+	}
+	it.Amount = amount
+	if amountIdx < 1 {
+		return
+	}
+	price := parseAmountLoose(tokens[amountIdx-1])
+	if price == nil || *price <= 0 {
+		return
+	}
+	qty := 1.0
+	if it.Quantity != nil {
+		qty = *it.Quantity
+	}
+	if math.Abs(qty*(*price)-*amount) <= math.Max(0.01, math.Abs(*amount)*0.005) {
+		it.UnitPrice = price
+	}
+}
+
+// storeInvoiceBlobTx saves the OCR payload of an invoice, rebuilds its line items from it and
+// re-derives the invoice type and warnings.
+func (s *InvoiceService) storeInvoiceBlobTx(tx *gorm.DB, ownerUserID, invoiceID string, extractedData, rawText *string) error {
+	if err := s.blobRepo.UpsertInvoiceBlob(tx, ownerUserID, invoiceID, extractedData, rawText); err != nil {
+		return err
+	}
+	return s.syncExtractedTx(tx, ownerUserID, invoiceID, extractedData)
+}
+
+// syncExtractedTx derives the line items, journey segments, type and warnings of an invoice from its
+// extraction result. Unreadable payloads leave the invoice without line items rather than failing the save.
+func (s *InvoiceService) syncExtractedTx(tx *gorm.DB, ownerUserID, invoiceID string, extractedData *string) error {
+	extracted := decodeInvoiceExtracted(extractedData)
+	var items []InvoiceLineItem
+	var journeys []JourneySegment
+	if extracted != nil {
+		items, journeys = extracted.Items, extracted.Journeys
+	}
+	if err := s.syncInvoiceLineItemsTx(tx, ownerUserID, invoiceID, items); err != nil {
+		return err
+	}
+	if err := s.syncJourneySegmentsTx(tx, ownerUserID, invoiceID, journeys); err != nil {
+		return err
+	}
+	return s.refreshInvoiceDerivedTx(tx, ownerUserID, invoiceID, extracted)
+}
+
+// syncInvoiceLineItemsTx replaces the stored line items of an invoice with items.
+func (s *InvoiceService) syncInvoiceLineItemsTx(tx *gorm.DB, ownerUserID, invoiceID string, items []InvoiceLineItem) error {
+	rows := make([]models.InvoiceLineItem, 0, len(items))
+	for _, it := range items {
+		name := strings.TrimSpace(it.Name)
+		if name == "" {
+			continue
+		}
+		rows = append(rows, models.InvoiceLineItem{
+			ID:        utils.GenerateUUID(),
+			Name:      name,
+			Spec:      ptrString(it.Spec),
+			Unit:      ptrString(it.Unit),
+			Quantity:  it.Quantity,
+			UnitPrice: it.UnitPrice,
+			Amount:    it.Amount,
+			TaxRate:   it.TaxRate,
+			TaxAmount: it.TaxAmount,
+		})
+	}
+	return s.lineItemRepo.ReplaceForInvoice(tx, ownerUserID, invoiceID, rows)
+}
@@ -0,0 +1,70 @@
+//go:build cgo
+
+package services
+
+import (
+	"testing"
+
+	"smart-bill-manager/internal/models"
+)
+
+func TestInvoiceLineItemsPersistAndAggregate(t *testing.T) {
+	db := openServiceTestDB(t)
+	service := NewInvoiceService(db, t.TempDir())
+
+	f := func(v float64) *float64 { return &v }
+	invoice, err := service.CreateFromExtracted("owner-1", CreateInvoiceInput{
+		Filename:     "invoice.xml",
+		OriginalName: "invoice.xml",
+		FilePath:     "uploads/owner-1/invoice.xml",
+		Source:       "email",
+	}, InvoiceExtractedData{
+		Amount: f(339),
+		Items: []InvoiceLineItem{
+			{Name: "*餐饮服务*餐费", Unit: "次", Quantity: f(1), UnitPrice: f(100), Amount: f(100), TaxRate: f(0.06), TaxAmount: f(6)},
+			{Name: "*日用品*纸巾", Unit: "包", Quantity: f(2), UnitPrice: f(100), Amount: f(200), TaxRate: f(0.13), TaxAmount: f(26)},
+			{Name: "*农产品*蔬菜", Amount: f(7), TaxRate: f(0)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("创建发票失败: %v", err)
+	}
+
+	got, err := service.GetByID("owner-1", invoice.ID)
+	if err != nil {
+		t.Fatalf("读取发票失败: %v", err)
+	}
+	if len(got.LineItems) != 3 {
+		t.Fatalf("发票明细应写入独立表: %#v", got.LineItems)
+	}
+	second := got.LineItems[1]
+	if second.LineNo != 2 || second.Name != "*日用品*纸巾" || second.Amount == nil || *second.Amount != 200 ||
+		second.TaxAmount == nil || *second.TaxAmount != 26 || second.TaxRate == nil || *second.TaxRate != 0.13 {
+		t.Fatalf("发票明细内容异常: %#v", second)
+	}
+
+	stats, err := service.GetStats("owner-1")
+	if err != nil {
+		t.Fatalf("统计发票失败: %v", err)
+	}
+	if stats.ByTaxRate["6%"] != 100 || stats.ByTaxRate["13%"] != 200 || stats.ByTaxRate["0%"] != 7 {
+		t.Fatalf("按税率汇总金额异常: %#v", stats.ByTaxRate)
+	}
+	if stats.ByTaxRateTax["13%"] != 26 || stats.ByTaxRateTax["6%"] != 6 {
+		t.Fatalf("按税率汇总税额异常: %#v", stats.ByTaxRateTax)
+	}
+	if stats.ByItem["*日用品*纸巾"] != 200 {
+		t.Fatalf("按商品汇总金额异常: %#v", stats.ByItem)
+	}
+
+	if err := service.Delete("owner-1", invoice.ID); err != nil {
+		t.Fatalf("删除发票失败: %v", err)
+	}
+	var count int64
+	if err := db.Model(&models.InvoiceLineItem{}).Count(&count).Error; err != nil {
+		t.Fatalf("统计发票明细失败: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("删除发票后明细应一并删除，剩余 %d 条", count)
+	}
+}
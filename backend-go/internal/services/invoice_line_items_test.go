@@ -0,0 +1,98 @@
+package services
+
+import "testing"
+
+func TestParseInvoiceTaxRate(t *testing.T) {
+	cases := map[string]float64{"13%": 0.13, "6％": 0.06, "0.09": 0.09, "3": 0.03, "免税": 0, "不征税": 0}
+	for in, want := range cases {
+		got := parseInvoiceTaxRate(in)
+		if got == nil || *got != want {
+			t.Fatalf("parseInvoiceTaxRate(%q) = %v, want %v", in, got, want)
+		}
+	}
+	if got := parseInvoiceTaxRate("abc"); got != nil {
+		t.Fatalf("expected nil for invalid rate, got %v", *got)
+	}
+}
+
+func TestApplyAmountTokens(t *testing.T) {
+	two := 2.0
+	it := InvoiceLineItem{Name: "*日用品*纸巾", Quantity: &two}
+	it.applyAmountTokens(invoiceItemAmountTokens("*日用品*纸巾 包 2 50.00 100.00 13% 13.00"))
+	if it.UnitPrice == nil || *it.UnitPrice != 50 || it.Amount == nil || *it.Amount != 100 ||
+		it.TaxRate == nil || *it.TaxRate != 0.13 || it.TaxAmount == nil || *it.TaxAmount != 13 {
+		t.Fatalf("unexpected amounts: %+v", it)
+	}
+
+	// The quantity column must not be taken as the unit price.
+	one := 1.0
+	it = InvoiceLineItem{Name: "*餐饮服务*餐饮服务", Quantity: &one}
+	it.applyAmountTokens([]string{"1", "109.43", "6%", "6.57"})
+	if it.UnitPrice != nil || it.Amount == nil || *it.Amount != 109.43 || it.TaxAmount == nil || *it.TaxAmount != 6.57 {
+		t.Fatalf("unexpected amounts: %+v", it)
+	}
+
+	it = InvoiceLineItem{Name: "*农产品*蔬菜"}
+	it.applyAmountTokens(invoiceItemAmountTokens("*农产品*蔬菜 7.00 免税 ***"))
+	if it.Amount == nil || *it.Amount != 7 || it.TaxRate == nil || *it.TaxRate != 0 || it.TaxAmount == nil || *it.TaxAmount != 0 {
+		t.Fatalf("unexpected exempt amounts: %+v", it)
+	}
+
+	it = InvoiceLineItem{Name: "x"}
+	it.applyAmountTokens([]string{"100.00", "6%", "6.00", "50.00", "13%", "6.50"})
+	if it.Amount != nil || it.TaxRate != nil {
+		t.Fatalf("rows with several rates should be left alone: %+v", it)
+	}
+}
+
+func TestExtractInvoiceLineItems_Text_ReadsAmountsAndTaxRate(t *testing.T) {
+	text := `
+项目名称 规格型号 单位 数量 单价 金额 税率/征收率 税额
+*餐饮服务*餐饮服务
+次
+1
+109.43
+109.43
+6%
+6.57
+*物流辅助服务*配送费 次 1 9.43 9.43 6% 0.57
+合计 ¥118.86 ¥7.14
+价税合计（小写） ￥126.00
+`
+	items := extractInvoiceLineItems(text)
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items, got %+v", items)
+	}
+	for i, want := range []struct{ price, amount, tax float64 }{{109.43, 109.43, 6.57}, {9.43, 9.43, 0.57}} {
+		it := items[i]
+		if it.UnitPrice == nil || *it.UnitPrice != want.price || it.Amount == nil || *it.Amount != want.amount ||
+			it.TaxRate == nil || *it.TaxRate != 0.06 || it.TaxAmount == nil || *it.TaxAmount != want.tax {
+			t.Fatalf("unexpected item %d: %+v", i, it)
+		}
+	}
+}
+
+func TestBuildInvoiceItems_ReadsXMLAmounts(t *testing.T) {
+	items := buildInvoiceItems(map[string][]string{
+		"itemname": {"*餐饮服务*餐费", "*日用品*纸巾"},
+		"quantity": {"1", "2"},
+		"unprice":  {"100", "50"},
+		"amount":   {"100.00", "100.00"},
+		"taxrate":  {"0.06", "0.13"},
+		"comtaxam": {"6.00", "13.00"},
+	})
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items, got %+v", items)
+	}
+	it := items[1]
+	if it.UnitPrice == nil || *it.UnitPrice != 50 || it.Amount == nil || *it.Amount != 100 ||
+		it.TaxRate == nil || *it.TaxRate != 0.13 || it.TaxAmount == nil || *it.TaxAmount != 13 {
+		t.Fatalf("unexpected item: %+v", it)
+	}
+
+	// A single total cannot be spread across several items.
+	items = buildInvoiceItems(map[string][]string{"itemname": {"a", "b"}, "amount": {"200.00"}})
+	if items[0].Amount != nil || items[1].Amount != nil {
+		t.Fatalf("amount should be ignored when counts differ: %+v", items)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"smart-bill-manager/internal/models"
 	"smart-bill-manager/internal/utils"
@@ -34,6 +35,10 @@ func (s *InvoiceService) CreateFromExtracted(ownerUserID string, input CreateInv
 		source = "upload"
 	}
 
+	if profiles, err := loadBuyerProfiles(s.db, ownerUserID); err == nil {
+		pickBuyerFromProfiles(&extracted, profiles)
+	}
+
 	extractedBytes, err := json.Marshal(extracted)
 	if err != nil {
 		return nil, fmt.Errorf("marshal extracted_data: %w", err)
@@ -48,27 +53,32 @@ func (s *InvoiceService) CreateFromExtracted(ownerUserID string, input CreateInv
 	buyerName := extracted.BuyerName
 
 	inv := &models.Invoice{
-		ID:            id,
-		OwnerUserID:   ownerUserID,
-		IsDraft:       false,
-		PaymentID:     input.PaymentID,
-		Filename:      input.Filename,
-		OriginalName:  input.OriginalName,
-		FilePath:      input.FilePath,
-		FileSize:      &input.FileSize,
-		FileSHA256:    input.FileSHA256,
-		InvoiceNumber: invoiceNumber,
-		InvoiceDate:   invoiceDate,
-		Amount:        amount,
-		TaxAmount:     taxAmount,
-		SellerName:    sellerName,
-		BuyerName:     buyerName,
-		ExtractedData: &extractedStr,
-		ParseStatus:   "success",
-		ParseError:    nil,
-		RawText:       nil,
-		Source:        source,
-		DedupStatus:   DedupStatusOK,
+		ID:             id,
+		OwnerUserID:    ownerUserID,
+		IsDraft:        false,
+		PaymentID:      input.PaymentID,
+		Filename:       input.Filename,
+		OriginalName:   input.OriginalName,
+		FilePath:       input.FilePath,
+		FileSize:       &input.FileSize,
+		FileSHA256:     input.FileSHA256,
+		PerceptualHash: computeStoredFilePerceptualHash(s.uploadsDir, input.FilePath),
+		InvoiceNumber:  invoiceNumber,
+		InvoiceDate:    invoiceDate,
+		Amount:         amount,
+		TaxAmount:      taxAmount,
+		SellerName:     sellerName,
+		BuyerName:      buyerName,
+		ExtractedData:  &extractedStr,
+		ParseStatus:    "success",
+		ParseError:     nil,
+		RawText:        nil,
+		Source:         source,
+		DedupStatus:    DedupStatusOK,
+	}
+	applyInvoiceExtracted(inv, &extracted, time.Now())
+	if err := applyBuyerCheckTx(s.db, inv, &extracted); err != nil {
+		return nil, err
 	}
 
 	db := s.db
@@ -76,6 +86,12 @@ func (s *InvoiceService) CreateFromExtracted(ownerUserID string, input CreateInv
 		if err := tx.Create(inv).Error; err != nil {
 			return err
 		}
+		if err := s.syncInvoiceLineItemsTx(tx, ownerUserID, inv.ID, extracted.Items); err != nil {
+			return err
+		}
+		if err := s.syncJourneySegmentsTx(tx, ownerUserID, inv.ID, extracted.Journeys); err != nil {
+			return err
+		}
 		if input.PaymentID != nil {
 			pid := strings.TrimSpace(*input.PaymentID)
 			if pid != "" {
@@ -96,25 +112,22 @@ func (s *InvoiceService) CreateFromExtracted(ownerUserID string, input CreateInv
 		return nil, err
 	}
 
-	// Mark suspected duplicates (invoice_number).
-	if inv.InvoiceNumber != nil {
-		n := strings.TrimSpace(*inv.InvoiceNumber)
-		if n != "" {
-			cands, err := s.FindCandidatesByInvoiceNumberForOwner(ownerUserID, n, inv.ID, 5)
-			if err != nil {
+	// Mark suspected duplicates (invoice_number, then a near-identical first page).
+	if strings.TrimSpace(strPtrVal(inv.InvoiceNumber)) != "" || inv.PerceptualHash != nil {
+		_, cands, err := s.FindSuspectedDuplicatesForOwner(ownerUserID, strPtrVal(inv.InvoiceNumber), inv.PerceptualHash, inv.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(cands) > 0 {
+			inv.DedupStatus = DedupStatusSuspected
+			ref := cands[0].ID
+			inv.DedupRefID = &ref
+			if err := db.Model(&models.Invoice{}).Where("id = ?", inv.ID).Updates(map[string]interface{}{
+				"dedup_status": DedupStatusSuspected,
+				"dedup_ref_id": ref,
+			}).Error; err != nil {
 				return nil, err
 			}
-			if len(cands) > 0 {
-				inv.DedupStatus = DedupStatusSuspected
-				ref := cands[0].ID
-				inv.DedupRefID = &ref
-				if err := db.Model(&models.Invoice{}).Where("id = ?", inv.ID).Updates(map[string]interface{}{
-					"dedup_status": DedupStatusSuspected,
-					"dedup_ref_id": ref,
-				}).Error; err != nil {
-					return nil, err
-				}
-			}
 		}
 	}
 
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/money"
+	"smart-bill-manager/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// InvoiceWarningRideTotalMismatch flags an invoice whose itinerary rides do not add up to it.
+const InvoiceWarningRideTotalMismatch = "ride_total_mismatch"
+
+// A ride is charged when it ends, so its payment is looked for from shortly before boarding to a
+// day after.
+const (
+	rideMatchBefore = 30 * time.Minute
+	rideMatchAfter  = 24 * time.Hour
+)
+
+// RideMatchResult reports how many rides MatchRidesCtx matched, with all rides of the invoice.
+type RideMatchResult struct {
+	Matched int                  `json:"matched"`
+	Rides   []models.InvoiceRide `json:"rides"`
+}
+
+// rideRows converts extracted rides to rows, skipping rides without a fare.
+func rideRows(rides []RideRecord) []models.InvoiceRide {
+	rows := make([]models.InvoiceRide, 0, len(rides))
+	for _, r := range rides {
+		if r.Amount == nil {
+			continue
+		}
+		amount := *r.Amount
+		row := models.InvoiceRide{
+			ID:          utils.GenerateUUID(),
+			Provider:    ptrString(r.Provider),
+			CarType:     ptrString(r.CarType),
+			City:        ptrString(r.City),
+			Origin:      ptrString(r.Origin),
+			Destination: ptrString(r.Destination),
+			DistanceKm:  r.DistanceKm,
+			Amount:      &amount,
+		}
+		if t, err := time.Parse(time.RFC3339, strings.TrimSpace(r.RideTime)); err == nil {
+			row.RideTime = ptrString(t.Format(time.RFC3339))
+			row.RideTs = unixMilli(t)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// validateInvoiceRides checks the rides of an invoice against its amount and against the total
+// printed on the itinerary (details.Total), which catches rows the parser missed.
+func validateInvoiceRides(inv *models.Invoice, rides []models.InvoiceRide) []models.InvoiceWarning {
+	if inv == nil || len(rides) == 0 {
+		return nil
+	}
+	var sum int64
+	for _, r := range rides {
+		if r.AmountCents != nil {
+			sum += *r.AmountCents
+		}
+	}
+	var out []models.InvoiceWarning
+	if d := inv.TypeDetails; d != nil && d.Total != nil {
+		if printed, err := money.FromMajor(*d.Total); err == nil && printed != sum {
+			out = append(out, models.InvoiceWarning{
+				Code:    InvoiceWarningRideTotalMismatch,
+				Field:   "rides",
+				Message: fmt.Sprintf("行程单 %d 笔行程金额之和 %.2f 与行程单合计 %.2f 不符，可能有行程未识别", len(rides), money.ToMajor(sum), *d.Total),
+			})
+		}
+	}
+	if inv.AmountCents != nil && *inv.AmountCents != sum {
+		out = append(out, models.InvoiceWarning{
+			Code:    InvoiceWarningRideTotalMismatch,
+			Field:   "amount",
+			Message: fmt.Sprintf("行程单 %d 笔行程合计 %.2f 与发票金额 %.2f 不符", len(rides), money.ToMajor(sum), money.ToMajor(*inv.AmountCents)),
+		})
+	}
+	return out
+}
+
+func (s *InvoiceService) MatchRides(ownerUserID string, invoiceID string) (*RideMatchResult, error) {
+	return s.MatchRidesCtx(context.Background(), ownerUserID, invoiceID)
+}
+
+// MatchRidesCtx matches each unmatched ride of an invoice to a payment of exactly its fare charged
+// around the ride, preferring the closest in time. Payments already linked to an invoice or matched
+// to another ride are skipped. A matched ride belongs to its payment's trip.
+func (s *InvoiceService) MatchRidesCtx(ctx context.Context, ownerUserID string, invoiceID string) (*RideMatchResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	if _, err := s.repo.FindByIDForOwnerCtx(ctx, ownerUserID, invoiceID); err != nil {
+		return nil, err
+	}
+	rides, err := s.rideRepo.FindByInvoiceIDForOwnerCtx(ctx, ownerUserID, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &RideMatchResult{}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var used []string
+		for _, r := range rides {
+			if r.PaymentID != nil || r.RideTs == 0 || r.AmountCents == nil || *r.AmountCents <= 0 {
+				continue
+			}
+			q := tx.Model(&models.Payment{}).
+				Select("id").
+				Where("owner_user_id = ? AND is_draft = 0 AND refund_of_id IS NULL", ownerUserID).
+				Where("amount_cents = ?", *r.AmountCents).
+				Where("transaction_time_ts BETWEEN ? AND ?", r.RideTs-rideMatchBefore.Milliseconds(), r.RideTs+rideMatchAfter.Milliseconds()).
+				Where("NOT EXISTS (SELECT 1 FROM invoice_payment_links l WHERE l.payment_id = payments.id)").
+				Where("NOT EXISTS (SELECT 1 FROM invoice_rides r WHERE r.payment_id = payments.id)")
+			if len(used) > 0 {
+				q = q.Where("id NOT IN ?", used)
+			}
+			var paymentIDs []string
+			if err := q.Order(gorm.Expr("ABS(transaction_time_ts - ?) ASC, id ASC", r.RideTs)).
+				Limit(1).
+				Pluck("id", &paymentIDs).Error; err != nil {
+				return err
+			}
+			if len(paymentIDs) == 0 {
+				continue
+			}
+			if err := s.rideRepo.SetPayment(tx, ownerUserID, r.ID, &paymentIDs[0]); err != nil {
+				return err
+			}
+			used = append(used, paymentIDs[0])
+			out.Matched++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.recalcRideTripsBadDebt(ownerUserID, invoiceID, nil); err != nil {
+		return nil, err
+	}
+	if out.Rides, err = s.rideRepo.FindByInvoiceIDForOwnerCtx(ctx, ownerUserID, invoiceID); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *InvoiceService) SetRidePayment(ownerUserID, invoiceID, rideID, paymentID string) (*models.InvoiceRide, error) {
+	return s.SetRidePaymentCtx(context.Background(), ownerUserID, invoiceID, rideID, paymentID)
+}
+
+// SetRidePaymentCtx matches a ride of an invoice to a payment by hand, or clears the match when
+// paymentID is empty.
+func (s *InvoiceService) SetRidePaymentCtx(ctx context.Context, ownerUserID, invoiceID, rideID, paymentID string) (*models.InvoiceRide, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	paymentID = strings.TrimSpace(paymentID)
+	ride, err := s.rideRepo.FindByIDForOwnerCtx(ctx, ownerUserID, rideID)
+	if err != nil {
+		return nil, err
+	}
+	if ride.InvoiceID != strings.TrimSpace(invoiceID) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var target *string
+	if paymentID != "" {
+		var cnt int64
+		if err := s.db.WithContext(ctx).Model(&models.Payment{}).
+			Where("id = ? AND owner_user_id = ? AND is_draft = 0", paymentID, ownerUserID).
+			Count(&cnt).Error; err != nil {
+			return nil, err
+		}
+		if cnt == 0 {
+			return nil, gorm.ErrRecordNotFound
+		}
+		target = &paymentID
+	}
+	before, err := tripIDsForInvoices(s.db.WithContext(ctx), ownerUserID, []string{ride.InvoiceID})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.rideRepo.SetPayment(s.db.WithContext(ctx), ownerUserID, ride.ID, target); err != nil {
+		return nil, err
+	}
+	if err := s.recalcRideTripsBadDebt(ownerUserID, ride.InvoiceID, before); err != nil {
+		return nil, err
+	}
+	return s.rideRepo.FindByIDForOwnerCtx(ctx, ownerUserID, ride.ID)
+}
+
+// recalcRideTripsBadDebt refreshes the bad-debt lock of the trips the invoice now belongs to through
+// its rides, plus the trips it belonged to before.
+func (s *InvoiceService) recalcRideTripsBadDebt(ownerUserID, invoiceID string, before []string) error {
+	after, err := tripIDsForInvoices(s.db, ownerUserID, []string{invoiceID})
+	if err != nil {
+		return err
+	}
+	return recalcTripBadDebtLockedForTripIDs(s.db, append(before, after...))
+}
@@ -0,0 +1,155 @@
+//go:build cgo
+
+package services
+
+import (
+	"context"
+	"testing"
+
+	"smart-bill-manager/internal/models"
+)
+
+func TestRideItinerarySplitsInvoiceAcrossTrips(t *testing.T) {
+	db := openServiceTestDB(t)
+	invoices := NewInvoiceService(db, t.TempDir())
+	payments := NewPaymentService(db, t.TempDir())
+	trips := NewTripService(db, t.TempDir())
+	ctx := context.Background()
+
+	f := func(v float64) *float64 { return &v }
+	inv, err := invoices.CreateFromExtracted("owner-1", CreateInvoiceInput{
+		Filename:     "didi.pdf",
+		OriginalName: "滴滴电子发票.pdf",
+		FilePath:     "uploads/owner-1/didi.pdf",
+		Source:       "upload",
+	}, InvoiceExtractedData{Amount: f(86.5), InvoiceType: InvoiceTypeDigital})
+	if err != nil {
+		t.Fatalf("创建发票失败: %v", err)
+	}
+	att, err := invoices.CreateAttachmentCtx(ctx, "owner-1", inv.ID, CreateInvoiceAttachmentInput{
+		Kind:         "itinerary",
+		Filename:     "trip.pdf",
+		OriginalName: "滴滴出行行程报销单.pdf",
+		FilePath:     "uploads/owner-1/trip.pdf",
+	})
+	if err != nil {
+		t.Fatalf("创建附件失败: %v", err)
+	}
+
+	// The itinerary misses the last ride, so the rides do not add up.
+	rides, total := parseRideItinerary(didiItineraryText)
+	if err := invoices.applyItineraryAttachmentCtx(ctx, att, &InvoiceExtractedData{Rides: rides[:2], TypeDetails: &InvoiceTypeDetails{Total: total}}); err != nil {
+		t.Fatalf("保存行程单失败: %v", err)
+	}
+	got, err := invoices.GetByID("owner-1", inv.ID)
+	if err != nil {
+		t.Fatalf("读取发票失败: %v", err)
+	}
+	if len(got.Rides) != 2 || strPtrVal(got.Rides[0].AttachmentID) != att.ID || got.Rides[0].RideNo != 1 {
+		t.Fatalf("行程应关联到行程单附件: %#v", got.Rides)
+	}
+	if !hasInvoiceWarning(got, InvoiceWarningRideTotalMismatch) {
+		t.Fatalf("行程金额不符应告警: %#v", got.Warnings)
+	}
+
+	if err := invoices.applyItineraryAttachmentCtx(ctx, att, &InvoiceExtractedData{Rides: rides, TypeDetails: &InvoiceTypeDetails{Total: total}}); err != nil {
+		t.Fatalf("重新保存行程单失败: %v", err)
+	}
+	if got, _ = invoices.GetByID("owner-1", inv.ID); len(got.Rides) != 3 || hasInvoiceWarning(got, InvoiceWarningRideTotalMismatch) {
+		t.Fatalf("完整行程不应告警: %d %#v", len(got.Rides), got.Warnings)
+	}
+
+	// The Beijing rides belong to one trip and the Shanghai ride to another.
+	beijing, _, err := trips.Create("owner-1", CreateTripInput{Name: "北京出差", StartTime: "2025-11-03T00:00:00+08:00", EndTime: "2025-11-04T00:00:00+08:00"})
+	if err != nil {
+		t.Fatalf("创建行程失败: %v", err)
+	}
+	shanghai, _, err := trips.Create("owner-1", CreateTripInput{Name: "上海出差", StartTime: "2025-11-05T00:00:00+08:00", EndTime: "2025-11-06T00:00:00+08:00"})
+	if err != nil {
+		t.Fatalf("创建行程失败: %v", err)
+	}
+	paymentIDs := make([]string, 0, 4)
+	for _, input := range []struct {
+		amount float64
+		when   string
+		trip   string
+	}{
+		{35.2, "2025-11-03T08:40:00+08:00", beijing.ID},
+		{33.8, "2025-11-03T19:05:00+08:00", beijing.ID},
+		{17.5, "2025-11-05T19:50:00+08:00", shanghai.ID},
+		// Same fare but a day too late, so it must not be picked.
+		{17.5, "2025-11-07T10:00:00+08:00", shanghai.ID},
+	} {
+		p, err := payments.Create("owner-1", CreatePaymentInput{Amount: input.amount, TransactionTime: input.when})
+		if err != nil {
+			t.Fatalf("创建支付失败: %v", err)
+		}
+		if err := db.Model(&models.Payment{}).Where("id = ?", p.ID).Update("trip_id", input.trip).Error; err != nil {
+			t.Fatalf("关联行程失败: %v", err)
+		}
+		paymentIDs = append(paymentIDs, p.ID)
+	}
+
+	result, err := invoices.MatchRides("owner-1", inv.ID)
+	if err != nil {
+		t.Fatalf("匹配行程支付失败: %v", err)
+	}
+	if result.Matched != 3 {
+		t.Fatalf("应匹配三笔行程: %#v", result)
+	}
+	for i, r := range result.Rides {
+		want := beijing.ID
+		if i == 2 {
+			want = shanghai.ID
+		}
+		if strPtrVal(r.PaymentID) != paymentIDs[i] || strPtrVal(r.TripID) != want {
+			t.Fatalf("第 %d 笔行程匹配异常: %#v", i+1, r)
+		}
+	}
+
+	// Each trip counts the invoice, and no matched payment shows as missing an invoice.
+	for _, trip := range []*models.Trip{beijing, shanghai} {
+		summary, err := trips.GetSummary("owner-1", trip.ID)
+		if err != nil {
+			t.Fatalf("读取行程汇总失败: %v", err)
+		}
+		wantUnlinked := 0
+		if trip.ID == shanghai.ID {
+			wantUnlinked = 1
+		}
+		if summary.LinkedInvoices != 1 || summary.UnlinkedPays != wantUnlinked {
+			t.Fatalf("行程 %s 汇总异常: %#v", trip.Name, summary)
+		}
+	}
+	if unlinked, _, err := invoices.GetUnlinked("owner-1", 0, 0); err != nil || len(unlinked) != 0 {
+		t.Fatalf("行程已匹配支付的发票不应算作未关联: %v %#v", err, unlinked)
+	}
+
+	// A manual change moves the Shanghai ride to the late payment; deleting that payment clears it.
+	ride, err := invoices.SetRidePayment("owner-1", inv.ID, result.Rides[2].ID, paymentIDs[3])
+	if err != nil || strPtrVal(ride.PaymentID) != paymentIDs[3] {
+		t.Fatalf("手动匹配行程失败: %v %#v", err, ride)
+	}
+	if err := payments.Delete("owner-1", paymentIDs[3]); err != nil {
+		t.Fatalf("删除支付失败: %v", err)
+	}
+	if got, _ = invoices.GetByID("owner-1", inv.ID); got.Rides[2].PaymentID != nil {
+		t.Fatalf("删除支付后应清除行程匹配: %#v", got.Rides[2])
+	}
+
+	if err := invoices.DeleteAttachmentCtx(ctx, "owner-1", inv.ID, att.ID); err != nil {
+		t.Fatalf("删除附件失败: %v", err)
+	}
+	if got, _ = invoices.GetByID("owner-1", inv.ID); len(got.Rides) != 0 {
+		t.Fatalf("删除行程单后应移除行程: %#v", got.Rides)
+	}
+}
+
+func hasInvoiceWarning(inv *models.Invoice, code string) bool {
+	for _, w := range inv.Warnings {
+		if w.Code == code {
+			return true
+		}
+	}
+	return false
+}
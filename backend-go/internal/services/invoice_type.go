@@ -0,0 +1,182 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	"smart-bill-manager/internal/invoicetype"
+	"smart-bill-manager/internal/models"
+)
+
+// Invoice types stored in models.Invoice.InvoiceType. An empty type means the invoice was never
+// classified (e.g. created before classification existed and without OCR text).
+const (
+	InvoiceTypeVATSpecial    = invoicetype.VATSpecial
+	InvoiceTypeVATOrdinary   = invoicetype.VATOrdinary
+	InvoiceTypeDigital       = invoicetype.Digital
+	InvoiceTypeRailwayTicket = invoicetype.RailwayTicket
+	InvoiceTypeAirItinerary  = invoicetype.AirItinerary
+	InvoiceTypeToll          = invoicetype.Toll
+	InvoiceTypeTaxi          = invoicetype.Taxi
+	InvoiceTypeOther         = invoicetype.Other
+)
+
+// InvoiceTypeDetails is the type-specific payload of an extraction result, stored as is on the invoice.
+type InvoiceTypeDetails = models.InvoiceTypeDetails
+
+// InvoiceTypes lists the known invoice types in display order.
+var InvoiceTypes = []string{
+	InvoiceTypeVATSpecial,
+	InvoiceTypeVATOrdinary,
+	InvoiceTypeDigital,
+	InvoiceTypeRailwayTicket,
+	InvoiceTypeAirItinerary,
+	InvoiceTypeToll,
+	InvoiceTypeTaxi,
+	InvoiceTypeOther,
+}
+
+// invoiceTypeLabels are the Chinese names used in exports.
+var invoiceTypeLabels = map[string]string{
+	InvoiceTypeVATSpecial:    "增值税专用发票",
+	InvoiceTypeVATOrdinary:   "增值税普通发票",
+	InvoiceTypeDigital:       "数电发票",
+	InvoiceTypeRailwayTicket: "铁路电子客票",
+	InvoiceTypeAirItinerary:  "航空运输电子客票行程单",
+	InvoiceTypeToll:          "通行费发票",
+	InvoiceTypeTaxi:          "出租车发票",
+	InvoiceTypeOther:         "其他发票",
+}
+
+func invoiceTypeLabel(t string) string {
+	if label, ok := invoiceTypeLabels[t]; ok {
+		return label
+	}
+	return "未分类"
+}
+
+// invoiceTypeRank orders invoice types as in InvoiceTypes, unclassified last.
+func invoiceTypeRank(t string) int {
+	for i, known := range InvoiceTypes {
+		if t == known {
+			return i
+		}
+	}
+	return len(InvoiceTypes)
+}
+
+// IsValidInvoiceType reports whether t is one of InvoiceTypes.
+func IsValidInvoiceType(t string) bool {
+	return invoiceTypeRank(t) < len(InvoiceTypes)
+}
+
+var (
+	plateNumberRe      = invoicetype.PlateNumberRe
+	taxiCarNumberRe    = regexp.MustCompile(`车号[:：]?\s*([\p{Han}]?[A-Z][A-Z0-9]{4,6})`)
+	taxiBoardingRe     = regexp.MustCompile(`上车[:：]?\s*(\d{1,2}[:：]\d{2})`)
+	taxiAlightingRe    = regexp.MustCompile(`下车[:：]?\s*(\d{1,2}[:：]\d{2})`)
+	tollPeriodStartRe  = regexp.MustCompile(`通行日期起[:：]?\s*(\d{4}[-/.年]?\d{2}[-/.月]?\d{2}日?)`)
+	tollPeriodEndRe    = regexp.MustCompile(`通行日期止[:：]?\s*(\d{4}[-/.年]?\d{2}[-/.月]?\d{2}日?)`)
+	tollRowDateRe      = regexp.MustCompile(`\b(20\d{2}[-/.]?\d{2}[-/.]?\d{2})\b`)
+	railTicketNumberRe = regexp.MustCompile(`电子客票号[:：]?\s*([0-9A-Z]{10,30})`)
+	railPassengerRe    = regexp.MustCompile(`\d{10}\*{4}\d{3}[\dX]\s*([\p{Han}·]{2,20})`)
+	airTicketNumberRe  = regexp.MustCompile(`电子客票号码\s*(?:E-TICKET\s*NO\.?)?\s*[:：]?\s*(\d{3}-?\d{10})`)
+)
+
+// compactInvoiceTypeText removes spacing and unifies brackets so title markers such as
+// "电子发票 (普通发票)" match regardless of the text layer.
+func compactInvoiceTypeText(text string) string {
+	return invoicetype.Compact(text)
+}
+
+// classifyInvoiceType derives the invoice type from the title and type-specific labels of the
+// invoice text; the migrations backfill old invoices with the same rules.
+func classifyInvoiceType(text string) string {
+	return invoicetype.Classify(text)
+}
+
+// classifyInvoiceXMLType classifies an invoice from the element values of its XML. Fully digital
+// invoices carry an EIid/LabelName header; legacy e-invoices a fplxdm type code.
+func classifyInvoiceXMLType(values map[string][]string) string {
+	var parts []string
+	for _, k := range []string{"labelname", "invoicetype", "einvoicetype", "fpzl", "fplxmc", "xmmc", "spmc", "itemname"} {
+		parts = append(parts, values[k]...)
+	}
+	text := strings.Join(parts, "\n")
+	if t := classifyInvoiceType(text); t != "" && t != InvoiceTypeOther {
+		if t == InvoiceTypeVATSpecial || t == InvoiceTypeVATOrdinary {
+			// LabelName only says 普通发票/增值税专用发票 on fully digital invoices.
+			if len(values["eiid"]) > 0 || len(values["einvoicetag"]) > 0 {
+				return InvoiceTypeDigital
+			}
+		}
+		return t
+	}
+	if strings.Contains(text, "通行费") {
+		return InvoiceTypeToll
+	}
+	if len(values["eiid"]) > 0 || len(values["einvoicetag"]) > 0 {
+		return InvoiceTypeDigital
+	}
+	for _, code := range values["fplxdm"] {
+		switch strings.TrimSpace(code) {
+		case "004", "028":
+			return InvoiceTypeVATSpecial
+		case "007", "026":
+			return InvoiceTypeVATOrdinary
+		}
+	}
+	return InvoiceTypeOther
+}
+
+// extractInvoiceTypeDetails reads the type-specific fields of an invoice from its text. data supplies
+// fields the type parsers already found (the passenger of an air itinerary is its buyer).
+func extractInvoiceTypeDetails(invoiceType, text string, data *InvoiceExtractedData) *InvoiceTypeDetails {
+	d := &InvoiceTypeDetails{}
+	first := func(re *regexp.Regexp, s string) *string {
+		if m := re.FindStringSubmatch(s); len(m) > 1 {
+			return ptrString(strings.TrimSpace(m[1]))
+		}
+		return nil
+	}
+	switch invoiceType {
+	case InvoiceTypeRailwayTicket:
+		d.TicketNumber = first(railTicketNumberRe, text)
+		d.Passenger = first(railPassengerRe, text)
+	case InvoiceTypeAirItinerary:
+		d.TicketNumber = first(airTicketNumberRe, text)
+		if data != nil && data.BuyerName != nil {
+			d.Passenger = ptrString(strings.TrimSpace(*data.BuyerName))
+		}
+		if d.Passenger == nil {
+			d.Passenger = ptrString(parseAirItineraryPassenger(text))
+		}
+		applyAirFareBreakdown(text, d)
+	case InvoiceTypeToll:
+		d.PeriodStart = first(tollPeriodStartRe, text)
+		d.PeriodEnd = first(tollPeriodEndRe, text)
+		for _, line := range strings.Split(text, "\n") {
+			plate := plateNumberRe.FindString(line)
+			if plate == "" {
+				continue
+			}
+			d.PlateNumber = ptrString(strings.NewReplacer("·", "", ".", "").Replace(plate))
+			// Table layout: the plate row also holds the passage start and end dates.
+			if dates := tollRowDateRe.FindAllString(line, -1); len(dates) >= 2 && d.PeriodStart == nil && d.PeriodEnd == nil {
+				d.PeriodStart, d.PeriodEnd = ptrString(dates[0]), ptrString(dates[len(dates)-1])
+			}
+			break
+		}
+	case InvoiceTypeTaxi:
+		d.PlateNumber = first(taxiCarNumberRe, text)
+		if d.PlateNumber == nil {
+			d.PlateNumber = ptrString(plateNumberRe.FindString(text))
+		}
+		d.PeriodStart = first(taxiBoardingRe, text)
+		d.PeriodEnd = first(taxiAlightingRe, text)
+	}
+	if *d == (InvoiceTypeDetails{}) {
+		return nil
+	}
+	return d
+}
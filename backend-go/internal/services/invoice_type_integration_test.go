@@ -0,0 +1,67 @@
+//go:build cgo
+
+package services
+
+import "testing"
+
+func TestInvoiceTypePersistFilterAndStats(t *testing.T) {
+	db := openServiceTestDB(t)
+	service := NewInvoiceService(db, t.TempDir())
+
+	f := func(v float64) *float64 { return &v }
+	create := func(name string, extracted InvoiceExtractedData) string {
+		inv, err := service.CreateFromExtracted("owner-1", CreateInvoiceInput{
+			Filename:     name,
+			OriginalName: name,
+			FilePath:     "uploads/owner-1/" + name,
+			Source:       "upload",
+		}, extracted)
+		if err != nil {
+			t.Fatalf("创建发票失败: %v", err)
+		}
+		return inv.ID
+	}
+	railID := create("rail.pdf", InvoiceExtractedData{
+		Amount:  f(100),
+		RawText: "电子发票（铁路电子客票）\n电子客票号: 1234567890123456789012\n3201021990****123X 张三",
+	})
+	create("toll.xml", InvoiceExtractedData{
+		Amount:      f(30),
+		InvoiceType: InvoiceTypeToll,
+		TypeDetails: &InvoiceTypeDetails{PlateNumber: ptrString("苏A12345")},
+	})
+	create("taxi.pdf", InvoiceExtractedData{Amount: f(20), InvoiceType: InvoiceTypeTaxi})
+	create("taxi2.pdf", InvoiceExtractedData{Amount: f(25), InvoiceType: InvoiceTypeTaxi})
+
+	got, err := service.GetByID("owner-1", railID)
+	if err != nil {
+		t.Fatalf("读取发票失败: %v", err)
+	}
+	if got.InvoiceType != InvoiceTypeRailwayTicket || got.TypeDetails == nil || strPtrVal(got.TypeDetails.Passenger) != "张三" {
+		t.Fatalf("应按识别文本分类并保存乘车人: %q %#v", got.InvoiceType, got.TypeDetails)
+	}
+
+	list, total, err := service.List("owner-1", InvoiceFilterInput{InvoiceType: InvoiceTypeTaxi})
+	if err != nil {
+		t.Fatalf("查询发票失败: %v", err)
+	}
+	if total != 2 || len(list) != 2 || list[0].InvoiceType != InvoiceTypeTaxi {
+		t.Fatalf("按发票类型筛选异常: total=%d %#v", total, list)
+	}
+	list, _, err = service.List("owner-1", InvoiceFilterInput{InvoiceType: InvoiceTypeToll})
+	if err != nil {
+		t.Fatalf("查询发票失败: %v", err)
+	}
+	if len(list) != 1 || list[0].TypeDetails == nil || strPtrVal(list[0].TypeDetails.PlateNumber) != "苏A12345" {
+		t.Fatalf("列表应返回车牌号: %#v", list)
+	}
+
+	stats, err := service.GetStats("owner-1")
+	if err != nil {
+		t.Fatalf("统计发票失败: %v", err)
+	}
+	if stats.ByType[InvoiceTypeTaxi] != 45 || stats.ByTypeCount[InvoiceTypeTaxi] != 2 ||
+		stats.ByType[InvoiceTypeRailwayTicket] != 100 || stats.ByType[InvoiceTypeToll] != 30 {
+		t.Fatalf("按发票类型统计异常: %#v %#v", stats.ByType, stats.ByTypeCount)
+	}
+}
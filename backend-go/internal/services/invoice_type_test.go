@@ -0,0 +1,90 @@
+package services
+
+import "testing"
+
+func TestClassifyInvoiceType(t *testing.T) {
+	cases := map[string]string{
+		"电子发票 (铁路电子客票)\n票价: ￥100.00":                        InvoiceTypeRailwayTicket,
+		"航空运输电子客票行程单\n电子客票号码: 7812345678901":                InvoiceTypeAirItinerary,
+		"增值税电子普通发票\n*经营租赁*通行费 苏A12345 客车 20240101 20240105": InvoiceTypeToll,
+		"北京市出租汽车专用发票\n车号: BT1234\n上车 08:01\n下车 08:30":       InvoiceTypeTaxi,
+		"电子发票（增值税专用发票）\n发票号码: 25117000000123456789":         InvoiceTypeDigital,
+		"北京增值税专用发票\n发票代码: 1100191130":                       InvoiceTypeVATSpecial,
+		"增值税电子普通发票\n发票代码: 011001900111":                     InvoiceTypeVATOrdinary,
+		"收据":  InvoiceTypeOther,
+		"   ": "",
+	}
+	for text, want := range cases {
+		if got := classifyInvoiceType(text); got != want {
+			t.Fatalf("classifyInvoiceType(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestClassifyInvoiceXMLType(t *testing.T) {
+	digital := map[string][]string{"eiid": {"25117000000123456789"}, "labelname": {"普通发票"}}
+	if got := classifyInvoiceXMLType(digital); got != InvoiceTypeDigital {
+		t.Fatalf("digital xml: got %q", got)
+	}
+	toll := map[string][]string{"fplxdm": {"026"}, "xmmc": {"*经营租赁*通行费"}}
+	if got := classifyInvoiceXMLType(toll); got != InvoiceTypeToll {
+		t.Fatalf("toll xml: got %q", got)
+	}
+	special := map[string][]string{"fplxdm": {"028"}}
+	if got := classifyInvoiceXMLType(special); got != InvoiceTypeVATSpecial {
+		t.Fatalf("special xml: got %q", got)
+	}
+}
+
+func TestExtractInvoiceTypeDetails(t *testing.T) {
+	d := extractInvoiceTypeDetails(InvoiceTypeToll, "*经营租赁*通行费 苏A12345 客车 20240101 20240105 100.00", nil)
+	if d == nil || strPtrVal(d.PlateNumber) != "苏A12345" || strPtrVal(d.PeriodStart) != "20240101" || strPtrVal(d.PeriodEnd) != "20240105" {
+		t.Fatalf("unexpected toll details: %+v", d)
+	}
+
+	d = extractInvoiceTypeDetails(InvoiceTypeRailwayTicket, "电子客票号: 1234567890123456789012\n3201021990****123X 张三", nil)
+	if d == nil || strPtrVal(d.TicketNumber) != "1234567890123456789012" || strPtrVal(d.Passenger) != "张三" {
+		t.Fatalf("unexpected railway details: %+v", d)
+	}
+
+	d = extractInvoiceTypeDetails(InvoiceTypeTaxi, "车号: BT1234\n上车 08:01\n下车 08:30", nil)
+	if d == nil || strPtrVal(d.PlateNumber) != "BT1234" || strPtrVal(d.PeriodStart) != "08:01" || strPtrVal(d.PeriodEnd) != "08:30" {
+		t.Fatalf("unexpected taxi details: %+v", d)
+	}
+
+	if d := extractInvoiceTypeDetails(InvoiceTypeVATSpecial, "发票代码: 1100191130", nil); d != nil {
+		t.Fatalf("expected no details for a VAT invoice, got %+v", d)
+	}
+}
+
+func TestTripExportInvoiceIndexGroupsByType(t *testing.T) {
+	cents := func(v int64) *int64 { return &v }
+	s := func(v string) *string { return &v }
+	rows := tripExportInvoiceIndex(map[string]tripExportInvoice{
+		"a": {ID: "a", InvoiceType: InvoiceTypeTaxi, InvoiceDate: s("2026-01-02"), AmountCents: cents(3000)},
+		"b": {ID: "b", InvoiceType: InvoiceTypeRailwayTicket, InvoiceDate: s("2026-01-03"), AmountCents: cents(10000)},
+		"c": {ID: "c", InvoiceType: InvoiceTypeTaxi, InvoiceDate: s("2026-01-01"), AmountCents: cents(2050)},
+		"d": {ID: "d"},
+	}, map[string][]string{"a": {"001_x/invoice_a_1.pdf"}})
+
+	got := make([]string, 0, len(rows))
+	for _, r := range rows[1:] {
+		got = append(got, r[0]+"|"+r[4])
+	}
+	want := []string{
+		"铁路电子客票|100.00", "铁路电子客票 小计|100.00",
+		"出租车发票|20.50", "出租车发票|30.00", "出租车发票 小计|50.50",
+		"未分类|", "未分类 小计|0.00",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected rows: %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("row %d = %q, want %q (all: %v)", i, got[i], want[i], got)
+		}
+	}
+	if rows[4][5] != "001_x/invoice_a_1.pdf" {
+		t.Fatalf("expected the zip path of invoice a, got %v", rows[4])
+	}
+}
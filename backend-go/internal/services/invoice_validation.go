@@ -0,0 +1,289 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// Invoice warning codes, see models.InvoiceWarning.
+const (
+	InvoiceWarningTotalMismatch    = "total_mismatch"
+	InvoiceWarningTaxTotalMismatch = "tax_total_mismatch"
+	InvoiceWarningItemTaxMismatch  = "item_tax_mismatch"
+	InvoiceWarningTaxTooLarge      = "tax_too_large"
+	InvoiceWarningNumberFormat     = "invoice_number_format"
+	InvoiceWarningDateInvalid      = "invoice_date_invalid"
+	InvoiceWarningTaxIDFormat      = "tax_id_format"
+	InvoiceWarningTaxIDChecksum    = "tax_id_checksum"
+)
+
+// maxInvoiceTaxShare bounds tax / total: no VAT rate has exceeded 17%, i.e. 17/117 of the total.
+// A larger share almost always means amount and tax were swapped or a digit was lost.
+const maxInvoiceTaxShare = 0.15
+
+var invoiceNumberDigitsRe = regexp.MustCompile(`^\d+$`)
+
+// expectedInvoiceNumberLengths returns the invoice number lengths allowed for an invoice type: 20
+// digits for fully digital invoices (数电票, including railway e-tickets), 8 for invoices that still
+// carry a separate 发票代码. Nil means the type has no fixed rule.
+func expectedInvoiceNumberLengths(invoiceType string) []int {
+	switch invoiceType {
+	case InvoiceTypeDigital, InvoiceTypeRailwayTicket:
+		return []int{20}
+	case InvoiceTypeVATSpecial, InvoiceTypeVATOrdinary:
+		return []int{8}
+	case InvoiceTypeAirItinerary, InvoiceTypeTaxi:
+		return nil
+	}
+	return []int{8, 20}
+}
+
+// validateInvoice cross-checks the stored fields of an invoice against each other and against the
+// line items and party details of its extraction result. now anchors the date plausibility check.
+func validateInvoice(inv *models.Invoice, extracted *InvoiceExtractedData, now time.Time) []models.InvoiceWarning {
+	if inv == nil {
+		return nil
+	}
+	if extracted == nil {
+		extracted = &InvoiceExtractedData{}
+	}
+	var out []models.InvoiceWarning
+	add := func(code, field, format string, args ...any) {
+		out = append(out, models.InvoiceWarning{Code: code, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	near := func(a, b, tolerance float64) bool {
+		return math.Abs(a-b) <= tolerance+1e-9
+	}
+
+	total, tax := inv.Amount, inv.TaxAmount
+	if total != nil && tax != nil && *total > 0 && *tax > *total*maxInvoiceTaxShare {
+		add(InvoiceWarningTaxTooLarge, "tax_amount", "税额 %.2f 占价税合计 %.2f 的比例过高，可能与金额互换或识别错位", *tax, *total)
+	}
+
+	// Line items: amount + tax per row, and their sums against the invoice totals.
+	items := extracted.Items
+	allAmounts, allTaxes := len(items) > 0, len(items) > 0
+	var sumAmount, sumTax float64
+	for i, it := range items {
+		if it.Amount == nil {
+			allAmounts = false
+		} else {
+			sumAmount += *it.Amount
+		}
+		if it.TaxAmount == nil {
+			allTaxes = false
+		} else {
+			sumTax += *it.TaxAmount
+		}
+		if it.Amount != nil && it.TaxRate != nil && it.TaxAmount != nil {
+			want := *it.Amount * *it.TaxRate
+			if !near(want, *it.TaxAmount, 0.02) {
+				add(InvoiceWarningItemTaxMismatch, fmt.Sprintf("items.%d", i), "第 %d 行税额 %.2f 与金额 %.2f × 税率 %g%% = %.2f 不符",
+					i+1, *it.TaxAmount, *it.Amount, math.Round(*it.TaxRate*10000)/100, want)
+			}
+		}
+	}
+	rowTolerance := 0.01 * float64(len(items))
+	if allTaxes && tax != nil && !near(sumTax, *tax, rowTolerance) {
+		add(InvoiceWarningTaxTotalMismatch, "tax_amount", "明细税额合计 %.2f 与税额 %.2f 不符", sumTax, *tax)
+	}
+	if allAmounts && total != nil {
+		taxPart, ok := 0.0, false
+		switch {
+		case tax != nil:
+			taxPart, ok = *tax, true
+		case allTaxes:
+			taxPart, ok = sumTax, true
+		}
+		if ok && !near(sumAmount+taxPart, *total, 0.01) {
+			add(InvoiceWarningTotalMismatch, "amount", "明细金额合计 %.2f 加税额 %.2f 与价税合计 %.2f 不符", sumAmount, taxPart, *total)
+		}
+	}
+
+	if number := strings.TrimSpace(strPtrVal(inv.InvoiceNumber)); number != "" {
+		lengths := expectedInvoiceNumberLengths(inv.InvoiceType)
+		lengthOK := len(lengths) == 0
+		for _, n := range lengths {
+			lengthOK = lengthOK || len(number) == n
+		}
+		if !invoiceNumberDigitsRe.MatchString(number) {
+			add(InvoiceWarningNumberFormat, "invoice_number", "发票号码 %s 含有非数字字符", number)
+		} else if !lengthOK {
+			want := make([]string, 0, len(lengths))
+			for _, n := range lengths {
+				want = append(want, fmt.Sprintf("%d", n))
+			}
+			add(InvoiceWarningNumberFormat, "invoice_number", "发票号码 %s 为 %d 位，该类发票应为 %s 位", number, len(number), strings.Join(want, " 或 "))
+		}
+	}
+
+	if date := strings.TrimSpace(strPtrVal(inv.InvoiceDate)); date != "" {
+		ymd := utils.NormalizeDateYMD(date)
+		day, err := time.ParseInLocation("2006-01-02", ymd, now.Location())
+		switch {
+		case ymd == "" || err != nil:
+			add(InvoiceWarningDateInvalid, "invoice_date", "开票日期 %s 无法识别", date)
+		case day.Year() < 2000:
+			add(InvoiceWarningDateInvalid, "invoice_date", "开票日期 %s 早于 2000 年", ymd)
+		case day.After(now.AddDate(0, 0, 1)):
+			add(InvoiceWarningDateInvalid, "invoice_date", "开票日期 %s 晚于当前日期", ymd)
+		}
+	}
+
+	for _, party := range []struct {
+		field, label string
+		id           *string
+	}{
+		{"buyer_tax_id", "购买方", extracted.BuyerTaxID},
+		{"seller_tax_id", "销售方", extracted.SellerTaxID},
+	} {
+		id := strings.TrimSpace(strPtrVal(party.id))
+		switch {
+		case id == "":
+		case !isValidTaxIDFormat(id):
+			add(InvoiceWarningTaxIDFormat, party.field, "%s纳税人识别号 %s 格式不正确", party.label, id)
+		case !isValidTaxID(id):
+			if _, corrected := checkTaxID(id); corrected != "" {
+				add(InvoiceWarningTaxIDChecksum, party.field, "%s纳税人识别号 %s 校验位不正确，可能是 %s", party.label, id, corrected)
+				out[len(out)-1].Suggestion = corrected
+			} else {
+				add(InvoiceWarningTaxIDChecksum, party.field, "%s纳税人识别号 %s 校验位不正确", party.label, id)
+			}
+		}
+	}
+	return out
+}
+
+// decodeInvoiceExtracted reads a stored extraction result; empty or unreadable payloads give nil.
+func decodeInvoiceExtracted(extractedData *string) *InvoiceExtractedData {
+	if extractedData == nil || strings.TrimSpace(*extractedData) == "" {
+		return nil
+	}
+	var extracted InvoiceExtractedData
+	if err := json.Unmarshal([]byte(*extractedData), &extracted); err != nil {
+		return nil
+	}
+	return &extracted
+}
+
+// applyInvoiceExtracted sets the fields derived from an extraction result on inv: the invoice type
+// with its details, and the consistency warnings. Results stored before classification existed are
+// classified from their raw text.
+func applyInvoiceExtracted(inv *models.Invoice, extracted *InvoiceExtractedData, now time.Time) {
+	if extracted != nil {
+		invoiceType, details := extracted.InvoiceType, extracted.TypeDetails
+		if invoiceType == "" {
+			invoiceType = classifyInvoiceType(extracted.RawText)
+			details = extractInvoiceTypeDetails(invoiceType, extracted.RawText, extracted)
+		}
+		if invoiceType != "" {
+			inv.InvoiceType, inv.TypeDetails = invoiceType, details
+		}
+	}
+	inv.Warnings = validateInvoice(inv, extracted, now)
+	inv.WarningCount = len(inv.Warnings)
+}
+
+// refreshInvoiceDerivedTx re-derives type and warnings of the invoice as currently stored, including
+// the check of its itinerary rides.
+func (s *InvoiceService) refreshInvoiceDerivedTx(tx *gorm.DB, ownerUserID, invoiceID string, extracted *InvoiceExtractedData) error {
+	inv, err := s.repo.WithDB(tx).FindByIDForOwner(ownerUserID, invoiceID)
+	if err != nil {
+		return err
+	}
+	applyInvoiceExtracted(inv, extracted, time.Now())
+	if err := mergeItineraryTypeDetailsTx(tx, inv); err != nil {
+		return err
+	}
+	var rides []models.InvoiceRide
+	if err := tx.Where("owner_user_id = ? AND invoice_id = ?", ownerUserID, invoiceID).Find(&rides).Error; err != nil {
+		return err
+	}
+	inv.Warnings = append(inv.Warnings, validateInvoiceRides(inv, rides)...)
+	inv.WarningCount = len(inv.Warnings)
+	if err := applyBuyerCheckTx(tx, inv, extracted); err != nil {
+		return err
+	}
+	return s.repo.WithDB(tx).UpdateForOwner(ownerUserID, invoiceID, map[string]interface{}{
+		"invoice_type":  inv.InvoiceType,
+		"type_details":  jsonColumnValue(inv.TypeDetails),
+		"warnings":      jsonColumnValue(inv.Warnings),
+		"warning_count": inv.WarningCount,
+		"buyer_check":   inv.BuyerCheck,
+	})
+}
+
+// refreshInvoiceDerived re-runs the validation after the invoice fields were edited, using the
+// stored extraction result.
+func (s *InvoiceService) refreshInvoiceDerived(ownerUserID, invoiceID string) error {
+	inv, err := s.repo.FindByIDForOwner(ownerUserID, invoiceID)
+	if err != nil {
+		return err
+	}
+	extractedData := inv.ExtractedData
+	if blob, err := s.blobRepo.FindInvoiceBlob(ownerUserID, invoiceID); err == nil && blob != nil {
+		extractedData = blob.ExtractedData
+	}
+	return s.refreshInvoiceDerivedTx(s.db, ownerUserID, invoiceID, decodeInvoiceExtracted(extractedData))
+}
+
+// setPartyTaxIDs writes edited buyer/seller taxpayer numbers into the stored extraction result, where
+// they are kept, and re-derives the warnings and the buyer check from it. "" removes a number.
+func (s *InvoiceService) setPartyTaxIDs(ownerUserID, invoiceID string, buyerTaxID, sellerTaxID *string) error {
+	inv, err := s.repo.FindByIDForOwner(ownerUserID, invoiceID)
+	if err != nil {
+		return err
+	}
+	extractedData, rawText := inv.ExtractedData, inv.RawText
+	if blob, err := s.blobRepo.FindInvoiceBlob(ownerUserID, invoiceID); err == nil && blob != nil {
+		extractedData, rawText = blob.ExtractedData, blob.RawText
+	}
+
+	payload := map[string]any{}
+	if extractedData != nil && strings.TrimSpace(*extractedData) != "" {
+		if err := json.Unmarshal([]byte(*extractedData), &payload); err != nil {
+			return fmt.Errorf("invalid extracted data: %w", err)
+		}
+	}
+	for key, id := range map[string]*string{"buyer_tax_id": buyerTaxID, "seller_tax_id": sellerTaxID} {
+		if id == nil {
+			continue
+		}
+		if v := strings.ToUpper(strings.TrimSpace(*id)); v != "" {
+			payload[key] = v
+		} else {
+			delete(payload, key)
+		}
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	updated := string(encoded)
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return s.storeInvoiceBlobTx(tx, ownerUserID, invoiceID, &updated, rawText)
+	})
+}
+
+// jsonColumnValue encodes a serializer:json field for a map update, which bypasses the serializer.
+// Nil and empty values are stored as NULL.
+func jsonColumnValue(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	switch string(b) {
+	case "null", "[]", "{}":
+		return nil
+	}
+	return string(b)
+}
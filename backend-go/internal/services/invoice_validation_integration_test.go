@@ -0,0 +1,115 @@
+//go:build cgo
+
+package services
+
+import "testing"
+
+func TestInvoiceWarningsPersistAndFilter(t *testing.T) {
+	db := openServiceTestDB(t)
+	service := NewInvoiceService(db, t.TempDir())
+
+	f := func(v float64) *float64 { return &v }
+	s := func(v string) *string { return &v }
+	invoice, err := service.CreateFromExtracted("owner-1", CreateInvoiceInput{
+		Filename:     "invoice.xml",
+		OriginalName: "invoice.xml",
+		FilePath:     "uploads/owner-1/invoice.xml",
+		Source:       "email",
+	}, InvoiceExtractedData{
+		InvoiceNumber: s("25117000000123456789"),
+		InvoiceDate:   s("2026-10-09"),
+		Amount:        f(120),
+		TaxAmount:     f(6),
+		RawText:       "电子发票（普通发票）",
+		Items: []InvoiceLineItem{
+			{Name: "*餐饮服务*餐费", Amount: f(100), TaxRate: f(0.06), TaxAmount: f(6)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("创建发票失败: %v", err)
+	}
+	if invoice.WarningCount != 1 || invoice.Warnings[0].Code != InvoiceWarningTotalMismatch {
+		t.Fatalf("创建时应标记价税合计不符: %#v", invoice.Warnings)
+	}
+	clean, err := service.CreateFromExtracted("owner-1", CreateInvoiceInput{
+		Filename:     "clean.xml",
+		OriginalName: "clean.xml",
+		FilePath:     "uploads/owner-1/clean.xml",
+		Source:       "email",
+	}, InvoiceExtractedData{
+		InvoiceNumber: s("25117000000123456790"),
+		InvoiceDate:   s("2026-10-09"),
+		Amount:        f(106),
+		TaxAmount:     f(6),
+	})
+	if err != nil {
+		t.Fatalf("创建发票失败: %v", err)
+	}
+
+	list, total, err := service.List("owner-1", InvoiceFilterInput{HasWarnings: true})
+	if err != nil {
+		t.Fatalf("查询发票失败: %v", err)
+	}
+	if total != 1 || len(list) != 1 || list[0].ID != invoice.ID || len(list[0].Warnings) != 1 || list[0].Warnings[0].Field != "amount" {
+		t.Fatalf("按校验警告筛选异常: total=%d %#v", total, list)
+	}
+
+	// Correcting the total clears the warning; breaking the number raises a new one.
+	if err := service.Update("owner-1", invoice.ID, UpdateInvoiceInput{Amount: f(106)}); err != nil {
+		t.Fatalf("更新发票失败: %v", err)
+	}
+	got, err := service.GetByID("owner-1", invoice.ID)
+	if err != nil {
+		t.Fatalf("读取发票失败: %v", err)
+	}
+	if got.WarningCount != 0 || len(got.Warnings) != 0 {
+		t.Fatalf("修正金额后警告应清除: %#v", got.Warnings)
+	}
+	if err := service.Update("owner-1", clean.ID, UpdateInvoiceInput{InvoiceNumber: s("2511700000012345")}); err != nil {
+		t.Fatalf("更新发票失败: %v", err)
+	}
+	got, err = service.GetByID("owner-1", clean.ID)
+	if err != nil {
+		t.Fatalf("读取发票失败: %v", err)
+	}
+	if got.WarningCount != 1 || got.Warnings[0].Code != InvoiceWarningNumberFormat {
+		t.Fatalf("发票号码位数异常应被标记: %#v", got.Warnings)
+	}
+
+	// A misread taxpayer number is kept as printed until the user accepts the proposed correction.
+	misread, err := service.CreateFromExtracted("owner-1", CreateInvoiceInput{
+		Filename:     "misread.xml",
+		OriginalName: "misread.xml",
+		FilePath:     "uploads/owner-1/misread.xml",
+		Source:       "email",
+	}, InvoiceExtractedData{
+		InvoiceNumber: s("25117000000123456791"),
+		InvoiceDate:   s("2026-10-09"),
+		Amount:        f(106),
+		TaxAmount:     f(6),
+		SellerTaxID:   s("91310000132200B21H"),
+	})
+	if err != nil {
+		t.Fatalf("创建发票失败: %v", err)
+	}
+	if misread.WarningCount != 1 || misread.Warnings[0].Code != InvoiceWarningTaxIDChecksum || misread.Warnings[0].Suggestion != "91310000132200821H" {
+		t.Fatalf("税号校验位错误应给出建议: %#v", misread.Warnings)
+	}
+	if err := service.Update("owner-1", misread.ID, UpdateInvoiceInput{SellerTaxID: s(misread.Warnings[0].Suggestion)}); err != nil {
+		t.Fatalf("采用税号建议失败: %v", err)
+	}
+	got, err = service.GetByID("owner-1", misread.ID)
+	if err != nil {
+		t.Fatalf("读取发票失败: %v", err)
+	}
+	if got.WarningCount != 0 {
+		t.Fatalf("采用建议后警告应清除: %#v", got.Warnings)
+	}
+	extracted := decodeInvoiceExtracted(got.ExtractedData)
+	if blob, err := service.blobRepo.FindInvoiceBlob("owner-1", misread.ID); err == nil {
+		extracted = decodeInvoiceExtracted(blob.ExtractedData)
+	}
+	if extracted == nil || strPtrVal(extracted.SellerTaxID) != "91310000132200821H" || strPtrVal(extracted.InvoiceNumber) != "25117000000123456791" {
+		t.Fatalf("识别结果应保存采用的税号并保留其他字段: %#v", extracted)
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"smart-bill-manager/internal/models"
+)
+
+func warningCodes(ws []models.InvoiceWarning) map[string]string {
+	out := make(map[string]string, len(ws))
+	for _, w := range ws {
+		out[w.Field] = w.Code
+	}
+	return out
+}
+
+func TestValidateInvoiceConsistent(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	s := func(v string) *string { return &v }
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.Local)
+	inv := &models.Invoice{
+		InvoiceType:   InvoiceTypeDigital,
+		InvoiceNumber: s("25117000000123456789"),
+		InvoiceDate:   s("2026年10月09日"),
+		Amount:        f(332),
+		TaxAmount:     f(32),
+	}
+	extracted := &InvoiceExtractedData{
+		BuyerTaxID:  s("91110108MA01KX2P7A"),
+		SellerTaxID: s("91310000132200821H"),
+		Items: []InvoiceLineItem{
+			{Name: "*餐饮服务*餐费", Amount: f(100), TaxRate: f(0.06), TaxAmount: f(6)},
+			{Name: "*日用品*纸巾", Amount: f(200), TaxRate: f(0.13), TaxAmount: f(26)},
+		},
+	}
+	if got := validateInvoice(inv, extracted, now); len(got) != 0 {
+		t.Fatalf("expected no warnings, got %+v", got)
+	}
+}
+
+func TestValidateInvoiceFlagsAnomalies(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	s := func(v string) *string { return &v }
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.Local)
+	inv := &models.Invoice{
+		InvoiceType:   InvoiceTypeDigital,
+		InvoiceNumber: s("12345678"),
+		InvoiceDate:   s("2027-01-05"),
+		Amount:        f(350),
+		TaxAmount:     f(32),
+	}
+	extracted := &InvoiceExtractedData{
+		SellerTaxID: s("9131000013220082OH"),
+		Items: []InvoiceLineItem{
+			{Name: "*餐饮服务*餐费", Amount: f(100), TaxRate: f(0.06), TaxAmount: f(9)},
+			{Name: "*日用品*纸巾", Amount: f(200), TaxRate: f(0.13), TaxAmount: f(26)},
+		},
+	}
+	got := warningCodes(validateInvoice(inv, extracted, now))
+	want := map[string]string{
+		"amount":         InvoiceWarningTotalMismatch,
+		"tax_amount":     InvoiceWarningTaxTotalMismatch,
+		"items.0":        InvoiceWarningItemTaxMismatch,
+		"invoice_number": InvoiceWarningNumberFormat,
+		"invoice_date":   InvoiceWarningDateInvalid,
+		"seller_tax_id":  InvoiceWarningTaxIDFormat,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected warnings: %+v", got)
+	}
+	for field, code := range want {
+		if got[field] != code {
+			t.Fatalf("field %s: got %q, want %q (all: %+v)", field, got[field], code, got)
+		}
+	}
+}
+
+func TestValidateInvoiceTaxIDChecksum(t *testing.T) {
+	s := func(v string) *string { return &v }
+	inv := &models.Invoice{InvoiceType: InvoiceTypeOther}
+	extracted := &InvoiceExtractedData{BuyerTaxID: s("91310000132200822H"), SellerTaxID: s("9111010873557S307R")}
+	got := validateInvoice(inv, extracted, time.Now())
+	if len(got) != 2 || got[0].Code != InvoiceWarningTaxIDChecksum || got[1].Code != InvoiceWarningTaxIDFormat {
+		t.Fatalf("unexpected warnings: %+v", got)
+	}
+	extracted.SellerTaxID = nil
+	// A single misread character comes with the number that passes.
+	extracted.BuyerTaxID = s("91310000132200B21H")
+	if got := validateInvoice(inv, extracted, time.Now()); len(got) != 1 || !strings.Contains(got[0].Message, "91310000132200821H") ||
+		got[0].Suggestion != "91310000132200821H" {
+		t.Fatalf("unexpected warnings: %+v", got)
+	}
+}
+
+func TestValidateInvoiceSwappedTax(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	got := validateInvoice(&models.Invoice{Amount: f(13), TaxAmount: f(113)}, nil, time.Now())
+	if len(got) != 1 || got[0].Code != InvoiceWarningTaxTooLarge || got[0].Field != "tax_amount" {
+		t.Fatalf("expected tax_too_large, got %+v", got)
+	}
+}
+
+func TestExpectedInvoiceNumberLengths(t *testing.T) {
+	if got := expectedInvoiceNumberLengths(InvoiceTypeRailwayTicket); len(got) != 1 || got[0] != 20 {
+		t.Fatalf("railway ticket: got %v", got)
+	}
+	if got := expectedInvoiceNumberLengths(InvoiceTypeVATSpecial); len(got) != 1 || got[0] != 8 {
+		t.Fatalf("legacy special invoice: got %v", got)
+	}
+	if got := expectedInvoiceNumberLengths(InvoiceTypeAirItinerary); got != nil {
+		t.Fatalf("air itinerary: got %v", got)
+	}
+	if got := expectedInvoiceNumberLengths(""); len(got) != 2 {
+		t.Fatalf("unclassified invoice: got %v", got)
+	}
+}
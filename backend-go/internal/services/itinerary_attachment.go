@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"smart-bill-manager/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// parseItineraryAttachmentCtx reads an itinerary attached to an invoice (e.g. the air itinerary sent
+// along with a flight's VAT invoice, or the 行程单 of a ride-hailing invoice) and stores its journeys,
+// rides and fares with the invoice. Parsing is best effort: an itinerary that cannot be read is
+// simply kept as a file.
+func (s *InvoiceService) parseItineraryAttachmentCtx(ctx context.Context, a *models.InvoiceAttachment) {
+	filePath := a.FilePath
+	if !filepath.IsAbs(filePath) {
+		filePath = filepath.Join(s.uploadsDir, "..", filePath)
+	}
+	_, _, _, _, _, _, extractedData, _, parseStatus, _ := s.parseInvoiceFile(filePath, a.Filename)
+	if parseStatus != "success" {
+		return
+	}
+	// OCR may outlast the caller's read timeout; the attachment row is already stored either way.
+	if err := s.applyItineraryAttachmentCtx(context.WithoutCancel(ctx), a, decodeInvoiceExtracted(extractedData)); err != nil {
+		log.Printf("[Itinerary] 保存行程单信息失败 invoice_id=%s attachment_id=%s err=%v", a.InvoiceID, a.ID, err)
+	}
+}
+
+// applyItineraryAttachmentCtx stores the type details, journey segments and rides read from itinerary
+// attachment a, then refreshes the invoice so its type details pick up the fares and its rides are
+// checked against its amount.
+func (s *InvoiceService) applyItineraryAttachmentCtx(ctx context.Context, a *models.InvoiceAttachment, extracted *InvoiceExtractedData) error {
+	if extracted == nil || (len(extracted.Journeys) == 0 && len(extracted.Rides) == 0 && extracted.TypeDetails == nil) {
+		return nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	segments := extracted.Journeys
+	if d := extracted.TypeDetails; d != nil {
+		for i := range segments {
+			if segments[i].Passenger == "" {
+				segments[i].Passenger = strPtrVal(d.Passenger)
+			}
+			if segments[i].TicketNumber == "" {
+				segments[i].TicketNumber = strPtrVal(d.TicketNumber)
+			}
+		}
+	}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.InvoiceAttachment{}).
+			Where("id = ? AND owner_user_id = ?", a.ID, a.OwnerUserID).
+			Update("type_details", jsonColumnValue(extracted.TypeDetails)).Error; err != nil {
+			return err
+		}
+		if err := s.rideRepo.ReplaceForAttachment(tx, a.OwnerUserID, a.InvoiceID, a.ID, rideRows(extracted.Rides)); err != nil {
+			return err
+		}
+		return s.journeyRepo.ReplaceForAttachment(tx, a.OwnerUserID, a.InvoiceID, a.ID, journeySegmentRows(segments))
+	})
+	if err != nil {
+		return err
+	}
+	a.TypeDetails = extracted.TypeDetails
+	return s.refreshInvoiceDerived(a.OwnerUserID, a.InvoiceID)
+}
+
+// mergeItineraryTypeDetailsTx fills unset type details of inv from its itinerary attachments.
+func mergeItineraryTypeDetailsTx(tx *gorm.DB, inv *models.Invoice) error {
+	var attachments []models.InvoiceAttachment
+	if err := tx.Where("owner_user_id = ? AND invoice_id = ? AND kind = ? AND type_details IS NOT NULL", inv.OwnerUserID, inv.ID, "itinerary").
+		Order("created_at ASC, id ASC").
+		Find(&attachments).Error; err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		inv.TypeDetails = mergeInvoiceTypeDetails(inv.TypeDetails, a.TypeDetails)
+	}
+	return nil
+}
+
+// mergeInvoiceTypeDetails returns dst with its unset fields taken from src.
+func mergeInvoiceTypeDetails(dst, src *InvoiceTypeDetails) *InvoiceTypeDetails {
+	if src == nil {
+		return dst
+	}
+	var out InvoiceTypeDetails
+	if dst != nil {
+		out = *dst
+	}
+	for _, f := range []struct{ dst, src **string }{
+		{&out.Passenger, &src.Passenger},
+		{&out.TicketNumber, &src.TicketNumber},
+		{&out.PlateNumber, &src.PlateNumber},
+		{&out.PeriodStart, &src.PeriodStart},
+		{&out.PeriodEnd, &src.PeriodEnd},
+	} {
+		if *f.dst == nil || strings.TrimSpace(**f.dst) == "" {
+			*f.dst = *f.src
+		}
+	}
+	for _, f := range []struct{ dst, src **float64 }{
+		{&out.Fare, &src.Fare},
+		{&out.FuelSurcharge, &src.FuelSurcharge},
+		{&out.DevelopmentFund, &src.DevelopmentFund},
+		{&out.OtherTaxes, &src.OtherTaxes},
+		{&out.Total, &src.Total},
+	} {
+		if *f.dst == nil {
+			*f.dst = *f.src
+		}
+	}
+	if out == (InvoiceTypeDetails{}) {
+		return nil
+	}
+	return &out
+}
@@ -0,0 +1,81 @@
+//go:build cgo
+
+package services
+
+import (
+	"context"
+	"testing"
+)
+
+func TestItineraryAttachmentAddsFlightsAndFares(t *testing.T) {
+	db := openServiceTestDB(t)
+	invoices := NewInvoiceService(db, t.TempDir())
+	ctx := context.Background()
+
+	f := func(v float64) *float64 { return &v }
+	inv, err := invoices.CreateFromExtracted("owner-1", CreateInvoiceInput{
+		Filename:     "air.pdf",
+		OriginalName: "air.pdf",
+		FilePath:     "uploads/owner-1/air.pdf",
+		Source:       "upload",
+	}, InvoiceExtractedData{Amount: f(2170), InvoiceType: InvoiceTypeDigital})
+	if err != nil {
+		t.Fatalf("创建发票失败: %v", err)
+	}
+	// The file does not exist, so the automatic parse leaves the attachment as is.
+	att, err := invoices.CreateAttachmentCtx(ctx, "owner-1", inv.ID, CreateInvoiceAttachmentInput{
+		Kind:         "itinerary",
+		Filename:     "itinerary.pdf",
+		OriginalName: "行程单.pdf",
+		FilePath:     "uploads/owner-1/itinerary.pdf",
+	})
+	if err != nil {
+		t.Fatalf("创建附件失败: %v", err)
+	}
+	if att.TypeDetails != nil {
+		t.Fatalf("无法解析的行程单不应带类型信息: %#v", att.TypeDetails)
+	}
+
+	err = invoices.applyItineraryAttachmentCtx(ctx, att, &InvoiceExtractedData{
+		InvoiceType: InvoiceTypeAirItinerary,
+		TypeDetails: &InvoiceTypeDetails{Passenger: ptrString("张三"), Fare: f(2100), DevelopmentFund: f(50), Total: f(2220)},
+		Journeys: []JourneySegment{{
+			Mode: JourneyModeAir, Carrier: "东航", Number: "MU5156", Origin: "北京首都", Destination: "上海虹桥",
+			DepartureTime: "2025-10-17T13:30:00+08:00",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("保存行程单信息失败: %v", err)
+	}
+
+	got, err := invoices.GetByID("owner-1", inv.ID)
+	if err != nil {
+		t.Fatalf("读取发票失败: %v", err)
+	}
+	if got.InvoiceType != InvoiceTypeDigital || got.TypeDetails == nil || valueOrZero(got.TypeDetails.Total) != 2220 ||
+		valueOrZero(got.TypeDetails.DevelopmentFund) != 50 || strPtrVal(got.TypeDetails.Passenger) != "张三" {
+		t.Fatalf("发票应带上行程单的票价信息: %q %#v", got.InvoiceType, got.TypeDetails)
+	}
+	if len(got.Journeys) != 1 || strPtrVal(got.Journeys[0].AttachmentID) != att.ID || strPtrVal(got.Journeys[0].Passenger) != "张三" {
+		t.Fatalf("航段应关联到行程单附件: %#v", got.Journeys)
+	}
+
+	// Re-syncing the invoice's own segments keeps the itinerary's.
+	if err := invoices.syncJourneySegmentsTx(db, "owner-1", inv.ID, nil); err != nil {
+		t.Fatalf("同步发票行程段失败: %v", err)
+	}
+	if got, _ = invoices.GetByID("owner-1", inv.ID); len(got.Journeys) != 1 {
+		t.Fatalf("行程单航段不应被发票自身的行程段覆盖: %#v", got.Journeys)
+	}
+
+	if err := invoices.DeleteAttachmentCtx(ctx, "owner-1", inv.ID, att.ID); err != nil {
+		t.Fatalf("删除附件失败: %v", err)
+	}
+	got, err = invoices.GetByID("owner-1", inv.ID)
+	if err != nil {
+		t.Fatalf("读取发票失败: %v", err)
+	}
+	if len(got.Journeys) != 0 || (got.TypeDetails != nil && got.TypeDetails.Total != nil) {
+		t.Fatalf("删除行程单后应移除航段和票价: %#v %#v", got.Journeys, got.TypeDetails)
+	}
+}
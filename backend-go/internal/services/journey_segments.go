@@ -0,0 +1,66 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// Journey modes stored in models.JourneySegment.Mode.
+const (
+	JourneyModeRail = "rail"
+	JourneyModeAir  = "air"
+)
+
+// JourneySegment is one leg of a transport ticket as extracted, see models.JourneySegment.
+// DepartureTime is RFC3339 with the ticket's local offset.
+type JourneySegment struct {
+	Mode          string `json:"mode"`
+	Carrier       string `json:"carrier,omitempty"`
+	Number        string `json:"number,omitempty"`
+	Origin        string `json:"origin,omitempty"`
+	Destination   string `json:"destination,omitempty"`
+	DepartureTime string `json:"departure_time,omitempty"`
+	SeatClass     string `json:"seat_class,omitempty"`
+	SeatNumber    string `json:"seat_number,omitempty"`
+	Passenger     string `json:"passenger,omitempty"`
+	TicketNumber  string `json:"ticket_number,omitempty"`
+}
+
+// syncJourneySegmentsTx replaces the stored journey segments of an invoice with segments.
+func (s *InvoiceService) syncJourneySegmentsTx(tx *gorm.DB, ownerUserID, invoiceID string, segments []JourneySegment) error {
+	return s.journeyRepo.ReplaceForInvoice(tx, ownerUserID, invoiceID, journeySegmentRows(segments))
+}
+
+// journeySegmentRows converts extracted segments to rows, skipping segments without a mode.
+func journeySegmentRows(segments []JourneySegment) []models.JourneySegment {
+	rows := make([]models.JourneySegment, 0, len(segments))
+	for _, seg := range segments {
+		mode := strings.TrimSpace(seg.Mode)
+		if mode == "" {
+			continue
+		}
+		row := models.JourneySegment{
+			ID:           utils.GenerateUUID(),
+			Mode:         mode,
+			Carrier:      ptrString(seg.Carrier),
+			Number:       ptrString(seg.Number),
+			Origin:       ptrString(seg.Origin),
+			Destination:  ptrString(seg.Destination),
+			SeatClass:    ptrString(seg.SeatClass),
+			SeatNumber:   ptrString(seg.SeatNumber),
+			Passenger:    ptrString(seg.Passenger),
+			TicketNumber: ptrString(seg.TicketNumber),
+		}
+		if t, err := time.Parse(time.RFC3339, strings.TrimSpace(seg.DepartureTime)); err == nil {
+			row.DepartureTime = ptrString(t.Format(time.RFC3339))
+			row.DepartureTs = unixMilli(t)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -8,6 +8,7 @@ import (
 	"unicode"
 
 	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/money"
 )
 
 var (
@@ -170,15 +171,47 @@ func merchantScore(invoiceSeller *string, paymentMerchant *string) float64 {
 }
 
 func computeInvoicePaymentScore(invoice *models.Invoice, payment *models.Payment) float64 {
-	score, _, _, _ := computeInvoicePaymentScoreBreakdown(invoice, payment)
+	score, _, _, _ := computeInvoicePaymentScoreBreakdown(invoice, payment, nil)
 	return score
 }
 
-func computeInvoicePaymentScoreBreakdown(invoice *models.Invoice, payment *models.Payment) (score, aScore, dScore, mScore float64) {
+// paymentAmountIn returns the payment amount expressed in currency, converted at the payment
+// date. Without a converter or a rate, amounts in different currencies score as no match.
+func paymentAmountIn(conv *currencyConverter, payment *models.Payment, currency string) float64 {
+	from := normalizeCurrencyOrDefault(payment.Currency)
+	to := normalizeCurrencyOrDefault(currency)
+	if from == to {
+		return payment.Amount
+	}
+	if conv == nil {
+		return 0
+	}
+	day := payment.TransactionTime
+	if len(day) > 10 {
+		day = day[:10]
+	}
+	cents, err := money.FromMajor(payment.Amount)
+	if err != nil {
+		return 0
+	}
+	cents, ok := conv.convert(cents, from, to, day)
+	if !ok {
+		return 0
+	}
+	return money.ToMajor(cents)
+}
+
+func computeInvoicePaymentScoreBreakdown(invoice *models.Invoice, payment *models.Payment, conv *currencyConverter) (score, aScore, dScore, mScore float64) {
 	if invoice == nil || payment == nil {
 		return 0, 0, 0, 0
 	}
-	aScore = amountScore(invoice.Amount, payment.Amount)
+	paid := paymentAmountIn(conv, payment, invoice.Currency)
+	aScore = amountScore(invoice.Amount, paid)
+	if d := invoice.TypeDetails; d != nil && d.Total != nil {
+		// Air itineraries: the passenger pays the itinerary total, which can include the development
+		// fund the invoice amount leaves out.
+		aScore = math.Max(aScore, amountScore(d.Total, paid))
+	}
 	dScore = dateScore(invoice.InvoiceDate, payment.TransactionTime)
 	mScore = merchantScore(invoice.SellerName, payment.Merchant)
 
@@ -1,6 +1,10 @@
 package services
 
-import "testing"
+import (
+	"testing"
+
+	"smart-bill-manager/internal/models"
+)
 
 func TestParseFlexibleDateTime(t *testing.T) {
 	cases := []struct {
@@ -34,3 +38,26 @@ func TestNormalizeNameAndSimilarity(t *testing.T) {
 		t.Fatalf("expected high similarity, got %v", bigramJaccard(a, b))
 	}
 }
+
+func TestAmountScoreComparesConvertedAmounts(t *testing.T) {
+	conv := &currencyConverter{
+		base: "CNY",
+		rates: map[string][]models.ExchangeRate{
+			"USD": {{Currency: "USD", Date: "2025-10-01", Rate: 7.1}},
+		},
+	}
+	amount := 71.0
+	invoice := &models.Invoice{Amount: &amount, Currency: "CNY"}
+	payment := &models.Payment{Amount: 10, Currency: "USD", TransactionTime: "2025-10-11T10:00:00Z"}
+
+	if _, aScore, _, _ := computeInvoicePaymentScoreBreakdown(invoice, payment, conv); aScore != 1 {
+		t.Fatalf("converted amount should match exactly, got %v", aScore)
+	}
+	if _, aScore, _, _ := computeInvoicePaymentScoreBreakdown(invoice, payment, nil); aScore != 0 {
+		t.Fatalf("amounts in different currencies without rates should not match, got %v", aScore)
+	}
+	payment.Currency = "EUR"
+	if _, aScore, _, _ := computeInvoicePaymentScoreBreakdown(invoice, payment, conv); aScore != 0 {
+		t.Fatalf("currency without rate should not match, got %v", aScore)
+	}
+}
@@ -97,6 +97,7 @@ var (
 	// Avoid matching non-money ids like "ZZHK-0007-..." where "-0007" is not an amount.
 	negativeAmountRegex   = regexp.MustCompile("[-\u2212]\\s*(?:[\u00A5￥]\\s*)?(\\d+(?:,\\d{3})*(?:\\.\\d{1,2}))")
 	merchantFullNameRegex = regexp.MustCompile(`商户全称[：:]?[\s]*([^\n收单机构支付方式]+?)[\s]*(?:收单机构|支付方式|\n|$)`)
+	refundStatusRegex     = regexp.MustCompile(`退款成功|退款中|已退款|退款到账|已全额退款|部分退款|退款详情|退款金额|退款单号`)
 	merchantGenericRegex  = regexp.MustCompile(`([^\n]+(?:店|行|公司|商户|超市|餐厅|饭店|有限公司))`)
 
 	// Pattern to insert space between Chinese date and time when 日 is directly followed by digits
@@ -147,6 +148,15 @@ func ocrEngineInstallHint(engine string) string {
 	return fmt.Sprintf("install rapidocr==3.* and onnxruntime (engine=%s)", engine)
 }
 
+// Payment platforms recognized from screenshots.
+const (
+	PaymentPlatformWeChat   = "wechat"
+	PaymentPlatformAlipay   = "alipay"
+	PaymentPlatformJD       = "jd"
+	PaymentPlatformUnionPay = "unionpay"
+	PaymentPlatformBank     = "bank"
+)
+
 // PaymentExtractedData represents extracted payment information
 type PaymentExtractedData struct {
 	Amount                    *float64 `json:"amount"`
@@ -164,15 +174,23 @@ type PaymentExtractedData struct {
 	OrderNumber               *string  `json:"order_number"`
 	OrderNumberSource         string   `json:"order_number_source,omitempty"`
 	OrderNumberConfidence     float64  `json:"order_number_confidence,omitempty"`
+	Platform                  string   `json:"platform,omitempty"` // wechat|alipay|jd|unionpay|bank
+	IsRefund                  bool     `json:"is_refund,omitempty"`
+	RefundOfID                *string  `json:"refund_of_id,omitempty"` // proposed original payment
+	RefundOfSource            string   `json:"refund_of_source,omitempty"`
 	RawText                   string   `json:"raw_text"`
 	PrettyText                string   `json:"pretty_text,omitempty"`
 }
 
 type InvoiceLineItem struct {
-	Name     string   `json:"name"`
-	Spec     string   `json:"spec,omitempty"`
-	Unit     string   `json:"unit,omitempty"`
-	Quantity *float64 `json:"quantity,omitempty"`
+	Name      string   `json:"name"`
+	Spec      string   `json:"spec,omitempty"`
+	Unit      string   `json:"unit,omitempty"`
+	Quantity  *float64 `json:"quantity,omitempty"`
+	UnitPrice *float64 `json:"unit_price,omitempty"`
+	Amount    *float64 `json:"amount,omitempty"`   // excluding tax
+	TaxRate   *float64 `json:"tax_rate,omitempty"` // fraction, e.g. 0.13; 0 for tax-exempt rows
+	TaxAmount *float64 `json:"tax_amount,omitempty"`
 }
 
 type ExtractionCandidate struct {
@@ -198,6 +216,7 @@ type InvoiceExtractionTrace struct {
 	SellerCandidates []ExtractionCandidate `json:"seller_candidates,omitempty"`
 	AmountCandidates []MoneyCandidate      `json:"amount_candidates,omitempty"`
 	TaxCandidates    []MoneyCandidate      `json:"tax_candidates,omitempty"`
+	TaxIDChecks      []TaxIDCheck          `json:"tax_id_checks,omitempty"`
 }
 
 // InvoiceExtractedData represents extracted invoice information
@@ -220,7 +239,13 @@ type InvoiceExtractedData struct {
 	BuyerName               *string                 `json:"buyer_name"`
 	BuyerNameSource         string                  `json:"buyer_name_source,omitempty"`
 	BuyerNameConfidence     float64                 `json:"buyer_name_confidence,omitempty"`
+	BuyerTaxID              *string                 `json:"buyer_tax_id,omitempty"`
+	SellerTaxID             *string                 `json:"seller_tax_id,omitempty"`
+	InvoiceType             string                  `json:"invoice_type,omitempty"`
+	TypeDetails             *InvoiceTypeDetails     `json:"type_details,omitempty"`
 	Items                   []InvoiceLineItem       `json:"items,omitempty"`
+	Journeys                []JourneySegment        `json:"journeys,omitempty"`
+	Rides                   []RideRecord            `json:"rides,omitempty"`
 	RawText                 string                  `json:"raw_text"`
 	RawTextSource           string                  `json:"raw_text_source,omitempty"` // pymupdf/rapidocr
 	PrettyText              string                  `json:"pretty_text,omitempty"`
@@ -285,13 +310,22 @@ func (s *OCRService) RecognizeWithRapidOCRProfile(imagePath, profile string) (st
 }
 
 func (s *OCRService) recognizeWithRapidOCRArgs(imagePath string, extraArgs []string) (string, error) {
+	result, err := s.recognizeWithRapidOCRResult(imagePath, extraArgs)
+	if err != nil {
+		return "", err
+	}
+	return result.Text, nil
+}
+
+// recognizeWithRapidOCRResult runs OCR and returns the full response, including line boxes.
+func (s *OCRService) recognizeWithRapidOCRResult(imagePath string, extraArgs []string) (*OCRCLIResponse, error) {
 	// One OCR job can be CPU-heavy (and may spawn external processes).
 	// Limit concurrent OCR to keep the server responsive.
 	ctx, cancel := context.WithTimeout(context.Background(), rapidOCRTimeout)
 	defer cancel()
 	release, err := acquireWithTimeout(ctx, limitOCR, rapidOCRTimeout, "ocr")
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer release()
 
@@ -326,7 +360,7 @@ func (s *OCRService) recognizeWithRapidOCRArgs(imagePath string, extraArgs []str
 					} else {
 						fmt.Printf("[OCR] OCR(worker) extracted %d lines, %d characters (engine=%s profile=%s backend=%s)\n", result.LineCount, len(result.Text), engine, usedProfile, be)
 					}
-					return result.Text, nil
+					return &result, nil
 				}
 				if parseErr != nil {
 					fmt.Printf("[OCR] OCR worker JSON parse failed: %v\n", parseErr)
@@ -344,7 +378,7 @@ func (s *OCRService) recognizeWithRapidOCRArgs(imagePath string, extraArgs []str
 	// Find the OCR CLI script
 	scriptPath := s.findOCRCLIScript()
 	if scriptPath == "" {
-		return "", fmt.Errorf("ocr_cli.py script not found")
+		return nil, fmt.Errorf("ocr_cli.py script not found")
 	}
 
 	// Execute Python script
@@ -370,15 +404,15 @@ func (s *OCRService) recognizeWithRapidOCRArgs(imagePath string, extraArgs []str
 	if err := unmarshalPossiblyNoisyJSON(output, &result); err != nil {
 		if execErr != nil {
 			fmt.Printf("[OCR] RapidOCR CLI exec error: %v, output=%s\n", execErr, stripANSIEscapes(string(output)))
-			return "", fmt.Errorf("failed to execute RapidOCR CLI: %w (output: %s)", execErr, string(output))
+			return nil, fmt.Errorf("failed to execute RapidOCR CLI: %w (output: %s)", execErr, string(output))
 		}
 		fmt.Printf("[OCR] RapidOCR CLI JSON parse失败: %v, output=%s\n", err, stripANSIEscapes(string(output)))
-		return "", fmt.Errorf("failed to parse OCR CLI output: %w (output: %s)", err, string(output))
+		return nil, fmt.Errorf("failed to parse OCR CLI output: %w (output: %s)", err, string(output))
 	}
 
 	if !result.Success {
 		fmt.Printf("[OCR] RapidOCR CLI returned error: %s, output=%s\n", result.Error, stripANSIEscapes(string(output)))
-		return "", fmt.Errorf("OCR error: %s", result.Error)
+		return nil, fmt.Errorf("OCR error: %s", result.Error)
 	}
 
 	engine := result.Engine
@@ -409,7 +443,7 @@ func (s *OCRService) recognizeWithRapidOCRArgs(imagePath string, extraArgs []str
 	} else {
 		fmt.Printf("[OCR] OCR extracted %d lines, %d characters (engine=%s profile=%s backend=%s)\n", result.LineCount, len(result.Text), engine, profile, be)
 	}
-	return result.Text, nil
+	return &result, nil
 }
 
 func stripANSIEscapes(s string) string {
@@ -538,21 +572,31 @@ func (s *OCRService) isRapidOCRAvailable() bool {
 
 // RecognizePaymentScreenshot performs OCR for payment screenshots (RapidOCR v3 only).
 func (s *OCRService) RecognizePaymentScreenshot(imagePath string) (string, error) {
+	result, err := s.RecognizePaymentScreenshotLines(imagePath)
+	if err != nil {
+		return "", err
+	}
+	return result.Text, nil
+}
+
+// RecognizePaymentScreenshotLines is RecognizePaymentScreenshot keeping the per-line boxes,
+// which bill-list screenshots need to be split into rows.
+func (s *OCRService) RecognizePaymentScreenshotLines(imagePath string) (*OCRCLIResponse, error) {
 	fmt.Printf("[OCR] Starting payment screenshot recognition for: %s\n", imagePath)
 
 	if !s.isRapidOCRAvailable() {
 		engine := getOCREngine()
-		return "", fmt.Errorf("OCR engine is not available (%s: %s)", engine, ocrEngineInstallHint(engine))
+		return nil, fmt.Errorf("OCR engine is not available (%s: %s)", engine, ocrEngineInstallHint(engine))
 	}
 
-	text, err := s.RecognizeWithRapidOCR(imagePath)
+	result, err := s.recognizeWithRapidOCRResult(imagePath, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	if strings.TrimSpace(text) == "" {
-		return "", fmt.Errorf("RapidOCR returned empty text")
+	if strings.TrimSpace(result.Text) == "" {
+		return nil, fmt.Errorf("RapidOCR returned empty text")
 	}
-	return text, nil
+	return result, nil
 }
 
 // isGarbledText checks if extracted text contains mostly garbled/unrecognizable characters
@@ -2168,26 +2212,20 @@ func (s *OCRService) ParsePaymentScreenshot(text string) (*PaymentExtractedData,
 		RawText: text,
 	}
 
-	// Preprocess for robust keyword matching/parsing:
-	// - normalize newlines (some OCR outputs use \r\n/\r)
-	// - remove invisible spaces that break keyword matching
-	// - remove spaces between Chinese characters (e.g. "支 付 时 间" -> "支付时间")
-	text = strings.ReplaceAll(text, "\r\n", "\n")
-	text = strings.ReplaceAll(text, "\r", "\n")
-	text = paymentInvisibleSpaceReplacer.Replace(text)
-	text = removeChineseSpaces(text)
-	text = strings.TrimSpace(text)
+	text = normalizePaymentScreenshotText(text)
 
 	// Try to detect payment platform and extract accordingly
-	if s.isJDBillDetail(text) {
+	data.Platform = s.detectPaymentPlatform(text)
+	switch data.Platform {
+	case PaymentPlatformJD:
 		s.parseJDBillDetail(text, data)
-	} else if s.isUnionPayBillDetail(text) {
+	case PaymentPlatformUnionPay:
 		s.parseUnionPayBillDetail(text, data)
-	} else if s.isWeChatPay(text) {
+	case PaymentPlatformWeChat:
 		s.parseWeChatPay(text, data)
-	} else if s.isAlipay(text) {
+	case PaymentPlatformAlipay:
 		s.parseAlipay(text, data)
-	} else if s.isBankTransfer(text) {
+	case PaymentPlatformBank:
 		s.parseBankTransfer(text, data)
 	}
 
@@ -2223,6 +2261,35 @@ func (s *OCRService) ParsePaymentScreenshot(text string) (*PaymentExtractedData,
 	return data, nil
 }
 
+// normalizePaymentScreenshotText prepares OCR text for robust keyword matching/parsing:
+// - normalize newlines (some OCR outputs use \r\n/\r)
+// - remove invisible spaces that break keyword matching
+// - remove spaces between Chinese characters (e.g. "支 付 时 间" -> "支付时间")
+func normalizePaymentScreenshotText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = paymentInvisibleSpaceReplacer.Replace(text)
+	text = removeChineseSpaces(text)
+	return strings.TrimSpace(text)
+}
+
+// detectPaymentPlatform tells which app a normalized screenshot text comes from, or "".
+func (s *OCRService) detectPaymentPlatform(text string) string {
+	switch {
+	case s.isJDBillDetail(text):
+		return PaymentPlatformJD
+	case s.isUnionPayBillDetail(text):
+		return PaymentPlatformUnionPay
+	case s.isWeChatPay(text):
+		return PaymentPlatformWeChat
+	case s.isAlipay(text):
+		return PaymentPlatformAlipay
+	case s.isBankTransfer(text):
+		return PaymentPlatformBank
+	}
+	return ""
+}
+
 // isWeChatPay checks if text is from WeChat Pay
 func (s *OCRService) isWeChatPay(text string) bool {
 	keywords := []string{"微信支付", "微信", "WeChat", "支付成功", "转账成功"}
@@ -2255,6 +2322,14 @@ func (s *OCRService) isAlipay(text string) bool {
 	return false
 }
 
+// isRefundScreenshot reports whether a WeChat/Alipay bill detail shows a refund rather than a
+// payment. Ordinary bills mention refunds in fixed hints ("可在支持的商户扫码退款", "申请退款"),
+// so only status-like phrases count.
+func isRefundScreenshot(text string) bool {
+	text = strings.NewReplacer("可在支持的商户扫码退款", "", "申请退款", "", "退款规则", "").Replace(text)
+	return refundStatusRegex.MatchString(text)
+}
+
 // isBankTransfer checks if text is from bank transfer
 func (s *OCRService) isBankTransfer(text string) bool {
 	keywords := []string{"银行", "转账", "交易成功", "电子回单"}
@@ -2392,6 +2467,7 @@ func extractValueByLabel(lines []string, label string, maxLookahead int, isBad f
 // parseWeChatPay extracts WeChat Pay information
 func (s *OCRService) parseWeChatPay(text string, data *PaymentExtractedData) {
 	lines := strings.Split(text, "\n")
+	data.IsRefund = isRefundScreenshot(text)
 
 	isWeChatBillDetailLabel := func(v string) bool {
 		v = sanitizePaymentField(v)
@@ -3290,6 +3366,7 @@ func (s *OCRService) parseUnionPayBillDetail(text string, data *PaymentExtracted
 // parseAlipay extracts Alipay information
 func (s *OCRService) parseAlipay(text string, data *PaymentExtractedData) {
 	lines := strings.Split(text, "\n")
+	data.IsRefund = isRefundScreenshot(text)
 
 	// Alipay transfer voucher ("转账凭证") is a distinct layout and should not reuse bill-detail heuristics.
 	if strings.Contains(text, "转账凭证") {
@@ -4411,7 +4488,9 @@ func cleanPartyNameFromInlineValue(val string) string {
 	return val
 }
 
-func scorePartyCandidate(value, source string, conf float64, isSeller bool, otherParty string) (int, string) {
+// scorePartyCandidate scores a buyer or seller name candidate. taxIDStatus is the check result of
+// the party's taxpayer number (see checkTaxID); names found next to that number follow its result.
+func scorePartyCandidate(value, source string, conf float64, isSeller bool, otherParty, taxIDStatus string) (int, string) {
 	value = strings.TrimSpace(value)
 	source = strings.TrimSpace(source)
 	otherParty = strings.TrimSpace(otherParty)
@@ -4471,6 +4550,16 @@ func scorePartyCandidate(value, source string, conf float64, isSeller bool, othe
 	if strings.Contains(value, "（") || strings.Contains(value, "(") {
 		score += 10
 	}
+	if strings.Contains(src, "taxid") {
+		switch taxIDStatus {
+		case TaxIDValid:
+			score += 40
+		case TaxIDCorrected:
+			score += 20
+		case TaxIDInvalid:
+			score -= 100
+		}
+	}
 	// Personal buyer with explicit "(个人)" / "（个人）" should beat plain "个人".
 	if !isSeller && (strings.Contains(value, "（个人") || strings.Contains(value, "(个人")) {
 		score += 220
@@ -4602,7 +4691,19 @@ func extractCompanyNameNearTaxID(text string) string {
 	best := ""
 	bestLen := 0
 	bestTaxPos := -1
-	for _, loc := range taxLoose.FindAllStringIndex(text, -1) {
+	// Numbers failing their check digit are usually invoice or account numbers that merely look like
+	// taxpayer numbers, so they are skipped as long as another number passes.
+	taxLocs := taxLoose.FindAllStringIndex(text, -1)
+	checked := make([][]int, 0, len(taxLocs))
+	for _, loc := range taxLocs {
+		if status, _ := checkTaxID(text[loc[0]:loc[1]]); status != TaxIDInvalid {
+			checked = append(checked, loc)
+		}
+	}
+	if len(checked) > 0 {
+		taxLocs = checked
+	}
+	for _, loc := range taxLocs {
 		if len(loc) < 2 {
 			continue
 		}
@@ -5489,6 +5590,14 @@ func extractInvoiceLineItemsFromPDFZones(pages []PDFTextZonesPage) []InvoiceLine
 			Unit:     strings.TrimSpace(unit),
 			Quantity: qty,
 		}
+		// Unit price, amount, tax rate and tax sit right of the unit column.
+		amountCells := make([]string, 0, 6)
+		for _, sp := range ordered {
+			if sp.X0 > bounds.unitEnd {
+				amountCells = append(amountCells, strings.TrimSpace(sp.T))
+			}
+		}
+		item.applyAmountTokens(invoiceItemAmountTokens(strings.Join(amountCells, " ")))
 		out = append(out, item)
 	}
 
@@ -7384,6 +7493,7 @@ func extractInvoiceLineItems(text string) []InvoiceLineItem {
 		currentUnit     string
 		currentQty      *float64
 		currentSawMoney bool
+		currentAmounts  []string
 		preserveDup     bool
 	)
 	flush := func() {
@@ -7408,6 +7518,7 @@ func extractInvoiceLineItems(text string) []InvoiceLineItem {
 			currentUnit = ""
 			currentQty = nil
 			currentSawMoney = false
+			currentAmounts = nil
 			return
 		}
 		name, currentSpec, currentUnit = peelTrailingUnitSpecTokensFromItemName(name, currentSpec, currentUnit)
@@ -7435,17 +7546,20 @@ func extractInvoiceLineItems(text string) []InvoiceLineItem {
 			one := 1.0
 			qty = &one
 		}
-		items = append(items, InvoiceLineItem{
+		item := InvoiceLineItem{
 			Name:     name,
 			Spec:     strings.TrimSpace(currentSpec),
 			Unit:     strings.TrimSpace(currentUnit),
 			Quantity: qty,
-		})
+		}
+		item.applyAmountTokens(currentAmounts)
+		items = append(items, item)
 		currentName = ""
 		currentSpec = ""
 		currentUnit = ""
 		currentQty = nil
 		currentSawMoney = false
+		currentAmounts = nil
 	}
 
 	isTableExitLine := func(s string) bool {
@@ -7492,6 +7606,13 @@ func extractInvoiceLineItems(text string) []InvoiceLineItem {
 			break
 		}
 
+		// Numeric cells at the end of the line (price, amount, rate, tax) belong to the current row,
+		// or to the row this line starts.
+		lineAmounts := invoiceItemAmountTokens(s)
+		if currentName != "" && !isLikelyItemNameLine(s) {
+			currentAmounts = append(currentAmounts, lineAmounts...)
+		}
+
 		// Within an active row, absorb spec/unit/qty tokens as we see them (PDF text often wraps names).
 		if currentName != "" && currentQty == nil {
 			tn := strings.TrimSpace(strings.ReplaceAll(s, "*", "\u00d7"))
@@ -7533,12 +7654,14 @@ func extractInvoiceLineItems(text string) []InvoiceLineItem {
 				openFull := strings.Count(currentName, "\uFF08") > strings.Count(currentName, "\uFF09")
 				if (strings.HasPrefix(currentName, "*") && !strings.HasPrefix(s, "*")) || ((openASCII || openFull) && !strings.HasPrefix(s, "*")) {
 					currentName = strings.TrimSpace(currentName + " " + s)
+					currentAmounts = append(currentAmounts, lineAmounts...)
 					continue
 				}
 			}
 			if currentName != "" {
 				flush()
 			}
+			currentAmounts = lineAmounts
 			// Didi-style merged rows: repeated service names in one line.
 			if strings.Contains(s, "运输服务") && strings.Contains(s, "客运服务费") &&
 				(strings.Count(s, "运输服务") >= 2 || strings.Count(s, "客运服务费") >= 2) {
@@ -8242,6 +8365,18 @@ func (s *OCRService) ParseInvoiceDataWithMeta(text string, meta *PDFTextCLIRespo
 				}}
 			}
 		}
+
+		// Flight segments; paper itineraries print dates without a year, taken from 填开日期.
+		ticketNo := ""
+		if m := airTicketNumberRe.FindStringSubmatch(parsedText); len(m) > 1 {
+			ticketNo = m[1]
+		}
+		segs := parseAirItinerarySegments(parsedText, strPtrVal(data.InvoiceDate))
+		for i := range segs {
+			segs[i].Passenger = strPtrVal(data.BuyerName)
+			segs[i].TicketNumber = ticketNo
+		}
+		data.Journeys = segs
 	}
 
 	// Special invoice type: railway e-ticket (电子发票（铁路电子客票）).
@@ -8327,6 +8462,10 @@ func (s *OCRService) ParseInvoiceDataWithMeta(text string, meta *PDFTextCLIRespo
 				}}
 			}
 		}
+
+		if seg := parseRailwayTicketJourney(parsedText); seg != nil {
+			data.Journeys = []JourneySegment{*seg}
+		}
 	}
 
 	isPlausibleInvoiceYear := func(y int) bool {
@@ -9210,10 +9349,22 @@ func (s *OCRService) ParseInvoiceDataWithMeta(text string, meta *PDFTextCLIRespo
 		}
 	}
 
+	// Printed taxpayer numbers are verified by their check digit; names found next to them are
+	// scored by the result below.
+	buyerTaxID, sellerTaxID := extractInvoicePartyTaxIDs(parsedText)
+	data.BuyerTaxID, data.SellerTaxID = buyerTaxID, sellerTaxID
+	buyerTaxCheck := checkPartyTaxID("buyer", buyerTaxID)
+	sellerTaxCheck := checkPartyTaxID("seller", sellerTaxID)
+
 	// Final selection: build multi-source candidate pools (xml/zones/text) and pick the best values
 	// with consistent scoring + validation. This makes the behavior stable across templates and improves debuggability.
 	if !airTicketDetected && !railTicketDetected {
 		trace := &InvoiceExtractionTrace{}
+		for _, check := range []*TaxIDCheck{buyerTaxCheck, sellerTaxCheck} {
+			if check != nil {
+				trace.TaxIDChecks = append(trace.TaxIDChecks, *check)
+			}
+		}
 
 		// Seller candidates
 		{
@@ -9266,7 +9417,7 @@ func (s *OCRService) ParseInvoiceDataWithMeta(text string, meta *PDFTextCLIRespo
 			bestScore := -1
 			scored := make([]ExtractionCandidate, 0, len(sellerCands))
 			for _, c := range sellerCands {
-				score, reject := scorePartyCandidate(c.Value, c.Source, c.Confidence, true, other)
+				score, reject := scorePartyCandidate(c.Value, c.Source, c.Confidence, true, other, taxIDCheckStatus(sellerTaxCheck))
 				c.Score = score
 				c.RejectReason = reject
 				scored = append(scored, c)
@@ -9334,7 +9485,7 @@ func (s *OCRService) ParseInvoiceDataWithMeta(text string, meta *PDFTextCLIRespo
 			bestScore := -1
 			scored := make([]ExtractionCandidate, 0, len(buyerCands))
 			for _, c := range buyerCands {
-				score, reject := scorePartyCandidate(c.Value, c.Source, c.Confidence, false, other)
+				score, reject := scorePartyCandidate(c.Value, c.Source, c.Confidence, false, other, taxIDCheckStatus(buyerTaxCheck))
 				c.Score = score
 				c.RejectReason = reject
 				scored = append(scored, c)
@@ -9374,12 +9525,19 @@ func (s *OCRService) ParseInvoiceDataWithMeta(text string, meta *PDFTextCLIRespo
 			for _, c := range extractAmountCandidatesFromText(parsedText) {
 				appendMoneyCandidate(&amountCands, c)
 			}
+			upper, hasUpper := extractUppercaseAmountCandidate(parsedText)
+			if hasUpper {
+				appendMoneyCandidate(&amountCands, upper)
+			}
 
 			best := MoneyCandidate{}
 			bestScore := -1
 			scored := make([]MoneyCandidate, 0, len(amountCands))
 			for _, c := range amountCands {
 				score, reject := scoreMoneyCandidate(c.Value, c.Source, c.Confidence, nil, false)
+				if hasUpper && reject == "" {
+					score, reject = crossCheckUppercaseAmount(c.Value, score, upper)
+				}
 				c.Score = score
 				c.RejectReason = reject
 				scored = append(scored, c)
@@ -9389,6 +9547,15 @@ func (s *OCRService) ParseInvoiceDataWithMeta(text string, meta *PDFTextCLIRespo
 				}
 			}
 			trace.AmountCandidates = scored
+			if hasUpper && bestScore >= 0 {
+				// Two independent readings of the total agree, whichever of them won.
+				for _, c := range scored {
+					if c.Source != uppercaseAmountSource && c.RejectReason == "" && math.Abs(c.Value-upper.Value) < 0.005 {
+						best.Confidence = math.Max(best.Confidence, 0.98)
+						break
+					}
+				}
+			}
 			if bestScore >= 0 {
 				v := best.Value
 				data.Amount = &v
@@ -9435,6 +9602,20 @@ func (s *OCRService) ParseInvoiceDataWithMeta(text string, meta *PDFTextCLIRespo
 		data.Trace = trace
 	}
 
+	data.InvoiceType = classifyInvoiceType(text)
+	data.TypeDetails = extractInvoiceTypeDetails(data.InvoiceType, text, data)
+	if rides, total := parseRideItinerary(text); len(rides) > 0 {
+		// Ride-hailing itineraries come attached to the invoice; their total is checked against it.
+		data.Rides = rides
+		if total != nil {
+			data.TypeDetails = mergeInvoiceTypeDetails(data.TypeDetails, &InvoiceTypeDetails{Total: total})
+		}
+	}
+	if data.Amount == nil && data.TypeDetails != nil && data.TypeDetails.Total != nil {
+		// Paper itineraries print "合计 TOTAL CNY ..." inline, which the layout rules above miss.
+		setAmountWithSourceAndConfidence(&data.Amount, &data.AmountSource, &data.AmountConfidence, data.TypeDetails.Total, "air_ticket_total", 0.9)
+	}
+
 	data.PrettyText = formatInvoicePrettyText(text, data)
 	return data, nil
 }
@@ -10,3 +10,11 @@ func TestExtractCompanyNameNearTaxID_PicksLongestNestedMatch(t *testing.T) {
 	}
 }
 
+func TestExtractCompanyNameNearTaxID_SkipsNumbersFailingCheckDigit(t *testing.T) {
+	// The account number after the bank name looks like a taxpayer number but fails its check digit.
+	text := "销售方 上海某某餐饮有限公司 统一社会信用代码：91310000132200821H\n" +
+		"开户银行：招商银行股份有限公司上海东方支行 账号：121932981110606123\n"
+	if got := extractCompanyNameNearTaxID(text); got != "上海某某餐饮有限公司" {
+		t.Fatalf("company name mismatch: got=%q", got)
+	}
+}
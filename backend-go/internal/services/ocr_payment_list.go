@@ -0,0 +1,342 @@
+package services
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bill-list screenshots (Alipay/WeChat "账单", bank transaction lists) show one transaction per
+// row: a merchant on the left, a signed amount on the right and a time underneath. Rows are
+// segmented with the OCR line boxes, using each right-aligned amount as the anchor of a row.
+
+var (
+	listAmountRegex = regexp.MustCompile(`^([-+－﹣−＋])?\s*[¥￥]?\s*((?:\d{1,3}(?:,\d{3})+|\d+)\.\d{2})\s*元?$`)
+	listClockRegex  = regexp.MustCompile(`(\d{1,2}):(\d{2})(?::(\d{2}))?`)
+	// Dates as printed in list rows or group headers, most specific first.
+	listFullDateRegex  = regexp.MustCompile(`(\d{4})\s*[-/.年]\s*(\d{1,2})\s*[-/.月]\s*(\d{1,2})`)
+	listShortDateRegex = regexp.MustCompile(`(?:^|[^\d])(\d{1,2})\s*[-/月]\s*(\d{1,2})\s*日?`)
+	listMonthRegex     = regexp.MustCompile(`(\d{4})\s*年\s*(\d{1,2})\s*月`)
+	listRelativeDays   = map[string]int{"今天": 0, "昨天": -1, "前天": -2}
+
+	// Labels only found on single-transaction detail pages.
+	listDetailMarkers = []string{"账单详情", "交易单号", "商户单号", "订单号", "支付时间", "付款方式", "电子回单"}
+	// Summary amounts in list headers ("支出 ¥1,234.00 收入 ¥100.00") are not rows.
+	listSummaryLabels = []string{"支出", "收入", "合计", "总计", "余额", "本月"}
+	// Status words printed inside a row that are not the merchant.
+	listStatusWords = []string{"交易成功", "支付成功", "已全额退款", "已退款", "退款成功", "交易关闭", "已支付", "还款成功"}
+)
+
+type listOCRLine struct {
+	text                   string
+	minX, maxX, minY, maxY float64
+}
+
+func (l listOCRLine) centerY() float64 { return (l.minY + l.maxY) / 2 }
+
+func (l listOCRLine) overlapsRow(o listOCRLine) bool {
+	return l.minY < o.maxY && o.minY < l.maxY
+}
+
+func toListOCRLines(lines []OCRCLILine) []listOCRLine {
+	out := make([]listOCRLine, 0, len(lines))
+	for _, ln := range lines {
+		text := normalizePaymentScreenshotText(ln.Text)
+		if text == "" || len(ln.Box) == 0 {
+			continue
+		}
+		l := listOCRLine{text: text, minX: math.Inf(1), minY: math.Inf(1), maxX: math.Inf(-1), maxY: math.Inf(-1)}
+		for _, p := range ln.Box {
+			if len(p) < 2 {
+				continue
+			}
+			l.minX, l.maxX = math.Min(l.minX, p[0]), math.Max(l.maxX, p[0])
+			l.minY, l.maxY = math.Min(l.minY, p[1]), math.Max(l.maxY, p[1])
+		}
+		if math.IsInf(l.minX, 0) || l.maxY <= l.minY {
+			continue
+		}
+		out = append(out, l)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].minY < out[j].minY })
+	return out
+}
+
+// ParsePaymentListScreenshot splits a bill-list screenshot into one extracted record per
+// transaction row. It returns nil when the lines do not look like a list of at least two
+// transactions, in which case the caller should parse the screenshot as a single payment.
+func (s *OCRService) ParsePaymentListScreenshot(lines []OCRCLILine) []*PaymentExtractedData {
+	return s.parsePaymentListLines(lines, time.Now().In(loadLocationOrUTC("Asia/Shanghai")))
+}
+
+func (s *OCRService) parsePaymentListLines(rawLines []OCRCLILine, now time.Time) []*PaymentExtractedData {
+	lines := toListOCRLines(rawLines)
+	if len(lines) < 4 {
+		return nil
+	}
+	texts := make([]string, 0, len(lines))
+	for _, l := range lines {
+		texts = append(texts, l.text)
+	}
+	fullText := strings.Join(texts, "\n")
+	for _, marker := range listDetailMarkers {
+		if strings.Contains(fullText, marker) {
+			return nil
+		}
+	}
+
+	anchors := listAmountAnchors(lines)
+	if len(anchors) < 2 {
+		return nil
+	}
+
+	// Row i spans from just above its amount to just above the next amount; the last row gets
+	// the median row pitch so footers ("没有更多了") are not attached to it.
+	pitches := make([]float64, 0, len(anchors)-1)
+	for i := 1; i < len(anchors); i++ {
+		pitches = append(pitches, lines[anchors[i]].minY-lines[anchors[i-1]].minY)
+	}
+	sort.Float64s(pitches)
+	medianPitch := pitches[len(pitches)/2]
+	rowTop := func(i int) float64 {
+		a := lines[anchors[i]]
+		return a.minY - (a.maxY-a.minY)*0.6
+	}
+
+	platform := s.detectPaymentPlatform(fullText)
+	ctx := listDateContext{now: now}
+	out := make([]*PaymentExtractedData, 0, len(anchors))
+	next := 0
+	for i := range anchors {
+		top := rowTop(i)
+		bottom := rowTop(i) + medianPitch
+		if i+1 < len(anchors) {
+			bottom = rowTop(i + 1)
+		}
+		// Lines above this row (list headers, date group headers) only update the date context.
+		for next < len(lines) && lines[next].centerY() < top {
+			ctx.observeHeader(lines[next].text)
+			next++
+		}
+		var row []listOCRLine
+		for next < len(lines) && lines[next].centerY() < bottom {
+			row = append(row, lines[next])
+			next++
+		}
+		if data := parsePaymentListRow(row, lines[anchors[i]], &ctx, platform); data != nil {
+			out = append(out, data)
+		}
+		// A date group header printed below this row applies to the rows after it.
+		for _, l := range row {
+			if ctx.isHeader(l.text) {
+				ctx.observeHeader(l.text)
+			}
+		}
+	}
+	if len(out) < 2 {
+		return nil
+	}
+	return out
+}
+
+// listAmountAnchors returns the indexes of right-aligned amount lines. Signed amounts are
+// preferred: list UIs print "-25.00" for every row, while unsigned ones are often summaries.
+func listAmountAnchors(lines []listOCRLine) []int {
+	width := 0.0
+	for _, l := range lines {
+		width = math.Max(width, l.maxX)
+	}
+	var signed, unsigned []int
+	for i, l := range lines {
+		m := listAmountRegex.FindStringSubmatch(l.text)
+		if m == nil || l.minX < width*0.45 {
+			continue
+		}
+		if m[1] != "" {
+			signed = append(signed, i)
+			continue
+		}
+		summary := false
+		for _, o := range lines {
+			if o.maxX <= l.minX && o.overlapsRow(l) && containsAnyWord(o.text, listSummaryLabels) {
+				summary = true
+				break
+			}
+		}
+		if !summary {
+			unsigned = append(unsigned, i)
+		}
+	}
+	if len(signed) >= 2 {
+		return signed
+	}
+	return unsigned
+}
+
+func parsePaymentListRow(row []listOCRLine, anchor listOCRLine, ctx *listDateContext, platform string) *PaymentExtractedData {
+	m := listAmountRegex.FindStringSubmatch(anchor.text)
+	if m == nil {
+		return nil
+	}
+	amount := parseAmount(m[2])
+	if amount == nil || *amount <= 0 {
+		return nil
+	}
+	rowText := make([]string, 0, len(row))
+	for _, l := range row {
+		rowText = append(rowText, l.text)
+	}
+	raw := strings.Join(rowText, "\n")
+	isRefund := strings.Contains(raw, "退款")
+	// Income rows (salary, transfers in) are not spending; refunds are kept and linked later.
+	if (m[1] == "+" || m[1] == "＋") && !isRefund {
+		return nil
+	}
+
+	data := &PaymentExtractedData{
+		Amount:           amount,
+		AmountSource:     "list_row",
+		AmountConfidence: 0.85,
+		Platform:         platform,
+		IsRefund:         isRefund,
+		RawText:          raw,
+	}
+
+	var merchant *listOCRLine
+	for i := range row {
+		l := row[i]
+		if l.text == anchor.text && l.minY == anchor.minY {
+			continue
+		}
+		if ts, ok := ctx.rowTime(l.text); ok {
+			if data.TransactionTime == nil {
+				data.TransactionTime = &ts
+				data.TransactionTimeSource = "list_row"
+				data.TransactionTimeConfidence = 0.8
+			}
+			continue
+		}
+		if ctx.isHeader(l.text) || containsAnyWord(l.text, listStatusWords) || listAmountRegex.MatchString(l.text) {
+			continue
+		}
+		// The merchant shares the amount's visual row; otherwise take the first text line.
+		if merchant == nil || (l.overlapsRow(anchor) && !merchant.overlapsRow(anchor)) {
+			merchant = &row[i]
+		}
+	}
+	if merchant != nil {
+		if name := sanitizePaymentField(merchant.text); name != "" {
+			data.Merchant = &name
+			data.MerchantSource = "list_row"
+			data.MerchantConfidence = 0.7
+		}
+	}
+	if data.Merchant == nil && data.TransactionTime == nil {
+		return nil
+	}
+	data.PrettyText = formatPaymentPrettyText(data.RawText, data)
+	return data
+}
+
+// listDateContext tracks the year/month/day printed in list headers ("2025年12月",
+// "12月01日 星期一") so rows that only show a clock time can be dated.
+type listDateContext struct {
+	now   time.Time
+	year  int
+	month int
+	day   int
+}
+
+// isHeader reports whether text is a date or month group header without a clock time.
+func (c *listDateContext) isHeader(text string) bool {
+	if listClockRegex.MatchString(text) {
+		return false
+	}
+	if _, _, _, ok := c.parseDate(text); ok {
+		return true
+	}
+	return listMonthRegex.MatchString(text)
+}
+
+func (c *listDateContext) observeHeader(text string) {
+	if y, mo, d, ok := c.parseDate(text); ok {
+		c.year, c.month, c.day = y, mo, d
+		return
+	}
+	if m := listMonthRegex.FindStringSubmatch(text); m != nil {
+		c.year, _ = strconv.Atoi(m[1])
+		c.month, _ = strconv.Atoi(m[2])
+		c.day = 0
+	}
+}
+
+// parseDate reads an absolute, short or relative date from text.
+func (c *listDateContext) parseDate(text string) (int, int, int, bool) {
+	for word, offset := range listRelativeDays {
+		if strings.Contains(text, word) {
+			d := c.now.AddDate(0, 0, offset)
+			return d.Year(), int(d.Month()), d.Day(), true
+		}
+	}
+	if m := listFullDateRegex.FindStringSubmatch(text); m != nil {
+		y, _ := strconv.Atoi(m[1])
+		mo, _ := strconv.Atoi(m[2])
+		d, _ := strconv.Atoi(m[3])
+		return y, mo, d, validListDate(y, mo, d)
+	}
+	// Keep "08:12" from being read as a month-day pair.
+	withoutClock := listClockRegex.ReplaceAllString(text, " ")
+	if m := listShortDateRegex.FindStringSubmatch(withoutClock); m != nil {
+		mo, _ := strconv.Atoi(m[1])
+		d, _ := strconv.Atoi(m[2])
+		y := c.year
+		if y == 0 {
+			y = c.now.Year()
+			// A bare month-day later than today belongs to last year.
+			if time.Date(y, time.Month(mo), d, 0, 0, 0, 0, c.now.Location()).After(c.now.AddDate(0, 0, 1)) {
+				y--
+			}
+		}
+		return y, mo, d, validListDate(y, mo, d)
+	}
+	return 0, 0, 0, false
+}
+
+// rowTime parses a row's time line ("今天 12:30", "12-01 08:12", "12:30" under a date header)
+// into local "2006-01-02 15:04:05". A clock time is required so stray dates are not used.
+func (c *listDateContext) rowTime(text string) (string, bool) {
+	clock := listClockRegex.FindStringSubmatch(text)
+	if clock == nil {
+		return "", false
+	}
+	y, mo, d, ok := c.parseDate(text)
+	if !ok {
+		if c.day == 0 {
+			return "", false
+		}
+		y, mo, d = c.year, c.month, c.day
+	}
+	h, _ := strconv.Atoi(clock[1])
+	mi, _ := strconv.Atoi(clock[2])
+	sec, _ := strconv.Atoi(clock[3])
+	if h > 23 || mi > 59 || sec > 59 {
+		return "", false
+	}
+	return time.Date(y, time.Month(mo), d, h, mi, sec, 0, time.UTC).Format("2006-01-02 15:04:05"), true
+}
+
+func validListDate(y, mo, d int) bool {
+	return y >= 2000 && mo >= 1 && mo <= 12 && d >= 1 && d <= 31
+}
+
+func containsAnyWord(s string, words []string) bool {
+	for _, w := range words {
+		if strings.Contains(s, w) {
+			return true
+		}
+	}
+	return false
+}
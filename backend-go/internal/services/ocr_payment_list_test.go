@@ -0,0 +1,112 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// listLine builds an OCR line with an axis-aligned box at (x, y) of the given width and height 30.
+func listLine(text string, x, y, w float64) OCRCLILine {
+	return OCRCLILine{Text: text, Confidence: 0.95, Box: [][]float64{{x, y}, {x + w, y}, {x + w, y + 30}, {x, y + 30}}}
+}
+
+func TestParsePaymentListScreenshot_AlipayBillList(t *testing.T) {
+	now := time.Date(2025, 12, 3, 20, 0, 0, 0, time.UTC)
+	lines := []OCRCLILine{
+		listLine("账单", 480, 80, 120),
+		listLine("支出 ¥3,123.50", 40, 160, 300),
+		listLine("收入 ¥200.00", 600, 160, 260),
+		listLine("美团外卖", 140, 260, 200),
+		listLine("-25.00", 880, 262, 160),
+		listLine("餐饮美食", 140, 300, 160),
+		listLine("今天 12:30", 140, 340, 200),
+		listLine("滴滴出行", 140, 420, 200),
+		listLine("-18.50", 880, 422, 160),
+		listLine("交通出行", 140, 460, 160),
+		listLine("昨天 08:12", 140, 500, 200),
+		listLine("工资", 140, 580, 120),
+		listLine("+8,000.00", 840, 582, 200),
+		listLine("11-30 09:00", 140, 660, 200),
+		listLine("某某便利店", 140, 740, 220),
+		listLine("-3,080.00", 840, 742, 200),
+		listLine("退款成功", 140, 780, 160),
+		listLine("12-15 21:05", 140, 820, 200),
+		listLine("没有更多了", 420, 1100, 200),
+	}
+
+	rows := (&OCRService{}).parsePaymentListLines(lines, now)
+	if len(rows) != 3 {
+		t.Fatalf("应拆分出三笔支出/退款, 实际 %d: %#v", len(rows), rows)
+	}
+	want := []struct {
+		merchant string
+		amount   float64
+		at       string
+		refund   bool
+	}{
+		{"美团外卖", 25, "2025-12-03 12:30:00", false},
+		{"滴滴出行", 18.5, "2025-12-02 08:12:00", false},
+		// A month-day later than today belongs to last year.
+		{"某某便利店", 3080, "2024-12-15 21:05:00", true},
+	}
+	for i, w := range want {
+		got := rows[i]
+		if got.Merchant == nil || *got.Merchant != w.merchant || got.Amount == nil || *got.Amount != w.amount ||
+			got.TransactionTime == nil || *got.TransactionTime != w.at || got.IsRefund != w.refund {
+			t.Fatalf("第 %d 行解析错误: %#v", i+1, got)
+		}
+	}
+}
+
+func TestParsePaymentListScreenshot_BankListWithDateHeaders(t *testing.T) {
+	now := time.Date(2025, 12, 3, 20, 0, 0, 0, time.UTC)
+	lines := []OCRCLILine{
+		listLine("交易明细", 420, 60, 200),
+		listLine("2025年11月", 40, 140, 200),
+		listLine("11月28日 星期五", 40, 200, 260),
+		listLine("星巴克咖啡", 40, 260, 220),
+		listLine("−36.00", 860, 262, 160),
+		listLine("10:05", 40, 300, 100),
+		listLine("11月27日 星期四", 40, 380, 260),
+		listLine("中国石化加油站", 40, 440, 260),
+		listLine("−300.00", 840, 442, 180),
+		listLine("18:40", 40, 480, 100),
+	}
+
+	rows := (&OCRService{}).parsePaymentListLines(lines, now)
+	if len(rows) != 2 {
+		t.Fatalf("应拆分出两笔交易, 实际 %d", len(rows))
+	}
+	if *rows[0].Merchant != "星巴克咖啡" || *rows[0].TransactionTime != "2025-11-28 10:05:00" {
+		t.Fatalf("第一行解析错误: %#v", rows[0])
+	}
+	if *rows[1].Merchant != "中国石化加油站" || *rows[1].TransactionTime != "2025-11-27 18:40:00" || *rows[1].Amount != 300 {
+		t.Fatalf("日期分组应作用于其后的交易: %#v", rows[1])
+	}
+}
+
+func TestParsePaymentListScreenshot_IgnoresDetailPages(t *testing.T) {
+	now := time.Date(2025, 12, 3, 20, 0, 0, 0, time.UTC)
+	detail := []OCRCLILine{
+		listLine("账单详情", 420, 60, 200),
+		listLine("美团外卖", 400, 160, 200),
+		listLine("-25.00", 380, 220, 260),
+		listLine("订单金额", 40, 320, 160),
+		listLine("25.00", 860, 320, 120),
+		listLine("支付时间", 40, 380, 160),
+		listLine("2025-12-01 12:30:00", 600, 380, 380),
+	}
+	if rows := (&OCRService{}).parsePaymentListLines(detail, now); rows != nil {
+		t.Fatalf("账单详情页不应按列表拆分: %#v", rows)
+	}
+
+	single := []OCRCLILine{
+		listLine("美团外卖", 140, 260, 200),
+		listLine("-25.00", 880, 262, 160),
+		listLine("今天 12:30", 140, 340, 200),
+		listLine("没有更多了", 420, 600, 200),
+	}
+	if rows := (&OCRService{}).parsePaymentListLines(single, now); rows != nil {
+		t.Fatalf("只有一笔交易时应回退到单笔解析: %#v", rows)
+	}
+}
@@ -65,3 +65,26 @@ func TestParsePaymentScreenshot_WeChatPay_WithInvisibleSpacesAndCRLF(t *testing.
 		t.Fatalf("expected transaction time, got %#v", data.TransactionTime)
 	}
 }
+
+func TestParsePaymentScreenshot_DetectsRefunds(t *testing.T) {
+	service := NewOCRService()
+
+	cases := []struct {
+		name string
+		text string
+		want bool
+	}{
+		{"wechat refund", "微信支付\n全部账单\n瑞幸咖啡\n+18.00\n当前状态\n已全额退款\n交易单号\n4200001234567890\n退款时间\n2025年10月24日 09:00:00", true},
+		{"alipay refund", "支付宝\n账单详情\n美团外卖\n+35.50\n退款成功\n退款金额 35.50\n订单号\n2025102422001400001234567890", true},
+		{"wechat payment hint", "微信支付\n支付成功\n-18.00\n商户全称\n瑞幸咖啡\n可在支持的商户扫码退款\n支付时间\n2025年10月23日 14:59:46", false},
+	}
+	for _, tc := range cases {
+		data, err := service.ParsePaymentScreenshot(tc.text)
+		if err != nil {
+			t.Fatalf("%s: ParsePaymentScreenshot returned error: %v", tc.name, err)
+		}
+		if data.IsRefund != tc.want {
+			t.Fatalf("%s: IsRefund=%v want %v", tc.name, data.IsRefund, tc.want)
+		}
+	}
+}
@@ -293,4 +293,10 @@ func TestExtractInvoiceLineItemsFromPDFZones_DiscountRowsNotMerged(t *testing.T)
 	if items[3].Quantity != nil {
 		t.Fatalf("expected discount row qty nil got %+v", items[3].Quantity)
 	}
+	if items[0].Amount == nil || *items[0].Amount != 109.43 || items[0].TaxAmount == nil || *items[0].TaxAmount != 6.57 {
+		t.Fatalf("expected first amount 109.43 tax 6.57, got %+v", items[0])
+	}
+	if items[1].Amount == nil || *items[1].Amount != -28.30 || items[1].TaxRate == nil || *items[1].TaxRate != 0.06 {
+		t.Fatalf("expected discount amount -28.30 at 6%%, got %+v", items[1])
+	}
 }
@@ -1879,6 +1879,10 @@ CNY 2220.00
 	if !strings.Contains(it.Name, "MU5156") || !strings.Contains(it.Name, "北京") || !strings.Contains(it.Name, "上海") {
 		t.Fatalf("Unexpected item name: %+v", it)
 	}
+	if data.InvoiceType != InvoiceTypeAirItinerary || data.TypeDetails == nil ||
+		strPtrVal(data.TypeDetails.Passenger) != "乌洪军" || strPtrVal(data.TypeDetails.TicketNumber) != "7812103964567" {
+		t.Fatalf("Unexpected invoice type/details: %q %+v", data.InvoiceType, data.TypeDetails)
+	}
 }
 
 func TestParseInvoiceData_SpaceSeparatedDate(t *testing.T) {
@@ -0,0 +1,823 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OFD (GB/T 33190) is the fixed-layout format used by tax-bureau and fully digital (数电) e-invoices.
+// An .ofd file is a zip container: OFD.xml points to a Document.xml that lists pages, templates,
+// resources, attachments (数电 invoices embed their original XML) and custom tags that map invoice
+// fields to the text objects drawn on the page.
+
+const (
+	ofdMaxEntryBytes = 8 << 20
+	ofdMaxFileBytes  = 32 << 20
+	ofdMaxPages      = 20
+
+	// ofdPreviewPixelsPerMM sizes the SVG preview (OFD coordinates are millimetres).
+	ofdPreviewPixelsPerMM = 4
+	ofdPreviewPageGap     = 4.0
+)
+
+func isOFDFilename(name string) bool {
+	return strings.HasSuffix(strings.ToLower(strings.TrimSpace(name)), ".ofd")
+}
+
+// IsOFDFilename reports whether a stored invoice file is an OFD document.
+func IsOFDFilename(name string) bool {
+	return isOFDFilename(name)
+}
+
+type ofdRootXML struct {
+	DocBody []struct {
+		CustomDatas []ofdCustomDataXML `xml:"DocInfo>CustomDatas>CustomData"`
+		DocRoot     string             `xml:"DocRoot"`
+	} `xml:"DocBody"`
+}
+
+type ofdCustomDataXML struct {
+	Name  string `xml:"Name,attr"`
+	Value string `xml:",chardata"`
+}
+
+type ofdLocXML struct {
+	ID      string `xml:"ID,attr"`
+	BaseLoc string `xml:"BaseLoc,attr"`
+}
+
+type ofdDocumentXML struct {
+	PhysicalBox string      `xml:"CommonData>PageArea>PhysicalBox"`
+	PublicRes   []string    `xml:"CommonData>PublicRes"`
+	DocumentRes []string    `xml:"CommonData>DocumentRes"`
+	Templates   []ofdLocXML `xml:"CommonData>TemplatePage"`
+	Pages       []ofdLocXML `xml:"Pages>Page"`
+	Attachments []string    `xml:"Attachments"`
+	CustomTags  []string    `xml:"CustomTags"`
+}
+
+type ofdResXML struct {
+	BaseLoc string `xml:"BaseLoc,attr"`
+	Fonts   []struct {
+		ID         string `xml:"ID,attr"`
+		FontName   string `xml:"FontName,attr"`
+		FamilyName string `xml:"FamilyName,attr"`
+	} `xml:"Fonts>Font"`
+	Media []struct {
+		ID        string `xml:"ID,attr"`
+		MediaFile string `xml:"MediaFile"`
+	} `xml:"MultiMedias>MultiMedia"`
+}
+
+type ofdPageXML struct {
+	PhysicalBox string `xml:"Area>PhysicalBox"`
+	Templates   []struct {
+		TemplateID string `xml:"TemplateID,attr"`
+	} `xml:"Template"`
+	Layers []ofdObjectXML `xml:"Content>Layer"`
+}
+
+// ofdObjectXML covers layers, page blocks and the text/path/image objects they contain.
+type ofdObjectXML struct {
+	XMLName         xml.Name
+	ID              string           `xml:"ID,attr"`
+	Boundary        string           `xml:"Boundary,attr"`
+	CTM             string           `xml:"CTM,attr"`
+	Font            string           `xml:"Font,attr"`
+	Size            string           `xml:"Size,attr"`
+	LineWidth       string           `xml:"LineWidth,attr"`
+	Fill            string           `xml:"Fill,attr"`
+	Stroke          string           `xml:"Stroke,attr"`
+	ResourceID      string           `xml:"ResourceID,attr"`
+	FillColor       *ofdColorXML     `xml:"FillColor"`
+	StrokeColor     *ofdColorXML     `xml:"StrokeColor"`
+	TextCodes       []ofdTextCodeXML `xml:"TextCode"`
+	AbbreviatedData string           `xml:"AbbreviatedData"`
+	Children        []ofdObjectXML   `xml:",any"`
+}
+
+type ofdColorXML struct {
+	Value string `xml:"Value,attr"`
+}
+
+type ofdTextCodeXML struct {
+	X      string `xml:"X,attr"`
+	Y      string `xml:"Y,attr"`
+	DeltaX string `xml:"DeltaX,attr"`
+	DeltaY string `xml:"DeltaY,attr"`
+	Text   string `xml:",chardata"`
+}
+
+type ofdPage struct {
+	width   float64
+	height  float64
+	objects []ofdObjectXML
+}
+
+type ofdDocument struct {
+	archive        *ofdArchive
+	pages          []ofdPage
+	fonts          map[string]string
+	media          map[string]string
+	customData     map[string]string
+	tags           map[string][]string
+	xmlAttachments [][]byte
+}
+
+type ofdArchive struct {
+	files map[string]*zip.File
+}
+
+func (a *ofdArchive) lookup(name string) *zip.File {
+	name = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, "\\", "/")), "/")
+	if f := a.files[name]; f != nil {
+		return f
+	}
+	for k, f := range a.files {
+		if strings.EqualFold(k, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+func (a *ofdArchive) read(name string) ([]byte, error) {
+	f := a.lookup(name)
+	if f == nil {
+		return nil, fmt.Errorf("ofd entry not found: %s", name)
+	}
+	// Guard against zip bombs: cap both the declared size and the bytes actually read.
+	if f.UncompressedSize64 > ofdMaxEntryBytes {
+		return nil, fmt.Errorf("ofd entry too large: %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, ofdMaxEntryBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > ofdMaxEntryBytes {
+		return nil, fmt.Errorf("ofd entry too large: %s", name)
+	}
+	return b, nil
+}
+
+func (a *ofdArchive) decode(name string, v any) error {
+	b, err := a.read(name)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(b, v)
+}
+
+// ofdResolve resolves a location relative to the file that references it; absolute locations start at the container root.
+func ofdResolve(base string, loc string) string {
+	loc = strings.TrimSpace(strings.ReplaceAll(loc, "\\", "/"))
+	if strings.HasPrefix(loc, "/") {
+		return path.Clean(loc)[1:]
+	}
+	return path.Join(path.Dir(base), loc)
+}
+
+func readOFDFile(filePath string) (*ofdDocument, error) {
+	st, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if st.Size() > ofdMaxFileBytes {
+		return nil, fmt.Errorf("ofd file too large")
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return readOFD(data)
+}
+
+func readOFD(data []byte) (*ofdDocument, error) {
+	if !isZipPayload(data) {
+		return nil, fmt.Errorf("not an ofd container")
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("open ofd: %w", err)
+	}
+	archive := &ofdArchive{files: make(map[string]*zip.File, len(zr.File))}
+	for _, f := range zr.File {
+		if f == nil || f.FileInfo().IsDir() {
+			continue
+		}
+		archive.files[strings.TrimPrefix(path.Clean("/"+f.Name), "/")] = f
+	}
+
+	var root ofdRootXML
+	if err := archive.decode("OFD.xml", &root); err != nil {
+		return nil, fmt.Errorf("read OFD.xml: %w", err)
+	}
+	if len(root.DocBody) == 0 || strings.TrimSpace(root.DocBody[0].DocRoot) == "" {
+		return nil, fmt.Errorf("ofd has no document")
+	}
+	body := root.DocBody[0]
+
+	doc := &ofdDocument{
+		archive:    archive,
+		fonts:      map[string]string{},
+		media:      map[string]string{},
+		customData: map[string]string{},
+		tags:       map[string][]string{},
+	}
+	for _, cd := range body.CustomDatas {
+		if name, v := strings.TrimSpace(cd.Name), strings.TrimSpace(cd.Value); name != "" && v != "" {
+			doc.customData[name] = v
+		}
+	}
+
+	docPath := ofdResolve("OFD.xml", body.DocRoot)
+	var d ofdDocumentXML
+	if err := archive.decode(docPath, &d); err != nil {
+		return nil, fmt.Errorf("read document: %w", err)
+	}
+
+	for _, loc := range append(append([]string{}, d.PublicRes...), d.DocumentRes...) {
+		if strings.TrimSpace(loc) == "" {
+			continue
+		}
+		resPath := ofdResolve(docPath, loc)
+		var res ofdResXML
+		if err := archive.decode(resPath, &res); err != nil {
+			continue
+		}
+		base := resPath
+		if strings.TrimSpace(res.BaseLoc) != "" {
+			base = ofdResolve(resPath, res.BaseLoc) + "/"
+		}
+		for _, f := range res.Fonts {
+			name := strings.TrimSpace(f.FamilyName)
+			if name == "" {
+				name = strings.TrimSpace(f.FontName)
+			}
+			doc.fonts[f.ID] = name
+		}
+		for _, m := range res.Media {
+			if strings.TrimSpace(m.MediaFile) != "" {
+				doc.media[m.ID] = ofdResolve(base, m.MediaFile)
+			}
+		}
+	}
+
+	templates := map[string][]ofdObjectXML{}
+	for _, tpl := range d.Templates {
+		var tp ofdPageXML
+		if err := archive.decode(ofdResolve(docPath, tpl.BaseLoc), &tp); err != nil {
+			continue
+		}
+		templates[tpl.ID] = flattenOFDObjects(tp.Layers, nil)
+	}
+
+	docBox := ofdNumbers(d.PhysicalBox)
+	for i, p := range d.Pages {
+		if i >= ofdMaxPages {
+			break
+		}
+		var pg ofdPageXML
+		if err := archive.decode(ofdResolve(docPath, p.BaseLoc), &pg); err != nil {
+			return nil, fmt.Errorf("read page %d: %w", i+1, err)
+		}
+		box := ofdNumbers(pg.PhysicalBox)
+		if len(box) < 4 {
+			box = docBox
+		}
+		page := ofdPage{width: 210, height: 140}
+		if len(box) >= 4 && box[2] > 0 && box[3] > 0 {
+			page.width, page.height = box[2], box[3]
+		}
+		// Templates carry the static form (labels, table lines) and are drawn beneath the page content.
+		for _, t := range pg.Templates {
+			page.objects = append(page.objects, templates[t.TemplateID]...)
+		}
+		page.objects = flattenOFDObjects(pg.Layers, page.objects)
+		doc.pages = append(doc.pages, page)
+	}
+	if len(doc.pages) == 0 {
+		return nil, fmt.Errorf("ofd has no pages")
+	}
+
+	for _, loc := range d.Attachments {
+		if strings.TrimSpace(loc) != "" {
+			doc.readAttachments(ofdResolve(docPath, loc))
+		}
+	}
+	for _, loc := range d.CustomTags {
+		if strings.TrimSpace(loc) != "" {
+			doc.readCustomTags(ofdResolve(docPath, loc))
+		}
+	}
+	return doc, nil
+}
+
+func flattenOFDObjects(objs []ofdObjectXML, out []ofdObjectXML) []ofdObjectXML {
+	for _, o := range objs {
+		switch o.XMLName.Local {
+		case "TextObject", "PathObject", "ImageObject":
+			out = append(out, o)
+		default:
+			// Layers and PageBlocks only group objects.
+			out = flattenOFDObjects(o.Children, out)
+		}
+	}
+	return out
+}
+
+func (d *ofdDocument) readAttachments(listPath string) {
+	var list struct {
+		Items []struct {
+			Format  string `xml:"Format,attr"`
+			FileLoc string `xml:"FileLoc"`
+		} `xml:"Attachment"`
+	}
+	if err := d.archive.decode(listPath, &list); err != nil {
+		return
+	}
+	for _, it := range list.Items {
+		loc := strings.TrimSpace(it.FileLoc)
+		if !strings.EqualFold(strings.TrimSpace(it.Format), "xml") && !strings.HasSuffix(strings.ToLower(loc), ".xml") {
+			continue
+		}
+		if b, err := d.archive.read(ofdResolve(listPath, loc)); err == nil {
+			d.xmlAttachments = append(d.xmlAttachments, b)
+		}
+	}
+}
+
+// readCustomTags resolves the invoice field tags: each tag either holds its value or ObjectRefs to page text objects.
+func (d *ofdDocument) readCustomTags(listPath string) {
+	var list struct {
+		Items []struct {
+			FileLoc string `xml:"FileLoc"`
+		} `xml:"CustomTag"`
+	}
+	if err := d.archive.decode(listPath, &list); err != nil {
+		return
+	}
+	objectText := map[string]string{}
+	for _, p := range d.pages {
+		for _, o := range p.objects {
+			if o.XMLName.Local != "TextObject" || o.ID == "" {
+				continue
+			}
+			var sb strings.Builder
+			for _, tc := range o.TextCodes {
+				sb.WriteString(tc.Text)
+			}
+			objectText[o.ID] = strings.TrimSpace(sb.String())
+		}
+	}
+
+	for _, it := range list.Items {
+		b, err := d.archive.read(ofdResolve(listPath, it.FileLoc))
+		if err != nil {
+			continue
+		}
+		dec := xml.NewDecoder(bytes.NewReader(b))
+		stack := []string{}
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				break
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				stack = append(stack, strings.ToLower(t.Name.Local))
+			case xml.EndElement:
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+			case xml.CharData:
+				v := strings.TrimSpace(string(t))
+				if v == "" || len(stack) == 0 {
+					continue
+				}
+				owner := stack[len(stack)-1]
+				if owner == "objectref" {
+					if len(stack) < 2 {
+						continue
+					}
+					owner = stack[len(stack)-2]
+					v = objectText[v]
+				}
+				if v != "" {
+					d.tags[owner] = append(d.tags[owner], v)
+				}
+			}
+		}
+	}
+}
+
+type ofdTextRun struct {
+	x0, x1 float64
+	y      float64
+	size   float64
+	text   string
+}
+
+func (d *ofdDocument) textRuns(page ofdPage) []ofdTextRun {
+	runs := make([]ofdTextRun, 0, len(page.objects))
+	for _, o := range page.objects {
+		if o.XMLName.Local != "TextObject" {
+			continue
+		}
+		bx, by := ofdBoundaryOrigin(o.Boundary)
+		ctm := ofdMatrix(o.CTM)
+		size := ofdNumber(o.Size, 3.5)
+		if ctm != nil {
+			size *= math.Sqrt(math.Abs(ctm[0]*ctm[3] - ctm[1]*ctm[2]))
+		}
+		for _, tc := range o.TextCodes {
+			text := strings.TrimSpace(tc.Text)
+			if text == "" {
+				continue
+			}
+			xs := ofdGlyphPositions(ofdNumber(tc.X, 0), tc.DeltaX, len([]rune(tc.Text)))
+			y := ofdNumber(tc.Y, 0)
+			last := []rune(tc.Text)[len([]rune(tc.Text))-1]
+			width := size
+			if last < 0x80 {
+				width = size / 2
+			}
+			x0, y0 := ofdApply(ctm, xs[0], y)
+			x1, _ := ofdApply(ctm, xs[len(xs)-1]+width, y)
+			if len(xs) < len([]rune(tc.Text)) {
+				// Without per-glyph deltas, estimate the run width from the glyph count.
+				x1, _ = ofdApply(ctm, xs[0]+float64(len([]rune(tc.Text)))*width, y)
+			}
+			runs = append(runs, ofdTextRun{x0: bx + x0, x1: bx + x1, y: by + y0, size: size, text: text})
+		}
+	}
+	return runs
+}
+
+// Text reconstructs the reading-order text: runs on one baseline form a line and glyph-level runs are glued back together.
+func (d *ofdDocument) Text() string {
+	lines := make([]string, 0, 64)
+	for _, page := range d.pages {
+		runs := d.textRuns(page)
+		sort.SliceStable(runs, func(i, j int) bool {
+			if math.Abs(runs[i].y-runs[j].y) > 0.01 {
+				return runs[i].y < runs[j].y
+			}
+			return runs[i].x0 < runs[j].x0
+		})
+		for start := 0; start < len(runs); {
+			end := start + 1
+			for end < len(runs) && math.Abs(runs[end].y-runs[start].y) <= runs[start].size*0.4 {
+				end++
+			}
+			row := append([]ofdTextRun{}, runs[start:end]...)
+			sort.SliceStable(row, func(i, j int) bool { return row[i].x0 < row[j].x0 })
+			var sb strings.Builder
+			for i, r := range row {
+				if i > 0 && r.x0-row[i-1].x1 > r.size*0.3 {
+					sb.WriteString(" ")
+				}
+				sb.WriteString(r.text)
+			}
+			lines = append(lines, sb.String())
+			start = end
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (d *ofdDocument) tag(keys ...string) string {
+	for _, k := range keys {
+		if vs := d.tags[strings.ToLower(k)]; len(vs) > 0 {
+			return strings.TrimSpace(strings.Join(vs, ""))
+		}
+		if v := strings.TrimSpace(d.customData[k]); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// extractOFDInvoiceData maps an OFD invoice into InvoiceExtractedData.
+// Field priority: the embedded original XML, then the custom tags/doc info, then the text-layer parser.
+func extractOFDInvoiceData(ocr *OCRService, doc *ofdDocument) (*InvoiceExtractedData, error) {
+	text := doc.Text()
+	var data *InvoiceExtractedData
+	if strings.TrimSpace(text) != "" && ocr != nil {
+		data, _ = ocr.ParseInvoiceDataWithMeta(text, nil)
+	}
+	if data == nil {
+		data = &InvoiceExtractedData{}
+	}
+	data.RawText = text
+	data.RawTextSource = "ofd"
+
+	overlayString := func(dst **string, source *string, confidence *float64, v string, from string) {
+		if v = strings.TrimSpace(v); v != "" {
+			*dst = ptrString(v)
+			*source = from
+			*confidence = 1
+		}
+	}
+	overlayAmount := func(dst **float64, source *string, confidence *float64, v *float64, from string) {
+		if v != nil {
+			*dst = v
+			*source = from
+			*confidence = 1
+		}
+	}
+
+	date := doc.tag("IssueDate", "kprq", "开票日期")
+	if norm := normalizeDate(date); norm != "" {
+		date = norm
+	}
+	overlayString(&data.InvoiceNumber, &data.InvoiceNumberSource, &data.InvoiceNumberConfidence, doc.tag("InvoiceNo", "InvoiceNumber", "fphm", "发票号码"), "ofd")
+	overlayString(&data.InvoiceDate, &data.InvoiceDateSource, &data.InvoiceDateConfidence, date, "ofd")
+	overlayAmount(&data.Amount, &data.AmountSource, &data.AmountConfidence, parseAmountLoose(doc.tag("TaxInclusiveTotalAmount", "jshj", "价税合计")), "ofd")
+	overlayAmount(&data.TaxAmount, &data.TaxAmountSource, &data.TaxAmountConfidence, parseAmountLoose(doc.tag("TaxTotalAmount", "hjse", "合计税额")), "ofd")
+	overlayString(&data.SellerName, &data.SellerNameSource, &data.SellerNameConfidence, doc.tag("SellerName", "xfmc", "销售方名称"), "ofd")
+	overlayString(&data.BuyerName, &data.BuyerNameSource, &data.BuyerNameConfidence, doc.tag("BuyerName", "gfmc", "购买方名称"), "ofd")
+	overlayTaxID := func(dst **string, v string) {
+		if v = strings.TrimSpace(v); v != "" {
+			*dst = ptrString(v)
+		}
+	}
+	overlayTaxID(&data.SellerTaxID, doc.tag("SellerTaxID", "xfsbh", "销售方纳税人识别号"))
+	overlayTaxID(&data.BuyerTaxID, doc.tag("BuyerTaxID", "gfsbh", "购买方纳税人识别号"))
+
+	for _, b := range doc.xmlAttachments {
+		x, err := parseInvoiceXMLToExtracted(b)
+		if err != nil {
+			continue
+		}
+		overlayString(&data.InvoiceNumber, &data.InvoiceNumberSource, &data.InvoiceNumberConfidence, strPtrVal(x.InvoiceNumber), "xml")
+		overlayString(&data.InvoiceDate, &data.InvoiceDateSource, &data.InvoiceDateConfidence, strPtrVal(x.InvoiceDate), "xml")
+		overlayAmount(&data.Amount, &data.AmountSource, &data.AmountConfidence, x.Amount, "xml")
+		overlayAmount(&data.TaxAmount, &data.TaxAmountSource, &data.TaxAmountConfidence, x.TaxAmount, "xml")
+		overlayString(&data.SellerName, &data.SellerNameSource, &data.SellerNameConfidence, strPtrVal(x.SellerName), "xml")
+		overlayString(&data.BuyerName, &data.BuyerNameSource, &data.BuyerNameConfidence, strPtrVal(x.BuyerName), "xml")
+		overlayTaxID(&data.SellerTaxID, strPtrVal(x.SellerTaxID))
+		overlayTaxID(&data.BuyerTaxID, strPtrVal(x.BuyerTaxID))
+		if x.InvoiceType != "" && x.InvoiceType != InvoiceTypeOther {
+			data.InvoiceType = x.InvoiceType
+		}
+		if len(x.Items) > 0 {
+			data.Items = x.Items
+		}
+		if len(x.Journeys) > 0 {
+			data.Journeys = x.Journeys
+		}
+		if x.TypeDetails != nil {
+			data.TypeDetails = x.TypeDetails
+		}
+		break
+	}
+
+	if data.InvoiceType == "" {
+		data.InvoiceType = classifyInvoiceType(text)
+	}
+
+	if data.InvoiceNumber == nil && data.InvoiceDate == nil && data.Amount == nil && data.SellerName == nil {
+		return nil, fmt.Errorf("no invoice fields found in ofd")
+	}
+	return data, nil
+}
+
+func parseOFDInvoiceFile(ocr *OCRService, filePath string) (*InvoiceExtractedData, error) {
+	doc, err := readOFDFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return extractOFDInvoiceData(ocr, doc)
+}
+
+// RenderOFDPreviewSVG draws the pages of an OFD file (text, paths and PNG/JPEG images) as one SVG image.
+// Electronic seals are stored as signed blobs and are not rendered.
+func RenderOFDPreviewSVG(filePath string) ([]byte, error) {
+	doc, err := readOFDFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return doc.renderSVG(), nil
+}
+
+func (d *ofdDocument) renderSVG() []byte {
+	width, height := 0.0, 0.0
+	for i, p := range d.pages {
+		width = max(width, p.width)
+		if i > 0 {
+			height += ofdPreviewPageGap
+		}
+		height += p.height
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %s %s">`,
+		ofdFmt(width*ofdPreviewPixelsPerMM), ofdFmt(height*ofdPreviewPixelsPerMM), ofdFmt(width), ofdFmt(height))
+	offset := 0.0
+	for _, p := range d.pages {
+		fmt.Fprintf(&sb, `<g transform="translate(0 %s)">`, ofdFmt(offset))
+		fmt.Fprintf(&sb, `<rect width="%s" height="%s" fill="#ffffff"/>`, ofdFmt(p.width), ofdFmt(p.height))
+		for _, o := range p.objects {
+			d.renderObjectSVG(&sb, o)
+		}
+		sb.WriteString(`</g>`)
+		offset += p.height + ofdPreviewPageGap
+	}
+	sb.WriteString(`</svg>`)
+	return []byte(sb.String())
+}
+
+func (d *ofdDocument) renderObjectSVG(sb *strings.Builder, o ofdObjectXML) {
+	b := ofdNumbers(o.Boundary)
+	if len(b) < 4 {
+		return
+	}
+	transform := fmt.Sprintf("translate(%s %s)", ofdFmt(b[0]), ofdFmt(b[1]))
+	if m := ofdMatrix(o.CTM); m != nil {
+		transform += fmt.Sprintf(" matrix(%s %s %s %s %s %s)", ofdFmt(m[0]), ofdFmt(m[1]), ofdFmt(m[2]), ofdFmt(m[3]), ofdFmt(m[4]), ofdFmt(m[5]))
+	} else if o.XMLName.Local == "ImageObject" {
+		// Images are drawn into the unit square; without a CTM they fill their boundary.
+		transform += fmt.Sprintf(" scale(%s %s)", ofdFmt(b[2]), ofdFmt(b[3]))
+	}
+
+	switch o.XMLName.Local {
+	case "TextObject":
+		size := ofdNumber(o.Size, 3.5)
+		family := "serif"
+		if name := d.fonts[o.Font]; name != "" {
+			family = "'" + strings.NewReplacer("'", "", "\"", "").Replace(name) + "', serif"
+		}
+		fmt.Fprintf(sb, `<g transform="%s" font-size="%s" font-family="%s" fill="%s">`, transform, ofdFmt(size), ofdEscape(family), ofdColor(o.FillColor, "#000000"))
+		for _, tc := range o.TextCodes {
+			if strings.TrimSpace(tc.Text) == "" {
+				continue
+			}
+			n := len([]rune(tc.Text))
+			fmt.Fprintf(sb, `<text x="%s" y="%s" xml:space="preserve">%s</text>`,
+				ofdJoin(ofdGlyphPositions(ofdNumber(tc.X, 0), tc.DeltaX, n)), ofdJoin(ofdGlyphPositions(ofdNumber(tc.Y, 0), tc.DeltaY, n)), ofdEscape(tc.Text))
+		}
+		sb.WriteString(`</g>`)
+	case "PathObject":
+		data := ofdPathToSVG(o.AbbreviatedData)
+		if data == "" {
+			return
+		}
+		fill := "none"
+		if strings.EqualFold(strings.TrimSpace(o.Fill), "true") {
+			fill = ofdColor(o.FillColor, "#000000")
+		}
+		stroke := ofdColor(o.StrokeColor, "#000000")
+		if strings.EqualFold(strings.TrimSpace(o.Stroke), "false") {
+			stroke = "none"
+		}
+		fmt.Fprintf(sb, `<path transform="%s" d="%s" fill="%s" stroke="%s" stroke-width="%s"/>`,
+			transform, data, fill, stroke, ofdFmt(ofdNumber(o.LineWidth, 0.353)))
+	case "ImageObject":
+		loc, ok := d.media[o.ResourceID]
+		if !ok {
+			return
+		}
+		img, err := d.archive.read(loc)
+		if err != nil {
+			return
+		}
+		mime := ""
+		switch {
+		case bytes.HasPrefix(img, []byte("\x89PNG")):
+			mime = "image/png"
+		case bytes.HasPrefix(img, []byte("\xff\xd8")):
+			mime = "image/jpeg"
+		default:
+			return
+		}
+		fmt.Fprintf(sb, `<image transform="%s" width="1" height="1" preserveAspectRatio="none" href="data:%s;base64,%s"/>`,
+			transform, mime, base64.StdEncoding.EncodeToString(img))
+	}
+}
+
+// ofdPathToSVG converts OFD abbreviated path data; the commands map one-to-one onto SVG path commands.
+func ofdPathToSVG(data string) string {
+	commands := map[string]string{"S": "M", "M": "M", "L": "L", "Q": "Q", "B": "C", "A": "A", "C": "Z"}
+	out := make([]string, 0, 32)
+	for _, tok := range strings.Fields(data) {
+		if cmd, ok := commands[tok]; ok {
+			out = append(out, cmd)
+			continue
+		}
+		if v, err := strconv.ParseFloat(tok, 64); err == nil {
+			out = append(out, ofdFmt(v))
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// ofdGlyphPositions expands a DeltaX/DeltaY list (with the "g count value" shorthand) into per-glyph offsets.
+func ofdGlyphPositions(start float64, deltas string, glyphs int) []float64 {
+	pos := []float64{start}
+	f := strings.Fields(deltas)
+	for i := 0; i < len(f) && len(pos) < glyphs; i++ {
+		if f[i] == "g" && i+2 < len(f) {
+			n, _ := strconv.Atoi(f[i+1])
+			v, err := strconv.ParseFloat(f[i+2], 64)
+			i += 2
+			if err != nil {
+				continue
+			}
+			for ; n > 0 && len(pos) < glyphs; n-- {
+				pos = append(pos, pos[len(pos)-1]+v)
+			}
+			continue
+		}
+		if v, err := strconv.ParseFloat(f[i], 64); err == nil {
+			pos = append(pos, pos[len(pos)-1]+v)
+		}
+	}
+	return pos
+}
+
+func ofdNumbers(s string) []float64 {
+	fields := strings.Fields(s)
+	out := make([]float64, 0, len(fields))
+	for _, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+func ofdNumber(s string, def float64) float64 {
+	if v, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil && !math.IsNaN(v) && !math.IsInf(v, 0) {
+		return v
+	}
+	return def
+}
+
+func ofdBoundaryOrigin(boundary string) (float64, float64) {
+	if b := ofdNumbers(boundary); len(b) >= 2 {
+		return b[0], b[1]
+	}
+	return 0, 0
+}
+
+func ofdMatrix(ctm string) []float64 {
+	if m := ofdNumbers(ctm); len(m) == 6 {
+		return m
+	}
+	return nil
+}
+
+func ofdApply(m []float64, x, y float64) (float64, float64) {
+	if m == nil {
+		return x, y
+	}
+	return m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]
+}
+
+func ofdColor(c *ofdColorXML, def string) string {
+	if c == nil {
+		return def
+	}
+	v := ofdNumbers(c.Value)
+	if len(v) < 3 {
+		return def
+	}
+	clamp := func(f float64) int { return int(math.Max(0, math.Min(255, f))) }
+	return fmt.Sprintf("#%02x%02x%02x", clamp(v[0]), clamp(v[1]), clamp(v[2]))
+}
+
+func ofdFmt(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func ofdJoin(vs []float64) string {
+	parts := make([]string, len(vs))
+	for i, v := range vs {
+		parts[i] = ofdFmt(v)
+	}
+	return strings.Join(parts, " ")
+}
+
+func ofdEscape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-message/mail"
+)
+
+// testOFDInvoice builds a minimal tax-bureau style OFD: labels on a template page, values and
+// glyph-positioned text on the page, custom tags pointing at the value objects and optional attachments.
+func testOFDInvoice(t *testing.T, attachments map[string]string) []byte {
+	t.Helper()
+	files := map[string]string{
+		"OFD.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<ofd:OFD xmlns:ofd="http://www.ofdspec.org/2016" Version="1.1" DocType="OFD">
+  <ofd:DocBody>
+    <ofd:DocInfo><ofd:CustomDatas><ofd:CustomData Name="发票号码">25442000000123456789</ofd:CustomData></ofd:CustomDatas></ofd:DocInfo>
+    <ofd:DocRoot>Doc_0/Document.xml</ofd:DocRoot>
+  </ofd:DocBody>
+</ofd:OFD>`,
+		"Doc_0/Document.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<ofd:Document xmlns:ofd="http://www.ofdspec.org/2016">
+  <ofd:CommonData>
+    <ofd:PageArea><ofd:PhysicalBox>0 0 210 140</ofd:PhysicalBox></ofd:PageArea>
+    <ofd:PublicRes>PublicRes.xml</ofd:PublicRes>
+    <ofd:TemplatePage ID="2" BaseLoc="Tpls/Tpl_0/Content.xml"/>
+  </ofd:CommonData>
+  <ofd:Pages><ofd:Page ID="1" BaseLoc="Pages/Page_0/Content.xml"/></ofd:Pages>
+  <ofd:Attachments>Attachs/Attachments.xml</ofd:Attachments>
+  <ofd:CustomTags>Tags/CustomTags.xml</ofd:CustomTags>
+</ofd:Document>`,
+		"Doc_0/PublicRes.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<ofd:Res xmlns:ofd="http://www.ofdspec.org/2016" BaseLoc="Res">
+  <ofd:Fonts><ofd:Font ID="3" FontName="宋体" FamilyName="宋体"/></ofd:Fonts>
+</ofd:Res>`,
+		"Doc_0/Tpls/Tpl_0/Content.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<ofd:Page xmlns:ofd="http://www.ofdspec.org/2016">
+  <ofd:Content><ofd:Layer ID="4">
+    <ofd:TextObject ID="5" Boundary="60 8 90 8" Font="3" Size="6"><ofd:TextCode X="0" Y="6">电子发票（普通发票）</ofd:TextCode></ofd:TextObject>
+    <ofd:TextObject ID="6" Boundary="140 20 20 4" Font="3" Size="3"><ofd:TextCode X="0" Y="3">发票号码：</ofd:TextCode></ofd:TextObject>
+    <ofd:TextObject ID="7" Boundary="140 26 20 4" Font="3" Size="3"><ofd:TextCode X="0" Y="3">开票日期：</ofd:TextCode></ofd:TextObject>
+    <ofd:TextObject ID="8" Boundary="10 40 20 4" Font="3" Size="3"><ofd:TextCode X="0" Y="3">购买方名称：</ofd:TextCode></ofd:TextObject>
+    <ofd:TextObject ID="9" Boundary="110 40 20 4" Font="3" Size="3"><ofd:TextCode X="0" Y="3">销售方名称：</ofd:TextCode></ofd:TextObject>
+    <ofd:TextObject ID="10" Boundary="10 110 40 4" Font="3" Size="3"><ofd:TextCode X="0" Y="3">价税合计（小写）</ofd:TextCode></ofd:TextObject>
+    <ofd:PathObject ID="11" Boundary="5 35 200 70" LineWidth="0.25"><ofd:StrokeColor Value="128 0 0"/><ofd:AbbreviatedData>M 0 0 L 200 0 L 200 70 L 0 70 C</ofd:AbbreviatedData></ofd:PathObject>
+  </ofd:Layer></ofd:Content>
+</ofd:Page>`,
+		"Doc_0/Pages/Page_0/Content.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<ofd:Page xmlns:ofd="http://www.ofdspec.org/2016">
+  <ofd:Template TemplateID="2" ZOrder="Background"/>
+  <ofd:Content><ofd:Layer ID="20"><ofd:PageBlock ID="21">
+    <ofd:TextObject ID="22" Boundary="156 20 40 4" Font="3" Size="3"><ofd:TextCode X="0" Y="3" DeltaX="g 19 1.5">25442000000123456789</ofd:TextCode></ofd:TextObject>
+    <ofd:TextObject ID="23" Boundary="156 26 40 4" Font="3" Size="3"><ofd:TextCode X="0" Y="3">2025年11月28日</ofd:TextCode></ofd:TextObject>
+    <ofd:TextObject ID="24" Boundary="30 40 10 4" Font="3" Size="3"><ofd:TextCode X="0" Y="3">张</ofd:TextCode></ofd:TextObject>
+    <ofd:TextObject ID="25" Boundary="33 40 10 4" Font="3" Size="3"><ofd:TextCode X="0" Y="3">三</ofd:TextCode></ofd:TextObject>
+    <ofd:TextObject ID="26" Boundary="130 40 60 4" Font="3" Size="3"><ofd:TextCode X="0" Y="3">深圳市某某科技有限公司</ofd:TextCode></ofd:TextObject>
+    <ofd:TextObject ID="27" Boundary="160 110 30 4" Font="3" Size="3"><ofd:TextCode X="0" Y="3">¥113.00</ofd:TextCode></ofd:TextObject>
+    <ofd:TextObject ID="28" Boundary="160 100 30 4" Font="3" Size="3"><ofd:TextCode X="0" Y="3">¥13.00</ofd:TextCode></ofd:TextObject>
+  </ofd:PageBlock></ofd:Layer></ofd:Content>
+</ofd:Page>`,
+		"Doc_0/Tags/CustomTags.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<ofd:CustomTags xmlns:ofd="http://www.ofdspec.org/2016">
+  <ofd:CustomTag NameSpace="ofd:invoice"><ofd:FileLoc>CustomTag.xml</ofd:FileLoc></ofd:CustomTag>
+</ofd:CustomTags>`,
+		"Doc_0/Tags/CustomTag.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<fp:eInvoice xmlns:fp="http://www.chinatax.gov.cn/ofd/invoice" xmlns:ofd="http://www.ofdspec.org/2016">
+  <fp:InvoiceNo><ofd:ObjectRef PageRef="1">22</ofd:ObjectRef></fp:InvoiceNo>
+  <fp:IssueDate><ofd:ObjectRef PageRef="1">23</ofd:ObjectRef></fp:IssueDate>
+  <fp:Buyer><fp:BuyerName><ofd:ObjectRef PageRef="1">24</ofd:ObjectRef><ofd:ObjectRef PageRef="1">25</ofd:ObjectRef></fp:BuyerName></fp:Buyer>
+  <fp:Seller><fp:SellerName><ofd:ObjectRef PageRef="1">26</ofd:ObjectRef></fp:SellerName></fp:Seller>
+  <fp:TaxInclusiveTotalAmount><ofd:ObjectRef PageRef="1">27</ofd:ObjectRef></fp:TaxInclusiveTotalAmount>
+  <fp:TaxTotalAmount><ofd:ObjectRef PageRef="1">28</ofd:ObjectRef></fp:TaxTotalAmount>
+</fp:eInvoice>`,
+	}
+	list := `<?xml version="1.0" encoding="UTF-8"?><ofd:Attachments xmlns:ofd="http://www.ofdspec.org/2016">`
+	for name, content := range attachments {
+		list += `<ofd:Attachment ID="30" Name="` + name + `" Format="xml"><ofd:FileLoc>` + name + `</ofd:FileLoc></ofd:Attachment>`
+		files["Doc_0/Attachs/"+name] = content
+	}
+	files["Doc_0/Attachs/Attachments.xml"] = list + `</ofd:Attachments>`
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zip create: %v", err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("zip write: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractOFDInvoiceData_TagsAndTextLayer(t *testing.T) {
+	doc, err := readOFD(testOFDInvoice(t, nil))
+	if err != nil {
+		t.Fatalf("读取 OFD 失败: %v", err)
+	}
+	text := doc.Text()
+	for _, want := range []string{"电子发票（普通发票）", "发票号码： 25442000000123456789", "购买方名称： 张三 销售方名称： 深圳市某某科技有限公司"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("文本层应按阅读顺序还原 %q:\n%s", want, text)
+		}
+	}
+
+	data, err := extractOFDInvoiceData(&OCRService{}, doc)
+	if err != nil {
+		t.Fatalf("解析 OFD 发票失败: %v", err)
+	}
+	if strPtrVal(data.InvoiceNumber) != "25442000000123456789" || strPtrVal(data.InvoiceDate) != "2025-11-28" ||
+		strPtrVal(data.BuyerName) != "张三" || strPtrVal(data.SellerName) != "深圳市某某科技有限公司" {
+		t.Fatalf("应从自定义标签提取发票字段: %#v", data)
+	}
+	if data.Amount == nil || *data.Amount != 113 || data.TaxAmount == nil || *data.TaxAmount != 13 || data.AmountSource != "ofd" {
+		t.Fatalf("应从自定义标签提取金额: %#v", data)
+	}
+	if data.RawTextSource != "ofd" || data.RawText != text {
+		t.Fatalf("应保留 OFD 文本层: %#v", data)
+	}
+}
+
+func TestExtractOFDInvoiceData_PrefersEmbeddedXML(t *testing.T) {
+	original := `<?xml version="1.0" encoding="UTF-8"?>
+<EInvoice>
+  <EIid>25442000000123456789</EIid>
+  <TotalTax-includedAmount>113.00</TotalTax-includedAmount>
+  <SellerName>深圳市某某科技股份有限公司</SellerName>
+  <ItemName>*信息技术服务*软件服务费</ItemName>
+</EInvoice>`
+	dir := t.TempDir()
+	path := filepath.Join(dir, "invoice.ofd")
+	if err := os.WriteFile(path, testOFDInvoice(t, map[string]string{"original_invoice.xml": original}), 0o644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+
+	data, err := parseOFDInvoiceFile(&OCRService{}, path)
+	if err != nil {
+		t.Fatalf("解析 OFD 发票失败: %v", err)
+	}
+	if strPtrVal(data.SellerName) != "深圳市某某科技股份有限公司" || data.SellerNameSource != "xml" {
+		t.Fatalf("内嵌原始 XML 应优先: %#v", data)
+	}
+	if strPtrVal(data.BuyerName) != "张三" || data.BuyerNameSource != "ofd" {
+		t.Fatalf("XML 缺失的字段应保留标签值: %#v", data)
+	}
+	if len(data.Items) != 1 || data.Items[0].Name != "*信息技术服务*软件服务费" {
+		t.Fatalf("应使用 XML 中的明细: %#v", data.Items)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "broken.ofd"), []byte("PK\x03\x04broken"), 0o644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	if _, err := parseOFDInvoiceFile(&OCRService{}, filepath.Join(dir, "broken.ofd")); err == nil {
+		t.Fatalf("损坏的 OFD 应返回错误")
+	}
+}
+
+func TestRenderOFDPreviewSVG(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invoice.ofd")
+	if err := os.WriteFile(path, testOFDInvoice(t, nil), 0o644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	svg, err := RenderOFDPreviewSVG(path)
+	if err != nil {
+		t.Fatalf("生成预览失败: %v", err)
+	}
+	s := string(svg)
+	for _, want := range []string{
+		`viewBox="0 0 210 140"`,
+		`font-family="&#39;宋体&#39;, serif"`,
+		`x="0 1.5 3 4.5`,
+		`>¥113.00</text>`,
+		`d="M 0 0 L 200 0 L 200 70 L 0 70 Z" fill="none" stroke="#800000"`,
+	} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("预览应包含 %q:\n%s", want, s)
+		}
+	}
+	if strings.Contains(s, "<script") {
+		t.Fatalf("预览不应包含脚本")
+	}
+}
+
+func TestExtractInvoiceArtifactsFromEmail_OFDAttachment(t *testing.T) {
+	ofd := base64.StdEncoding.EncodeToString(testOFDInvoice(t, nil))
+	build := func(withPDF bool) string {
+		parts := []string{
+			"From: test@example.com",
+			"To: you@example.com",
+			"Subject: ofd invoice",
+			"MIME-Version: 1.0",
+			"Content-Type: multipart/mixed; boundary=\"z\"",
+			"",
+			"--z",
+			"Content-Type: application/octet-stream",
+			"Content-Disposition: attachment; filename=\"dzfp_25442000000123456789.ofd\"",
+			"Content-Transfer-Encoding: base64",
+			"",
+			ofd,
+		}
+		if withPDF {
+			parts = append(parts,
+				"--z",
+				"Content-Type: application/pdf",
+				"Content-Disposition: attachment; filename=\"dzfp_25442000000123456789.pdf\"",
+				"",
+				"%PDF-1.4",
+			)
+		}
+		return strings.Join(append(parts, "--z--", ""), "\r\n")
+	}
+
+	for _, tc := range []struct {
+		withPDF  bool
+		wantName string
+	}{
+		{false, "dzfp_25442000000123456789.ofd"},
+		{true, "dzfp_25442000000123456789.pdf"},
+	} {
+		mr, err := mail.CreateReader(strings.NewReader(build(tc.withPDF)))
+		if err != nil {
+			t.Fatalf("CreateReader: %v", err)
+		}
+		name, b, _, extra, _, err := extractInvoiceArtifactsFromEmail(mr)
+		if err != nil {
+			t.Fatalf("extract: %v", err)
+		}
+		if name != tc.wantName || len(b) == 0 || len(extra) != 0 {
+			t.Fatalf("withPDF=%v: expected primary %q without extras, got %q (extras=%d)", tc.withPDF, tc.wantName, name, len(extra))
+		}
+	}
+}
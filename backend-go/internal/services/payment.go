@@ -7,6 +7,7 @@ import (
 	"log"
 	"math"
 	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/money"
 	"smart-bill-manager/internal/repository"
 	"smart-bill-manager/internal/utils"
 	"sort"
@@ -22,6 +23,7 @@ type PaymentService struct {
 	db          *gorm.DB
 	repo        *repository.PaymentRepository
 	invoiceRepo *repository.InvoiceRepository
+	rideRepo    *repository.InvoiceRideRepository
 	blobRepo    *repository.OCRBlobRepository
 	ocrService  *OCRService
 	uploadsDir  string
@@ -32,6 +34,7 @@ func NewPaymentService(db *gorm.DB, uploadsDir string) *PaymentService {
 		db:          db,
 		repo:        repository.NewPaymentRepository(db),
 		invoiceRepo: repository.NewInvoiceRepository(db),
+		rideRepo:    repository.NewInvoiceRideRepository(db),
 		blobRepo:    repository.NewOCRBlobRepository(db),
 		ocrService:  NewOCRService(),
 		uploadsDir:  uploadsDir,
@@ -51,6 +54,7 @@ func (s *PaymentService) CreateDraftFromScreenshotUpload(ownerUserID string, scr
 		TransactionTimeTs: unixMilli(now),
 		ScreenshotPath:    &screenshotPath,
 		FileSHA256:        fileSHA256,
+		PerceptualHash:    computeStoredFilePerceptualHash(s.uploadsDir, screenshotPath),
 		TripAssignSrc:     assignSrcAuto,
 		TripAssignState:   assignStateNoMatch,
 		DedupStatus:       DedupStatusOK,
@@ -86,6 +90,7 @@ func (s *PaymentService) UpdateDraftScreenshotPath(ownerUserID string, paymentID
 
 	update := map[string]any{
 		"screenshot_path": screenshotPath,
+		"perceptual_hash": computeStoredFilePerceptualHash(s.uploadsDir, screenshotPath),
 	}
 	if fileSHA256 != nil {
 		h := strings.TrimSpace(*fileSHA256)
@@ -109,6 +114,9 @@ type paymentOCRTaskResult struct {
 	ScreenshotPath string                `json:"screenshot_path"`
 	OCRError       string                `json:"ocr_error,omitempty"`
 	Dedup          any                   `json:"dedup,omitempty"`
+	// Rows is set for bill-list screenshots: one draft per transaction row. The top-level
+	// fields repeat the first row.
+	Rows []*paymentOCRTaskResult `json:"rows,omitempty"`
 }
 
 func (s *PaymentService) ProcessPaymentOCRTask(paymentID string) (any, error) {
@@ -125,16 +133,93 @@ func (s *PaymentService) ProcessPaymentOCRTask(paymentID string) (any, error) {
 		return nil, fmt.Errorf("payment has no screenshot")
 	}
 
-	text, err := s.ocrService.RecognizePaymentScreenshot(*payment.ScreenshotPath)
+	recognized, err := s.ocrService.RecognizePaymentScreenshotLines(*payment.ScreenshotPath)
 	if err != nil {
 		return nil, err
 	}
+	if rows := s.ocrService.ParsePaymentListScreenshot(recognized.Lines); len(rows) > 1 {
+		return s.processPaymentListOCR(payment, rows)
+	}
 
-	extracted, parseErr := s.ocrService.ParsePaymentScreenshot(text)
+	extracted, parseErr := s.ocrService.ParsePaymentScreenshot(recognized.Text)
 	if parseErr != nil {
 		return nil, parseErr
 	}
+	return s.applyPaymentOCRResult(payment, extracted)
+}
+
+// processPaymentListOCR turns the uploaded draft into the first row of a bill-list screenshot
+// and creates one more draft per remaining row, all in one transaction so a failure leaves no
+// partial set of rows. Drafts left by an earlier run of the task for the same screenshot are
+// replaced. Only the first draft keeps the file hashes, so confirming one row never blocks its
+// siblings as a copy of the same file.
+func (s *PaymentService) processPaymentListOCR(payment *models.Payment, rows []*PaymentExtractedData) (*paymentOCRTaskResult, error) {
+	ownerUserID := strings.TrimSpace(payment.OwnerUserID)
+	screenshotPath := strings.TrimSpace(*payment.ScreenshotPath)
 
+	results := make([]*paymentOCRTaskResult, 0, len(rows))
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		var stale []string
+		if err := tx.Model(&models.Payment{}).
+			Where("owner_user_id = ? AND is_draft = 1 AND screenshot_path = ? AND id <> ?", ownerUserID, screenshotPath, payment.ID).
+			Pluck("id", &stale).Error; err != nil {
+			return err
+		}
+		for _, id := range stale {
+			if err := s.deletePaymentTx(tx, ownerUserID, id); err != nil {
+				return err
+			}
+		}
+
+		for i, row := range rows {
+			draft := payment
+			if i > 0 {
+				now := time.Now().UTC()
+				draft = &models.Payment{
+					ID:                utils.GenerateUUID(),
+					OwnerUserID:       ownerUserID,
+					IsDraft:           true,
+					TransactionTime:   now.Format(time.RFC3339),
+					TransactionTimeTs: unixMilli(now),
+					ScreenshotPath:    &screenshotPath,
+					TripAssignSrc:     assignSrcAuto,
+					TripAssignState:   assignStateNoMatch,
+					DedupStatus:       DedupStatusOK,
+				}
+				if err := tx.Create(draft).Error; err != nil {
+					return err
+				}
+			}
+			res, err := s.applyPaymentOCRResultTx(tx, draft, row)
+			if err != nil {
+				return err
+			}
+			results = append(results, res)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	out := *results[0]
+	out.Rows = results
+	return &out, nil
+}
+
+// applyPaymentOCRResult stores the fields recognized from a screenshot on a draft payment and
+// flags suspected duplicates of the result.
+func (s *PaymentService) applyPaymentOCRResult(payment *models.Payment, extracted *PaymentExtractedData) (*paymentOCRTaskResult, error) {
+	var out *paymentOCRTaskResult
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		out, err = s.applyPaymentOCRResultTx(tx, payment, extracted)
+		return err
+	})
+	return out, err
+}
+
+func (s *PaymentService) applyPaymentOCRResultTx(tx *gorm.DB, payment *models.Payment, extracted *PaymentExtractedData) (*paymentOCRTaskResult, error) {
+	paymentID := payment.ID
 	warn := ""
 	if extracted.TransactionTime == nil || strings.TrimSpace(*extracted.TransactionTime) == "" {
 		warn = "missing transaction time"
@@ -150,6 +235,9 @@ func (s *PaymentService) ProcessPaymentOCRTask(paymentID string) (any, error) {
 		}
 	}
 
+	if err := s.proposeRefundOriginal(tx, payment.OwnerUserID, paymentID, extracted); err != nil {
+		return nil, err
+	}
 	extractedDataJSON, err := ExtractedDataToJSON(extracted)
 	if err != nil {
 		extractedDataJSON = nil
@@ -177,33 +265,46 @@ func (s *PaymentService) ProcessPaymentOCRTask(paymentID string) (any, error) {
 		}
 	}
 
-	db := s.db
 	ownerUserID := strings.TrimSpace(payment.OwnerUserID)
-	if err := db.Transaction(func(tx *gorm.DB) error {
-		if err := s.repo.WithDB(tx).Update(paymentID, updateData); err != nil {
-			return err
+	recognized := *payment
+	recognized.AmountCents = 0
+	if amount, ok := updateData["amount"].(float64); ok {
+		recognized.Amount = amount
+	}
+	recognized.Merchant = extracted.Merchant
+	recognized.PaymentMethod = extracted.PaymentMethod
+	if changed, err := applyCategoryRules(tx, ownerUserID, &recognized, extracted.Platform); err != nil {
+		return nil, err
+	} else if changed {
+		updateData["category"] = recognized.Category
+		updateData["trip_id"] = recognized.TripID
+		updateData["trip_assignment_source"] = recognized.TripAssignSrc
+		updateData["trip_assignment_state"] = recognized.TripAssignState
+	}
+	if payment.AccountID == nil {
+		if err := applyPaymentAccount(tx, ownerUserID, &recognized); err != nil {
+			return nil, err
+		} else if recognized.AccountID != nil {
+			updateData["account_id"] = *recognized.AccountID
 		}
-		return s.blobRepo.UpsertPaymentBlob(tx, ownerUserID, paymentID, extractedDataJSON)
-	}); err != nil {
+	}
+	if err := s.repo.WithDB(tx).Update(paymentID, updateData); err != nil {
 		return nil, err
 	}
-
-	updated, err := s.repo.FindByID(paymentID)
-	if err != nil {
+	if err := s.blobRepo.UpsertPaymentBlob(tx, ownerUserID, paymentID, extractedDataJSON); err != nil {
 		return nil, err
 	}
-	dedup := any(nil)
-	blob, err := s.blobRepo.FindPaymentBlob(ownerUserID, updated.ID)
+
+	updated, err := s.repo.WithDB(tx).FindByID(paymentID)
 	if err != nil {
 		return nil, err
 	}
-	if blob != nil {
-		updated.ExtractedData = blob.ExtractedData
-	}
+	dedup := any(nil)
+	updated.ExtractedData = extractedDataJSON
 
-	// If we have a meaningful amount+time, compute suspected duplicates for UI.
-	if updated != nil && updated.Amount > 0 && updated.TransactionTimeTs > 0 {
-		cands, err := s.FindCandidatesByAmountTimeForOwner(strings.TrimSpace(updated.OwnerUserID), updated.Amount, updated.TransactionTimeTs, updated.ID, 5*time.Minute, 5)
+	// Compute suspected duplicates for UI: amount+time when recognized, otherwise a near-identical screenshot.
+	if updated != nil {
+		reason, cands, err := findSuspectedPaymentDuplicatesForOwner(tx, strings.TrimSpace(updated.OwnerUserID), updated.Amount, updated.Currency, updated.TransactionTimeTs, updated.PerceptualHash, updated.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -211,7 +312,7 @@ func (s *PaymentService) ProcessPaymentOCRTask(paymentID string) (any, error) {
 			updated.DedupStatus = DedupStatusSuspected
 			ref := cands[0].ID
 			updated.DedupRefID = &ref
-			if err := s.db.Model(&models.Payment{}).Where("id = ?", updated.ID).Updates(map[string]any{
+			if err := tx.Model(&models.Payment{}).Where("id = ?", updated.ID).Updates(map[string]any{
 				"dedup_status": DedupStatusSuspected,
 				"dedup_ref_id": ref,
 			}).Error; err != nil {
@@ -219,7 +320,7 @@ func (s *PaymentService) ProcessPaymentOCRTask(paymentID string) (any, error) {
 			}
 			dedup = map[string]any{
 				"kind":       "suspected_duplicate",
-				"reason":     "amount_time",
+				"reason":     reason,
 				"candidates": cands,
 			}
 		}
@@ -240,6 +341,7 @@ func (s *PaymentService) ProcessPaymentOCRTask(paymentID string) (any, error) {
 
 type CreatePaymentInput struct {
 	Amount          float64 `json:"amount" binding:"required"`
+	Currency        *string `json:"currency"`
 	Merchant        *string `json:"merchant"`
 	Category        *string `json:"category"`
 	PaymentMethod   *string `json:"payment_method"`
@@ -247,13 +349,27 @@ type CreatePaymentInput struct {
 	TransactionTime string  `json:"transaction_time" binding:"required"`
 	ScreenshotPath  *string `json:"screenshot_path"`
 	ExtractedData   *string `json:"extracted_data"`
+	// Set by statement/bill imports only; not accepted from the API.
+	ImportSource *string `json:"-"`
+	ExternalID   *string `json:"-"`
 }
 
 func (s *PaymentService) Create(ownerUserID string, input CreatePaymentInput) (*models.Payment, error) {
+	return s.create(ownerUserID, input, true)
+}
+
+// create inserts a payment. Batch inserts pass checkBudget=false and check budgets once afterwards.
+func (s *PaymentService) create(ownerUserID string, input CreatePaymentInput, checkBudget bool) (*models.Payment, error) {
 	t, err := parseRFC3339ToUTC(input.TransactionTime)
 	if err != nil {
 		return nil, fmt.Errorf("transaction_time must be RFC3339: %w", err)
 	}
+	currency := money.DefaultCurrency
+	if input.Currency != nil {
+		if currency, err = money.NormalizeCurrency(*input.Currency); err != nil {
+			return nil, err
+		}
+	}
 
 	var screenshotPath *string
 	if input.ScreenshotPath != nil {
@@ -274,6 +390,7 @@ func (s *PaymentService) Create(ownerUserID string, input CreatePaymentInput) (*
 		ID:                utils.GenerateUUID(),
 		OwnerUserID:       strings.TrimSpace(ownerUserID),
 		Amount:            input.Amount,
+		Currency:          currency,
 		Merchant:          input.Merchant,
 		Category:          input.Category,
 		PaymentMethod:     input.PaymentMethod,
@@ -282,6 +399,8 @@ func (s *PaymentService) Create(ownerUserID string, input CreatePaymentInput) (*
 		TransactionTimeTs: unixMilli(t),
 		ScreenshotPath:    screenshotPath,
 		ExtractedData:     nil, // stored in payment_ocr_blobs
+		ImportSource:      input.ImportSource,
+		ExternalID:        input.ExternalID,
 		DedupStatus:       DedupStatusOK,
 		TripAssignSrc:     assignSrcAuto,
 		TripAssignState:   assignStateNoMatch,
@@ -289,6 +408,12 @@ func (s *PaymentService) Create(ownerUserID string, input CreatePaymentInput) (*
 
 	db := s.db
 	if err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := applyCategoryRules(tx, payment.OwnerUserID, payment, extractedPlatform(extractedData)); err != nil {
+			return err
+		}
+		if err := applyPaymentAccount(tx, payment.OwnerUserID, payment); err != nil {
+			return err
+		}
 		if err := tx.Create(payment).Error; err != nil {
 			return err
 		}
@@ -301,6 +426,9 @@ func (s *PaymentService) Create(ownerUserID string, input CreatePaymentInput) (*
 	}); err != nil {
 		return nil, err
 	}
+	if checkBudget {
+		s.checkBudgetAlerts(payment.OwnerUserID, payment.ID)
+	}
 
 	// Include OCR payload in response.
 	if extractedData != nil {
@@ -316,6 +444,10 @@ type PaymentFilterInput struct {
 	StartDate string `form:"startDate"`
 	EndDate   string `form:"endDate"`
 	Category  string `form:"category"`
+	// TagIDs keeps payments carrying all of these tags (repeat tagIds=... in the query).
+	TagIDs []string `form:"tagIds"`
+	// AccountID keeps payments made from one account; "none" keeps payments without an account.
+	AccountID string `form:"accountId"`
 	// IncludeDraft controls whether draft records are included in listing/stats.
 	// Default is false.
 	IncludeDraft bool `form:"includeDraft"`
@@ -335,24 +467,33 @@ func normalizeLimitOffset(limit, offset int) (int, int) {
 }
 
 func (s *PaymentService) GetAll(ownerUserID string, filter PaymentFilterInput) ([]models.Payment, error) {
+	repoFilter, err := s.repositoryFilter(ownerUserID, filter)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.FindAll(repoFilter)
+}
+
+// repositoryFilter converts list query parameters into a repository filter.
+func (s *PaymentService) repositoryFilter(ownerUserID string, filter PaymentFilterInput) (repository.PaymentFilter, error) {
 	startTs := int64(0)
 	endTs := int64(0)
 	if strings.TrimSpace(filter.StartDate) != "" {
 		if t, err := parseRFC3339ToUTC(filter.StartDate); err == nil {
 			startTs = unixMilli(t)
 		} else {
-			return nil, fmt.Errorf("invalid startDate: %w", err)
+			return repository.PaymentFilter{}, fmt.Errorf("invalid startDate: %w", err)
 		}
 	}
 	if strings.TrimSpace(filter.EndDate) != "" {
 		if t, err := parseRFC3339ToUTC(filter.EndDate); err == nil {
 			endTs = unixMilli(t)
 		} else {
-			return nil, fmt.Errorf("invalid endDate: %w", err)
+			return repository.PaymentFilter{}, fmt.Errorf("invalid endDate: %w", err)
 		}
 	}
 
-	return s.repo.FindAll(repository.PaymentFilter{
+	return repository.PaymentFilter{
 		OwnerUserID:  strings.TrimSpace(ownerUserID),
 		Limit:        filter.Limit,
 		Offset:       filter.Offset,
@@ -361,8 +502,10 @@ func (s *PaymentService) GetAll(ownerUserID string, filter PaymentFilterInput) (
 		StartTs:      startTs,
 		EndTs:        endTs,
 		Category:     filter.Category,
+		TagIDs:       filter.TagIDs,
+		AccountID:    filter.AccountID,
 		IncludeDraft: filter.IncludeDraft,
-	})
+	}, nil
 }
 
 type PaymentListItem struct {
@@ -390,7 +533,7 @@ func (s *PaymentService) GetAllWithInvoiceCounts(ownerUserID string, filter Paym
 	}
 	var rows []row
 	if err := s.db.
-		Table("invoice_payment_links").
+		Table(repository.InvoicePaymentPairsTable+" AS l").
 		Select("payment_id, COUNT(*) AS cnt").
 		Where("payment_id IN ?", ids).
 		Group("payment_id").
@@ -460,6 +603,7 @@ func (s *PaymentService) ListWithInvoiceCountsCtx(ctx context.Context, ownerUser
 		"merchant",
 		"category",
 		"payment_method",
+		"account_id",
 		"description",
 		"transaction_time",
 		"transaction_time_ts",
@@ -480,6 +624,8 @@ func (s *PaymentService) ListWithInvoiceCountsCtx(ctx context.Context, ownerUser
 		StartTs:      startTs,
 		EndTs:        endTs,
 		Category:     filter.Category,
+		TagIDs:       filter.TagIDs,
+		AccountID:    filter.AccountID,
 		IncludeDraft: filter.IncludeDraft,
 	}, selectCols)
 	if err != nil {
@@ -500,7 +646,7 @@ func (s *PaymentService) ListWithInvoiceCountsCtx(ctx context.Context, ownerUser
 	}
 	var rows []row
 	if err := s.db.WithContext(ctx).
-		Table("invoice_payment_links").
+		Table(repository.InvoicePaymentPairsTable+" AS l").
 		Select("payment_id, COUNT(*) AS cnt").
 		Where("payment_id IN ?", ids).
 		Group("payment_id").
@@ -512,9 +658,14 @@ func (s *PaymentService) ListWithInvoiceCountsCtx(ctx context.Context, ownerUser
 	for _, r := range rows {
 		counts[strings.TrimSpace(r.PaymentID)] = r.Cnt
 	}
+	tags, err := paymentTagLink.load(s.db.WithContext(ctx), ownerUserID, ids)
+	if err != nil {
+		return nil, 0, err
+	}
 
 	out := make([]PaymentListItem, 0, len(payments))
 	for _, p := range payments {
+		p.Tags = tags[p.ID]
 		out = append(out, PaymentListItem{
 			Payment:      p,
 			InvoiceCount: counts[p.ID],
@@ -536,11 +687,15 @@ func (s *PaymentService) GetByIDCtx(ctx context.Context, ownerUserID string, id
 	if err == nil && blob != nil {
 		p.ExtractedData = blob.ExtractedData
 	}
+	if tags, err := paymentTagLink.load(s.db.WithContext(ctx), ownerUserID, []string{p.ID}); err == nil {
+		p.Tags = tags[p.ID]
+	}
 	return p, nil
 }
 
 type UpdatePaymentInput struct {
 	Amount             *float64 `json:"amount"`
+	Currency           *string  `json:"currency"`
 	Merchant           *string  `json:"merchant"`
 	Category           *string  `json:"category"`
 	PaymentMethod      *string  `json:"payment_method"`
@@ -551,6 +706,11 @@ type UpdatePaymentInput struct {
 	BadDebt            *bool    `json:"bad_debt"`
 	Confirm            *bool    `json:"confirm"`
 	ForceDuplicateSave *bool    `json:"force_duplicate_save"`
+	// RefundOfID links the payment as a refund of another one; "" removes the link.
+	RefundOfID *string `json:"refund_of_id"`
+	// AccountID links the payment to one of the owner's accounts; "" unlinks it. When omitted,
+	// a changed payment method links a payment without an account automatically.
+	AccountID *string `json:"account_id"`
 }
 
 func (s *PaymentService) Update(ownerUserID string, id string, input UpdatePaymentInput) error {
@@ -570,7 +730,7 @@ func (s *PaymentService) Update(ownerUserID string, id string, input UpdatePayme
 
 	// On confirm, enforce dedup rules:
 	// - hash duplicate: hard block (no override)
-	// - amount+time duplicate: allow only with force_duplicate_save
+	// - amount+time or near-identical screenshot: allow only with force_duplicate_save
 	if confirming && before != nil {
 		force := input.ForceDuplicateSave != nil && *input.ForceDuplicateSave
 
@@ -596,6 +756,10 @@ func (s *PaymentService) Update(ownerUserID string, id string, input UpdatePayme
 		if input.Amount != nil {
 			nextAmount = *input.Amount
 		}
+		nextCurrency := before.Currency
+		if input.Currency != nil {
+			nextCurrency = *input.Currency
+		}
 		nextTs := before.TransactionTimeTs
 		if input.TransactionTime != nil {
 			if t, err := parseRFC3339ToUTC(*input.TransactionTime); err == nil {
@@ -603,14 +767,14 @@ func (s *PaymentService) Update(ownerUserID string, id string, input UpdatePayme
 			}
 		}
 
-		cands, err := s.FindCandidatesByAmountTimeForOwner(strings.TrimSpace(ownerUserID), nextAmount, nextTs, id, 5*time.Minute, 5)
+		reason, cands, err := s.FindSuspectedDuplicatesForOwner(strings.TrimSpace(ownerUserID), nextAmount, nextCurrency, nextTs, before.PerceptualHash, id)
 		if err != nil {
 			return err
 		}
 		if len(cands) > 0 && !force {
 			return &DuplicateError{
 				Kind:       "suspected_duplicate",
-				Reason:     "amount_time",
+				Reason:     reason,
 				Entity:     "payment",
 				Candidates: cands,
 			}
@@ -622,6 +786,13 @@ func (s *PaymentService) Update(ownerUserID string, id string, input UpdatePayme
 	if input.Amount != nil {
 		data["amount"] = *input.Amount
 	}
+	if input.Currency != nil {
+		currency, err := money.NormalizeCurrency(*input.Currency)
+		if err != nil {
+			return err
+		}
+		data["currency"] = currency
+	}
 	if input.Merchant != nil {
 		data["merchant"] = *input.Merchant
 	}
@@ -631,6 +802,32 @@ func (s *PaymentService) Update(ownerUserID string, id string, input UpdatePayme
 	if input.PaymentMethod != nil {
 		data["payment_method"] = *input.PaymentMethod
 	}
+	if input.AccountID != nil {
+		if accountID := strings.TrimSpace(*input.AccountID); accountID == "" {
+			data["account_id"] = nil
+		} else if account, err := findPaymentAccountForOwner(s.db, ownerUserID, accountID); err != nil {
+			return err
+		} else {
+			data["account_id"] = account.ID
+		}
+	} else if input.PaymentMethod != nil {
+		current := before
+		if current == nil {
+			var err error
+			if current, err = s.repo.FindByIDForOwner(strings.TrimSpace(ownerUserID), id); err != nil {
+				return err
+			}
+		}
+		if current.AccountID == nil {
+			accountID, err := accountIDForMethod(s.db, ownerUserID, input.PaymentMethod)
+			if err != nil {
+				return err
+			}
+			if accountID != nil {
+				data["account_id"] = *accountID
+			}
+		}
+	}
 	if input.Description != nil {
 		data["description"] = *input.Description
 	}
@@ -704,6 +901,10 @@ func (s *PaymentService) Update(ownerUserID string, id string, input UpdatePayme
 		if input.Amount != nil {
 			nextAmount = *input.Amount
 		}
+		nextCurrency := before.Currency
+		if input.Currency != nil {
+			nextCurrency = *input.Currency
+		}
 		nextTs := before.TransactionTimeTs
 		if input.TransactionTime != nil {
 			if t, err := parseRFC3339ToUTC(*input.TransactionTime); err == nil {
@@ -711,7 +912,7 @@ func (s *PaymentService) Update(ownerUserID string, id string, input UpdatePayme
 			}
 		}
 
-		cands, err := s.FindCandidatesByAmountTimeForOwner(strings.TrimSpace(ownerUserID), nextAmount, nextTs, id, 5*time.Minute, 5)
+		_, cands, err := s.FindSuspectedDuplicatesForOwner(strings.TrimSpace(ownerUserID), nextAmount, nextCurrency, nextTs, before.PerceptualHash, id)
 		if err == nil && len(cands) > 0 {
 			if force {
 				data["dedup_status"] = DedupStatusForced
@@ -727,13 +928,64 @@ func (s *PaymentService) Update(ownerUserID string, id string, input UpdatePayme
 		}
 	}
 
-	if len(data) == 0 {
+	if len(data) == 0 && input.RefundOfID == nil {
 		return nil
 	}
 
 	// No file move/rename on confirm. The draft flag alone controls visibility/lifecycle.
 
-	if err := s.repo.UpdateForOwner(strings.TrimSpace(ownerUserID), id, data); err != nil {
+	if input.Amount != nil {
+		hasSplits, err := paymentHasSplits(s.db, ownerUserID, id)
+		if err != nil {
+			return err
+		}
+		if hasSplits {
+			cents, err := money.FromMajor(*input.Amount)
+			if err != nil {
+				return err
+			}
+			current := before
+			if current == nil {
+				if current, err = s.repo.FindByIDForOwner(strings.TrimSpace(ownerUserID), id); err != nil {
+					return err
+				}
+			}
+			if cents != current.AmountCents {
+				return fmt.Errorf("%w: remove the splits before changing the amount", ErrInvalidPaymentSplit)
+			}
+		}
+	}
+
+	// The refund link is checked against the updated row, and a rejected link rolls the update back.
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if len(data) > 0 {
+			if err := s.repo.WithDB(tx).UpdateForOwner(strings.TrimSpace(ownerUserID), id, data); err != nil {
+				return err
+			}
+			if _, ok := data["trip_id"]; ok {
+				if err := syncAutoSplitTripsTx(tx, ownerUserID, []string{id}); err != nil {
+					return err
+				}
+			}
+		}
+		if input.RefundOfID != nil {
+			var err error
+			if strings.TrimSpace(*input.RefundOfID) == "" {
+				err = s.unlinkRefundTx(tx, ownerUserID, id)
+			} else {
+				err = s.linkRefundTx(tx, ownerUserID, id, *input.RefundOfID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		_, amountChanged := data["amount"]
+		_, currencyChanged := data["currency"]
+		if !amountChanged && !currencyChanged {
+			return nil
+		}
+		return s.revalidateRefundLinksTx(tx, ownerUserID, id)
+	}); err != nil {
 		return err
 	}
 
@@ -756,6 +1008,9 @@ func (s *PaymentService) Update(ownerUserID string, id string, input UpdatePayme
 		}
 		after = refreshed
 	}
+	if after != nil && !after.IsDraft {
+		s.checkBudgetAlerts(ownerUserID, id)
+	}
 
 	if !needsRecalc && !(timeChanged || confirming) {
 		return nil
@@ -784,20 +1039,12 @@ func (s *PaymentService) Delete(ownerUserID string, id string) error {
 
 	db := s.db
 	if err := db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("payment_id = ?", id).Delete(&models.InvoicePaymentLink{}).Error; err != nil {
-			return err
-		}
-		if err := s.blobRepo.DeletePaymentBlob(tx, strings.TrimSpace(ownerUserID), id); err != nil {
-			return err
-		}
-		return s.repo.WithDB(tx).DeleteForOwner(strings.TrimSpace(ownerUserID), id)
+		return s.deletePaymentTx(tx, ownerUserID, id)
 	}); err != nil {
 		return err
 	}
-	if payment.ScreenshotPath != nil && strings.TrimSpace(*payment.ScreenshotPath) != "" {
-		if _, err := removeStoredFile(s.uploadsDir, *payment.ScreenshotPath); err != nil {
-			log.Printf("[FileCleanup] 删除支付截图失败 payment_id=%s err=%v", id, err)
-		}
+	if payment.ScreenshotPath != nil {
+		removeUnreferencedFile(s.db, s.uploadsDir, *payment.ScreenshotPath)
 	}
 
 	if tripID == "" {
@@ -806,6 +1053,34 @@ func (s *PaymentService) Delete(ownerUserID string, id string) error {
 	return recalcTripBadDebtLocked(s.db, tripID)
 }
 
+// deletePaymentTx removes a payment together with its links, splits, tags and OCR blob.
+// Stored files and trip locks are left to the caller.
+func (s *PaymentService) deletePaymentTx(tx *gorm.DB, ownerUserID string, id string) error {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	if err := tx.Where("payment_id = ?", id).Delete(&models.InvoicePaymentLink{}).Error; err != nil {
+		return err
+	}
+	if err := s.rideRepo.ClearPayments(tx, []string{id}); err != nil {
+		return err
+	}
+	// Refunds of a deleted payment become ordinary payments again.
+	if err := tx.Model(&models.Payment{}).
+		Where("owner_user_id = ? AND refund_of_id = ?", ownerUserID, id).
+		Updates(map[string]interface{}{"refund_of_id": nil, "refund_kind": ""}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("owner_user_id = ? AND payment_id = ?", ownerUserID, id).Delete(&models.PaymentSplit{}).Error; err != nil {
+		return err
+	}
+	if err := paymentTagLink.deleteFor(tx, []string{id}); err != nil {
+		return err
+	}
+	if err := s.blobRepo.DeletePaymentBlob(tx, ownerUserID, id); err != nil {
+		return err
+	}
+	return s.repo.WithDB(tx).DeleteForOwner(ownerUserID, id)
+}
+
 func (s *PaymentService) GetStats(ownerUserID string, startDate, endDate string) (*models.PaymentStats, error) {
 	return s.GetStatsCtx(context.Background(), ownerUserID, startDate, endDate)
 }
@@ -827,7 +1102,16 @@ func (s *PaymentService) GetStatsCtx(ctx context.Context, ownerUserID string, st
 			return nil, fmt.Errorf("invalid endDate: %w", err)
 		}
 	}
-	return s.repo.GetStatsByTsCtx(ctx, strings.TrimSpace(ownerUserID), startTs, endTs)
+	conv, err := newCurrencyConverter(ctx, s.db, ownerUserID)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.repo.GetConvertedStatsByTsCtx(ctx, strings.TrimSpace(ownerUserID), startTs, endTs, conv.toBase)
+	if err != nil {
+		return nil, err
+	}
+	stats.BaseCurrency = conv.base
+	return stats, nil
 }
 
 // CreateFromScreenshot creates a payment from a screenshot with OCR
@@ -876,6 +1160,10 @@ func (s *PaymentService) CreateFromScreenshot(ownerUserID string, input CreateFr
 		utcTimeStr = now.Format(time.RFC3339)
 	}
 
+	if err := s.proposeRefundOriginal(s.db, ownerUserID, "", extracted); err != nil {
+		return nil, nil, err
+	}
+
 	// Store extracted data as JSON
 	extractedDataJSON, err := ExtractedDataToJSON(extracted)
 	if err != nil {
@@ -895,6 +1183,7 @@ func (s *PaymentService) CreateFromScreenshot(ownerUserID string, input CreateFr
 		TransactionTimeTs: unixMilli(payTime),
 		ScreenshotPath:    &input.ScreenshotPath,
 		FileSHA256:        input.FileSHA256,
+		PerceptualHash:    computeStoredFilePerceptualHash(s.uploadsDir, input.ScreenshotPath),
 		ExtractedData:     nil, // stored in payment_ocr_blobs
 		TripAssignSrc:     assignSrcAuto,
 		TripAssignState:   assignStateNoMatch,
@@ -914,6 +1203,12 @@ func (s *PaymentService) CreateFromScreenshot(ownerUserID string, input CreateFr
 	// Set transaction time if extracted
 	db := s.db
 	if err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := applyCategoryRules(tx, payment.OwnerUserID, payment, extracted.Platform); err != nil {
+			return err
+		}
+		if err := applyPaymentAccount(tx, payment.OwnerUserID, payment); err != nil {
+			return err
+		}
 		if err := tx.Create(payment).Error; err != nil {
 			return err
 		}
@@ -923,23 +1218,21 @@ func (s *PaymentService) CreateFromScreenshot(ownerUserID string, input CreateFr
 	}
 	payment.ExtractedData = extractedDataJSON
 
-	// Mark suspected duplicates for UI (amount+time) if we have a meaningful timestamp.
-	if payment.Amount > 0 && payment.TransactionTimeTs > 0 {
-		cands, err := s.FindCandidatesByAmountTimeForOwner(strings.TrimSpace(payment.OwnerUserID), payment.Amount, payment.TransactionTimeTs, payment.ID, 5*time.Minute, 5)
-		if err != nil {
+	// Mark suspected duplicates for UI (amount+time, then a near-identical screenshot).
+	_, cands, err := s.FindSuspectedDuplicatesForOwner(strings.TrimSpace(payment.OwnerUserID), payment.Amount, payment.Currency, payment.TransactionTimeTs, payment.PerceptualHash, payment.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(cands) > 0 {
+		payment.DedupStatus = DedupStatusSuspected
+		ref := cands[0].ID
+		payment.DedupRefID = &ref
+		if err := db.Model(&models.Payment{}).Where("id = ?", payment.ID).Updates(map[string]interface{}{
+			"dedup_status": DedupStatusSuspected,
+			"dedup_ref_id": ref,
+		}).Error; err != nil {
 			return nil, nil, err
 		}
-		if len(cands) > 0 {
-			payment.DedupStatus = DedupStatusSuspected
-			ref := cands[0].ID
-			payment.DedupRefID = &ref
-			if err := db.Model(&models.Payment{}).Where("id = ?", payment.ID).Updates(map[string]interface{}{
-				"dedup_status": DedupStatusSuspected,
-				"dedup_ref_id": ref,
-			}).Error; err != nil {
-				return nil, nil, err
-			}
-		}
 	}
 
 	if warn != nil {
@@ -965,13 +1258,13 @@ type scoredInvoiceCandidate struct {
 	mScore  float64
 }
 
-func scoreInvoiceCandidates(payment *models.Payment, candidates []models.Invoice, linkedIDs map[string]struct{}) []scoredInvoiceCandidate {
+func scoreInvoiceCandidates(payment *models.Payment, candidates []models.Invoice, linkedIDs map[string]struct{}, conv *currencyConverter) []scoredInvoiceCandidate {
 	scoredAll := make([]scoredInvoiceCandidate, 0, len(candidates))
 	for _, inv := range candidates {
 		if _, ok := linkedIDs[inv.ID]; ok {
 			continue
 		}
-		score, aScore, dScore, mScore := computeInvoicePaymentScoreBreakdown(&inv, payment)
+		score, aScore, dScore, mScore := computeInvoicePaymentScoreBreakdown(&inv, payment, conv)
 		scoredAll = append(scoredAll, scoredInvoiceCandidate{invoice: inv, score: score, aScore: aScore, dScore: dScore, mScore: mScore})
 	}
 
@@ -1067,7 +1360,11 @@ func (s *PaymentService) SuggestInvoicesCtx(ctx context.Context, ownerUserID str
 		log.Printf("[MATCH] payment=%s linked=%d candidates=%d", paymentID, len(linkedIDs), len(candidates))
 	}
 
-	scoredAll := scoreInvoiceCandidates(payment, candidates, linkedIDs)
+	conv, err := newCurrencyConverter(ctx, s.db, ownerUserID)
+	if err != nil {
+		return nil, err
+	}
+	scoredAll := scoreInvoiceCandidates(payment, candidates, linkedIDs, conv)
 	out := pickSuggestedInvoices(payment, scoredAll, limit)
 
 	if debug {
@@ -1120,6 +1417,9 @@ func (s *PaymentService) ReparseScreenshot(paymentID string) (*PaymentExtractedD
 	if err != nil {
 		return nil, fmt.Errorf("OCR parsing failed: %w", err)
 	}
+	if err := s.proposeRefundOriginal(s.db, payment.OwnerUserID, paymentID, extracted); err != nil {
+		return nil, err
+	}
 
 	// Store extracted data as JSON
 	extractedDataJSON, err := ExtractedDataToJSON(extracted)
@@ -1162,6 +1462,13 @@ func (s *PaymentService) ReparseScreenshot(paymentID string) (*PaymentExtractedD
 
 	// 主表字段和 OCR Blob 必须同时提交或同时回滚。
 	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if payment.AccountID == nil && extracted.PaymentMethod != nil {
+			if accountID, err := accountIDForMethod(tx, payment.OwnerUserID, extracted.PaymentMethod); err != nil {
+				return err
+			} else if accountID != nil {
+				updateData["account_id"] = *accountID
+			}
+		}
 		if err := s.repo.WithDB(tx).Update(paymentID, updateData); err != nil {
 			return err
 		}
@@ -0,0 +1,484 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/money"
+	"smart-bill-manager/internal/repository"
+	"smart-bill-manager/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	PaymentAccountCreditCard  = "credit_card"
+	PaymentAccountDebitCard   = "debit_card"
+	PaymentAccountWallet      = "wallet"
+	PaymentAccountBankAccount = "bank_account"
+	PaymentAccountCash        = "cash"
+	PaymentAccountOther       = "other"
+)
+
+var (
+	ErrPaymentAccountNotFound = errors.New("payment account not found")
+	ErrPaymentAccountExists   = errors.New("payment account already exists")
+)
+
+type PaymentAccountService struct {
+	db *gorm.DB
+}
+
+func NewPaymentAccountService(db *gorm.DB) *PaymentAccountService {
+	return &PaymentAccountService{db: db}
+}
+
+type PaymentAccountInput struct {
+	Name     string   `json:"name" binding:"required"`
+	Type     string   `json:"type"`
+	Issuer   string   `json:"issuer"`
+	LastFour string   `json:"last_four"`
+	Currency string   `json:"currency"`
+	Aliases  []string `json:"aliases"`
+}
+
+var lastFourRe = regexp.MustCompile(`^\d{4}$`)
+
+// applyTo validates the input and copies it onto account, filling defaults.
+func (input PaymentAccountInput) applyTo(account *models.PaymentAccount) error {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	accountType := strings.ToLower(strings.TrimSpace(input.Type))
+	if accountType == "" {
+		accountType = PaymentAccountOther
+	}
+	switch accountType {
+	case PaymentAccountCreditCard, PaymentAccountDebitCard, PaymentAccountWallet,
+		PaymentAccountBankAccount, PaymentAccountCash, PaymentAccountOther:
+	default:
+		return fmt.Errorf("invalid type")
+	}
+	lastFour := strings.TrimSpace(input.LastFour)
+	if lastFour != "" && !lastFourRe.MatchString(lastFour) {
+		return fmt.Errorf("last_four must be 4 digits")
+	}
+	currency := money.DefaultCurrency
+	if strings.TrimSpace(input.Currency) != "" {
+		var err error
+		if currency, err = money.NormalizeCurrency(input.Currency); err != nil {
+			return err
+		}
+	}
+	aliases := make([]string, 0, len(input.Aliases))
+	for _, alias := range input.Aliases {
+		if alias = sanitizePaymentMethod(strings.ReplaceAll(alias, "\n", " ")); alias != "" {
+			aliases = append(aliases, alias)
+		}
+	}
+
+	account.Name = name
+	account.Type = accountType
+	account.Issuer = strings.TrimSpace(input.Issuer)
+	account.LastFour = lastFour
+	account.Currency = currency
+	account.AliasesRaw = strings.Join(aliases, "\n")
+	return account.AfterFind(nil)
+}
+
+func (s *PaymentAccountService) List(ownerUserID string) ([]models.PaymentAccount, error) {
+	var out []models.PaymentAccount
+	err := s.db.Where("owner_user_id = ?", strings.TrimSpace(ownerUserID)).
+		Order("name ASC").
+		Find(&out).Error
+	return out, err
+}
+
+func (s *PaymentAccountService) GetByID(ownerUserID string, id string) (*models.PaymentAccount, error) {
+	return findPaymentAccountForOwner(s.db, ownerUserID, id)
+}
+
+// Create adds the account and links unassigned payments whose method maps to it.
+func (s *PaymentAccountService) Create(ownerUserID string, input PaymentAccountInput) (*models.PaymentAccount, error) {
+	account := &models.PaymentAccount{
+		ID:          utils.GenerateUUID(),
+		OwnerUserID: strings.TrimSpace(ownerUserID),
+	}
+	if err := input.applyTo(account); err != nil {
+		return nil, err
+	}
+	if err := s.ensureUniqueName(account); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(account).Error; err != nil {
+		return nil, err
+	}
+	if err := linkUnassignedPayments(s.db, account.OwnerUserID); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// Update saves the account and links unassigned payments that now map to it. Payments already
+// linked keep their account.
+func (s *PaymentAccountService) Update(ownerUserID string, id string, input PaymentAccountInput) (*models.PaymentAccount, error) {
+	account, err := findPaymentAccountForOwner(s.db, ownerUserID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := input.applyTo(account); err != nil {
+		return nil, err
+	}
+	if err := s.ensureUniqueName(account); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(account).Error; err != nil {
+		return nil, err
+	}
+	if err := linkUnassignedPayments(s.db, account.OwnerUserID); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// Delete removes the account; its payments are kept and become unassigned.
+func (s *PaymentAccountService) Delete(ownerUserID string, id string) error {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	id = strings.TrimSpace(id)
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND owner_user_id = ?", id, ownerUserID).Delete(&models.PaymentAccount{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrPaymentAccountNotFound
+		}
+		return tx.Model(&models.Payment{}).
+			Where("owner_user_id = ? AND account_id = ?", ownerUserID, id).
+			Update("account_id", nil).Error
+	})
+}
+
+func (s *PaymentAccountService) ensureUniqueName(account *models.PaymentAccount) error {
+	var clash int64
+	if err := s.db.Model(&models.PaymentAccount{}).
+		Where("owner_user_id = ? AND name = ? AND id <> ?", account.OwnerUserID, account.Name, account.ID).
+		Count(&clash).Error; err != nil {
+		return err
+	}
+	if clash > 0 {
+		return ErrPaymentAccountExists
+	}
+	return nil
+}
+
+func findPaymentAccountForOwner(db *gorm.DB, ownerUserID string, id string) (*models.PaymentAccount, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, ErrPaymentAccountNotFound
+	}
+	var account models.PaymentAccount
+	if err := db.Where("id = ? AND owner_user_id = ?", id, strings.TrimSpace(ownerUserID)).First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPaymentAccountNotFound
+		}
+		return nil, err
+	}
+	return &account, nil
+}
+
+// paymentMethodInfo is what a payment method text says about the account it was paid from.
+type paymentMethodInfo struct {
+	normalized string
+	issuer     string
+	lastFour   string
+	kind       string
+}
+
+var (
+	paymentMethodLastFourRe = regexp.MustCompile(`(?:\(|尾号|\*+|\s)\s*(\d{4})(?:\D|$)`)
+	paymentMethodBankRe     = regexp.MustCompile(`^(\p{Han}{2,10}?银行)`)
+)
+
+// parsePaymentMethod normalizes a payment method the way OCR produces it (see
+// inferPaymentMethodFromText), e.g. "招商银行信用卡（1234）>" or "微信零钱通".
+func parsePaymentMethod(method string) paymentMethodInfo {
+	info := paymentMethodInfo{normalized: sanitizePaymentMethod(method)}
+	text := info.normalized
+	if text == "" {
+		return info
+	}
+	if m := paymentMethodLastFourRe.FindAllStringSubmatch(text, -1); len(m) > 0 {
+		info.lastFour = m[len(m)-1][1]
+	}
+
+	switch {
+	case strings.Contains(text, "信用卡"):
+		info.kind = PaymentAccountCreditCard
+	case strings.Contains(text, "储蓄卡"), strings.Contains(text, "借记卡"):
+		info.kind = PaymentAccountDebitCard
+	case strings.Contains(text, "零钱"), strings.Contains(text, "余额"), strings.Contains(text, "花呗"):
+		info.kind = PaymentAccountWallet
+	case strings.Contains(text, "现金"):
+		info.kind = PaymentAccountCash
+	}
+
+	switch {
+	case paymentMethodBankRe.MatchString(text):
+		info.issuer = paymentMethodBankRe.FindStringSubmatch(text)[1]
+	case strings.Contains(text, "微信"), strings.Contains(text, "零钱"):
+		info.issuer = "微信"
+	case strings.Contains(text, "支付宝"), strings.Contains(text, "余额宝"), strings.Contains(text, "花呗"):
+		info.issuer = "支付宝"
+	case strings.Contains(text, "云闪付"):
+		info.issuer = "云闪付"
+	}
+	return info
+}
+
+func issuersMatch(a, b string) bool {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	return a != "" && b != "" && (strings.Contains(a, b) || strings.Contains(b, a))
+}
+
+// matchPaymentAccount picks the account a payment method belongs to: an alias contained in the
+// method wins, then the last four digits (narrowed by issuer), then issuer and type for methods
+// without digits. Ambiguous methods are left unassigned.
+func matchPaymentAccount(accounts []models.PaymentAccount, method string) *models.PaymentAccount {
+	info := parsePaymentMethod(method)
+	if info.normalized == "" {
+		return nil
+	}
+	unique := func(keep func(models.PaymentAccount) bool) *models.PaymentAccount {
+		var found *models.PaymentAccount
+		for i := range accounts {
+			if !keep(accounts[i]) {
+				continue
+			}
+			if found != nil {
+				return nil
+			}
+			found = &accounts[i]
+		}
+		return found
+	}
+
+	lower := strings.ToLower(info.normalized)
+	if account := unique(func(a models.PaymentAccount) bool {
+		for _, alias := range a.Aliases {
+			if strings.Contains(lower, strings.ToLower(alias)) {
+				return true
+			}
+		}
+		return false
+	}); account != nil {
+		return account
+	}
+
+	if info.lastFour != "" {
+		if account := unique(func(a models.PaymentAccount) bool { return a.LastFour == info.lastFour }); account != nil {
+			return account
+		}
+		return unique(func(a models.PaymentAccount) bool {
+			return a.LastFour == info.lastFour && issuersMatch(a.Issuer, info.issuer)
+		})
+	}
+	if info.issuer == "" {
+		return nil
+	}
+	return unique(func(a models.PaymentAccount) bool {
+		if !issuersMatch(a.Issuer, info.issuer) {
+			return false
+		}
+		return info.kind == "" || a.Type == info.kind || a.Type == PaymentAccountOther
+	})
+}
+
+func loadPaymentAccounts(db *gorm.DB, ownerUserID string) ([]models.PaymentAccount, error) {
+	var accounts []models.PaymentAccount
+	err := db.Where("owner_user_id = ?", strings.TrimSpace(ownerUserID)).Find(&accounts).Error
+	return accounts, err
+}
+
+// accountIDForMethod returns the id of the owner's account matching method, or nil.
+func accountIDForMethod(db *gorm.DB, ownerUserID string, method *string) (*string, error) {
+	if method == nil || strings.TrimSpace(*method) == "" {
+		return nil, nil
+	}
+	accounts, err := loadPaymentAccounts(db, ownerUserID)
+	if err != nil || len(accounts) == 0 {
+		return nil, err
+	}
+	if account := matchPaymentAccount(accounts, *method); account != nil {
+		id := account.ID
+		return &id, nil
+	}
+	return nil, nil
+}
+
+// applyPaymentAccount links a payment that has no account yet to the one its method maps to.
+func applyPaymentAccount(db *gorm.DB, ownerUserID string, payment *models.Payment) error {
+	if payment.AccountID != nil {
+		return nil
+	}
+	id, err := accountIDForMethod(db, ownerUserID, payment.PaymentMethod)
+	if err != nil {
+		return err
+	}
+	payment.AccountID = id
+	return nil
+}
+
+// linkUnassignedPayments maps the owner's payments without an account through the current accounts.
+func linkUnassignedPayments(db *gorm.DB, ownerUserID string) error {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	accounts, err := loadPaymentAccounts(db, ownerUserID)
+	if err != nil || len(accounts) == 0 {
+		return err
+	}
+	var rows []struct {
+		ID            string  `gorm:"column:id"`
+		PaymentMethod *string `gorm:"column:payment_method"`
+	}
+	if err := db.Model(&models.Payment{}).
+		Select("id, payment_method").
+		Where("owner_user_id = ? AND account_id IS NULL AND payment_method IS NOT NULL AND TRIM(payment_method) <> ''", ownerUserID).
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+	byAccount := map[string][]string{}
+	for _, row := range rows {
+		if account := matchPaymentAccount(accounts, *row.PaymentMethod); account != nil {
+			byAccount[account.ID] = append(byAccount[account.ID], row.ID)
+		}
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for accountID, ids := range byAccount {
+			if err := tx.Model(&models.Payment{}).
+				Where("owner_user_id = ? AND id IN ? AND account_id IS NULL", ownerUserID, ids).
+				Update("account_id", accountID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PaymentAccountStatement summarizes one account over a period. Totals are in the account's
+// currency; payments in other currencies are listed but summed separately per currency.
+type PaymentAccountStatement struct {
+	Account         models.PaymentAccount `json:"account"`
+	StartDate       string                `json:"start_date,omitempty"`
+	EndDate         string                `json:"end_date,omitempty"`
+	Spent           float64               `json:"spent"`
+	Refunded        float64               `json:"refunded"`
+	Net             float64               `json:"net"`
+	Count           int                   `json:"count"`
+	CategoryStats   map[string]float64    `json:"category_stats"`
+	OtherCurrencies map[string]float64    `json:"other_currencies"`
+	Payments        []models.Payment      `json:"payments"`
+}
+
+// Statement lists the account's confirmed payments between startDate and endDate (RFC3339, either
+// may be empty) oldest first, with refunds netted against the period of their original payment.
+func (s *PaymentAccountService) Statement(ctx context.Context, ownerUserID string, id string, startDate, endDate string) (*PaymentAccountStatement, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	account, err := findPaymentAccountForOwner(s.db.WithContext(ctx), ownerUserID, id)
+	if err != nil {
+		return nil, err
+	}
+	var startTs, endTs int64
+	if strings.TrimSpace(startDate) != "" {
+		t, err := parseRFC3339ToUTC(startDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid startDate: %w", err)
+		}
+		startTs = unixMilli(t)
+	}
+	if strings.TrimSpace(endDate) != "" {
+		t, err := parseRFC3339ToUTC(endDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endDate: %w", err)
+		}
+		endTs = unixMilli(t)
+	}
+	inRange := func(q *gorm.DB) *gorm.DB {
+		q = q.Where("owner_user_id = ? AND account_id = ? AND is_draft = 0", ownerUserID, account.ID)
+		if startTs > 0 {
+			q = q.Where("transaction_time_ts >= ?", startTs)
+		}
+		if endTs > 0 {
+			q = q.Where("transaction_time_ts <= ?", endTs)
+		}
+		return q
+	}
+
+	var rows []struct {
+		Currency   string `gorm:"column:currency"`
+		Category   string `gorm:"column:category"`
+		IsRefund   bool   `gorm:"column:is_refund"`
+		TotalCents int64  `gorm:"column:total_cents"`
+	}
+	if err := inRange(s.db.WithContext(ctx).Table(repository.NetPaymentsTable)).
+		Select(`currency,
+			CASE WHEN category IS NULL OR TRIM(category) = '' THEN '未分类' ELSE category END AS category,
+			is_refund,
+			COALESCE(SUM(amount_cents), 0) AS total_cents`).
+		Group("currency, category, is_refund").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	out := &PaymentAccountStatement{
+		Account:         *account,
+		StartDate:       startDate,
+		EndDate:         endDate,
+		CategoryStats:   map[string]float64{},
+		OtherCurrencies: map[string]float64{},
+		Payments:        []models.Payment{},
+	}
+	var spent, refunded int64
+	categories := map[string]int64{}
+	others := map[string]int64{}
+	for _, row := range rows {
+		if row.Currency != account.Currency {
+			others[row.Currency] += row.TotalCents
+			continue
+		}
+		if row.IsRefund {
+			refunded -= row.TotalCents
+		} else {
+			spent += row.TotalCents
+		}
+		categories[row.Category] += row.TotalCents
+	}
+	for key, cents := range categories {
+		out.CategoryStats[key] = money.ToMajor(cents)
+	}
+	for key, cents := range others {
+		out.OtherCurrencies[key] = money.ToMajor(cents)
+	}
+	out.Spent = money.ToMajor(spent)
+	out.Refunded = money.ToMajor(refunded)
+	out.Net = money.ToMajor(spent - refunded)
+
+	// The list takes the same rows as the totals: refunds by their original's time and account.
+	listed := inRange(s.db.WithContext(ctx).Table(repository.NetPaymentsTable)).Select("id")
+	if err := s.db.WithContext(ctx).Model(&models.Payment{}).
+		Where("owner_user_id = ? AND id IN (?)", ownerUserID, listed).
+		Order("transaction_time_ts ASC, id ASC").
+		Find(&out.Payments).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range out.Payments {
+		if p.RefundOfID == nil {
+			out.Count++
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,110 @@
+//go:build cgo
+
+package services
+
+import (
+	"context"
+	"testing"
+
+	"smart-bill-manager/internal/repository"
+)
+
+func TestPaymentAccountsMapMethodsAndReportStatements(t *testing.T) {
+	db := openServiceTestDB(t)
+	payments := NewPaymentService(db, t.TempDir())
+	accounts := NewPaymentAccountService(db)
+	ctx := context.Background()
+
+	// A payment recorded before the account exists is linked once the account is added.
+	cmbMethod := "招商银行信用卡（1234）>"
+	early, err := payments.Create("owner-1", CreatePaymentInput{Amount: 88, PaymentMethod: &cmbMethod, TransactionTime: "2025-11-02T02:00:00Z"})
+	if err != nil {
+		t.Fatalf("创建支付失败: %v", err)
+	}
+	if early.AccountID != nil {
+		t.Fatalf("没有账户时不应关联: %#v", early.AccountID)
+	}
+
+	cmb, err := accounts.Create("owner-1", PaymentAccountInput{Name: "招行信用卡", Type: PaymentAccountCreditCard, Issuer: "招商银行", LastFour: "1234"})
+	if err != nil {
+		t.Fatalf("创建账户失败: %v", err)
+	}
+	wechat, err := accounts.Create("owner-1", PaymentAccountInput{Name: "微信零钱", Type: PaymentAccountWallet, Issuer: "微信"})
+	if err != nil {
+		t.Fatalf("创建账户失败: %v", err)
+	}
+	if _, err := accounts.Create("owner-1", PaymentAccountInput{Name: "招行信用卡"}); err != ErrPaymentAccountExists {
+		t.Fatalf("重名账户应被拒绝: %v", err)
+	}
+	if _, err := accounts.Create("owner-1", PaymentAccountInput{Name: "坏卡号", LastFour: "12a4"}); err == nil {
+		t.Fatalf("非法尾号应被拒绝")
+	}
+	if got, _ := payments.GetByID("owner-1", early.ID); got.AccountID == nil || *got.AccountID != cmb.ID {
+		t.Fatalf("新建账户后历史支付应被关联: %#v", got.AccountID)
+	}
+
+	walletMethod := "零钱通"
+	lunch, err := payments.Create("owner-1", CreatePaymentInput{Amount: 30, PaymentMethod: &walletMethod, TransactionTime: "2025-11-03T04:00:00Z"})
+	if err != nil || lunch.AccountID == nil || *lunch.AccountID != wechat.ID {
+		t.Fatalf("零钱通应映射到微信零钱: %#v %v", lunch, err)
+	}
+	unknown := "建设银行储蓄卡(9999)"
+	other, err := payments.Create("owner-1", CreatePaymentInput{Amount: 12, PaymentMethod: &unknown, TransactionTime: "2025-11-04T04:00:00Z"})
+	if err != nil || other.AccountID != nil {
+		t.Fatalf("无法匹配的支付方式不应关联账户: %#v %v", other, err)
+	}
+	refund, err := payments.Create("owner-1", CreatePaymentInput{Amount: 20, PaymentMethod: &cmbMethod, TransactionTime: "2025-11-05T04:00:00Z"})
+	if err != nil {
+		t.Fatalf("创建退款失败: %v", err)
+	}
+	if _, err := payments.LinkRefund("owner-1", refund.ID, early.ID); err != nil {
+		t.Fatalf("关联退款失败: %v", err)
+	}
+
+	items, total, err := payments.ListWithInvoiceCounts("owner-1", PaymentFilterInput{AccountID: cmb.ID})
+	if err != nil || total != 2 || len(items) != 2 {
+		t.Fatalf("按账户筛选应返回招行的两笔记录: %d %v", total, err)
+	}
+	if _, total, _ = payments.ListWithInvoiceCounts("owner-1", PaymentFilterInput{AccountID: "none"}); total != 1 {
+		t.Fatalf("未关联账户的筛选应只返回一笔: %d", total)
+	}
+
+	stats, err := payments.GetStatsCtx(ctx, "owner-1", "", "")
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+	if stats.AccountStats[cmb.ID] != 68 || stats.AccountStats[wechat.ID] != 30 || stats.AccountStats[repository.PaymentAccountNone] != 12 {
+		t.Fatalf("账户统计异常: %#v", stats.AccountStats)
+	}
+
+	statement, err := accounts.Statement(ctx, "owner-1", cmb.ID, "2025-11-01T00:00:00+08:00", "2025-11-30T23:59:59+08:00")
+	if err != nil {
+		t.Fatalf("获取账户流水失败: %v", err)
+	}
+	if statement.Spent != 88 || statement.Refunded != 20 || statement.Net != 68 || statement.Count != 1 || len(statement.Payments) != 2 {
+		t.Fatalf("账户流水异常: %#v", statement)
+	}
+	// The refund is booked in the period of its original payment, in the totals and the list alike.
+	statement, err = accounts.Statement(ctx, "owner-1", cmb.ID, "2025-11-01T00:00:00+08:00", "2025-11-04T23:59:59+08:00")
+	if err != nil {
+		t.Fatalf("获取账户流水失败: %v", err)
+	}
+	if statement.Net != 68 || len(statement.Payments) != 2 {
+		t.Fatalf("退款应随原支付计入同一期间: %#v", statement)
+	}
+
+	// Manual assignment overrides the mapping; deleting the account unlinks its payments.
+	empty := ""
+	if err := payments.Update("owner-1", lunch.ID, UpdatePaymentInput{AccountID: &cmb.ID}); err != nil {
+		t.Fatalf("手动关联账户失败: %v", err)
+	}
+	if err := payments.Update("owner-1", other.ID, UpdatePaymentInput{AccountID: &empty}); err != nil {
+		t.Fatalf("取消关联失败: %v", err)
+	}
+	if err := accounts.Delete("owner-1", cmb.ID); err != nil {
+		t.Fatalf("删除账户失败: %v", err)
+	}
+	if got, _ := payments.GetByID("owner-1", lunch.ID); got.AccountID != nil {
+		t.Fatalf("删除账户后支付应取消关联: %#v", got.AccountID)
+	}
+}
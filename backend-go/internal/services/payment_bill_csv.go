@@ -0,0 +1,202 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+const (
+	BillCSVSourceAlipay = "alipay_csv"
+	BillCSVSourceWeChat = "wechat_csv"
+)
+
+var ErrUnsupportedBillCSV = errors.New("unsupported bill csv format")
+
+// billCSVRow is one transaction line from an Alipay/WeChat Pay bill export, before validation.
+type billCSVRow struct {
+	Line          int
+	Time          string
+	Merchant      string
+	Description   string
+	Amount        string
+	Direction     string
+	PaymentMethod string
+	Status        string
+	OrderNumber   string
+	MerchantOrder string
+	// HasDirection is set when the export has a 收/支 column, so an empty Direction is a neutral row.
+	HasDirection bool
+}
+
+type billCSVFile struct {
+	Source string
+	Rows   []billCSVRow
+}
+
+// billCSVColumns lists accepted header names per field, in priority order.
+// Alipay has shipped two layouts (legacy "交易记录明细查询" and the newer "电子客户回单"); WeChat has one.
+var billCSVColumns = map[string][]string{
+	"time":           {"付款时间", "交易时间", "交易创建时间"},
+	"merchant":       {"交易对方"},
+	"description":    {"商品名称", "商品说明", "商品"},
+	"amount":         {"金额（元）", "金额(元)", "金额"},
+	"direction":      {"收/支"},
+	"payment_method": {"支付方式", "收/付款方式"},
+	"status":         {"交易状态", "当前状态"},
+	"order_number":   {"交易订单号", "交易单号", "交易号"},
+	"merchant_order": {"商家订单号", "商户单号", "商户订单号"},
+}
+
+// decodeImportText converts an uploaded export to UTF-8. WeChat exports are UTF-8 (often with BOM);
+// Alipay exports and most domestic bank statements are GBK.
+func decodeImportText(raw []byte) (string, error) {
+	raw = bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf"))
+	if utf8.Valid(raw) {
+		return string(raw), nil
+	}
+	decoded, err := simplifiedchinese.GB18030.NewDecoder().Bytes(raw)
+	if err != nil {
+		return "", fmt.Errorf("decode gbk: %w", err)
+	}
+	return string(decoded), nil
+}
+
+func detectBillCSVSource(text string) string {
+	head := text
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	switch {
+	case strings.Contains(head, "微信支付账单"), strings.Contains(head, "微信昵称"):
+		return BillCSVSourceWeChat
+	case strings.Contains(head, "支付宝"):
+		return BillCSVSourceAlipay
+	default:
+		return ""
+	}
+}
+
+// parseBillCSV recognizes an Alipay or WeChat Pay bill export, skips the preamble and footer,
+// and returns the transaction rows keyed by the vendor's column names.
+func parseBillCSV(raw []byte) (*billCSVFile, error) {
+	text, err := decodeImportText(raw)
+	if err != nil {
+		return nil, err
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	source := detectBillCSVSource(text)
+
+	lines := strings.Split(text, "\n")
+	headerIdx := -1
+	for i, line := range lines {
+		if strings.Contains(line, "交易对方") && strings.Contains(line, "金额") && strings.Contains(line, "时间") {
+			headerIdx = i
+			break
+		}
+	}
+	if headerIdx < 0 {
+		return nil, ErrUnsupportedBillCSV
+	}
+	if source == "" {
+		// Header-only detection: WeChat is the only layout with "当前状态".
+		if strings.Contains(lines[headerIdx], "当前状态") {
+			source = BillCSVSourceWeChat
+		} else {
+			source = BillCSVSourceAlipay
+		}
+	}
+
+	body := make([]string, 0, len(lines)-headerIdx)
+	for _, line := range lines[headerIdx:] {
+		trimmed := strings.TrimSpace(line)
+		if len(body) > 0 && (trimmed == "" || strings.HasPrefix(trimmed, "---")) {
+			// Footer ("----" separator followed by export summary).
+			break
+		}
+		body = append(body, line)
+	}
+
+	reader := csv.NewReader(strings.NewReader(strings.Join(body, "\n")))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read bill csv header: %w", err)
+	}
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+	columns := make(map[string]int, len(billCSVColumns))
+	for field, names := range billCSVColumns {
+		columns[field] = -1
+		for _, name := range names {
+			if i, ok := index[name]; ok {
+				columns[field] = i
+				break
+			}
+		}
+	}
+	if columns["time"] < 0 || columns["amount"] < 0 {
+		return nil, ErrUnsupportedBillCSV
+	}
+
+	out := &billCSVFile{Source: source}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read bill csv: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		get := func(field string) string {
+			i := columns[field]
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return cleanBillCSVCell(record[i])
+		}
+		row := billCSVRow{
+			Line:          headerIdx + line,
+			Time:          get("time"),
+			Merchant:      get("merchant"),
+			Description:   get("description"),
+			Amount:        get("amount"),
+			Direction:     get("direction"),
+			HasDirection:  columns["direction"] >= 0,
+			PaymentMethod: get("payment_method"),
+			Status:        get("status"),
+			OrderNumber:   get("order_number"),
+			MerchantOrder: get("merchant_order"),
+		}
+		// Legacy Alipay layout leaves 付款时间 empty for unpaid rows; fall back to the creation time.
+		if i, ok := index["交易创建时间"]; ok && row.Time == "" && i < len(record) {
+			row.Time = cleanBillCSVCell(record[i])
+		}
+		if row.Time == "" && row.Amount == "" {
+			continue
+		}
+		out.Rows = append(out.Rows, row)
+	}
+	return out, nil
+}
+
+// cleanBillCSVCell strips padding and the trailing tab WeChat appends to keep order numbers as text.
+func cleanBillCSVCell(s string) string {
+	s = strings.TrimSpace(strings.Trim(s, "\t"))
+	if s == "/" {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestParseBillCSV_AlipayGBK(t *testing.T) {
+	text := strings.Join([]string{
+		"支付宝交易记录明细查询",
+		"账号:[someone@example.com]",
+		"起始日期:[2025-10-01 00:00:00]    终止日期:[2025-11-01 00:00:00]",
+		"---------------------------------交易记录明细列表------------------------------------",
+		"交易号                  ,商户订单号               ,交易创建时间              ,付款时间                ,最近修改时间              ,交易来源地     ,类型              ,交易对方            ,商品名称                ,金额（元）   ,收/支     ,交易状态    ,服务费（元）   ,成功退款（元）  ,备注                  ,资金状态     ,",
+		"2025101522001400001234567890\t,T20251015001\t,2025-10-15 12:30:00 ,2025-10-15 12:30:05 ,2025-10-15 12:30:05 ,其他（包括阿里巴巴和外部商家）,即时到账交易          ,星巴克咖啡            ,拿铁                ,38.00   ,支出      ,交易成功    ,0.00     ,0.00     ,                    ,已支出      ,",
+		"2025101622001400001234567891\t,                        ,2025-10-16 09:00:00 ,                    ,2025-10-16 09:00:00 ,支付宝网站     ,即时到账交易          ,张三                ,转账                ,100.00  ,收入      ,交易成功    ,0.00     ,0.00     ,                    ,已收入      ,",
+		"------------------------------------------------------------------------------------",
+		"共2笔记录",
+	}, "\r\n")
+	raw, err := simplifiedchinese.GBK.NewEncoder().String(text)
+	if err != nil {
+		t.Fatalf("encode gbk: %v", err)
+	}
+
+	file, err := parseBillCSV([]byte(raw))
+	if err != nil {
+		t.Fatalf("parseBillCSV: %v", err)
+	}
+	if file.Source != BillCSVSourceAlipay {
+		t.Fatalf("source=%q", file.Source)
+	}
+	if len(file.Rows) != 2 {
+		t.Fatalf("rows=%d want 2: %#v", len(file.Rows), file.Rows)
+	}
+	row := file.Rows[0]
+	if row.Merchant != "星巴克咖啡" || row.Amount != "38.00" || row.Time != "2025-10-15 12:30:05" {
+		t.Fatalf("unexpected row: %#v", row)
+	}
+	if row.OrderNumber != "2025101522001400001234567890" || row.Line != 6 {
+		t.Fatalf("unexpected order/line: %#v", row)
+	}
+	if reason := billCSVSkipReason(file.Rows[1]); reason == "" {
+		t.Fatalf("income row should be skipped")
+	}
+}
+
+func TestParseBillCSV_WeChatUTF8BOM(t *testing.T) {
+	text := "\ufeff" + strings.Join([]string{
+		"微信支付账单明细,,,,,,,,,,",
+		"微信昵称：[someone],,,,,,,,,,",
+		"起始时间：[2025-10-01 00:00:00] 终止时间：[2025-10-31 23:59:59],,,,,,,,,,",
+		"----------------------微信支付账单明细列表--------------------,,,,,,,,,,",
+		"交易时间,交易类型,交易对方,商品,收/支,金额(元),支付方式,当前状态,交易单号,商户单号,备注",
+		"2025-10-20 18:01:02,商户消费,滴滴出行,\"快车, 杭州\",支出,¥25.60,招商银行信用卡(1234),支付成功,4200002001202510201234567890\t,D20251020\t,/",
+		"2025-10-21 08:00:00,商户消费,某便利店,饮料,支出,¥6.00,零钱,已全额退款,4200002001202510211234567890\t,M1\t,/",
+		"2025-10-22 09:00:00,信用卡还款,招商银行,/,/,¥500.00,零钱,支付成功,4200002001202510221234567890\t,/,/",
+	}, "\n")
+
+	file, err := parseBillCSV([]byte(text))
+	if err != nil {
+		t.Fatalf("parseBillCSV: %v", err)
+	}
+	if file.Source != BillCSVSourceWeChat || len(file.Rows) != 3 {
+		t.Fatalf("unexpected file: %#v", file)
+	}
+	row := file.Rows[0]
+	if row.Description != "快车, 杭州" || row.PaymentMethod != "招商银行信用卡(1234)" {
+		t.Fatalf("unexpected row: %#v", row)
+	}
+	if v := parseAmount(row.Amount); v == nil || *v != 25.6 {
+		t.Fatalf("amount=%q", row.Amount)
+	}
+	if row.OrderNumber != "4200002001202510201234567890" || row.MerchantOrder != "D20251020" {
+		t.Fatalf("order numbers not cleaned: %#v", row)
+	}
+	if reason := billCSVSkipReason(file.Rows[1]); reason == "" {
+		t.Fatalf("refunded row should be skipped")
+	}
+	// Neutral rows ("/" in 收/支) move money between own accounts and are not expenses.
+	if reason := billCSVSkipReason(file.Rows[2]); reason != "not an expense" {
+		t.Fatalf("neutral row should be skipped, got %q", reason)
+	}
+	if reason := billCSVSkipReason(billCSVRow{Status: "支付成功"}); reason != "" {
+		t.Fatalf("rows of exports without 收/支 should be kept, got %q", reason)
+	}
+}
+
+func TestParseBillCSV_Unsupported(t *testing.T) {
+	if _, err := parseBillCSV([]byte("a,b,c\n1,2,3\n")); err != ErrUnsupportedBillCSV {
+		t.Fatalf("err=%v want ErrUnsupportedBillCSV", err)
+	}
+}
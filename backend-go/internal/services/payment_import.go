@@ -0,0 +1,304 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"smart-bill-manager/internal/money"
+)
+
+const (
+	PaymentImportRowNew        = "new"
+	PaymentImportRowCreated    = "created"
+	PaymentImportRowImported   = "already_imported"
+	PaymentImportRowDuplicate  = "suspected_duplicate"
+	PaymentImportRowSkipped    = "skipped"
+	PaymentImportRowInvalid    = "invalid"
+	paymentImportDedupWindow   = 5 * time.Minute
+	paymentImportDedupMaxCands = 5
+)
+
+type PaymentImportRow struct {
+	Line            int              `json:"line"`
+	Status          string           `json:"status"`
+	Reason          string           `json:"reason,omitempty"`
+	PaymentID       string           `json:"payment_id,omitempty"`
+	Amount          float64          `json:"amount"`
+	Currency        string           `json:"currency,omitempty"`
+	Merchant        string           `json:"merchant,omitempty"`
+	PaymentMethod   string           `json:"payment_method,omitempty"`
+	TransactionTime string           `json:"transaction_time,omitempty"`
+	OrderNumber     string           `json:"order_number,omitempty"`
+	ExternalID      string           `json:"external_id,omitempty"`
+	Candidates      []DedupCandidate `json:"candidates,omitempty"`
+}
+
+type PaymentImportResult struct {
+	Source     string             `json:"source"`
+	Committed  bool               `json:"committed"`
+	Total      int                `json:"total"`
+	New        int                `json:"new"`
+	Created    int                `json:"created"`
+	Duplicates int                `json:"duplicates"`
+	Skipped    int                `json:"skipped"`
+	Invalid    int                `json:"invalid"`
+	Rows       []PaymentImportRow `json:"rows"`
+}
+
+func (r *PaymentImportResult) add(row PaymentImportRow) {
+	r.Total++
+	switch row.Status {
+	case PaymentImportRowNew:
+		r.New++
+	case PaymentImportRowCreated:
+		r.Created++
+	case PaymentImportRowImported, PaymentImportRowDuplicate:
+		r.Duplicates++
+	case PaymentImportRowSkipped:
+		r.Skipped++
+	case PaymentImportRowInvalid:
+		r.Invalid++
+	}
+	r.Rows = append(r.Rows, row)
+}
+
+// paymentImportEntry is one source transaction normalized by a format parser. Time is parsed
+// with parsePaymentTimeToUTC (Asia/Shanghai when no offset is given); DateOnly marks a source
+// that only gives the day, with Time at its midnight. Amount is the unsigned expense amount.
+// Entries with SkipReason or InvalidReason set are reported but never inserted.
+type paymentImportEntry struct {
+	Line          int
+	Time          string
+	DateOnly      bool
+	Amount        string
+	Currency      string // ISO 4217; empty means CNY
+	Merchant      string
+	Category      string
+	Description   string
+	PaymentMethod string
+	OrderNumber   string
+	ExternalID    string
+	SkipReason    string
+	InvalidReason string
+}
+
+// ImportBillCSV imports an Alipay/WeChat Pay bill export. Expense rows become confirmed payments
+// through Create; rows matching an existing payment by amount+time are reported, not inserted.
+func (s *PaymentService) ImportBillCSV(ownerUserID string, raw []byte) (*PaymentImportResult, error) {
+	file, err := parseBillCSV(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]paymentImportEntry, 0, len(file.Rows))
+	for _, row := range file.Rows {
+		entries = append(entries, paymentImportEntry{
+			Line:          row.Line,
+			Time:          row.Time,
+			Amount:        row.Amount,
+			Merchant:      row.Merchant,
+			Description:   row.Description,
+			PaymentMethod: row.PaymentMethod,
+			OrderNumber:   row.OrderNumber,
+			ExternalID:    row.OrderNumber,
+			SkipReason:    billCSVSkipReason(row),
+		})
+	}
+	return s.importPaymentEntries(ownerUserID, file.Source, entries, true)
+}
+
+// importPaymentEntries validates and deduplicates entries. Without commit it only reports what
+// would happen; with commit the new rows are inserted one by one, and budgets are checked once for
+// the whole batch. Rows created by the batch itself never count as duplicates of later rows, so
+// commit reports what the preview showed. When a row fails, the result so far is returned with the error, so the client
+// still sees the rows already created.
+func (s *PaymentService) importPaymentEntries(ownerUserID, source string, entries []paymentImportEntry, commit bool) (*PaymentImportResult, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	shanghai := loadLocationOrUTC("Asia/Shanghai")
+	out := &PaymentImportResult{Source: source, Committed: commit, Rows: make([]PaymentImportRow, 0, len(entries))}
+	seen := make(map[string]bool, len(entries))
+	var createdIDs []string
+	defer func() {
+		if len(createdIDs) > 0 {
+			s.checkBatchBudgetAlerts(ownerUserID, createdIDs)
+		}
+	}()
+	for _, entry := range entries {
+		item := PaymentImportRow{
+			Line:          entry.Line,
+			Merchant:      entry.Merchant,
+			PaymentMethod: sanitizePaymentMethod(entry.PaymentMethod),
+			OrderNumber:   entry.OrderNumber,
+			ExternalID:    strings.TrimSpace(entry.ExternalID),
+		}
+
+		if entry.InvalidReason != "" {
+			item.Status = PaymentImportRowInvalid
+			item.Reason = entry.InvalidReason
+			out.add(item)
+			continue
+		}
+		if entry.SkipReason != "" {
+			item.Status = PaymentImportRowSkipped
+			item.Reason = entry.SkipReason
+			out.add(item)
+			continue
+		}
+
+		amount := parseAmount(entry.Amount)
+		if amount == nil || math.Abs(*amount) <= 0 {
+			item.Status = PaymentImportRowInvalid
+			item.Reason = "invalid amount"
+			out.add(item)
+			continue
+		}
+		item.Amount = math.Abs(*amount)
+
+		currency, err := money.NormalizeCurrency(entry.Currency)
+		if err != nil {
+			item.Status = PaymentImportRowInvalid
+			item.Reason = "invalid currency"
+			out.add(item)
+			continue
+		}
+		item.Currency = currency
+
+		payTime, err := parsePaymentTimeToUTC(entry.Time, shanghai)
+		if err != nil {
+			item.Status = PaymentImportRowInvalid
+			item.Reason = "invalid transaction time"
+			out.add(item)
+			continue
+		}
+		item.TransactionTime = payTime.Format(time.RFC3339)
+
+		if item.ExternalID != "" {
+			if seen[item.ExternalID] {
+				item.Status = PaymentImportRowImported
+				item.Reason = "external_id"
+				out.add(item)
+				continue
+			}
+			seen[item.ExternalID] = true
+
+			existing, err := s.FindByExternalIDForOwner(ownerUserID, source, item.ExternalID)
+			if err != nil {
+				return out, err
+			}
+			if existing != nil {
+				item.Status = PaymentImportRowImported
+				item.Reason = "external_id"
+				item.PaymentID = existing.ID
+				out.add(item)
+				continue
+			}
+		}
+
+		startTs, endTs := paymentImportDedupRange(entry.DateOnly, payTime)
+		cands, err := s.FindImportCandidatesForOwner(ownerUserID, item.Amount, item.Currency, startTs, endTs, source, item.ExternalID, createdIDs, paymentImportDedupMaxCands)
+		if err != nil {
+			return out, err
+		}
+		if len(cands) > 0 {
+			item.Status = PaymentImportRowDuplicate
+			item.Reason = "amount_time"
+			item.Candidates = cands
+			out.add(item)
+			continue
+		}
+
+		if !commit {
+			item.Status = PaymentImportRowNew
+			out.add(item)
+			continue
+		}
+
+		payment, err := s.create(ownerUserID, paymentImportEntryToInput(source, entry, item), false)
+		if err != nil {
+			return out, fmt.Errorf("import line %d: %w", entry.Line, err)
+		}
+		createdIDs = append(createdIDs, payment.ID)
+		item.Status = PaymentImportRowCreated
+		item.PaymentID = payment.ID
+		out.add(item)
+	}
+	return out, nil
+}
+
+// paymentImportDedupRange returns the time range (unix millis) searched for amount/time duplicates.
+// Date-only entries (OFX DTPOSTED without a clock, QIF D, CAMT Dt, mapped CSV formats without a
+// time) sit at the midnight of their day while the matching payment may be at any hour, so the
+// whole day from that midnight is searched for them.
+func paymentImportDedupRange(dateOnly bool, payTime time.Time) (int64, int64) {
+	if !dateOnly {
+		deltaMs := int64(paymentImportDedupWindow / time.Millisecond)
+		return unixMilli(payTime) - deltaMs, unixMilli(payTime) + deltaMs
+	}
+	return unixMilli(payTime), unixMilli(payTime.Add(24*time.Hour)) - 1
+}
+
+// billCSVSkipReason filters rows that are not completed expenses (income, transfers between
+// own accounts, closed or failed orders). WeChat marks neutral rows such as 零钱提现 or 信用卡还款
+// with "/" in 收/支, which cleanBillCSVCell turns into an empty direction.
+func billCSVSkipReason(row billCSVRow) string {
+	direction := strings.TrimSpace(row.Direction)
+	if row.HasDirection && direction != "支出" {
+		return "not an expense"
+	}
+	status := strings.TrimSpace(row.Status)
+	for _, bad := range []string{"关闭", "失败", "已全额退款", "对方已退还"} {
+		if strings.Contains(status, bad) {
+			return "transaction " + status
+		}
+	}
+	return ""
+}
+
+func paymentImportEntryToInput(source string, entry paymentImportEntry, item PaymentImportRow) CreatePaymentInput {
+	currency := item.Currency
+	input := CreatePaymentInput{
+		Amount:          item.Amount,
+		Currency:        &currency,
+		TransactionTime: item.TransactionTime,
+	}
+	if v := strings.TrimSpace(entry.Merchant); v != "" {
+		input.Merchant = &v
+	}
+	if v := strings.TrimSpace(entry.Category); v != "" {
+		input.Category = &v
+	}
+	if v := strings.TrimSpace(item.PaymentMethod); v != "" {
+		input.PaymentMethod = &v
+	}
+	if v := strings.TrimSpace(entry.Description); v != "" {
+		input.Description = &v
+	}
+	if item.ExternalID != "" {
+		src := source
+		externalID := item.ExternalID
+		input.ImportSource = &src
+		input.ExternalID = &externalID
+	}
+
+	// Keep the vendor order number alongside OCR results so later matching sees the same shape.
+	extracted := &PaymentExtractedData{
+		Amount:                &item.Amount,
+		AmountSource:          source,
+		Merchant:              input.Merchant,
+		MerchantSource:        source,
+		TransactionTime:       &item.TransactionTime,
+		TransactionTimeSource: source,
+		PaymentMethod:         input.PaymentMethod,
+		PaymentMethodSource:   source,
+	}
+	if v := strings.TrimSpace(entry.OrderNumber); v != "" {
+		extracted.OrderNumber = &v
+		extracted.OrderNumberSource = source
+	}
+	if data, err := ExtractedDataToJSON(extracted); err == nil {
+		input.ExtractedData = data
+	}
+	return input
+}
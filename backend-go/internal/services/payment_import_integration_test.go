@@ -0,0 +1,246 @@
+//go:build cgo
+
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImportBillCSVReportsDuplicatesInsteadOfInserting(t *testing.T) {
+	db := openServiceTestDB(t)
+	service := NewPaymentService(db, t.TempDir())
+
+	// Same transaction already entered from a screenshot (2025-10-20 18:01:02 Asia/Shanghai).
+	existing, err := service.Create("owner-1", CreatePaymentInput{
+		Amount:          25.6,
+		TransactionTime: "2025-10-20T10:01:00Z",
+	})
+	if err != nil {
+		t.Fatalf("创建已有支付失败: %v", err)
+	}
+
+	csv := strings.Join([]string{
+		"微信支付账单明细,,,,,,,,,,",
+		"交易时间,交易类型,交易对方,商品,收/支,金额(元),支付方式,当前状态,交易单号,商户单号,备注",
+		"2025-10-20 18:01:02,商户消费,滴滴出行,快车,支出,¥25.60,零钱,支付成功,4200000001\t,D1\t,/",
+		"2025-10-22 12:00:00,商户消费,便利店,饮料,支出,¥6.00,零钱,支付成功,4200000002\t,D2\t,/",
+		"2025-10-23 12:00:00,转账,张三,/,收入,¥50.00,/,已存入零钱,4200000003\t,/,/",
+	}, "\n")
+
+	result, err := service.ImportBillCSV("owner-1", []byte(csv))
+	if err != nil {
+		t.Fatalf("导入账单失败: %v", err)
+	}
+	if result.Total != 3 || result.Created != 1 || result.Duplicates != 1 || result.Skipped != 1 {
+		t.Fatalf("导入统计异常: %#v", result)
+	}
+	dup := result.Rows[0]
+	if dup.Status != PaymentImportRowDuplicate || len(dup.Candidates) == 0 || dup.Candidates[0].ID != existing.ID {
+		t.Fatalf("应命中已有支付记录: %#v", dup)
+	}
+	assertPaymentCount(t, db, 2)
+
+	created, err := service.GetByID("owner-1", result.Rows[1].PaymentID)
+	if err != nil {
+		t.Fatalf("读取导入支付失败: %v", err)
+	}
+	if created.AmountCents != 600 || created.IsDraft || created.TransactionTime != "2025-10-22T04:00:00Z" {
+		t.Fatalf("导入支付内容异常: %#v", created)
+	}
+	if created.ExtractedData == nil || !strings.Contains(*created.ExtractedData, "4200000002") {
+		t.Fatalf("应保留交易单号: %v", created.ExtractedData)
+	}
+
+	again, err := service.ImportBillCSV("owner-1", []byte(csv))
+	if err != nil {
+		t.Fatalf("重复导入失败: %v", err)
+	}
+	if again.Created != 0 || again.Duplicates != 2 {
+		t.Fatalf("重复导入不应插入新记录: %#v", again)
+	}
+	assertPaymentCount(t, db, 2)
+}
+
+func TestImportStatementPreviewThenCommitIsIdempotent(t *testing.T) {
+	db := openServiceTestDB(t)
+	service := NewPaymentService(db, t.TempDir())
+
+	preview, err := service.ImportStatement("owner-1", "statement.ofx", []byte(testOFXStatement), false)
+	if err != nil {
+		t.Fatalf("预览对账单失败: %v", err)
+	}
+	if preview.Committed || preview.New != 1 || preview.Skipped != 1 || preview.Rows[0].Status != PaymentImportRowNew {
+		t.Fatalf("预览统计异常: %#v", preview)
+	}
+	assertPaymentCount(t, db, 0)
+
+	result, err := service.ImportStatement("owner-1", "statement.ofx", []byte(testOFXStatement), true)
+	if err != nil {
+		t.Fatalf("导入对账单失败: %v", err)
+	}
+	if result.Created != 1 {
+		t.Fatalf("导入统计异常: %#v", result)
+	}
+	created, err := service.GetByID("owner-1", result.Rows[0].PaymentID)
+	if err != nil {
+		t.Fatalf("读取导入支付失败: %v", err)
+	}
+	if created.ExternalID == nil || *created.ExternalID != "FIT-001" || created.ImportSource == nil || *created.ImportSource != StatementSourceOFX {
+		t.Fatalf("应保留银行交易号: %#v", created)
+	}
+	if created.AmountCents != 2560 || created.TransactionTime != "2025-10-20T02:01:00Z" {
+		t.Fatalf("导入支付内容异常: %#v", created)
+	}
+
+	again, err := service.ImportStatement("owner-1", "statement.ofx", []byte(testOFXStatement), true)
+	if err != nil {
+		t.Fatalf("重复导入失败: %v", err)
+	}
+	row := again.Rows[0]
+	if again.Created != 0 || row.Status != PaymentImportRowImported || row.PaymentID != created.ID {
+		t.Fatalf("重复导入应按交易号识别: %#v", again)
+	}
+	assertPaymentCount(t, db, 1)
+
+	// Another user importing the same statement is unaffected.
+	other, err := service.ImportStatement("owner-2", "statement.ofx", []byte(testOFXStatement), true)
+	if err != nil {
+		t.Fatalf("其他用户导入失败: %v", err)
+	}
+	if other.Created != 1 {
+		t.Fatalf("其他用户应能导入: %#v", other)
+	}
+}
+
+func TestImportStatementMatchesDateOnlyRowsOverTheWholeDay(t *testing.T) {
+	db := openServiceTestDB(t)
+	service := NewPaymentService(db, t.TempDir())
+
+	// Entered from a screenshot at 2025-10-20 21:30 Asia/Shanghai; the QIF row only has the date.
+	existing, err := service.Create("owner-1", CreatePaymentInput{
+		Amount:          88,
+		TransactionTime: "2025-10-20T13:30:00Z",
+	})
+	if err != nil {
+		t.Fatalf("创建已有支付失败: %v", err)
+	}
+
+	qif := "!Type:Bank\nD2025-10-20\nT-88.00\nP超市\n^\nD2025-10-21\nT-88.00\nP超市\n^\n"
+	result, err := service.ImportStatement("owner-1", "statement.qif", []byte(qif), false)
+	if err != nil {
+		t.Fatalf("预览对账单失败: %v", err)
+	}
+	if len(result.Rows) != 2 {
+		t.Fatalf("导入行数异常: %#v", result)
+	}
+	dup := result.Rows[0]
+	if dup.Status != PaymentImportRowDuplicate || len(dup.Candidates) == 0 || dup.Candidates[0].ID != existing.ID {
+		t.Fatalf("同一天的支付应被识别为重复: %#v", dup)
+	}
+	if result.Rows[1].Status != PaymentImportRowNew {
+		t.Fatalf("次日的支付不应被识别为重复: %#v", result.Rows[1])
+	}
+}
+
+func TestImportStatementKeepsIdenticalSameDayRows(t *testing.T) {
+	db := openServiceTestDB(t)
+	service := NewPaymentService(db, t.TempDir())
+
+	// Two genuine ¥15 debits at the same shop on one day; the QIF rows only carry the date.
+	qif := "!Type:Bank\nD2025-10-20\nT-15.00\nP食堂\n^\nD2025-10-20\nT-15.00\nP食堂\n^\n"
+	preview, err := service.ImportStatement("owner-1", "statement.qif", []byte(qif), false)
+	if err != nil {
+		t.Fatalf("预览对账单失败: %v", err)
+	}
+	if preview.New != 2 || preview.Duplicates != 0 {
+		t.Fatalf("预览应将两笔都视为新记录: %#v", preview)
+	}
+
+	result, err := service.ImportStatement("owner-1", "statement.qif", []byte(qif), true)
+	if err != nil {
+		t.Fatalf("导入对账单失败: %v", err)
+	}
+	if result.Created != 2 || result.Duplicates != 0 {
+		t.Fatalf("导入结果应与预览一致: %#v", result)
+	}
+	assertPaymentCount(t, db, 2)
+
+	again, err := service.ImportStatement("owner-1", "statement.qif", []byte(qif), true)
+	if err != nil {
+		t.Fatalf("重复导入失败: %v", err)
+	}
+	for _, row := range again.Rows {
+		if row.Status != PaymentImportRowImported {
+			t.Fatalf("重复导入应按交易号识别: %#v", row)
+		}
+	}
+	assertPaymentCount(t, db, 2)
+}
+
+func TestImportMappedCSVDryRunThenCommit(t *testing.T) {
+	db := openServiceTestDB(t)
+	service := NewPaymentService(db, t.TempDir())
+	profiles := NewImportProfileService(db)
+
+	profile, err := profiles.Create("owner-1", ImportProfileInput{
+		Name:             "信用卡",
+		AmountColumn:     "交易金额",
+		TimeColumn:       "交易日期",
+		MerchantColumn:   "交易描述",
+		ExternalIDColumn: "流水号",
+		DateFormat:       "YYYY-MM-DD",
+		AmountSign:       ImportAmountSignExpensePositive,
+	})
+	if err != nil {
+		t.Fatalf("创建导入模板失败: %v", err)
+	}
+	if !profile.HasHeader || profile.Encoding != "auto" || profile.Delimiter != "," {
+		t.Fatalf("导入模板默认值异常: %#v", profile)
+	}
+	if _, err := profiles.GetByID("owner-2", profile.ID); err != ErrImportProfileNotFound {
+		t.Fatalf("其他用户不应读取导入模板: %v", err)
+	}
+
+	csv := "交易日期,交易描述,交易金额,流水号\n2025-10-20,超市,88.80,S1\n2025-10-21,还款,-500.00,S2\n2025-10-22,加油,,S3\n"
+	preview, err := service.ImportMappedCSV("owner-1", profile.ID, []byte(csv), true)
+	if err != nil {
+		t.Fatalf("试导入失败: %v", err)
+	}
+	if preview.New != 1 || preview.Skipped != 1 || preview.Invalid != 1 || preview.Rows[2].Reason == "" {
+		t.Fatalf("试导入统计异常: %#v", preview)
+	}
+	assertPaymentCount(t, db, 0)
+
+	result, err := service.ImportMappedCSV("owner-1", profile.ID, []byte(csv), false)
+	if err != nil {
+		t.Fatalf("导入失败: %v", err)
+	}
+	if result.Created != 1 {
+		t.Fatalf("导入统计异常: %#v", result)
+	}
+	created, err := service.GetByID("owner-1", result.Rows[0].PaymentID)
+	if err != nil {
+		t.Fatalf("读取导入支付失败: %v", err)
+	}
+	if created.AmountCents != 8880 || created.TransactionTime != "2025-10-19T16:00:00Z" || created.ImportSource == nil || *created.ImportSource != MappedCSVSourcePrefix+profile.ID {
+		t.Fatalf("导入支付内容异常: %#v", created)
+	}
+
+	if _, err := service.ImportMappedCSV("owner-2", profile.ID, []byte(csv), true); err != ErrImportProfileNotFound {
+		t.Fatalf("其他用户不应使用导入模板: %v", err)
+	}
+
+	// A date-only row matches a payment entered with its real time anywhere on that day.
+	existing, err := service.Create("owner-1", CreatePaymentInput{Amount: 66, TransactionTime: "2025-10-23T12:30:00Z"})
+	if err != nil {
+		t.Fatalf("创建已有支付失败: %v", err)
+	}
+	dayOnly, err := service.ImportMappedCSV("owner-1", profile.ID, []byte("交易日期,交易描述,交易金额,流水号\n2025-10-23,便利店,66.00,S4\n"), true)
+	if err != nil {
+		t.Fatalf("试导入失败: %v", err)
+	}
+	if row := dayOnly.Rows[0]; row.Status != PaymentImportRowDuplicate || len(row.Candidates) == 0 || row.Candidates[0].ID != existing.ID {
+		t.Fatalf("仅有日期的行应按整天匹配重复: %#v", row)
+	}
+}
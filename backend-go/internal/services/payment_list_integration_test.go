@@ -0,0 +1,98 @@
+//go:build cgo
+
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"smart-bill-manager/internal/models"
+)
+
+func TestBillListScreenshotCreatesOneDraftPerRow(t *testing.T) {
+	db := openServiceTestDB(t)
+	uploads := t.TempDir()
+	payments := NewPaymentService(db, uploads)
+
+	existing, err := payments.Create("owner-1", CreatePaymentInput{Amount: 25, TransactionTime: "2025-12-03T04:30:00Z"})
+	if err != nil {
+		t.Fatalf("创建已有支付失败: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(uploads, "list.png"), []byte("list"), 0o644); err != nil {
+		t.Fatalf("写入截图失败: %v", err)
+	}
+	fileHash := "list-hash"
+	draft, err := payments.CreateDraftFromScreenshotUpload("owner-1", "uploads/list.png", &fileHash)
+	if err != nil {
+		t.Fatalf("创建草稿失败: %v", err)
+	}
+
+	now := time.Date(2025, 12, 3, 20, 0, 0, 0, time.UTC)
+	lines := []OCRCLILine{
+		listLine("美团外卖", 140, 260, 200),
+		listLine("-25.00", 880, 262, 160),
+		listLine("今天 12:30", 140, 340, 200),
+		listLine("滴滴出行", 140, 420, 200),
+		listLine("-18.50", 880, 422, 160),
+		listLine("昨天 08:12", 140, 500, 200),
+		listLine("全家便利店", 140, 580, 200),
+		listLine("-9.90", 880, 582, 160),
+		listLine("12-01 07:45", 140, 660, 200),
+	}
+	process := func() *paymentOCRTaskResult {
+		t.Helper()
+		rows := (&OCRService{}).parsePaymentListLines(lines, now)
+		current, err := payments.repo.FindByID(draft.ID)
+		if err != nil {
+			t.Fatalf("读取草稿失败: %v", err)
+		}
+		res, err := payments.processPaymentListOCR(current, rows)
+		if err != nil {
+			t.Fatalf("处理账单列表失败: %v", err)
+		}
+		return res
+	}
+
+	res := process()
+	if len(res.Rows) != 3 || res.Payment.ID != draft.ID || res.Rows[0].Payment.ID != draft.ID {
+		t.Fatalf("应为每行生成一张草稿且首行复用上传草稿: %#v", res)
+	}
+	first := res.Rows[0].Payment
+	if first.Amount != 25 || first.Merchant == nil || *first.Merchant != "美团外卖" || first.DedupStatus != DedupStatusSuspected ||
+		first.DedupRefID == nil || *first.DedupRefID != existing.ID || res.Rows[0].Dedup == nil {
+		t.Fatalf("首行应识别并按金额时间标记疑似重复: %#v", first)
+	}
+	for _, row := range res.Rows[1:] {
+		p := row.Payment
+		if !p.IsDraft || p.FileSHA256 != nil || p.ScreenshotPath == nil || *p.ScreenshotPath != "uploads/list.png" || p.DedupStatus != DedupStatusOK {
+			t.Fatalf("其余行应为共用截图且无文件哈希的草稿: %#v", p)
+		}
+	}
+	if got := res.Rows[2].Payment.TransactionTime; got != "2025-11-30T23:45:00Z" {
+		t.Fatalf("行内时间应按北京时间解析: %s", got)
+	}
+
+	// Re-running the task replaces the rows created the first time.
+	res = process()
+	var drafts int64
+	db.Model(&models.Payment{}).Where("screenshot_path = ?", "uploads/list.png").Count(&drafts)
+	if drafts != 3 {
+		t.Fatalf("重新识别不应重复生成草稿: %d", drafts)
+	}
+
+	confirm := true
+	for _, row := range res.Rows[1:] {
+		if err := payments.Update("owner-1", row.Payment.ID, UpdatePaymentInput{Confirm: &confirm}); err != nil {
+			t.Fatalf("同一截图的其他行应可独立确认: %v", err)
+		}
+	}
+	if err := payments.Delete("owner-1", draft.ID); err != nil {
+		t.Fatalf("删除草稿失败: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(uploads, "list.png")); err != nil {
+		t.Fatalf("仍被其他支付引用的截图不应删除: %v", err)
+	}
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"smart-bill-manager/internal/models"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// MappedCSVSourcePrefix prefixes the profile ID in payments.import_source, so external IDs from
+// different banks never collide.
+const MappedCSVSourcePrefix = "csv:"
+
+var ErrInvalidMappedCSV = errors.New("csv does not match import profile")
+
+// ImportMappedCSV imports a CSV export using a saved column-mapping profile. With dryRun nothing
+// is written and the result lists every row that would be created, skipped or rejected.
+func (s *PaymentService) ImportMappedCSV(ownerUserID string, profileID string, raw []byte, dryRun bool) (*PaymentImportResult, error) {
+	profile, err := findImportProfileForOwner(s.db, ownerUserID, profileID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseMappedCSV(profile, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMappedCSV, err)
+	}
+	return s.importPaymentEntries(ownerUserID, MappedCSVSourcePrefix+profile.ID, entries, !dryRun)
+}
+
+func decodeMappedCSV(encoding string, raw []byte) (string, error) {
+	switch encoding {
+	case "utf-8":
+		raw = bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf"))
+		if !utf8.Valid(raw) {
+			return "", fmt.Errorf("file is not valid utf-8")
+		}
+		return string(raw), nil
+	case "gbk":
+		decoded, err := simplifiedchinese.GB18030.NewDecoder().Bytes(raw)
+		if err != nil {
+			return "", fmt.Errorf("decode gbk: %w", err)
+		}
+		return string(decoded), nil
+	default:
+		return decodeImportText(raw)
+	}
+}
+
+// parseMappedCSV turns each data row into an import entry. Per-row problems (unparsable amount
+// or time) are recorded on the entry so a dry run can report them; only structural problems
+// such as a missing mapped column fail the whole file.
+func parseMappedCSV(profile *models.ImportProfile, raw []byte) ([]paymentImportEntry, error) {
+	text, err := decodeMappedCSV(profile.Encoding, raw)
+	if err != nil {
+		return nil, err
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.SplitAfter(text, "\n")
+	if profile.SkipRows >= len(lines) {
+		return nil, fmt.Errorf("file has fewer than %d lines", profile.SkipRows+1)
+	}
+
+	reader := csv.NewReader(strings.NewReader(strings.Join(lines[profile.SkipRows:], "")))
+	reader.Comma, _ = utf8.DecodeRuneInString(profile.Delimiter)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var header []string
+	if profile.HasHeader {
+		header, err = reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("read csv header: %w", err)
+		}
+	}
+	resolve := func(field, ref string) (int, error) {
+		if ref == "" {
+			return -1, nil
+		}
+		for i, name := range header {
+			if strings.TrimSpace(name) == ref {
+				return i, nil
+			}
+		}
+		if n, err := strconv.Atoi(ref); err == nil && n >= 1 {
+			return n - 1, nil
+		}
+		return -1, fmt.Errorf("%s column %q not found", field, ref)
+	}
+	columns := map[string]string{
+		"amount":         profile.AmountColumn,
+		"time":           profile.TimeColumn,
+		"merchant":       profile.MerchantColumn,
+		"category":       profile.CategoryColumn,
+		"note":           profile.NoteColumn,
+		"payment_method": profile.PaymentMethodColumn,
+		"external_id":    profile.ExternalIDColumn,
+		"direction":      profile.DirectionColumn,
+	}
+	index := make(map[string]int, len(columns))
+	for field, ref := range columns {
+		if index[field], err = resolve(field, ref); err != nil {
+			return nil, err
+		}
+	}
+
+	loc := loadLocationOrUTC(profile.Timezone)
+	layout := importDateLayout(profile.DateFormat)
+	var out []paymentImportEntry
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read csv: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		get := func(field string) string {
+			i := index[field]
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(strings.Trim(record[i], "\t"))
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		entry := paymentImportEntry{
+			Line:          profile.SkipRows + line,
+			Merchant:      get("merchant"),
+			Category:      get("category"),
+			Description:   get("note"),
+			PaymentMethod: get("payment_method"),
+			ExternalID:    get("external_id"),
+		}
+		entry.OrderNumber = entry.ExternalID
+
+		rawTime := get("time")
+		var when time.Time
+		if layout != "" {
+			when, err = time.ParseInLocation(layout, rawTime, loc)
+		} else {
+			when, err = parsePaymentTimeToUTC(rawTime, loc)
+		}
+		if err != nil {
+			entry.InvalidReason = fmt.Sprintf("cannot parse time %q", rawTime)
+			out = append(out, entry)
+			continue
+		}
+		entry.Time = when.UTC().Format(time.RFC3339)
+		if layout != "" {
+			entry.DateOnly = !strings.Contains(layout, "15") && !strings.Contains(layout, "4")
+		} else {
+			entry.DateOnly = !strings.Contains(rawTime, ":")
+		}
+
+		rawAmount := get("amount")
+		amount, ok := parseMappedAmount(rawAmount, profile.DecimalSeparator)
+		if !ok || amount == 0 {
+			entry.InvalidReason = fmt.Sprintf("cannot parse amount %q", rawAmount)
+			out = append(out, entry)
+			continue
+		}
+		switch profile.AmountSign {
+		case ImportAmountSignExpensePositive:
+			if amount < 0 {
+				entry.SkipReason = "not an expense"
+			}
+		case ImportAmountSignAbsolute:
+		case ImportAmountSignDirection:
+			if !strings.Contains(get("direction"), profile.ExpenseMarker) {
+				entry.SkipReason = "not an expense"
+			}
+		default:
+			if amount > 0 {
+				entry.SkipReason = "not an expense"
+			}
+		}
+		entry.Amount = strconv.FormatFloat(math.Abs(amount), 'f', -1, 64)
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+// parseMappedAmount accepts currency symbols, thousands separators, accounting parentheses and
+// trailing minus signs ("12.00-") as produced by credit-card portals.
+func parseMappedAmount(s string, decimal string) (float64, bool) {
+	s = strings.NewReplacer("￥", "", "¥", "", "$", "", "€", "", "CNY", "", "RMB", "", "元", "", " ", "", "\u00a0", "").Replace(strings.TrimSpace(s))
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+	if strings.HasSuffix(s, "-") {
+		negative = true
+		s = strings.TrimSuffix(s, "-")
+	}
+	if decimal == "," {
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.Replace(s, ",", ".", 1)
+	} else {
+		s = strings.ReplaceAll(s, ",", "")
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	if negative {
+		v = -math.Abs(v)
+	}
+	return v, true
+}
+
+// importDateLayout converts a user-facing date format (YYYY-MM-DD HH:mm:ss and friends) to a Go
+// layout. A format that already is a Go layout is returned unchanged; "" means unsupported.
+func importDateLayout(format string) string {
+	format = strings.TrimSpace(format)
+	if format == "" || strings.Contains(format, "2006") {
+		return format
+	}
+	tokens := []struct{ from, to string }{
+		{"YYYY", "2006"}, {"YY", "06"},
+		{"MM", "01"}, {"M", "1"},
+		{"DD", "02"}, {"D", "2"},
+		{"HH", "15"}, {"H", "15"},
+		{"mm", "04"}, {"m", "4"},
+		{"ss", "05"}, {"s", "5"},
+	}
+	var b strings.Builder
+	hasYear := false
+	for i := 0; i < len(format); {
+		matched := false
+		for _, tok := range tokens {
+			if strings.HasPrefix(format[i:], tok.from) {
+				b.WriteString(tok.to)
+				i += len(tok.from)
+				hasYear = hasYear || strings.HasPrefix(tok.from, "Y")
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(format[i:])
+		if r >= '0' && r <= '9' {
+			// Digits would be read as Go layout elements.
+			return ""
+		}
+		b.WriteString(format[i : i+size])
+		i += size
+	}
+	if !hasYear {
+		return ""
+	}
+	return b.String()
+}
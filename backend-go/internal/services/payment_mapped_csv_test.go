@@ -0,0 +1,103 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"smart-bill-manager/internal/models"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestParseMappedCSV_GBKWithDirectionColumn(t *testing.T) {
+	text := strings.Join([]string{
+		"随手记导出",
+		"日期;类型;金额;商家;分类;备注",
+		"2025/10/20 18:01;支出;1.234,50;滴滴出行;交通;快车",
+		"2025/10/21 09:00;收入;100,00;工资;;",
+		"2025/13/01 09:00;支出;5,00;便利店;;",
+		"2025/10/22 12:00;支出;abc;便利店;;",
+	}, "\r\n")
+	raw, err := simplifiedchinese.GBK.NewEncoder().String(text)
+	if err != nil {
+		t.Fatalf("encode gbk: %v", err)
+	}
+	profile := &models.ImportProfile{
+		Encoding:         "gbk",
+		Delimiter:        ";",
+		SkipRows:         1,
+		HasHeader:        true,
+		AmountColumn:     "金额",
+		TimeColumn:       "日期",
+		MerchantColumn:   "商家",
+		CategoryColumn:   "分类",
+		NoteColumn:       "备注",
+		DirectionColumn:  "类型",
+		ExpenseMarker:    "支出",
+		DateFormat:       "YYYY/MM/DD HH:mm",
+		Timezone:         "Asia/Shanghai",
+		DecimalSeparator: ",",
+		AmountSign:       ImportAmountSignDirection,
+	}
+
+	entries, err := parseMappedCSV(profile, []byte(raw))
+	if err != nil {
+		t.Fatalf("parseMappedCSV: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("entries=%d want 4", len(entries))
+	}
+	first := entries[0]
+	if first.Amount != "1234.5" || first.Time != "2025-10-20T10:01:00Z" || first.Merchant != "滴滴出行" || first.Category != "交通" || first.Line != 3 {
+		t.Fatalf("unexpected first entry: %#v", first)
+	}
+	if entries[1].SkipReason == "" {
+		t.Fatalf("income row should be skipped: %#v", entries[1])
+	}
+	if !strings.Contains(entries[2].InvalidReason, "time") || !strings.Contains(entries[3].InvalidReason, "amount") {
+		t.Fatalf("invalid rows should carry reasons: %#v %#v", entries[2], entries[3])
+	}
+}
+
+func TestParseMappedCSV_ColumnNumbersWithoutHeader(t *testing.T) {
+	profile := &models.ImportProfile{
+		Encoding:         "auto",
+		Delimiter:        ",",
+		AmountColumn:     "2",
+		TimeColumn:       "1",
+		MerchantColumn:   "3",
+		Timezone:         "Asia/Shanghai",
+		DecimalSeparator: ".",
+		AmountSign:       ImportAmountSignExpensePositive,
+	}
+	entries, err := parseMappedCSV(profile, []byte("2025-10-20 08:00:00,(12.00),退款\n2025-10-20 09:00:00,\"1,024.00\",商场\n"))
+	if err != nil {
+		t.Fatalf("parseMappedCSV: %v", err)
+	}
+	if len(entries) != 2 || entries[0].SkipReason == "" || entries[1].Amount != "1024" || entries[1].Merchant != "商场" {
+		t.Fatalf("unexpected entries: %#v", entries)
+	}
+
+	profile.MerchantColumn = "商户"
+	profile.HasHeader = true
+	profile.AmountColumn = "金额"
+	if _, err := parseMappedCSV(profile, []byte("时间,金额\n")); err == nil {
+		t.Fatalf("missing mapped column should fail")
+	}
+}
+
+func TestImportDateLayout(t *testing.T) {
+	cases := map[string]string{
+		"YYYY-MM-DD HH:mm:ss": "2006-01-02 15:04:05",
+		"DD.MM.YYYY":          "02.01.2006",
+		"YYYY年M月D日":           "2006年1月2日",
+		"2006/01/02":          "2006/01/02",
+		"MM/DD":               "",
+		"YYYY-MM-DD 1":        "",
+	}
+	for in, want := range cases {
+		if got := importDateLayout(in); got != want {
+			t.Fatalf("importDateLayout(%q)=%q want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/money"
+
+	"gorm.io/gorm"
+)
+
+const (
+	RefundKindFull    = "full"
+	RefundKindPartial = "partial"
+)
+
+var ErrInvalidRefund = errors.New("invalid refund")
+
+// LinkRefund marks refundID as a full or partial refund of originalID. The refund keeps its own
+// positive amount; stats and trip totals subtract it from the original. Refunds of one payment
+// may not add up to more than the payment itself.
+func (s *PaymentService) LinkRefund(ownerUserID string, refundID string, originalID string) (*models.Payment, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	refundID = strings.TrimSpace(refundID)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return s.linkRefundTx(tx, ownerUserID, refundID, originalID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.FindByIDForOwner(ownerUserID, refundID)
+}
+
+// linkRefundTx validates and stores the link inside tx, so callers can combine it with other writes.
+func (s *PaymentService) linkRefundTx(tx *gorm.DB, ownerUserID string, refundID string, originalID string) error {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	refundID = strings.TrimSpace(refundID)
+	originalID = strings.TrimSpace(originalID)
+	if refundID == "" || originalID == "" || refundID == originalID {
+		return fmt.Errorf("%w: a payment cannot refund itself", ErrInvalidRefund)
+	}
+
+	repo := s.repo.WithDB(tx)
+	refund, err := repo.FindByIDForOwner(ownerUserID, refundID)
+	if err != nil {
+		return err
+	}
+	original, err := repo.FindByIDForOwner(ownerUserID, originalID)
+	if err != nil {
+		return err
+	}
+	if original.IsDraft {
+		return fmt.Errorf("%w: original payment is a draft", ErrInvalidRefund)
+	}
+	if original.RefundOfID != nil {
+		return fmt.Errorf("%w: original payment is itself a refund", ErrInvalidRefund)
+	}
+	for _, id := range []string{refundID, originalID} {
+		hasSplits, err := paymentHasSplits(tx, ownerUserID, id)
+		if err != nil {
+			return err
+		}
+		if hasSplits {
+			return fmt.Errorf("%w: split payments cannot take part in refunds", ErrInvalidRefund)
+		}
+	}
+	if normalizeCurrencyOrDefault(refund.Currency) != normalizeCurrencyOrDefault(original.Currency) {
+		return fmt.Errorf("%w: refund currency differs from original", ErrInvalidRefund)
+	}
+
+	var refundsOfRefund int64
+	if err := tx.Model(&models.Payment{}).
+		Where("owner_user_id = ? AND refund_of_id = ?", ownerUserID, refundID).
+		Count(&refundsOfRefund).Error; err != nil {
+		return err
+	}
+	if refundsOfRefund > 0 {
+		return fmt.Errorf("%w: payment already has refunds", ErrInvalidRefund)
+	}
+
+	var refundedCents int64
+	if err := tx.Model(&models.Payment{}).
+		Where("owner_user_id = ? AND refund_of_id = ? AND id <> ?", ownerUserID, originalID, refundID).
+		Select("COALESCE(SUM(amount_cents), 0)").
+		Scan(&refundedCents).Error; err != nil {
+		return err
+	}
+	if refund.AmountCents <= 0 || refundedCents+refund.AmountCents > original.AmountCents {
+		return fmt.Errorf("%w: refunds exceed the original amount", ErrInvalidRefund)
+	}
+
+	kind := RefundKindPartial
+	if refund.AmountCents == original.AmountCents {
+		kind = RefundKindFull
+	}
+	return repo.UpdateForOwner(ownerUserID, refundID, map[string]interface{}{
+		"refund_of_id": originalID,
+		"refund_kind":  kind,
+	})
+}
+
+// revalidateRefundLinksTx re-checks the refund links of a payment whose amount or currency changed:
+// its own link when it is a refund, or each of its refunds when it is an original. linkRefundTx
+// enforces the same-currency rule and the cap again and recomputes refund_kind.
+func (s *PaymentService) revalidateRefundLinksTx(tx *gorm.DB, ownerUserID string, paymentID string) error {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	payment, err := s.repo.WithDB(tx).FindByIDForOwner(ownerUserID, paymentID)
+	if err != nil {
+		return err
+	}
+	if payment.RefundOfID != nil {
+		return s.linkRefundTx(tx, ownerUserID, payment.ID, *payment.RefundOfID)
+	}
+
+	var refundIDs []string
+	if err := tx.Model(&models.Payment{}).
+		Where("owner_user_id = ? AND refund_of_id = ?", ownerUserID, payment.ID).
+		Order("id ASC").
+		Pluck("id", &refundIDs).Error; err != nil {
+		return err
+	}
+	for _, refundID := range refundIDs {
+		if err := s.linkRefundTx(tx, ownerUserID, refundID, payment.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnlinkRefund turns a refund back into an ordinary payment.
+func (s *PaymentService) UnlinkRefund(ownerUserID string, refundID string) error {
+	return s.unlinkRefundTx(s.db, ownerUserID, refundID)
+}
+
+func (s *PaymentService) unlinkRefundTx(tx *gorm.DB, ownerUserID string, refundID string) error {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	repo := s.repo.WithDB(tx)
+	if _, err := repo.FindByIDForOwner(ownerUserID, refundID); err != nil {
+		return err
+	}
+	return repo.UpdateForOwner(ownerUserID, strings.TrimSpace(refundID), map[string]interface{}{
+		"refund_of_id": nil,
+		"refund_kind":  "",
+	})
+}
+
+// GetRefunds lists the confirmed refunds linked to a payment, oldest first.
+func (s *PaymentService) GetRefunds(ownerUserID string, paymentID string) ([]models.Payment, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	if _, err := s.repo.FindByIDForOwner(ownerUserID, paymentID); err != nil {
+		return nil, err
+	}
+	var out []models.Payment
+	err := s.db.Model(&models.Payment{}).
+		Where("owner_user_id = ? AND refund_of_id = ? AND is_draft = 0", ownerUserID, strings.TrimSpace(paymentID)).
+		Order("transaction_time_ts ASC, id ASC").
+		Find(&out).Error
+	return out, err
+}
+
+// findRefundOriginalForOwner proposes the payment a refund screenshot belongs to. The order
+// number is decisive (imported payments carry it as external_id, screenshots in their OCR
+// blob); otherwise the latest earlier payment to the same merchant that still has enough left
+// to refund is used.
+func findRefundOriginalForOwner(db *gorm.DB, ownerUserID string, excludeID string, orderNumber string, merchant string, refundCents int64, refundTs int64) (*models.Payment, string, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	base := func() *gorm.DB {
+		q := db.Model(&models.Payment{}).
+			Where("owner_user_id = ? AND is_draft = 0 AND refund_of_id IS NULL", ownerUserID)
+		if excludeID = strings.TrimSpace(excludeID); excludeID != "" {
+			q = q.Where("id <> ?", excludeID)
+		}
+		return q
+	}
+
+	if orderNumber = strings.TrimSpace(orderNumber); orderNumber != "" {
+		var byOrder []models.Payment
+		if err := base().
+			Where(`(external_id = ? OR id IN (
+				SELECT payment_id FROM payment_ocr_blobs
+				WHERE owner_user_id = ? AND extracted_data LIKE ?
+			))`, orderNumber, ownerUserID, `%"order_number":"`+orderNumber+`"%`).
+			Order("transaction_time_ts DESC").
+			Limit(1).
+			Find(&byOrder).Error; err != nil {
+			return nil, "", err
+		}
+		if len(byOrder) > 0 {
+			return &byOrder[0], "order_number", nil
+		}
+	}
+
+	if merchant = strings.TrimSpace(merchant); merchant == "" || refundCents <= 0 {
+		return nil, "", nil
+	}
+	q := base().
+		Where("merchant = ?", merchant).
+		Where(`amount_cents - COALESCE((
+			SELECT SUM(r.amount_cents) FROM payments AS r
+			WHERE r.refund_of_id = payments.id AND r.owner_user_id = payments.owner_user_id
+		), 0) >= ?`, refundCents)
+	if refundTs > 0 {
+		q = q.Where("transaction_time_ts <= ?", refundTs)
+	}
+	var byMerchant []models.Payment
+	if err := q.Order("transaction_time_ts DESC").Limit(1).Find(&byMerchant).Error; err != nil {
+		return nil, "", err
+	}
+	if len(byMerchant) > 0 {
+		return &byMerchant[0], "merchant", nil
+	}
+	return nil, "", nil
+}
+
+// proposeRefundOriginal records on a refund screenshot's extracted data which payment it most
+// likely refunds. The link itself is only made when the user confirms it.
+func (s *PaymentService) proposeRefundOriginal(db *gorm.DB, ownerUserID string, paymentID string, extracted *PaymentExtractedData) error {
+	if extracted == nil || !extracted.IsRefund {
+		return nil
+	}
+	var refundCents, refundTs int64
+	if extracted.Amount != nil {
+		if cents, err := money.FromMajor(math.Abs(*extracted.Amount)); err == nil {
+			refundCents = cents
+		}
+	}
+	if extracted.TransactionTime != nil {
+		if t, err := parseRFC3339ToUTC(*extracted.TransactionTime); err == nil {
+			refundTs = unixMilli(t)
+		}
+	}
+	original, reason, err := findRefundOriginalForOwner(db, ownerUserID, paymentID, strPtrVal(extracted.OrderNumber), strPtrVal(extracted.Merchant), refundCents, refundTs)
+	if err != nil || original == nil {
+		return err
+	}
+	id := original.ID
+	extracted.RefundOfID = &id
+	extracted.RefundOfSource = reason
+	return nil
+}
@@ -0,0 +1,160 @@
+//go:build cgo
+
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"smart-bill-manager/internal/models"
+)
+
+func TestRefundsNetAgainstOriginalPayment(t *testing.T) {
+	db := openServiceTestDB(t)
+	payments := NewPaymentService(db, t.TempDir())
+	trips := NewTripService(db, t.TempDir())
+
+	trip, _, err := trips.Create("owner-1", CreateTripInput{
+		Name:      "杭州出差",
+		StartTime: "2025-10-20T00:00:00+08:00",
+		EndTime:   "2025-10-21T00:00:00+08:00",
+	})
+	if err != nil {
+		t.Fatalf("创建行程失败: %v", err)
+	}
+	merchant, category, externalID, source := "瑞幸咖啡", "餐饮", "4200001234567890", "wechat_csv"
+	original, err := payments.Create("owner-1", CreatePaymentInput{
+		Amount:          100,
+		Merchant:        &merchant,
+		Category:        &category,
+		TransactionTime: "2025-10-20T02:00:00Z",
+		ImportSource:    &source,
+		ExternalID:      &externalID,
+	})
+	if err != nil {
+		t.Fatalf("创建原支付失败: %v", err)
+	}
+	if err := db.Model(&models.Payment{}).Where("id = ?", original.ID).Update("trip_id", trip.ID).Error; err != nil {
+		t.Fatalf("关联行程失败: %v", err)
+	}
+	// The refund arrives after the trip and carries no category of its own.
+	refund, err := payments.Create("owner-1", CreatePaymentInput{Amount: 30, Merchant: &merchant, TransactionTime: "2025-10-25T02:00:00Z"})
+	if err != nil {
+		t.Fatalf("创建退款失败: %v", err)
+	}
+
+	got, reason, err := findRefundOriginalForOwner(db, "owner-1", refund.ID, externalID, "", 0, 0)
+	if err != nil || got == nil || got.ID != original.ID || reason != "order_number" {
+		t.Fatalf("按订单号应找到原支付: %#v %q %v", got, reason, err)
+	}
+	got, reason, err = findRefundOriginalForOwner(db, "owner-1", refund.ID, "", merchant, 3000, refund.TransactionTimeTs)
+	if err != nil || got == nil || got.ID != original.ID || reason != "merchant" {
+		t.Fatalf("按商户应找到原支付: %#v %q %v", got, reason, err)
+	}
+
+	linked, err := payments.LinkRefund("owner-1", refund.ID, original.ID)
+	if err != nil {
+		t.Fatalf("关联退款失败: %v", err)
+	}
+	if linked.RefundOfID == nil || *linked.RefundOfID != original.ID || linked.RefundKind != RefundKindPartial {
+		t.Fatalf("退款关联结果异常: %#v", linked)
+	}
+
+	tooMuch, err := payments.Create("owner-1", CreatePaymentInput{Amount: 80, TransactionTime: "2025-10-26T02:00:00Z"})
+	if err != nil {
+		t.Fatalf("创建退款失败: %v", err)
+	}
+	if _, err := payments.LinkRefund("owner-1", tooMuch.ID, original.ID); !errors.Is(err, ErrInvalidRefund) {
+		t.Fatalf("退款总额超过原支付应被拒绝: %v", err)
+	}
+	renamed, originalID := "改名商户", original.ID
+	if err := payments.Update("owner-1", tooMuch.ID, UpdatePaymentInput{Merchant: &renamed, RefundOfID: &originalID}); !errors.Is(err, ErrInvalidRefund) {
+		t.Fatalf("编辑时退款总额超过原支付应被拒绝: %v", err)
+	}
+	if unchanged, err := payments.GetByID("owner-1", tooMuch.ID); err != nil || unchanged.Merchant != nil {
+		t.Fatalf("退款关联被拒绝时不应保存其他修改: %#v %v", unchanged, err)
+	}
+	if _, err := payments.LinkRefund("owner-1", original.ID, refund.ID); !errors.Is(err, ErrInvalidRefund) {
+		t.Fatalf("不能关联到退款记录: %v", err)
+	}
+
+	stats, err := payments.GetStatsCtx(context.Background(), "owner-1", "2025-10-01T00:00:00Z", "2025-10-24T00:00:00Z")
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+	if stats.TotalAmount != 70 || stats.TotalCount != 1 || stats.CategoryStats[category] != 70 || stats.DailyStats["2025-10-20"] != 70 {
+		t.Fatalf("退款应冲减原支付: %#v", stats)
+	}
+
+	summary, err := trips.GetSummaryCtx(context.Background(), "owner-1", trip.ID)
+	if err != nil {
+		t.Fatalf("行程汇总失败: %v", err)
+	}
+	if summary.TotalAmount != 70 || summary.PaymentCount != 1 {
+		t.Fatalf("行程汇总应扣除退款: %#v", summary)
+	}
+
+	if err := payments.Delete("owner-1", original.ID); err != nil {
+		t.Fatalf("删除原支付失败: %v", err)
+	}
+	after, err := payments.GetByID("owner-1", refund.ID)
+	if err != nil {
+		t.Fatalf("读取退款失败: %v", err)
+	}
+	if after.RefundOfID != nil || after.RefundKind != "" {
+		t.Fatalf("删除原支付后退款应解除关联: %#v", after)
+	}
+}
+
+func TestUpdateRevalidatesRefundLinks(t *testing.T) {
+	db := openServiceTestDB(t)
+	payments := NewPaymentService(db, t.TempDir())
+
+	original, err := payments.Create("owner-1", CreatePaymentInput{Amount: 100, TransactionTime: "2025-10-20T02:00:00Z"})
+	if err != nil {
+		t.Fatalf("创建原支付失败: %v", err)
+	}
+	refund, err := payments.Create("owner-1", CreatePaymentInput{Amount: 40, TransactionTime: "2025-10-21T02:00:00Z"})
+	if err != nil {
+		t.Fatalf("创建退款失败: %v", err)
+	}
+	if _, err := payments.LinkRefund("owner-1", refund.ID, original.ID); err != nil {
+		t.Fatalf("关联退款失败: %v", err)
+	}
+
+	// Refund side: raising the amount past the original or changing the currency is rejected.
+	tooMuch, usd := 120.0, "USD"
+	if err := payments.Update("owner-1", refund.ID, UpdatePaymentInput{Amount: &tooMuch}); !errors.Is(err, ErrInvalidRefund) {
+		t.Fatalf("退款金额超过原支付应被拒绝: %v", err)
+	}
+	if err := payments.Update("owner-1", refund.ID, UpdatePaymentInput{Currency: &usd}); !errors.Is(err, ErrInvalidRefund) {
+		t.Fatalf("退款币种与原支付不同应被拒绝: %v", err)
+	}
+	full := 100.0
+	if err := payments.Update("owner-1", refund.ID, UpdatePaymentInput{Amount: &full}); err != nil {
+		t.Fatalf("修改退款金额失败: %v", err)
+	}
+	if got, err := payments.GetByID("owner-1", refund.ID); err != nil || got.RefundKind != RefundKindFull {
+		t.Fatalf("退款金额等于原支付时应为全额退款: %#v %v", got, err)
+	}
+
+	// Original side: lowering below the refunds or changing the currency is rejected.
+	lower := 50.0
+	if err := payments.Update("owner-1", original.ID, UpdatePaymentInput{Amount: &lower}); !errors.Is(err, ErrInvalidRefund) {
+		t.Fatalf("原支付金额低于退款总额应被拒绝: %v", err)
+	}
+	if err := payments.Update("owner-1", original.ID, UpdatePaymentInput{Currency: &usd}); !errors.Is(err, ErrInvalidRefund) {
+		t.Fatalf("原支付币种与退款不同应被拒绝: %v", err)
+	}
+	if got, err := payments.GetByID("owner-1", original.ID); err != nil || got.AmountCents != 10000 || normalizeCurrencyOrDefault(got.Currency) != "CNY" {
+		t.Fatalf("被拒绝的修改不应保存: %#v %v", got, err)
+	}
+	higher := 150.0
+	if err := payments.Update("owner-1", original.ID, UpdatePaymentInput{Amount: &higher}); err != nil {
+		t.Fatalf("提高原支付金额失败: %v", err)
+	}
+	if got, err := payments.GetByID("owner-1", refund.ID); err != nil || got.RefundKind != RefundKindPartial {
+		t.Fatalf("原支付金额提高后应改为部分退款: %#v %v", got, err)
+	}
+}
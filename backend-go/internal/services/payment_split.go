@@ -0,0 +1,170 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/money"
+	"smart-bill-manager/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidPaymentSplit = errors.New("invalid payment split")
+
+// PaymentSplitInput describes one allocation of a payment. With no TripAssignSrc a TripID
+// means manual and no TripID means the allocation follows the payment's trip.
+type PaymentSplitInput struct {
+	Amount        float64 `json:"amount"`
+	Category      *string `json:"category"`
+	TripID        *string `json:"trip_id"`
+	TripAssignSrc string  `json:"trip_assignment_source"`
+	Note          *string `json:"note"`
+}
+
+// GetSplits lists a payment's allocations in the order they were given.
+func (s *PaymentService) GetSplits(ownerUserID string, paymentID string) ([]models.PaymentSplit, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	paymentID = strings.TrimSpace(paymentID)
+	if _, err := s.repo.FindByIDForOwner(ownerUserID, paymentID); err != nil {
+		return nil, err
+	}
+	out := make([]models.PaymentSplit, 0)
+	err := s.db.Model(&models.PaymentSplit{}).
+		Where("owner_user_id = ? AND payment_id = ?", ownerUserID, paymentID).
+		Order("sort_order ASC").
+		Find(&out).Error
+	return out, err
+}
+
+// SetSplits replaces a payment's allocations. Either no splits (the payment counts as a whole)
+// or at least two whose amounts add up exactly to the payment amount.
+func (s *PaymentService) SetSplits(ownerUserID string, paymentID string, inputs []PaymentSplitInput) ([]models.PaymentSplit, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	paymentID = strings.TrimSpace(paymentID)
+	if len(inputs) == 1 {
+		return nil, fmt.Errorf("%w: a split needs at least two parts", ErrInvalidPaymentSplit)
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		payment, err := s.repo.WithDB(tx).FindByIDForOwner(ownerUserID, paymentID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("owner_user_id = ? AND payment_id = ?", ownerUserID, paymentID).
+			Delete(&models.PaymentSplit{}).Error; err != nil {
+			return err
+		}
+		if len(inputs) == 0 {
+			return nil
+		}
+		if payment.RefundOfID != nil {
+			return fmt.Errorf("%w: refunds cannot be split", ErrInvalidPaymentSplit)
+		}
+		var refunds int64
+		if err := tx.Model(&models.Payment{}).
+			Where("owner_user_id = ? AND refund_of_id = ?", ownerUserID, paymentID).
+			Count(&refunds).Error; err != nil {
+			return err
+		}
+		if refunds > 0 {
+			return fmt.Errorf("%w: payment has refunds", ErrInvalidPaymentSplit)
+		}
+
+		splits := make([]models.PaymentSplit, 0, len(inputs))
+		var total int64
+		for i, in := range inputs {
+			cents, err := money.FromMajor(in.Amount)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidPaymentSplit, err)
+			}
+			if cents <= 0 {
+				return fmt.Errorf("%w: split amounts must be positive", ErrInvalidPaymentSplit)
+			}
+			total += cents
+
+			tripID := ""
+			if in.TripID != nil {
+				tripID = strings.TrimSpace(*in.TripID)
+			}
+			src := strings.TrimSpace(in.TripAssignSrc)
+			if src == "" {
+				src = assignSrcAuto
+				if tripID != "" {
+					src = assignSrcManual
+				}
+			}
+			split := models.PaymentSplit{
+				ID:            utils.GenerateUUID(),
+				OwnerUserID:   ownerUserID,
+				PaymentID:     paymentID,
+				AmountCents:   cents,
+				Category:      trimmedOrNil(in.Category),
+				TripAssignSrc: src,
+				Note:          trimmedOrNil(in.Note),
+				SortOrder:     i,
+			}
+			switch src {
+			case assignSrcAuto:
+				split.TripID = payment.TripID
+			case assignSrcManual:
+				if tripID != "" {
+					var trips int64
+					if err := tx.Model(&models.Trip{}).
+						Where("id = ? AND owner_user_id = ?", tripID, ownerUserID).
+						Count(&trips).Error; err != nil {
+						return err
+					}
+					if trips == 0 {
+						return fmt.Errorf("%w: trip not found", ErrInvalidPaymentSplit)
+					}
+					split.TripID = &tripID
+				}
+			case assignSrcBlocked:
+			default:
+				return fmt.Errorf("%w: invalid trip_assignment_source", ErrInvalidPaymentSplit)
+			}
+			splits = append(splits, split)
+		}
+		if total != payment.AmountCents {
+			return fmt.Errorf("%w: splits add up to %.2f, payment is %.2f", ErrInvalidPaymentSplit, money.ToMajor(total), money.ToMajor(payment.AmountCents))
+		}
+		return tx.Create(&splits).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSplits(ownerUserID, paymentID)
+}
+
+// syncAutoSplitTripsTx points auto-assigned splits at their payment's current trip. An empty
+// paymentIDs syncs every payment of the owner.
+func syncAutoSplitTripsTx(tx *gorm.DB, ownerUserID string, paymentIDs []string) error {
+	q := tx.Model(&models.PaymentSplit{}).
+		Where("owner_user_id = ? AND trip_assignment_source = ?", strings.TrimSpace(ownerUserID), assignSrcAuto)
+	if len(paymentIDs) > 0 {
+		q = q.Where("payment_id IN ?", paymentIDs)
+	}
+	return q.Update("trip_id", gorm.Expr("(SELECT p.trip_id FROM payments AS p WHERE p.id = payment_splits.payment_id)")).Error
+}
+
+func paymentHasSplits(db *gorm.DB, ownerUserID string, paymentID string) (bool, error) {
+	var n int64
+	err := db.Model(&models.PaymentSplit{}).
+		Where("owner_user_id = ? AND payment_id = ?", strings.TrimSpace(ownerUserID), strings.TrimSpace(paymentID)).
+		Count(&n).Error
+	return n > 0, err
+}
+
+func trimmedOrNil(v *string) *string {
+	if v == nil {
+		return nil
+	}
+	t := strings.TrimSpace(*v)
+	if t == "" {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,123 @@
+//go:build cgo
+
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPaymentSplitsAllocateCategoriesAndTrips(t *testing.T) {
+	db := openServiceTestDB(t)
+	payments := NewPaymentService(db, t.TempDir())
+	trips := NewTripService(db, t.TempDir())
+
+	shanghai, _, err := trips.Create("owner-1", CreateTripInput{
+		Name:      "上海出差",
+		StartTime: "2025-11-03T00:00:00+08:00",
+		EndTime:   "2025-11-05T00:00:00+08:00",
+	})
+	if err != nil {
+		t.Fatalf("创建行程失败: %v", err)
+	}
+	beijing, _, err := trips.Create("owner-1", CreateTripInput{
+		Name:      "北京出差",
+		StartTime: "2025-11-10T00:00:00+08:00",
+		EndTime:   "2025-11-12T00:00:00+08:00",
+	})
+	if err != nil {
+		t.Fatalf("创建行程失败: %v", err)
+	}
+
+	category := "餐饮"
+	payment, err := payments.Create("owner-1", CreatePaymentInput{
+		Amount:          100,
+		Category:        &category,
+		TransactionTime: "2025-11-03T04:00:00Z",
+	})
+	if err != nil {
+		t.Fatalf("创建支付失败: %v", err)
+	}
+	if payment, err = payments.GetByID("owner-1", payment.ID); err != nil || payment.TripID == nil || *payment.TripID != shanghai.ID {
+		t.Fatalf("支付应自动归入上海行程: %#v %v", payment, err)
+	}
+
+	transport := "交通"
+	if _, err := payments.SetSplits("owner-1", payment.ID, []PaymentSplitInput{
+		{Amount: 60, Category: &transport},
+		{Amount: 30, TripID: &beijing.ID},
+	}); !errors.Is(err, ErrInvalidPaymentSplit) {
+		t.Fatalf("拆分合计不等于支付金额应被拒绝: %v", err)
+	}
+	splits, err := payments.SetSplits("owner-1", payment.ID, []PaymentSplitInput{
+		{Amount: 60, Category: &transport},
+		{Amount: 40, TripID: &beijing.ID},
+	})
+	if err != nil {
+		t.Fatalf("保存拆分失败: %v", err)
+	}
+	if len(splits) != 2 || splits[0].TripID == nil || *splits[0].TripID != shanghai.ID || splits[1].TripAssignSrc != assignSrcManual {
+		t.Fatalf("拆分结果异常: %#v", splits)
+	}
+
+	stats, err := payments.GetStatsCtx(context.Background(), "owner-1", "", "")
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+	if stats.TotalAmount != 100 || stats.TotalCount != 1 || stats.CategoryStats[transport] != 60 || stats.CategoryStats[category] != 40 {
+		t.Fatalf("分类统计应按拆分金额: %#v", stats)
+	}
+
+	summaries, err := trips.GetAllSummaries("owner-1")
+	if err != nil {
+		t.Fatalf("获取行程汇总失败: %v", err)
+	}
+	byTrip := make(map[string]TripSummary, len(summaries))
+	for _, s := range summaries {
+		byTrip[s.TripID] = s
+	}
+	if got := byTrip[shanghai.ID]; got.TotalAmount != 60 || got.PaymentCount != 1 {
+		t.Fatalf("上海行程应只计拆分部分: %#v", got)
+	}
+	if got := byTrip[beijing.ID]; got.TotalAmount != 40 || got.PaymentCount != 1 || got.UnlinkedPays != 1 {
+		t.Fatalf("北京行程应计手动拆分部分: %#v", got)
+	}
+
+	tripPayments, err := trips.GetPayments("owner-1", beijing.ID, false)
+	if err != nil || len(tripPayments) != 1 || tripPayments[0].ID != payment.ID {
+		t.Fatalf("北京行程应列出拆分到该行程的支付: %#v %v", tripPayments, err)
+	}
+
+	amount := 120.0
+	if err := payments.Update("owner-1", payment.ID, UpdatePaymentInput{Amount: &amount}); !errors.Is(err, ErrInvalidPaymentSplit) {
+		t.Fatalf("有拆分时修改金额应被拒绝: %v", err)
+	}
+
+	// Moving the payment out of its trip takes the auto split along; the manual one stays.
+	moved := "2025-11-20T04:00:00Z"
+	if err := payments.Update("owner-1", payment.ID, UpdatePaymentInput{TransactionTime: &moved}); err != nil {
+		t.Fatalf("更新支付时间失败: %v", err)
+	}
+	shanghaiSummary, err := trips.GetSummary("owner-1", shanghai.ID)
+	if err != nil {
+		t.Fatalf("获取行程汇总失败: %v", err)
+	}
+	if shanghaiSummary.PaymentCount != 0 || shanghaiSummary.TotalAmount != 0 {
+		t.Fatalf("自动拆分应跟随支付离开行程: %#v", shanghaiSummary)
+	}
+	beijingSummary, err := trips.GetSummary("owner-1", beijing.ID)
+	if err != nil {
+		t.Fatalf("获取行程汇总失败: %v", err)
+	}
+	if beijingSummary.PaymentCount != 1 || beijingSummary.TotalAmount != 40 {
+		t.Fatalf("手动拆分应保留在北京行程: %#v", beijingSummary)
+	}
+
+	if _, err := payments.SetSplits("owner-1", payment.ID, nil); err != nil {
+		t.Fatalf("清除拆分失败: %v", err)
+	}
+	if beijingSummary, err = trips.GetSummary("owner-1", beijing.ID); err != nil || beijingSummary.PaymentCount != 0 {
+		t.Fatalf("清除拆分后北京行程不应再计入: %#v %v", beijingSummary, err)
+	}
+}
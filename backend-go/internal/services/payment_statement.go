@@ -0,0 +1,521 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	StatementSourceOFX     = "ofx"
+	StatementSourceQIF     = "qif"
+	StatementSourceCAMT053 = "camt053"
+)
+
+var ErrUnsupportedStatement = errors.New("unsupported bank statement format")
+
+// ImportStatement parses an OFX/QFX, QIF or CAMT.053 bank statement. Debits become payments keyed
+// by the bank's transaction ID (FITID, QIF check number or CAMT reference), so importing the same
+// statement twice is a no-op. Without commit the result is a preview and nothing is written.
+func (s *PaymentService) ImportStatement(ownerUserID string, filename string, raw []byte, commit bool) (*PaymentImportResult, error) {
+	text, err := decodeImportText(raw)
+	if err != nil {
+		return nil, err
+	}
+	source := detectStatementFormat(filename, text)
+
+	var entries []paymentImportEntry
+	switch source {
+	case StatementSourceOFX:
+		entries, err = parseOFXStatement(text)
+	case StatementSourceQIF:
+		entries, err = parseQIFStatement(text)
+	case StatementSourceCAMT053:
+		entries, err = parseCAMT053Statement(text)
+	default:
+		return nil, ErrUnsupportedStatement
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.importPaymentEntries(ownerUserID, source, entries, commit)
+}
+
+// detectStatementFormat sniffs the content first and only falls back to the file extension,
+// since banks commonly serve OFX as .txt and CAMT as .xml or .053.
+func detectStatementFormat(filename string, text string) string {
+	head := strings.TrimSpace(text)
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	switch {
+	case strings.Contains(head, "OFXHEADER"), strings.Contains(strings.ToUpper(head), "<OFX>"):
+		return StatementSourceOFX
+	case strings.Contains(head, "BkToCstmrStmt"):
+		return StatementSourceCAMT053
+	case strings.HasPrefix(head, "!Type:"), strings.HasPrefix(head, "!Account"), strings.HasPrefix(head, "!Option"):
+		return StatementSourceQIF
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ofx", ".qfx":
+		return StatementSourceOFX
+	case ".qif":
+		return StatementSourceQIF
+	}
+	return ""
+}
+
+// statementAmount normalizes a signed statement amount. Some European exports use a decimal
+// comma; a lone comma is treated as the decimal separator, otherwise commas are thousands.
+func statementAmount(s string) (float64, bool) {
+	s = strings.TrimSpace(strings.ReplaceAll(s, " ", ""))
+	if strings.Contains(s, ",") && !strings.Contains(s, ".") && strings.Count(s, ",") == 1 {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	s = strings.ReplaceAll(s, ",", "")
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// statementEntry fills the parts shared by all formats. Credits are kept with a skip reason so
+// the preview shows every line of the statement.
+func statementEntry(line int, when string, rawAmount string, currency string) paymentImportEntry {
+	entry := paymentImportEntry{Line: line, Time: when, Amount: rawAmount, Currency: currency}
+	amount, ok := statementAmount(rawAmount)
+	if !ok {
+		// Left as-is so importPaymentEntries reports it as invalid.
+		return entry
+	}
+	if amount >= 0 {
+		entry.SkipReason = "not a debit"
+	}
+	entry.Amount = strconv.FormatFloat(-amount, 'f', -1, 64)
+	return entry
+}
+
+// syntheticStatementID derives a stable transaction ID for rows without one (plain QIF, sloppy OFX).
+// The occurrence counter keeps identical same-day transactions apart.
+func syntheticStatementID(occurrence int, key string) string {
+	sum := sha256.Sum256([]byte(key + "|" + strconv.Itoa(occurrence)))
+	return "sha256:" + hex.EncodeToString(sum[:12])
+}
+
+var (
+	ofxTransactionRe = regexp.MustCompile(`(?is)<STMTTRN>(.*?)</STMTTRN>`)
+	ofxFieldRe       = regexp.MustCompile(`(?i)<([A-Z0-9.]+)>([^<\r\n]*)`)
+	ofxCurrencyRe    = regexp.MustCompile(`(?i)<CURDEF>([^<\r\n]*)`)
+	ofxDateRe        = regexp.MustCompile(`^(\d{8})(\d{6})?(?:\.\d+)?(?:\[([+-]?\d+(?:\.\d+)?)(?::[^\]]*)?\])?$`)
+)
+
+// parseOFXStatement handles both OFX 1.x (SGML, leaf tags unclosed) and OFX 2.x (XML).
+// Aggregates such as STMTTRN are closed in both, so a regexp over blocks is sufficient.
+func parseOFXStatement(text string) ([]paymentImportEntry, error) {
+	currency := ""
+	if m := ofxCurrencyRe.FindStringSubmatch(text); m != nil {
+		currency = strings.TrimSpace(m[1])
+	}
+
+	matches := ofxTransactionRe.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return nil, ErrUnsupportedStatement
+	}
+	out := make([]paymentImportEntry, 0, len(matches))
+	occurrences := map[string]int{}
+	for _, m := range matches {
+		block := text[m[2]:m[3]]
+		fields := map[string]string{}
+		for _, f := range ofxFieldRe.FindAllStringSubmatch(block, -1) {
+			key := strings.ToUpper(f[1])
+			if _, ok := fields[key]; !ok {
+				fields[key] = strings.TrimSpace(f[2])
+			}
+		}
+
+		posted := fields["DTPOSTED"]
+		if posted == "" {
+			posted = fields["DTUSER"]
+		}
+		line := strings.Count(text[:m[0]], "\n") + 1
+		entry := statementEntry(line, ofxDateToTime(posted), fields["TRNAMT"], currency)
+		entry.DateOnly = ofxDateOnly(posted)
+		entry.Merchant = fields["NAME"]
+		entry.Description = fields["MEMO"]
+		entry.OrderNumber = fields["CHECKNUM"]
+		entry.ExternalID = fields["FITID"]
+		if entry.ExternalID == "" {
+			key := strings.Join([]string{posted, fields["TRNAMT"], entry.Merchant, entry.Description}, "|")
+			entry.ExternalID = syntheticStatementID(occurrences[key], key)
+			occurrences[key]++
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+// ofxDateOnly reports whether an OFX date carries no clock time.
+func ofxDateOnly(s string) bool {
+	m := ofxDateRe.FindStringSubmatch(strings.TrimSpace(s))
+	return m != nil && m[2] == ""
+}
+
+// ofxDateToTime converts YYYYMMDD[HHMMSS[.XXX]][[gmt offset[:tz name]]] to a string accepted by
+// parsePaymentTimeToUTC. Without an offset the value is left local (Asia/Shanghai).
+func ofxDateToTime(s string) string {
+	m := ofxDateRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return s
+	}
+	clock := m[2]
+	if clock == "" {
+		if m[3] == "" {
+			// Date only: left without a clock so the importer matches duplicates over the whole day.
+			return fmt.Sprintf("%s-%s-%s", m[1][:4], m[1][4:6], m[1][6:8])
+		}
+		clock = "000000"
+	}
+	local := fmt.Sprintf("%s-%s-%s %s:%s:%s", m[1][:4], m[1][4:6], m[1][6:8], clock[:2], clock[2:4], clock[4:6])
+	if m[3] == "" {
+		return local
+	}
+	hours, err := strconv.ParseFloat(m[3], 64)
+	if err != nil {
+		return local
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", local, time.FixedZone("", int(hours*3600)))
+	if err != nil {
+		return local
+	}
+	return t.Format(time.RFC3339)
+}
+
+// parseQIFStatement reads Quicken interchange records (one field per line, "^" terminates a record).
+func parseQIFStatement(text string) ([]paymentImportEntry, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+
+	var out []paymentImportEntry
+	occurrences := map[string]int{}
+	fields := map[byte]string{}
+	start := 0
+	inTransactions := true
+	flush := func() {
+		defer func() { fields = map[byte]string{} }()
+		if !inTransactions || (fields['D'] == "" && fields['T'] == "" && fields['U'] == "") {
+			return
+		}
+		amount := fields['T']
+		if amount == "" {
+			amount = fields['U']
+		}
+		entry := statementEntry(start, qifDateToTime(fields['D']), amount, "")
+		entry.DateOnly = true
+		entry.Merchant = fields['P']
+		entry.Description = fields['M']
+		entry.OrderNumber = fields['N']
+		if category := fields['L']; category != "" && !strings.HasPrefix(category, "[") {
+			// "[Account]" marks a transfer target, not a category.
+			entry.Category = category
+		}
+		// N is a check number or a generic marker such as "ATM"/"DEP" that repeats across
+		// transactions, so it only feeds the synthetic ID together with the other fields.
+		key := strings.Join([]string{fields['D'], amount, fields['P'], fields['M'], fields['N']}, "|")
+		entry.ExternalID = syntheticStatementID(occurrences[key], key)
+		occurrences[key]++
+		out = append(out, entry)
+	}
+
+	for i, raw := range lines {
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "!") {
+			header := strings.ToLower(line)
+			if strings.HasPrefix(header, "!account") {
+				// Account list records share the N/T/^ syntax but are not transactions.
+				inTransactions = false
+			}
+			if strings.HasPrefix(header, "!type:") {
+				kind := strings.TrimSpace(strings.TrimPrefix(header, "!type:"))
+				inTransactions = kind == "bank" || kind == "cash" || kind == "ccard" || kind == "oth a" || kind == "oth l"
+			}
+			continue
+		}
+		if line == "^" {
+			flush()
+			continue
+		}
+		if len(fields) == 0 {
+			start = i + 1
+		}
+		code := line[0]
+		if _, ok := fields[code]; !ok {
+			fields[code] = strings.TrimSpace(line[1:])
+		}
+	}
+	flush()
+
+	if len(out) == 0 {
+		return nil, ErrUnsupportedStatement
+	}
+	return out, nil
+}
+
+var qifDateRe = regexp.MustCompile(`^(\d{1,4})[/.\-](\d{1,2})[/.\-'](\d{1,4})$`)
+
+// qifDateToTime accepts YYYY-MM-DD, MM/DD/YYYY, DD.MM.YYYY and Quicken's MM/DD'YY.
+// Slash dates are read US-style unless the first part cannot be a month.
+func qifDateToTime(s string) string {
+	s = strings.ReplaceAll(strings.TrimSpace(s), " ", "")
+	m := qifDateRe.FindStringSubmatch(s)
+	if m == nil {
+		return s
+	}
+	a, _ := strconv.Atoi(m[1])
+	b, _ := strconv.Atoi(m[2])
+	c, _ := strconv.Atoi(m[3])
+
+	var year, month, day int
+	switch {
+	case len(m[1]) == 4:
+		year, month, day = a, b, c
+	case strings.Contains(s, "."), a > 12:
+		day, month, year = a, b, c
+	default:
+		month, day, year = a, b, c
+	}
+	if year < 100 {
+		year += 2000
+	}
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return s
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", year, month, day)
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+// DateOnly reports whether the bank gave only the day (Dt) and no DtTm.
+func (d camtDate) DateOnly() bool {
+	return strings.TrimSpace(d.DateTime) == "" && strings.TrimSpace(d.Date) != ""
+}
+
+func (d camtDate) String() string {
+	v := strings.TrimSpace(d.DateTime)
+	if v == "" {
+		return strings.TrimSpace(d.Date)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return v
+	}
+	// ISODateTime without offset is local bank time.
+	if i := strings.Index(v, "."); i > 0 {
+		v = v[:i]
+	}
+	return strings.Replace(v, "T", " ", 1)
+}
+
+// camtStatus covers both the .02 layout (<Sts>BOOK</Sts>) and .08+ (<Sts><Cd>BOOK</Cd></Sts>).
+type camtStatus struct {
+	Text string `xml:",chardata"`
+	Code string `xml:"Cd"`
+}
+
+func (s camtStatus) String() string {
+	if v := strings.TrimSpace(s.Code); v != "" {
+		return strings.ToUpper(v)
+	}
+	return strings.ToUpper(strings.TrimSpace(s.Text))
+}
+
+// camtParty covers both the .02 layout (Cdtr/Nm) and .08+ (Cdtr/Pty/Nm).
+type camtParty struct {
+	Name      string `xml:"Nm"`
+	PartyName string `xml:"Pty>Nm"`
+}
+
+func (p camtParty) String() string {
+	if v := strings.TrimSpace(p.Name); v != "" {
+		return v
+	}
+	return strings.TrimSpace(p.PartyName)
+}
+
+type camtTxDetails struct {
+	AcctSvcrRef   string     `xml:"Refs>AcctSvcrRef"`
+	TxID          string     `xml:"Refs>TxId"`
+	EndToEndID    string     `xml:"Refs>EndToEndId"`
+	Amount        camtAmount `xml:"Amt"`
+	TxAmount      camtAmount `xml:"AmtDtls>TxAmt>Amt"`
+	Creditor      camtParty  `xml:"RltdPties>Cdtr"`
+	Debtor        camtParty  `xml:"RltdPties>Dbtr"`
+	Unstructured  []string   `xml:"RmtInf>Ustrd"`
+	AddtlInfo     string     `xml:"AddtlTxInf"`
+	CreditDebitID string     `xml:"CdtDbtInd"`
+}
+
+func (d camtTxDetails) amount() camtAmount {
+	if strings.TrimSpace(d.Amount.Value) != "" {
+		return d.Amount
+	}
+	return d.TxAmount
+}
+
+func (d camtTxDetails) reference() string {
+	for _, v := range []string{d.AcctSvcrRef, d.TxID, d.EndToEndID} {
+		if v = strings.TrimSpace(v); v != "" && !strings.EqualFold(v, "NOTPROVIDED") {
+			return v
+		}
+	}
+	return ""
+}
+
+type camtEntry struct {
+	Reference    string          `xml:"NtryRef"`
+	Amount       camtAmount      `xml:"Amt"`
+	CreditDebit  string          `xml:"CdtDbtInd"`
+	Reversal     bool            `xml:"RvslInd"`
+	Status       camtStatus      `xml:"Sts"`
+	BookingDate  camtDate        `xml:"BookgDt"`
+	ValueDate    camtDate        `xml:"ValDt"`
+	AcctSvcrRef  string          `xml:"AcctSvcrRef"`
+	AddtlInfo    string          `xml:"AddtlNtryInf"`
+	Transactions []camtTxDetails `xml:"NtryDtls>TxDtls"`
+}
+
+// parseCAMT053Statement streams <Ntry> elements so each entry keeps its line number. Batch
+// bookings whose TxDtls carry individual amounts are split into one payment per transaction.
+func parseCAMT053Statement(text string) ([]paymentImportEntry, error) {
+	decoder := xml.NewDecoder(strings.NewReader(text))
+	// Input is already UTF-8 (decodeImportText); ignore the declared charset.
+	decoder.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+
+	var out []paymentImportEntry
+	occurrences := map[string]int{}
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read camt.053: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "Ntry" {
+			continue
+		}
+		line, _ := decoder.InputPos()
+		var entry camtEntry
+		if err := decoder.DecodeElement(&entry, &start); err != nil {
+			return nil, fmt.Errorf("read camt.053 entry at line %d: %w", line, err)
+		}
+		out = append(out, camtEntryToImport(line, entry, occurrences)...)
+	}
+	if len(out) == 0 {
+		return nil, ErrUnsupportedStatement
+	}
+	return out, nil
+}
+
+func camtEntryToImport(line int, entry camtEntry, occurrences map[string]int) []paymentImportEntry {
+	when, dateOnly := entry.BookingDate.String(), entry.BookingDate.DateOnly()
+	if when == "" {
+		when, dateOnly = entry.ValueDate.String(), entry.ValueDate.DateOnly()
+	}
+	entryRef := strings.TrimSpace(entry.AcctSvcrRef)
+	if entryRef == "" {
+		entryRef = strings.TrimSpace(entry.Reference)
+	}
+
+	split := len(entry.Transactions) > 1
+	for _, tx := range entry.Transactions {
+		if strings.TrimSpace(tx.amount().Value) == "" {
+			split = false
+			break
+		}
+	}
+
+	build := func(amount camtAmount, creditDebit string, tx camtTxDetails, externalID string) paymentImportEntry {
+		signed := strings.TrimSpace(amount.Value)
+		if strings.EqualFold(strings.TrimSpace(creditDebit), "DBIT") {
+			signed = "-" + signed
+		}
+		item := statementEntry(line, when, signed, amount.Currency)
+		item.DateOnly = dateOnly
+		status := entry.Status.String()
+		switch {
+		case entry.Reversal:
+			item.SkipReason = "reversal"
+		case status != "" && status != "BOOK":
+			item.SkipReason = "entry status " + status
+		}
+		if strings.EqualFold(strings.TrimSpace(creditDebit), "DBIT") {
+			item.Merchant = tx.Creditor.String()
+		} else {
+			item.Merchant = tx.Debtor.String()
+		}
+		item.Description = strings.TrimSpace(strings.Join(tx.Unstructured, " "))
+		if item.Description == "" {
+			item.Description = strings.TrimSpace(tx.AddtlInfo)
+		}
+		if item.Description == "" {
+			item.Description = strings.TrimSpace(entry.AddtlInfo)
+		}
+		item.OrderNumber = strings.TrimSpace(tx.EndToEndID)
+		if strings.EqualFold(item.OrderNumber, "NOTPROVIDED") {
+			item.OrderNumber = ""
+		}
+		item.ExternalID = externalID
+		if item.ExternalID == "" {
+			key := strings.Join([]string{when, signed, item.Merchant, item.Description}, "|")
+			item.ExternalID = syntheticStatementID(occurrences[key], key)
+			occurrences[key]++
+		}
+		return item
+	}
+
+	if !split {
+		var tx camtTxDetails
+		if len(entry.Transactions) > 0 {
+			tx = entry.Transactions[0]
+		}
+		ref := entryRef
+		if ref == "" {
+			ref = tx.reference()
+		}
+		return []paymentImportEntry{build(entry.Amount, entry.CreditDebit, tx, ref)}
+	}
+
+	out := make([]paymentImportEntry, 0, len(entry.Transactions))
+	for i, tx := range entry.Transactions {
+		creditDebit := tx.CreditDebitID
+		if creditDebit == "" {
+			creditDebit = entry.CreditDebit
+		}
+		ref := tx.reference()
+		if ref == "" && entryRef != "" {
+			ref = fmt.Sprintf("%s#%d", entryRef, i+1)
+		}
+		out = append(out, build(tx.amount(), creditDebit, tx, ref))
+	}
+	return out
+}
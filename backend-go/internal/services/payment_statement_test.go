@@ -0,0 +1,188 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+const testOFXStatement = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+ENCODING:USASCII
+CHARSET:1252
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>CNY
+<BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20251020100100.000[+8:CST]
+<TRNAMT>-25.60
+<FITID>FIT-001
+<NAME>滴滴出行
+<MEMO>快车
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20251021
+<TRNAMT>1000.00
+<FITID>FIT-002
+<NAME>工资
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+func TestParseOFXStatement_SGML(t *testing.T) {
+	if got := detectStatementFormat("statement.txt", testOFXStatement); got != StatementSourceOFX {
+		t.Fatalf("format=%q", got)
+	}
+	entries, err := parseOFXStatement(testOFXStatement)
+	if err != nil {
+		t.Fatalf("parseOFXStatement: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries=%d want 2", len(entries))
+	}
+	debit := entries[0]
+	if debit.ExternalID != "FIT-001" || debit.Amount != "25.6" || debit.Merchant != "滴滴出行" || debit.SkipReason != "" {
+		t.Fatalf("unexpected debit: %#v", debit)
+	}
+	if debit.Time != "2025-10-20T10:01:00+08:00" || debit.Line != 11 {
+		t.Fatalf("unexpected debit time/line: %q line=%d", debit.Time, debit.Line)
+	}
+	if entries[1].SkipReason == "" {
+		t.Fatalf("credit should be skipped: %#v", entries[1])
+	}
+}
+
+func TestParseQIFStatement(t *testing.T) {
+	qif := strings.Join([]string{
+		"!Type:Bank",
+		"D10/20'25",
+		"T-25.60",
+		"P滴滴出行",
+		"L交通",
+		"^",
+		"D2025-10-21",
+		"T-6.00",
+		"P便利店",
+		"^",
+		"D2025-10-21",
+		"T-6.00",
+		"P便利店",
+		"^",
+		"D21/10/2025",
+		"T-1,200.00",
+		"N1024",
+		"L[储蓄卡]",
+		"^",
+		"D2025-10-22",
+		"T-50.00",
+		"NATM",
+		"^",
+		"D2025-10-23",
+		"T-80.00",
+		"NATM",
+		"^",
+	}, "\r\n")
+	if got := detectStatementFormat("x.bin", qif); got != StatementSourceQIF {
+		t.Fatalf("format=%q", got)
+	}
+	entries, err := parseQIFStatement(qif)
+	if err != nil {
+		t.Fatalf("parseQIFStatement: %v", err)
+	}
+	if len(entries) != 6 {
+		t.Fatalf("entries=%d want 6", len(entries))
+	}
+	if entries[0].Time != "2025-10-20" || entries[0].Amount != "25.6" || entries[0].Category != "交通" || entries[0].Line != 2 {
+		t.Fatalf("unexpected first entry: %#v", entries[0])
+	}
+	if entries[1].ExternalID == "" || entries[1].ExternalID == entries[2].ExternalID {
+		t.Fatalf("identical rows need distinct synthetic IDs: %q %q", entries[1].ExternalID, entries[2].ExternalID)
+	}
+	again, _ := parseQIFStatement(qif)
+	if again[1].ExternalID != entries[1].ExternalID {
+		t.Fatalf("synthetic IDs must be stable across imports")
+	}
+	check := entries[3]
+	if check.Time != "2025-10-21" || check.Amount != "1200" || check.OrderNumber != "1024" || check.ExternalID == "1024" || check.Category != "" {
+		t.Fatalf("unexpected check entry: %#v", check)
+	}
+	// A repeated N such as "ATM" must not collapse distinct transactions.
+	if entries[4].OrderNumber != "ATM" || entries[4].ExternalID == entries[5].ExternalID {
+		t.Fatalf("rows sharing N need distinct IDs: %#v %#v", entries[4], entries[5])
+	}
+}
+
+func TestParseCAMT053Statement(t *testing.T) {
+	xmlText := `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+  <BkToCstmrStmt>
+    <Stmt>
+      <Id>STMT-1</Id>
+      <Ntry>
+        <Amt Ccy="CNY">25.60</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt><DtTm>2025-10-20T18:01:00</DtTm></BookgDt>
+        <AcctSvcrRef>REF-1</AcctSvcrRef>
+        <NtryDtls><TxDtls>
+          <RltdPties><Cdtr><Nm>滴滴出行</Nm></Cdtr></RltdPties>
+          <RmtInf><Ustrd>快车</Ustrd></RmtInf>
+        </TxDtls></NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="CNY">30.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts><Cd>BOOK</Cd></Sts>
+        <BookgDt><Dt>2025-10-21</Dt></BookgDt>
+        <AcctSvcrRef>REF-2</AcctSvcrRef>
+        <NtryDtls>
+          <TxDtls><Amt Ccy="CNY">10.00</Amt><RltdPties><Cdtr><Pty><Nm>甲</Nm></Pty></Cdtr></RltdPties></TxDtls>
+          <TxDtls><Refs><AcctSvcrRef>TX-2B</AcctSvcrRef></Refs><Amt Ccy="CNY">20.00</Amt></TxDtls>
+        </NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="USD">5.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt><Dt>2025-10-22</Dt></BookgDt>
+        <AcctSvcrRef>REF-3</AcctSvcrRef>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>`
+	if got := detectStatementFormat("statement.xml", xmlText); got != StatementSourceCAMT053 {
+		t.Fatalf("format=%q", got)
+	}
+	entries, err := parseCAMT053Statement(xmlText)
+	if err != nil {
+		t.Fatalf("parseCAMT053Statement: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("entries=%d want 4: %#v", len(entries), entries)
+	}
+	first := entries[0]
+	if first.ExternalID != "REF-1" || first.Amount != "25.6" || first.Merchant != "滴滴出行" || first.Description != "快车" || first.Time != "2025-10-20 18:01:00" {
+		t.Fatalf("unexpected first entry: %#v", first)
+	}
+	if entries[1].ExternalID != "REF-2#1" || entries[1].Amount != "10" || entries[1].Merchant != "甲" {
+		t.Fatalf("unexpected split entry: %#v", entries[1])
+	}
+	if entries[2].ExternalID != "TX-2B" || entries[2].Amount != "20" {
+		t.Fatalf("unexpected split entry: %#v", entries[2])
+	}
+	if entries[3].Currency != "USD" || entries[3].Amount != "5" || entries[3].SkipReason != "" {
+		t.Fatalf("foreign currency entry should keep its currency: %#v", entries[3])
+	}
+}
+
+func TestDetectStatementFormat_Unknown(t *testing.T) {
+	if got := detectStatementFormat("notes.txt", "hello"); got != "" {
+		t.Fatalf("format=%q", got)
+	}
+}
@@ -25,7 +25,7 @@ func TestPickSuggestedInvoices_RespectsMinScore_NoFallback(t *testing.T) {
 		CreatedAt:   now,
 	}
 
-	scored := scoreInvoiceCandidates(p, []models.Invoice{inv}, map[string]struct{}{})
+	scored := scoreInvoiceCandidates(p, []models.Invoice{inv}, map[string]struct{}{}, nil)
 	out := pickSuggestedInvoices(p, scored, 10)
 	if len(out) != 0 {
 		t.Fatalf("expected 0 suggestions, got %d", len(out))
@@ -52,7 +52,7 @@ func TestPickSuggestedInvoices_AmountMissing_AllowsMerchantDateSignals(t *testin
 		CreatedAt:   now,
 	}
 
-	scored := scoreInvoiceCandidates(p, []models.Invoice{inv}, map[string]struct{}{})
+	scored := scoreInvoiceCandidates(p, []models.Invoice{inv}, map[string]struct{}{}, nil)
 	out := pickSuggestedInvoices(p, scored, 10)
 	if len(out) != 1 || out[0].ID != "i1" {
 		t.Fatalf("expected 1 suggestion i1, got %+v", out)
@@ -69,7 +69,7 @@ func TestScoreInvoiceCandidates_ExcludesLinkedInvoices(t *testing.T) {
 	inv2 := models.Invoice{ID: "i2", Amount: &a2, CreatedAt: now}
 
 	linked := map[string]struct{}{"i1": {}}
-	scored := scoreInvoiceCandidates(p, []models.Invoice{inv1, inv2}, linked)
+	scored := scoreInvoiceCandidates(p, []models.Invoice{inv1, inv2}, linked, nil)
 	if len(scored) != 1 || scored[0].invoice.ID != "i2" {
 		t.Fatalf("expected only i2 scored, got %+v", scored)
 	}
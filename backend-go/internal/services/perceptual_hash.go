@@ -0,0 +1,150 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"math/bits"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// perceptualHashMaxDistance is the largest Hamming distance (out of 64 bits) at which two
+// dHashes are still treated as the same picture: re-encoded, re-scaled or lightly cropped.
+const perceptualHashMaxDistance = 10
+
+// perceptualHashPDFDPI is enough resolution for a 9x8 thumbnail of the first page.
+const perceptualHashPDFDPI = 36
+
+// differenceHash computes a 64-bit dHash: the image is reduced to a 9x8 grayscale grid and
+// each bit records whether a cell is brighter than its right-hand neighbour.
+func differenceHash(img image.Image) uint64 {
+	const w, h = 9, 8
+	bounds := img.Bounds()
+	if bounds.Dx() <= 0 || bounds.Dy() <= 0 {
+		return 0
+	}
+
+	// Box-average each cell so noise and JPEG artefacts do not flip bits.
+	var grid [h][w]float64
+	for gy := 0; gy < h; gy++ {
+		y0 := bounds.Min.Y + gy*bounds.Dy()/h
+		y1 := max(bounds.Min.Y+(gy+1)*bounds.Dy()/h, y0+1)
+		for gx := 0; gx < w; gx++ {
+			x0 := bounds.Min.X + gx*bounds.Dx()/w
+			x1 := max(bounds.Min.X+(gx+1)*bounds.Dx()/w, x0+1)
+			sum, n := 0.0, 0
+			for y := y0; y < y1 && y < bounds.Max.Y; y++ {
+				for x := x0; x < x1 && x < bounds.Max.X; x++ {
+					r, g, b, _ := img.At(x, y).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+					n++
+				}
+			}
+			if n > 0 {
+				grid[gy][gx] = sum / float64(n)
+			}
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if grid[y][x] > grid[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+func formatPerceptualHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+func parsePerceptualHash(s string) (uint64, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) != 16 {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+func perceptualHashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// perceptualHashSimilarity maps a Hamming distance to a 0..1 score (1 = identical hashes).
+func perceptualHashSimilarity(distance int) float64 {
+	return 1 - float64(distance)/64
+}
+
+func imageFilePerceptualHash(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return 0, err
+	}
+	return differenceHash(img), nil
+}
+
+// pdfFirstPagePerceptualHash renders page 1 with pdftoppm and hashes the result.
+func pdfFirstPagePerceptualHash(path string) (uint64, error) {
+	if _, err := exec.LookPath("pdftoppm"); err != nil {
+		return 0, fmt.Errorf("pdftoppm not found in PATH: %w", err)
+	}
+	tempDir, err := os.MkdirTemp("", "pdf-phash-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	prefix := filepath.Join(tempDir, "page")
+	cmd := exec.Command("pdftoppm", "-png", "-gray", "-singlefile", "-f", "1", "-l", "1", "-r", strconv.Itoa(perceptualHashPDFDPI), path, prefix)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return 0, fmt.Errorf("pdftoppm failed: %w (output: %s)", err, string(output))
+	}
+	return imageFilePerceptualHash(prefix + ".png")
+}
+
+// computeStoredFilePerceptualHash hashes an uploaded screenshot or invoice (first page for PDFs).
+// It is best-effort: unsupported formats and render failures yield nil so uploads never fail on it.
+func computeStoredFilePerceptualHash(uploadsDir string, storedPath string) *string {
+	abs := resolveUploadsPathAbs(uploadsDir, storedPath)
+	if abs == "" {
+		return nil
+	}
+
+	var (
+		hash uint64
+		err  error
+	)
+	switch strings.ToLower(filepath.Ext(abs)) {
+	case ".png", ".jpg", ".jpeg":
+		hash, err = imageFilePerceptualHash(abs)
+	case ".pdf":
+		hash, err = pdfFirstPagePerceptualHash(abs)
+	default:
+		return nil
+	}
+	if err != nil {
+		log.Printf("[Dedup] perceptual hash skipped for %s: %v", storedPath, err)
+		return nil
+	}
+	out := formatPerceptualHash(hash)
+	return &out
+}
@@ -0,0 +1,128 @@
+//go:build cgo
+
+package services
+
+import (
+	"context"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNearDuplicateUploadsSurfaceByPerceptualHash(t *testing.T) {
+	db := openServiceTestDB(t)
+	uploads := t.TempDir()
+	payments := NewPaymentService(db, uploads)
+	invoices := NewInvoiceService(db, uploads)
+	review := NewDedupReviewService(db, payments, invoices)
+
+	original := testReceiptImage(360, 720)
+	mirrored := image.NewGray(original.Bounds())
+	for y := 0; y < 720; y++ {
+		for x := 0; x < 360; x++ {
+			mirrored.SetGray(359-x, y, original.GrayAt(x, y))
+		}
+	}
+	writeImage := func(name string, img image.Image) string {
+		t.Helper()
+		f, err := os.Create(filepath.Join(uploads, name))
+		if err != nil {
+			t.Fatalf("创建文件失败: %v", err)
+		}
+		defer f.Close()
+		if err := jpeg.Encode(f, img, &jpeg.Options{Quality: 70}); err != nil {
+			t.Fatalf("编码图片失败: %v", err)
+		}
+		return "uploads/" + name
+	}
+	confirm := true
+	force := true
+	confirmPayment := func(id string, amount float64, at string, forced bool) error {
+		input := UpdatePaymentInput{Amount: &amount, TransactionTime: &at, Confirm: &confirm}
+		if forced {
+			input.ForceDuplicateSave = &force
+		}
+		return payments.Update("owner-1", id, input)
+	}
+	draftPayment := func(path string) string {
+		t.Helper()
+		p, err := payments.CreateDraftFromScreenshotUpload("owner-1", path, nil)
+		if err != nil {
+			t.Fatalf("创建支付草稿失败: %v", err)
+		}
+		if p.PerceptualHash == nil {
+			t.Fatalf("上传截图时应计算感知哈希")
+		}
+		return p.ID
+	}
+
+	first := draftPayment(writeImage("first.jpg", original))
+	if err := confirmPayment(first, 25, "2025-12-01T02:00:00Z", false); err != nil {
+		t.Fatalf("确认支付失败: %v", err)
+	}
+
+	// A rescaled, re-encoded copy has a different SHA-256 and OCR time but looks the same.
+	second := draftPayment(writeImage("second.jpg", scaleNearest(original, 240, 480)))
+	err := confirmPayment(second, 25, "2025-12-01T09:00:00Z", false)
+	de, ok := AsDuplicateError(err)
+	if !ok || de.Reason != "perceptual_hash" || len(de.Candidates) != 1 || de.Candidates[0].ID != first {
+		t.Fatalf("近似截图应以感知哈希疑似重复拦截: %v", err)
+	}
+	if s := de.Candidates[0].Similarity; s == nil || *s < perceptualHashSimilarity(perceptualHashMaxDistance) || *s > 1 {
+		t.Fatalf("候选应带相似度: %v", s)
+	}
+	if err := confirmPayment(second, 25, "2025-12-01T09:00:00Z", true); err != nil {
+		t.Fatalf("强制保存失败: %v", err)
+	}
+	if got, _ := payments.GetByID("owner-1", second); got.DedupStatus != DedupStatusForced || got.DedupRefID == nil || *got.DedupRefID != first {
+		t.Fatalf("强制保存后应记录重复引用: %#v", got)
+	}
+
+	// Same layout with a different recognised amount is another payment; a different picture is not matched.
+	third := draftPayment(writeImage("third.jpg", original))
+	if err := confirmPayment(third, 99, "2025-12-02T02:00:00Z", false); err != nil {
+		t.Fatalf("金额不同的相似截图不应被拦截: %v", err)
+	}
+	fourth := draftPayment(writeImage("fourth.jpg", mirrored))
+	if err := confirmPayment(fourth, 25, "2025-12-03T02:00:00Z", false); err != nil {
+		t.Fatalf("内容不同的截图不应被拦截: %v", err)
+	}
+
+	pairs, total, err := review.List(context.Background(), "owner-1", DuplicateQueueFilter{Entity: DedupEntityPayment})
+	if err != nil || total != 1 {
+		t.Fatalf("重复队列应包含近似截图: %d %v", total, err)
+	}
+	if e := pairs[0].Evidence; len(e.Reasons) != 1 || e.Reasons[0] != "perceptual_hash" || e.ImageSimilarity == nil {
+		t.Fatalf("重复队列证据应包含图片相似度: %#v", e)
+	}
+
+	draftInvoice := func(path string) string {
+		t.Helper()
+		inv, err := invoices.CreateDraftFromUpload("owner-1", CreateInvoiceInput{Filename: filepath.Base(path), OriginalName: filepath.Base(path), FilePath: path})
+		if err != nil {
+			t.Fatalf("创建发票草稿失败: %v", err)
+		}
+		return inv.ID
+	}
+	confirmInvoice := func(id string, invoiceNumber string) error {
+		input := UpdateInvoiceInput{Confirm: &confirm}
+		if invoiceNumber != "" {
+			input.InvoiceNumber = &invoiceNumber
+		}
+		return invoices.Update("owner-1", id, input)
+	}
+
+	if err := confirmInvoice(draftInvoice(writeImage("invoice-a.jpg", original)), "24110000000000000001"); err != nil {
+		t.Fatalf("确认发票失败: %v", err)
+	}
+	// Invoices from one template only differ in their numbers, so a different number is not a duplicate.
+	if err := confirmInvoice(draftInvoice(writeImage("invoice-b.jpg", original)), "24110000000000000002"); err != nil {
+		t.Fatalf("发票号不同的相似发票不应被拦截: %v", err)
+	}
+	err = confirmInvoice(draftInvoice(writeImage("invoice-c.jpg", scaleNearest(original, 300, 600))), "")
+	if de, ok := AsDuplicateError(err); !ok || de.Reason != "perceptual_hash" || len(de.Candidates) != 2 || de.Candidates[0].Similarity == nil {
+		t.Fatalf("未识别发票号的近似发票应以感知哈希疑似重复拦截: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testReceiptImage draws a receipt-like picture: a header band, a few text bars and a footer.
+func testReceiptImage(w, h int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(235)
+			switch {
+			case y < h/6:
+				v = uint8(40 + 120*x/w)
+			case y > h*5/6:
+				v = uint8(200 - 150*x/w)
+			case (y*12/h)%2 == 0 && x > w/10 && x < w*(5+(y*12/h)%4)/10:
+				v = 60
+			}
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+	return img
+}
+
+func scaleNearest(src *image.Gray, w, h int) *image.Gray {
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	b := src.Bounds()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dst.SetGray(x, y, src.GrayAt(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h))
+		}
+	}
+	return dst
+}
+
+func TestDifferenceHashToleratesRescaleAndReencode(t *testing.T) {
+	original := testReceiptImage(360, 720)
+	base := differenceHash(original)
+
+	dir := t.TempDir()
+	jpegPath := filepath.Join(dir, "resaved.jpg")
+	f, err := os.Create(jpegPath)
+	if err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	if err := jpeg.Encode(f, scaleNearest(original, 270, 540), &jpeg.Options{Quality: 60}); err != nil {
+		t.Fatalf("编码 JPEG 失败: %v", err)
+	}
+	f.Close()
+
+	resaved, err := imageFilePerceptualHash(jpegPath)
+	if err != nil {
+		t.Fatalf("计算感知哈希失败: %v", err)
+	}
+	if d := perceptualHashDistance(base, resaved); d > perceptualHashMaxDistance {
+		t.Fatalf("缩放并重新压缩的图片应视为近似重复, 距离 %d", d)
+	}
+
+	mirrored := image.NewGray(original.Bounds())
+	for y := 0; y < 720; y++ {
+		for x := 0; x < 360; x++ {
+			mirrored.SetGray(359-x, y, original.GrayAt(x, y))
+		}
+	}
+	other := differenceHash(mirrored)
+	if d := perceptualHashDistance(base, other); d <= perceptualHashMaxDistance {
+		t.Fatalf("内容不同的图片不应视为近似重复, 距离 %d", d)
+	}
+}
+
+func TestPerceptualHashFormattingAndStoredFiles(t *testing.T) {
+	if got, ok := parsePerceptualHash(formatPerceptualHash(0x0123456789abcdef)); !ok || got != 0x0123456789abcdef {
+		t.Fatalf("哈希格式往返失败: %x %v", got, ok)
+	}
+	for _, bad := range []string{"", "abc", "zz23456789abcdef"} {
+		if _, ok := parsePerceptualHash(bad); ok {
+			t.Fatalf("非法哈希应被拒绝: %q", bad)
+		}
+	}
+	if s := perceptualHashSimilarity(0); s != 1 {
+		t.Fatalf("相同哈希相似度应为 1: %v", s)
+	}
+
+	uploads := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(uploads, "owner-1"), 0o755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	f, err := os.Create(filepath.Join(uploads, "owner-1", "shot.png"))
+	if err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	if err := png.Encode(f, testReceiptImage(90, 180)); err != nil {
+		t.Fatalf("编码 PNG 失败: %v", err)
+	}
+	f.Close()
+	if err := os.WriteFile(filepath.Join(uploads, "owner-1", "broken.png"), []byte("not an image"), 0o644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+
+	if h := computeStoredFilePerceptualHash(uploads, "uploads/owner-1/shot.png"); h == nil || len(*h) != 16 {
+		t.Fatalf("应为上传的截图计算感知哈希: %v", h)
+	}
+	for _, path := range []string{"uploads/owner-1/broken.png", "uploads/owner-1/missing.png", "uploads/owner-1/data.xml", "../escape.png"} {
+		if h := computeStoredFilePerceptualHash(uploads, path); h != nil {
+			t.Fatalf("%s 不应产生感知哈希: %s", path, *h)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	railStationRe   = regexp.MustCompile(`(?m)^\s*([\p{Han}]{2,10})\s*[A-Za-z]*\s*站`)
+	railTrainRe     = regexp.MustCompile(`\b([GDCKTZYLSP]\d{1,4})\b`)
+	railDepartureRe = regexp.MustCompile(`(\d{4})\s*年\s*(\d{1,2})\s*月\s*(\d{1,2})\s*日\s*(\d{1,2})[:：](\d{2})\s*开`)
+	railSeatClassRe = regexp.MustCompile(`(商务座|特等座|优选一等座|一等座|二等座|三等座|高级软卧|软卧|硬卧|动卧|软座|硬座|无座)`)
+	railSeatNoRe    = regexp.MustCompile(`(\d{1,2})\s*车\s*(\d{1,3}[A-F]?)\s*号`)
+	railClockRe     = regexp.MustCompile(`(\d{1,2})[:：](\d{2})`)
+)
+
+// railTicketLocation is the time zone of departure times printed on railway e-tickets.
+var railTicketLocation = loadLocationOrUTC("Asia/Shanghai")
+
+// parseRailwayTicketJourney reads the ride of a railway e-ticket (电子发票（铁路电子客票）) from its
+// text layer: stations, train, departure, seat, passenger and ticket number. It returns nil when
+// neither the train nor the stations can be found.
+func parseRailwayTicketJourney(text string) *JourneySegment {
+	seg := &JourneySegment{Mode: JourneyModeRail}
+	if m := railStationRe.FindAllStringSubmatch(text, -1); len(m) > 0 {
+		seg.Origin = m[0][1]
+		if len(m) > 1 {
+			seg.Destination = m[1][1]
+		}
+	}
+	if m := railTrainRe.FindStringSubmatch(text); len(m) > 1 {
+		seg.Number = m[1]
+	}
+	if seg.Number == "" && seg.Origin == "" {
+		return nil
+	}
+	if m := railDepartureRe.FindStringSubmatch(text); len(m) == 6 {
+		seg.DepartureTime = railDepartureTime(m[1], m[2], m[3], m[4], m[5])
+	}
+	if m := railSeatClassRe.FindStringSubmatch(text); len(m) > 1 {
+		seg.SeatClass = m[1]
+	}
+	if m := railSeatNoRe.FindStringSubmatch(text); len(m) > 2 {
+		seg.SeatNumber = m[1] + "车" + m[2] + "号"
+	}
+	if m := railPassengerRe.FindStringSubmatch(text); len(m) > 1 {
+		seg.Passenger = strings.TrimSpace(m[1])
+	}
+	if m := railTicketNumberRe.FindStringSubmatch(text); len(m) > 1 {
+		seg.TicketNumber = m[1]
+	}
+	return seg
+}
+
+// parseRailwayTicketXMLJourney reads the ride of a railway e-ticket from the element values of its
+// XML (lower-cased element names, as collected by parseInvoiceXMLToExtracted).
+func parseRailwayTicketXMLJourney(values map[string][]string) *JourneySegment {
+	first := func(keys ...string) string {
+		for _, k := range keys {
+			for _, v := range values[k] {
+				if v = strings.TrimSpace(v); v != "" {
+					return v
+				}
+			}
+		}
+		return ""
+	}
+	seg := &JourneySegment{
+		Mode:         JourneyModeRail,
+		Number:       first("trainnumber", "trainno", "checi"),
+		Origin:       strings.TrimSuffix(first("departurestation", "fromstation", "startstation", "fzmc"), "站"),
+		Destination:  strings.TrimSuffix(first("destinationstation", "arrivalstation", "tostation", "endstation", "dzmc"), "站"),
+		SeatClass:    first("seatlevel", "seattype", "seatclass", "xb"),
+		SeatNumber:   first("seatno", "seatnumber", "zwh"),
+		Passenger:    first("passengername", "travelername", "ckxm"),
+		TicketNumber: first("electronicticketnumber", "eticketno", "ticketnumber", "dzkph"),
+	}
+	if seg.Number == "" && seg.Origin == "" {
+		return nil
+	}
+	rawDate := first("traveldate", "departuredate", "ccrq")
+	clock := first("departuretime", "traveltime", "kcsj")
+	if clock == "" {
+		// Some issuers put the full date-time into the date element.
+		clock = rawDate
+	}
+	if date := normalizeDate(rawDate); date != "" {
+		if m := railClockRe.FindStringSubmatch(clock); len(m) == 3 {
+			parts := strings.Split(date, "-")
+			seg.DepartureTime = railDepartureTime(parts[0], parts[1], parts[2], m[1], m[2])
+		}
+	}
+	return seg
+}
+
+// railDepartureTime formats a departure printed in Beijing time as RFC3339, or "" when invalid.
+func railDepartureTime(year, month, day, hour, minute string) string {
+	var n [5]int
+	for i, s := range []string{year, month, day, hour, minute} {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return ""
+		}
+		n[i] = v
+	}
+	if n[1] < 1 || n[1] > 12 || n[2] < 1 || n[2] > 31 || n[3] > 23 || n[4] > 59 {
+		return ""
+	}
+	t := time.Date(n[0], time.Month(n[1]), n[2], n[3], n[4], 0, 0, railTicketLocation)
+	if t.Day() != n[2] {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,74 @@
+package services
+
+import "testing"
+
+func TestParseRailwayTicketJourney(t *testing.T) {
+	text := "电子发票（铁路电子客票）\n" +
+		"发票号码:25329116804000012345\n" +
+		"南京南 站\n" +
+		"G7 Nanjingnan\n" +
+		"北京南 站\n" +
+		"2025年11月03日 08:15开 05车12F号 二等座\n" +
+		"票价: ￥443.50\n" +
+		"3201021990****123X 张三\n" +
+		"电子客票号:E123456789012345678\n"
+	seg := parseRailwayTicketJourney(text)
+	if seg == nil {
+		t.Fatal("expected a journey segment")
+	}
+	want := JourneySegment{
+		Mode:          JourneyModeRail,
+		Number:        "G7",
+		Origin:        "南京南",
+		Destination:   "北京南",
+		DepartureTime: "2025-11-03T08:15:00+08:00",
+		SeatClass:     "二等座",
+		SeatNumber:    "05车12F号",
+		Passenger:     "张三",
+		TicketNumber:  "E123456789012345678",
+	}
+	if *seg != want {
+		t.Fatalf("got %+v\nwant %+v", *seg, want)
+	}
+
+	data, err := NewOCRService().ParseInvoiceDataWithMeta(text, nil)
+	if err != nil {
+		t.Fatalf("parse invoice: %v", err)
+	}
+	if len(data.Journeys) != 1 || data.Journeys[0] != want {
+		t.Fatalf("expected the ride on the extraction result, got %+v", data.Journeys)
+	}
+
+	if got := parseRailwayTicketJourney("电子发票（铁路电子客票）\n票价: 100.00"); got != nil {
+		t.Fatalf("expected nil without train and stations, got %+v", got)
+	}
+}
+
+func TestParseRailwayTicketXMLJourney(t *testing.T) {
+	extracted, err := parseInvoiceXMLToExtracted([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<EInvoice>
+  <EIid>25329116804000012345</EIid>
+  <LabelName>电子发票（铁路电子客票）</LabelName>
+  <IssueTime>2025-11-03</IssueTime>
+  <TotalTax-includedAmount>443.50</TotalTax-includedAmount>
+  <TrainNumber>G7</TrainNumber>
+  <DepartureStation>南京南站</DepartureStation>
+  <DestinationStation>北京南站</DestinationStation>
+  <TravelDate>2025-11-03</TravelDate>
+  <DepartureTime>08:15</DepartureTime>
+  <SeatLevel>二等座</SeatLevel>
+  <PassengerName>张三</PassengerName>
+  <ElectronicTicketNumber>E123456789012345678</ElectronicTicketNumber>
+</EInvoice>`))
+	if err != nil {
+		t.Fatalf("parse xml: %v", err)
+	}
+	if extracted.InvoiceType != InvoiceTypeRailwayTicket || len(extracted.Journeys) != 1 {
+		t.Fatalf("expected one railway segment, got %q %+v", extracted.InvoiceType, extracted.Journeys)
+	}
+	seg := extracted.Journeys[0]
+	if seg.Number != "G7" || seg.Origin != "南京南" || seg.Destination != "北京南" ||
+		seg.DepartureTime != "2025-11-03T08:15:00+08:00" || seg.Passenger != "张三" || seg.SeatClass != "二等座" {
+		t.Fatalf("unexpected segment: %+v", seg)
+	}
+}
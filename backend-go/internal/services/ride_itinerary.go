@@ -0,0 +1,151 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RideRecord is one ride of a ride-hailing itinerary as extracted, see models.InvoiceRide.
+// RideTime is the boarding time as RFC3339 in Beijing time.
+type RideRecord struct {
+	Provider    string   `json:"provider,omitempty"`
+	CarType     string   `json:"car_type,omitempty"`
+	RideTime    string   `json:"ride_time,omitempty"`
+	City        string   `json:"city,omitempty"`
+	Origin      string   `json:"origin,omitempty"`
+	Destination string   `json:"destination,omitempty"`
+	DistanceKm  *float64 `json:"distance_km,omitempty"`
+	Amount      *float64 `json:"amount,omitempty"`
+}
+
+var (
+	rideProviderRe = regexp.MustCompile(`(滴滴出行|滴滴|高德打车|高德地图|高德|花小猪|曹操出行|T3出行|美团打车|首汽约车|享道出行|如祺出行)`)
+	// A row starts with its number, one to three text cells (car type, or provider and car type)
+	// and the boarding time; the year is missing on some itineraries.
+	rideRowRe   = regexp.MustCompile(`(?:^|\s)(\d{1,3})\s+((?:[^\s\d]\S*\s+){1,3}?)(?:(\d{4})[-/.年])?(\d{1,2})[-/.月](\d{1,2})日?\s+(\d{1,2}):(\d{2})(?::\d{2})?`)
+	rideTotalRe = regexp.MustCompile(`共\s*\d+\s*[笔单个]?行程[，,]?\s*(?:合计|总计|共计)\s*([\d,]+\.\d{1,2})\s*元`)
+	rideYearRe  = regexp.MustCompile(`(20\d{2})[-/.年]\d{1,2}`)
+	rideMoneyRe = regexp.MustCompile(`^\d+\.\d{1,2}$`)
+	rideKmRe    = regexp.MustCompile(`^\d+(?:\.\d+)?$`)
+	rideCityRe  = regexp.MustCompile(`^[\p{Han}]{2,8}(?:市|州|盟|地区|县)$`)
+	rideWeekRe  = regexp.MustCompile(`^(?:周|星期)[一二三四五六日天]$`)
+)
+
+// rideProviderNames normalizes the provider names found on itineraries.
+var rideProviderNames = map[string]string{
+	"滴滴": "滴滴出行", "高德": "高德打车", "高德地图": "高德打车", "花小猪": "花小猪打车",
+}
+
+// isRideItineraryText reports whether text is the itinerary of a ride-hailing platform, as opposed
+// to an air or railway itinerary.
+func isRideItineraryText(text string) bool {
+	compact := compactInvoiceTypeText(text)
+	if !strings.Contains(compact, "行程单") && !strings.Contains(strings.ToUpper(compact), "TRIPTABLE") {
+		return false
+	}
+	return rideProviderRe.MatchString(compact) || rideTotalRe.MatchString(text)
+}
+
+// parseRideItinerary reads the rides of a ride-hailing itinerary (滴滴/高德 行程单): boarding time,
+// city, origin, destination, distance and fare of each row, plus the total printed in the summary
+// ("共3笔行程，合计86.50元"). Cells may come one per line or one row per line.
+func parseRideItinerary(text string) ([]RideRecord, *float64) {
+	if !isRideItineraryText(text) {
+		return nil, nil
+	}
+	var total *float64
+	if m := rideTotalRe.FindStringSubmatch(text); len(m) > 1 {
+		total = parseAmountLoose(m[1])
+	}
+	provider := ""
+	if m := rideProviderRe.FindStringSubmatch(text); len(m) > 1 {
+		provider = m[1]
+		if name, ok := rideProviderNames[provider]; ok {
+			provider = name
+		}
+	}
+	defaultYear := ""
+	if m := rideYearRe.FindStringSubmatch(text); len(m) > 1 {
+		defaultYear = m[1]
+	}
+
+	flat := strings.Join(strings.Fields(text), " ")
+	matches := rideRowRe.FindAllStringSubmatchIndex(flat, -1)
+	var rides []RideRecord
+	for i, m := range matches {
+		group := func(n int) string {
+			if m[2*n] < 0 {
+				return ""
+			}
+			return flat[m[2*n]:m[2*n+1]]
+		}
+		end := len(flat)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		ride := RideRecord{Provider: provider}
+		head := strings.Fields(group(2))
+		switch len(head) {
+		case 1:
+			ride.CarType = head[0]
+		default:
+			ride.Provider, ride.CarType = head[0], strings.Join(head[1:], " ")
+		}
+		year := group(3)
+		if year == "" {
+			year = defaultYear
+		}
+		ride.RideTime = railDepartureTime(year, group(4), group(5), group(6), group(7))
+		if !fillRideBody(&ride, strings.Fields(flat[m[1]:end])) {
+			continue
+		}
+		rides = append(rides, ride)
+	}
+	return rides, total
+}
+
+// fillRideBody reads city, origin, destination, distance and fare from the cells that follow the
+// boarding time of a row. The fare is the first money cell, unless another one follows it: then
+// the first is the distance. An integer right before the fare is the distance too. It reports
+// false when the row has no fare.
+func fillRideBody(ride *RideRecord, cells []string) bool {
+	if len(cells) > 0 && rideWeekRe.MatchString(cells[0]) {
+		cells = cells[1:]
+	}
+	fare := -1
+	for j, c := range cells {
+		if rideMoneyRe.MatchString(c) {
+			fare = j
+			break
+		}
+	}
+	if fare < 0 {
+		return false
+	}
+	places := cells[:fare]
+	distance := ""
+	if fare+1 < len(cells) && rideMoneyRe.MatchString(cells[fare+1]) {
+		distance, fare = cells[fare], fare+1
+	} else if n := len(places); n > 0 && rideKmRe.MatchString(places[n-1]) {
+		distance, places = places[n-1], places[:n-1]
+	}
+	ride.Amount = parseAmountLoose(cells[fare])
+	if distance != "" {
+		if km, err := strconv.ParseFloat(distance, 64); err == nil {
+			ride.DistanceKm = &km
+		}
+	}
+	if len(places) > 0 && (rideCityRe.MatchString(places[0]) || len(places) > 2) {
+		ride.City, places = places[0], places[1:]
+	}
+	switch {
+	case len(places) == 1:
+		ride.Origin = places[0]
+	case len(places) >= 2:
+		half := len(places) / 2
+		ride.Origin = strings.Join(places[:half], " ")
+		ride.Destination = strings.Join(places[half:], " ")
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"smart-bill-manager/internal/models"
+)
+
+const didiItineraryText = "滴滴出行-行程单\nDIDI TRAVEL-TRIP TABLE\n" +
+	"申请时间：2025-11-06 10:20 行程时间：2025-11-03 08:10 至 2025-11-05 19:30\n" +
+	"行程人手机号：138****0000 共3笔行程，合计86.50元\n" +
+	"序号 车型 上车时间 城市 起点 终点 里程[公里] 金额[元] 备注\n" +
+	"1 快车 11-03 08:10 周一 北京市 北京南站 国贸大厦 12.3 35.20\n" +
+	"2 快车 11-03 18:40 周一 北京市 国贸大厦 北京南站 11.8 33.80\n" +
+	"3 特惠快车 11-05 19:30 周三 上海市 虹桥火车站 陆家嘴 17.50\n" +
+	"页码：1/1\n"
+
+func TestParseRideItinerary_Didi(t *testing.T) {
+	rides, total := parseRideItinerary(didiItineraryText)
+	if total == nil || *total != 86.5 {
+		t.Fatalf("unexpected total: %v", total)
+	}
+	if len(rides) != 3 {
+		t.Fatalf("expected three rides, got %+v", rides)
+	}
+	first := rides[0]
+	if first.Provider != "滴滴出行" || first.CarType != "快车" || first.RideTime != "2025-11-03T08:10:00+08:00" ||
+		first.City != "北京市" || first.Origin != "北京南站" || first.Destination != "国贸大厦" ||
+		valueOrZero(first.DistanceKm) != 12.3 || valueOrZero(first.Amount) != 35.2 {
+		t.Fatalf("unexpected first ride: %+v", first)
+	}
+	// The last ride has no distance.
+	last := rides[2]
+	if last.CarType != "特惠快车" || last.City != "上海市" || last.Destination != "陆家嘴" || last.DistanceKm != nil || valueOrZero(last.Amount) != 17.5 {
+		t.Fatalf("unexpected last ride: %+v", last)
+	}
+
+	data, err := NewOCRService().ParseInvoiceData(didiItineraryText)
+	if err != nil {
+		t.Fatalf("parse itinerary: %v", err)
+	}
+	if len(data.Rides) != 3 || data.TypeDetails == nil || valueOrZero(data.TypeDetails.Total) != 86.5 {
+		t.Fatalf("extraction should carry the rides and their total: %+v %+v", data.Rides, data.TypeDetails)
+	}
+}
+
+func TestParseRideItinerary_CellPerLine(t *testing.T) {
+	text := "滴滴出行\n行程单\n申请日期：2025-11-06\n共2笔行程，合计69.00元\n" +
+		"序号\n车型\n上车时间\n城市\n起点\n终点\n里程[公里]\n金额[元]\n" +
+		"1\n快车\n11-03 08:10\n北京市\n北京南站\n国贸大厦\n12.3\n35.20\n" +
+		"2\n快车\n11-03 18:40\n北京市\n国贸大厦\n北京南站\n11.8\n33.80\n"
+	rides, total := parseRideItinerary(text)
+	if total == nil || *total != 69 || len(rides) != 2 {
+		t.Fatalf("unexpected rides: %+v total=%v", rides, total)
+	}
+	if rides[1].RideTime != "2025-11-03T18:40:00+08:00" || rides[1].Origin != "国贸大厦" || valueOrZero(rides[1].Amount) != 33.8 {
+		t.Fatalf("unexpected second ride: %+v", rides[1])
+	}
+}
+
+func TestParseRideItinerary_GaodeProviderColumn(t *testing.T) {
+	text := "高德打车电子行程单\nAMAP RIDE-HAILING TRIP TABLE\n共2单行程，合计68.00元\n" +
+		"序号 服务商 车型 上车时间 城市 起点 终点 金额(元)\n" +
+		"1 曹操出行 经济型 2025-11-03 08:10 北京市 北京南站 国贸大厦 35.20\n" +
+		"2 T3出行 舒适型 2025-11-04 09:05 北京市 国贸大厦 首都机场T3 32.80\n"
+	rides, total := parseRideItinerary(text)
+	if total == nil || *total != 68 || len(rides) != 2 {
+		t.Fatalf("unexpected rides: %+v total=%v", rides, total)
+	}
+	if rides[0].Provider != "曹操出行" || rides[0].CarType != "经济型" || rides[0].DistanceKm != nil ||
+		rides[1].Provider != "T3出行" || rides[1].Destination != "首都机场T3" || rides[1].RideTime != "2025-11-04T09:05:00+08:00" {
+		t.Fatalf("unexpected rides: %+v", rides)
+	}
+}
+
+func TestParseRideItinerary_IgnoresOtherItineraries(t *testing.T) {
+	if rides, _ := parseRideItinerary("航空运输电子客票行程单\n自 FROM 北京首都 T3 PEK CA 1501 Y 30DEC 0830\n"); rides != nil {
+		t.Fatalf("air itinerary should not yield rides: %+v", rides)
+	}
+}
+
+func TestValidateInvoiceRides(t *testing.T) {
+	cents := func(v int64) *int64 { return &v }
+	rides := []models.InvoiceRide{{AmountCents: cents(3520)}, {AmountCents: cents(3380)}}
+	total := 69.0
+	inv := &models.Invoice{AmountCents: cents(6900), TypeDetails: &models.InvoiceTypeDetails{Total: &total}}
+	if w := validateInvoiceRides(inv, rides); len(w) != 0 {
+		t.Fatalf("matching rides should not warn: %+v", w)
+	}
+
+	// A ride the parser missed shows against both the printed total and the invoice amount.
+	w := validateInvoiceRides(inv, rides[:1])
+	if len(w) != 2 || w[0].Code != InvoiceWarningRideTotalMismatch || w[0].Field != "rides" || w[1].Field != "amount" {
+		t.Fatalf("unexpected warnings: %+v", w)
+	}
+}
+
+func TestTripExportRides(t *testing.T) {
+	cents := func(v int64) *int64 { return &v }
+	km := 12.3
+	invByID := map[string]tripExportInvoice{
+		"inv-1": {ID: "inv-1", InvoiceNumber: ptrString("001"), AmountCents: cents(8650)},
+	}
+	rides := []models.InvoiceRide{
+		{InvoiceID: "inv-1", RideTs: 1762128600000, City: ptrString("北京市"), Origin: ptrString("北京南站"), DistanceKm: &km, AmountCents: cents(3520)},
+		{InvoiceID: "inv-1", RideTs: 1762166400000, AmountCents: cents(3380)},
+		{InvoiceID: "draft", AmountCents: cents(100)},
+	}
+	allocateTripExportRides(invByID, rides)
+	if got := *invByID["inv-1"].AmountCents; got != 6900 {
+		t.Fatalf("invoice should count only the rides of this trip, got %d", got)
+	}
+
+	rows := tripExportRideIndex(rides, invByID, time.FixedZone("CST", 8*3600))
+	if len(rows) != 3 || rows[1][0] != "2025-11-03 08:10" || rows[1][4] != "北京南站" || rows[1][6] != "12.3" ||
+		rows[1][7] != "35.20" || rows[1][8] != "001" || rows[2][7] != "33.80" {
+		t.Fatalf("unexpected rows: %v", rows)
+	}
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SearchTypePayment = "payment"
+	SearchTypeInvoice = "invoice"
+	SearchTypeEmail   = "email"
+)
+
+const (
+	searchDefaultLimit = 20
+	searchMaxLimit     = 100
+	// Terms shorter than the trigram width cannot use the FTS index and are matched with LIKE.
+	searchTrigramRunes = 3
+	searchSnippetRunes = 40
+)
+
+// SearchService queries the search_documents table, which migrations keep in sync through
+// triggers. When the SQLite build has FTS5 an external-content trigram index is layered on top
+// for ranking; otherwise every term falls back to a LIKE scan of the owner's documents.
+type SearchService struct {
+	db *gorm.DB
+
+	ftsOnce sync.Once
+	fts     bool
+}
+
+func NewSearchService(db *gorm.DB) *SearchService {
+	return &SearchService{db: db}
+}
+
+type SearchInput struct {
+	Query  string   `form:"q"`
+	Types  []string `form:"types"`
+	Limit  int      `form:"limit"`
+	Offset int      `form:"offset"`
+}
+
+type SearchResult struct {
+	Type    string  `json:"type"`
+	ID      string  `json:"id"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"`
+	Time    string  `json:"time"`
+	Score   float64 `json:"score"`
+}
+
+// ftsStatements create the FTS5 index over search_documents and the triggers mirroring it.
+var ftsStatements = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS search_fts USING fts5(
+		title, body, content='search_documents', content_rowid='id', tokenize='trigram'
+	)`,
+	`CREATE TRIGGER IF NOT EXISTS search_documents_fts_ai AFTER INSERT ON search_documents BEGIN
+		INSERT INTO search_fts(rowid, title, body) VALUES (NEW.id, NEW.title, NEW.body);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_documents_fts_ad AFTER DELETE ON search_documents BEGIN
+		INSERT INTO search_fts(search_fts, rowid, title, body) VALUES ('delete', OLD.id, OLD.title, OLD.body);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_documents_fts_au AFTER UPDATE ON search_documents BEGIN
+		INSERT INTO search_fts(search_fts, rowid, title, body) VALUES ('delete', OLD.id, OLD.title, OLD.body);
+		INSERT INTO search_fts(rowid, title, body) VALUES (NEW.id, NEW.title, NEW.body);
+	END`,
+}
+
+var ftsTriggers = []string{"search_documents_fts_ai", "search_documents_fts_ad", "search_documents_fts_au"}
+
+// ensureFTS prepares the FTS5 index once per process. It is runtime maintenance rather than a
+// versioned migration because availability depends on how the binary was built: a build without
+// FTS5 drops the mirroring triggers so writes keep working, and the next FTS5 build rebuilds the
+// index from search_documents.
+func (s *SearchService) ensureFTS() bool {
+	s.ftsOnce.Do(func() {
+		var mirrored int64
+		if err := s.db.Raw(
+			"SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name IN ?", ftsTriggers,
+		).Scan(&mirrored).Error; err != nil {
+			log.Printf("[Search] check FTS index failed: %v", err)
+			return
+		}
+
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			for _, stmt := range ftsStatements {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			if int(mirrored) != len(ftsTriggers) {
+				return tx.Exec("INSERT INTO search_fts(search_fts) VALUES ('rebuild')").Error
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("[Search] FTS5 unavailable, falling back to LIKE search: %v", err)
+			for _, name := range ftsTriggers {
+				if err := s.db.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+					log.Printf("[Search] drop trigger %s failed: %v", name, err)
+				}
+			}
+			return
+		}
+		s.fts = true
+	})
+	return s.fts
+}
+
+// Search returns the owner's payments, invoices and emails matching every term of the query,
+// best matches first, together with the total number of matches.
+func (s *SearchService) Search(ctx context.Context, ownerUserID string, input SearchInput) ([]SearchResult, int64, error) {
+	terms := strings.Fields(input.Query)
+	if len(terms) == 0 {
+		return []SearchResult{}, 0, nil
+	}
+	limit := input.Limit
+	if limit <= 0 {
+		limit = searchDefaultLimit
+	}
+	if limit > searchMaxLimit {
+		limit = searchMaxLimit
+	}
+	offset := input.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	useFTS := s.ensureFTS()
+	q := s.db.WithContext(ctx).Table("search_documents AS d").
+		Where("d.owner_user_id = ?", strings.TrimSpace(ownerUserID))
+	if types := normalizeSearchTypes(input.Types); len(types) > 0 {
+		q = q.Where("d.doc_type IN ?", types)
+	}
+
+	var phrases []string
+	for _, term := range terms {
+		if useFTS && utf8.RuneCountInString(term) >= searchTrigramRunes {
+			phrases = append(phrases, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+			continue
+		}
+		pattern := "%" + escapeLike(term) + "%"
+		q = q.Where(`(d.title LIKE ? ESCAPE '\' OR d.body LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+	ranked := len(phrases) > 0
+	if ranked {
+		q = q.Joins("JOIN search_fts ON search_fts.rowid = d.id").
+			Where("search_fts MATCH ?", strings.Join(phrases, " "))
+	}
+
+	var total int64
+	if err := q.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	type row struct {
+		DocType string  `gorm:"column:doc_type"`
+		DocID   string  `gorm:"column:doc_id"`
+		Title   string  `gorm:"column:title"`
+		Body    string  `gorm:"column:body"`
+		DocTime string  `gorm:"column:doc_time"`
+		Score   float64 `gorm:"column:score"`
+	}
+	selectSQL := "d.doc_type, d.doc_id, d.title, d.body, d.doc_time, 0 AS score"
+	order := "d.doc_time DESC, d.id DESC"
+	if ranked {
+		// bm25 is lower-is-better; titles weigh more than body text.
+		selectSQL = "d.doc_type, d.doc_id, d.title, d.body, d.doc_time, -bm25(search_fts, 5.0, 1.0) AS score"
+		order = "score DESC, d.doc_time DESC"
+	}
+	var rows []row
+	if err := q.Select(selectSQL).Order(order).Limit(limit).Offset(offset).Scan(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+
+	out := make([]SearchResult, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, SearchResult{
+			Type:    r.DocType,
+			ID:      r.DocID,
+			Title:   r.Title,
+			Snippet: searchSnippet(r.Body, terms),
+			Time:    r.DocTime,
+			Score:   r.Score,
+		})
+	}
+	return out, total, nil
+}
+
+func normalizeSearchTypes(types []string) []string {
+	var out []string
+	for _, raw := range types {
+		for _, t := range strings.Split(raw, ",") {
+			switch t = strings.ToLower(strings.TrimSpace(t)); t {
+			case SearchTypePayment, SearchTypeInvoice, SearchTypeEmail:
+				out = append(out, t)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// searchSnippet returns a single-line excerpt of body around the earliest matching term.
+func searchSnippet(body string, terms []string) string {
+	text := []rune(strings.Join(strings.Fields(body), " "))
+	lower := lowerRunes(text)
+	at := -1
+	for _, term := range terms {
+		needle := lowerRunes([]rune(term))
+		if idx := runeIndex(lower, needle); idx >= 0 && (at < 0 || idx < at) {
+			at = idx
+		}
+	}
+	if at < 0 {
+		at = 0
+	}
+	start := at - searchSnippetRunes/2
+	if start < 0 {
+		start = 0
+	}
+	end := start + searchSnippetRunes
+	if end > len(text) {
+		end = len(text)
+	}
+	snippet := string(text[start:end])
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(text) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// lowerRunes lower-cases rune by rune so offsets stay aligned with the original text.
+func lowerRunes(in []rune) []rune {
+	out := make([]rune, len(in))
+	for i, r := range in {
+		out[i] = unicode.ToLower(r)
+	}
+	return out
+}
+
+func runeIndex(haystack, needle []rune) int {
+	if len(needle) == 0 {
+		return -1
+	}
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		match := true
+		for j := range needle {
+			if haystack[i+j] != needle[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,94 @@
+//go:build cgo
+
+package services
+
+import (
+	"context"
+	"testing"
+
+	"smart-bill-manager/internal/models"
+)
+
+func TestSearchIndexesRecordsIncrementally(t *testing.T) {
+	db := openServiceTestDB(t)
+	payments := NewPaymentService(db, t.TempDir())
+	invoices := NewInvoiceService(db, t.TempDir())
+	search := NewSearchService(db)
+	ctx := context.Background()
+
+	didi := "滴滴出行"
+	description := "杭州西湖区打车"
+	ride, err := payments.Create("owner-1", CreatePaymentInput{Amount: 36, Merchant: &didi, Description: &description, TransactionTime: "2025-04-02T02:00:00Z"})
+	if err != nil {
+		t.Fatalf("创建支付失败: %v", err)
+	}
+	if _, err := payments.Create("owner-2", CreatePaymentInput{Amount: 20, Merchant: &didi, TransactionTime: "2025-04-03T02:00:00Z"}); err != nil {
+		t.Fatalf("创建支付失败: %v", err)
+	}
+	rawText := `{"raw_text":"订单号 9988 上车地点 杭州东站"}`
+	if err := db.Create(&models.PaymentOCRBlob{PaymentID: ride.ID, OwnerUserID: "owner-1", ExtractedData: &rawText}).Error; err != nil {
+		t.Fatalf("写入支付 OCR 失败: %v", err)
+	}
+
+	seller, number, invoiceText := "杭州滴滴科技有限公司", "25332000000012345678", "电子发票 客运服务费"
+	if err := db.Create(&models.Invoice{
+		ID: "invoice-1", OwnerUserID: "owner-1", Filename: "a.pdf", OriginalName: "a.pdf", FilePath: "uploads/a.pdf",
+		SellerName: &seller, InvoiceNumber: &number, Source: "upload",
+	}).Error; err != nil {
+		t.Fatalf("写入发票失败: %v", err)
+	}
+	if err := db.Create(&models.InvoiceOCRBlob{InvoiceID: "invoice-1", OwnerUserID: "owner-1", RawText: &invoiceText}).Error; err != nil {
+		t.Fatalf("写入发票 OCR 失败: %v", err)
+	}
+	if err := db.Create(&models.Invoice{
+		ID: "invoice-draft", OwnerUserID: "owner-1", IsDraft: true, Filename: "b.pdf", OriginalName: "b.pdf", FilePath: "uploads/b.pdf",
+		SellerName: &seller, Source: "upload",
+	}).Error; err != nil {
+		t.Fatalf("写入草稿发票失败: %v", err)
+	}
+	subject := "您收到一张滴滴出行电子发票"
+	if err := db.Create(&models.EmailLog{ID: "email-1", OwnerUserID: "owner-1", EmailConfigID: "cfg-1", Subject: &subject}).Error; err != nil {
+		t.Fatalf("写入邮件记录失败: %v", err)
+	}
+
+	search.ensureFTS()
+	results, total, err := search.Search(ctx, "owner-1", SearchInput{Query: "滴滴"})
+	if err != nil {
+		t.Fatalf("搜索失败: %v", err)
+	}
+	if total != 3 || len(results) != 3 {
+		t.Fatalf("应找到本人的支付、发票和邮件，草稿与他人记录不应出现: %#v", results)
+	}
+
+	results, _, err = search.Search(ctx, "owner-1", SearchInput{Query: "杭州东站 9988"})
+	if err != nil || len(results) != 1 || results[0].ID != ride.ID || results[0].Type != SearchTypePayment {
+		t.Fatalf("应通过 OCR 原文找到支付: %#v %v", results, err)
+	}
+	if results[0].Snippet == "" {
+		t.Fatalf("搜索结果应包含摘要")
+	}
+
+	results, _, err = search.Search(ctx, "owner-1", SearchInput{Query: "客运服务", Types: []string{"invoice,email"}})
+	if err != nil || len(results) != 1 || results[0].ID != "invoice-1" {
+		t.Fatalf("应通过发票 OCR 原文找到发票: %#v %v", results, err)
+	}
+
+	// Updates and deletes are reflected immediately.
+	merchant := "曹操出行"
+	if err := payments.Update("owner-1", ride.ID, UpdatePaymentInput{Merchant: &merchant}); err != nil {
+		t.Fatalf("更新支付失败: %v", err)
+	}
+	if results, _, err = search.Search(ctx, "owner-1", SearchInput{Query: "曹操出行"}); err != nil || len(results) != 1 || results[0].Title != merchant {
+		t.Fatalf("更新后应按新商户找到支付: %#v %v", results, err)
+	}
+	if err := db.Model(&models.Invoice{}).Where("id = ?", "invoice-draft").Update("is_draft", false).Error; err != nil {
+		t.Fatalf("确认草稿失败: %v", err)
+	}
+	if err := invoices.Delete("owner-1", "invoice-1"); err != nil {
+		t.Fatalf("删除发票失败: %v", err)
+	}
+	results, _, err = search.Search(ctx, "owner-1", SearchInput{Query: "滴滴科技", Types: []string{SearchTypeInvoice}})
+	if err != nil || len(results) != 1 || results[0].ID != "invoice-draft" {
+		t.Fatalf("删除的发票应移出索引，确认的草稿应加入索引: %#v %v", results, err)
+	}
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTagNotFound = errors.New("tag not found")
+	ErrTagExists   = errors.New("tag already exists")
+)
+
+type TagService struct {
+	db *gorm.DB
+}
+
+func NewTagService(db *gorm.DB) *TagService {
+	return &TagService{db: db}
+}
+
+type TagInput struct {
+	Name  string `json:"name" binding:"required"`
+	Color string `json:"color"`
+}
+
+func (s *TagService) List(ownerUserID string) ([]models.Tag, error) {
+	var out []models.Tag
+	err := s.db.Where("owner_user_id = ?", strings.TrimSpace(ownerUserID)).
+		Order("name ASC").
+		Find(&out).Error
+	return out, err
+}
+
+func (s *TagService) Create(ownerUserID string, input TagInput) (*models.Tag, error) {
+	tag := &models.Tag{
+		ID:          utils.GenerateUUID(),
+		OwnerUserID: strings.TrimSpace(ownerUserID),
+	}
+	if err := s.apply(tag, input); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(tag).Error; err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+func (s *TagService) Update(ownerUserID string, id string, input TagInput) (*models.Tag, error) {
+	var tag models.Tag
+	if err := s.db.Where("id = ? AND owner_user_id = ?", strings.TrimSpace(id), strings.TrimSpace(ownerUserID)).
+		First(&tag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTagNotFound
+		}
+		return nil, err
+	}
+	if err := s.apply(&tag, input); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(&tag).Error; err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// Delete removes the tag together with its links; the tagged records are kept.
+func (s *TagService) Delete(ownerUserID string, id string) error {
+	id = strings.TrimSpace(id)
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND owner_user_id = ?", id, strings.TrimSpace(ownerUserID)).Delete(&models.Tag{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrTagNotFound
+		}
+		for _, link := range []interface{}{&models.PaymentTag{}, &models.InvoiceTag{}, &models.TripTag{}} {
+			if err := tx.Where("tag_id = ?", id).Delete(link).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *TagService) apply(tag *models.Tag, input TagInput) error {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	var clash int64
+	if err := s.db.Model(&models.Tag{}).
+		Where("owner_user_id = ? AND name = ? AND id <> ?", tag.OwnerUserID, name, tag.ID).
+		Count(&clash).Error; err != nil {
+		return err
+	}
+	if clash > 0 {
+		return ErrTagExists
+	}
+	tag.Name = name
+	tag.Color = strings.TrimSpace(input.Color)
+	return nil
+}
+
+// tagLink describes the join table linking tags to one kind of record.
+type tagLink struct {
+	entityTable string // table holding the tagged records
+	linkTable   string
+	column      string // column of linkTable referencing the record
+}
+
+var (
+	paymentTagLink = tagLink{entityTable: "payments", linkTable: "payment_tags", column: "payment_id"}
+	invoiceTagLink = tagLink{entityTable: "invoices", linkTable: "invoice_tags", column: "invoice_id"}
+	tripTagLink    = tagLink{entityTable: "trips", linkTable: "trip_tags", column: "trip_id"}
+)
+
+// set replaces the tags of one of the owner's records and returns them by name.
+func (l tagLink) set(db *gorm.DB, ownerUserID string, entityID string, tagIDs []string) ([]models.Tag, error) {
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	entityID = strings.TrimSpace(entityID)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var found int64
+		if err := tx.Table(l.entityTable).
+			Where("id = ? AND owner_user_id = ?", entityID, ownerUserID).
+			Count(&found).Error; err != nil {
+			return err
+		}
+		if found == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		ids := uniqueTrimmed(tagIDs)
+		if len(ids) > 0 {
+			var owned int64
+			if err := tx.Model(&models.Tag{}).
+				Where("owner_user_id = ? AND id IN ?", ownerUserID, ids).
+				Count(&owned).Error; err != nil {
+				return err
+			}
+			if int(owned) != len(ids) {
+				return ErrTagNotFound
+			}
+		}
+
+		if err := tx.Exec("DELETE FROM "+l.linkTable+" WHERE "+l.column+" = ?", entityID).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := tx.Exec("INSERT INTO "+l.linkTable+" ("+l.column+", tag_id, created_at) VALUES (?, ?, CURRENT_TIMESTAMP)", entityID, id).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	tags, err := l.load(db, ownerUserID, []string{entityID})
+	if err != nil {
+		return nil, err
+	}
+	return tags[entityID], nil
+}
+
+// load returns the tags of each record, sorted by name.
+func (l tagLink) load(db *gorm.DB, ownerUserID string, entityIDs []string) (map[string][]models.Tag, error) {
+	out := make(map[string][]models.Tag, len(entityIDs))
+	if len(entityIDs) == 0 {
+		return out, nil
+	}
+	type row struct {
+		models.Tag
+		EntityID string `gorm:"column:entity_id"`
+	}
+	var rows []row
+	if err := db.Table("tags AS t").
+		Select("t.*, l."+l.column+" AS entity_id").
+		Joins("JOIN "+l.linkTable+" AS l ON l.tag_id = t.id").
+		Where("t.owner_user_id = ? AND l."+l.column+" IN ?", strings.TrimSpace(ownerUserID), entityIDs).
+		Order("t.name ASC").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		out[r.EntityID] = append(out[r.EntityID], r.Tag)
+	}
+	return out, nil
+}
+
+// uniqueTrimmed trims ids and drops blanks and repeats, keeping the first occurrence's order.
+func uniqueTrimmed(ids []string) []string {
+	out := make([]string, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); id != "" && !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// moveTo re-points the tag links of one record to another, keeping tags the target already has.
+func (l tagLink) moveTo(tx *gorm.DB, fromID string, toID string) error {
+	if err := tx.Exec("INSERT OR IGNORE INTO "+l.linkTable+" ("+l.column+", tag_id, created_at) "+
+		"SELECT ?, tag_id, created_at FROM "+l.linkTable+" WHERE "+l.column+" = ?", toID, fromID).Error; err != nil {
+		return err
+	}
+	return l.deleteFor(tx, []string{fromID})
+}
+
+// deleteFor drops the tag links of records that are being deleted.
+func (l tagLink) deleteFor(tx *gorm.DB, entityIDs []string) error {
+	if len(entityIDs) == 0 {
+		return nil
+	}
+	return tx.Exec("DELETE FROM "+l.linkTable+" WHERE "+l.column+" IN ?", entityIDs).Error
+}
+
+func (s *PaymentService) SetTags(ownerUserID string, paymentID string, tagIDs []string) ([]models.Tag, error) {
+	return paymentTagLink.set(s.db, ownerUserID, paymentID, tagIDs)
+}
+
+func (s *InvoiceService) SetTags(ownerUserID string, invoiceID string, tagIDs []string) ([]models.Tag, error) {
+	return invoiceTagLink.set(s.db, ownerUserID, invoiceID, tagIDs)
+}
+
+func (s *TripService) SetTags(ownerUserID string, tripID string, tagIDs []string) ([]models.Tag, error) {
+	return tripTagLink.set(s.db, ownerUserID, tripID, tagIDs)
+}
@@ -0,0 +1,97 @@
+//go:build cgo
+
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestTagsFilterPaymentsAndNetStats(t *testing.T) {
+	db := openServiceTestDB(t)
+	payments := NewPaymentService(db, t.TempDir())
+	tags := NewTagService(db)
+
+	business, err := tags.Create("owner-1", TagInput{Name: "报销", Color: "#f56c6c"})
+	if err != nil {
+		t.Fatalf("创建标签失败: %v", err)
+	}
+	client, err := tags.Create("owner-1", TagInput{Name: "客户A"})
+	if err != nil {
+		t.Fatalf("创建标签失败: %v", err)
+	}
+	if _, err := tags.Create("owner-1", TagInput{Name: " 报销 "}); !errors.Is(err, ErrTagExists) {
+		t.Fatalf("重名标签应被拒绝: %v", err)
+	}
+	foreign, err := tags.Create("owner-2", TagInput{Name: "报销"})
+	if err != nil {
+		t.Fatalf("其他用户可以使用相同名称: %v", err)
+	}
+
+	merchant := "酒店"
+	hotel, err := payments.Create("owner-1", CreatePaymentInput{Amount: 500, Merchant: &merchant, TransactionTime: "2025-10-24T02:00:00Z"})
+	if err != nil {
+		t.Fatalf("创建支付失败: %v", err)
+	}
+	lunch, err := payments.Create("owner-1", CreatePaymentInput{Amount: 80, TransactionTime: "2025-10-24T04:00:00Z"})
+	if err != nil {
+		t.Fatalf("创建支付失败: %v", err)
+	}
+	if _, err := payments.Create("owner-1", CreatePaymentInput{Amount: 30, TransactionTime: "2025-10-24T06:00:00Z"}); err != nil {
+		t.Fatalf("创建支付失败: %v", err)
+	}
+
+	if _, err := payments.SetTags("owner-1", hotel.ID, []string{foreign.ID}); !errors.Is(err, ErrTagNotFound) {
+		t.Fatalf("不应允许使用其他用户的标签: %v", err)
+	}
+	if _, err := payments.SetTags("owner-2", hotel.ID, []string{foreign.ID}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("不应允许给其他用户的支付打标签: %v", err)
+	}
+	set, err := payments.SetTags("owner-1", hotel.ID, []string{business.ID, client.ID, business.ID})
+	if err != nil || len(set) != 2 {
+		t.Fatalf("保存标签失败: %#v %v", set, err)
+	}
+	if _, err := payments.SetTags("owner-1", lunch.ID, []string{business.ID}); err != nil {
+		t.Fatalf("保存标签失败: %v", err)
+	}
+
+	items, total, err := payments.ListWithInvoiceCounts("owner-1", PaymentFilterInput{TagIDs: []string{business.ID}})
+	if err != nil || total != 2 || len(items) != 2 {
+		t.Fatalf("按标签筛选应返回两笔支付: %d %v", total, err)
+	}
+	items, total, err = payments.ListWithInvoiceCounts("owner-1", PaymentFilterInput{TagIDs: []string{business.ID, client.ID}})
+	if err != nil || total != 1 || len(items) != 1 || items[0].ID != hotel.ID || len(items[0].Tags) != 2 {
+		t.Fatalf("多个标签应同时满足: %#v %v", items, err)
+	}
+
+	got, err := payments.GetByID("owner-1", hotel.ID)
+	if err != nil || len(got.Tags) != 2 || got.Tags[0].Name != "客户A" {
+		t.Fatalf("支付详情应包含标签: %#v %v", got, err)
+	}
+
+	// A linked refund is counted against the tags of its original payment.
+	refund, err := payments.Create("owner-1", CreatePaymentInput{Amount: 100, Merchant: &merchant, TransactionTime: "2025-10-25T02:00:00Z"})
+	if err != nil {
+		t.Fatalf("创建退款失败: %v", err)
+	}
+	if _, err := payments.LinkRefund("owner-1", refund.ID, hotel.ID); err != nil {
+		t.Fatalf("关联退款失败: %v", err)
+	}
+	stats, err := payments.GetStatsCtx(context.Background(), "owner-1", "", "")
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+	if stats.TagStats["报销"] != 480 || stats.TagStats["客户A"] != 400 {
+		t.Fatalf("标签统计应扣除退款: %#v", stats.TagStats)
+	}
+
+	if err := tags.Delete("owner-1", business.ID); err != nil {
+		t.Fatalf("删除标签失败: %v", err)
+	}
+	if got, err = payments.GetByID("owner-1", lunch.ID); err != nil || len(got.Tags) != 0 {
+		t.Fatalf("删除标签后支付不应再带该标签: %#v %v", got, err)
+	}
+}
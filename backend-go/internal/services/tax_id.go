@@ -0,0 +1,220 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	invoiceTaxIDLabelRe = regexp.MustCompile(`(?:统一社会信用代码|纳税人识别号)[^:：\n\d]{0,12}?[:：]?\s*([0-9A-Z]{15,20})`)
+
+	// Unified social credit codes (GB 32100) never use I, O, Z, S or V.
+	uscc18Re      = regexp.MustCompile(`^[0-9A-HJ-NPQRTUWXY]{2}\d{6}[0-9A-HJ-NPQRTUWXY]{10}$`)
+	legacyTaxID15 = regexp.MustCompile(`^\d{6}[0-9A-Z]{9}$`)
+	legacyTaxID20 = regexp.MustCompile(`^[0-9A-Z]{20}$`)
+)
+
+// Taxpayer number check results, see TaxIDCheck.
+const (
+	TaxIDValid     = "valid"
+	TaxIDCorrected = "corrected"
+	TaxIDInvalid   = "invalid"
+)
+
+// TaxIDCheck records the check digit verification of a printed taxpayer number in the extraction
+// trace. Corrected is the number one OCR confusion away that passes, when there is exactly one.
+type TaxIDCheck struct {
+	Party     string `json:"party"` // buyer|seller
+	Value     string `json:"value"`
+	Status    string `json:"status"`
+	Corrected string `json:"corrected,omitempty"`
+}
+
+const usccCharset = "0123456789ABCDEFGHJKLMNPQRTUWXY"
+
+var (
+	usccWeights    = [17]int{1, 3, 9, 27, 19, 26, 16, 17, 20, 29, 25, 13, 8, 24, 10, 30, 28}
+	orgCodeWeights = [8]int{3, 7, 9, 10, 5, 8, 4, 2}
+	idCardWeights  = [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+
+	// taxIDConfusions lists the characters OCR commonly reads in place of each other.
+	taxIDConfusions = map[byte]string{
+		'0': "OD", 'O': "0D", 'D': "0O",
+		'1': "IL", 'I': "1L", 'L': "1I",
+		'8': "B", 'B': "8",
+		'2': "Z", 'Z': "2",
+		'5': "S", 'S': "5",
+		'6': "G", 'G': "6",
+		'U': "V", 'V': "U",
+	}
+)
+
+// isValidTaxIDFormat reports whether id has the shape of a unified social credit code or of a
+// legacy 15/20-character taxpayer number. It does not verify check digits.
+func isValidTaxIDFormat(id string) bool {
+	id = strings.TrimSpace(id)
+	switch len(id) {
+	case 18:
+		return uscc18Re.MatchString(id)
+	case 15:
+		return legacyTaxID15.MatchString(id)
+	case 20:
+		return legacyTaxID20.MatchString(id)
+	}
+	return false
+}
+
+// isValidTaxID reports whether id is a taxpayer number whose check digit is correct: GB 32100 for
+// unified social credit codes, the GB 11714 organization code for 15-character numbers and the
+// GB 11643 identity card number for 20-character ones.
+func isValidTaxID(id string) bool {
+	id = strings.TrimSpace(id)
+	if !isValidTaxIDFormat(id) {
+		return false
+	}
+	switch len(id) {
+	case 18:
+		sum := 0
+		for i := 0; i < 17; i++ {
+			sum += strings.IndexByte(usccCharset, id[i]) * usccWeights[i]
+		}
+		return usccCharset[(31-sum%31)%31] == id[17]
+	case 15:
+		return orgCodeCheckDigit(id[6:14]) == id[14]
+	case 20:
+		return isValidIDCardNumber(id[:18])
+	}
+	return false
+}
+
+func orgCodeCheckDigit(code string) byte {
+	sum := 0
+	for i := 0; i < 8; i++ {
+		c := code[i]
+		v := int(c - '0')
+		if c >= 'A' && c <= 'Z' {
+			v = int(c-'A') + 10
+		}
+		sum += v * orgCodeWeights[i]
+	}
+	switch d := 11 - sum%11; d {
+	case 10:
+		return 'X'
+	case 11:
+		return '0'
+	default:
+		return byte('0' + d)
+	}
+}
+
+func isValidIDCardNumber(id string) bool {
+	sum := 0
+	for i := 0; i < 17; i++ {
+		if id[i] < '0' || id[i] > '9' {
+			return false
+		}
+		sum += int(id[i]-'0') * idCardWeights[i]
+	}
+	return "10X98765432"[sum%11] == id[17]
+}
+
+// checkTaxID verifies the check digit of a printed taxpayer number. For a number that fails, the
+// correction is returned when exactly one single-character OCR confusion makes it pass.
+func checkTaxID(id string) (status, corrected string) {
+	id = strings.TrimSpace(id)
+	if isValidTaxID(id) {
+		return TaxIDValid, ""
+	}
+	for i := 0; i < len(id); i++ {
+		for _, alt := range []byte(taxIDConfusions[id[i]]) {
+			cand := id[:i] + string(alt) + id[i+1:]
+			if !isValidTaxID(cand) {
+				continue
+			}
+			if corrected != "" {
+				return TaxIDInvalid, ""
+			}
+			corrected = cand
+		}
+	}
+	if corrected != "" {
+		return TaxIDCorrected, corrected
+	}
+	return TaxIDInvalid, ""
+}
+
+// checkPartyTaxID checks the taxpayer number printed for a party for the extraction trace. The
+// number itself is kept as printed; a correction is only proposed, see validateInvoice.
+func checkPartyTaxID(party string, id *string) *TaxIDCheck {
+	if id == nil || strings.TrimSpace(*id) == "" {
+		return nil
+	}
+	check := &TaxIDCheck{Party: party, Value: strings.TrimSpace(*id)}
+	check.Status, check.Corrected = checkTaxID(check.Value)
+	return check
+}
+
+// taxIDCheckStatus returns the status of a check, or "" when no number was printed.
+func taxIDCheckStatus(check *TaxIDCheck) string {
+	if check == nil {
+		return ""
+	}
+	return check.Status
+}
+
+// extractInvoicePartyTaxIDs finds the buyer and seller taxpayer numbers next to their
+// 纳税人识别号/统一社会信用代码 labels. The side comes from the nearest 购买方/销售方 marker on the
+// same line or from the section the line belongs to; when no line carries a side, two labelled
+// numbers are taken in layout order (buyer block first). A number failing its check digit gives way
+// to a later one of the same side that passes.
+func extractInvoicePartyTaxIDs(text string) (buyer, seller *string) {
+	const (
+		sideNone = iota
+		sideBuyer
+		sideSeller
+	)
+	sideAt := func(s string) int {
+		b := max(strings.LastIndex(s, "购买方"), strings.LastIndex(s, "购方"))
+		sl := max(strings.LastIndex(s, "销售方"), strings.LastIndex(s, "销方"))
+		switch {
+		case b < 0 && sl < 0:
+			return sideNone
+		case b > sl:
+			return sideBuyer
+		default:
+			return sideSeller
+		}
+	}
+
+	var unassigned []string
+	section := sideNone
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		matches := invoiceTaxIDLabelRe.FindAllStringSubmatchIndex(line, -1)
+		for _, m := range matches {
+			id := line[m[2]:m[3]]
+			side := sideAt(line[:m[0]])
+			if side == sideNone {
+				side = section
+			}
+			switch {
+			case side == sideBuyer && (buyer == nil || (!isValidTaxID(*buyer) && isValidTaxID(id))):
+				buyer = &id
+			case side == sideSeller && (seller == nil || (!isValidTaxID(*seller) && isValidTaxID(id))):
+				seller = &id
+			case side == sideNone:
+				unassigned = append(unassigned, id)
+			}
+		}
+		if side := sideAt(line); side != sideNone {
+			section = side
+		}
+	}
+	if buyer == nil && seller == nil && len(unassigned) == 2 && unassigned[0] != unassigned[1] {
+		buyer, seller = &unassigned[0], &unassigned[1]
+	}
+	return buyer, seller
+}
@@ -0,0 +1,113 @@
+package services
+
+import "testing"
+
+func TestIsValidTaxIDFormat(t *testing.T) {
+	valid := []string{"91310000132200821H", "110108123456789", "11010812345678901234"}
+	for _, id := range valid {
+		if !isValidTaxIDFormat(id) {
+			t.Fatalf("expected %q to be valid", id)
+		}
+	}
+	invalid := []string{"", "9131000013220082OH", "91310000132200821", "1101081234567890", "abc"}
+	for _, id := range invalid {
+		if isValidTaxIDFormat(id) {
+			t.Fatalf("expected %q to be invalid", id)
+		}
+	}
+}
+
+func TestIsValidTaxID(t *testing.T) {
+	valid := []string{"91310000132200821H", "91110108735575307R", "110108123456788", "11010519491231002X01"}
+	for _, id := range valid {
+		if !isValidTaxID(id) {
+			t.Fatalf("expected %q to pass its check digit", id)
+		}
+	}
+	invalid := []string{"91310000132200822H", "110108123456789", "11010519491231002101", "9131000013220082OH"}
+	for _, id := range invalid {
+		if isValidTaxID(id) {
+			t.Fatalf("expected %q to fail its check digit", id)
+		}
+	}
+}
+
+func TestCheckTaxID(t *testing.T) {
+	cases := []struct {
+		id, status, corrected string
+	}{
+		{"91310000132200821H", TaxIDValid, ""},
+		{"91310000132200B21H", TaxIDCorrected, "91310000132200821H"},
+		{"9I310000132200821H", TaxIDCorrected, "91310000132200821H"},
+		{"9111010873557S307R", TaxIDCorrected, "91110108735575307R"},
+		// Two single-character readings pass, so neither is proposed.
+		{"9131000013220082LH", TaxIDInvalid, ""},
+		{"91310000132200822H", TaxIDInvalid, ""},
+	}
+	for _, tc := range cases {
+		status, corrected := checkTaxID(tc.id)
+		if status != tc.status || corrected != tc.corrected {
+			t.Fatalf("%s: got %s %q, want %s %q", tc.id, status, corrected, tc.status, tc.corrected)
+		}
+	}
+}
+
+func TestExtractInvoicePartyTaxIDs(t *testing.T) {
+	text := "购买方信息 名称：北京某某科技有限公司\n统一社会信用代码/纳税人识别号：91110108MA01ABCD2X\n" +
+		"销售方信息 名称：上海某某餐饮有限公司\n统一社会信用代码/纳税人识别号：91310000132200821H\n"
+	buyer, seller := extractInvoicePartyTaxIDs(text)
+	if buyer == nil || *buyer != "91110108MA01ABCD2X" || seller == nil || *seller != "91310000132200821H" {
+		t.Fatalf("unexpected tax ids: buyer=%v seller=%v", buyer, seller)
+	}
+
+	// Side-by-side layout: both parties on one line.
+	text = "购 名称：北京某某科技有限公司 销 名称：上海某某餐饮有限公司\n" +
+		"买方 纳税人识别号：91110108MA01ABCD2X 售方 纳税人识别号：91310000132200821H\n"
+	buyer, seller = extractInvoicePartyTaxIDs(text)
+	if buyer == nil || *buyer != "91110108MA01ABCD2X" || seller == nil || *seller != "91310000132200821H" {
+		t.Fatalf("unexpected side-by-side tax ids: buyer=%v seller=%v", buyer, seller)
+	}
+}
+
+func TestExtractInvoicePartyTaxIDs_PrefersValidNumber(t *testing.T) {
+	// The first seller number is the invoice number misread next to the label.
+	text := "销售方 纳税人识别号：25117000000123456789\n销售方 统一社会信用代码：91310000132200821H\n"
+	if _, seller := extractInvoicePartyTaxIDs(text); seller == nil || *seller != "91310000132200821H" {
+		t.Fatalf("expected the number passing its check digit, got %v", seller)
+	}
+}
+
+func TestParseInvoiceData_ProposesTaxIDCorrection(t *testing.T) {
+	text := "电子发票（普通发票）\n发票号码：25117000000123456789\n开票日期：2025年10月09日\n" +
+		"购买方信息 名称：北京星河科技有限公司\n统一社会信用代码/纳税人识别号：9111010873557S307R\n" +
+		"销售方信息 名称：上海某某餐饮有限公司\n统一社会信用代码/纳税人识别号：91310000132200821H\n" +
+		"价税合计（大写）壹佰元整（小写）¥100.00\n"
+	data, err := NewOCRService().ParseInvoiceData(text)
+	if err != nil {
+		t.Fatalf("parse invoice: %v", err)
+	}
+	// The printed number is kept; the correction is only recorded.
+	if strPtrVal(data.BuyerTaxID) != "9111010873557S307R" || strPtrVal(data.SellerTaxID) != "91310000132200821H" {
+		t.Fatalf("unexpected tax ids: %v %v", strPtrVal(data.BuyerTaxID), strPtrVal(data.SellerTaxID))
+	}
+	if data.Trace == nil || len(data.Trace.TaxIDChecks) != 2 {
+		t.Fatalf("trace should record both checks: %+v", data.Trace)
+	}
+	buyer := data.Trace.TaxIDChecks[0]
+	if buyer.Party != "buyer" || buyer.Value != "9111010873557S307R" || buyer.Status != TaxIDCorrected || buyer.Corrected != "91110108735575307R" {
+		t.Fatalf("unexpected buyer check: %+v", buyer)
+	}
+	if data.Trace.TaxIDChecks[1].Status != TaxIDValid {
+		t.Fatalf("unexpected seller check: %+v", data.Trace.TaxIDChecks[1])
+	}
+}
+
+func TestScorePartyCandidate_PrefersValidatedTaxID(t *testing.T) {
+	valid, _ := scorePartyCandidate("上海某某餐饮有限公司", "seller_company_taxid_context", 0.9, true, "", TaxIDValid)
+	unchecked, _ := scorePartyCandidate("上海某某餐饮有限公司", "seller_company_taxid_context", 0.9, true, "", "")
+	invalid, _ := scorePartyCandidate("上海某某餐饮有限公司", "seller_company_taxid_context", 0.9, true, "", TaxIDInvalid)
+	label, _ := scorePartyCandidate("上海某某餐饮有限公司", "seller_label", 0.8, true, "", TaxIDInvalid)
+	if !(valid > unchecked && unchecked > invalid && label > invalid) {
+		t.Fatalf("unexpected scores: valid=%d unchecked=%d invalid=%d label=%d", valid, unchecked, invalid, label)
+	}
+}
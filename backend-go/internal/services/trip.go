@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -20,6 +22,8 @@ type TripService struct {
 	db          *gorm.DB
 	repo        *repository.TripRepository
 	paymentRepo *repository.PaymentRepository
+	journeyRepo *repository.JourneySegmentRepository
+	rideRepo    *repository.InvoiceRideRepository
 	uploadsDir  string
 }
 
@@ -28,6 +32,8 @@ func NewTripService(db *gorm.DB, uploadsDir string) *TripService {
 		db:          db,
 		repo:        repository.NewTripRepository(db),
 		paymentRepo: repository.NewPaymentRepository(db),
+		journeyRepo: repository.NewJourneySegmentRepository(db),
+		rideRepo:    repository.NewInvoiceRideRepository(db),
 		uploadsDir:  uploadsDir,
 	}
 }
@@ -115,7 +121,22 @@ func (s *TripService) GetAll(ownerUserID string) ([]models.Trip, error) {
 }
 
 func (s *TripService) GetAllCtx(ctx context.Context, ownerUserID string) ([]models.Trip, error) {
-	return s.repo.FindAllCtx(ctx, strings.TrimSpace(ownerUserID))
+	trips, err := s.repo.FindAllCtx(ctx, strings.TrimSpace(ownerUserID))
+	if err != nil || len(trips) == 0 {
+		return trips, err
+	}
+	ids := make([]string, 0, len(trips))
+	for _, t := range trips {
+		ids = append(ids, t.ID)
+	}
+	tags, err := tripTagLink.load(s.db.WithContext(ctx), ownerUserID, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range trips {
+		trips[i].Tags = tags[trips[i].ID]
+	}
+	return trips, nil
 }
 
 func (s *TripService) GetByID(ownerUserID string, id string) (*models.Trip, error) {
@@ -123,7 +144,14 @@ func (s *TripService) GetByID(ownerUserID string, id string) (*models.Trip, erro
 }
 
 func (s *TripService) GetByIDCtx(ctx context.Context, ownerUserID string, id string) (*models.Trip, error) {
-	return s.repo.FindByIDForOwnerCtx(ctx, strings.TrimSpace(ownerUserID), id)
+	trip, err := s.repo.FindByIDForOwnerCtx(ctx, strings.TrimSpace(ownerUserID), id)
+	if err != nil {
+		return nil, err
+	}
+	if tags, err := tripTagLink.load(s.db.WithContext(ctx), ownerUserID, []string{trip.ID}); err == nil {
+		trip.Tags = tags[trip.ID]
+	}
+	return trip, nil
 }
 
 type UpdateTripInput struct {
@@ -250,6 +278,47 @@ type TripSummary struct {
 	TotalAmount    float64 `json:"total_amount"`
 	LinkedInvoices int     `json:"linked_invoices"`
 	UnlinkedPays   int     `json:"unlinked_payments"`
+	// Currency is the owner's base currency; TotalAmount is converted at each payment's date.
+	Currency              string   `json:"currency"`
+	MissingRateCurrencies []string `json:"missing_rate_currencies,omitempty"`
+}
+
+// convertedTripTotals sums non-draft allocated cents per trip in the owner's base currency, with
+// refunds netted against their original's trip. An empty tripID covers all trips. Payments in a
+// currency without any rate are left out and reported per trip.
+func convertedTripTotals(db *gorm.DB, conv *currencyConverter, ownerUserID string, tripID string) (map[string]int64, map[string][]string, error) {
+	type row struct {
+		TripID     string `gorm:"column:trip_id"`
+		Currency   string `gorm:"column:currency"`
+		Day        string `gorm:"column:day"`
+		TotalCents int64  `gorm:"column:total_cents"`
+	}
+	q := db.Table(repository.NetPaymentsTable).
+		Select("trip_id, currency, "+repository.LocalDayExpr+" AS day, COALESCE(SUM(amount_cents), 0) AS total_cents").
+		Where("owner_user_id = ?", ownerUserID).
+		Where("trip_id IS NOT NULL").
+		Where("is_draft = 0")
+	if tripID != "" {
+		q = q.Where("trip_id = ?", tripID)
+	}
+	var rows []row
+	if err := q.Group("trip_id, currency, day").Scan(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	totals := make(map[string]int64)
+	missing := make(map[string][]string)
+	for _, r := range rows {
+		cents, ok := conv.toBase(r.TotalCents, r.Currency, r.Day)
+		if !ok {
+			if !slices.Contains(missing[r.TripID], r.Currency) {
+				missing[r.TripID] = append(missing[r.TripID], r.Currency)
+				sort.Strings(missing[r.TripID])
+			}
+			continue
+		}
+		totals[r.TripID] += cents
+	}
+	return totals, missing, nil
 }
 
 func (s *TripService) GetSummary(ownerUserID string, tripID string) (*TripSummary, error) {
@@ -268,52 +337,48 @@ func (s *TripService) GetSummaryCtx(ctx context.Context, ownerUserID string, tri
 		return nil, gorm.ErrRecordNotFound
 	}
 
-	out := &TripSummary{TripID: tripID}
-	type payAgg struct {
-		PaymentCount int64 `gorm:"column:payment_count"`
-		TotalCents   int64 `gorm:"column:total_cents"`
+	conv, err := newCurrencyConverter(ctx, s.db, ownerUserID)
+	if err != nil {
+		return nil, err
 	}
-	var pa payAgg
-	if err := db.
-		Model(&models.Payment{}).
-		Select("COUNT(*) AS payment_count, COALESCE(SUM(amount_cents), 0) AS total_cents").
-		Where("owner_user_id = ?", ownerUserID).
-		Where("trip_id = ?", tripID).
-		Where("is_draft = 0").
-		Scan(&pa).Error; err != nil {
+	out := &TripSummary{TripID: tripID, Currency: conv.base}
+	// Payments with an allocation in this trip; refunds are netted into TotalAmount, not counted
+	// as payments of their own.
+	tripPayments := db.Table(repository.NetPaymentsTable).
+		Select("DISTINCT id").
+		Where("owner_user_id = ? AND trip_id = ? AND is_draft = 0 AND is_refund = 0", ownerUserID, tripID)
+	var paymentCount int64
+	if err := db.Table("(?) AS tp", tripPayments).Count(&paymentCount).Error; err != nil {
 		return nil, err
 	}
-	out.PaymentCount = int(pa.PaymentCount)
-	out.TotalAmount = money.ToMajor(pa.TotalCents)
-	if pa.PaymentCount == 0 {
+	out.PaymentCount = int(paymentCount)
+	if paymentCount == 0 {
 		return out, nil
 	}
 
-	// Count distinct invoices linked to these payments.
+	// Count distinct invoices linked to these payments, directly or through a matched ride.
 	var invoiceCount int64
 	if err := db.
-		Table("invoice_payment_links AS l").
-		Joins("JOIN payments AS p ON p.id = l.payment_id").
-		Where("p.owner_user_id = ?", ownerUserID).
-		Where("p.trip_id = ?", tripID).
-		Where("p.is_draft = 0").
+		Table(repository.InvoicePaymentPairsTable+" AS l").
+		Where("l.payment_id IN (?)", tripPayments).
 		Distinct("l.invoice_id").
 		Count(&invoiceCount).Error; err != nil {
 		return nil, err
 	}
 	out.LinkedInvoices = int(invoiceCount)
 
+	totals, missing, err := convertedTripTotals(db, conv, ownerUserID, tripID)
+	if err != nil {
+		return nil, err
+	}
+	out.TotalAmount = money.ToMajor(totals[tripID])
+	out.MissingRateCurrencies = missing[tripID]
+
 	// Count payments with no linked invoices.
 	var unlinked int64
-	if err := db.Raw(`
-		SELECT COUNT(*)
-		FROM payments p
-		LEFT JOIN invoice_payment_links l ON l.payment_id = p.id
-		WHERE p.owner_user_id = ?
-		  AND p.trip_id = ?
-		  AND p.is_draft = 0
-		  AND l.payment_id IS NULL
-	`, ownerUserID, tripID).Scan(&unlinked).Error; err != nil {
+	if err := db.Table("(?) AS tp", tripPayments).
+		Where("NOT EXISTS (SELECT 1 FROM " + repository.InvoicePaymentPairsTable + " l WHERE l.payment_id = tp.id)").
+		Count(&unlinked).Error; err != nil {
 		return nil, err
 	}
 	out.UnlinkedPays = int(unlinked)
@@ -340,7 +405,6 @@ func (s *TripService) GetAllSummariesCtx(ctx context.Context, ownerUserID string
 		SELECT
 			t.id AS trip_id,
 			COALESCE(p.payment_count, 0) AS payment_count,
-			COALESCE(p.total_cents, 0) / 100.0 AS total_amount,
 			COALESCE(li.linked_invoices, 0) AS linked_invoices,
 			COALESCE(p.unlinked_pays, 0) AS unlinked_pays
 		FROM trips t
@@ -348,30 +412,45 @@ func (s *TripService) GetAllSummariesCtx(ctx context.Context, ownerUserID string
 			SELECT
 				trip_id,
 				owner_user_id,
-				COUNT(*) AS payment_count,
-				COALESCE(SUM(amount_cents), 0) AS total_cents,
-				COALESCE(SUM(CASE
-					WHEN NOT EXISTS (SELECT 1 FROM invoice_payment_links l WHERE l.payment_id = payments.id) THEN 1
-					ELSE 0
-				END), 0) AS unlinked_pays
-			FROM payments
-			WHERE owner_user_id = ? AND is_draft = 0
+				COUNT(DISTINCT id) AS payment_count,
+				COUNT(DISTINCT CASE
+					WHEN NOT EXISTS (SELECT 1 FROM `+repository.InvoicePaymentPairsTable+` l WHERE l.payment_id = payments.id) THEN id
+				END) AS unlinked_pays
+			FROM `+repository.NetPaymentsTable+`
+			WHERE owner_user_id = ? AND is_draft = 0 AND is_refund = 0
 			GROUP BY owner_user_id, trip_id
 		) p ON p.trip_id = t.id AND p.owner_user_id = t.owner_user_id
 		LEFT JOIN (
 			SELECT
-				p.trip_id AS trip_id,
-				p.owner_user_id AS owner_user_id,
+				payments.trip_id AS trip_id,
+				payments.owner_user_id AS owner_user_id,
 				COUNT(DISTINCT l.invoice_id) AS linked_invoices
-			FROM payments p
-			JOIN invoice_payment_links l ON l.payment_id = p.id
-			WHERE p.owner_user_id = ? AND p.is_draft = 0
-			GROUP BY p.owner_user_id, p.trip_id
+			FROM `+repository.NetPaymentsTable+`
+			JOIN `+repository.InvoicePaymentPairsTable+` l ON l.payment_id = payments.id
+			WHERE payments.owner_user_id = ? AND payments.is_draft = 0 AND payments.is_refund = 0
+			GROUP BY payments.owner_user_id, payments.trip_id
 		) li ON li.trip_id = t.id AND li.owner_user_id = t.owner_user_id
 		WHERE t.owner_user_id = ?
 		ORDER BY t.start_time_ts DESC
 	`, ownerUserID, ownerUserID, ownerUserID).Scan(&out).Error
-	return out, err
+	if err != nil {
+		return nil, err
+	}
+
+	conv, err := newCurrencyConverter(ctx, s.db, ownerUserID)
+	if err != nil {
+		return nil, err
+	}
+	totals, missing, err := convertedTripTotals(db, conv, ownerUserID, "")
+	if err != nil {
+		return nil, err
+	}
+	for i := range out {
+		out[i].Currency = conv.base
+		out[i].TotalAmount = money.ToMajor(totals[out[i].TripID])
+		out[i].MissingRateCurrencies = missing[out[i].TripID]
+	}
+	return out, nil
 }
 
 type TripPaymentInvoice struct {
@@ -428,8 +507,9 @@ func (s *TripService) GetPaymentsCtx(ctx context.Context, ownerUserID string, tr
 			"created_at",
 		}).
 		Where("owner_user_id = ?", ownerUserID).
-		Where("trip_id = ?", tripID).
-		Where("is_draft = 0").
+		Where("id IN (?)", db.Table(repository.NetPaymentsTable).
+			Select("DISTINCT id").
+			Where("owner_user_id = ? AND trip_id = ? AND is_draft = 0 AND is_refund = 0", ownerUserID, tripID)).
 		Order("transaction_time_ts DESC").
 		Find(&payments).Error; err != nil {
 		return nil, err
@@ -454,7 +534,7 @@ func (s *TripService) GetPaymentsCtx(ctx context.Context, ownerUserID string, tr
 	}
 	var links []linkRow
 	if err := db.
-		Table("invoice_payment_links").
+		Table(repository.InvoicePaymentPairsTable+" AS l").
 		Select("payment_id, invoice_id").
 		Where("payment_id IN ?", paymentIDs).
 		Scan(&links).Error; err != nil {
@@ -568,7 +648,7 @@ func (s *TripService) GetCascadePreviewCtx(ctx context.Context, ownerUserID stri
 
 	var invoiceIDs []string
 	if err := db.
-		Table("invoice_payment_links").
+		Table(repository.InvoicePaymentPairsTable+" AS l").
 		Distinct("invoice_id").
 		Where("payment_id IN ?", paymentIDs).
 		Pluck("invoice_id", &invoiceIDs).Error; err != nil {
@@ -581,7 +661,7 @@ func (s *TripService) GetCascadePreviewCtx(ctx context.Context, ownerUserID stri
 	if len(invoiceIDs) > 0 {
 		var stillLinked []string
 		if err := db.
-			Table("invoice_payment_links").
+			Table(repository.InvoicePaymentPairsTable+" AS l").
 			Distinct("invoice_id").
 			Where("invoice_id IN ? AND payment_id NOT IN ?", invoiceIDs, paymentIDs).
 			Pluck("invoice_id", &stillLinked).Error; err != nil {
@@ -671,9 +751,9 @@ func (s *TripService) DeleteWithOptions(ownerUserID string, tripID string, opts
 			}
 
 			if len(paymentIDs) > 0 {
-				// Invoices linked to these payments.
+				// Invoices linked to these payments, directly or through a matched ride.
 				var invoiceIDs []string
-				if err := tx.Table("invoice_payment_links").
+				if err := tx.Table(repository.InvoicePaymentPairsTable+" AS l").
 					Distinct("invoice_id").
 					Where("payment_id IN ?", paymentIDs).
 					Pluck("invoice_id", &invoiceIDs).Error; err != nil {
@@ -685,7 +765,7 @@ func (s *TripService) DeleteWithOptions(ownerUserID string, tripID string, opts
 					remaining := make(map[string]struct{})
 					var stillLinked []string
 					if err := tx.
-						Table("invoice_payment_links").
+						Table(repository.InvoicePaymentPairsTable+" AS l").
 						Distinct("invoice_id").
 						Where("invoice_id IN ? AND payment_id NOT IN ?", invoiceIDs, paymentIDs).
 						Pluck("invoice_id", &stillLinked).Error; err != nil {
@@ -709,6 +789,9 @@ func (s *TripService) DeleteWithOptions(ownerUserID string, tripID string, opts
 						Delete(&models.InvoicePaymentLink{}).Error; err != nil {
 						return err
 					}
+					if err := s.rideRepo.ClearPayments(tx, paymentIDs); err != nil {
+						return err
+					}
 					// Clear legacy payment_id pointers if they reference deleted payments.
 					if err := tx.Model(&models.Invoice{}).
 						Where("id IN ? AND payment_id IN ?", invoiceIDs, paymentIDs).
@@ -723,12 +806,24 @@ func (s *TripService) DeleteWithOptions(ownerUserID string, tripID string, opts
 					for id := range toDelete {
 						toDeleteIDs = append(toDeleteIDs, id)
 					}
+					if err := invoiceTagLink.deleteFor(tx, toDeleteIDs); err != nil {
+						return err
+					}
+					if err := tx.Where("owner_user_id = ? AND invoice_id IN ?", ownerUserID, toDeleteIDs).Delete(&models.InvoiceRide{}).Error; err != nil {
+						return err
+					}
 					if err := tx.Where("owner_user_id = ? AND id IN ?", ownerUserID, toDeleteIDs).Delete(&models.Invoice{}).Error; err != nil {
 						return err
 					}
 				}
 
 				// Delete payments.
+				if err := tx.Where("owner_user_id = ? AND payment_id IN ?", ownerUserID, paymentIDs).Delete(&models.PaymentSplit{}).Error; err != nil {
+					return err
+				}
+				if err := paymentTagLink.deleteFor(tx, paymentIDs); err != nil {
+					return err
+				}
 				if err := tx.Where("owner_user_id = ? AND id IN ?", ownerUserID, paymentIDs).Delete(&models.Payment{}).Error; err != nil {
 					return err
 				}
@@ -748,7 +843,20 @@ func (s *TripService) DeleteWithOptions(ownerUserID string, tripID string, opts
 			}
 		}
 
+		// Splits allocated to the trip lose their trip; auto ones follow their payment again.
+		if err := tx.Model(&models.PaymentSplit{}).
+			Where("owner_user_id = ? AND trip_id = ?", ownerUserID, tripID).
+			Update("trip_id", nil).Error; err != nil {
+			return err
+		}
+		if err := syncAutoSplitTripsTx(tx, ownerUserID, nil); err != nil {
+			return err
+		}
+
 		// Delete trip itself.
+		if err := tripTagLink.deleteFor(tx, []string{tripID}); err != nil {
+			return err
+		}
 		if err := tx.Where("id = ? AND owner_user_id = ?", tripID, ownerUserID).Delete(&models.Trip{}).Error; err != nil {
 			return err
 		}
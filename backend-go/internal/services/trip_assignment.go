@@ -42,13 +42,16 @@ func autoAssignPaymentTx(tx *gorm.DB, ownerUserID string, payment *models.Paymen
 		src = assignSrcAuto
 	}
 	if src == assignSrcBlocked {
-		return tx.Model(&models.Payment{}).
+		if err := tx.Model(&models.Payment{}).
 			Where("id = ? AND owner_user_id = ?", payment.ID, ownerUserID).
 			Updates(map[string]interface{}{
 				"trip_id":                nil,
 				"trip_assignment_source": assignSrcBlocked,
 				"trip_assignment_state":  assignStateBlocked,
-			}).Error
+			}).Error; err != nil {
+			return err
+		}
+		return syncAutoSplitTripsTx(tx, ownerUserID, []string{payment.ID})
 	}
 	if src == assignSrcManual {
 		// Manual is trusted; just ensure state reflects whether it's assigned.
@@ -90,7 +93,8 @@ func autoAssignPaymentTx(tx *gorm.DB, ownerUserID string, payment *models.Paymen
 		return err
 	}
 
-	return nil
+	// Splits left on auto follow the payment's trip.
+	return syncAutoSplitTripsTx(tx, ownerUserID, []string{payment.ID})
 }
 
 func recomputeAutoAssignmentsForRangeTx(tx *gorm.DB, ownerUserID string, startTs, endTs int64) (*AssignmentChangeSummary, []string, error) {
@@ -107,6 +111,7 @@ func recomputeAutoAssignmentsForRangeTx(tx *gorm.DB, ownerUserID string, startTs
 
 	out := &AssignmentChangeSummary{RangeStartTs: startTs, RangeEndTs: endTs}
 	affectedBadDebtTrips := make(map[string]struct{})
+	changedPaymentIDs := make([]string, 0)
 
 	// For auto payments within range, compute how many trips match and the single trip_id when unique.
 	var rows []paymentMatchRow
@@ -164,6 +169,9 @@ func recomputeAutoAssignmentsForRangeTx(tx *gorm.DB, ownerUserID string, startTs
 		if err := tx.Model(&models.Payment{}).Where("id = ?", r.PaymentID).Updates(updates).Error; err != nil {
 			return nil, nil, err
 		}
+		if curTrip != nextTrip {
+			changedPaymentIDs = append(changedPaymentIDs, r.PaymentID)
+		}
 
 		if r.BadDebt {
 			if curTrip != "" {
@@ -175,6 +183,12 @@ func recomputeAutoAssignmentsForRangeTx(tx *gorm.DB, ownerUserID string, startTs
 		}
 	}
 
+	if len(changedPaymentIDs) > 0 {
+		if err := syncAutoSplitTripsTx(tx, ownerUserID, changedPaymentIDs); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	// Count manual/blocked payments that are currently inside overlaps (do not touch them).
 	var manualOverlap int64
 	if err := tx.
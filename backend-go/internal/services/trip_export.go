@@ -3,6 +3,7 @@ package services
 import (
 	"archive/zip"
 	"context"
+	"encoding/csv"
 	"fmt"
 	"io"
 	"os"
@@ -14,15 +15,19 @@ import (
 	"time"
 
 	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/money"
+	"smart-bill-manager/internal/repository"
 )
 
 type tripExportInvoice struct {
 	ID            string
 	OriginalName  string
 	FilePath      string
+	InvoiceType   string
 	InvoiceNumber *string
 	InvoiceDate   *string
 	SellerName    *string
+	AmountCents   *int64
 	CreatedAt     time.Time
 }
 
@@ -58,6 +63,7 @@ func (s *TripService) PrepareTripExportZip(ctx context.Context, ownerUserID stri
 		Select([]string{
 			"id",
 			"merchant",
+			"category",
 			"amount",
 			"amount_cents",
 			"transaction_time",
@@ -66,8 +72,9 @@ func (s *TripService) PrepareTripExportZip(ctx context.Context, ownerUserID stri
 			"created_at",
 		}).
 		Where("owner_user_id = ?", ownerUserID).
-		Where("trip_id = ?", tripID).
-		Where("is_draft = 0").
+		Where("id IN (?)", db.Table(repository.NetPaymentsTable).
+			Select("DISTINCT id").
+			Where("owner_user_id = ? AND trip_id = ? AND is_draft = 0 AND is_refund = 0", ownerUserID, tripID)).
 		Order("transaction_time_ts ASC, id ASC").
 		Find(&payments).Error; err != nil {
 		return nil, err
@@ -81,13 +88,47 @@ func (s *TripService) PrepareTripExportZip(ctx context.Context, ownerUserID stri
 		paymentIDs = append(paymentIDs, p.ID)
 	}
 
+	// Refunds go into their original's folder, and the folder name shows the net amount.
+	var refunds []models.Payment
+	if err := db.Model(&models.Payment{}).
+		Select([]string{"id", "refund_of_id", "amount", "amount_cents", "screenshot_path", "transaction_time_ts"}).
+		Where("owner_user_id = ?", ownerUserID).
+		Where("refund_of_id IN ?", paymentIDs).
+		Where("is_draft = 0").
+		Order("transaction_time_ts ASC, id ASC").
+		Find(&refunds).Error; err != nil {
+		return nil, err
+	}
+	// A split payment is labelled with the part allocated to this trip.
+	type allocationRow struct {
+		PaymentID string
+		Cents     int64
+	}
+	var allocations []allocationRow
+	if err := db.Model(&models.PaymentSplit{}).
+		Select("payment_id, SUM(amount_cents) AS cents").
+		Where("owner_user_id = ? AND trip_id = ? AND payment_id IN ?", ownerUserID, tripID, paymentIDs).
+		Group("payment_id").
+		Scan(&allocations).Error; err != nil {
+		return nil, err
+	}
+	allocatedCents := make(map[string]int64, len(allocations))
+	for _, a := range allocations {
+		allocatedCents[a.PaymentID] = a.Cents
+	}
+	refundsByPayment := make(map[string][]models.Payment, len(refunds))
+	for _, r := range refunds {
+		refundsByPayment[*r.RefundOfID] = append(refundsByPayment[*r.RefundOfID], r)
+	}
+
 	type linkRow struct {
 		PaymentID string
 		InvoiceID string
 	}
+	// An invoice whose itinerary rides were matched to payments of this trip counts as linked to them.
 	var links []linkRow
 	if err := db.
-		Table("invoice_payment_links").
+		Table(repository.InvoicePaymentPairsTable+" AS l").
 		Select("payment_id, invoice_id").
 		Where("payment_id IN ?", paymentIDs).
 		Scan(&links).Error; err != nil {
@@ -115,9 +156,12 @@ func (s *TripService) PrepareTripExportZip(ctx context.Context, ownerUserID stri
 				"id",
 				"original_name",
 				"file_path",
+				"invoice_type",
 				"invoice_number",
 				"invoice_date",
 				"seller_name",
+				"amount",
+				"amount_cents",
 				"created_at",
 			}).
 			Where("owner_user_id = ?", ownerUserID).
@@ -131,9 +175,11 @@ func (s *TripService) PrepareTripExportZip(ctx context.Context, ownerUserID stri
 				ID:            inv.ID,
 				OriginalName:  inv.OriginalName,
 				FilePath:      inv.FilePath,
+				InvoiceType:   inv.InvoiceType,
 				InvoiceNumber: inv.InvoiceNumber,
 				InvoiceDate:   inv.InvoiceDate,
 				SellerName:    inv.SellerName,
+				AmountCents:   inv.AmountCents,
 				CreatedAt:     inv.CreatedAt,
 			}
 		}
@@ -158,6 +204,23 @@ func (s *TripService) PrepareTripExportZip(ctx context.Context, ownerUserID stri
 		}
 	}
 
+	paymentTags, err := paymentTagLink.load(db, ownerUserID, paymentIDs)
+	if err != nil {
+		return nil, err
+	}
+	journeys, err := s.journeyRepo.FindByInvoiceIDsForOwnerCtx(ctx, ownerUserID, invoiceIDs)
+	if err != nil {
+		return nil, err
+	}
+	var rides []models.InvoiceRide
+	if err := db.Model(&models.InvoiceRide{}).
+		Where("owner_user_id = ? AND payment_id IN ?", ownerUserID, paymentIDs).
+		Order("ride_ts ASC, id ASC").
+		Find(&rides).Error; err != nil {
+		return nil, err
+	}
+	allocateTripExportRides(invByID, rides)
+
 	width := len(fmt.Sprintf("%d", len(payments)))
 	if width < 3 {
 		width = 3
@@ -186,6 +249,11 @@ func (s *TripService) PrepareTripExportZip(ctx context.Context, ownerUserID stri
 			var warnings []string
 			_, _ = zw.Create(rootDir + "/")
 
+			// payments.csv lists every folder with its category and tags.
+			index := [][]string{{"序号", "文件夹", "交易时间", "商户", "金额", "分类", "标签"}}
+			// invoices.csv lists the exported invoices grouped by invoice type.
+			invoicePaths := make(map[string][]string, len(invByID))
+
 			for i, p := range payments {
 				if err := ctx.Err(); err != nil {
 					return err
@@ -193,11 +261,33 @@ func (s *TripService) PrepareTripExportZip(ctx context.Context, ownerUserID stri
 				seq := fmt.Sprintf("%0*d", width, i+1)
 				when := formatZipTimeLabel(p.TransactionTime, p.CreatedAt)
 				merchant := sanitizeZipComponent(ptrOrEmpty(p.Merchant), 24)
-				amount := sanitizeZipComponent(fmt.Sprintf("%.2f", p.Amount), 16)
+				netCents := p.AmountCents
+				if cents, ok := allocatedCents[p.ID]; ok {
+					netCents = cents
+				}
+				for _, r := range refundsByPayment[p.ID] {
+					netCents -= r.AmountCents
+				}
+				amount := sanitizeZipComponent(fmt.Sprintf("%.2f", money.ToMajor(netCents)), 16)
 
-				paymentDir := rootDir + "/" + strings.Trim(sanitizeZipComponent(strings.Join([]string{seq, when, merchant, amount}, "_"), 120), "_") + "/"
+				folder := strings.Trim(sanitizeZipComponent(strings.Join([]string{seq, when, merchant, amount}, "_"), 120), "_")
+				paymentDir := rootDir + "/" + folder + "/"
 				_, _ = zw.Create(paymentDir)
 
+				tagNames := make([]string, 0, len(paymentTags[p.ID]))
+				for _, t := range paymentTags[p.ID] {
+					tagNames = append(tagNames, t.Name)
+				}
+				index = append(index, []string{
+					seq,
+					folder,
+					p.TransactionTime,
+					ptrOrEmpty(p.Merchant),
+					fmt.Sprintf("%.2f", money.ToMajor(netCents)),
+					ptrOrEmpty(p.Category),
+					strings.Join(tagNames, ";"),
+				})
+
 				// Payment screenshot (optional)
 				if p.ScreenshotPath != nil && strings.TrimSpace(*p.ScreenshotPath) != "" {
 					stored := strings.TrimSpace(*p.ScreenshotPath)
@@ -209,6 +299,19 @@ func (s *TripService) PrepareTripExportZip(ctx context.Context, ownerUserID stri
 					}
 				}
 
+				for k, r := range refundsByPayment[p.ID] {
+					if r.ScreenshotPath == nil || strings.TrimSpace(*r.ScreenshotPath) == "" {
+						continue
+					}
+					stored := strings.TrimSpace(*r.ScreenshotPath)
+					abs, err := resolveUploadsFilePathAbs(s.uploadsDir, stored)
+					if err != nil {
+						warnings = append(warnings, fmt.Sprintf("refund %s screenshot path invalid: %s (%v)", r.ID, stored, err))
+					} else if err := zipAddFile(ctx, zw, paymentDir+fmt.Sprintf("refund_%02d_screenshot%s", k+1, fileExtOrDefault(stored, ".png")), abs); err != nil {
+						warnings = append(warnings, fmt.Sprintf("refund %s screenshot read failed: %s (%v)", r.ID, stored, err))
+					}
+				}
+
 				// Linked invoices (0..N)
 				invIDs := byPayment[p.ID]
 				invs := make([]tripExportInvoice, 0, len(invIDs))
@@ -263,6 +366,8 @@ func (s *TripService) PrepareTripExportZip(ctx context.Context, ownerUserID stri
 					name := fmt.Sprintf("invoice_%s_%s%s", sub, label, ext)
 					if err := zipAddFile(ctx, zw, paymentDir+name, abs); err != nil {
 						warnings = append(warnings, fmt.Sprintf("invoice %s read failed: %s (%v)", inv.ID, stored, err))
+					} else {
+						invoicePaths[inv.ID] = append(invoicePaths[inv.ID], folder+"/"+name)
 					}
 
 					// Extra invoice attachments (e.g. itinerary PDFs).
@@ -298,6 +403,39 @@ func (s *TripService) PrepareTripExportZip(ctx context.Context, ownerUserID stri
 				}
 			}
 
+			if f, err := zw.Create(rootDir + "/payments.csv"); err == nil {
+				// BOM so spreadsheet apps read the file as UTF-8.
+				_, _ = f.Write([]byte("\ufeff"))
+				cw := csv.NewWriter(f)
+				_ = cw.WriteAll(index)
+			}
+
+			if len(invByID) > 0 {
+				if f, err := zw.Create(rootDir + "/invoices.csv"); err == nil {
+					_, _ = f.Write([]byte("\ufeff"))
+					cw := csv.NewWriter(f)
+					_ = cw.WriteAll(tripExportInvoiceIndex(invByID, invoicePaths))
+				}
+			}
+
+			// rides.csv lists the ride-hailing rides of this trip, which may be part of a larger invoice.
+			if len(rides) > 0 {
+				if f, err := zw.Create(rootDir + "/rides.csv"); err == nil {
+					_, _ = f.Write([]byte("\ufeff"))
+					cw := csv.NewWriter(f)
+					_ = cw.WriteAll(tripExportRideIndex(rides, invByID, loadLocationOrUTC(trip.Timezone)))
+				}
+			}
+
+			// journeys.csv lists the trains and flights of the exported invoices by departure.
+			if len(journeys) > 0 {
+				if f, err := zw.Create(rootDir + "/journeys.csv"); err == nil {
+					_, _ = f.Write([]byte("\ufeff"))
+					cw := csv.NewWriter(f)
+					_ = cw.WriteAll(tripExportJourneyIndex(journeys, invByID, loadLocationOrUTC(trip.Timezone)))
+				}
+			}
+
 			if len(warnings) > 0 {
 				b := []byte(strings.Join(warnings, "\n") + "\n")
 				if f, err := zw.Create(rootDir + "/WARNINGS.txt"); err == nil {
@@ -310,6 +448,150 @@ func (s *TripService) PrepareTripExportZip(ctx context.Context, ownerUserID stri
 	}, nil
 }
 
+// tripExportInvoiceIndex builds the rows of invoices.csv: invoices ordered by type, then date, each
+// type closed by a subtotal row.
+func tripExportInvoiceIndex(invByID map[string]tripExportInvoice, paths map[string][]string) [][]string {
+	invs := make([]tripExportInvoice, 0, len(invByID))
+	for _, inv := range invByID {
+		invs = append(invs, inv)
+	}
+	sort.Slice(invs, func(a, b int) bool {
+		ra, rb := invoiceTypeRank(invs[a].InvoiceType), invoiceTypeRank(invs[b].InvoiceType)
+		if ra != rb {
+			return ra < rb
+		}
+		da, db := invoiceDateKey(invs[a].InvoiceDate), invoiceDateKey(invs[b].InvoiceDate)
+		if da != db {
+			return da < db
+		}
+		return invs[a].ID < invs[b].ID
+	})
+
+	rows := [][]string{{"发票类型", "发票号", "开票日期", "销售方", "金额", "文件"}}
+	var subtotal int64
+	for i, inv := range invs {
+		amount := ""
+		if inv.AmountCents != nil {
+			amount = fmt.Sprintf("%.2f", money.ToMajor(*inv.AmountCents))
+			subtotal += *inv.AmountCents
+		}
+		label := invoiceTypeLabel(inv.InvoiceType)
+		rows = append(rows, []string{
+			label,
+			ptrOrEmpty(inv.InvoiceNumber),
+			ptrOrEmpty(inv.InvoiceDate),
+			ptrOrEmpty(inv.SellerName),
+			amount,
+			strings.Join(paths[inv.ID], ";"),
+		})
+		if i == len(invs)-1 || invoiceTypeRank(invs[i+1].InvoiceType) != invoiceTypeRank(inv.InvoiceType) {
+			rows = append(rows, []string{label + " 小计", "", "", "", fmt.Sprintf("%.2f", money.ToMajor(subtotal)), ""})
+			subtotal = 0
+		}
+	}
+	return rows
+}
+
+// tripExportJourneyIndex builds the rows of journeys.csv: segments ordered by departure, those
+// without a departure time last, with departures shown in loc.
+func tripExportJourneyIndex(segments []models.JourneySegment, invByID map[string]tripExportInvoice, loc *time.Location) [][]string {
+	segs := append([]models.JourneySegment(nil), segments...)
+	sort.SliceStable(segs, func(a, b int) bool {
+		ta, tb := segs[a].DepartureTs, segs[b].DepartureTs
+		if (ta == 0) != (tb == 0) {
+			return tb == 0
+		}
+		return ta < tb
+	})
+
+	rows := [][]string{{"出发时间", "方式", "承运人", "车次/航班", "出发地", "目的地", "座位等级", "乘客", "客票号", "发票号"}}
+	for _, seg := range segs {
+		inv, ok := invByID[seg.InvoiceID]
+		if !ok {
+			// Draft invoices are not exported.
+			continue
+		}
+		departure := ""
+		if seg.DepartureTs > 0 {
+			departure = time.UnixMilli(seg.DepartureTs).In(loc).Format("2006-01-02 15:04")
+		}
+		mode := seg.Mode
+		switch seg.Mode {
+		case JourneyModeRail:
+			mode = "火车"
+		case JourneyModeAir:
+			mode = "飞机"
+		}
+		rows = append(rows, []string{
+			departure,
+			mode,
+			ptrOrEmpty(seg.Carrier),
+			ptrOrEmpty(seg.Number),
+			ptrOrEmpty(seg.Origin),
+			ptrOrEmpty(seg.Destination),
+			ptrOrEmpty(seg.SeatClass),
+			ptrOrEmpty(seg.Passenger),
+			ptrOrEmpty(seg.TicketNumber),
+			ptrOrEmpty(inv.InvoiceNumber),
+		})
+	}
+	return rows
+}
+
+// allocateTripExportRides sets the amount of each invoice with rides in this trip to the sum of those
+// rides, so an invoice covering rides of several trips is only counted for its share.
+func allocateTripExportRides(invByID map[string]tripExportInvoice, rides []models.InvoiceRide) {
+	sums := make(map[string]int64)
+	for _, r := range rides {
+		if r.AmountCents != nil {
+			sums[r.InvoiceID] += *r.AmountCents
+		}
+	}
+	for id, cents := range sums {
+		inv, ok := invByID[id]
+		if !ok {
+			continue
+		}
+		cents := cents
+		inv.AmountCents = &cents
+		invByID[id] = inv
+	}
+}
+
+// tripExportRideIndex builds the rows of rides.csv: rides ordered by boarding time, shown in loc.
+func tripExportRideIndex(rides []models.InvoiceRide, invByID map[string]tripExportInvoice, loc *time.Location) [][]string {
+	rows := [][]string{{"上车时间", "平台", "车型", "城市", "起点", "终点", "里程(km)", "金额", "发票号"}}
+	for _, r := range rides {
+		inv, ok := invByID[r.InvoiceID]
+		if !ok {
+			continue
+		}
+		when := ""
+		if r.RideTs > 0 {
+			when = time.UnixMilli(r.RideTs).In(loc).Format("2006-01-02 15:04")
+		}
+		distance, amount := "", ""
+		if r.DistanceKm != nil {
+			distance = strconv.FormatFloat(*r.DistanceKm, 'f', -1, 64)
+		}
+		if r.AmountCents != nil {
+			amount = fmt.Sprintf("%.2f", money.ToMajor(*r.AmountCents))
+		}
+		rows = append(rows, []string{
+			when,
+			ptrOrEmpty(r.Provider),
+			ptrOrEmpty(r.CarType),
+			ptrOrEmpty(r.City),
+			ptrOrEmpty(r.Origin),
+			ptrOrEmpty(r.Destination),
+			distance,
+			amount,
+			ptrOrEmpty(inv.InvoiceNumber),
+		})
+	}
+	return rows
+}
+
 func zipAddFile(ctx context.Context, zw *zip.Writer, zipPath string, absPath string) error {
 	if err := ctx.Err(); err != nil {
 		return err
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"smart-bill-manager/internal/models"
+	"smart-bill-manager/internal/repository"
+)
+
+// TripJourneyWarning flags a journey segment that does not fit the trip's time range.
+type TripJourneyWarning struct {
+	SegmentID string `json:"segment_id"`
+	InvoiceID string `json:"invoice_id"`
+	Message   string `json:"message"`
+}
+
+// TripJourneySuggestion derives a trip's time range from the journey segments of the invoices linked
+// to its payments. The suggested start is the earliest departure and the suggested end the latest
+// one (tickets carry no arrival time), formatted in the trip's time zone; both are empty when no
+// segment has a departure time.
+type TripJourneySuggestion struct {
+	TripID             string                  `json:"trip_id"`
+	Segments           []models.JourneySegment `json:"segments"`
+	SuggestedStartTime string                  `json:"suggested_start_time,omitempty"`
+	SuggestedEndTime   string                  `json:"suggested_end_time,omitempty"`
+	SuggestedStartTs   int64                   `json:"suggested_start_ts,omitempty"`
+	SuggestedEndTs     int64                   `json:"suggested_end_ts,omitempty"`
+	Warnings           []TripJourneyWarning    `json:"warnings"`
+}
+
+func (s *TripService) GetJourneySuggestion(ownerUserID string, tripID string) (*TripJourneySuggestion, error) {
+	return s.GetJourneySuggestionCtx(context.Background(), ownerUserID, tripID)
+}
+
+func (s *TripService) GetJourneySuggestionCtx(ctx context.Context, ownerUserID string, tripID string) (*TripJourneySuggestion, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ownerUserID = strings.TrimSpace(ownerUserID)
+	trip, err := s.repo.FindByIDForOwnerCtx(ctx, ownerUserID, tripID)
+	if err != nil {
+		return nil, err
+	}
+
+	db := s.db.WithContext(ctx)
+	tripPayments := db.Table(repository.NetPaymentsTable).
+		Select("DISTINCT id").
+		Where("owner_user_id = ? AND trip_id = ? AND is_draft = 0 AND is_refund = 0", ownerUserID, trip.ID)
+	var invoiceIDs []string
+	if err := db.Table("invoice_payment_links AS l").
+		Joins("JOIN invoices i ON i.id = l.invoice_id").
+		Where("l.payment_id IN (?) AND i.owner_user_id = ? AND i.is_draft = 0", tripPayments, ownerUserID).
+		Distinct().
+		Pluck("l.invoice_id", &invoiceIDs).Error; err != nil {
+		return nil, err
+	}
+	segments, err := s.journeyRepo.FindByInvoiceIDsForOwnerCtx(ctx, ownerUserID, invoiceIDs)
+	if err != nil {
+		return nil, err
+	}
+	return suggestTripJourney(trip, segments), nil
+}
+
+// suggestTripJourney orders segments by departure and checks them against the trip's range.
+func suggestTripJourney(trip *models.Trip, segments []models.JourneySegment) *TripJourneySuggestion {
+	sort.SliceStable(segments, func(i, j int) bool {
+		a, b := segments[i].DepartureTs, segments[j].DepartureTs
+		if (a == 0) != (b == 0) {
+			return b == 0
+		}
+		return a < b
+	})
+	out := &TripJourneySuggestion{TripID: trip.ID, Segments: segments, Warnings: []TripJourneyWarning{}}
+	loc := loadLocationOrUTC(trip.Timezone)
+	for _, seg := range segments {
+		if seg.DepartureTs == 0 {
+			continue
+		}
+		if out.SuggestedStartTs == 0 || seg.DepartureTs < out.SuggestedStartTs {
+			out.SuggestedStartTs = seg.DepartureTs
+		}
+		if seg.DepartureTs > out.SuggestedEndTs {
+			out.SuggestedEndTs = seg.DepartureTs
+		}
+		var msg string
+		switch {
+		case trip.StartTimeTs > 0 && seg.DepartureTs < trip.StartTimeTs:
+			msg = "早于行程开始时间"
+		case trip.EndTimeTs > 0 && seg.DepartureTs > trip.EndTimeTs:
+			msg = "晚于行程结束时间"
+		default:
+			continue
+		}
+		out.Warnings = append(out.Warnings, TripJourneyWarning{
+			SegmentID: seg.ID,
+			InvoiceID: seg.InvoiceID,
+			Message:   fmt.Sprintf("%s 出发时间 %s %s", journeySegmentLabel(seg), time.UnixMilli(seg.DepartureTs).In(loc).Format("2006-01-02 15:04"), msg),
+		})
+	}
+	if out.SuggestedStartTs > 0 {
+		out.SuggestedStartTime = time.UnixMilli(out.SuggestedStartTs).In(loc).Format(time.RFC3339)
+		out.SuggestedEndTime = time.UnixMilli(out.SuggestedEndTs).In(loc).Format(time.RFC3339)
+	}
+	return out
+}
+
+// journeySegmentLabel names a segment in messages, e.g. "G1234 北京南-上海虹桥".
+func journeySegmentLabel(seg models.JourneySegment) string {
+	parts := make([]string, 0, 2)
+	if n := strings.TrimSpace(strPtrVal(seg.Number)); n != "" {
+		parts = append(parts, n)
+	}
+	origin, dest := strings.TrimSpace(strPtrVal(seg.Origin)), strings.TrimSpace(strPtrVal(seg.Destination))
+	switch {
+	case origin != "" && dest != "":
+		parts = append(parts, origin+"-"+dest)
+	case origin != "":
+		parts = append(parts, origin)
+	}
+	if len(parts) == 0 {
+		return "行程段"
+	}
+	return strings.Join(parts, " ")
+}
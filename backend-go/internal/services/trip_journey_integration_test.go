@@ -0,0 +1,87 @@
+//go:build cgo
+
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"smart-bill-manager/internal/models"
+)
+
+func TestRailwayJourneysPersistAndSuggestTripTimes(t *testing.T) {
+	db := openServiceTestDB(t)
+	invoices := NewInvoiceService(db, t.TempDir())
+	payments := NewPaymentService(db, t.TempDir())
+	trips := NewTripService(db, t.TempDir())
+
+	trip, _, err := trips.Create("owner-1", CreateTripInput{
+		Name:      "北京出差",
+		StartTime: "2025-11-03T09:00:00+08:00",
+		EndTime:   "2025-11-05T18:00:00+08:00",
+	})
+	if err != nil {
+		t.Fatalf("创建行程失败: %v", err)
+	}
+	payment, err := payments.Create("owner-1", CreatePaymentInput{Amount: 887, TransactionTime: "2025-11-03T02:00:00Z"})
+	if err != nil {
+		t.Fatalf("创建支付失败: %v", err)
+	}
+
+	f := func(v float64) *float64 { return &v }
+	create := func(name string, seg JourneySegment) string {
+		inv, err := invoices.CreateFromExtracted("owner-1", CreateInvoiceInput{
+			Filename:     name,
+			OriginalName: name,
+			FilePath:     "uploads/owner-1/" + name,
+			Source:       "upload",
+			PaymentID:    &payment.ID,
+		}, InvoiceExtractedData{Amount: f(443.5), InvoiceType: InvoiceTypeRailwayTicket, Journeys: []JourneySegment{seg}})
+		if err != nil {
+			t.Fatalf("创建发票失败: %v", err)
+		}
+		return inv.ID
+	}
+	outbound := create("out.pdf", JourneySegment{
+		Mode: JourneyModeRail, Number: "G7", Origin: "南京南", Destination: "北京南",
+		DepartureTime: "2025-11-03T08:15:00+08:00", SeatClass: "二等座", Passenger: "张三",
+	})
+	create("back.pdf", JourneySegment{
+		Mode: JourneyModeRail, Number: "G8", Origin: "北京南", Destination: "南京南",
+		DepartureTime: "2025-11-05T17:00:00+08:00",
+	})
+
+	got, err := invoices.GetByID("owner-1", outbound)
+	if err != nil {
+		t.Fatalf("读取发票失败: %v", err)
+	}
+	if len(got.Journeys) != 1 || strPtrVal(got.Journeys[0].Number) != "G7" || got.Journeys[0].SegmentNo != 1 ||
+		got.Journeys[0].DepartureTs != 1762128900000 || strPtrVal(got.Journeys[0].Passenger) != "张三" {
+		t.Fatalf("行程段保存异常: %#v", got.Journeys)
+	}
+
+	suggestion, err := trips.GetJourneySuggestion("owner-1", trip.ID)
+	if err != nil {
+		t.Fatalf("获取行程时间建议失败: %v", err)
+	}
+	if len(suggestion.Segments) != 2 || strPtrVal(suggestion.Segments[0].Number) != "G7" {
+		t.Fatalf("应按出发时间返回两段行程: %#v", suggestion.Segments)
+	}
+	if suggestion.SuggestedStartTime != "2025-11-03T08:15:00+08:00" || suggestion.SuggestedEndTime != "2025-11-05T17:00:00+08:00" {
+		t.Fatalf("建议时间异常: %s ~ %s", suggestion.SuggestedStartTime, suggestion.SuggestedEndTime)
+	}
+	if len(suggestion.Warnings) != 1 || suggestion.Warnings[0].InvoiceID != outbound || !strings.Contains(suggestion.Warnings[0].Message, "早于行程开始时间") {
+		t.Fatalf("早于行程开始的车次应给出提示: %#v", suggestion.Warnings)
+	}
+
+	if err := invoices.Delete("owner-1", outbound); err != nil {
+		t.Fatalf("删除发票失败: %v", err)
+	}
+	var left int64
+	if err := db.Model(&models.JourneySegment{}).Where("invoice_id = ?", outbound).Count(&left).Error; err != nil {
+		t.Fatalf("统计行程段失败: %v", err)
+	}
+	if left != 0 {
+		t.Fatalf("删除发票应同时删除行程段，剩余 %d", left)
+	}
+}
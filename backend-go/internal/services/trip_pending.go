@@ -160,6 +160,9 @@ func (s *TripService) AssignPendingPayment(ownerUserID string, paymentID, tripID
 	}).Error; err != nil {
 		return err
 	}
+	if err := syncAutoSplitTripsTx(db, ownerUserID, []string{paymentID}); err != nil {
+		return err
+	}
 	return recalcTripBadDebtLocked(s.db, tripID)
 }
 
@@ -170,9 +173,12 @@ func (s *TripService) BlockPendingPayment(ownerUserID string, paymentID string)
 		return fmt.Errorf("owner_user_id and payment_id are required")
 	}
 	db := s.db
-	return db.Model(&models.Payment{}).Where("id = ? AND owner_user_id = ?", paymentID, ownerUserID).Updates(map[string]interface{}{
+	if err := db.Model(&models.Payment{}).Where("id = ? AND owner_user_id = ?", paymentID, ownerUserID).Updates(map[string]interface{}{
 		"trip_id":                nil,
 		"trip_assignment_source": assignSrcBlocked,
 		"trip_assignment_state":  assignStateBlocked,
-	}).Error
+	}).Error; err != nil {
+		return err
+	}
+	return syncAutoSplitTripsTx(db, ownerUserID, []string{paymentID})
 }
@@ -14,7 +14,7 @@ export {
 } from './auth'
 export type { ActAsConfirmInfo } from './auth'
 export { paymentApi } from './payments'
-export { invoiceApi } from './invoices'
+export { invoiceApi, buyerProfileApi } from './invoices'
 export { emailApi } from './email'
 export { tripsApi } from './trips'
 export { dashboardApi } from './dashboard'
@@ -1,6 +1,6 @@
 import api from './client'
 import type { AxiosRequestConfig } from 'axios'
-import type { Invoice, InvoiceAttachment, Payment, ApiResponse, DedupHint } from '@/types'
+import type { Invoice, InvoiceAttachment, InvoiceRide, Payment, ApiResponse, DedupHint, BuyerProfile } from '@/types'
 
 type UploadInvoiceResult = {
   invoice: Invoice
@@ -19,7 +19,7 @@ export type InvoiceOcrTaskResult = {
 
 export const invoiceApi = {
   getAll: (
-    params?: { limit?: number; offset?: number; startDate?: string; endDate?: string; includeDraft?: boolean },
+    params?: { limit?: number; offset?: number; startDate?: string; endDate?: string; includeDraft?: boolean; hasWarnings?: boolean; invoiceType?: string; buyerCheck?: string },
     config?: AxiosRequestConfig,
   ) =>
     api.get<ApiResponse<{ items: Invoice[]; total: number }>>('/invoices', { params, ...(config || {}) }),
@@ -72,7 +72,15 @@ export const invoiceApi = {
     })
   },
   
-  update: (id: string, invoice: (Partial<Invoice> & { confirm?: boolean; force_duplicate_save?: boolean })) =>
+  update: (
+    id: string,
+    invoice: Partial<Invoice> & {
+      confirm?: boolean
+      force_duplicate_save?: boolean
+      buyer_tax_id?: string
+      seller_tax_id?: string
+    },
+  ) =>
     api.put<ApiResponse<void>>(`/invoices/${id}`, invoice),
   
   delete: (id: string) =>
@@ -103,6 +111,14 @@ export const invoiceApi = {
   unlinkPayment: (invoiceId: string, paymentId: string) =>
     api.delete<ApiResponse<void>>(`/invoices/${invoiceId}/unlink-payment?payment_id=${paymentId}`),
 
+  // Match the itinerary rides of an invoice to payments of the same fare
+  matchRides: (invoiceId: string) =>
+    api.post<ApiResponse<{ matched: number; rides: InvoiceRide[] }>>(`/invoices/${invoiceId}/rides/match`),
+
+  // Match one ride to a payment by hand; an empty id clears the match
+  setRidePayment: (invoiceId: string, rideId: string, paymentId: string) =>
+    api.put<ApiResponse<InvoiceRide>>(`/invoices/${invoiceId}/rides/${rideId}/payment`, { payment_id: paymentId }),
+
   getFileBlob: (invoiceId: string, config?: AxiosRequestConfig) =>
     api.get(`/invoices/${invoiceId}/file`, { responseType: 'blob', ...(config || {}) }),
 
@@ -121,3 +137,15 @@ export const invoiceApi = {
   deleteAttachment: (invoiceId: string, attachmentId: string) =>
     api.delete<ApiResponse<void>>(`/invoices/${invoiceId}/attachments/${attachmentId}`),
 }
+
+type BuyerProfileInput = Pick<BuyerProfile, 'name' | 'tax_id' | 'aliases' | 'shared'>
+
+export const buyerProfileApi = {
+  list: () => api.get<ApiResponse<BuyerProfile[]>>('/buyer-profiles'),
+
+  create: (input: BuyerProfileInput) => api.post<ApiResponse<BuyerProfile>>('/buyer-profiles', input),
+
+  update: (id: string, input: BuyerProfileInput) => api.put<ApiResponse<BuyerProfile>>(`/buyer-profiles/${id}`, input),
+
+  delete: (id: string) => api.delete<ApiResponse<void>>(`/buyer-profiles/${id}`),
+}
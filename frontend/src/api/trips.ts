@@ -7,6 +7,7 @@ import type {
   Trip,
   TripSummary,
   TripCascadePreview,
+  TripJourneySuggestion,
   TripPaymentWithInvoices,
 } from '@/types'
 
@@ -36,6 +37,9 @@ export const tripsApi = {
       ...(config || {}),
     }),
 
+  getJourneySuggestion: (id: string, config?: AxiosRequestConfig) =>
+    api.get<ApiResponse<TripJourneySuggestion>>(`/trips/${id}/journey-suggestion`, config),
+
   exportZip: async (id: string, config?: AxiosRequestConfig) =>
     api.get<Blob>(`/trips/${id}/export`, {
       responseType: 'blob',
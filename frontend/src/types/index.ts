@@ -44,6 +44,23 @@ export interface TripSummary {
   unlinked_payments: number;
 }
 
+// Suggested trip range from the journey segments of the trip's invoices (earliest / latest departure).
+export interface TripJourneySuggestion {
+  trip_id: string;
+  segments: JourneySegment[];
+  suggested_start_time?: string;
+  suggested_end_time?: string;
+  suggested_start_ts?: number;
+  suggested_end_ts?: number;
+  warnings: TripJourneyWarning[];
+}
+
+export interface TripJourneyWarning {
+  segment_id: string;
+  invoice_id: string;
+  message: string;
+}
+
 export interface TripCascadePreview {
   trip_id: string;
   payments: number;
@@ -94,6 +111,8 @@ export interface Invoice {
   file_path: string;
   file_size?: number;
   file_sha256?: string;
+  invoice_type?: string;
+  type_details?: InvoiceTypeDetails;
   invoice_number?: string;
   invoice_date?: string;
   amount?: number;
@@ -106,12 +125,43 @@ export interface Invoice {
   parse_error?: string;
   raw_text?: string;
   attachments?: InvoiceAttachment[];
+  line_items?: InvoiceLineItem[];
+  journeys?: JourneySegment[];
+  rides?: InvoiceRide[];
   source?: string;
   dedup_status?: string;
   dedup_ref_id?: string;
+  warnings?: InvoiceWarning[];
+  warning_count?: number;
+  // Result of checking the buyer against the buyer profiles; empty when not checked.
+  buyer_check?: string;
   created_at?: string;
 }
 
+// Fields only some invoice types carry (transport tickets, toll and taxi invoices).
+export interface InvoiceTypeDetails {
+  passenger?: string;
+  ticket_number?: string;
+  plate_number?: string;
+  period_start?: string;
+  period_end?: string;
+  // Price breakdown of an air itinerary.
+  fare?: number;
+  fuel_surcharge?: number;
+  development_fund?: number;
+  other_taxes?: number;
+  total?: number;
+}
+
+export interface InvoiceWarning {
+  code: string;
+  // amount, tax_amount, invoice_number, invoice_date, buyer_tax_id, seller_tax_id or items.N
+  field: string;
+  message: string;
+  // corrected value the user may accept for field (tax_id_checksum)
+  suggestion?: string;
+}
+
 export interface InvoiceAttachment {
   id: string;
   invoice_id: string;
@@ -122,9 +172,76 @@ export interface InvoiceAttachment {
   file_size?: number;
   file_sha256?: string;
   source?: string;
+  // Fares read from an itinerary attachment.
+  type_details?: InvoiceTypeDetails;
   created_at?: string;
 }
 
+export interface InvoiceLineItem {
+  id: string;
+  invoice_id: string;
+  line_no: number;
+  name: string;
+  spec?: string;
+  unit?: string;
+  quantity?: number;
+  unit_price?: number;
+  amount?: number;
+  tax_rate?: number;
+  tax_amount?: number;
+}
+
+// One leg of a transport ticket, e.g. the train ride of a railway e-ticket or a flight of an air itinerary.
+export interface JourneySegment {
+  id: string;
+  invoice_id: string;
+  // Set when the segment was read from an itinerary attachment.
+  attachment_id?: string;
+  segment_no: number;
+  mode: string; // rail | air
+  carrier?: string;
+  number?: string;
+  origin?: string;
+  destination?: string;
+  departure_time?: string;
+  departure_ts: number;
+  seat_class?: string;
+  seat_number?: string;
+  passenger?: string;
+  ticket_number?: string;
+}
+
+// One ride of a ride-hailing itinerary (滴滴/高德 行程单) attached to an invoice.
+export interface InvoiceRide {
+  id: string;
+  invoice_id: string;
+  attachment_id?: string;
+  ride_no: number;
+  provider?: string;
+  car_type?: string;
+  ride_time?: string;
+  ride_ts: number;
+  city?: string;
+  origin?: string;
+  destination?: string;
+  distance_km?: number;
+  amount?: number;
+  // The payment matched to the ride, and that payment's trip.
+  payment_id?: string;
+  trip_id?: string;
+}
+
+// A company invoices may be issued to (发票抬头); shared profiles apply to every user.
+export interface BuyerProfile {
+  id: string;
+  name: string;
+  tax_id: string;
+  aliases: string[];
+  shared: boolean;
+  created_at?: string;
+  updated_at?: string;
+}
+
 export interface DedupCandidate {
   id: string;
   is_draft: boolean;